@@ -0,0 +1,152 @@
+// Package bmp is the API of bitmap for Go programs embedding it: the images
+// the command works on, the colors and comparisons its flags use, the
+// transformations that make a new image without touching the original, and
+// the registration of filters that apply --filter runs like its own. The
+// types are those of the command itself, so images pass between the two
+// without any conversion.
+//
+// # Rounding
+//
+// Every filter computes its result at full precision and quantizes it to a
+// channel value once, at the end, by rounding half away from zero and
+// clamping into the range of the channel, 0-255, or 0-65535 for the 16-bit
+// channels of Wide. Averages of integer sums round the same way. The same
+// input thus gives the same output whatever filter or precision it goes
+// through, and no filter biases its results darker by truncating them:
+// exact filters such as negative are their own inverse at either precision.
+package bmp
+
+import (
+	"io"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+// BMPImage is a decoded image, its pixels in Data from the visual top row
+// down. Pixel is one of its pixels.
+type (
+	BMPImage = core.BMPImage
+	Pixel    = core.Pixel
+)
+
+// CropInfo is the area of an image Cropped keeps: either explicit
+// coordinates from the top-left corner, or a named region and the fraction
+// of the image it covers.
+type CropInfo = core.CropInfo
+
+// ImageStats describes the pixels of an image, as returned by Stats, and
+// ChannelStats one of its channels.
+type (
+	ImageStats   = core.ImageStats
+	ChannelStats = core.ChannelStats
+)
+
+// DiffReport is how two images of the same size differ, as returned by
+// DiffImages. PixelDiff is one of the pixels it lists.
+type (
+	DiffReport = core.DiffReport
+	PixelDiff  = core.PixelDiff
+)
+
+// Error kinds, as in the command: every error of the package wraps one of
+// them where it applies, so callers can tell failures apart with errors.Is.
+var (
+	ErrInvalidParameter  = core.ErrInvalidParameter
+	ErrOutOfBounds       = core.ErrOutOfBounds
+	ErrUnsupported       = core.ErrUnsupported
+	ErrIO                = core.ErrIO
+	ErrDimensionMismatch = core.ErrDimensionMismatch
+)
+
+// NewImage returns a black 24-bit image of the given size.
+func NewImage(width, height int) *BMPImage {
+	return core.NewImage(width, height)
+}
+
+// DecodeImage decodes an image in any of the formats bitmap reads: BMP, PNG,
+// JPEG, PPM and PGM, and the native frames of the command. There is no limit
+// on the size of the image.
+func DecodeImage(data []byte) (*BMPImage, error) {
+	return core.DecodeImage(data)
+}
+
+// LoadImage reads the image file at path and decodes it as DecodeImage does.
+// Failing to read the file is an error of kind ErrIO.
+func LoadImage(path string) (*BMPImage, error) {
+	return core.LoadImage(path)
+}
+
+// DecodeSubsampled decodes the BMP read from r keeping only every factor-th
+// row, and every factor-th pixel of those rows, from the top-left corner:
+// the image a nearest neighbor downscale of the whole one gives, built
+// without decoding the rest. The rows in between are sought over if r is an
+// io.Seeker. A factor of 1 decodes the whole image.
+func DecodeSubsampled(r io.Reader, factor int) (*BMPImage, error) {
+	return core.DecodeSubsampled(r, factor)
+}
+
+// PixelOrders lists the channel orders FromBytes reads.
+var PixelOrders = core.PixelOrders
+
+// FromBytes returns a new w by h image read from buf, where its pixels are
+// tightly packed one byte per channel in order, one of PixelOrders, rows
+// from the top down if topDown is set and from the bottom up otherwise. The
+// alpha channel, if any, is kept unless every pixel is opaque. An unknown
+// order, or a buffer that isn't exactly the size of the image, is an error
+// of kind ErrInvalidParameter.
+func FromBytes(buf []byte, w, h int, order string, topDown bool) (*BMPImage, error) {
+	return core.FromBytes(buf, w, h, order, topDown)
+}
+
+// SaveBMP atomically writes image as a 24-bit BMP into the file filename.
+func SaveBMP(image *BMPImage, filename string) error {
+	return core.SaveBMP(image, filename)
+}
+
+// ParseColor parses a color as the flags of the command take it: #RGB,
+// #RRGGBB, RRGGBB, rgb(r,g,b) with decimal components in 0-255, or one of
+// the 16 basic CSS color names, whatever the case. Anything else is an
+// error of kind ErrInvalidParameter.
+func ParseColor(s string) (Pixel, error) {
+	return core.ParseColor(s)
+}
+
+// Stats returns the statistics of the 8-bit pixels of image: the range,
+// mean and spread of every channel, and the mean, spread and entropy of its
+// luminance. The alpha channel is ignored.
+func Stats(image *BMPImage) ImageStats {
+	return core.Stats(image)
+}
+
+// DiffImages compares a and b pixel by pixel, as bitmap compare does. A pixel
+// counts as different when any of its channels differs by more than
+// tolerance. Images of different dimensions give ErrDimensionMismatch.
+func DiffImages(a, b *BMPImage, tolerance int) (DiffReport, error) {
+	return core.DiffImages(a, b, tolerance)
+}
+
+// Mirrored, Rotated and Cropped return a transformed copy of image and never
+// modify it. The copy shares no memory with image, so that either can be
+// edited without affecting the other, and since image is only read, any
+// number of copies may be made from it concurrently as long as nothing
+// modifies it meanwhile.
+
+// Mirrored returns a copy of image mirrored in the given direction, one of
+// the values of --mirror such as "horizontal" or "v". An unknown direction
+// is an error of kind ErrInvalidParameter.
+func Mirrored(image *BMPImage, direction string) (*BMPImage, error) {
+	return core.Mirrored(image, direction)
+}
+
+// Rotated returns a copy of image rotated clockwise by angle degrees, a
+// multiple of 90; negative angles turn counterclockwise. Any other angle is
+// an error of kind ErrInvalidParameter.
+func Rotated(image *BMPImage, angle int) (*BMPImage, error) {
+	return core.Rotated(image, angle)
+}
+
+// Cropped returns a copy of the area of image given by rect. An area outside
+// the image is an error of kind ErrOutOfBounds.
+func Cropped(image *BMPImage, rect CropInfo) (*BMPImage, error) {
+	return core.Cropped(image, rect)
+}
@@ -0,0 +1,89 @@
+package bmp_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/bmp"
+)
+
+// recorder is a bmp.ProgressSink and a bmp.Logger counting what it receives.
+type recorder struct {
+	progress, messages int
+}
+
+func (r *recorder) OnProgress(stage string, done, total int) { r.progress++ }
+func (r *recorder) Infof(format string, args ...any)         { r.messages++ }
+func (r *recorder) Warnf(format string, args ...any)         { r.messages++ }
+
+var (
+	_ bmp.ProgressSink = (*recorder)(nil)
+	_ bmp.Logger       = (*recorder)(nil)
+)
+
+// TestAPI goes through the package the way a program embedding it would,
+// using each of its entry points on the images of the others.
+func TestAPI(t *testing.T) {
+	const w, h = 4, 2
+	buf := make([]byte, 3*w*h)
+	for i := range buf {
+		buf[i] = byte(i * 10)
+	}
+	image, err := bmp.FromBytes(buf, w, h, bmp.PixelOrders[0], true)
+	if err != nil {
+		t.Fatalf("FromBytes: %v", err)
+	}
+	if got := image.At(0, 0); got != (bmp.Pixel{Red: 0, Green: 10, Blue: 20}) {
+		t.Errorf("FromBytes: the top-left pixel is %v", got)
+	}
+
+	var pipeline *bmp.ParsedPipeline
+	if pipeline, err = bmp.ParsePipeline([]string{"--filter=negative", "--mirror=horizontal"}); err != nil {
+		t.Fatalf("ParsePipeline: %v", err)
+	}
+	var transforms []bmp.Transform = pipeline.Transforms
+	rec := &recorder{}
+	hooks := bmp.Hooks{Progress: rec, Logger: rec}
+	if err := bmp.ApplyTransformationsWith(context.Background(), image, transforms, hooks, w*h); err != nil {
+		t.Fatalf("ApplyTransformationsWith: %v", err)
+	}
+	if rec.progress != len(transforms)+1 || rec.messages != len(transforms) {
+		t.Errorf("the hooks got %d progress reports and %d messages", rec.progress, rec.messages)
+	}
+	if got := image.At(w-1, 0); got != (bmp.Pixel{Red: 255, Green: 245, Blue: 235}) {
+		t.Errorf("ApplyTransformationsWith: the top-right pixel is %v", got)
+	}
+
+	var stats bmp.ImageStats = bmp.Stats(image)
+	var red bmp.ChannelStats = stats.Red
+	if red.Min != 255-byte(3*(w*h-1)*10) || red.Max != 255 {
+		t.Errorf("Stats: red ranges from %d to %d", red.Min, red.Max)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.bmp")
+	if err := bmp.SaveBMP(image, path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	small, err := bmp.DecodeSubsampled(f, 2)
+	if err != nil {
+		t.Fatalf("DecodeSubsampled: %v", err)
+	}
+	if small.InfoHeader.Width != w/2 || small.At(0, 0) != image.At(0, 0) {
+		t.Errorf("DecodeSubsampled: the image is %d wide with %v at the top left", small.InfoHeader.Width, small.At(0, 0))
+	}
+
+	p := bmp.Pixel{Red: 200, Green: 100, Blue: 50}
+	if got := bmp.HSLToRGB(bmp.RGBToHSL(p)); got != p {
+		t.Errorf("HSL round trip of %v gives %v", p, got)
+	}
+	if got := bmp.HSVToRGB(bmp.RGBToHSV(p)); got != p {
+		t.Errorf("HSV round trip of %v gives %v", p, got)
+	}
+}
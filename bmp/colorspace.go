@@ -0,0 +1,30 @@
+package bmp
+
+import "github.com/ab-dauletkhan/bitmap/internal/core"
+
+// Conversions between RGB and the HSL and HSV color spaces, as the filters
+// of the command make them. Hue is in degrees in [0, 360); saturation,
+// lightness and value are in [0, 1]. Grays have a hue and a saturation of 0.
+// Converting to RGB wraps the hue, clamps the other components and rounds
+// every channel to the nearest integer, so any color survives a round trip
+// within ±1 per channel.
+
+// RGBToHSL converts p to hue, saturation and lightness.
+func RGBToHSL(p Pixel) (h, s, l float64) {
+	return core.RGBToHSL(p)
+}
+
+// HSLToRGB converts hue, saturation and lightness to a pixel.
+func HSLToRGB(h, s, l float64) Pixel {
+	return core.HSLToRGB(h, s, l)
+}
+
+// RGBToHSV converts p to hue, saturation and value.
+func RGBToHSV(p Pixel) (h, s, v float64) {
+	return core.RGBToHSV(p)
+}
+
+// HSVToRGB converts hue, saturation and value to a pixel.
+func HSVToRGB(h, s, v float64) Pixel {
+	return core.HSVToRGB(h, s, v)
+}
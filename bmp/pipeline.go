@@ -0,0 +1,46 @@
+package bmp
+
+import (
+	"context"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+// Transform is one step of a pipeline, as parsed from a flag of apply such
+// as --filter=blur:2 or --rotate=90.
+type Transform = core.Transform
+
+// ParsedPipeline is a pipeline of transformations parsed once and applied to
+// any number of images without parsing the flags again. Its Apply and
+// ApplyContext methods only read it, so one pipeline may be applied to
+// several images concurrently.
+type ParsedPipeline = core.ParsedPipeline
+
+// ParsePipeline parses the transformation flags of apply, such as
+// --filter=negative or --crop=10:10:50:50, without the input and output
+// files. Its errors are of kind ErrInvalidParameter.
+func ParsePipeline(args []string) (*ParsedPipeline, error) {
+	return core.ParsePipeline(args)
+}
+
+// ProgressSink receives the progress of an operation: done of the total
+// units of work of its current stage, such as "apply" counting the
+// transformations of a pipeline. Logger receives the messages of an
+// operation: Infof what it did, and Warnf the oddities it worked around.
+type (
+	ProgressSink = core.ProgressSink
+	Logger       = core.Logger
+)
+
+// Hooks holds the ProgressSink and the Logger operations report to, either
+// of which may be nil to discard what it would receive.
+type Hooks = core.Hooks
+
+// ApplyTransformationsWith applies transforms to image in order, stopping
+// once ctx is done, and reports the progress of the pipeline to hooks along
+// with how long each step took. The whole pipeline is validated before any
+// step runs. Unless maxPixels is 0, a step growing the image past maxPixels
+// pixels fails validation with an error of kind ErrOutOfBounds.
+func ApplyTransformationsWith(ctx context.Context, image *BMPImage, transforms []Transform, hooks Hooks, maxPixels int64) error {
+	return core.ApplyTransformationsWith(ctx, image, transforms, hooks, maxPixels)
+}
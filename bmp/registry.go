@@ -0,0 +1,36 @@
+package bmp
+
+import "github.com/ab-dauletkhan/bitmap/internal/core"
+
+// Types of filter parameters, for ParamSchema.Type.
+const (
+	ParamInt    = core.ParamInt
+	ParamFloat  = core.ParamFloat
+	ParamEnum   = core.ParamEnum   // One of Values
+	ParamPoints = core.ParamPoints // Curve points, <in>/<out>,...
+)
+
+// ParamSchema describes a parameter of a filter: its name and type, and the
+// range, values or default it takes. bitmap capabilities lists the schemas
+// of every filter.
+type ParamSchema = core.ParamSchema
+
+// FilterFunc implements a filter added with RegisterFilter. It modifies the
+// 8-bit pixels of image in place, and gets the parameters of the filter by
+// name, with the defaults of the ones not given filled in. Optional
+// parameters without a default are missing from params when not given.
+type FilterFunc = core.FilterFunc
+
+// RegisterFilter adds a filter that apply --filter=name[:param...] runs with
+// fn, whose parameters, in order, are described by params. The arguments are
+// checked against params like those of the built-in filters, and the filter
+// is listed by bitmap capabilities and bitmap help along with them. It takes
+// the opacity suffix and --region too.
+//
+// Names must not contain ':', '=' or ',', nor be those of built-in or
+// already registered filters, which is an error of kind
+// ErrInvalidParameter. It is meant to be called from an init function,
+// before any pipeline is parsed.
+func RegisterFilter(name string, params []ParamSchema, fn FilterFunc) error {
+	return core.RegisterFilter(name, params, fn)
+}
@@ -0,0 +1,94 @@
+//go:build unix
+
+package bitmap
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+// runChild runs the program with args in a child process and returns what
+// it wrote to its standard output and error, along with how it exited.
+func runChild(args ...string) (stdout, stderr string, err error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunHelper$")
+	cmd.Env = append(os.Environ(), runArgsEnv+"="+strings.Join(args, "\n"))
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	return out.String(), errOut.String(), err
+}
+
+func TestPNGNamedBMP(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "photo.bmp")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(in, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// header only shows BMP headers, which a PNG has none of
+	_, stderr, err := runChild("header", in)
+	if err == nil {
+		t.Fatal("header accepted a PNG file")
+	}
+	if want := "invalid file type, expected 'BM': " + in + " has no BMP header to show (it is a png image)"; !strings.Contains(stderr, want) {
+		t.Errorf("stderr %q doesn't say %q", stderr, want)
+	}
+
+	// apply reads the file by its content, whatever its name
+	out := filepath.Join(dir, "out.bmp")
+	if _, stderr, err := runChild("apply", "--filter=negative", in, out); err != nil {
+		t.Fatalf("apply: %v; stderr: %s", err, stderr)
+	}
+	image, err := core.LoadBMP(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := image.InfoHeader.Width, image.InfoHeader.Height; w != 4 || (h != 3 && h != -3) {
+		t.Errorf("the output is %dx%d, want 4x3", w, h)
+	}
+}
+
+func TestHeaderWarningsVerbose(t *testing.T) {
+	// A FileSize of 0 is worked around with a warning
+	var buf bytes.Buffer
+	if err := core.EncodeBMP(&buf, core.NewImage(4, 3)); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	clear(b[2:6])
+	in := filepath.Join(t.TempDir(), "in.bmp")
+	if err := os.WriteFile(in, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	quiet, stderr, err := runChild("header", in)
+	if err != nil {
+		t.Fatalf("header: %v; stderr: %s", err, stderr)
+	}
+	if stderr != "" {
+		t.Errorf("header without --verbose printed %q", stderr)
+	}
+
+	verbose, stderr, err := runChild("header", "--verbose", in)
+	if err != nil {
+		t.Fatalf("header --verbose: %v; stderr: %s", err, stderr)
+	}
+	if want := "Warning: FileSize is 0"; !strings.Contains(stderr, want) {
+		t.Errorf("header --verbose printed %q, want %q", stderr, want)
+	}
+	if verbose != quiet {
+		t.Errorf("--verbose changes the header info:\n%s\nwant:\n%s", verbose, quiet)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build unix
+
+package bitmap
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+func TestApplyLimitsPixelsUnlessAllowHuge(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.bmp")
+	if err := core.SaveBMP(core.NewImage(1, 1), in); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run validates the pipeline without allocating the huge output
+	run := func(flags ...string) (string, error) {
+		args := append(append([]string{"apply", "--dry-run"}, flags...), "--extend=right:100000000", in, filepath.Join(dir, "out.bmp"))
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRunHelper$")
+		cmd.Env = append(os.Environ(), runArgsEnv+"="+strings.Join(args, "\n"))
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stderr.String(), err
+	}
+
+	stderr, err := run()
+	if err == nil {
+		t.Fatal("an output of 100000001 pixels was accepted by default")
+	}
+	for _, want := range []string{"100000001 pixels, more than 100000000", "--allow-huge"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr %q doesn't mention %q", stderr, want)
+		}
+	}
+
+	if stderr, err := run("--allow-huge"); err != nil {
+		t.Errorf("--allow-huge: %v; stderr: %s", err, stderr)
+	}
+}
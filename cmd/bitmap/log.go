@@ -0,0 +1,57 @@
+package bitmap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// progressBarWidth is the number of marks of a full progress bar.
+const progressBarWidth = 30
+
+// reporter is the core.Logger and core.ProgressSink of the command line. It
+// prints messages to w prefixed by their level, Infof ones only if verbose,
+// and draws the progress of each stage as a bar redrawn in place, which a
+// message interrupting it moves to a line of its own.
+type reporter struct {
+	w       io.Writer
+	verbose bool
+	midLine bool // A progress bar is drawn and its line not ended
+}
+
+// stderrLogger returns the reporter printing messages to standard error.
+func stderrLogger(verbose bool) *reporter {
+	return &reporter{w: os.Stderr, verbose: verbose}
+}
+
+func (r *reporter) Infof(format string, args ...any) {
+	if r.verbose {
+		r.printf("Info: "+format, args...)
+	}
+}
+
+func (r *reporter) Warnf(format string, args ...any) {
+	r.printf("Warning: "+format, args...)
+}
+
+// printf prints a message on a line of its own.
+func (r *reporter) printf(format string, args ...any) {
+	if r.midLine {
+		fmt.Fprintln(r.w)
+		r.midLine = false
+	}
+	fmt.Fprintf(r.w, format+"\n", args...)
+}
+
+func (r *reporter) OnProgress(stage string, done, total int) {
+	filled := progressBarWidth
+	if total > 0 {
+		filled = min(done, total) * progressBarWidth / total
+	}
+	fmt.Fprintf(r.w, "\r%-6s [%s%s] %d/%d", stage, strings.Repeat("#", filled), strings.Repeat(" ", progressBarWidth-filled), done, total)
+	r.midLine = done < total
+	if !r.midLine {
+		fmt.Fprintln(r.w)
+	}
+}
@@ -0,0 +1,28 @@
+package bitmap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := &reporter{w: &buf}
+	r.OnProgress("apply", 0, 2)
+	r.Infof("not verbose")
+	r.OnProgress("apply", 1, 2)
+	r.Warnf("odd %s", "file")
+	r.OnProgress("apply", 2, 2)
+	r.OnProgress("encode", 0, 0)
+	r.Warnf("done")
+
+	want := "\rapply  [                              ] 0/2" +
+		"\rapply  [###############               ] 1/2\n" +
+		"Warning: odd file\n" +
+		"\rapply  [##############################] 2/2\n" +
+		"\rencode [##############################] 0/0\n" +
+		"Warning: done\n"
+	if buf.String() != want {
+		t.Errorf("printed\n%q, want\n%q", buf.String(), want)
+	}
+}
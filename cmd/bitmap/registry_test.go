@@ -0,0 +1,81 @@
+package bitmap
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/bmp"
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+func init() {
+	// Marks the size×size top-left corner of the image white
+	one := 1.0
+	params := []bmp.ParamSchema{{Name: "size", Type: bmp.ParamInt, Min: &one, Default: "1", Optional: true}}
+	err := bmp.RegisterFilter("stamp-corner", params, func(image *bmp.BMPImage, params map[string]string) error {
+		size, _ := strconv.Atoi(params["size"])
+		for y := range min(size, len(image.Data)) {
+			for x := range min(size, int(image.InfoHeader.Width)) {
+				image.Set(x, y, bmp.Pixel{Blue: 255, Green: 255, Red: 255})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// runMain runs the program with args, returning what it printed to standard
+// output.
+func runMain(t *testing.T, args ...string) []byte {
+	t.Helper()
+	stdout, osArgs := os.Stdout, os.Args
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Stdout, os.Args = f, append([]string{"bitmap"}, args...)
+	defer func() { os.Stdout, os.Args = stdout, osArgs }()
+
+	Run()
+
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRegisteredFilterThroughCLI(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.bmp")
+	out := filepath.Join(dir, "out.bmp")
+	if err := bmp.SaveBMP(bmp.NewImage(8, 8), in); err != nil {
+		t.Fatal(err)
+	}
+
+	runMain(t, "apply", "--filter=stamp-corner:2", in, out)
+	image, err := bmp.LoadImage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	white := bmp.Pixel{Blue: 255, Green: 255, Red: 255}
+	if image.At(1, 1) != white || image.At(2, 0) != (bmp.Pixel{}) || image.At(0, 2) != (bmp.Pixel{}) {
+		t.Errorf("corner pixels %v %v %v, want a white 2×2 corner", image.At(1, 1), image.At(2, 0), image.At(0, 2))
+	}
+
+	var c core.Capabilities
+	if err := json.Unmarshal(runMain(t, "capabilities", "--json"), &c); err != nil {
+		t.Fatalf("capabilities aren't valid JSON: %v", err)
+	}
+	i := slices.IndexFunc(c.Filters, func(f core.FilterCapability) bool { return f.Name == "stamp-corner" })
+	if i < 0 || len(c.Filters[i].Params) != 1 || c.Filters[i].Params[0].Name != "size" {
+		t.Errorf("capabilities don't list stamp-corner with its size: %+v", c.Filters)
+	}
+}
@@ -1,9 +1,14 @@
 package bitmap
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/ab-dauletkhan/bitmap/internal/core"
+	"github.com/ab-dauletkhan/bitmap/manifest"
+	"github.com/ab-dauletkhan/bitmap/rawdesc"
 )
 
 func Run() {
@@ -28,40 +33,86 @@ func Run() {
 	// If any error occurs (e.g., incorrect arguments or file read error),
 	// the program exits with an appropriate error message.
 	// If flags --help or -h are provided, then prints help message
+	// With --thumbnail, a preview of the image follows the header, as wide as
+	// --width for ASCII previews, with
+	// --comments the comments of the file, and with --encoding-analysis the
+	// size of each BMP encoding of it.
 	case "header":
-		if len(args) != 1 {
-			core.PrintErrorUsageExit(core.ErrIncorrectArgument, "header")
-		}
-
-		// if !strings.HasSuffix(args[0], ".bmp") {
-		// 	if args[0] == "--help" || args[0] == "-h" {
-		// 		core.PrintUsage("header")
-		// 		return
-		// 	} else {
-		// 		core.PrintErrorUsageExit(core.ErrIncorrectArgument, "header")
-		// 	}
-		// }
-
-		if args[0] == "--help" || args[0] == "-h" {
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
 			core.PrintUsage("header")
 			return
 		}
+		opts, file, err := core.ParseHeaderArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "header")
+		}
 
-		bytes, err := os.ReadFile(args[0])
+		bytes, err := os.ReadFile(file)
 		if err != nil {
 			core.PrintErrorExit(err)
 		}
 
+		// The file is recognized by its content, whatever its extension
+		format, err := core.DetectFormat(bytes)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if format != core.InputBMP {
+			core.PrintErrorExit(fmt.Errorf("%w: %s has no BMP header to show (it is a %s image)", core.ErrInvalidFileType, file, format))
+		}
+
 		image, err := core.ParseBMP(bytes)
 		if err != nil {
 			core.PrintErrorExit(err)
 		}
-		core.PrintBMPHeaderInfo(image)
+		core.PrintBMPHeaderInfo(os.Stdout, image)
+		if opts.Verbose {
+			printWarnings(image)
+		}
+		if opts.Comments {
+			if err := core.WriteComments(os.Stdout, image); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+		if opts.EncodingAnalysis {
+			if err := core.PrintEncodingAnalysis(os.Stdout, core.AnalyzeEncoding(image, core.SaveOptions{})); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+		if opts.Thumbnail == core.ThumbnailAuto {
+			opts.Thumbnail = core.DetectThumbnailMode(os.Getenv)
+		}
+		if opts.Thumbnail != "" {
+			if err := core.WriteThumbnail(os.Stdout, image, opts.Thumbnail, opts.Width); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+	// If the "histogram" command is provided, it prints the luminance histogram
+	// of an image as a bar chart fitted to the terminal, or to --width.
+	case "histogram":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("histogram")
+			return
+		}
+		opts, file, err := core.ParseHistogramArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "histogram")
+		}
+
+		image, err := core.LoadImage(file)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.WriteHistogram(os.Stdout, image, opts.Width); err != nil {
+			core.PrintErrorExit(err)
+		}
 
 	// If the "apply" command is provided, it processes various transformation options
 	// (mirror, filter, rotate, crop) and applies them to the input image in sequence.
 	// The command requires an input file and output file as the last two arguments.
-	// All files must be .bmp format.
+	// The input may be a BMP, PNG, JPEG, PPM or PGM file, recognized by its content;
+	// the output format follows the output extension unless --format is given.
 	// If any error occurs during processing (invalid options, file operations, etc.),
 	// the program exits with an appropriate error message.
 	case "apply":
@@ -69,32 +120,779 @@ func Run() {
 			core.PrintUsage("apply")
 			return
 		}
+		opts, args, err := core.ParseApplyOptions(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "apply")
+		}
 		transforms, inFile, outFile, err := core.ParseTransformations(args)
 		if err != nil {
 			core.PrintErrorUsageExit(err, "apply")
 		}
+		if opts.Jobs > 0 {
+			core.Workers = opts.Jobs
+		}
+		if !opts.AllowHuge {
+			opts.MaxPixels = core.DefaultMaxPixels
+		}
+		if opts.Mmap {
+			core.MmapThreshold = 0
+		}
+		if opts.Manifest && outFile == "-" {
+			core.PrintErrorUsageExit(fmt.Errorf("--write-manifest needs an output file, not standard output"), "apply")
+		}
+
+		// Interrupting the program stops the pipeline and cleans up any output that is half written
+		ctx := handleSignals()
+
+		// With --timeout, the whole run stops at the deadline, whatever stage it is in
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+
+		// A dry run only plans the pipeline against the input header
+		if opts.DryRun {
+			if err := core.DryRun(os.Stdout, transforms, inFile, outFile, opts); err != nil {
+				core.PrintErrorExit(allowHugeHint(err))
+			}
+			return
+		}
+
+		// In tiled mode the image is streamed and never fully decoded
+		if opts.TileRows > 0 {
+			err := runStage(ctx, "running the tiled pipeline", func() error {
+				return core.ApplyTiled(transforms, inFile, outFile, opts.TileRows)
+			})
+			if err != nil {
+				exitIfTimedOut(err, opts.Timeout)
+				core.PrintErrorExit(err)
+			}
+			if opts.Manifest {
+				writeManifest(inFile, outFile, opts.Save, transforms)
+			}
+			return
+		}
+
+		// Refuse work that would exceed the memory budget before decoding anything
+		if opts.MaxMemory > 0 {
+			if err := core.CheckMemory(transforms, inFile, opts.MaxMemory, opts.Precision); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+		// Progress is drawn on standard error, and the warnings of the
+		// decoder are only printed with --verbose
+		log := stderrLogger(opts.Verbose)
+		hooks := core.Hooks{Logger: log}
+		if opts.Progress {
+			hooks.Progress = log
+		}
+		parse := core.ParseOptions{MaxPixels: opts.MaxPixels, Hooks: hooks}
+		if !opts.Verbose {
+			parse.Hooks.Logger = nil
+		}
+		// A pipeline starting with pointwise filters maps the colors of a
+		// palettized image instead of its pixels
+		if len(transforms) > 0 && opts.Precision != 16 {
+			filter, _ := transforms[0].Options.(core.FilterOptions)
+			parse.KeepPalette = core.IsPointwise(filter)
+		}
+		opts.Save.Hooks = hooks
+
+		// The input format is detected from its content and the output
+		// format from the extension of outFile unless --format is given
+		var image *core.BMPImage
+		err = runStage(ctx, "loading "+inFile, func() (err error) {
+			if opts.Salvage {
+				image, err = loadSalvaged(inFile, opts.SalvageFill, parse, log)
+			} else {
+				image, err = core.LoadImageWith(inFile, parse)
+			}
+			return err
+		})
+		if err != nil {
+			exitIfTimedOut(err, opts.Timeout)
+			core.PrintErrorExit(allowHugeHint(err))
+		}
+		if opts.Invariants {
+			if err := core.CheckInvariants(image); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+		// In high precision mode filters work on 16-bit channels until the image is saved
+		if opts.Precision == 16 {
+			image.Widen()
+		}
+
+		if err := core.ApplyTransformationsWith(ctx, image, transforms, hooks, opts.MaxPixels); err != nil {
+			exitIfTimedOut(err, opts.Timeout)
+			core.PrintErrorExit(allowHugeHint(err))
+		}
+
+		// The stamp holds the hash of the manifest, so both are made from the same one
+		var m *manifest.Manifest
+		if opts.Manifest || opts.Stamp {
+			if m, err = core.NewManifest(inFile, outFile, core.OutputFormat(outFile, opts.Save), transforms); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+		if opts.Stamp {
+			if opts.Save.Stamp, err = core.NewStamp(m); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+		if opts.PrintSize {
+			save := opts.Save
+			save.Format = core.OutputFormat(outFile, save)
+			fmt.Println(core.FormatOutputSize(core.EncodedSize(image, save)))
+		}
+
+		err = runStage(ctx, "saving "+outFile, func() error {
+			return core.Save(image, outFile, opts.Save)
+		})
+		if err != nil {
+			exitIfTimedOut(err, opts.Timeout)
+			core.PrintErrorExit(err)
+		}
+		if opts.Manifest {
+			if err := core.WriteManifest(m, manifest.Path(outFile)); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+	// If the "compare" command is provided, it loads both images, prints a report
+	// of the differing pixels and exits with status 1 if any were found.
+	// Images of different sizes differ too, while any other error exits with
+	// status 2, so scripts can tell a difference from a failed comparison.
+	// With --by-row, or given row index files, it compares row digests instead.
+	case "compare":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("compare")
+			return
+		}
+		opts, first, second, err := core.ParseCompareArgs(args)
+		if err != nil {
+			core.PrintError(err)
+			core.PrintUsage("compare")
+			os.Exit(2)
+		}
+
+		// Neither image is loaded whole: BMP rows are streamed and hashed
+		if opts.ByRow || core.IsRowIndexFile(first) || core.IsRowIndexFile(second) {
+			compareByRow(first, second, opts)
+			return
+		}
+
+		a, err := core.LoadImage(first)
+		if err != nil {
+			compareFailed(err)
+		}
+		b, err := core.LoadImage(second)
+		if err != nil {
+			compareFailed(err)
+		}
+
+		report, err := core.DiffImages(a, b, opts.Tolerance)
+		if errors.Is(err, core.ErrDimensionMismatch) {
+			core.PrintError(err)
+			os.Exit(1)
+		}
+		if err != nil {
+			compareFailed(err)
+		}
+		core.PrintDiffReport(os.Stdout, report, opts.ShowDiffs)
+		if !report.Equal() {
+			os.Exit(1)
+		}
+
+	// If the "rowhash" command is provided, it writes the CRC-32 of every row
+	// of a BMP file to a row index file for compare, or prints them.
+	case "rowhash":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("rowhash")
+			return
+		}
+		inFile, outFile, err := core.ParseRowHashArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "rowhash")
+		}
+
+		index, err := core.LoadRowIndex(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if outFile == "" {
+			if err := core.PrintRowIndex(os.Stdout, index); err != nil {
+				core.PrintErrorExit(err)
+			}
+			return
+		}
+		handleSignals()
+		if err := core.SaveRowIndex(index, outFile); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "motion" command is provided, it writes a mask of the pixels
+	// that changed between two frames, prints how many did and exits with
+	// status 1 if that is more than --min-change, or 2 on any error.
+	case "motion":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("motion")
+			return
+		}
+		opts, files, err := core.ParseMotionArgs(args)
+		if err != nil {
+			core.PrintError(err)
+			core.PrintUsage("motion")
+			os.Exit(2)
+		}
+		handleSignals()
+
+		prev, err := core.LoadImage(files[0])
+		if err != nil {
+			motionFailed(err)
+		}
+		curr, err := core.LoadImage(files[1])
+		if err != nil {
+			motionFailed(err)
+		}
+		mask, changed, err := core.MotionMask(prev, curr, opts)
+		if err != nil {
+			motionFailed(err)
+		}
+		if err := core.Save(mask, files[2], core.SaveOptions{}); err != nil {
+			motionFailed(err)
+		}
+		fmt.Printf("Changed: %.2f%% of pixels (threshold %d, min change %g%%)\n", changed, opts.Threshold, opts.MinChange)
+		if changed > opts.MinChange {
+			os.Exit(1)
+		}
+
+	// If the "frames" command is provided, it splits the sprite sheet into
+	// the frames of the given grid and writes them to the output directory.
+	case "frames":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("frames")
+			return
+		}
+		opts, inFile, outDir, err := core.ParseFramesArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "frames")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.WriteFrames(image, opts, outDir); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "pyramid" command is provided, it writes the image and
+	// successively halved versions of it to the output directory.
+	case "pyramid":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("pyramid")
+			return
+		}
+		levels, inFile, outDir, err := core.ParsePyramidArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "pyramid")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.WritePyramid(core.Pyramid(image, levels), outDir); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "merge-exposures" command is provided, it loads the bracketed
+	// shots, fuses them and saves the result.
+	case "merge-exposures":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("merge-exposures")
+			return
+		}
+		inFiles, outFile, err := core.ParseMergeArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "merge-exposures")
+		}
+		handleSignals()
 
-		// if !strings.HasSuffix(inFile, ".bmp") || !strings.HasSuffix(outFile, ".bmp") {
-		// 	core.PrintError(core.ErrInvalidFileType)
-		// }
+		images := make([]*core.BMPImage, len(inFiles))
+		for i, path := range inFiles {
+			if images[i], err = core.LoadImage(path); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+		merged, err := core.MergeExposures(images)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.Save(merged, outFile, core.SaveOptions{}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "align-channels" command is provided, it lines the red and blue
+	// plates of a color separation up with the green one, merges the three,
+	// prints the offsets found and saves the result.
+	case "align-channels":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("align-channels")
+			return
+		}
+		opts, inFiles, outFile, err := core.ParseAlignChannelsArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "align-channels")
+		}
+		handleSignals()
+
+		var plates [3]*core.BMPImage
+		for i, path := range inFiles {
+			if plates[i], err = core.LoadImage(path); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+		aligned, offsets, err := core.AlignChannels(plates[0], plates[1], plates[2], opts)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.PrintChannelOffsets(os.Stdout, offsets); err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.Save(aligned, outFile, core.SaveOptions{}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "dump" command is provided, it prints the stored bytes of a row
+	// of the bitmap, read straight from the file.
+	case "dump":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("dump")
+			return
+		}
+		opts, inFile, err := core.ParseDumpArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "dump")
+		}
 
 		bytes, err := os.ReadFile(inFile)
 		if err != nil {
 			core.PrintErrorExit(err)
 		}
+		if err := core.DumpRow(os.Stdout, bytes, opts); err != nil {
+			core.PrintErrorExit(err)
+		}
 
-		image, err := core.ParseBMP(bytes)
+	// If the "orient" command is provided, it flips the image to the
+	// orientation that best matches the reference and saves it.
+	case "orient":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("orient")
+			return
+		}
+		opts, inFile, outFile, err := core.ParseOrientArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "orient")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		reference, err := core.LoadImage(opts.Reference)
 		if err != nil {
 			core.PrintErrorExit(err)
 		}
 
-		if err := core.ApplyTransformations(image, transforms); err != nil {
+		result := core.FindOrientation(image, reference)
+		core.PrintOrientReport(os.Stdout, stderrLogger(false), result, opts.Threshold)
+		core.Orient(image, result.Orientation)
+		if err := core.Save(image, outFile, core.SaveOptions{}); err != nil {
 			core.PrintErrorExit(err)
 		}
 
-		if err := core.SaveBMP(image, outFile); err != nil {
+	// If the "blobs" command is provided, it labels the connected regions of
+	// the thresholded image and prints their statistics.
+	case "blobs":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("blobs")
+			return
+		}
+		opts, inFile, err := core.ParseBlobsArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "blobs")
+		}
+		if opts.LabelOutput != "" {
+			handleSignals()
+		}
+
+		image, err := core.LoadImage(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		blobs, labels := core.FindBlobs(image, opts)
+		if err := core.PrintBlobs(os.Stdout, blobs, opts.JSON); err != nil {
 			core.PrintErrorExit(err)
 		}
+		if opts.LabelOutput != "" {
+			if err := core.Save(core.LabelImage(labels), opts.LabelOutput, core.SaveOptions{}); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+	// If the "suggest-crop" command is provided, it prints the crop of the
+	// requested aspect ratio that keeps the most detail, or applies it.
+	case "suggest-crop":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("suggest-crop")
+			return
+		}
+		opts, inFile, err := core.ParseSuggestCropArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "suggest-crop")
+		}
+		if opts.Apply != "" {
+			handleSignals()
+		}
+
+		image, err := core.LoadImage(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		crop := core.SuggestCrop(image, opts)
+		if opts.Apply == "" {
+			fmt.Printf("--crop=%d-%d-%d-%d\n", crop.OffsetX, crop.OffsetY, crop.Width, crop.Height)
+			return
+		}
+		if err := core.Crop(image, crop); err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.Save(image, opts.Apply, core.SaveOptions{}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "stereo" command is provided, it splits a stereo image into its
+	// views, joins two views into one, or makes a red/cyan anaglyph.
+	case "stereo":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("stereo")
+			return
+		}
+		opts, files, err := core.ParseStereoArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "stereo")
+		}
+		handleSignals()
+
+		inFiles, outFiles := files[:len(files)-1], files[len(files)-1:]
+		if opts.Action == core.StereoSplit {
+			inFiles, outFiles = files[:1], files[1:]
+		}
+		images := make([]*core.BMPImage, len(inFiles))
+		for i, path := range inFiles {
+			if images[i], err = core.LoadImage(path); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+		var results []*core.BMPImage
+		switch opts.Action {
+		case core.StereoSplit:
+			left, right, err := core.SplitStereo(images[0], opts.Layout)
+			if err != nil {
+				core.PrintErrorExit(err)
+			}
+			results = []*core.BMPImage{left, right}
+		case core.StereoJoin:
+			joined, err := core.JoinStereo(images[0], images[1], opts.Layout)
+			if err != nil {
+				core.PrintErrorExit(err)
+			}
+			results = []*core.BMPImage{joined}
+		case core.StereoAnaglyph:
+			// A single input holds both views
+			if len(images) == 1 {
+				left, right, err := core.SplitStereo(images[0], opts.Layout)
+				if err != nil {
+					core.PrintErrorExit(err)
+				}
+				images = []*core.BMPImage{left, right}
+			}
+			anaglyph, err := core.Anaglyph(images[0], images[1])
+			if err != nil {
+				core.PrintErrorExit(err)
+			}
+			results = []*core.BMPImage{anaglyph}
+		}
+		for i, image := range results {
+			if err := core.Save(image, outFiles[i], core.SaveOptions{}); err != nil {
+				core.PrintErrorExit(err)
+			}
+		}
+
+	// If the "mosaic" command is provided, it rebuilds an image out of the
+	// tiles of a library.
+	case "mosaic":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("mosaic")
+			return
+		}
+		opts, files, err := core.ParseMosaicArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "mosaic")
+		}
+		handleSignals()
+
+		lib, err := core.LoadTileLibrary(opts.Tiles, opts.Cell)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		image, err := core.LoadImage(files[0])
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		core.Mosaic(image, lib)
+		if err := core.Save(image, files[1], core.SaveOptions{}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "stamp" command is provided, it prints the provenance stamp of a
+	// file written by apply --stamp.
+	case "stamp":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("stamp")
+			return
+		}
+		if len(args) != 2 || args[0] != "read" {
+			core.PrintErrorUsageExit(core.ErrIncorrectArgument, "stamp")
+		}
+
+		stamp, err := core.ReadStampFile(args[1])
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		fmt.Printf("Stamp version %d, manifest hash %s\n", stamp.Version, stamp)
+
+	// If the "generate" command is provided, it writes a test pattern.
+	case "generate":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("generate")
+			return
+		}
+		opts, outFile, err := core.ParseGenerateArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "generate")
+		}
+		handleSignals()
+
+		if err := core.Save(core.GeneratePattern(opts), outFile, core.SaveOptions{}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "verify-pattern" command is provided, it checks a captured test
+	// pattern and exits with status 1 if it is damaged, or 2 if it can't be read.
+	case "verify-pattern":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("verify-pattern")
+			return
+		}
+		if len(args) != 1 {
+			core.PrintError(core.ErrIncorrectArgument)
+			core.PrintUsage("verify-pattern")
+			os.Exit(2)
+		}
+
+		image, err := core.LoadImage(args[0])
+		if err != nil {
+			core.PrintError(err)
+			os.Exit(2)
+		}
+		report := core.VerifyPattern(image)
+		core.PrintPatternReport(os.Stdout, report)
+		if !report.OK() {
+			os.Exit(1)
+		}
+
+	// If the "export-raw" command is provided, it writes the pixels of the
+	// image as a raw dump with a JSON descriptor of their layout alongside.
+	case "export-raw":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("export-raw")
+			return
+		}
+		channels, inFile, outFile, err := core.ParseExportRawArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "export-raw")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.ExportRaw(image, outFile, channels); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "import-raw" command is provided, it reads a raw dump laid out
+	// as its descriptor says and saves it as an image.
+	case "import-raw":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("import-raw")
+			return
+		}
+		descFile, inFile, outFile, err := core.ParseImportRawArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "import-raw")
+		}
+		handleSignals()
+
+		desc, err := rawdesc.Read(descFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		image, err := core.ImportRaw(desc, inFile)
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.Save(image, outFile, core.SaveOptions{}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "alpha" command is provided, it writes the alpha channel of an
+	// image as a grayscale mask, or sets it from one.
+	case "alpha":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("alpha")
+			return
+		}
+		op, files, err := core.ParseAlphaArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "alpha")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(files[0])
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if op == "extract" {
+			if err := core.Save(core.ExtractAlpha(image), files[1], core.SaveOptions{}); err != nil {
+				core.PrintErrorExit(err)
+			}
+			return
+		}
+		mask, err := core.LoadImage(files[1])
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.ApplyAlpha(image, mask); err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.Save(image, files[2], core.AlphaSaveOptions(files[2])); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "canonicalize" command is provided, it rewrites an image as a
+	// canonical bmp24 file.
+	case "canonicalize":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("canonicalize")
+			return
+		}
+		if len(args) != 2 {
+			core.PrintErrorUsageExit(core.ErrIncorrectArgument, "canonicalize")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(args[0])
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.Save(image, args[1], core.SaveOptions{Format: core.FormatBMP24, Canonical: true}); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "clipboard" command is provided, it saves the image on the
+	// clipboard to a BMP file, or puts an image file on the clipboard.
+	case "clipboard":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("clipboard")
+			return
+		}
+		action, file, err := core.ParseClipboardArgs(args)
+		if err != nil {
+			core.PrintErrorUsageExit(err, "clipboard")
+		}
+
+		if action == "paste" {
+			handleSignals()
+			err = core.PasteClipboard(core.SystemClipboard, file)
+		} else {
+			err = core.CopyClipboard(core.SystemClipboard, file)
+		}
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "interactive" command is provided, it loads the image and runs
+	// the commands read from standard input on it until quit.
+	case "interactive":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("interactive")
+			return
+		}
+		if len(args) != 1 {
+			core.PrintErrorUsageExit(core.ErrIncorrectArgument, "interactive")
+		}
+		handleSignals()
+
+		image, err := core.LoadImage(args[0])
+		if err != nil {
+			core.PrintErrorExit(err)
+		}
+		if err := core.NewSession(image).Run(os.Stdin, os.Stdout); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "capabilities" command is provided, it describes the formats,
+	// filters, transformations and limits this build supports.
+	case "capabilities":
+		if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+			core.PrintUsage("capabilities")
+			return
+		}
+		if len(args) > 1 || len(args) == 1 && args[0] != "--json" {
+			core.PrintErrorUsageExit(core.ErrIncorrectArgument, "capabilities")
+		}
+
+		if err := core.WriteCapabilities(os.Stdout, len(args) == 1); err != nil {
+			core.PrintErrorExit(err)
+		}
+
+	// If the "help" command is provided, it prints the help topic of the
+	// given flag or filter, or the usage of the given command, or lists the
+	// topics if none is given.
+	case "help":
+		switch len(args) {
+		case 0:
+			core.PrintHelpTopics(os.Stdout)
+		case 1:
+			if err := core.PrintHelpTopic(os.Stdout, args[0]); err != nil {
+				core.PrintErrorExit(err)
+			}
+		default:
+			core.PrintErrorUsageExit(core.ErrIncorrectArgument, "main")
+		}
 
 	case "--help", "-h":
 		core.PrintUsage()
@@ -103,3 +901,104 @@ func Run() {
 		core.PrintErrorUsageExit(core.ErrUnknownCmd, "main")
 	}
 }
+
+// compareByRow compares the row digests of two BMP or row index files, as
+// compare --by-row does, and exits with the status of compare.
+func compareByRow(first, second string, opts core.CompareOptions) {
+	if opts.Tolerance > 0 || opts.ShowDiffs > 0 {
+		core.PrintError(fmt.Errorf("--tolerance and --diffs don't apply to row index files"))
+		core.PrintUsage("compare")
+		os.Exit(2)
+	}
+	a, err := core.LoadRowIndex(first)
+	if err != nil {
+		compareFailed(err)
+	}
+	b, err := core.LoadRowIndex(second)
+	if err != nil {
+		compareFailed(err)
+	}
+
+	rows, err := core.DiffRows(a, b)
+	if err != nil {
+		core.PrintError(err)
+		os.Exit(1)
+	}
+	core.PrintRowDiff(os.Stdout, rows, a.Height)
+	if len(rows) > 0 {
+		os.Exit(1)
+	}
+}
+
+// compareFailed reports an error that kept compare from comparing the images
+// and exits with status 2. I/O errors name the file as the OS reported it,
+// anything else is a problem with the image itself.
+func compareFailed(err error) {
+	if !errors.Is(err, core.ErrIO) {
+		err = fmt.Errorf("cannot compare: %w", err)
+	}
+	core.PrintError(err)
+	os.Exit(2)
+}
+
+// writeManifest writes the manifest of an apply run next to its output.
+func writeManifest(inFile, outFile string, save core.SaveOptions, transforms []core.Transform) {
+	m, err := core.NewManifest(inFile, outFile, core.OutputFormat(outFile, save), transforms)
+	if err != nil {
+		core.PrintErrorExit(err)
+	}
+	if err := core.WriteManifest(m, manifest.Path(outFile)); err != nil {
+		core.PrintErrorExit(err)
+	}
+}
+
+// printWarnings prints the warnings of the decoder about image to standard
+// error.
+func printWarnings(image *core.BMPImage) {
+	for _, warning := range image.Warnings {
+		stderrLogger(false).Warnf("%s", warning)
+	}
+}
+
+// motionFailed reports an error that kept motion from comparing the frames
+// and exits with status 2, as status 1 means they changed.
+func motionFailed(err error) {
+	core.PrintError(err)
+	os.Exit(2)
+}
+
+// loadSalvaged loads the input of apply --salvage with opts, as
+// core.DecodeImageWith does. A truncated BMP is decoded as far as it goes,
+// with a warning to log telling how much of it was missing.
+func loadSalvaged(path string, fill core.Pixel, opts core.ParseOptions, log core.Logger) (*core.BMPImage, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format, err := core.DetectFormat(bytes); err != nil || format != core.InputBMP {
+		return core.DecodeImageWith(bytes, opts)
+	}
+
+	image, present, err := core.SalvageBMP(bytes, fill, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Hooks.Logger != nil {
+		for _, warning := range image.Warnings {
+			opts.Hooks.Logger.Warnf("%s", warning)
+		}
+	}
+	if total := len(image.Data); present < total {
+		log.Warnf("%v; filled the missing %d rows", &core.TruncatedError{Present: present, Total: total}, total-present)
+	}
+	return image, nil
+}
+
+// allowHugeHint adds to an error about an image over the pixel limit of apply
+// the flag that lifts it.
+func allowHugeHint(err error) error {
+	if errors.Is(err, core.ErrPixelLimit) {
+		return fmt.Errorf("%w (use --allow-huge to lift it)", err)
+	}
+	return err
+}
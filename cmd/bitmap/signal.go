@@ -0,0 +1,35 @@
+package bitmap
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+// exitInterrupted is the exit status used when the program is stopped by a signal.
+const exitInterrupted = 130
+
+// handleSignals returns a context that is cancelled on SIGINT or SIGTERM.
+// It is installed by the commands that write outputs; the others keep the
+// default behavior of dying on the spot, having nothing to clean up.
+// When a signal arrives, the context is cancelled so a running pipeline stops,
+// the temporary files of outputs still being written are removed, and the
+// program exits with status 130. Existing outputs are never touched, since
+// they are only replaced once a new file is complete.
+func handleSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+		core.AbortOutputs()
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package bitmap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+// runArgsEnv holds the arguments, one per line, that TestRunHelper runs the
+// program with in a child process.
+const runArgsEnv = "BITMAP_TEST_RUN_ARGS"
+
+// TestRunHelper is not a test: it runs the program in the child processes
+// started by the other tests, so they can send it signals.
+func TestRunHelper(t *testing.T) {
+	args := os.Getenv(runArgsEnv)
+	if args == "" {
+		t.Skip("only runs as a child process")
+	}
+	os.Args = append([]string{"bitmap"}, strings.Split(args, "\n")...)
+	Run()
+	os.Exit(0)
+}
+
+func TestInterruptRemovesPartialOutput(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.bmp")
+	out := filepath.Join(dir, "out.bmp")
+
+	// The input is a pipe fed by the test, so the save stalls halfway
+	// through the pixels for as long as the test wants
+	if err := syscall.Mkfifo(in, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunHelper$")
+	cmd.Env = append(os.Environ(), runArgsEnv+"="+strings.Join([]string{"apply", "--tiled=1", "--filter=blur:1", in, out}, "\n"))
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	fifo, err := os.OpenFile(in, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fifo.Close()
+
+	var src bytes.Buffer
+	if err := core.EncodeBMP(&src, core.NewImage(64, 64)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fifo.Write(src.Bytes()[:src.Len()/2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the output to be in flight before interrupting
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		tmp, _ := filepath.Glob(filepath.Join(dir, ".out.bmp.*.tmp"))
+		if len(tmp) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			t.Fatal("the output was never created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitInterrupted {
+		t.Errorf("child exited with %v, want status %d", err, exitInterrupted)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "in.bmp" {
+			t.Errorf("stray file left behind: %s", e.Name())
+		}
+	}
+}
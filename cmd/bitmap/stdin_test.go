@@ -0,0 +1,100 @@
+//go:build unix
+
+package bitmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+	"github.com/ab-dauletkhan/bitmap/manifest"
+)
+
+// runPiped runs the program with args in a child process, with input on its
+// standard input, and returns its standard output.
+func runPiped(t *testing.T, input []byte, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunHelper$")
+	cmd.Env = append(os.Environ(), runArgsEnv+"="+strings.Join(args, "\n"))
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%s: %v; stderr: %s", strings.Join(args, " "), err, &stderr)
+	}
+	return stdout.String()
+}
+
+func TestApplyOptionsReadStdinInput(t *testing.T) {
+	var input bytes.Buffer
+	if err := core.EncodeBMP(&input, core.NewImage(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(input.Bytes())
+
+	tests := []struct {
+		name  string
+		flags []string
+		check func(t *testing.T, stdout, out string)
+	}{
+		{"dry run", []string{"--dry-run"}, func(t *testing.T, stdout, out string) {
+			if !strings.Contains(stdout, "Input: - (8x8)") {
+				t.Errorf("the plan doesn't describe the piped image: %q", stdout)
+			}
+		}},
+		{"max memory", []string{"--max-memory=1GB"}, nil},
+		{"tiled", []string{"--tiled"}, nil},
+		{"manifest", []string{"--write-manifest"}, func(t *testing.T, stdout, out string) {
+			m, err := manifest.Read(manifest.Path(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Input != "-" || m.InputSHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("manifest input %s with hash %s, want - with the hash of the piped bytes", m.Input, m.InputSHA256)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.bmp")
+			args := append(append([]string{"apply"}, tt.flags...), "--filter=blur:1", "-", out)
+			stdout := runPiped(t, input.Bytes(), args...)
+			if tt.check != nil {
+				tt.check(t, stdout, out)
+			}
+			if tt.name != "dry run" {
+				if _, err := core.LoadBMP(out); err != nil {
+					t.Errorf("output: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStampPipedInput(t *testing.T) {
+	var input bytes.Buffer
+	if err := core.EncodeBMP(&input, core.NewImage(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out.bmp")
+	runPiped(t, input.Bytes(), "apply", "--stamp", "--write-manifest", "--filter=negative", "-", out)
+
+	stamp, err := core.ReadStampFile(out)
+	if err != nil {
+		t.Fatalf("ReadStampFile: %v", err)
+	}
+	data, err := os.ReadFile(manifest.Path(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(stamp.Hash[:], sum[:len(stamp.Hash)]) {
+		t.Errorf("the stamp hash %x isn't that of the manifest of the run, %x", stamp.Hash, sum[:len(stamp.Hash)])
+	}
+}
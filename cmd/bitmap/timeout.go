@@ -0,0 +1,47 @@
+package bitmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+// exitTimeout is the exit status used when apply runs out of the time given
+// with --timeout, the one the timeout command uses.
+const exitTimeout = 124
+
+// runStage runs fn, the stage of a run described by stage, such as "loading
+// in.bmp". If ctx is done first, fn is abandoned and the context's error is
+// returned, naming the stage. Stages that write outputs leave them to be
+// cleaned up by core.AbortOutputs.
+func runStage(ctx context.Context, stage string, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", stage, ctx.Err())
+	}
+}
+
+// exitIfTimedOut exits with status exitTimeout if err is due to the run
+// taking longer than timeout, after removing the temporary files of outputs
+// still being written. err names what was running at the time, e.g. the
+// transformation. Other errors are left to the caller.
+func exitIfTimedOut(err error, timeout time.Duration) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	core.AbortOutputs()
+	core.PrintError(fmt.Errorf("timed out after %v: %w", timeout, err))
+	os.Exit(exitTimeout)
+}
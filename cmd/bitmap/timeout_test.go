@@ -0,0 +1,73 @@
+//go:build unix
+
+package bitmap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/bitmap/internal/core"
+)
+
+func TestTimeoutAbortsSlowTransform(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.bmp")
+	out := filepath.Join(dir, "out.bmp")
+	if err := core.SaveBMP(core.NewImage(16, 16), in); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mask is a pipe fed once, for the validation to read its header, so
+	// reading it again blocks the transformation until the timeout stops it.
+	// It is a PPM file since the header of one is read in a single open
+	mask := filepath.Join(dir, "mask.ppm")
+	if err := syscall.Mkfifo(mask, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if fifo, err := os.OpenFile(mask, os.O_WRONLY, 0); err == nil {
+			fifo.Write(append([]byte("P6\n16 16\n255\n"), make([]byte, 16*16*3)...))
+			fifo.Close()
+		}
+	}()
+
+	args := []string{"apply", "--timeout=50ms", "--filter=grayscale", "--pixelate-mask=" + mask + ":4", in, out}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunHelper$")
+	cmd.Env = append(os.Environ(), runArgsEnv+"="+strings.Join(args, "\n"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	timer := time.AfterFunc(10*time.Second, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitTimeout {
+		t.Fatalf("child exited with %v after %v, want status %d; stderr: %s", err, time.Since(start), exitTimeout, &stderr)
+	}
+	for _, want := range []string{"timed out after 50ms", "transform 2 (pixelate-mask " + mask + ":4)", "deadline exceeded"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr %q doesn't mention %q", stderr.String(), want)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "in.bmp" && e.Name() != "mask.ppm" {
+			t.Errorf("stray file left behind: %s", e.Name())
+		}
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/ab-dauletkhan/bitmap
 
 go 1.23.1
+
+require golang.org/x/image v0.30.0
@@ -0,0 +1,244 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AffineOptions stores a 2x3 affine matrix [[a b c] [d e f]] mapping a point
+// (x, y) of the image to (a*x + b*y + c, d*x + e*y + f) of the output, with
+// coordinates measured from the visual top-left corner, y pointing down.
+type AffineOptions struct {
+	Matrix     [6]float64 // a, b, c, d, e, f
+	Fit        bool       // Size the output to the bounding box of the transformed image instead of keeping the size
+	Background Pixel      // Color of the output pixels no pixel of the image maps to
+}
+
+// Validate rejects fitted outputs too large for a BMP header.
+func (o AffineOptions) Validate(width, height int) error {
+	if !o.Fit {
+		return nil
+	}
+	if minX, minY, maxX, maxY := o.bounds(width, height); maxX-minX > math.MaxInt32 || maxY-minY > math.MaxInt32 {
+		return withKind(ErrOutOfBounds, fmt.Errorf("affine output of %gx%g is too large", maxX-minX, maxY-minY))
+	}
+	return nil
+}
+
+// Dimensions returns the size of the image, or that of the bounding box of
+// the transformed image with Fit.
+func (o AffineOptions) Dimensions(width, height int) (int, int) {
+	if !o.Fit {
+		return width, height
+	}
+	minX, minY, maxX, maxY := o.bounds(width, height)
+	return max(int(maxX-minX), 1), max(int(maxY-minY), 1)
+}
+
+// MemoryMultiplier is 2 since the output is sampled into new rows.
+func (o AffineOptions) MemoryMultiplier() int { return 2 }
+
+func (o AffineOptions) String() string {
+	m := make([]string, len(o.Matrix))
+	for i, v := range o.Matrix {
+		m[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	name := "affine"
+	if o.Fit {
+		name = "affine-fit"
+	}
+	return name + " " + strings.Join(m, ",")
+}
+
+// bounds returns the bounding box of the transformed image, widened to whole
+// pixels.
+func (o AffineOptions) bounds(width, height int) (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, c := range [][2]float64{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+		x, y := o.apply(c[0], c[1])
+		minX, minY = min(minX, x), min(minY, y)
+		maxX, maxY = max(maxX, x), max(maxY, y)
+	}
+	return math.Floor(snap(minX)), math.Floor(snap(minY)), math.Ceil(snap(maxX)), math.Ceil(snap(maxY))
+}
+
+// apply maps the point (x, y) of the image to the output.
+func (o AffineOptions) apply(x, y float64) (float64, float64) {
+	m := o.Matrix
+	return m[0]*x + m[1]*y + m[2], m[3]*x + m[4]*y + m[5]
+}
+
+// inverse returns the matrix mapping the output back to the image.
+func (o AffineOptions) inverse() [6]float64 {
+	a, b, c, d, e, f := o.Matrix[0], o.Matrix[1], o.Matrix[2], o.Matrix[3], o.Matrix[4], o.Matrix[5]
+	det := a*e - b*d
+	return [6]float64{
+		e / det, -b / det, (b*f - c*e) / det,
+		-d / det, a / det, (c*d - a*f) / det,
+	}
+}
+
+// parseAffineOptions parses an affine value of the form a,b,c,d,e,f
+// optionally followed by :<color> for the background, as accepted by
+// ParseColor.
+func parseAffineOptions(value string, fit bool) (AffineOptions, error) {
+	opts := AffineOptions{Fit: fit}
+	matrix, color, hasColor := strings.Cut(value, ":")
+
+	values := strings.Split(matrix, ",")
+	if len(values) != 6 {
+		return opts, fmt.Errorf("affine matrix needs 6 values: a,b,c,d,e,f, got %s", matrix)
+	}
+	for i, v := range values {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return opts, fmt.Errorf("invalid affine matrix value: %s", v)
+		}
+		opts.Matrix[i] = f
+	}
+	if det := opts.Matrix[0]*opts.Matrix[4] - opts.Matrix[1]*opts.Matrix[3]; det == 0 {
+		return opts, fmt.Errorf("affine matrix %s is singular (its determinant is 0)", matrix)
+	}
+
+	if hasColor {
+		c, err := ParseColor(color)
+		if err != nil {
+			return opts, err
+		}
+		opts.Background = c
+	}
+	return opts, nil
+}
+
+// Affine transforms the image by the matrix of opts. Every output pixel is
+// mapped back through the inverse matrix and sampled bilinearly between the
+// centers of the four nearest pixels of the image; output pixels that map
+// outside the image get the background color and are opaque. With Fit, the
+// output is the bounding box of the transformed image, so that nothing of it
+// is cut off, and the matrix is applied relative to the top-left corner of
+// that box.
+func Affine(image *BMPImage, opts AffineOptions) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	outW, outH := opts.Dimensions(width, height)
+	var offX, offY float64
+	if opts.Fit {
+		offX, offY, _, _ = opts.bounds(width, height)
+	}
+	inv := AffineOptions{Matrix: opts.inverse()}
+
+	data := makeGrid[Pixel](outW, outH)
+	var alpha [][]byte
+	if image.Alpha != nil {
+		alpha = makeGrid[byte](outW, outH)
+	}
+	var wide [][]Pixel16
+	if image.Wide != nil {
+		wide = makeGrid[Pixel16](outW, outH)
+	}
+	bg := WidenPixel(opts.Background)
+
+	ForRange(outH, 0, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range outW {
+				sx, sy := inv.apply(float64(x)+0.5+offX, float64(y)+0.5+offY)
+				s, ok := bilinearAt(sx, sy, width, height)
+				if !ok {
+					data[y][x] = opts.Background
+					if alpha != nil {
+						alpha[y][x] = 255
+					}
+					if wide != nil {
+						wide[y][x] = bg
+					}
+					continue
+				}
+
+				data[y][x] = s.pixel(image)
+				if alpha != nil {
+					alpha[y][x] = s.alpha(image)
+				}
+				if wide != nil {
+					wide[y][x] = s.wide(image)
+				}
+			}
+		}
+	})
+
+	image.Data, image.Alpha, image.Wide = data, alpha, wide
+	resizeHeaders(image)
+}
+
+// bilinearSample holds the four pixels a point is interpolated from, as
+// visual coordinates, and their weights.
+type bilinearSample struct {
+	xs, ys  [4]int
+	weights [4]float64
+}
+
+// bilinearAt returns the pixels and weights of the bilinear interpolation at
+// the point (x, y) of a width x height image, in continuous coordinates where
+// pixel (i, j) covers [i, i+1) x [j, j+1). Points outside the image report
+// false; near the edges the nearest pixels are repeated.
+func bilinearAt(x, y float64, width, height int) (bilinearSample, bool) {
+	x, y = snap(x), snap(y)
+	if x < 0 || y < 0 || x >= float64(width) || y >= float64(height) {
+		return bilinearSample{}, false
+	}
+
+	u, v := x-0.5, y-0.5
+	x0, y0 := math.Floor(u), math.Floor(v)
+	fx, fy := snap(u-x0), snap(v-y0)
+	clampX := func(i float64) int { return min(max(int(i), 0), width-1) }
+	clampY := func(i float64) int { return min(max(int(i), 0), height-1) }
+
+	var s bilinearSample
+	s.xs = [4]int{clampX(x0), clampX(x0 + 1), clampX(x0), clampX(x0 + 1)}
+	s.ys = [4]int{clampY(y0), clampY(y0), clampY(y0 + 1), clampY(y0 + 1)}
+	s.weights = [4]float64{(1 - fx) * (1 - fy), fx * (1 - fy), (1 - fx) * fy, fx * fy}
+	return s, true
+}
+
+// pixel interpolates the 8-bit pixels of image at the sample.
+func (s bilinearSample) pixel(image *BMPImage) Pixel {
+	var p [3]float64
+	for k, w := range s.weights {
+		q := image.Data[s.ys[k]][s.xs[k]]
+		p[0] += w * float64(q.Blue)
+		p[1] += w * float64(q.Green)
+		p[2] += w * float64(q.Red)
+	}
+	return Pixel{Blue: clampRound(p[0]), Green: clampRound(p[1]), Red: clampRound(p[2])}
+}
+
+// alpha interpolates the alpha channel of image at the sample.
+func (s bilinearSample) alpha(image *BMPImage) byte {
+	var a float64
+	for k, w := range s.weights {
+		a += w * float64(image.Alpha[s.ys[k]][s.xs[k]])
+	}
+	return clampRound(a)
+}
+
+// wide interpolates the 16-bit pixels of a widened image at the sample.
+func (s bilinearSample) wide(image *BMPImage) Pixel16 {
+	var p [3]float64
+	for k, w := range s.weights {
+		q := image.Wide[s.ys[k]][s.xs[k]]
+		p[0] += w * float64(q.Blue)
+		p[1] += w * float64(q.Green)
+		p[2] += w * float64(q.Red)
+	}
+	return Pixel16{Blue: clampRound16(p[0]), Green: clampRound16(p[1]), Red: clampRound16(p[2])}
+}
+
+// makeGrid allocates a height x width grid.
+func makeGrid[T any](width, height int) [][]T {
+	grid := make([][]T, height)
+	for y := range grid {
+		grid[y] = make([]T, width)
+	}
+	return grid
+}
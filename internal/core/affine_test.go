@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAffineIdentity(t *testing.T) {
+	for _, fit := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fit=%v", fit), func(t *testing.T) {
+			image := withAlpha(noiseImage(13, 7, 1))
+			image.Widen()
+			original := image.Clone()
+
+			Affine(image, AffineOptions{Matrix: [6]float64{1, 0, 0, 0, 1, 0}, Fit: fit})
+			checkShape(t, image, 13, 7)
+			if !gridsEqual(image.Data, original.Data) || !gridsEqual(image.Alpha, original.Alpha) || !gridsEqual(image.Wide, original.Wide) {
+				t.Error("the identity matrix changed the image")
+			}
+		})
+	}
+}
+
+func TestAffineTranslation(t *testing.T) {
+	tests := []struct{ dx, dy int }{
+		{3, 0}, {0, 2}, {-4, 1}, {5, -3},
+	}
+	background := Pixel{Blue: 1, Green: 2, Red: 3}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d,%d", tt.dx, tt.dy), func(t *testing.T) {
+			image := noiseImage(13, 7, 2)
+			src := visualRows(image)
+			Affine(image, AffineOptions{Matrix: [6]float64{1, 0, float64(tt.dx), 0, 1, float64(tt.dy)}, Background: background})
+
+			for y, row := range visualRows(image) {
+				for x, p := range row {
+					want := background
+					if sx, sy := x-tt.dx, y-tt.dy; sx >= 0 && sx < 13 && sy >= 0 && sy < 7 {
+						want = src[sy][sx]
+					}
+					if p != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, p, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAffineRotationMatchesRotate(t *testing.T) {
+	tests := []struct {
+		name      string
+		matrix    [6]float64
+		direction int
+	}{
+		// Clockwise in image coordinates, with y pointing down
+		{"right", [6]float64{0, -1, 0, 1, 0, 0}, 1},
+		{"left", [6]float64{0, 1, 0, -1, 0, 0}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := noiseImage(13, 7, 3)
+			want := image.Clone()
+			Rotate(want, tt.direction)
+
+			Affine(image, AffineOptions{Matrix: tt.matrix, Fit: true})
+			checkShape(t, image, 7, 13)
+			got, exp := visualRows(image), visualRows(want)
+			for y := range got {
+				for x := range got[y] {
+					for c, d := range []int{
+						int(got[y][x].Blue) - int(exp[y][x].Blue),
+						int(got[y][x].Green) - int(exp[y][x].Green),
+						int(got[y][x].Red) - int(exp[y][x].Red),
+					} {
+						if d < -1 || d > 1 {
+							t.Fatalf("pixel (%d, %d) channel %d differs by %d", x, y, c, d)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAffineFitDimensions(t *testing.T) {
+	tests := []struct {
+		matrix        [6]float64
+		width, height int
+	}{
+		{[6]float64{2, 0, 0, 0, 0.5, 0}, 26, 4},
+		{[6]float64{1, 1, 0, 0, 1, 0}, 20, 7},
+		{[6]float64{1, 0, 100, 0, 1, -50}, 13, 7},
+	}
+
+	for _, tt := range tests {
+		opts := AffineOptions{Matrix: tt.matrix, Fit: true}
+		t.Run(opts.String(), func(t *testing.T) {
+			if w, h := opts.Dimensions(13, 7); w != tt.width || h != tt.height {
+				t.Errorf("Dimensions = %dx%d, want %dx%d", w, h, tt.width, tt.height)
+			}
+			image := noiseImage(13, 7, 4)
+			Affine(image, opts)
+			checkShape(t, image, tt.width, tt.height)
+		})
+	}
+}
+
+func TestParseAffineOptions(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"1,0,0,0,1,0", true},
+		{"0.5, 0.1, -3, 0, 2, 4:white", true},
+		{"1,0,0,0,1", false},
+		{"1,0,0,0,1,0,0", false},
+		{"1,x,0,0,1,0", false},
+		{"1,2,0,2,4,0", false}, // singular
+		{"0,0,5,0,0,5", false},
+		{"1,0,0,0,1,0:nocolor", false},
+		{"1,0,0,0,1,NaN", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, err := parseAffineOptions(tt.value, false); (err == nil) != tt.ok {
+				t.Errorf("got error %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// defaultChannelSearch is the default distance, in pixels, that the red and
+// blue plates are searched for their best offset.
+const defaultChannelSearch = 16
+
+// AlignChannelsOptions stores the settings of the align-channels command.
+type AlignChannelsOptions struct {
+	Search     int   // Largest offset tried along either axis
+	Background Pixel // Color of the edges a shifted plate leaves uncovered
+}
+
+// ChannelOffset is where a plate was found relative to the green one: it is
+// moved DX pixels right and DY pixels down to line up. Correlation is the
+// normalized cross-correlation of the two at that offset, from -1 to 1.
+type ChannelOffset struct {
+	DX, DY      int
+	Correlation float64
+}
+
+// ParseAlignChannelsArgs parses the align-channels command arguments:
+// options, then the red, green and blue plates and the output file.
+func ParseAlignChannelsArgs(args []string) (AlignChannelsOptions, [3]string, string, error) {
+	opts := AlignChannelsOptions{Search: defaultChannelSearch}
+	var plates [3]string
+
+	var files []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--search="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--search="))
+			if err != nil || n < 0 {
+				return opts, plates, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid search option: %s (must be a number of pixels of at least 0)", arg))
+			}
+			opts.Search = n
+		case strings.HasPrefix(arg, "--background="):
+			c, err := ParseColor(strings.TrimPrefix(arg, "--background="))
+			if err != nil {
+				return opts, plates, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid background option: %w", err))
+			}
+			opts.Background = c
+		case strings.HasPrefix(arg, "--"):
+			return opts, plates, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		default:
+			files = append(files, arg)
+		}
+	}
+	if len(files) != 4 {
+		return opts, plates, "", withKind(ErrInvalidParameter, fmt.Errorf("align-channels needs the red, green and blue plates and an output"))
+	}
+	copy(plates[:], files)
+	return opts, plates, files[3], nil
+}
+
+// AlignChannels merges three grayscale plates of a color separation into one
+// color image, the red channel from the luminance of red, and so on. The
+// green plate is the reference: the red and blue ones are moved by the whole
+// number of pixels, up to opts.Search and half the size of the plates along
+// each axis, at which their normalized cross-correlation with it over the
+// area where they overlap is highest. Of equally good offsets the one nearest
+// to no shift wins, and the first of those in row order. The edges a plate
+// uncovers take the channel of opts.Background. It returns the image and the
+// offsets of the red and blue plates, in that order.
+//
+// The plates must have the same dimensions; they are matched from their
+// visual top-left corners. The result is a new 24-bit bottom-up image.
+func AlignChannels(red, green, blue *BMPImage, opts AlignChannelsOptions) (*BMPImage, [2]ChannelOffset, error) {
+	var offsets [2]ChannelOffset
+	width, height := int(green.InfoHeader.Width), len(green.Data)
+	for _, plate := range []*BMPImage{red, blue} {
+		if w, h := int(plate.InfoHeader.Width), len(plate.Data); w != width || h != height {
+			return nil, offsets, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, width, height, w, h)
+		}
+	}
+
+	reference := lumaPlane(green)
+	offsets[0] = bestChannelOffset(reference, lumaPlane(red), opts.Search)
+	offsets[1] = bestChannelOffset(reference, lumaPlane(blue), opts.Search)
+
+	out := NewImage(width, height)
+	for y, row := range out.Rows() {
+		for x := range row {
+			p := opts.Background
+			p.Green = luminance(green.Data[y][x])
+			if sx, sy := x-offsets[0].DX, y-offsets[0].DY; sx >= 0 && sx < width && sy >= 0 && sy < height {
+				p.Red = luminance(red.Data[sy][sx])
+			}
+			if sx, sy := x-offsets[1].DX, y-offsets[1].DY; sx >= 0 && sx < width && sy >= 0 && sy < height {
+				p.Blue = luminance(blue.Data[sy][sx])
+			}
+			row[x] = p
+		}
+	}
+	return out, offsets, nil
+}
+
+// PrintChannelOffsets prints the offsets AlignChannels found for the red and
+// blue plates.
+func PrintChannelOffsets(w io.Writer, offsets [2]ChannelOffset) error {
+	for i, name := range []string{"red", "blue"} {
+		o := offsets[i]
+		if _, err := fmt.Fprintf(w, "%-5s dx=%+d dy=%+d (correlation %.4f)\n", name, o.DX, o.DY, o.Correlation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lumaPlane returns the luminance of every pixel of image, by visual row.
+func lumaPlane(image *BMPImage) [][]float64 {
+	plane := make([][]float64, len(image.Data))
+	for y, row := range image.Rows() {
+		plane[y] = make([]float64, len(row))
+		for x, p := range row {
+			plane[y][x] = float64(luminance(p))
+		}
+	}
+	return plane
+}
+
+// bestChannelOffset returns the offset of plate within search pixels along
+// each axis that correlates best with reference. The offsets are scored in
+// parallel, each into its own slot, and compared in a fixed order.
+func bestChannelOffset(reference, plate [][]float64, search int) ChannelOffset {
+	height, width := len(reference), len(reference[0])
+	// Over a sliver of overlap any two plates can correlate perfectly, so at
+	// least half of each dimension is kept
+	sx, sy := min(search, width/2), min(search, height/2)
+	side := 2*sx + 1
+	scores := make([]float64, side*(2*sy+1))
+
+	ForRange(len(scores), 0, func(start, end int) {
+		for i := start; i < end; i++ {
+			scores[i] = channelCorrelation(reference, plate, i%side-sx, i/side-sy)
+		}
+	})
+
+	best := ChannelOffset{Correlation: math.Inf(-1)}
+	for i, score := range scores {
+		dx, dy := i%side-sx, i/side-sy
+		dist, bestDist := utils.Abs(dx)+utils.Abs(dy), utils.Abs(best.DX)+utils.Abs(best.DY)
+		if score > best.Correlation || score == best.Correlation && dist < bestDist {
+			best = ChannelOffset{DX: dx, DY: dy, Correlation: score}
+		}
+	}
+	return best
+}
+
+// channelCorrelation returns the normalized cross-correlation of reference
+// and plate moved dx pixels right and dy down, over the area where they
+// overlap. It is 0 if either is flat there.
+func channelCorrelation(reference, plate [][]float64, dx, dy int) float64 {
+	height, width := len(reference), len(reference[0])
+	var n, sa, sb, saa, sbb, sab float64
+	for y := max(0, dy); y < min(height, height+dy); y++ {
+		a, b := reference[y], plate[y-dy]
+		for x := max(0, dx); x < min(width, width+dx); x++ {
+			va, vb := a[x], b[x-dx]
+			sa, sb = sa+va, sb+vb
+			saa, sbb, sab = saa+va*va, sbb+vb*vb, sab+va*vb
+			n++
+		}
+	}
+
+	varA, varB := saa-sa*sa/n, sbb-sb*sb/n
+	if varA <= 0 || varB <= 0 {
+		return 0
+	}
+	return (sab - sa*sb/n) / math.Sqrt(varA*varB)
+}
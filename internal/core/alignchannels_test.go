@@ -0,0 +1,112 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// plate returns the channel of image picked by channel as a grayscale image,
+// with its content moved dx pixels left and dy up, as a misaligned scan of
+// that separation. The uncovered edges are black.
+func plate(image *BMPImage, channel func(Pixel) byte, dx, dy int) *BMPImage {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	out := NewImage(width, height)
+	for y, row := range out.Rows() {
+		for x := range row {
+			if sx, sy := x+dx, y+dy; sx >= 0 && sx < width && sy >= 0 && sy < height {
+				v := channel(image.At(sx, sy))
+				row[x] = Pixel{Blue: v, Green: v, Red: v}
+			}
+		}
+	}
+	return out
+}
+
+func TestAlignChannelsRecoversOffsets(t *testing.T) {
+	const width, height = 48, 40
+	tests := []struct {
+		name      string
+		red, blue ChannelOffset
+	}{
+		{"aligned", ChannelOffset{}, ChannelOffset{}},
+		{"shifted", ChannelOffset{DX: 3, DY: -2}, ChannelOffset{DX: -5, DY: 4}},
+		{"at the search limit", ChannelOffset{DX: -6, DY: 6}, ChannelOffset{DX: 6, DY: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The separations of a scene share its structure, at different
+			// levels and with some noise of their own
+			color := noiseImage(width, height, 1)
+			for _, row := range color.Data {
+				for x, p := range row {
+					row[x] = Pixel{Red: p.Red, Green: p.Red/2 + 64 + p.Green%16, Blue: p.Red/4*3 + p.Blue%32}
+				}
+			}
+			r := plate(color, func(p Pixel) byte { return p.Red }, tt.red.DX, tt.red.DY)
+			g := plate(color, func(p Pixel) byte { return p.Green }, 0, 0)
+			b := plate(color, func(p Pixel) byte { return p.Blue }, tt.blue.DX, tt.blue.DY)
+
+			aligned, offsets, err := AlignChannels(r, g, b, AlignChannelsOptions{Search: 6, Background: Pixel{Red: 7, Blue: 9}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range []ChannelOffset{tt.red, tt.blue} {
+				if got := offsets[i]; got.DX != want.DX || got.DY != want.DY {
+					t.Errorf("offset %d = %+v, want %d,%d", i, got, want.DX, want.DY)
+				}
+			}
+
+			// Every pixel is restored exactly, but for the edges the plates uncover
+			for y := range height {
+				for x := range width {
+					got, want := aligned.At(x, y), color.At(x, y)
+					inside := func(o ChannelOffset) bool {
+						return x-o.DX >= 0 && x-o.DX < width && y-o.DY >= 0 && y-o.DY < height
+					}
+					if !inside(tt.red) {
+						want.Red = 7
+					}
+					if !inside(tt.blue) {
+						want.Blue = 9
+					}
+					if got != want {
+						t.Fatalf("(%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAlignChannelsMismatch(t *testing.T) {
+	_, _, err := AlignChannels(NewImage(4, 4), NewImage(4, 4), NewImage(4, 5), AlignChannelsOptions{Search: 2})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("got %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestParseAlignChannelsArgs(t *testing.T) {
+	opts, plates, out, err := ParseAlignChannelsArgs([]string{"--search=4", "r.bmp", "g.bmp", "--background=white", "b.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Search != 4 || opts.Background != (Pixel{Blue: 255, Green: 255, Red: 255}) || plates != [3]string{"r.bmp", "g.bmp", "b.bmp"} || out != "out.bmp" {
+		t.Errorf("got %+v %v %s", opts, plates, out)
+	}
+	if opts, _, _, _ := ParseAlignChannelsArgs([]string{"r", "g", "b", "o"}); opts.Search != defaultChannelSearch {
+		t.Errorf("default search %d, want %d", opts.Search, defaultChannelSearch)
+	}
+
+	for _, args := range [][]string{
+		{"r.bmp", "g.bmp", "b.bmp"},
+		{"r.bmp", "g.bmp", "b.bmp", "o.bmp", "x.bmp"},
+		{"--search=-1", "r.bmp", "g.bmp", "b.bmp", "o.bmp"},
+		{"--background=nope", "r.bmp", "g.bmp", "b.bmp", "o.bmp"},
+		{"--bogus", "r.bmp", "g.bmp", "b.bmp", "o.bmp"},
+	} {
+		if _, _, _, err := ParseAlignChannelsArgs(args); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package core
+
+import "fmt"
+
+// ParseAlphaArgs parses the alpha command arguments: extract followed by
+// the source image and the mask to write, or apply followed by the base
+// image, the mask and the output file. It returns the subcommand and the
+// files.
+func ParseAlphaArgs(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, ErrIncorrectArgument
+	}
+	switch args[0] {
+	case "extract":
+		if len(args) != 3 {
+			return "", nil, withKind(ErrInvalidParameter, fmt.Errorf("alpha extract takes a source image and a mask file"))
+		}
+	case "apply":
+		if len(args) != 4 {
+			return "", nil, withKind(ErrInvalidParameter, fmt.Errorf("alpha apply takes a base image, a mask and an output file"))
+		}
+	default:
+		return "", nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid alpha subcommand: %s (must be extract or apply)", args[0]))
+	}
+	return args[0], args[1:], nil
+}
+
+// ExtractAlpha returns the alpha channel of image as a grayscale image of
+// the same size, where black is transparent and white opaque. An image
+// without an alpha channel gives a white one.
+func ExtractAlpha(image *BMPImage) *BMPImage {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	mask := NewImage(width, height)
+	for y, row := range mask.Rows() {
+		for x := range row {
+			a := byte(255)
+			if image.Alpha != nil {
+				a = image.Alpha[y][x]
+			}
+			row[x] = Pixel{Blue: a, Green: a, Red: a}
+		}
+	}
+	return mask
+}
+
+// ApplyAlpha sets the alpha channel of image to the luminance of mask,
+// which must have the same size, replacing any it had. A grayscale mask
+// gives its levels exactly, so that applying the mask ExtractAlpha returns
+// restores the alpha it was extracted from.
+func ApplyAlpha(image, mask *BMPImage) error {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	if mw, mh := int(mask.InfoHeader.Width), len(mask.Data); mw != width || mh != height {
+		return withKind(ErrOutOfBounds, fmt.Errorf("mask is %dx%d but the image is %dx%d", mw, mh, width, height))
+	}
+	mask = mask.narrowed()
+
+	alpha := makeGrid[byte](width, height)
+	for y := range height {
+		row := alpha[y]
+		for x, p := range mask.Data[y] {
+			row[x] = luminance(p)
+		}
+	}
+	image.Alpha = alpha
+	return nil
+}
+
+// AlphaSaveOptions returns the options alpha apply saves an image to path
+// with: 32-bit for BMP output, which keeps the alpha channel, else the
+// format of the extension.
+func AlphaSaveOptions(path string) SaveOptions {
+	if OutputFormat(path, SaveOptions{}) == FormatBMP24 {
+		return SaveOptions{Format: FormatBMP32}
+	}
+	return SaveOptions{}
+}
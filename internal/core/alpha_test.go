@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAlphaExtractApplyRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, orientation := range []string{"bottom-up", "top-down"} {
+		t.Run(orientation, func(t *testing.T) {
+			image := withAlpha(noiseImage(11, 6, 1))
+			if orientation == "top-down" {
+				image = topDown(image)
+			}
+
+			// Through files, as bitmap alpha does
+			maskPath := filepath.Join(dir, orientation+"-mask.bmp")
+			if err := Save(ExtractAlpha(image), maskPath, SaveOptions{}); err != nil {
+				t.Fatalf("saving the mask: %v", err)
+			}
+			mask, err := LoadImage(maskPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isGrayscale(mask) {
+				t.Error("the mask isn't grayscale")
+			}
+
+			base := image.Clone()
+			base.Alpha = nil
+			if err := ApplyAlpha(base, mask); err != nil {
+				t.Fatalf("ApplyAlpha: %v", err)
+			}
+			if !gridsEqual(base.Alpha, image.Alpha) || !gridsEqual(base.Data, image.Data) {
+				t.Error("extracting and applying the mask changed the image")
+			}
+		})
+	}
+}
+
+func TestAlphaApplyPromotesTo32Bit(t *testing.T) {
+	dir := t.TempDir()
+	image := noiseImage(5, 3, 2)
+	mask := withAlpha(NewImage(5, 3))
+	gray := ExtractAlpha(mask)
+	if err := ApplyAlpha(image, gray); err != nil {
+		t.Fatalf("ApplyAlpha: %v", err)
+	}
+
+	out := filepath.Join(dir, "out.bmp")
+	if err := Save(image, out, AlphaSaveOptions(out)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := binary.LittleEndian
+	if size, offset := h.Uint32(b[2:]), h.Uint32(b[10:]); int(size) != len(b) || offset != 14+v4HeaderSize || len(b) != 14+v4HeaderSize+5*3*4 {
+		t.Errorf("file size %d, data offset %d for a %d-byte file", size, offset, len(b))
+	}
+	if dib, bits, compression, imageSize := h.Uint32(b[14:]), h.Uint16(b[28:]), h.Uint32(b[30:]), h.Uint32(b[34:]); dib != v4HeaderSize || bits != 32 || compression != biBitfields || imageSize != 5*3*4 {
+		t.Errorf("DIB header of %d bytes, %d bits, compression %d, image size %d", dib, bits, compression, imageSize)
+	}
+	if alphaMask := h.Uint32(b[54+12:]); alphaMask != 0xff000000 {
+		t.Errorf("alpha mask %#x", alphaMask)
+	}
+
+	back, err := ParseBMP(b)
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	if !gridsEqual(back.Alpha, image.Alpha) || !gridsEqual(back.Data, image.Data) {
+		t.Error("32-bit output doesn't read back as written")
+	}
+}
+
+func TestAlphaErrors(t *testing.T) {
+	if err := ApplyAlpha(NewImage(4, 4), NewImage(4, 5)); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("mismatched mask: %v, want an ErrOutOfBounds", err)
+	}
+	for _, args := range [][]string{{}, {"extract", "in.bmp"}, {"apply", "in.bmp", "mask.bmp"}, {"invert", "a", "b"}} {
+		if _, _, err := ParseAlphaArgs(args); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+	// An opaque image has a white mask
+	if mask := ExtractAlpha(noiseImage(2, 2, 1)); mask.At(1, 1) != (Pixel{255, 255, 255}) {
+		t.Errorf("mask of an opaque image = %v, want white", mask.At(1, 1))
+	}
+}
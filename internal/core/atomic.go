@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// inFlight tracks the temporary files of outputs that are still being written,
+// so they can be removed if the process is interrupted.
+var inFlight = struct {
+	sync.Mutex
+	paths map[string]struct{}
+}{paths: make(map[string]struct{})}
+
+// atomicFile is an output file written under a temporary name in the same
+// directory as its destination, and renamed over the destination only once
+// it is complete. An interrupted write never leaves a truncated output behind,
+// and never clobbers an existing file with a partial one.
+type atomicFile struct {
+	*os.File
+	dest string
+}
+
+// createAtomic creates the temporary file for dest.
+func createAtomic(dest string) (*atomicFile, error) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	inFlight.paths[f.Name()] = struct{}{}
+	return &atomicFile{File: f, dest: dest}, nil
+}
+
+// Commit closes the temporary file and renames it to the destination.
+// If anything fails, the temporary file is removed.
+func (a *atomicFile) Commit() error {
+	if err := a.Chmod(0o644); err != nil {
+		a.Abort()
+		return err
+	}
+	if err := a.Close(); err != nil {
+		a.Abort()
+		return err
+	}
+
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	delete(inFlight.paths, a.Name())
+	if err := os.Rename(a.Name(), a.dest); err != nil {
+		os.Remove(a.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving the destination untouched.
+func (a *atomicFile) Abort() {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	a.Close()
+	os.Remove(a.Name())
+	delete(inFlight.paths, a.Name())
+}
+
+// AbortOutputs removes the temporary files of every output still being written.
+// It is meant to be called right before exiting on a signal: the in-flight
+// registry stays locked afterwards, so no output can be committed any more.
+func AbortOutputs() {
+	inFlight.Lock()
+	for path := range inFlight.paths {
+		os.Remove(path)
+	}
+}
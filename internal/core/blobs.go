@@ -0,0 +1,260 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BlobsOptions holds the flags of the blobs command.
+type BlobsOptions struct {
+	Threshold    int    // Pixels with a luminance of at least Threshold are foreground
+	Invert       bool   // Pixels below Threshold are foreground instead, for dark ink on paper
+	MinArea      int    // Blobs of fewer pixels are left out
+	Connectivity int    // 4 to join pixels sharing an edge, 8 to also join diagonal neighbors
+	JSON         bool   // Print the blobs as JSON instead of a table
+	LabelOutput  string // Path to save an image of the blobs in distinct colors to, if any
+}
+
+// Blob is a connected region of foreground pixels. Coordinates are counted
+// from the visual top-left corner, and the bounding box is inclusive.
+type Blob struct {
+	Label     int     `json:"label"`
+	Area      int     `json:"area"`
+	MinX      int     `json:"min_x"`
+	MinY      int     `json:"min_y"`
+	MaxX      int     `json:"max_x"`
+	MaxY      int     `json:"max_y"`
+	CentroidX float64 `json:"centroid_x"`
+	CentroidY float64 `json:"centroid_y"`
+}
+
+// ParseBlobsArgs parses the blobs command arguments: options and the input file.
+func ParseBlobsArgs(args []string) (BlobsOptions, string, error) {
+	opts := BlobsOptions{Threshold: 128, MinArea: 1, Connectivity: 8}
+
+	if len(args) < 1 {
+		return opts, "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		switch {
+		case strings.HasPrefix(arg, "--threshold="):
+			t, err := strconv.Atoi(strings.TrimPrefix(arg, "--threshold="))
+			if err != nil || t < 0 || t > 255 {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid threshold option: %s (must be between 0 and 255)", arg))
+			}
+			opts.Threshold = t
+		case arg == "--invert":
+			opts.Invert = true
+		case strings.HasPrefix(arg, "--min-area="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--min-area="))
+			if err != nil || n < 1 {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid min-area option: %s (must be positive)", arg))
+			}
+			opts.MinArea = n
+		case strings.HasPrefix(arg, "--connectivity="):
+			switch value := strings.TrimPrefix(arg, "--connectivity="); value {
+			case "4", "8":
+				opts.Connectivity, _ = strconv.Atoi(value)
+			default:
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid connectivity option: %s (must be 4 or 8)", arg))
+			}
+		case arg == "--json":
+			opts.JSON = true
+		case strings.HasPrefix(arg, "--label-output="):
+			opts.LabelOutput = strings.TrimPrefix(arg, "--label-output=")
+		default:
+			return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	return opts, args[len(args)-1], nil
+}
+
+// foreground reports whether p belongs to a blob under opts.
+func (opts BlobsOptions) foreground(p Pixel) bool {
+	return (int(luminance(p)) >= opts.Threshold) != opts.Invert
+}
+
+// FindBlobs binarizes the image as opts says and labels its connected
+// regions of foreground pixels with the classic two-pass algorithm: the first
+// pass gives every pixel the label of one of its already visited neighbors,
+// or a new one if none is labeled, and records in a union-find forest that the labels
+// it saw are the same blob; the second pass replaces every label by the root
+// of its tree. It returns the blobs of at least opts.MinArea pixels, numbered
+// from 1 in the order their first pixel appears in raster order, and the
+// label of every pixel in visual order, 0 for the background and for blobs
+// that were left out.
+func FindBlobs(image *BMPImage, opts BlobsOptions) ([]Blob, [][]int) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	labels := make([][]int, height)
+	forest := unionFind{0} // Label 0 is the background
+
+	// Neighbors visited before a pixel in raster order: left, then for 8-connectivity
+	// the three above, else just the one above
+	neighbors := [][2]int{{-1, 0}, {0, -1}}
+	if opts.Connectivity == 8 {
+		neighbors = [][2]int{{-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	}
+
+	for y, row := range image.Rows() {
+		labels[y] = make([]int, width)
+		for x, p := range row {
+			if !opts.foreground(p) {
+				continue
+			}
+			label := 0
+			for _, d := range neighbors {
+				nx, ny := x+d[0], y+d[1]
+				if nx < 0 || nx >= width || ny < 0 {
+					continue
+				}
+				if n := labels[ny][nx]; n != 0 {
+					if label == 0 {
+						label = n
+					} else {
+						forest.union(label, n)
+					}
+				}
+			}
+			if label == 0 {
+				label = forest.add()
+			}
+			labels[y][x] = label
+		}
+	}
+
+	// Resolve every label to its root, then measure the blobs
+	type moments struct {
+		blob       Blob
+		sumX, sumY int
+	}
+	byRoot := make(map[int]*moments)
+	var order []int
+	for y, row := range labels {
+		for x, label := range row {
+			if label == 0 {
+				continue
+			}
+			root := forest.find(label)
+			row[x] = root
+			m, ok := byRoot[root]
+			if !ok {
+				m = &moments{blob: Blob{MinX: x, MinY: y, MaxX: x, MaxY: y}}
+				byRoot[root] = m
+				order = append(order, root)
+			}
+			m.blob.Area++
+			m.sumX, m.sumY = m.sumX+x, m.sumY+y
+			m.blob.MinX, m.blob.MinY = min(m.blob.MinX, x), min(m.blob.MinY, y)
+			m.blob.MaxX, m.blob.MaxY = max(m.blob.MaxX, x), max(m.blob.MaxY, y)
+		}
+	}
+
+	// Number the blobs that are large enough, and clear the others from the labels
+	number := make(map[int]int, len(order))
+	var blobs []Blob
+	for _, root := range order {
+		m := byRoot[root]
+		if m.blob.Area < opts.MinArea {
+			continue
+		}
+		m.blob.Label = len(blobs) + 1
+		m.blob.CentroidX = float64(m.sumX) / float64(m.blob.Area)
+		m.blob.CentroidY = float64(m.sumY) / float64(m.blob.Area)
+		number[root] = m.blob.Label
+		blobs = append(blobs, m.blob)
+	}
+	for _, row := range labels {
+		for x, root := range row {
+			row[x] = number[root]
+		}
+	}
+	return blobs, labels
+}
+
+// unionFind is a forest of labels, each entry holding the parent of its
+// label. Roots are their own parent, and are always the smallest label of
+// their tree.
+type unionFind []int
+
+// add creates a new label in a tree of its own and returns it.
+func (u *unionFind) add() int {
+	*u = append(*u, len(*u))
+	return len(*u) - 1
+}
+
+// find returns the root of the tree of label, pointing the labels on the way
+// straight at it so that later lookups are shorter.
+func (u unionFind) find(label int) int {
+	root := label
+	for u[root] != root {
+		root = u[root]
+	}
+	for u[label] != root {
+		label, u[label] = u[label], root
+	}
+	return root
+}
+
+// union merges the trees of a and b under the smaller of their roots.
+func (u unionFind) union(a, b int) {
+	a, b = u.find(a), u.find(b)
+	if a > b {
+		a, b = b, a
+	}
+	u[b] = a
+}
+
+// LabelImage returns an image of labels, as returned by FindBlobs, with the
+// background black and every blob in a color of its own. Hues are spread by
+// the golden angle so that blobs with close labels get distant colors.
+func LabelImage(labels [][]int) *BMPImage {
+	width := 0
+	if len(labels) > 0 {
+		width = len(labels[0])
+	}
+	image := NewImage(width, len(labels))
+	for y, row := range image.Rows() {
+		for x := range row {
+			if label := labels[y][x]; label != 0 {
+				row[x] = HSVToRGB(math.Mod(float64(label)*137.508, 360), 0.8, 1)
+			}
+		}
+	}
+	return image
+}
+
+// PrintBlobs writes the blobs to w as a table with a total, or as a JSON
+// array if asJSON is set.
+func PrintBlobs(w io.Writer, blobs []Blob, asJSON bool) error {
+	if asJSON {
+		if blobs == nil {
+			blobs = []Blob{}
+		}
+		data, err := json.MarshalIndent(blobs, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	fmt.Fprintf(w, "Blobs: %d\n", len(blobs))
+	if len(blobs) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "%6s  %8s  %-21s  %s\n", "label", "area", "bounding box", "centroid")
+	for _, b := range blobs {
+		box := fmt.Sprintf("(%d,%d)-(%d,%d)", b.MinX, b.MinY, b.MaxX, b.MaxY)
+		_, err := fmt.Fprintf(w, "%6d  %8d  %-21s  (%.2f,%.2f)\n", b.Label, b.Area, box, b.CentroidX, b.CentroidY)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// blobFixture returns a black 40x30 image with three white shapes: a 5x4
+// rectangle at (2, 3), a plus of area 13 centered on (20, 10), and an L of
+// area 9 whose corner is at (30, 25).
+func blobFixture() *BMPImage {
+	image := NewImage(40, 30)
+	white := Pixel{Blue: 255, Green: 255, Red: 255}
+	for y := 3; y < 7; y++ {
+		for x := 2; x < 7; x++ {
+			image.Set(x, y, white)
+		}
+	}
+	for d := -3; d <= 3; d++ {
+		image.Set(20+d, 10, white)
+		image.Set(20, 10+d, white)
+	}
+	for d := 0; d < 5; d++ {
+		image.Set(30, 25-d, white)
+		image.Set(30+d, 25, white)
+	}
+	return image
+}
+
+func TestFindBlobs(t *testing.T) {
+	blobs, labels := FindBlobs(blobFixture(), BlobsOptions{Threshold: 128, MinArea: 1, Connectivity: 8})
+
+	want := []Blob{
+		{Label: 1, Area: 20, MinX: 2, MinY: 3, MaxX: 6, MaxY: 6, CentroidX: 4, CentroidY: 4.5},
+		{Label: 2, Area: 13, MinX: 17, MinY: 7, MaxX: 23, MaxY: 13, CentroidX: 20, CentroidY: 10},
+		{Label: 3, Area: 9, MinX: 30, MinY: 21, MaxX: 34, MaxY: 25, CentroidX: 31.111111111111111, CentroidY: 23.888888888888889},
+	}
+	if len(blobs) != len(want) {
+		t.Fatalf("found %d blobs, want %d: %+v", len(blobs), len(want), blobs)
+	}
+	for i, b := range blobs {
+		w := want[i]
+		if b.Label != w.Label || b.Area != w.Area || b.MinX != w.MinX || b.MinY != w.MinY || b.MaxX != w.MaxX || b.MaxY != w.MaxY {
+			t.Errorf("blob %d = %+v, want %+v", i, b, w)
+		}
+		if math.Abs(b.CentroidX-w.CentroidX) > 1e-9 || math.Abs(b.CentroidY-w.CentroidY) > 1e-9 {
+			t.Errorf("blob %d centroid = (%g, %g), want (%g, %g)", i, b.CentroidX, b.CentroidY, w.CentroidX, w.CentroidY)
+		}
+	}
+
+	for _, tt := range []struct{ x, y, label int }{{2, 3, 1}, {6, 6, 1}, {20, 7, 2}, {34, 25, 3}, {0, 0, 0}, {21, 11, 0}} {
+		if got := labels[tt.y][tt.x]; got != tt.label {
+			t.Errorf("label at (%d, %d) = %d, want %d", tt.x, tt.y, got, tt.label)
+		}
+	}
+}
+
+func TestFindBlobsConnectivity(t *testing.T) {
+	// A diagonal line of pixels, and a U whose arms only meet at the bottom,
+	// so the first pass labels them apart and has to merge the labels
+	image := NewImage(12, 6)
+	white := Pixel{Blue: 255, Green: 255, Red: 255}
+	for d := range 4 {
+		image.Set(d, d, white)
+	}
+	for y := range 5 {
+		image.Set(6, y, white)
+		image.Set(10, y, white)
+	}
+	for x := 6; x <= 10; x++ {
+		image.Set(x, 5, white)
+	}
+
+	tests := []struct {
+		connectivity int
+		areas        []int
+	}{
+		{8, []int{4, 15}},
+		{4, []int{1, 15, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		blobs, _ := FindBlobs(image, BlobsOptions{Threshold: 128, MinArea: 1, Connectivity: tt.connectivity})
+		var areas []int
+		for _, b := range blobs {
+			areas = append(areas, b.Area)
+		}
+		if !slices.Equal(areas, tt.areas) {
+			t.Errorf("connectivity %d: areas %v, want %v", tt.connectivity, areas, tt.areas)
+		}
+	}
+}
+
+func TestFindBlobsOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  BlobsOptions
+		count int
+	}{
+		{"min area drops the L", BlobsOptions{Threshold: 128, MinArea: 10, Connectivity: 8}, 2},
+		{"min area drops all", BlobsOptions{Threshold: 128, MinArea: 100, Connectivity: 8}, 0},
+		{"inverted, the background is one blob", BlobsOptions{Threshold: 128, Invert: true, MinArea: 1, Connectivity: 8}, 1},
+		{"lowest threshold", BlobsOptions{Threshold: 1, MinArea: 1, Connectivity: 8}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs, labels := FindBlobs(blobFixture(), tt.opts)
+			if len(blobs) != tt.count {
+				t.Fatalf("found %d blobs, want %d", len(blobs), tt.count)
+			}
+			// Labels only refer to the blobs that were kept
+			for _, row := range labels {
+				for _, label := range row {
+					if label < 0 || label > len(blobs) {
+						t.Fatalf("label %d with %d blobs", label, len(blobs))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLabelImageColorsBlobsApart(t *testing.T) {
+	_, labels := FindBlobs(blobFixture(), BlobsOptions{Threshold: 128, MinArea: 1, Connectivity: 8})
+	image := LabelImage(labels)
+	if got := image.At(0, 0); got != (Pixel{}) {
+		t.Errorf("background is %v, want black", got)
+	}
+	a, b, c := image.At(2, 3), image.At(20, 10), image.At(30, 25)
+	if a == b || b == c || a == c || a == (Pixel{}) {
+		t.Errorf("blob colors %v, %v, %v are not distinct", a, b, c)
+	}
+}
+
+func TestPrintBlobs(t *testing.T) {
+	blobs, _ := FindBlobs(blobFixture(), BlobsOptions{Threshold: 128, MinArea: 1, Connectivity: 8})
+
+	var table bytes.Buffer
+	if err := PrintBlobs(&table, blobs, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(table.String(), "Blobs: 3\n") || !strings.Contains(table.String(), "(2,3)-(6,6)") {
+		t.Errorf("unexpected table:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := PrintBlobs(&out, blobs, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Blob
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(decoded) != 3 || decoded[1] != blobs[1] {
+		t.Errorf("JSON round trip gave %+v, want %+v", decoded, blobs)
+	}
+
+	out.Reset()
+	if err := PrintBlobs(&out, nil, true); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("no blobs printed %q, want []", out.String())
+	}
+}
+
+func TestParseBlobsArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"in.bmp"}, true},
+		{[]string{"--threshold=0", "--min-area=5", "--connectivity=4", "--json", "--invert", "--label-output=l.bmp", "in.bmp"}, true},
+		{[]string{}, false},
+		{[]string{"--threshold=256", "in.bmp"}, false},
+		{[]string{"--min-area=0", "in.bmp"}, false},
+		{[]string{"--connectivity=6", "in.bmp"}, false},
+		{[]string{"--unknown", "in.bmp"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if _, _, err := ParseBlobsArgs(tt.args); (err == nil) != tt.ok {
+				t.Errorf("ParseBlobsArgs(%v) error = %v, want ok %v", tt.args, err, tt.ok)
+			}
+		})
+	}
+}
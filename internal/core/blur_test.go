@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+// naiveBlur is the reference for applyBlur: the average of the neighborhood
+// of every pixel, with the rows and columns outside the image mapped by mode.
+func naiveBlur(image *BMPImage, radius int, mode EdgeMode) [][]Pixel {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	out := make([][]Pixel, height)
+	for y := range height {
+		out[y] = make([]Pixel, width)
+		for x := range width {
+			var red, green, blue, count int
+			for ny := y - radius; ny <= y+radius; ny++ {
+				sy, ok := mode.index(ny, height)
+				if !ok {
+					continue
+				}
+				for nx := x - radius; nx <= x+radius; nx++ {
+					sx, ok := mode.index(nx, width)
+					if !ok {
+						continue
+					}
+					p := image.Data[sy][sx]
+					red, green, blue, count = red+int(p.Red), green+int(p.Green), blue+int(p.Blue), count+1
+				}
+			}
+			out[y][x] = Pixel{Red: byte(divRound(red, count)), Green: byte(divRound(green, count)), Blue: byte(divRound(blue, count))}
+		}
+	}
+	return out
+}
+
+func TestBlurMatchesNaive(t *testing.T) {
+	// Heights across several bands, and radii larger than the image
+	sizes := [][2]int{{1, 1}, {7, 1}, {1, 7}, {13, 70}, {9, 200}}
+	for _, size := range sizes {
+		for _, radius := range []int{1, 3, 20} {
+			for _, mode := range []EdgeMode{EdgeShrink, EdgeClamp, EdgeMirror, EdgeWrap} {
+				t.Run(fmt.Sprintf("%dx%d_r%d_%s", size[0], size[1], radius, mode), func(t *testing.T) {
+					image := noiseImage(size[0], size[1], int64(radius))
+					want := naiveBlur(image, radius, mode)
+					applyBlur(image, radius, mode)
+					if !gridsEqual(image.Data, want) {
+						t.Error("differs from the naive average")
+					}
+
+					// At 16 bits, on the same values times 257, whose
+					// averages narrow back to the rounded 8-bit ones
+					wide := noiseImage(size[0], size[1], int64(radius))
+					wide.Widen()
+					applyBlurWide(wide, radius, mode)
+					for y, row := range wide.Wide {
+						for x, p := range row {
+							if w := want[y][x]; NarrowPixel(p) != w {
+								t.Fatalf("16-bit (%d, %d) = %v, want %v narrowed", x, y, p, w)
+							}
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestBlurEdgeModes(t *testing.T) {
+	blur := func(image *BMPImage, filter string) {
+		t.Helper()
+		opts, err := parseFilterOptions(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Filter(image, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Whatever is read past the edges of a white image is white too
+	for _, mode := range []string{"shrink", "clamp", "mirror", "wrap"} {
+		image := NewImage(5, 4)
+		for _, row := range image.Data {
+			for x := range row {
+				row[x] = Pixel{Blue: 255, Green: 255, Red: 255}
+			}
+		}
+		blur(image, "blur:2:"+mode)
+		for y, row := range image.Data {
+			for x, p := range row {
+				if p != (Pixel{Blue: 255, Green: 255, Red: 255}) {
+					t.Fatalf("blur:2:%s turns white into %v at (%d, %d)", mode, p, x, y)
+				}
+			}
+		}
+	}
+
+	// With wrap, the first pixel of a ramp averages in the last one and the
+	// last the first; clamp and mirror repeat the edge pixel instead
+	tests := []struct {
+		mode        string
+		first, last int
+	}{
+		{"clamp", 11, 213},  // (0+0+32)/3, (192+224+224)/3
+		{"mirror", 11, 213}, // the same for a radius of 1
+		{"wrap", 85, 139},   // (224+0+32)/3, (192+224+0)/3
+		{"shrink", 16, 208}, // (0+32)/2, (192+224)/2
+	}
+	for _, tt := range tests {
+		row := grayRow(0, 32, 64, 96, 128, 160, 192, 224)
+		blur(row, "blur:1:"+tt.mode)
+		if got := grayValues(row); got[0] != tt.first || got[7] != tt.last {
+			t.Errorf("blur:1:%s gives %v across the ramp, want %d first and %d last", tt.mode, got, tt.first, tt.last)
+		}
+
+		// The same down a column
+		column, err := Rotated(grayRow(0, 32, 64, 96, 128, 160, 192, 224), 90)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blur(column, "blur:1:"+tt.mode)
+		if top, bottom := column.Data[0][0].Red, column.Data[7][0].Red; int(top) != tt.first || int(bottom) != tt.last {
+			t.Errorf("blur:1:%s gives %d at the top of the ramp and %d at the bottom, want %d and %d", tt.mode, top, bottom, tt.first, tt.last)
+		}
+	}
+}
+
+func BenchmarkBlur(b *testing.B) {
+	for _, radius := range []int{2, 20} {
+		b.Run(fmt.Sprintf("r%d", radius), func(b *testing.B) {
+			benchmarkPass(b, func(image *BMPImage) { applyBlur(image, radius, EdgeShrink) })
+		})
+	}
+}
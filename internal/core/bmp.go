@@ -1,10 +1,14 @@
 package core
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"math"
-	"os"
+	"slices"
 
 	"github.com/ab-dauletkhan/bitmap/internal/utils"
 )
@@ -42,17 +46,96 @@ type Pixel struct {
 }
 
 // BMPImage encapsulates both the BMP and DIB headers, along with the actual image data.
+// Data holds the rows from the visual top down, whatever order the file stores
+// them in: the sign of InfoHeader.Height only says which order they are
+// written back in, bottom-up if positive and top-down if negative.
+// Alpha holds the per-pixel opacity in the same layout as Data, or is nil for fully
+// opaque images. Its values are straight (not premultiplied) alpha.
+// Wide holds the pixels at 16 bits per channel while the image is widened
+// for high precision processing (see Widen), and is nil otherwise.
+// Warnings lists the oddities of the file ParseBMP worked around rather than
+// rejecting it, such as an uncommon DIB header.
+// HeaderExtra holds the fields of a V4 or V5 DIB header past its first 40
+// bytes, such as the color space, and ICCProfile the color profile a V5
+// header embeds or links to. Both are written back into BMP output unless
+// SaveOptions.ColorProfile says otherwise. Comments holds the text blocks
+// after the pixel data, which BMP output carries over.
 type BMPImage struct {
-	Header     BMPHeader
-	InfoHeader DIBHeader
-	Data       [][]Pixel
+	Header      BMPHeader
+	InfoHeader  DIBHeader
+	Data        [][]Pixel
+	Alpha       [][]byte
+	Wide        [][]Pixel16
+	Warnings    []string
+	HeaderExtra []byte
+	ICCProfile  []byte
+	Comments    []string
+
+	indexed *indexedPixels // Palette representation, see ParseOptions.KeepPalette
+}
+
+// Clone returns a deep copy of the image that shares no memory with the original.
+func (b *BMPImage) Clone() *BMPImage {
+	c := &BMPImage{Header: b.Header, InfoHeader: b.InfoHeader, Warnings: slices.Clone(b.Warnings), HeaderExtra: slices.Clone(b.HeaderExtra), ICCProfile: slices.Clone(b.ICCProfile), Comments: slices.Clone(b.Comments)}
+	c.Data = make([][]Pixel, len(b.Data))
+	for y, row := range b.Data {
+		c.Data[y] = append([]Pixel(nil), row...)
+	}
+	if b.Alpha != nil {
+		c.Alpha = make([][]byte, len(b.Alpha))
+		for y, row := range b.Alpha {
+			c.Alpha[y] = append([]byte(nil), row...)
+		}
+	}
+	if b.Wide != nil {
+		c.Wide = make([][]Pixel16, len(b.Wide))
+		for y, row := range b.Wide {
+			c.Wide[y] = append([]Pixel16(nil), row...)
+		}
+	}
+	return c
+}
+
+// Rows returns an iterator over the rows of the image from the visual top to the
+// bottom. It yields the visual row number along with the row itself, which
+// aliases Data.
+func (b *BMPImage) Rows() iter.Seq2[int, []Pixel] {
+	return func(yield func(int, []Pixel) bool) {
+		for y, row := range b.Data {
+			if !yield(y, row) {
+				return
+			}
+		}
+	}
+}
+
+// At returns the pixel at column x of row y, counted from the visual top-left
+// corner of the image.
+func (b *BMPImage) At(x, y int) Pixel {
+	return b.Data[y][x]
+}
+
+// Set sets the pixel at column x of row y, counted from the visual top-left
+// corner as by At.
+func (b *BMPImage) Set(x, y int, p Pixel) {
+	b.Data[y][x] = p
+}
+
+// fileRow maps i, the index of a row of the pixel array in file order, to the
+// index of that row in Data. Bottom-up images (positive height) store the
+// visual bottom row first, so it is the last of Data.
+func (b *BMPImage) fileRow(i int) int {
+	if b.InfoHeader.Height > 0 {
+		return len(b.Data) - 1 - i
+	}
+	return i
 }
 
 // ParseBMP parses a BMP file from a byte slice and returns a BMPImage struct.
 // It performs various checks to ensure the validity and supported format of the BMP file.
 //
 // The function:
-// - Verifies the file size and header integrity.
+// - Takes the size of the file over a FileSize field unlike it, with a warning.
 // - Ensures the file type is "BM".
 // - Parses both BMP and DIB headers.
 // - Validates header information including dimensions, bit depth, and compression.
@@ -62,6 +145,365 @@ type BMPImage struct {
 // - *BMPImage: A pointer to the parsed BMPImage struct.
 // - error: An error if the BMP is invalid, unsupported, or corrupted.
 func ParseBMP(b []byte) (*BMPImage, error) {
+	return ParseBMPWith(b, ParseOptions{})
+}
+
+// ParseOptions controls how ParseBMPWith, SalvageBMP and DecodeImageWith read
+// a file.
+type ParseOptions struct {
+	Strict    bool  // Reject a FileSize unlike the size of the file with ErrCorruptFile instead of warning about it
+	MaxPixels int64 // Reject images over this many pixels with ErrPixelLimit before allocating them; 0 means no limit
+
+	// KeepPalette keeps the color table of palettized BMP images and the
+	// index of each pixel in it, so that ApplyTransformationsWith runs the
+	// pointwise filters at the start of a pipeline on the colors rather than
+	// on every pixel. The pixels must not be modified before, or the
+	// pipeline overwrites them with the colors they had.
+	KeepPalette bool
+
+	Hooks Hooks // Receive the progress of the "decode" stage and the warnings of DecodeImageWith
+}
+
+// ParseBMPWith is like ParseBMP, with the strictness and the pixel limit of
+// opts.
+func ParseBMPWith(b []byte, opts ParseOptions) (*BMPImage, error) {
+	bmp, err := parseHeaders(b)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Strict {
+		relaxFileSize(bmp, len(b))
+	}
+
+	// A file cut short is reported with how much of it is left, rather than as a size mismatch
+	if err := checkTruncation(bmp, len(b)); err != nil {
+		return nil, err
+	}
+
+	// Validate header information
+	if err := validateHeaders(bmp, len(b)); err != nil {
+		return nil, err
+	}
+	if err := checkPixels(int(bmp.InfoHeader.Width), utils.Abs(int(bmp.InfoHeader.Height)), opts.MaxPixels); err != nil {
+		return nil, err
+	}
+
+	alpha, err := hasAlpha(bmp, b)
+	if err != nil {
+		return nil, err
+	}
+	readHeaderExtra(bmp, b)
+	readComments(bmp, b)
+	decodeRows(bmp, b, utils.Abs(int(bmp.InfoHeader.Height)), alpha)
+	if opts.KeepPalette {
+		bmp.indexed = readIndices(bmp, b)
+	}
+	return bmp, nil
+}
+
+// SalvageBMP decodes a BMP whose pixel data may be truncated. The complete
+// rows present in b are decoded and the missing ones are filled with fill.
+// It returns the image along with the number of complete rows, which is the
+// image height if nothing is missing. Any other problem with the file is
+// reported as by ParseBMPWith with opts.
+func SalvageBMP(b []byte, fill Pixel, opts ParseOptions) (*BMPImage, int, error) {
+	bmp, err := parseHeaders(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !opts.Strict {
+		relaxFileSize(bmp, len(b))
+	}
+
+	var truncated *TruncatedError
+	switch err := checkTruncation(bmp, len(b)); {
+	case err == nil:
+		bmp, err := ParseBMPWith(b, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		return bmp, len(bmp.Data), nil
+	case !errors.As(err, &truncated):
+		return nil, 0, err
+	}
+
+	if err := checkPixels(int(bmp.InfoHeader.Width), truncated.Total, opts.MaxPixels); err != nil {
+		return nil, 0, err
+	}
+	present := truncated.Present
+	alpha, err := hasAlpha(bmp, b)
+	if err != nil {
+		return nil, 0, err
+	}
+	readHeaderExtra(bmp, b)
+
+	decodeRows(bmp, b, present, alpha)
+	for i := present; i < len(bmp.Data); i++ {
+		row := bmp.Data[bmp.fileRow(i)]
+		for x := range row {
+			row[x] = fill
+		}
+	}
+	return bmp, present, nil
+}
+
+// checkTruncation returns a *TruncatedError if the pixel array of bmp is cut
+// short in a file of fileSize bytes while the headers are otherwise sound,
+// that is valid for the file it would be if complete. A short file whose
+// headers are wrong too, such as a DataOffset pointing into the headers or,
+// when ParseOptions.Strict keeps it, a FileSize that doesn't match the
+// declared pixel array, gives the header error instead: the truncation
+// can't be salvaged if the headers can't be trusted. A complete file gives
+// nil and is left for validateHeaders.
+func checkTruncation(bmp *BMPImage, fileSize int) error {
+	present, total, truncated := truncatedRows(bmp, fileSize)
+	if !truncated {
+		return nil
+	}
+
+	if int64(bmp.Header.DataOffset) < 14+int64(bmp.InfoHeader.Size) {
+		return fmt.Errorf("%w: pixel data offset %d overlaps the %d bytes of headers", ErrCorruptFile, bmp.Header.DataOffset, 14+bmp.InfoHeader.Size)
+	}
+	size := int64(bmp.Header.DataOffset) + max(int64(bmp.InfoHeader.ImageSize), int64(pixelStride(bmp))*int64(total))
+	if size > math.MaxUint32 {
+		return ErrCorruptFile
+	}
+	if err := validateHeaders(bmp, int(size)); err != nil {
+		return err
+	}
+	return &TruncatedError{Present: present, Total: total}
+}
+
+// relaxFileSize replaces a FileSize field unlike fileSize, the size of the
+// file, with the size the file has, or would have if its pixel array weren't
+// cut short, and warns about it. Encoders write FileSize rounded, too large
+// or 0 often enough that it can't be relied on; what matters is whether the
+// pixel array fits in the file, which checkTruncation tells.
+func relaxFileSize(bmp *BMPImage, fileSize int) {
+	declared := bmp.Header.FileSize
+	if int64(declared) == int64(fileSize) || int64(fileSize) > math.MaxUint32 {
+		return
+	}
+
+	bmp.Header.FileSize = uint32(fileSize)
+	if _, total, truncated := truncatedRows(bmp, fileSize); truncated {
+		size := int64(bmp.Header.DataOffset) + max(int64(bmp.InfoHeader.ImageSize), int64(pixelStride(bmp))*int64(total))
+		if size > math.MaxUint32 {
+			return
+		}
+		bmp.Header.FileSize = uint32(size)
+	}
+	bmp.Warnings = append(bmp.Warnings, fmt.Sprintf("FileSize is %d, taken as the %d bytes of the file", declared, bmp.Header.FileSize))
+}
+
+// truncatedRows reports whether the pixel array of an image of a supported
+// bit depth with the given headers would be cut short in a file of fileSize bytes, and if so
+// how many complete rows are present out of the total. Headers that don't
+// describe such an image are left for validateHeaders to reject.
+func truncatedRows(bmp *BMPImage, fileSize int) (present, total int, truncated bool) {
+	bpp := int(bmp.InfoHeader.BitsPerPixel)
+	if bmp.InfoHeader.Width <= 0 || bmp.InfoHeader.Height == 0 || !slices.Contains(BMPBitDepths, bpp) || checkBounds(bmp, maxFileSize) != nil {
+		return 0, 0, false
+	}
+
+	total = utils.Abs(int(bmp.InfoHeader.Height))
+	stride := int64(pixelStride(bmp))
+	available := int64(fileSize) - int64(bmp.Header.DataOffset)
+	if available >= stride*int64(total) {
+		return 0, total, false
+	}
+	return int(max(available, 0) / stride), total, true
+}
+
+// decodeRows allocates the pixel data of bmp and decodes the first rows
+// rows, in file order, from b into their visual place in Data. The remaining
+// rows are left black. If alpha is
+// set, the fourth byte of every pixel is decoded into Alpha, which is dropped
+// again if every pixel turns out to be opaque; missing rows count as opaque.
+// The indices of a palettized image are unpacked with paletteIndex and looked
+// up in its color table, those past its end giving black with a warning.
+func decodeRows(bmp *BMPImage, b []byte, rows int, alpha bool) {
+	h := utils.Abs(int(bmp.InfoHeader.Height))
+	w := int(bmp.InfoHeader.Width)
+	bpp := int(bmp.InfoHeader.BitsPerPixel)
+	bytesPerPixel := bpp / 8
+	stride := pixelStride(bmp)
+	dataOffset := int(bmp.Header.DataOffset)
+	palette := readPalette(bmp, b)
+	bmp.Data = make([][]Pixel, h)
+	if alpha {
+		bmp.Alpha = make([][]byte, h)
+	}
+	opaque, outside := true, false
+
+	// The headers passed checkBounds, so the offsets can't overflow
+	for i := 0; i < h; i++ {
+		y := bmp.fileRow(i)
+		bmp.Data[y] = make([]Pixel, w)
+		if alpha {
+			bmp.Alpha[y] = make([]byte, w)
+		}
+		if i >= rows {
+			if alpha {
+				for x := range bmp.Alpha[y] {
+					bmp.Alpha[y][x] = 255
+				}
+			}
+			continue
+		}
+		for x := 0; x < w; x++ {
+			pixelOffset := dataOffset + i*stride + x*bytesPerPixel
+			if palette != nil {
+				index := paletteIndex(b[dataOffset+i*stride:], x, bpp)
+				bmp.Data[y][x] = paletteEntry(palette, index)
+				outside = outside || int(index) >= len(palette)
+				continue
+			}
+			bmp.Data[y][x] = Pixel{
+				Blue:  b[pixelOffset],
+				Green: b[pixelOffset+1],
+				Red:   b[pixelOffset+2],
+			}
+			if alpha {
+				bmp.Alpha[y][x] = b[pixelOffset+3]
+				opaque = opaque && b[pixelOffset+3] == 255
+			}
+		}
+	}
+	if opaque {
+		bmp.Alpha = nil
+	}
+	if outside {
+		bmp.Warnings = append(bmp.Warnings, fmt.Sprintf("pixel indices past the %d colors of the palette are decoded as black", len(palette)))
+	}
+}
+
+// paletteColors returns the number of entries in the color table of a
+// palettized image, of 1, 4 or 8 bits per pixel: ColorsUsed, or as many as
+// the pixels can index if it is 0. Other images have no table.
+func paletteColors(bmp *BMPImage) int64 {
+	switch bpp := bmp.InfoHeader.BitsPerPixel; {
+	case bpp > 8:
+		return 0
+	case bmp.InfoHeader.ColorsUsed == 0:
+		return 1 << bpp
+	}
+	return int64(bmp.InfoHeader.ColorsUsed)
+}
+
+// readPalette returns the color table of a palettized image from the file b,
+// or nil for other images. Its entries follow the DIB header, 4 bytes each in
+// BGR order with an unused fourth byte. The headers must have passed
+// validateHeaders, so that the table lies before the pixels; the entries
+// past the end of a truncated b are left black.
+func readPalette(bmp *BMPImage, b []byte) []Pixel {
+	colors := paletteColors(bmp)
+	if colors == 0 {
+		return nil
+	}
+	palette := make([]Pixel, colors)
+	start := 14 + int(bmp.InfoHeader.Size)
+	for i := range palette {
+		entry := start + 4*i
+		if entry+3 > len(b) {
+			break
+		}
+		palette[i] = Pixel{Blue: b[entry], Green: b[entry+1], Red: b[entry+2]}
+	}
+	return palette
+}
+
+// paletteIndex returns the palette index of pixel x of row, the pixels of an
+// image of bpp bits per pixel, 1, 4 or 8. Pixels of fewer than 8 bits are
+// packed from the most significant bits of each byte, the leftmost first.
+func paletteIndex(row []byte, x, bpp int) byte {
+	bit := x * bpp
+	return row[bit/8] >> (8 - bpp - bit%8) & (1<<bpp - 1)
+}
+
+// paletteEntry returns entry i of palette, or black, as most viewers show
+// them, for an index past its end.
+func paletteEntry(palette []Pixel, i byte) Pixel {
+	if int(i) >= len(palette) {
+		return Pixel{}
+	}
+	return palette[i]
+}
+
+// biBitfields is the compression method of pixel arrays whose channels are
+// described by color masks rather than implied by the bit depth.
+const biBitfields = 3
+
+// hasAlpha reports whether the pixels of a 32-bit image carry an alpha
+// channel in their fourth byte, as declared by an alpha mask. The color masks
+// of a BI_BITFIELDS image follow the 40-byte DIB header, where the larger V4
+// and V5 headers also hold the alpha mask. Only the usual byte-aligned BGRA
+// layout is supported. Without masks, the fourth byte of a 32-bit pixel is
+// unused, and other images have no alpha channel at all.
+func hasAlpha(bmp *BMPImage, b []byte) (bool, error) {
+	if bmp.InfoHeader.BitsPerPixel != 32 || bmp.InfoHeader.Compression != biBitfields {
+		return false, nil
+	}
+	if len(b) < 66 || bmp.Header.DataOffset < 66 {
+		return false, ErrCorruptFile
+	}
+
+	red := binary.LittleEndian.Uint32(b[54:58])
+	green := binary.LittleEndian.Uint32(b[58:62])
+	blue := binary.LittleEndian.Uint32(b[62:66])
+	if red != 0x00ff0000 || green != 0x0000ff00 || blue != 0x000000ff {
+		return false, ErrUnsupportedCompression
+	}
+
+	if bmp.InfoHeader.Size < 56 {
+		return false, nil
+	}
+	if len(b) < 70 {
+		return false, ErrCorruptFile
+	}
+	switch binary.LittleEndian.Uint32(b[66:70]) {
+	case 0:
+		return false, nil
+	case 0xff000000:
+		return true, nil
+	}
+	return false, ErrUnsupportedCompression
+}
+
+// dibHeaderNames names the DIB headers by their size. All of them start
+// with the 40 bytes of BITMAPINFOHEADER, the only fields read but for the
+// color masks of hasAlpha.
+var dibHeaderNames = map[uint32]string{
+	40:  "BITMAPINFOHEADER",
+	52:  "BITMAPV2INFOHEADER",
+	56:  "BITMAPV3INFOHEADER",
+	64:  "OS/2 BITMAPINFOHEADER2",
+	108: "BITMAPV4HEADER",
+	124: "BITMAPV5HEADER",
+}
+
+// os2HeaderSize is the size of the OS/2 DIB header, whose compression
+// methods don't mean what they do in the Windows headers.
+const os2HeaderSize = 64
+
+// dibHeaderWarning returns the warning for a DIB header of the given size,
+// or "" for the common ones, which are read without any guesswork. The
+// pixels of the others are found at dataOffset like any other's, skipping
+// whatever fields lie between.
+func dibHeaderWarning(size, dataOffset uint32) string {
+	switch name, ok := dibHeaderNames[size]; {
+	case size == 40 || size == v4HeaderSize || size == v5HeaderSize:
+		return ""
+	case ok:
+		return fmt.Sprintf("%d-byte %s DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset %d", size, name, dataOffset)
+	}
+	return fmt.Sprintf("unknown %d-byte DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset %d", size, dataOffset)
+}
+
+// parseHeaders decodes the BMP and DIB headers from the first 54 bytes of b.
+// It only checks the signature and the DIB header size, warning about the
+// uncommon ones; the remaining fields are validated by validateHeaders.
+func parseHeaders(b []byte) (*BMPImage, error) {
 	if len(b) < 54 {
 		return nil, ErrInvalidBMP
 	}
@@ -71,6 +513,10 @@ func ParseBMP(b []byte) (*BMPImage, error) {
 	// Parse BMP Header
 	bmp.Header.Signature = [2]byte{b[0], b[1]}
 	if string(bmp.Header.Signature[:]) != "BM" {
+		// Say what the file is instead, if it is an image all the same
+		if format, err := DetectFormat(b); err == nil {
+			return nil, fmt.Errorf("%w: it is a %s image", ErrInvalidFileType, format)
+		}
 		return nil, ErrInvalidFileType
 	}
 	bmp.Header.FileSize = binary.LittleEndian.Uint32(b[2:6])
@@ -82,6 +528,9 @@ func ParseBMP(b []byte) (*BMPImage, error) {
 	if bmp.InfoHeader.Size < 40 {
 		return nil, ErrInvalidHeaderSize
 	}
+	if warning := dibHeaderWarning(bmp.InfoHeader.Size, bmp.Header.DataOffset); warning != "" {
+		bmp.Warnings = append(bmp.Warnings, warning)
+	}
 	bmp.InfoHeader.Width = int32(binary.LittleEndian.Uint32(b[18:22]))
 	bmp.InfoHeader.Height = int32(binary.LittleEndian.Uint32(b[22:26]))
 	bmp.InfoHeader.Planes = binary.LittleEndian.Uint16(b[26:28])
@@ -93,34 +542,73 @@ func ParseBMP(b []byte) (*BMPImage, error) {
 	bmp.InfoHeader.ColorsUsed = binary.LittleEndian.Uint32(b[46:50])
 	bmp.InfoHeader.ColorsImportant = binary.LittleEndian.Uint32(b[50:54])
 
-	// Validate header information
-	if err := validateHeaders(bmp, len(b)); err != nil {
-		return nil, err
+	// Uncompressed pixels may leave ImageSize 0 for the dimensions to give
+	if bmp.InfoHeader.ImageSize == 0 && (bmp.InfoHeader.Compression == 0 || bmp.InfoHeader.Compression == biBitfields) {
+		if size, ok := impliedImageSize(bmp); ok {
+			bmp.InfoHeader.ImageSize = size
+			bmp.Warnings = append(bmp.Warnings, fmt.Sprintf("ImageSize is 0, taken as the %d bytes of rows padded to 4 bytes", size))
+		}
 	}
 
-	// Set pixel data
-	h := utils.Abs(int(bmp.InfoHeader.Height))
-	w := int(bmp.InfoHeader.Width)
-	bytesPerPixel := int(bmp.InfoHeader.BitsPerPixel) / 8
-	rowSize := w * bytesPerPixel
-	dataOffset := int(bmp.Header.DataOffset)
-	bmp.Data = make([][]Pixel, h)
+	return bmp, nil
+}
 
-	for y := 0; y < h; y++ {
-		bmp.Data[y] = make([]Pixel, w)
-		for x := 0; x < w; x++ {
-			pixelOffset := dataOffset + y*rowSize + x*bytesPerPixel
-			bmp.Data[y][x] = Pixel{
-				Blue:  b[pixelOffset],
-				Green: b[pixelOffset+1],
-				Red:   b[pixelOffset+2],
-			}
-		}
+// impliedImageSize returns the size of the pixel array the dimensions and
+// bit depth of bmp give, with rows padded to 4 bytes, and whether it is one:
+// unsupported bit depths, non-positive dimensions and arrays of more than
+// 4 GiB have none, and are left for validateHeaders to reject.
+func impliedImageSize(bmp *BMPImage) (uint32, bool) {
+	bpp := int(bmp.InfoHeader.BitsPerPixel)
+	if bmp.InfoHeader.Width <= 0 || bmp.InfoHeader.Height == 0 || !slices.Contains(BMPBitDepths, bpp) {
+		return 0, false
 	}
+	stride := stride64(int(bmp.InfoHeader.Width), bpp, 4)
+	height := int64(bmp.InfoHeader.Height)
+	height = max(height, -height)
+	if height > math.MaxUint32/stride {
+		return 0, false
+	}
+	return uint32(stride * height), true
+}
 
+// ReadBMPHeader reads and validates only the headers of the BMP file at path,
+// leaving Data empty. It is used to plan a pipeline without decoding pixels.
+func ReadBMPHeader(path string) (*BMPImage, error) {
+	bmp, size, err := readHeaderFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateHeaders(bmp, int(size)); err != nil {
+		return nil, err
+	}
 	return bmp, nil
 }
 
+// readHeaderFile parses the headers of the file at path without validating
+// them, and returns them along with the size of the file.
+func readHeaderFile(path string) (*BMPImage, int64, error) {
+	f, size, err := openInput(path)
+	if err != nil {
+		return nil, 0, ioError(err)
+	}
+	defer f.Close()
+
+	head := make([]byte, 54)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, 0, ErrInvalidBMP
+	}
+
+	bmp, err := parseHeaders(head)
+	if err != nil {
+		return nil, 0, err
+	}
+	relaxFileSize(bmp, int(size))
+	return bmp, size, nil
+}
+
+// BMPBitDepths lists the bits per pixel of the BMP files ParseBMP decodes.
+var BMPBitDepths = []int{1, 4, 8, 24, 32}
+
 // validateHeaders performs various checks on the BMP and DIB headers to ensure
 // the BMP file is valid and supported. It checks for correct file size, positive
 // dimensions, supported bit depth, and uncompressed format. It also validates
@@ -142,46 +630,270 @@ func validateHeaders(bmp *BMPImage, fileSize int) error {
 	if bmp.InfoHeader.Planes != 1 {
 		return ErrUnsupportedFormat
 	}
-	if bmp.InfoHeader.BitsPerPixel != 24 {
+	if !slices.Contains(BMPBitDepths, int(bmp.InfoHeader.BitsPerPixel)) {
 		return ErrUnsupportedFormat
 	}
-	if bmp.InfoHeader.Compression != 0 {
+	if bmp.InfoHeader.Compression != 0 && (bmp.InfoHeader.Compression != biBitfields || bmp.InfoHeader.BitsPerPixel != 32 || bmp.InfoHeader.Size == os2HeaderSize) {
 		return ErrUnsupportedCompression
 	}
+	if int64(bmp.Header.DataOffset) < 14+int64(bmp.InfoHeader.Size) {
+		return ErrCorruptFile
+	}
+	// The color table of a palettized image lies between the headers and the pixels
+	if colors := paletteColors(bmp); colors > 256 || int64(bmp.Header.DataOffset) < 14+int64(bmp.InfoHeader.Size)+4*colors {
+		return ErrCorruptFile
+	}
+	if err := checkBounds(bmp, maxFileSize); err != nil {
+		return err
+	}
 
 	// Validate image size
-	widthInBytes := uint32(math.Abs(float64(bmp.InfoHeader.Width)) * float64(bmp.InfoHeader.BitsPerPixel) / 8)
-	paddedWidth := (widthInBytes + 3) & ^uint32(3) // Round up to nearest multiple of 4
-	expectedImageSize := (paddedWidth*uint32(math.Abs(float64(bmp.InfoHeader.Height))) + 3) & ^uint32(3)
-
-	if bmp.InfoHeader.ImageSize != expectedImageSize {
+	if _, ok := declaredStride(bmp); !ok {
 		return ErrInvalidImageData
 	}
 
 	return nil
 }
 
+// declaredStride returns the number of bytes between the starts of two rows
+// of the pixel array, as declared by the headers, and whether they are
+// consistent. Normally rows are padded to 4 bytes and ImageSize is exactly
+// the size of the padded rows. Some encoders align rows to more than 4
+// bytes, which shows as an ImageSize that is a whole number of rows of a
+// wider stride, a multiple of 4 too; others round ImageSize up beyond the
+// last row, which leaves the stride unchanged. The pixel array must fit in
+// the file either way. The headers must pass checkBounds, so that the
+// stride fits in an int.
+func declaredStride(bmp *BMPImage) (int, bool) {
+	minimal := stride64(int(bmp.InfoHeader.Width), int(bmp.InfoHeader.BitsPerPixel), 4)
+	height := int64(bmp.InfoHeader.Height)
+	height = max(height, -height)
+	size := int64(bmp.InfoHeader.ImageSize)
+
+	switch {
+	case size == (minimal*height+3) & ^int64(3):
+		return int(minimal), true
+	case int64(bmp.Header.DataOffset)+size > int64(bmp.Header.FileSize):
+		return int(minimal), false
+	case size%height == 0 && size/height > minimal && size/height%4 == 0:
+		return int(size / height), true
+	case size > minimal*height:
+		return int(minimal), true
+	}
+	return int(minimal), false
+}
+
+// pixelStride returns the stride rows are read with: the declared one, or
+// the minimal 4-byte aligned one if the headers are inconsistent.
+func pixelStride(bmp *BMPImage) int {
+	stride, _ := declaredStride(bmp)
+	return stride
+}
+
 // SerializeBMP converts a BMPImage struct
-// into a byte slice representing the complete BMP file.
+// into a byte slice representing the complete BMP file, as EncodeBMP writes
+// it followed by the comments of the image.
 // It handles the BMP and DIB headers, accounts for row padding,
 // and properly organizes the pixel data.
-func SerializeBMP(image *BMPImage) []byte {
-	// Calculate sizes and offsets
-	headerSize := int(image.Header.DataOffset)
-	width := int(image.InfoHeader.Width)
-	height := utils.Abs(int(image.InfoHeader.Height)) // Handle top-down BMPs
-	bytesPerPixel := int(image.InfoHeader.BitsPerPixel) / 8
-	rowSize := (width*bytesPerPixel + 3) & ^3 // 4-byte alignment
-	dataSize := rowSize * height
-	totalSize := headerSize + dataSize
-
-	// Pre-allocate a byte slice for the entire BMP file
-	data := make([]byte, totalSize)
+// The size of the result is always the one EncodedSize predicts. An image
+// whose headers don't match its pixels is an error wrapping
+// ErrInconsistentImage, as for EncodeBMP.
+func SerializeBMP(image *BMPImage) ([]byte, error) {
+	if err := image.checkConsistency(); err != nil {
+		return nil, err
+	}
 
+	// Pre-allocate the buffer for the entire BMP file
+	size := EncodedSize(image, SaveOptions{Format: FormatBMP24})
+	if err := checkFileSize(size); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(size))
+
+	// The image was checked and writing to a bytes.Buffer can't fail
+	_ = Encode(&buf, image, SaveOptions{Format: FormatBMP24})
+
+	if int64(buf.Len()) != size {
+		panic(fmt.Sprintf("SerializeBMP: wrote %d bytes, but EncodedSize predicted %d", buf.Len(), size))
+	}
+	return buf.Bytes(), nil
+}
+
+// checkHeaders returns an error wrapping ErrInconsistentImage if the headers
+// of b can't be encoded: dimensions that aren't positive, a DIB header
+// shorter than the fields written, pixels starting inside the headers, an
+// unsupported bit depth or a HeaderExtra of another size than the DIB header.
+func (b *BMPImage) checkHeaders() error {
+	switch {
+	case b.InfoHeader.Width <= 0 || b.InfoHeader.Height == 0:
+		return fmt.Errorf("%w: dimensions %dx%d", ErrInconsistentImage, b.InfoHeader.Width, b.InfoHeader.Height)
+	case b.InfoHeader.Size < 40:
+		return fmt.Errorf("%w: DIB header size %d is under 40 bytes", ErrInconsistentImage, b.InfoHeader.Size)
+	case int64(b.Header.DataOffset) < 14+int64(b.InfoHeader.Size):
+		return fmt.Errorf("%w: pixel data offset %d overlaps the %d bytes of headers", ErrInconsistentImage, b.Header.DataOffset, 14+b.InfoHeader.Size)
+	case !slices.Contains(BMPBitDepths, int(b.InfoHeader.BitsPerPixel)):
+		return fmt.Errorf("%w: unsupported bit depth %d", ErrInconsistentImage, b.InfoHeader.BitsPerPixel)
+	case b.HeaderExtra != nil && len(b.HeaderExtra) != int(b.InfoHeader.Size)-40:
+		return fmt.Errorf("%w: %d bytes of extra DIB header fields for a %d-byte header", ErrInconsistentImage, len(b.HeaderExtra), b.InfoHeader.Size)
+	}
+	return nil
+}
+
+// checkConsistency is checkHeaders that also checks that Data, and Alpha and
+// Wide if set, have as many rows of as many pixels as the headers declare,
+// which transformations could otherwise leave them without.
+func (b *BMPImage) checkConsistency() error {
+	if err := b.checkHeaders(); err != nil {
+		return err
+	}
+	return b.checkPlanes()
+}
+
+// checkPlanes checks that Data, and Alpha and Wide if set, have as many
+// rows of as many pixels as the headers declare.
+func (b *BMPImage) checkPlanes() error {
+	width, height := int(b.InfoHeader.Width), utils.Abs(int(b.InfoHeader.Height))
+	if err := checkPlane("Data", b.Data, width, height); err != nil {
+		return err
+	}
+	if b.Alpha != nil {
+		if err := checkPlane("Alpha", b.Alpha, width, height); err != nil {
+			return err
+		}
+	}
+	if b.Wide != nil {
+		return checkPlane("Wide", b.Wide, width, height)
+	}
+	return nil
+}
+
+// checkPlane returns an error wrapping ErrInconsistentImage unless grid, the
+// field of the given name, has height rows of width values.
+func checkPlane[T any](name string, grid [][]T, width, height int) error {
+	if len(grid) != height {
+		return fmt.Errorf("%w: the headers declare %d rows, but %s has %d", ErrInconsistentImage, height, name, len(grid))
+	}
+	for y, row := range grid {
+		if len(row) != width {
+			return fmt.Errorf("%w: the headers declare %d columns, but row %d of %s has %d", ErrInconsistentImage, width, y, name, len(row))
+		}
+	}
+	return nil
+}
+
+// EncodeBMP writes image to w as a complete 24-bit BMP file, as Encode does
+// with default options: a widened image is quantized to 8 bits per channel
+// and a transparent one is flattened onto black.
+// Row buffers are recycled between calls, but every padding byte is explicitly
+// zeroed, so encoding the same image always produces identical bytes.
+func EncodeBMP(w io.Writer, image *BMPImage) error {
+	return EncodeBMPAligned(w, image, 4)
+}
+
+// EncodeBMPAligned is like EncodeBMP, but pads rows to a multiple of align
+// bytes, as some embedded framebuffer loaders require. Only an align of 4
+// gives a standard BMP file. An image whose headers don't match its pixels
+// is an error wrapping ErrInconsistentImage, and nothing is written.
+func EncodeBMPAligned(w io.Writer, image *BMPImage, align int) error {
+	if err := image.checkConsistency(); err != nil {
+		return err
+	}
+	image = SaveOptions{}.prepare(image, false)
+	bw, err := NewBMPWriterAligned(w, image, align)
+	if err != nil {
+		return err
+	}
+
+	for i := range image.Data {
+		if err := bw.WriteRow(image.Data[image.fileRow(i)]); err != nil {
+			bw.Close()
+			return err
+		}
+	}
+
+	return bw.Close()
+}
+
+// pixelArraySize returns the size in bytes of a pixel array with the given
+// dimensions and bit depth, including the padding at the end of every row.
+func pixelArraySize(width, height, bitsPerPixel int) int64 {
+	return alignedArraySize(width, height, bitsPerPixel, 4)
+}
+
+// alignedArraySize is like pixelArraySize for rows padded to a multiple of
+// align bytes.
+func alignedArraySize(width, height, bitsPerPixel, align int) int64 {
+	return stride64(width, bitsPerPixel, align) * int64(height)
+}
+
+// outputHeaders returns a copy of image with the headers it is encoded with
+// when rows are padded to a multiple of align bytes. Output is always 24-bit,
+// so 32-bit input gets the headers of a plain 24-bit image: alpha is
+// flattened before encoding and its masks no longer apply. Likewise
+// palettized input, whose colors were expanded from its palette, loses the
+// table and the color counts. A V4 or V5 header
+// kept in HeaderExtra stays, without its masks, and the ICC profile is
+// written after the pixel array. Headers of other sizes, whose fields past
+// the first 40 bytes aren't kept, become a plain 40-byte header, and the
+// pixels always follow the headers, without whatever lay between them in
+// the input.
+func (b *BMPImage) outputHeaders(align int) BMPImage {
+	out := BMPImage{Header: b.Header, InfoHeader: b.InfoHeader, ICCProfile: b.ICCProfile}
+	if b.HeaderExtra == nil {
+		out.InfoHeader.Size = 40
+	}
+	out.Header.DataOffset = 14 + out.InfoHeader.Size
+	out.InfoHeader.BitsPerPixel = 24
+	out.InfoHeader.Compression = 0
+	out.InfoHeader.ColorsUsed, out.InfoHeader.ColorsImportant = 0, 0
+	out.updateSizesAligned(align)
+	if b.HeaderExtra != nil {
+		out.HeaderExtra = slices.Clone(b.HeaderExtra)
+		clear(out.HeaderExtra[:extraMasksEnd])
+		if out.ICCProfile != nil {
+			binary.LittleEndian.PutUint32(out.HeaderExtra[extraProfileData:], out.Header.DataOffset+out.InfoHeader.ImageSize-14)
+			binary.LittleEndian.PutUint32(out.HeaderExtra[extraProfileSize:], uint32(len(out.ICCProfile)))
+		}
+	}
+	return out
+}
+
+// outputSize returns the size of the file EncodeBMPAligned writes for the
+// image with rows padded to a multiple of align bytes. Unlike the FileSize of
+// outputHeaders, it doesn't wrap around past the largest FileSize.
+func (b *BMPImage) outputSize(align int) int64 {
+	out := b.outputHeaders(align)
+	return int64(out.Header.DataOffset) + alignedArraySize(int(out.InfoHeader.Width), utils.Abs(int(out.InfoHeader.Height)), 24, align) + int64(len(out.ICCProfile))
+}
+
+// updateSizes recomputes the ImageSize and FileSize header fields from the
+// dimensions, bit depth and DataOffset of the image, and the size of its ICC
+// profile.
+func (b *BMPImage) updateSizes() {
+	b.updateSizesAligned(4)
+}
+
+// updateSizesAligned is like updateSizes for rows padded to a multiple of
+// align bytes.
+func (b *BMPImage) updateSizesAligned(align int) {
+	imageSize := alignedArraySize(int(b.InfoHeader.Width), utils.Abs(int(b.InfoHeader.Height)), int(b.InfoHeader.BitsPerPixel), align)
+	b.InfoHeader.ImageSize = uint32(imageSize)
+	b.Header.FileSize = uint32(int64(b.Header.DataOffset) + imageSize + int64(len(b.ICCProfile)))
+}
+
+// putHeaders writes the BMP and DIB headers of image into the first 54 bytes
+// of data, followed by HeaderExtra if set.
+func putHeaders(data []byte, image *BMPImage) {
 	// Serialize BMP Header
 	binary.LittleEndian.PutUint16(data[0:2], uint16(image.Header.Signature[0])|uint16(image.Header.Signature[1])<<8)
 	binary.LittleEndian.PutUint32(data[2:6], image.Header.FileSize)
-	binary.LittleEndian.PutUint32(data[6:10], image.Header.Reserved)
+	// The trailer of a stamp isn't carried over, so neither is its tag
+	reserved := image.Header.Reserved
+	if isStampTag(reserved) {
+		reserved = 0
+	}
+	binary.LittleEndian.PutUint32(data[6:10], reserved)
 	binary.LittleEndian.PutUint32(data[10:14], image.Header.DataOffset)
 
 	// Serialize DIB Header
@@ -196,45 +908,34 @@ func SerializeBMP(image *BMPImage) []byte {
 	binary.LittleEndian.PutUint32(data[42:46], uint32(image.InfoHeader.YPixelsPerMeter))
 	binary.LittleEndian.PutUint32(data[46:50], image.InfoHeader.ColorsUsed)
 	binary.LittleEndian.PutUint32(data[50:54], image.InfoHeader.ColorsImportant)
+	copy(data[54:], image.HeaderExtra)
+}
 
-	// Serialize pixel data with padding
-	offset := headerSize
-	rowBytes := width * bytesPerPixel // actual bytes used by pixels in a row
-	padding := rowSize - rowBytes     // padding bytes needed for 4-byte alignment
-
-	for y := 0; y < height; y++ {
-		// Write pixel data for the current row
-		for x := 0; x < width; x++ {
-			pixel := image.Data[y][x]
-			data[offset] = pixel.Blue
-			data[offset+1] = pixel.Green
-			data[offset+2] = pixel.Red
-			offset += bytesPerPixel
-		}
-
-		// Add padding bytes at the end of the row
-		for p := 0; p < padding; p++ {
-			data[offset] = 0
-			offset++
-		}
+// LoadBMP reads and parses the BMP file at path, memory-mapping it as
+// LoadImage does.
+func LoadBMP(path string) (*BMPImage, error) {
+	b, release, err := readFile(path)
+	if err != nil {
+		return nil, err
 	}
-
-	return data
+	defer release()
+	return ParseBMP(b)
 }
 
+// SaveBMP atomically writes image as a 24-bit BMP into the file filename.
 func SaveBMP(image *BMPImage, filename string) error {
-	data := SerializeBMP(image)
-	return os.WriteFile(filename, data, 0o644)
+	return Save(image, filename, SaveOptions{})
 }
 
-// PrintBMPHeaderInfo prints the BMP and DIB header information in a formatted style.
+// PrintBMPHeaderInfo prints the BMP and DIB header information to w in a formatted style.
 // It displays all relevant fields from both headers, providing a comprehensive
 // overview of the BMP file structure and image properties.
 //
 // Parameters:
+// - w: The writer the headers are printed to, such as os.Stdout.
 // - image: A pointer to the BMPImage struct containing the headers to print.
-func PrintBMPHeaderInfo(image *BMPImage) {
-	fmt.Printf(`BMP Header:
+func PrintBMPHeaderInfo(w io.Writer, image *BMPImage) {
+	fmt.Fprintf(w, `BMP Header:
 - Signature: %s
 - FileSize: %d bytes
 - DataOffset: %d bytes
@@ -0,0 +1,634 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// dirtyRowPool takes buffers out of the row pool, fills them with 0xff bytes,
+// as if left behind by earlier encodes of other images, and puts them back.
+func dirtyRowPool() {
+	bufs := make([][]byte, 8)
+	for i := range bufs {
+		bufs[i] = getRowBuffer(4096)
+		for j := range bufs[i] {
+			bufs[i][j] = 0xff
+		}
+	}
+	for _, b := range bufs {
+		putRowBuffer(b)
+	}
+}
+
+func TestEncodeBMPZeroesPadding(t *testing.T) {
+	for width := 1; width <= 8; width++ {
+		t.Run(fmt.Sprintf("width_%d", width), func(t *testing.T) {
+			image := noiseImage(width, 5, int64(width))
+			want := encodeBMP(t, image)
+
+			for run := range 3 {
+				dirtyRowPool()
+				got := encodeBMP(t, image)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("run %d: output differs from the first encode", run)
+				}
+			}
+
+			stride := rowStride(width, 24)
+			offset := int(image.Header.DataOffset)
+			for y := range 5 {
+				row := want[offset+y*stride : offset+(y+1)*stride]
+				for i, b := range row[width*3:] {
+					if b != 0 {
+						t.Errorf("row %d: padding byte %d is %#02x, want 0", y, i, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSerializeBMPRoundTripOddWidths(t *testing.T) {
+	for width := 1; width <= 7; width++ {
+		for _, orientation := range []string{"bottom-up", "top-down"} {
+			t.Run(fmt.Sprintf("width_%d_%s", width, orientation), func(t *testing.T) {
+				image := noiseImage(width, 3, int64(width))
+				if orientation == "top-down" {
+					image = topDown(image)
+				}
+				data, err := SerializeBMP(image)
+				if err != nil {
+					t.Fatalf("SerializeBMP: %v", err)
+				}
+				if want := 54 + 3*((width*3+3)/4*4); len(data) != want {
+					t.Errorf("%d bytes, want %d for rows padded to 4 bytes", len(data), want)
+				}
+
+				parsed, err := ParseBMP(data)
+				if err != nil {
+					t.Fatalf("ParseBMP: %v", err)
+				}
+				if x, y, ok := firstDifference(image, parsed); !ok {
+					t.Errorf("pixel (%d, %d) differs after a round trip", x, y)
+				}
+				// x/image/bmp shares no code with ParseBMP, stride included
+				reference, err := decodeTheirs(data)
+				if err != nil {
+					t.Fatalf("x/image/bmp: %v", err)
+				}
+				for y, row := range image.Rows() {
+					for x, p := range row {
+						if c := opaqueAt(reference, x, y); c.R != p.Red || c.G != p.Green || c.B != p.Blue {
+							t.Fatalf("x/image/bmp reads %v at (%d, %d), want %v", c, x, y, p)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseBMPTruncationVersusCorruption(t *testing.T) {
+	// 10x20 pixels, rows of 32 bytes, so the pixel array spans 640 bytes from offset 54
+	full := encodeBMP(t, noiseImage(10, 20, 1))
+	const stride = 32
+
+	// patched returns b cut to size bytes with the 32-bit field at offset set to v
+	patched := func(size, offset int, v uint32) []byte {
+		b := bytes.Clone(full[:size])
+		binary.LittleEndian.PutUint32(b[offset:], v)
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    error
+		present int // Rows a truncation error reports as recoverable
+	}{
+		{"cut mid row", full[:54+7*stride+5], ErrTruncatedData, 7},
+		{"cut on a row boundary", full[:54+12*stride], ErrTruncatedData, 12},
+		{"cut right after the headers", full[:54], ErrTruncatedData, 0},
+		{"offset into the headers", patched(54+7*stride, 10, 20), ErrCorruptFile, 0},
+		{"file size unlike the pixel array", patched(54+7*stride, 2, 1000), ErrTruncatedData, 7},
+		{"image size unlike the rows", patched(54+7*stride, 34, 100), ErrInvalidImageData, 0},
+		{"two planes", func() []byte {
+			b := bytes.Clone(full[:54+7*stride])
+			binary.LittleEndian.PutUint16(b[26:], 2)
+			return b
+		}(), ErrUnsupportedFormat, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBMP(tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ParseBMP error = %v, want %v", err, tt.want)
+			}
+
+			var truncated *TruncatedError
+			if got := errors.As(err, &truncated); got != (tt.want == ErrTruncatedData) {
+				t.Fatalf("errors.As(%v, *TruncatedError) = %v", err, got)
+			}
+			if tt.want != ErrTruncatedData {
+				if errors.Is(err, ErrTruncatedData) {
+					t.Errorf("header error %v also matches ErrTruncatedData", err)
+				}
+				if _, _, serr := SalvageBMP(tt.data, Pixel{}, ParseOptions{}); !errors.Is(serr, tt.want) {
+					t.Errorf("SalvageBMP error = %v, want %v", serr, tt.want)
+				}
+				return
+			}
+
+			if truncated.Present != tt.present || truncated.Total != 20 {
+				t.Errorf("truncation reports %d of %d rows, want %d of 20", truncated.Present, truncated.Total, tt.present)
+			}
+			image, present, err := SalvageBMP(tt.data, Pixel{}, ParseOptions{})
+			if err != nil {
+				t.Fatalf("SalvageBMP: %v", err)
+			}
+			if present != truncated.Present || len(image.Data) != truncated.Total {
+				t.Errorf("SalvageBMP recovered %d of %d rows, want %d of %d", present, len(image.Data), truncated.Present, truncated.Total)
+			}
+		})
+	}
+}
+
+func TestParseBMPFileSize(t *testing.T) {
+	image := noiseImage(10, 20, 1)
+	full := encodeBMP(t, image)
+	withFileSize := func(b []byte, size uint32) []byte {
+		b = bytes.Clone(b)
+		binary.LittleEndian.PutUint32(b[2:], size)
+		return b
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"zero", withFileSize(full, 0)},
+		{"larger than the file", withFileSize(full, uint32(len(full)+100))},
+		{"rounded down", withFileSize(full, uint32(len(full)/100*100))},
+		{"trailing bytes past it", append(bytes.Clone(full), "trailing bytes"...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBMP(tt.data)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			if x, y, ok := firstDifference(image, got); !ok {
+				t.Errorf("pixel (%d, %d) differs", x, y)
+			}
+			if int(got.Header.FileSize) != len(tt.data) || len(got.Warnings) != 1 || !strings.Contains(got.Warnings[0], "FileSize") {
+				t.Errorf("FileSize %d with warnings %q, want %d and a warning", got.Header.FileSize, got.Warnings, len(tt.data))
+			}
+			if _, err := ParseBMPWith(tt.data, ParseOptions{Strict: true}); !errors.Is(err, ErrCorruptFile) {
+				t.Errorf("strict: %v, want ErrCorruptFile", err)
+			}
+		})
+	}
+
+	if got, err := ParseBMPWith(full, ParseOptions{Strict: true}); err != nil || len(got.Warnings) != 0 {
+		t.Errorf("strict with the right FileSize: %v, warnings %q", err, got.Warnings)
+	}
+	// The pixel array must still fit in the file whatever FileSize says
+	cut := withFileSize(full[:len(full)-1], 0)
+	if _, err := ParseBMP(cut); !errors.Is(err, ErrTruncatedData) {
+		t.Errorf("cut short with FileSize 0: %v, want ErrTruncatedData", err)
+	}
+	if _, err := ParseBMPWith(cut, ParseOptions{Strict: true}); !errors.Is(err, ErrCorruptFile) || errors.Is(err, ErrTruncatedData) {
+		t.Errorf("strict, cut short with FileSize 0: %v, want only ErrCorruptFile", err)
+	}
+}
+
+func TestParseBMPImageSizeZero(t *testing.T) {
+	// 10x20 pixels, rows of 32 bytes, so the pixel array spans 640 bytes from offset 54
+	image := noiseImage(10, 20, 1)
+	zeroed := func(b []byte, trailing int) []byte {
+		b = append(bytes.Clone(b), bytes.Repeat([]byte{0xee}, trailing)...)
+		binary.LittleEndian.PutUint32(b[2:], uint32(len(b)))
+		binary.LittleEndian.PutUint32(b[34:], 0)
+		return b
+	}
+	var bmp32 bytes.Buffer
+	if err := Encode(&bmp32, topDown(image.Clone()), SaveOptions{Format: FormatBMP32}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, b := range map[string][]byte{
+		"24-bit":                     zeroed(encodeBMP(t, image), 0),
+		"24-bit with trailing bytes": zeroed(encodeBMP(t, image), 7),
+		"32-bit bitfields":           zeroed(bmp32.Bytes(), 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseBMP(b)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			if x, y, ok := firstDifference(image, got); !ok {
+				t.Errorf("pixel (%d, %d) differs", x, y)
+			}
+			want := uint32(40 * 20)
+			if got.InfoHeader.BitsPerPixel == 24 {
+				want = 32 * 20
+			}
+			if got.InfoHeader.ImageSize != want || len(got.Warnings) != 1 {
+				t.Errorf("ImageSize %d with warnings %q, want %d and a warning", got.InfoHeader.ImageSize, got.Warnings, want)
+			}
+			if _, err := HashRows(bytes.NewReader(b)); err != nil {
+				t.Errorf("streaming: %v", err)
+			}
+
+			out, err := SerializeBMP(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := binary.LittleEndian.Uint32(out[34:]); size != 32*20 {
+				t.Errorf("SerializeBMP wrote ImageSize %d, want %d", size, 32*20)
+			}
+		})
+	}
+
+	// A file cut short is still a truncation, sized from the dimensions
+	b := zeroed(encodeBMP(t, image), 0)[:54+7*32+5]
+	var truncated *TruncatedError
+	if _, err := ParseBMP(b); !errors.As(err, &truncated) || truncated.Present != 7 {
+		t.Errorf("cut after 7 rows: %v", err)
+	}
+}
+
+// withDIBHeaderSize returns the 24-bit BMP file b with its 40-byte DIB header
+// grown to size bytes, the extra fields filled with junk, and gap more junk
+// bytes before the pixels.
+func withDIBHeaderSize(b []byte, size, gap int) []byte {
+	out := bytes.Clone(b[:54])
+	out = append(out, bytes.Repeat([]byte{0xab}, size-40+gap)...)
+	out = append(out, b[54:]...)
+	binary.LittleEndian.PutUint32(out[2:], uint32(len(out)))
+	binary.LittleEndian.PutUint32(out[10:], uint32(14+size+gap))
+	binary.LittleEndian.PutUint32(out[14:], uint32(size))
+	return out
+}
+
+func TestParseBMPUncommonDIBHeaders(t *testing.T) {
+	image := noiseImage(5, 3, 1)
+	full := encodeBMP(t, image)
+
+	tests := []struct {
+		name      string
+		size, gap int
+		warning   string
+	}{
+		{"v2", 52, 0, "52-byte BITMAPV2INFOHEADER DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset 66"},
+		{"v3", 56, 0, "56-byte BITMAPV3INFOHEADER DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset 70"},
+		{"os2 v2", 64, 0, "64-byte OS/2 BITMAPINFOHEADER2 DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset 78"},
+		{"os2 v2 with a gap", 64, 6, "64-byte OS/2 BITMAPINFOHEADER2 DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset 84"},
+		{"unknown", 48, 0, "unknown 48-byte DIB header: its fields past the first 40 bytes are skipped and the pixels read from offset 62"},
+		{"v4", 108, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBMP(withDIBHeaderSize(full, tt.size, tt.gap))
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			if !gridsEqual(got.Data, image.Data) {
+				t.Error("the pixels differ from the original")
+			}
+			var want []string
+			if tt.warning != "" {
+				want = []string{tt.warning}
+			}
+			if !slices.Equal(got.Warnings, want) {
+				t.Errorf("warnings %q, want %q", got.Warnings, want)
+			}
+		})
+	}
+
+	// OS/2 headers have no bit fields, and a pixel offset inside the header is corrupt
+	os2 := withDIBHeaderSize(encodeBMP(t, withAlpha(noiseImage(5, 3, 1))), 64, 0)
+	binary.LittleEndian.PutUint32(os2[30:], biBitfields)
+	if _, err := ParseBMP(os2); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("OS/2 header with compression 3: error %v, want ErrUnsupportedCompression", err)
+	}
+	inside := withDIBHeaderSize(full, 64, 0)
+	binary.LittleEndian.PutUint32(inside[10:], 54)
+	if _, err := ParseBMP(inside); !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("pixels inside the header: error %v, want ErrCorruptFile", err)
+	}
+}
+
+func TestSerializeBMPInconsistentImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(*BMPImage)
+	}{
+		{"width past the rows", func(b *BMPImage) { b.InfoHeader.Width++ }},
+		{"height past the rows", func(b *BMPImage) { b.InfoHeader.Height = -5 }},
+		{"ragged rows", func(b *BMPImage) { b.Data[2] = b.Data[2][:3] }},
+		{"ragged alpha", func(b *BMPImage) { withAlpha(b).Alpha[1] = nil }},
+		{"short wide pixels", func(b *BMPImage) { b.Widen(); b.Wide = b.Wide[:2] }},
+		{"zero width", func(b *BMPImage) { b.InfoHeader.Width = 0 }},
+		{"pixels inside the headers", func(b *BMPImage) { b.Header.DataOffset = 40 }},
+		{"short DIB header", func(b *BMPImage) { b.InfoHeader.Size = 12 }},
+		{"16-bit pixels", func(b *BMPImage) { b.InfoHeader.BitsPerPixel = 16 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := noiseImage(6, 4, 1)
+			tt.corrupt(image)
+
+			if _, err := SerializeBMP(image); !errors.Is(err, ErrInconsistentImage) {
+				t.Errorf("SerializeBMP error = %v, want ErrInconsistentImage", err)
+			}
+			var buf bytes.Buffer
+			if err := EncodeBMP(&buf, image); !errors.Is(err, ErrInconsistentImage) {
+				t.Errorf("EncodeBMP error = %v, want ErrInconsistentImage", err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("EncodeBMP wrote %d bytes of an inconsistent image", buf.Len())
+			}
+		})
+	}
+}
+
+// palettedBMP returns a bottom-up BMP file of the given dimensions and bits
+// per pixel, 1, 4 or 8, with palette as its color table, declaring colorsUsed
+// colors, whose pixel (x, y) is index(x, y).
+func palettedBMP(width, height, bpp int, palette []Pixel, colorsUsed uint32, index func(x, y int) byte) []byte {
+	stride := rowStride(width, bpp)
+	offset := 54 + 4*len(palette)
+	b := make([]byte, offset+stride*height)
+	copy(b, "BM")
+	binary.LittleEndian.PutUint32(b[2:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[10:], uint32(offset))
+	binary.LittleEndian.PutUint32(b[14:], 40)
+	binary.LittleEndian.PutUint32(b[18:], uint32(width))
+	binary.LittleEndian.PutUint32(b[22:], uint32(height))
+	binary.LittleEndian.PutUint16(b[26:], 1)
+	binary.LittleEndian.PutUint16(b[28:], uint16(bpp))
+	binary.LittleEndian.PutUint32(b[34:], uint32(stride*height))
+	binary.LittleEndian.PutUint32(b[46:], colorsUsed)
+	for i, c := range palette {
+		copy(b[54+4*i:], []byte{c.Blue, c.Green, c.Red, 0})
+	}
+	for y := range height {
+		row := b[offset+(height-1-y)*stride:]
+		for x := range width {
+			bit := x * bpp
+			row[bit/8] |= index(x, y) << (8 - bpp - bit%8)
+		}
+	}
+	return b
+}
+
+func TestParseBMPPalette(t *testing.T) {
+	const width, height = 5, 3
+	small := make([]Pixel, 16)
+	for i := range small {
+		small[i] = Pixel{Blue: byte(i * 16), Green: byte(255 - i), Red: byte(i * 3)}
+	}
+	full := make([]Pixel, 256)
+	for i := range full {
+		full[i] = Pixel{Blue: byte(i), Green: byte(i / 2), Red: byte(255 - i)}
+	}
+
+	tests := []struct {
+		name       string
+		palette    []Pixel
+		colorsUsed uint32
+		index      func(x, y int) byte
+	}{
+		{"16 colors used", small, 16, func(x, y int) byte { return byte((x + y*width) % 16) }},
+		{"colors used 0", full, 0, func(x, y int) byte { return byte(x*50 + y*17) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := palettedBMP(width, height, 8, tt.palette, tt.colorsUsed, tt.index)
+			image, err := ParseBMP(b)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			for y, row := range image.Rows() {
+				for x, p := range row {
+					if want := tt.palette[tt.index(x, y)]; p != want {
+						t.Fatalf("(%d, %d) = %v, want %v", x, y, p, want)
+					}
+				}
+			}
+			if len(image.Warnings) != 0 {
+				t.Errorf("warnings %q", image.Warnings)
+			}
+
+			streamed, err := DecodeSubsampled(bytes.NewReader(b), 1)
+			if err != nil {
+				t.Fatalf("DecodeSubsampled: %v", err)
+			}
+			if !gridsEqual(streamed.Data, image.Data) {
+				t.Error("the streamed pixels differ")
+			}
+
+			// The palette is dropped from the 24-bit output, and the sizes follow
+			out, err := SerializeBMP(image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := ParseBMP(out)
+			if err != nil {
+				t.Fatalf("ParseBMP of the output: %v", err)
+			}
+			h := back.InfoHeader
+			if h.BitsPerPixel != 24 || h.ColorsUsed != 0 || back.Header.DataOffset != 54 ||
+				h.ImageSize != uint32(rowStride(width, 24)*height) || back.Header.FileSize != uint32(len(out)) {
+				t.Errorf("output headers %+v %+v", back.Header, h)
+			}
+			if !gridsEqual(back.Data, image.Data) {
+				t.Error("the output pixels differ")
+			}
+		})
+	}
+}
+
+func TestParseBMPPaletteErrors(t *testing.T) {
+	palette := []Pixel{{Red: 255}, {Green: 255}}
+	outside := palettedBMP(3, 2, 8, palette, 2, func(x, y int) byte { return byte(x + y) })
+	image, err := ParseBMP(outside)
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	if got := image.At(2, 0); got != (Pixel{}) {
+		t.Errorf("index past the palette gives %v, want black", got)
+	}
+	if want := []string{"pixel indices past the 2 colors of the palette are decoded as black"}; !slices.Equal(image.Warnings, want) {
+		t.Errorf("warnings %q, want %q", image.Warnings, want)
+	}
+
+	// A table of more colors than fit before the pixels, or than 8 bits index
+	overlap := bytes.Clone(outside)
+	binary.LittleEndian.PutUint32(overlap[46:], 3)
+	tooMany := palettedBMP(3, 2, 8, make([]Pixel, 257), 257, func(x, y int) byte { return 0 })
+	for name, b := range map[string][]byte{"table overlaps the pixels": overlap, "257 colors": tooMany} {
+		if _, err := ParseBMP(b); !errors.Is(err, ErrCorruptFile) {
+			t.Errorf("%s: error %v, want ErrCorruptFile", name, err)
+		}
+	}
+}
+
+func TestParseBMPPackedPixels(t *testing.T) {
+	mono := []Pixel{{}, {Blue: 255, Green: 255, Red: 255}}
+	sixteen := make([]Pixel, 16)
+	for i := range sixteen {
+		sixteen[i] = Pixel{Blue: byte(i), Green: byte(i * 16), Red: byte(255 - i)}
+	}
+
+	tests := []struct {
+		name       string
+		width, bpp int
+		palette    []Pixel
+		colorsUsed uint32
+	}{
+		// Rows of 2 bytes, the last of them only holding 5 pixels, padded to 4
+		{"1-bit 13 wide", 13, 1, mono, 0},
+		{"1-bit byte wide", 8, 1, mono, 2},
+		// 5 bytes of pixels spill into a second group of 4
+		{"1-bit 33 wide", 33, 1, mono, 0},
+		{"4-bit 13 wide", 13, 4, sixteen, 0},
+		{"4-bit 7 wide, 12 colors", 7, 4, sixteen[:12], 12},
+		{"4-bit 1 wide", 1, 4, sixteen, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const height = 5
+			index := func(x, y int) byte { return byte((x*7 + y*3 + x*y) % len(tt.palette)) }
+			b := palettedBMP(tt.width, height, tt.bpp, tt.palette, tt.colorsUsed, index)
+			if stride := (len(b) - 54 - 4*len(tt.palette)) / height; stride%4 != 0 || stride < (tt.width*tt.bpp+7)/8 {
+				t.Fatalf("fixture stride %d", stride)
+			}
+
+			image, err := ParseBMP(b)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			checkShape(t, image, tt.width, height)
+			for y, row := range image.Rows() {
+				for x, p := range row {
+					if want := tt.palette[index(x, y)]; p != want {
+						t.Fatalf("(%d, %d) = %v, want %v", x, y, p, want)
+					}
+				}
+			}
+
+			for _, factor := range []int{1, 3} {
+				sub, err := DecodeSubsampled(bytes.NewReader(b), factor)
+				if err != nil {
+					t.Fatalf("DecodeSubsampled: %v", err)
+				}
+				for y, row := range sub.Rows() {
+					for x, p := range row {
+						if want := image.At(x*factor, y*factor); p != want {
+							t.Fatalf("factor %d: (%d, %d) = %v, want %v", factor, x, y, p, want)
+						}
+					}
+				}
+			}
+
+			// A file cut one byte short of its second row keeps the first, the bottom one
+			stride := rowStride(tt.width, tt.bpp)
+			cut := b[:len(b)-(height-2)*stride-1]
+			salvaged, present, err := SalvageBMP(cut, Pixel{Red: 1}, ParseOptions{})
+			if err != nil || present != 1 {
+				t.Fatalf("SalvageBMP: %d rows, %v", present, err)
+			}
+			if !gridsEqual(salvaged.Data[height-1:], image.Data[height-1:]) {
+				t.Error("the salvaged bottom row differs")
+			}
+		})
+	}
+}
+
+// stridedBMP returns the 24-bit BMP file of image with its rows stride bytes
+// apart, padded with fill, and ImageSize declaring that stride, as encoders
+// aligning rows to more than 4 bytes write them.
+func stridedBMP(t *testing.T, image *BMPImage, stride int, fill byte) []byte {
+	t.Helper()
+	standard := encodeBMP(t, image)
+	minimal := rowStride(int(image.InfoHeader.Width), 24)
+	height := len(image.Data)
+
+	b := bytes.Clone(standard[:54])
+	for y := range height {
+		row := standard[54+y*minimal : 54+y*minimal+3*int(image.InfoHeader.Width)]
+		b = append(b, row...)
+		b = append(b, bytes.Repeat([]byte{fill}, stride-len(row))...)
+	}
+	binary.LittleEndian.PutUint32(b[2:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[34:], uint32(stride*height))
+	return b
+}
+
+func TestParseBMPDeclaredStride(t *testing.T) {
+	for width := 1; width <= 7; width++ {
+		t.Run(fmt.Sprintf("width_%d", width), func(t *testing.T) {
+			image := noiseImage(width, 3, int64(width))
+			standard := encodeBMP(t, image)
+			padded := stridedBMP(t, image, 16*((3*width+15)/16+1), 0xcc)
+
+			for name, b := range map[string][]byte{"4-byte stride": standard, "16-byte stride": padded} {
+				got, err := ParseBMP(b)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if x, y, same := firstDifference(image, got); !same {
+					t.Errorf("%s: pixel (%d, %d) differs", name, x, y)
+				}
+
+				br, err := NewBMPReader(bytes.NewReader(b))
+				if err != nil {
+					t.Fatalf("%s: NewBMPReader: %v", name, err)
+				}
+				row := make([]Pixel, width)
+				for i := range 3 {
+					if err := br.ReadRow(row); err != nil {
+						t.Fatalf("%s: ReadRow: %v", name, err)
+					}
+					if want := image.Data[2-i]; !slices.Equal(row, want) {
+						t.Errorf("%s: streamed row %d is %v, want %v", name, i, row, want)
+					}
+				}
+			}
+		})
+	}
+
+	image := noiseImage(5, 4, 1)
+	strided := func(imageSize uint32) []byte {
+		b := stridedBMP(t, image, 16, 0)
+		binary.LittleEndian.PutUint32(b[34:], imageSize)
+		return b
+	}
+
+	// An ImageSize rounded up past the last row keeps the 4-byte stride
+	rounded := append(encodeBMP(t, image), make([]byte, 12)...)
+	binary.LittleEndian.PutUint32(rounded[2:], uint32(len(rounded)))
+	binary.LittleEndian.PutUint32(rounded[34:], uint32(16*4+12))
+	if got, err := ParseBMP(rounded); err != nil {
+		t.Errorf("ImageSize rounded up: %v", err)
+	} else if x, y, same := firstDifference(image, got); !same {
+		t.Errorf("ImageSize rounded up: pixel (%d, %d) differs", x, y)
+	}
+
+	// Anything else is rejected rather than read at a guessed stride
+	for name, b := range map[string][]byte{
+		"smaller than the rows":    strided(16*4 - 4),
+		"past the end of the file": strided(16*4 + 4),
+	} {
+		if _, err := ParseBMP(b); !errors.Is(err, ErrInvalidImageData) {
+			t.Errorf("ImageSize %s: %v, want ErrInvalidImageData", name, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// The headers of a BMP file declare its sizes in uint32 and its dimensions
+// in int32 fields, while the decoder indexes the file with ints, which are
+// only 32 bits wide on 32-bit platforms. A product such as the stride times
+// the height could wrap around there and give a wrong offset instead of an
+// error, so sizes are computed in int64 and checked against the platform
+// before they are used as ints.
+
+// maxFileSize is the size of the largest BMP file that can be decoded and
+// encoded: the largest FileSize, or the largest int on 32-bit platforms, for
+// the file to be indexed with ints.
+const maxFileSize = min(math.MaxUint32, math.MaxInt)
+
+// stride64 returns the number of bytes a row of the given width and bit
+// depth occupies when rows are padded to a multiple of align bytes, as
+// alignedStride does but in int64, which can't overflow for any width and
+// bit depth the headers can declare. A row of pixels smaller than a byte
+// takes up its last byte whole before the padding.
+func stride64(width, bitsPerPixel, align int) int64 {
+	a := int64(align)
+	return ((int64(width)*int64(bitsPerPixel)+7)/8 + a - 1) / a * a
+}
+
+// checkBounds returns an error wrapping ErrCorruptFile unless the pixel
+// array the headers of bmp declare, at the declared or the minimal size,
+// ends within limit bytes of the start of the file. limit is maxFileSize,
+// except in tests that check the limits of 32-bit platforms on 64-bit ones.
+// The stride, the offset of every pixel and the end of the array then fit
+// in an int. The dimensions must be positive and the bit depth supported.
+func checkBounds(bmp *BMPImage, limit int64) error {
+	offset := int64(bmp.Header.DataOffset)
+	if offset > limit {
+		return fmt.Errorf("%w: pixel data offset %d is past the largest file of %d bytes", ErrCorruptFile, offset, limit)
+	}
+	if size := int64(bmp.InfoHeader.ImageSize); size > limit-offset {
+		return fmt.Errorf("%w: the %d-byte pixel array at offset %d ends past the largest file of %d bytes", ErrCorruptFile, size, offset, limit)
+	}
+
+	width, height := int64(bmp.InfoHeader.Width), int64(bmp.InfoHeader.Height)
+	height = max(height, -height)
+	// Dividing rather than multiplying the stride by the height can't overflow
+	stride := stride64(int(width), int(bmp.InfoHeader.BitsPerPixel), 4)
+	if stride > limit-offset || height > (limit-offset)/stride {
+		return fmt.Errorf("%w: %dx%d pixels of %d bits at offset %d end past the largest file of %d bytes", ErrCorruptFile, width, height, bmp.InfoHeader.BitsPerPixel, offset, limit)
+	}
+	return nil
+}
+
+// checkFileSize returns an error wrapping ErrTooLarge if a BMP file of size
+// bytes can't be written, its FileSize field being too small to hold it.
+func checkFileSize(size int64) error {
+	if size > maxFileSize {
+		return fmt.Errorf("%w: the %d-byte BMP file would be over the largest of %d bytes", ErrTooLarge, size, int64(maxFileSize))
+	}
+	return nil
+}
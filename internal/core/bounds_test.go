@@ -0,0 +1,130 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// boundsHeaders returns the headers of a 32-bit BMP of the given dimensions
+// with its pixels at offset 54 and ImageSize left at 0.
+func boundsHeaders(width, height int32, offset uint32) *BMPImage {
+	return &BMPImage{
+		Header:     BMPHeader{Signature: [2]byte{'B', 'M'}, DataOffset: offset},
+		InfoHeader: DIBHeader{Size: 40, Width: width, Height: height, Planes: 1, BitsPerPixel: 32},
+	}
+}
+
+func TestCheckBounds32Bit(t *testing.T) {
+	const limit = math.MaxInt32
+	// Rows of 4 KiB: the largest height whose pixel array ends by the limit
+	rows := int32((limit - 54) / 4096)
+
+	tests := []struct {
+		name  string
+		image *BMPImage
+		ok    bool
+	}{
+		{"last row fits", boundsHeaders(1024, rows, 54), true},
+		{"one row past", boundsHeaders(1024, rows+1, 54), false},
+		{"top-down one row past", boundsHeaders(1024, -rows-1, 54), false},
+		{"widest row", boundsHeaders(math.MaxInt32, 1, 54), false},
+		{"tallest image", boundsHeaders(1, math.MaxInt32, 54), false},
+		{"most negative height", boundsHeaders(1, math.MinInt32, 54), false},
+		{"offset at the limit", boundsHeaders(1, 1, limit), false},
+		{"offset past 32 bits", boundsHeaders(1, 1, math.MaxUint32), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBounds(tt.image, limit)
+			if tt.ok && err != nil {
+				t.Errorf("checkBounds: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrCorruptFile) {
+				t.Errorf("checkBounds: error %v, want ErrCorruptFile", err)
+			}
+		})
+	}
+
+	image := boundsHeaders(1, 1, 54)
+	image.InfoHeader.ImageSize = limit - 53
+	if err := checkBounds(image, limit); !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("ImageSize past the limit: error %v, want ErrCorruptFile", err)
+	}
+}
+
+func TestStride64(t *testing.T) {
+	tests := []struct {
+		width, bpp, align int
+		want              int64
+	}{
+		{1, 24, 4, 4},
+		{5, 24, 1, 15},
+		{math.MaxInt32, 32, 4, 4 * math.MaxInt32},
+		{math.MaxInt32, 24, 4, (3*math.MaxInt32 + 3) &^ 3},
+	}
+	for _, tt := range tests {
+		if got := stride64(tt.width, tt.bpp, tt.align); got != tt.want {
+			t.Errorf("stride64(%d, %d, %d) = %d, want %d", tt.width, tt.bpp, tt.align, got, tt.want)
+		}
+	}
+}
+
+func TestParseBMPRejectsOverflowingHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int32
+		imageSize     uint32
+	}{
+		{"widest and tallest", math.MaxInt32, math.MinInt32, 0},
+		{"stride times height past 32 bits", 65536, 65536, 0},
+		{"image size past 32 bits", 1, 1, math.MaxUint32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeBMP(t, noiseImage(1, 1, 1))
+			binary.LittleEndian.PutUint32(data[18:], uint32(tt.width))
+			binary.LittleEndian.PutUint32(data[22:], uint32(tt.height))
+			binary.LittleEndian.PutUint32(data[34:], tt.imageSize)
+			if _, err := ParseBMP(data); !errors.Is(err, ErrCorruptFile) {
+				t.Errorf("ParseBMP: error %v, want ErrCorruptFile", err)
+			}
+			if _, _, err := SalvageBMP(data, Pixel{}, ParseOptions{}); !errors.Is(err, ErrCorruptFile) {
+				t.Errorf("SalvageBMP: error %v, want ErrCorruptFile", err)
+			}
+		})
+	}
+}
+
+func TestEncodeRejectsFilesPastFileSize(t *testing.T) {
+	// Only the headers are looked at, so the image needs no pixels
+	image := boundsHeaders(40000, 40000, 54)
+	image.InfoHeader.BitsPerPixel = 24
+
+	want := 54 + int64(40000*3)*40000
+	if got := EncodedSize(image, SaveOptions{Format: FormatBMP24}); got != want {
+		t.Errorf("EncodedSize = %d, want %d", got, want)
+	}
+	for _, format := range []string{FormatBMP24, FormatBMP32} {
+		if err := Encode(nil, image, SaveOptions{Format: format}); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: Encode error %v, want ErrTooLarge", format, err)
+		}
+	}
+	if _, err := NewBMPWriter(nil, image); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("NewBMPWriter: error %v, want ErrTooLarge", err)
+	}
+}
+
+func TestCropValidateDoesNotOverflow(t *testing.T) {
+	for _, c := range []CropInfo{
+		{OffsetX: 1, Width: math.MaxInt, Height: 1},
+		{OffsetY: 1, Width: 1, Height: math.MaxInt},
+		{OffsetY: 1, Height: math.MaxInt, Range: "rows"},
+		{OffsetX: 1, Width: math.MaxInt, Range: "cols"},
+	} {
+		if err := c.Validate(10, 10); !errors.Is(err, ErrOutOfBounds) {
+			t.Errorf("Validate(%+v): error %v, want ErrOutOfBounds", c, err)
+		}
+	}
+}
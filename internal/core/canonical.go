@@ -0,0 +1,25 @@
+package core
+
+// Canonicalize returns image in the canonical form of 24-bit BMP output, in
+// which two images with the same pixels and resolution are encoded to the
+// same bytes: bottom-up rows, a plain 40-byte DIB header right after the
+// file header, computed ImageSize and FileSize, a zero Reserved field and
+// no color space information or comments. Only the resolution of the headers is kept.
+// A widened image is narrowed to 8 bits. The pixels are shared with image.
+func Canonicalize(image *BMPImage) *BMPImage {
+	image = image.narrowed()
+	c := &BMPImage{Data: image.Data, Alpha: image.Alpha}
+
+	c.Header = BMPHeader{Signature: [2]byte{'B', 'M'}, DataOffset: 54}
+	c.InfoHeader = DIBHeader{
+		Size:            40,
+		Width:           image.InfoHeader.Width,
+		Height:          int32(len(c.Data)),
+		Planes:          1,
+		BitsPerPixel:    24,
+		XPixelsPerMeter: image.InfoHeader.XPixelsPerMeter,
+		YPixelsPerMeter: image.InfoHeader.YPixelsPerMeter,
+	}
+	c.updateSizes()
+	return c
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// canonicalBytes parses the BMP file b and encodes it in canonical form.
+func canonicalBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	image, err := ParseBMP(b)
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, image, SaveOptions{Format: FormatBMP24, Canonical: true}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCanonicalizeIsByteIdentical(t *testing.T) {
+	bottomUp := noiseImage(7, 5, 1)
+	bottomUp.InfoHeader.XPixelsPerMeter, bottomUp.InfoHeader.YPixelsPerMeter = 2835, 2835
+	// The same pixels, stored from the top row down
+	top := topDown(bottomUp.Clone())
+	if top.At(3, 0) != bottomUp.At(3, 0) {
+		t.Fatal("the fixtures don't hold the same pixels")
+	}
+
+	want := canonicalBytes(t, encodeBMP(t, bottomUp))
+	stale := encodeBMP(t, top)
+	binary.LittleEndian.PutUint32(stale[6:], 0x12345678) // Reserved
+	binary.LittleEndian.PutUint32(stale[50:], 3)         // ColorsImportant
+	inputs := map[string][]byte{
+		"top-down":       encodeBMP(t, top),
+		"stale fields":   stale,
+		"gap":            withDIBHeaderSize(encodeBMP(t, top), 40, 6),
+		"v5 and profile": v5File(t, top, []byte("ICC profile data")),
+	}
+	for name, b := range inputs {
+		if got := canonicalBytes(t, b); !bytes.Equal(got, want) {
+			t.Errorf("%s: canonical form differs from the bottom-up one", name)
+		}
+	}
+
+	if len(want) != 54+int(pixelArraySize(7, 5, 24)) || binary.LittleEndian.Uint32(want[10:]) != 54 || int32(binary.LittleEndian.Uint32(want[22:])) != 5 {
+		t.Errorf("canonical headers: offset %d, height %d, size %d", binary.LittleEndian.Uint32(want[10:]), int32(binary.LittleEndian.Uint32(want[22:])), len(want))
+	}
+	if got := binary.LittleEndian.Uint32(want[38:]); got != 2835 {
+		t.Errorf("resolution %d, want 2835 kept", got)
+	}
+	if size := EncodedSize(top, SaveOptions{Format: FormatBMP24, Canonical: true}); size != int64(len(want)) {
+		t.Errorf("EncodedSize = %d, want %d", size, len(want))
+	}
+}
+
+func TestCanonicalRejectsOtherOutput(t *testing.T) {
+	image := noiseImage(3, 3, 1)
+	for _, opts := range []SaveOptions{
+		{Format: FormatPNG, Canonical: true},
+		{Format: FormatBMP24, Align: 8, Canonical: true},
+		{Format: FormatBMP24, ColorProfile: ColorProfileSRGB, Canonical: true},
+		{Format: FormatBMP24, Stamp: &Stamp{}, Canonical: true},
+	} {
+		if err := Encode(&bytes.Buffer{}, image, opts); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("%+v: %v, want an ErrInvalidParameter", opts, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"--canonical", "--format=png", "in.bmp", "out.png"},
+		{"--canonical", "--stamp", "in.bmp", "out.bmp"},
+		{"--canonical", "--tiled", "--filter=blur", "in.bmp", "out.bmp"},
+	} {
+		if _, _, _, err := ParseTransformations(args); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("%v: %v, want an ErrInvalidParameter", args, err)
+		}
+	}
+}
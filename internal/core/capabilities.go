@@ -0,0 +1,116 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Types of filter parameters.
+const (
+	ParamInt    = "int"
+	ParamFloat  = "float"
+	ParamEnum   = "enum"   // One of Values
+	ParamPoints = "points" // Curve points, <in>/<out>,...
+)
+
+// ParamSchema describes a parameter of a filter.
+type ParamSchema struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Min          *float64 `json:"min,omitempty"`
+	Max          *float64 `json:"max,omitempty"`
+	MinExclusive bool     `json:"minExclusive,omitempty"` // Min itself is out of range
+	MaxExclusive bool     `json:"maxExclusive,omitempty"` // Max itself is out of range
+	Values       []string `json:"values,omitempty"`
+	Default      string   `json:"default,omitempty"`
+	Optional     bool     `json:"optional"`
+	Summary      string   `json:"summary,omitempty"` // Constraints the other fields can't express
+}
+
+// bound returns a pointer to v, for the bounds of a ParamSchema.
+func bound(v float64) *float64 { return &v }
+
+// FilterCapability describes a filter and its parameters, in order.
+type FilterCapability struct {
+	Name   string        `json:"name"`
+	Params []ParamSchema `json:"params"`
+}
+
+// Limits are the limits on the images apply reads and writes.
+type Limits struct {
+	MaxDimension     int   `json:"maxDimension"`     // Widest and tallest image a BMP header can describe
+	MaxPixels        int64 `json:"maxPixels"`        // Images over this are refused without --allow-huge; 0 means no limit
+	DefaultMaxMemory int64 `json:"defaultMaxMemory"` // Memory budget without --max-memory; 0 means no limit
+}
+
+// Capabilities describes what this build of the tool supports, for tools
+// that build pipelines to check before running one.
+type Capabilities struct {
+	Version       string             `json:"version"`
+	InputFormats  []string           `json:"inputFormats"`
+	OutputFormats []string           `json:"outputFormats"`
+	BMPBitDepths  []int              `json:"bmpBitDepths"` // Bits per pixel of the BMP input decoded
+	Precisions    []int              `json:"precisions"`   // Bits per channel filters work at, see --precision
+	Transforms    []string           `json:"transforms"`
+	Filters       []FilterCapability `json:"filters"`
+	FilterSuffix  []ParamSchema      `json:"filterSuffix"` // Parameters any filter takes last, as name=value
+	Limits        Limits             `json:"limits"`
+}
+
+// GetCapabilities returns the capabilities of the tool, taken from the
+// tables the parsers use, so that they can't go stale.
+func GetCapabilities() Capabilities {
+	c := Capabilities{
+		Version:       Version,
+		InputFormats:  InputFormats,
+		OutputFormats: OutputFormats,
+		BMPBitDepths:  BMPBitDepths,
+		Precisions:    []int{8, 16},
+		Transforms:    TransformNames(),
+		FilterSuffix:  []ParamSchema{opacityParam},
+		Limits:        Limits{MaxDimension: math.MaxInt32, MaxPixels: DefaultMaxPixels},
+	}
+	for _, name := range FilterNames {
+		c.Filters = append(c.Filters, FilterCapability{Name: name, Params: filterParams[name]})
+	}
+	for _, name := range registeredFilterNames() {
+		f, _ := lookupFilter(name)
+		c.Filters = append(c.Filters, FilterCapability{Name: name, Params: slices.Clone(f.params)})
+	}
+	return c
+}
+
+// WriteCapabilities writes the capabilities of the tool to w, as indented
+// JSON if asJSON is set and as a summary otherwise.
+func WriteCapabilities(w io.Writer, asJSON bool) error {
+	c := GetCapabilities()
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+
+	fmt.Fprintf(w, "Version: %s\n", c.Version)
+	fmt.Fprintf(w, "Input formats: %s\n", strings.Join(c.InputFormats, ", "))
+	fmt.Fprintf(w, "Output formats: %s\n", strings.Join(c.OutputFormats, ", "))
+	fmt.Fprintf(w, "BMP bit depths: %s\n", strings.Trim(fmt.Sprint(c.BMPBitDepths), "[]"))
+	fmt.Fprintf(w, "Transforms: %s\n", strings.Join(c.Transforms, ", "))
+	fmt.Fprintln(w, "Filters:")
+	for _, f := range c.Filters {
+		var params []string
+		for _, p := range f.Params {
+			if p.Optional {
+				params = append(params, "[:"+p.Name+"]")
+			} else {
+				params = append(params, ":"+p.Name)
+			}
+		}
+		fmt.Fprintf(w, "  %s%s\n", f.Name, strings.Join(params, ""))
+	}
+	_, err := fmt.Fprintf(w, "Max pixels: %d\n", c.Limits.MaxPixels)
+	return err
+}
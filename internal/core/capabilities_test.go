@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCapabilitiesListParserFilters(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCapabilities(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	var c Capabilities
+	if err := json.Unmarshal(buf.Bytes(), &c); err != nil {
+		t.Fatalf("capabilities aren't valid JSON: %v", err)
+	}
+
+	for _, name := range FilterNames {
+		i := slices.IndexFunc(c.Filters, func(f FilterCapability) bool { return f.Name == name })
+		if i < 0 {
+			t.Errorf("filter %s is missing", name)
+			continue
+		}
+		params := c.Filters[i].Params
+		t.Run(name, func(t *testing.T) {
+			args := make([]string, len(params))
+			for j, p := range params {
+				if p.Type != ParamInt && p.Type != ParamFloat && p.Type != ParamEnum && p.Type != ParamPoints {
+					t.Fatalf("parameter %s has unknown type %q", p.Name, p.Type)
+				}
+				if p.Type == ParamEnum && len(p.Values) == 0 {
+					t.Fatalf("enum parameter %s has no values", p.Name)
+				}
+				args[j] = exampleArg(p)
+			}
+			value := strings.Join(append([]string{name}, args...), ":")
+			if _, err := parseFilterOptions(value); err != nil {
+				t.Fatalf("%s rejected: %v", value, err)
+			}
+			if _, err := parseFilterOptions(value + ":opacity=50"); err != nil {
+				t.Errorf("%s:opacity=50 rejected: %v", value, err)
+			}
+
+			// Defaults are in range, and just outside each bound is rejected
+			for j, p := range params {
+				if p.Default != "" {
+					good := slices.Clone(args)
+					good[j] = p.Default
+					if _, err := parseFilterOptions(strings.Join(append([]string{name}, good...), ":")); err != nil {
+						t.Errorf("default %s of %s rejected: %v", p.Default, p.Name, err)
+					}
+				}
+				var outside []float64
+				if p.Min != nil {
+					outside = append(outside, *p.Min-1)
+					if p.MinExclusive {
+						outside = append(outside, *p.Min)
+					}
+				}
+				if p.Max != nil {
+					outside = append(outside, *p.Max+1)
+					if p.MaxExclusive {
+						outside = append(outside, *p.Max)
+					}
+				}
+				for _, v := range outside {
+					bad := slices.Clone(args)
+					bad[j] = strconv.FormatFloat(v, 'g', -1, 64)
+					value := strings.Join(append([]string{name}, bad...), ":")
+					if _, err := parseFilterOptions(value); err == nil {
+						t.Errorf("%s accepted, %s is out of range", value, p.Name)
+					}
+				}
+			}
+		})
+	}
+
+	for _, p := range c.FilterSuffix {
+		if _, err := parseFilterOptions("grayscale:" + p.Name + "=" + p.Default); err != nil {
+			t.Errorf("suffix %s=%s rejected: %v", p.Name, p.Default, err)
+		}
+	}
+}
+
+func TestCapabilitiesListFormats(t *testing.T) {
+	c := GetCapabilities()
+	for _, format := range c.OutputFormats {
+		if _, err := parseFormat(format); err != nil {
+			t.Errorf("output format %s rejected: %v", format, err)
+		}
+	}
+	if len(c.Transforms) != int(numTransformTypes) || slices.Contains(c.Transforms, "unknown") {
+		t.Errorf("transforms %v don't name every transformation type", c.Transforms)
+	}
+}
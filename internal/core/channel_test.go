@@ -0,0 +1,48 @@
+package core
+
+import "testing"
+
+func TestChannelModes(t *testing.T) {
+	// Its luminance is 0.2126*200 + 0.7152*100 + 0.0722*50 = 117.65, so 118
+	p := Pixel{Red: 200, Green: 100, Blue: 50}
+	tests := []struct {
+		filter string
+		want   Pixel
+	}{
+		{"red", Pixel{Red: 200}},
+		{"green", Pixel{Green: 100}},
+		{"blue", Pixel{Blue: 50}},
+		{"red:luma", Pixel{Red: 200, Green: 200, Blue: 200}},
+		{"green:luma", Pixel{Red: 100, Green: 100, Blue: 100}},
+		{"blue:luma", Pixel{Red: 50, Green: 50, Blue: 50}},
+		// The lightness 118/255 at full saturation has a chroma of
+		// 1 - |2*118/255 - 1| = 236/255, and nothing added to the other channels
+		{"red:tint", Pixel{Red: 236}},
+		{"green:tint", Pixel{Green: 236}},
+		{"blue:tint", Pixel{Blue: 236}},
+	}
+	for _, tt := range tests {
+		opts, err := parseFilterOptions(tt.filter)
+		if err != nil {
+			t.Fatalf("%s rejected: %v", tt.filter, err)
+		}
+		image := NewImage(1, 1)
+		image.Data[0][0] = p
+		if err := Filter(image, opts); err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+		if got := image.Data[0][0]; got != tt.want {
+			t.Errorf("%s turns %v into %v, want %v", tt.filter, p, got, tt.want)
+		}
+	}
+
+	// Black and white keep their lightness whatever the hue
+	opts, _ := parseFilterOptions("green:tint")
+	image := grayRow(0, 255)
+	if err := Filter(image, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := grayValues(image); got[0] != 0 || got[1] != 255 || image.Data[0][1] != (Pixel{Red: 255, Green: 255, Blue: 255}) {
+		t.Errorf("green:tint turns black and white into %v", image.Data[0])
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Clipboard is the part of a system clipboard that holds bitmaps. Images
+// are exchanged as packed DIBs, the CF_DIB format of Windows: a BMP file
+// without its 14-byte file header, the pixels right after the DIB header
+// and its color masks and table.
+type Clipboard interface {
+	ReadDIB() ([]byte, error)
+	WriteDIB(dib []byte) error
+}
+
+// SystemClipboard is the clipboard of the OS. It is only implemented on
+// Windows; elsewhere both of its methods fail with an ErrUnsupported.
+var SystemClipboard Clipboard = systemClipboard{}
+
+// biAlphaBitfields is the compression method of BI_BITFIELDS images whose
+// masks after a 40-byte DIB header include an alpha mask.
+const biAlphaBitfields = 6
+
+// ParseClipboardArgs parses the clipboard command arguments: paste or copy
+// and the file to write the clipboard image to or read it from.
+func ParseClipboardArgs(args []string) (string, string, error) {
+	if len(args) != 2 || args[0] != "paste" && args[0] != "copy" {
+		return "", "", ErrIncorrectArgument
+	}
+	return args[0], args[1], nil
+}
+
+// dibTableSize returns the number of bytes of color masks and color table
+// that follow a DIB header in b, a packed DIB, before the pixels.
+func dibTableSize(b []byte) (int, error) {
+	if len(b) < 40 {
+		return 0, ErrInvalidBMP
+	}
+	size := binary.LittleEndian.Uint32(b[0:4])
+	if size < 40 {
+		return 0, ErrInvalidHeaderSize
+	}
+	if uint64(size) > uint64(len(b)) {
+		return 0, ErrCorruptFile
+	}
+
+	bpp := binary.LittleEndian.Uint16(b[14:16])
+	compression := binary.LittleEndian.Uint32(b[16:20])
+	colors := uint64(binary.LittleEndian.Uint32(b[32:36]))
+
+	var table uint64
+	// The larger headers hold the masks themselves
+	if size == 40 && compression == biBitfields {
+		table = 12
+	}
+	if size == 40 && compression == biAlphaBitfields {
+		table = 16
+	}
+	if colors == 0 && bpp <= 8 {
+		colors = 1 << bpp
+	}
+	table += 4 * colors
+	if uint64(size)+table > uint64(len(b)) {
+		return 0, ErrCorruptFile
+	}
+	return int(table), nil
+}
+
+// DIBToBMP returns the BMP file of dib, a packed DIB as found on the
+// clipboard, by putting a file header in front of it. The pixels are taken to
+// start right after the color table, and every byte of dib is kept, so that
+// BMPToDIB gives dib back.
+func DIBToBMP(dib []byte) ([]byte, error) {
+	table, err := dibTableSize(dib)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFileSize(14 + int64(len(dib))); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 14+len(dib))
+	copy(b, "BM")
+	binary.LittleEndian.PutUint32(b[2:6], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[10:14], 14+binary.LittleEndian.Uint32(dib[0:4])+uint32(table))
+	copy(b[14:], dib)
+	return b, nil
+}
+
+// BMPToDIB returns the packed DIB of the BMP file b, to put on the
+// clipboard: its DIB header, color masks and color table, followed straight
+// by the pixel array, wherever in the file that starts. Anything after the
+// pixels, such as comments, is left out.
+func BMPToDIB(b []byte) ([]byte, error) {
+	bmp, err := parseHeaders(b)
+	if err != nil {
+		return nil, err
+	}
+	table, err := dibTableSize(b[14:])
+	if err != nil {
+		return nil, err
+	}
+	headers := 14 + int64(bmp.InfoHeader.Size) + int64(table)
+
+	// Compressed pixels only have the size their header gives
+	pixels := int64(bmp.InfoHeader.ImageSize)
+	if bmp.InfoHeader.Compression == 0 || bmp.InfoHeader.Compression == biBitfields || bmp.InfoHeader.Compression == biAlphaBitfields {
+		height := int64(bmp.InfoHeader.Height)
+		pixels = stride64(int(bmp.InfoHeader.Width), int(bmp.InfoHeader.BitsPerPixel), 4) * max(height, -height)
+	}
+	offset := int64(bmp.Header.DataOffset)
+	if offset < headers || offset+pixels > int64(len(b)) {
+		return nil, ErrCorruptFile
+	}
+
+	dib := make([]byte, 0, headers-14+pixels)
+	dib = append(dib, b[14:headers]...)
+	return append(dib, b[offset:offset+pixels]...), nil
+}
+
+// PasteClipboard saves the image on the clipboard to path as a BMP file, as
+// it is but for the file header put in front of it. The image must be one
+// ParseBMP decodes.
+func PasteClipboard(c Clipboard, path string) error {
+	dib, err := c.ReadDIB()
+	if err != nil {
+		return err
+	}
+	b, err := DIBToBMP(dib)
+	if err != nil {
+		return fmt.Errorf("clipboard image: %w", err)
+	}
+	if _, err := ParseBMP(b); err != nil {
+		return fmt.Errorf("clipboard image: %w", err)
+	}
+
+	f, err := createAtomic(path)
+	if err != nil {
+		return ioError(err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Abort()
+		return ioError(err)
+	}
+	return ioError(f.Commit())
+}
+
+// CopyClipboard puts the image at path, in any format LoadImage reads, on
+// the clipboard as a 24-bit DIB in canonical form. Transparency is dropped.
+func CopyClipboard(c Clipboard, path string) error {
+	image, err := LoadImage(path)
+	if err != nil {
+		return err
+	}
+	b, err := SerializeBMP(Canonicalize(image))
+	if err != nil {
+		return err
+	}
+	dib, err := BMPToDIB(b)
+	if err != nil {
+		return err
+	}
+	return c.WriteDIB(dib)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package core
+
+import "errors"
+
+// errNoClipboard is the error of every method of SystemClipboard.
+var errNoClipboard = withKind(ErrUnsupported, errors.New("the clipboard is unsupported on this OS; it is only available on Windows"))
+
+// systemClipboard reports that the clipboard isn't supported.
+type systemClipboard struct{}
+
+func (systemClipboard) ReadDIB() ([]byte, error) { return nil, errNoClipboard }
+func (systemClipboard) WriteDIB([]byte) error    { return errNoClipboard }
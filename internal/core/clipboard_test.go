@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeClipboard holds a DIB in memory in place of the system clipboard.
+type fakeClipboard struct {
+	dib []byte
+}
+
+func (c *fakeClipboard) ReadDIB() ([]byte, error) {
+	if c.dib == nil {
+		return nil, errors.New("empty clipboard")
+	}
+	return c.dib, nil
+}
+
+func (c *fakeClipboard) WriteDIB(dib []byte) error {
+	c.dib = dib
+	return nil
+}
+
+// The CF_DIB fixtures are 3x2 images in the layouts Windows puts on the
+// clipboard, whose pixel (x, y) is clipboardPixel(x, y).
+var clipboardFixtures = []struct {
+	name       string
+	dataOffset uint32
+}{
+	{"bitfields32.dib", 14 + 40 + 12}, // Color masks after the header
+	{"rgb24-topdown.dib", 14 + 40},
+	{"v5-bgra.dib", 14 + 124},
+}
+
+func clipboardPixel(x, y int) Pixel {
+	return Pixel{Blue: byte(10*x + 1), Green: byte(100 + y), Red: 200}
+}
+
+func TestDIBToBMPRoundTrip(t *testing.T) {
+	for _, f := range clipboardFixtures {
+		t.Run(f.name, func(t *testing.T) {
+			dib, err := os.ReadFile(filepath.Join("testdata", "clipboard", f.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := DIBToBMP(dib)
+			if err != nil {
+				t.Fatalf("DIBToBMP: %v", err)
+			}
+			image, err := ParseBMP(b)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			if image.Header.DataOffset != f.dataOffset {
+				t.Errorf("DataOffset = %d, want %d", image.Header.DataOffset, f.dataOffset)
+			}
+			for y, row := range image.Rows() {
+				for x, p := range row {
+					if want := clipboardPixel(x, y); p != want {
+						t.Fatalf("(%d, %d) = %v, want %v", x, y, p, want)
+					}
+				}
+			}
+
+			back, err := BMPToDIB(b)
+			if err != nil {
+				t.Fatalf("BMPToDIB: %v", err)
+			}
+			if !bytes.Equal(back, dib) {
+				t.Errorf("BMPToDIB gives %x, want the fixture %x", back, dib)
+			}
+		})
+	}
+}
+
+func TestBMPToDIBPacksPixels(t *testing.T) {
+	// The pixels of the fixture start 8 bytes past the header
+	b, err := os.ReadFile(filepath.Join("testdata", "differential", "gap-before-pixels.bmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseBMP(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Whatever follows the pixels is left out too
+	b = append(b, "trailing bytes"...)
+
+	dib, err := BMPToDIB(b)
+	if err != nil {
+		t.Fatalf("BMPToDIB: %v", err)
+	}
+	if wantSize := int(want.InfoHeader.Size) + int(want.InfoHeader.ImageSize); len(dib) != wantSize {
+		t.Errorf("DIB of %d bytes, want %d", len(dib), wantSize)
+	}
+	b, err = DIBToBMP(dib)
+	if err != nil {
+		t.Fatalf("DIBToBMP: %v", err)
+	}
+	got, err := ParseBMP(b)
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	if x, y, ok := firstDifference(want, got); !ok {
+		t.Errorf("pixel (%d, %d) differs after a round trip", x, y)
+	}
+}
+
+func TestDIBToBMPRejectsMalformed(t *testing.T) {
+	dib, err := os.ReadFile(filepath.Join("testdata", "clipboard", "rgb24-topdown.dib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := append([]byte(nil), dib...)
+	short[0] = 12 // An OS/2 core header
+	palette := append([]byte(nil), dib...)
+	palette[14] = 8 // 8 bits per pixel with a 1 KiB color table that isn't there
+
+	for name, b := range map[string][]byte{"empty": nil, "truncated header": dib[:30], "core header": short, "missing palette": palette} {
+		if _, err := DIBToBMP(b); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestPasteAndCopyClipboard(t *testing.T) {
+	dib, err := os.ReadFile(filepath.Join("testdata", "clipboard", "bitfields32.dib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pasted.bmp")
+
+	c := &fakeClipboard{dib: dib}
+	if err := PasteClipboard(c, path); err != nil {
+		t.Fatalf("PasteClipboard: %v", err)
+	}
+	pasted, err := LoadBMP(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pasted.At(2, 1); got != clipboardPixel(2, 1) {
+		t.Errorf("pasted (2, 1) = %v, want %v", got, clipboardPixel(2, 1))
+	}
+
+	if err := CopyClipboard(c, path); err != nil {
+		t.Fatalf("CopyClipboard: %v", err)
+	}
+	if bpp := c.dib[14]; bpp != 24 {
+		t.Errorf("copied %d-bit DIB, want 24-bit", bpp)
+	}
+	b, err := DIBToBMP(c.dib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := ParseBMP(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, ok := firstDifference(pasted, copied); !ok {
+		t.Errorf("pixel (%d, %d) differs after copying", x, y)
+	}
+
+	if err := PasteClipboard(&fakeClipboard{dib: []byte("not a bitmap")}, filepath.Join(dir, "bad.bmp")); err == nil {
+		t.Error("pasted a clipboard without a bitmap")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.bmp")); !os.IsNotExist(err) {
+		t.Errorf("failed paste left a file: %v", err)
+	}
+}
+
+func TestSystemClipboardUnsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the clipboard is supported")
+	}
+	if _, err := SystemClipboard.ReadDIB(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ReadDIB: %v, want ErrUnsupported", err)
+	}
+	if err := SystemClipboard.WriteDIB(nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("WriteDIB: %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,108 @@
+//go:build windows
+
+package core
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	user32   = syscall.NewLazyDLL("user32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procOpenClipboard    = user32.NewProc("OpenClipboard")
+	procCloseClipboard   = user32.NewProc("CloseClipboard")
+	procEmptyClipboard   = user32.NewProc("EmptyClipboard")
+	procGetClipboardData = user32.NewProc("GetClipboardData")
+	procSetClipboardData = user32.NewProc("SetClipboardData")
+	procGlobalAlloc      = kernel32.NewProc("GlobalAlloc")
+	procGlobalFree       = kernel32.NewProc("GlobalFree")
+	procGlobalLock       = kernel32.NewProc("GlobalLock")
+	procGlobalUnlock     = kernel32.NewProc("GlobalUnlock")
+	procGlobalSize       = kernel32.NewProc("GlobalSize")
+)
+
+const (
+	cfDIB        = 8      // Clipboard format of packed DIBs
+	gmemMoveable = 0x0002 // The allocation flag SetClipboardData requires
+)
+
+// systemClipboard is the Windows clipboard, accessed through user32.
+type systemClipboard struct{}
+
+// openClipboard opens the clipboard, retrying for a moment since another
+// program may be holding it.
+func openClipboard() error {
+	var err error
+	for range 10 {
+		r, _, e := procOpenClipboard.Call(0)
+		if r != 0 {
+			return nil
+		}
+		err = e
+		time.Sleep(20 * time.Millisecond)
+	}
+	return os.NewSyscallError("OpenClipboard", err)
+}
+
+// globalBytes returns the memory of the locked global memory object at p,
+// of size bytes.
+func globalBytes(p, size uintptr) []byte {
+	// Converting the address through a pointer to it keeps go vet from
+	// flagging a uintptr turned into an unsafe.Pointer
+	return unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&p))), size)
+}
+
+func (systemClipboard) ReadDIB() ([]byte, error) {
+	if err := openClipboard(); err != nil {
+		return nil, err
+	}
+	defer procCloseClipboard.Call()
+
+	h, _, _ := procGetClipboardData.Call(cfDIB)
+	if h == 0 {
+		return nil, withKind(ErrUnsupported, errors.New("the clipboard holds no bitmap"))
+	}
+	size, _, _ := procGlobalSize.Call(h)
+	p, _, err := procGlobalLock.Call(h)
+	if p == 0 {
+		return nil, os.NewSyscallError("GlobalLock", err)
+	}
+	defer procGlobalUnlock.Call(h)
+
+	// The memory belongs to the clipboard and is gone once it is closed
+	return append([]byte(nil), globalBytes(p, size)...), nil
+}
+
+func (systemClipboard) WriteDIB(dib []byte) error {
+	if err := openClipboard(); err != nil {
+		return err
+	}
+	defer procCloseClipboard.Call()
+
+	if r, _, err := procEmptyClipboard.Call(); r == 0 {
+		return os.NewSyscallError("EmptyClipboard", err)
+	}
+	h, _, err := procGlobalAlloc.Call(gmemMoveable, uintptr(len(dib)))
+	if h == 0 {
+		return os.NewSyscallError("GlobalAlloc", err)
+	}
+	p, _, err := procGlobalLock.Call(h)
+	if p == 0 {
+		procGlobalFree.Call(h)
+		return os.NewSyscallError("GlobalLock", err)
+	}
+	copy(globalBytes(p, uintptr(len(dib))), dib)
+	procGlobalUnlock.Call(h)
+
+	// The clipboard owns the memory once it is set, and frees it itself
+	if r, _, err := procSetClipboardData.Call(cfDIB, h); r == 0 {
+		procGlobalFree.Call(h)
+		return os.NewSyscallError("SetClipboardData", err)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // registers the JPEG decoder with image.Decode
+	_ "image/png"  // registers the PNG decoder with image.Decode
+	"io"
+	"strconv"
+)
+
+// Input formats recognized by DetectFormat.
+const (
+	InputBMP  = "bmp"
+	InputPNG  = "png"
+	InputJPEG = "jpeg"
+	InputPPM  = "ppm" // binary netpbm color, P6
+	InputPGM  = "pgm" // binary netpbm grayscale, P5
+
+	InputNative = "native" // the frame written by EncodeNative
+)
+
+// InputFormats lists the formats DetectFormat recognizes.
+var InputFormats = []string{InputBMP, InputPNG, InputJPEG, InputPPM, InputPGM, InputNative}
+
+// DetectFormat identifies the format of an image from its first bytes,
+// whatever the name of the file it came from.
+func DetectFormat(head []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(head, []byte("BM")):
+		return InputBMP, nil
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return InputPNG, nil
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff}):
+		return InputJPEG, nil
+	case bytes.HasPrefix(head, []byte("P6")):
+		return InputPPM, nil
+	case bytes.HasPrefix(head, []byte("P5")):
+		return InputPGM, nil
+	case bytes.HasPrefix(head, []byte(nativeMagic)):
+		return InputNative, nil
+	}
+	return "", fmt.Errorf("%w (starts with 0x%x)", ErrUnrecognizedFormat, head[:min(len(head), 8)])
+}
+
+// DecodeImage decodes an image in any of the formats recognized by
+// DetectFormat. Images that aren't BMP are converted to a 24-bit bottom-up
+// BMPImage; an alpha channel is kept in Alpha if any pixel is not opaque.
+func DecodeImage(data []byte) (*BMPImage, error) {
+	return DecodeImageWith(data, ParseOptions{})
+}
+
+// DecodeImageWith is like DecodeImage, reading BMP files as ParseBMPWith
+// does with opts, rejecting images of any format over opts.MaxPixels with
+// ErrPixelLimit before any pixel is allocated, reporting the progress of the
+// "decode" stage to opts.Hooks and logging the Warnings of the decoded image
+// as warnings.
+func DecodeImageWith(data []byte, opts ParseOptions) (*BMPImage, error) {
+	opts.Hooks.progress("decode", 0, 1)
+	image, err := decodeImage(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range image.Warnings {
+		opts.Hooks.warnf("%s", warning)
+	}
+	opts.Hooks.progress("decode", 1, 1)
+	return image, nil
+}
+
+// decodeImage decodes data for DecodeImageWith.
+func decodeImage(data []byte, opts ParseOptions) (*BMPImage, error) {
+	format, err := DetectFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case InputBMP:
+		return ParseBMPWith(data, opts)
+	case InputPPM, InputPGM:
+		return decodeNetpbm(bufio.NewReader(bytes.NewReader(data)), opts.MaxPixels)
+	case InputNative:
+		return decodeNative(data, opts.MaxPixels)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, withKind(ErrUnsupported, fmt.Errorf("decoding %s: %w", format, err))
+	}
+	if err := checkPixels(config.Width, config.Height, opts.MaxPixels); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, withKind(ErrUnsupported, fmt.Errorf("decoding %s: %w", format, err))
+	}
+	return fromImage(img), nil
+}
+
+// LoadImage reads the file at path and decodes it with DecodeImage. Files
+// of at least MmapThreshold bytes are memory-mapped rather than read, and a
+// path of "-" reads standard input, so that images can be piped from one
+// bitmap process to the next. Failing to read the file is an error of kind
+// ErrIO.
+func LoadImage(path string) (*BMPImage, error) {
+	return LoadImageWith(path, ParseOptions{})
+}
+
+// LoadImageWith is like LoadImage, decoding the file with DecodeImageWith
+// and opts.
+func LoadImageWith(path string, opts ParseOptions) (*BMPImage, error) {
+	b, release, err := readFile(path)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	defer release()
+	return DecodeImageWith(b, opts)
+}
+
+// ReadImageHeader returns the headers of the image file at path without
+// decoding any pixels. For BMP files they are the validated file headers;
+// for other formats they are the headers DecodeImage gives the decoded image.
+func ReadImageHeader(path string) (*BMPImage, error) {
+	image, size, format, err := readImageHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == InputBMP {
+		if err := validateHeaders(image, int(size)); err != nil {
+			return nil, err
+		}
+	}
+	return image, nil
+}
+
+// readImageHeader is ReadImageHeader without validation of BMP headers,
+// as in readHeaderFile. It also returns the file size and its format.
+func readImageHeader(path string) (*BMPImage, int64, string, error) {
+	f, size, err := openInput(path)
+	if err != nil {
+		return nil, 0, "", ioError(err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head, _ := r.Peek(len(nativeMagic))
+	format, err := DetectFormat(head)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	var width, height int
+	switch format {
+	case InputBMP:
+		image, size, err := readHeaderFile(path)
+		return image, size, format, err
+	case InputPPM, InputPGM:
+		_, width, height, _, err = readNetpbmHeader(r)
+	case InputNative:
+		var flags byte
+		width, height, flags, err = readNativeHeader(r)
+		if err == nil {
+			image := NewImage(width, height)
+			if flags&nativeTopDown != 0 {
+				image.InfoHeader.Height = -image.InfoHeader.Height
+			}
+			return image, size, format, nil
+		}
+	default:
+		var config image.Config
+		config, _, err = image.DecodeConfig(r)
+		width, height = config.Width, config.Height
+	}
+	if err != nil {
+		return nil, 0, "", withKind(ErrUnsupported, fmt.Errorf("decoding %s: %w", format, err))
+	}
+	return NewImage(width, height), size, format, nil
+}
+
+// NewImage returns a black 24-bit bottom-up image of the given size with
+// consistent headers.
+func NewImage(width, height int) *BMPImage {
+	b := &BMPImage{
+		Header: BMPHeader{Signature: [2]byte{'B', 'M'}, DataOffset: 54},
+		InfoHeader: DIBHeader{
+			Size:         40,
+			Width:        int32(width),
+			Height:       int32(height),
+			Planes:       1,
+			BitsPerPixel: 24,
+		},
+	}
+	b.updateSizes()
+
+	b.Data = make([][]Pixel, height)
+	for y := range b.Data {
+		b.Data[y] = make([]Pixel, width)
+	}
+	return b
+}
+
+// fromImage converts a decoded standard library image to a BMPImage.
+func fromImage(img image.Image) *BMPImage {
+	bounds := img.Bounds()
+	b := NewImage(bounds.Dx(), bounds.Dy())
+
+	alpha := make([][]byte, len(b.Data))
+	opaque := true
+	for y, row := range b.Rows() {
+		alpha[y] = make([]byte, len(row))
+		for x := range row {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			row[x] = Pixel{Blue: c.B, Green: c.G, Red: c.R}
+			alpha[y][x] = c.A
+			opaque = opaque && c.A == 255
+		}
+	}
+	if !opaque {
+		b.Alpha = alpha
+	}
+	return b
+}
+
+// toImage converts a BMPImage to a standard library image, for the encoders
+// of other formats.
+func toImage(b *BMPImage) *image.NRGBA {
+	width := int(b.InfoHeader.Width)
+	img := image.NewNRGBA(image.Rect(0, 0, width, len(b.Data)))
+	for y, row := range b.Rows() {
+		for x, p := range row {
+			a := byte(255)
+			if b.Alpha != nil {
+				a = b.Alpha[y][x]
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: p.Red, G: p.Green, B: p.Blue, A: a})
+		}
+	}
+	return img
+}
+
+// readNetpbmHeader parses the header of a binary PPM (P6) or PGM (P5) file,
+// leaving r at the first byte of the pixel data.
+func readNetpbmHeader(r *bufio.Reader) (magic string, width, height, maxval int, err error) {
+	var fields [4]string
+	for i := range fields {
+		if fields[i], err = netpbmToken(r); err != nil {
+			return "", 0, 0, 0, err
+		}
+	}
+
+	magic = fields[0]
+	width, errW := strconv.Atoi(fields[1])
+	height, errH := strconv.Atoi(fields[2])
+	maxval, errM := strconv.Atoi(fields[3])
+	if (magic != "P6" && magic != "P5") || errW != nil || errH != nil || errM != nil ||
+		width <= 0 || height <= 0 || maxval <= 0 || maxval > 65535 {
+		return "", 0, 0, 0, ErrCorruptFile
+	}
+	return magic, width, height, maxval, nil
+}
+
+// netpbmToken reads the next whitespace separated header token, skipping
+// comments, and consumes the single whitespace character that ends it.
+func netpbmToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", ErrCorruptFile
+		}
+		switch {
+		case c == '#' && len(token) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", ErrCorruptFile
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, c)
+		}
+	}
+}
+
+// decodeNetpbm decodes a binary PPM or PGM image. Samples wider than 8 bits
+// are scaled down to 8 bits with rounding. Images over maxPixels, unless it
+// is 0, are rejected with ErrPixelLimit.
+func decodeNetpbm(r *bufio.Reader, maxPixels int64) (*BMPImage, error) {
+	magic, width, height, maxval, err := readNetpbmHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := 3
+	if magic == "P5" {
+		channels = 1
+	}
+	sampleSize := 1
+	if maxval > 255 {
+		sampleSize = 2
+	}
+
+	if err := checkPixels(width, height, maxPixels); err != nil {
+		return nil, err
+	}
+	b := NewImage(width, height)
+	buf := make([]byte, width*channels*sampleSize)
+	sample := func(i int) byte {
+		v := int(buf[i*sampleSize])
+		if sampleSize == 2 {
+			v = v<<8 | int(buf[i*2+1])
+		}
+		return byte(divRound(min(v, maxval)*255, maxval))
+	}
+
+	for _, row := range b.Rows() {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, ErrInvalidImageData
+		}
+		for x := range row {
+			if channels == 1 {
+				g := sample(x)
+				row[x] = Pixel{Blue: g, Green: g, Red: g}
+			} else {
+				row[x] = Pixel{Red: sample(3 * x), Green: sample(3*x + 1), Blue: sample(3*x + 2)}
+			}
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// colorNames are the 16 basic CSS color keywords accepted by ParseColor.
+var colorNames = map[string]Pixel{
+	"black":   {Red: 0x00, Green: 0x00, Blue: 0x00},
+	"silver":  {Red: 0xc0, Green: 0xc0, Blue: 0xc0},
+	"gray":    {Red: 0x80, Green: 0x80, Blue: 0x80},
+	"white":   {Red: 0xff, Green: 0xff, Blue: 0xff},
+	"maroon":  {Red: 0x80, Green: 0x00, Blue: 0x00},
+	"red":     {Red: 0xff, Green: 0x00, Blue: 0x00},
+	"purple":  {Red: 0x80, Green: 0x00, Blue: 0x80},
+	"fuchsia": {Red: 0xff, Green: 0x00, Blue: 0xff},
+	"green":   {Red: 0x00, Green: 0x80, Blue: 0x00},
+	"lime":    {Red: 0x00, Green: 0xff, Blue: 0x00},
+	"olive":   {Red: 0x80, Green: 0x80, Blue: 0x00},
+	"yellow":  {Red: 0xff, Green: 0xff, Blue: 0x00},
+	"navy":    {Red: 0x00, Green: 0x00, Blue: 0x80},
+	"blue":    {Red: 0x00, Green: 0x00, Blue: 0xff},
+	"teal":    {Red: 0x00, Green: 0x80, Blue: 0x80},
+	"aqua":    {Red: 0x00, Green: 0xff, Blue: 0xff},
+}
+
+// colorForms lists the accepted color syntaxes for error messages.
+const colorForms = "#RGB, #RRGGBB, RRGGBB, rgb(r,g,b) or a basic color name such as red"
+
+// ParseColor parses a color given as #RGB, #RRGGBB, RRGGBB, rgb(r,g,b) with
+// decimal components in 0-255, or one of the 16 basic CSS color names.
+// Parsing is case-insensitive and ignores surrounding spaces. Anything else
+// is an error of kind ErrInvalidParameter.
+func ParseColor(s string) (Pixel, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+
+	if p, ok := colorNames[v]; ok {
+		return p, nil
+	}
+
+	if inner, ok := strings.CutPrefix(v, "rgb("); ok {
+		inner, ok = strings.CutSuffix(inner, ")")
+		parts := strings.Split(inner, ",")
+		if !ok || len(parts) != 3 {
+			return Pixel{}, withKind(ErrInvalidParameter, fmt.Errorf("invalid color %q: rgb() takes three components, as in rgb(255,128,0)", s))
+		}
+		var c [3]byte
+		for i, part := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 0 || n > 255 {
+				return Pixel{}, withKind(ErrInvalidParameter, fmt.Errorf("invalid color %q: rgb() component %q is not an integer in 0-255", s, strings.TrimSpace(part)))
+			}
+			c[i] = byte(n)
+		}
+		return Pixel{Red: c[0], Green: c[1], Blue: c[2]}, nil
+	}
+
+	digits, hash := strings.CutPrefix(v, "#")
+	if hash && len(digits) == 3 {
+		// #RGB is shorthand for #RRGGBB with every digit doubled.
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if b, err := hex.DecodeString(digits); err == nil && len(b) == 3 {
+		return Pixel{Red: b[0], Green: b[1], Blue: b[2]}, nil
+	}
+
+	return Pixel{}, withKind(ErrInvalidParameter, fmt.Errorf("invalid color %q: expected %s", s, colorForms))
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Pixel
+	}{
+		{"#f80", Pixel{Red: 0xff, Green: 0x88, Blue: 0x00}},
+		{"#F80", Pixel{Red: 0xff, Green: 0x88, Blue: 0x00}},
+		{"#ff8000", Pixel{Red: 0xff, Green: 0x80, Blue: 0x00}},
+		{"#FF8000", Pixel{Red: 0xff, Green: 0x80, Blue: 0x00}},
+		{"0a1B2c", Pixel{Red: 0x0a, Green: 0x1b, Blue: 0x2c}},
+		{"rgb(255,128,0)", Pixel{Red: 255, Green: 128, Blue: 0}},
+		{"RGB( 1, 2 ,3 )", Pixel{Red: 1, Green: 2, Blue: 3}},
+		{"red", Pixel{Red: 0xff}},
+		{"Teal", Pixel{Green: 0x80, Blue: 0x80}},
+		{"  NAVY ", Pixel{Blue: 0x80}},
+		{"fuchsia", Pixel{Red: 0xff, Blue: 0xff}},
+	}
+	for _, tt := range tests {
+		got, err := ParseColor(tt.in)
+		if err != nil {
+			t.Errorf("ParseColor(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"#",
+		"#gg0000", // Bad hex
+		"#12345z",
+		"#ff00", // Wrong lengths
+		"#ff00000",
+		"#f",
+		"fff",    // #RGB needs its #
+		"orange", // Unknown name
+		"rgb(256,0,0)",
+		"rgb(1,2)",
+		"rgb(1,2,3",
+	} {
+		if _, err := ParseColor(in); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("ParseColor(%q): got %v, want an error of kind ErrInvalidParameter", in, err)
+		}
+	}
+}
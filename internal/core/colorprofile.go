@@ -0,0 +1,108 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// Color profile modes of BMP output, selected with --color-profile.
+const (
+	ColorProfileKeep  = "keep"  // Pass the V4/V5 header fields and ICC profile of the input through, the default
+	ColorProfileStrip = "strip" // Write a plain 40-byte BITMAPINFOHEADER without any color space information
+	ColorProfileSRGB  = "srgb"  // Write a BITMAPV5HEADER tagged LCS_sRGB, without an embedded profile
+)
+
+// ColorProfiles lists the modes --color-profile accepts.
+var ColorProfiles = []string{ColorProfileKeep, ColorProfileStrip, ColorProfileSRGB}
+
+// Sizes of the DIB headers carrying color space information.
+const (
+	v4HeaderSize = 108
+	v5HeaderSize = 124
+)
+
+// Color space types of the bV5CSType field, and the rendering intent of
+// sRGB output.
+const (
+	lcsSRGB            = 0x73524742 // 'sRGB'
+	lcsWindows         = 0x57696e20 // 'Win ', the default color space of the system
+	lcsProfileLinked   = 0x4c494e4b // 'LINK', ProfileData holds the file name of the profile
+	lcsProfileEmbedded = 0x4d424544 // 'MBED', ProfileData holds the profile itself
+	lcsGMImages        = 4          // LCS_GM_IMAGES, perceptual rendering
+)
+
+// Offsets of the color space fields in HeaderExtra, the DIB header past its
+// first 40 bytes: the four color masks come first, then bV4CSType.
+const (
+	extraMasksEnd    = 16
+	extraCSType      = 16
+	extraIntent      = 68 // V5 only, like the fields below
+	extraProfileData = 72
+	extraProfileSize = 76
+)
+
+// parseColorProfile validates the value of the --color-profile flag.
+func parseColorProfile(value string) (string, error) {
+	if slices.Contains(ColorProfiles, value) {
+		return value, nil
+	}
+	return "", withKind(ErrInvalidParameter, fmt.Errorf("invalid color-profile option: %s (must be keep, strip or srgb)", value))
+}
+
+// readHeaderExtra keeps the fields of a V4 or V5 DIB header past its first
+// 40 bytes in HeaderExtra, and the profile a V5 header embeds or links to in
+// ICCProfile, from the file b. A profile that isn't within b is dropped with
+// a warning, and the color space becomes the default one of the system.
+func readHeaderExtra(bmp *BMPImage, b []byte) {
+	size := int64(bmp.InfoHeader.Size)
+	if size != v4HeaderSize && size != v5HeaderSize || int64(len(b)) < 14+size {
+		return
+	}
+	bmp.HeaderExtra = slices.Clone(b[54 : 14+size])
+	if size != v5HeaderSize {
+		return
+	}
+
+	extra := bmp.HeaderExtra
+	if cs := binary.LittleEndian.Uint32(extra[extraCSType:]); cs != lcsProfileEmbedded && cs != lcsProfileLinked {
+		return
+	}
+	offset := 14 + int64(binary.LittleEndian.Uint32(extra[extraProfileData:]))
+	n := int64(binary.LittleEndian.Uint32(extra[extraProfileSize:]))
+	if n > 0 && offset >= 14+size && offset+n <= int64(len(b)) {
+		bmp.ICCProfile = slices.Clone(b[offset : offset+n])
+		return
+	}
+	bmp.Warnings = append(bmp.Warnings, fmt.Sprintf("color profile of %d bytes at offset %d is not within the file and was dropped", n, offset))
+	binary.LittleEndian.PutUint32(extra[extraCSType:], lcsWindows)
+	clear(extra[extraProfileData : extraProfileSize+4])
+}
+
+// srgbHeaderExtra returns the fields of a BITMAPV5HEADER past its first 40
+// bytes for an sRGB image without color masks nor embedded profile.
+func srgbHeaderExtra() []byte {
+	extra := make([]byte, v5HeaderSize-40)
+	binary.LittleEndian.PutUint32(extra[extraCSType:], lcsSRGB)
+	binary.LittleEndian.PutUint32(extra[extraIntent:], lcsGMImages)
+	return extra
+}
+
+// withColorProfile returns image with the headers opts.ColorProfile selects.
+// The pixels are shared with image, which is left untouched.
+func (opts SaveOptions) withColorProfile(image *BMPImage) *BMPImage {
+	c := *image
+	switch opts.colorProfile() {
+	case ColorProfileStrip:
+		c.InfoHeader.Size = 40
+		c.HeaderExtra, c.ICCProfile = nil, nil
+	case ColorProfileSRGB:
+		c.InfoHeader.Size = v5HeaderSize
+		c.HeaderExtra, c.ICCProfile = srgbHeaderExtra(), nil
+	default:
+		return image
+	}
+	c.Header.DataOffset = 14 + c.InfoHeader.Size
+	c.updateSizes()
+	return &c
+}
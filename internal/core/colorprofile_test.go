@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// v5File returns image encoded as a 24-bit BMP with a BITMAPV5HEADER that
+// embeds profile after the pixel array.
+func v5File(t *testing.T, image *BMPImage, profile []byte) []byte {
+	t.Helper()
+	b := withDIBHeaderSize(encodeBMP(t, image), v5HeaderSize, 0)
+	extra := b[54:138]
+	clear(extra)
+	binary.LittleEndian.PutUint32(extra[extraCSType:], lcsProfileEmbedded)
+	binary.LittleEndian.PutUint32(extra[extraIntent:], lcsGMImages)
+	binary.LittleEndian.PutUint32(extra[extraProfileData:], uint32(len(b)-14))
+	binary.LittleEndian.PutUint32(extra[extraProfileSize:], uint32(len(profile)))
+	b = append(b, profile...)
+	binary.LittleEndian.PutUint32(b[2:], uint32(len(b)))
+	return b
+}
+
+func TestColorProfileModes(t *testing.T) {
+	image := noiseImage(5, 3, 1)
+	profile := []byte("ICC profile data")
+	input, err := ParseBMP(v5File(t, image, profile))
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	if !bytes.Equal(input.ICCProfile, profile) {
+		t.Fatalf("ICCProfile = %q, want %q", input.ICCProfile, profile)
+	}
+
+	pixels := int(pixelArraySize(5, 3, 24))
+	tests := []struct {
+		mode                 string
+		size, offset, length int
+		csType, intent       uint32
+		profile              []byte
+	}{
+		{ColorProfileKeep, 124, 138, 138 + pixels + len(profile), lcsProfileEmbedded, lcsGMImages, profile},
+		{ColorProfileStrip, 40, 54, 54 + pixels, 0, 0, nil},
+		{ColorProfileSRGB, 124, 138, 138 + pixels, lcsSRGB, lcsGMImages, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			opts := SaveOptions{Format: FormatBMP24, ColorProfile: tt.mode}
+			var buf bytes.Buffer
+			if err := Encode(&buf, input, opts); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			b := buf.Bytes()
+
+			if len(b) != tt.length || EncodedSize(input, opts) != int64(tt.length) {
+				t.Errorf("%d bytes written, EncodedSize %d, want %d", len(b), EncodedSize(input, opts), tt.length)
+			}
+			le := binary.LittleEndian
+			if got := le.Uint32(b[2:]); got != uint32(len(b)) {
+				t.Errorf("FileSize = %d, want %d", got, len(b))
+			}
+			if got := le.Uint32(b[10:]); got != uint32(tt.offset) {
+				t.Errorf("DataOffset = %d, want %d", got, tt.offset)
+			}
+			if got := le.Uint32(b[14:]); got != uint32(tt.size) {
+				t.Errorf("DIB header size = %d, want %d", got, tt.size)
+			}
+			if tt.size == v5HeaderSize {
+				extra := b[54:138]
+				if got := le.Uint32(extra[extraCSType:]); got != tt.csType {
+					t.Errorf("CSType = %#x, want %#x", got, tt.csType)
+				}
+				if got := le.Uint32(extra[extraIntent:]); got != tt.intent {
+					t.Errorf("intent = %d, want %d", got, tt.intent)
+				}
+				data, size := le.Uint32(extra[extraProfileData:]), le.Uint32(extra[extraProfileSize:])
+				if tt.profile == nil && (data != 0 || size != 0) {
+					t.Errorf("profile at %d of %d bytes, want none", data, size)
+				}
+				if tt.profile != nil && !bytes.Equal(b[14+data:14+data+size], tt.profile) {
+					t.Errorf("profile at %d is %q, want %q", data, b[14+data:14+data+size], tt.profile)
+				}
+			}
+
+			decoded, err := ParseBMP(b)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			if !gridsEqual(decoded.Data, image.Data) {
+				t.Error("pixels differ from the input")
+			}
+			if !bytes.Equal(decoded.ICCProfile, tt.profile) {
+				t.Errorf("decoded ICCProfile = %q, want %q", decoded.ICCProfile, tt.profile)
+			}
+		})
+	}
+}
+
+func TestColorProfileOutsideFile(t *testing.T) {
+	b := v5File(t, noiseImage(5, 3, 1), nil)
+	binary.LittleEndian.PutUint32(b[54+extraProfileSize:], 100)
+
+	image, err := ParseBMP(b)
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	if image.ICCProfile != nil || len(image.Warnings) != 1 || !strings.Contains(image.Warnings[0], "color profile of 100 bytes") {
+		t.Errorf("profile %q kept with warnings %q, want it dropped with a warning", image.ICCProfile, image.Warnings)
+	}
+	if got := binary.LittleEndian.Uint32(image.HeaderExtra[extraCSType:]); got != lcsWindows {
+		t.Errorf("CSType = %#x, want LCS_WINDOWS_COLOR_SPACE", got)
+	}
+}
+
+func TestColorProfileOnlyForBMP24(t *testing.T) {
+	if _, _, err := ParseApplyOptions([]string{"--color-profile=srgb", "--format=png"}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("srgb with png output: %v, want an ErrInvalidParameter", err)
+	}
+	if _, _, err := ParseApplyOptions([]string{"--color-profile=icc"}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("unknown mode: %v, want an ErrInvalidParameter", err)
+	}
+	opts, _, err := ParseApplyOptions([]string{"--color-profile=strip", "--format=bmp24"})
+	if err != nil || opts.Save.ColorProfile != ColorProfileStrip {
+		t.Errorf("strip: %q, %v", opts.Save.ColorProfile, err)
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import "math"
+
+// Conversions between RGB and the cylindrical HSL and HSV color spaces.
+// Hue is in degrees in [0, 360); saturation, lightness and value are in [0, 1].
+// For grays the hue is undefined and reported as 0, with a saturation of 0;
+// converting back ignores the hue whenever the saturation is 0.
+// Converting to RGB rounds every channel to the nearest integer, so any
+// 8-bit color survives a round trip within ±1 per channel.
+
+// RGBToHSL converts p to hue, saturation and lightness.
+func RGBToHSL(p Pixel) (h, s, l float64) {
+	r, g, b := float64(p.Red)/255, float64(p.Green)/255, float64(p.Blue)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+	l = (hi + lo) / 2
+
+	if hi == lo {
+		return 0, 0, l
+	}
+
+	d := hi - lo
+	if l > 0.5 {
+		s = d / (2 - hi - lo)
+	} else {
+		s = d / (hi + lo)
+	}
+	return hue(r, g, b, hi, d), s, l
+}
+
+// HSLToRGB converts hue, saturation and lightness to a pixel. Out of range
+// inputs are wrapped (hue) or clamped (saturation, lightness).
+func HSLToRGB(h, s, l float64) Pixel {
+	s, l = clamp01(s), clamp01(l)
+	c := (1 - math.Abs(2*l-1)) * s
+	return chromaToRGB(h, c, l-c/2)
+}
+
+// RGBToHSV converts p to hue, saturation and value.
+func RGBToHSV(p Pixel) (h, s, v float64) {
+	r, g, b := float64(p.Red)/255, float64(p.Green)/255, float64(p.Blue)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+
+	if hi == lo {
+		return 0, 0, hi
+	}
+
+	d := hi - lo
+	return hue(r, g, b, hi, d), d / hi, hi
+}
+
+// HSVToRGB converts hue, saturation and value to a pixel. Out of range
+// inputs are wrapped (hue) or clamped (saturation, value).
+func HSVToRGB(h, s, v float64) Pixel {
+	s, v = clamp01(s), clamp01(v)
+	c := v * s
+	return chromaToRGB(h, c, v-c)
+}
+
+// hue returns the hue in degrees of a color with channels r, g, b in [0, 1],
+// given its largest channel hi and its chroma d, which must not be 0.
+func hue(r, g, b, hi, d float64) float64 {
+	var h float64
+	switch hi {
+	case r:
+		h = (g - b) / d
+		if h < 0 {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h >= 360 {
+		h -= 360
+	}
+	return h
+}
+
+// chromaToRGB builds a pixel from a hue, a chroma c and the amount m added
+// to every channel to match the lightness or value.
+func chromaToRGB(h, c, m float64) Pixel {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	hp := h / 60
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+
+	var r, g, b float64
+	switch int(hp) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	return Pixel{Blue: unitToByte(b + m), Green: unitToByte(g + m), Red: unitToByte(r + m)}
+}
+
+// unitToByte maps v in [0, 1] to a channel value, rounding to the nearest integer.
+func unitToByte(v float64) byte {
+	return clampRound(v * 255)
+}
+
+// clamp01 limits v to [0, 1].
+func clamp01(v float64) float64 {
+	return min(max(v, 0), 1)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// within1 reports whether every channel of a and b differs by at most 1.
+func within1(a, b Pixel) bool {
+	return utils.Abs(int(a.Red)-int(b.Red)) <= 1 && utils.Abs(int(a.Green)-int(b.Green)) <= 1 && utils.Abs(int(a.Blue)-int(b.Blue)) <= 1
+}
+
+func TestColorSpaceRoundTrip(t *testing.T) {
+	// Grays have no hue, so they must come back exactly
+	for v := range 256 {
+		p := Pixel{Blue: byte(v), Green: byte(v), Red: byte(v)}
+		if h, s, l := RGBToHSL(p); h != 0 || s != 0 || HSLToRGB(h, s, l) != p {
+			t.Errorf("HSL of gray %d is (%v, %v, %v), back to %v", v, h, s, l, HSLToRGB(h, s, l))
+		}
+		if h, s, v := RGBToHSV(p); h != 0 || s != 0 || HSVToRGB(h, s, v) != p {
+			t.Errorf("HSV of %v is (%v, %v, %v), back to %v", p, h, s, v, HSVToRGB(h, s, v))
+		}
+	}
+
+	for r := 0; r < 256; r += 15 {
+		for g := 0; g < 256; g += 15 {
+			for b := 0; b < 256; b += 15 {
+				p := Pixel{Blue: byte(b), Green: byte(g), Red: byte(r)}
+				if got := HSLToRGB(RGBToHSL(p)); !within1(got, p) {
+					t.Errorf("HSL round trip of %v gives %v", p, got)
+				}
+				if got := HSVToRGB(RGBToHSV(p)); !within1(got, p) {
+					t.Errorf("HSV round trip of %v gives %v", p, got)
+				}
+			}
+		}
+	}
+}
+
+func TestColorSpacePrimaries(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Pixel
+		hue  float64
+	}{
+		{"red", Pixel{Red: 255}, 0},
+		{"green", Pixel{Green: 255}, 120},
+		{"blue", Pixel{Blue: 255}, 240},
+	}
+	for _, tt := range tests {
+		if h, s, l := RGBToHSL(tt.p); h != tt.hue || s != 1 || l != 0.5 {
+			t.Errorf("HSL of %s is (%v, %v, %v), want (%v, 1, 0.5)", tt.name, h, s, l, tt.hue)
+		}
+		if h, s, v := RGBToHSV(tt.p); h != tt.hue || s != 1 || v != 1 {
+			t.Errorf("HSV of %s is (%v, %v, %v), want (%v, 1, 1)", tt.name, h, s, v, tt.hue)
+		}
+		if got := HSLToRGB(tt.hue, 1, 0.5); got != tt.p {
+			t.Errorf("HSLToRGB(%v, 1, 0.5) = %v, want %s", tt.hue, got, tt.name)
+		}
+		if got := HSVToRGB(tt.hue, 1, 1); got != tt.p {
+			t.Errorf("HSVToRGB(%v, 1, 1) = %v, want %s", tt.hue, got, tt.name)
+		}
+		// The hue wraps around
+		if got := HSLToRGB(tt.hue+360, 1, 0.5); got != tt.p {
+			t.Errorf("HSLToRGB(%v, 1, 0.5) = %v, want %s", tt.hue+360, got, tt.name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"unicode/utf8"
+)
+
+// A comment is a note of text carried by a BMP file in a block after the
+// pixel data, and after the ICC profile if any, counted in FileSize:
+//
+//	offset 0  "BMCM"   magic
+//	offset 4  4 bytes  length of the text, little-endian
+//	offset 8  the UTF-8 text, without a terminator
+//
+// A file holds any number of blocks back to back, in the order they were
+// added, followed by the trailer of a stamp if it is stamped. Readers locate
+// pixels through DataOffset and ImageSize, so viewers ignore comments.
+const (
+	commentMagic      = "BMCM"
+	commentHeaderSize = 8
+
+	// MaxCommentSize is the largest comment --comment accepts, in bytes.
+	MaxCommentSize = 64 << 10
+)
+
+// checkComment returns an error of kind ErrInvalidParameter if text can't
+// be written as a comment: it must be non-empty UTF-8 of at most
+// MaxCommentSize bytes.
+func checkComment(text string) error {
+	switch {
+	case text == "":
+		return withKind(ErrInvalidParameter, fmt.Errorf("comment option requires some text"))
+	case len(text) > MaxCommentSize:
+		return withKind(ErrInvalidParameter, fmt.Errorf("invalid comment option: %d bytes (must be at most %d)", len(text), MaxCommentSize))
+	case !utf8.ValidString(text):
+		return withKind(ErrInvalidParameter, fmt.Errorf("invalid comment option: the text is not valid UTF-8"))
+	}
+	return nil
+}
+
+// commentsSize returns the number of bytes the blocks of comments take.
+func commentsSize(comments []string) int64 {
+	var n int64
+	for _, c := range comments {
+		n += commentHeaderSize + int64(len(c))
+	}
+	return n
+}
+
+// encodeComments returns the blocks of comments, back to back.
+func encodeComments(comments []string) []byte {
+	b := make([]byte, 0, commentsSize(comments))
+	for _, c := range comments {
+		b = append(b, commentMagic...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+// readComments keeps the comments of the file b, whose headers and color
+// profile have been read, in Comments. The blocks are read from the end of
+// the pixel array, or of the profile if it comes later, up to FileSize or
+// the trailer of a stamp, and stop at the first bytes that aren't a
+// complete block: data of other tools is skipped, not rejected.
+func readComments(bmp *BMPImage, b []byte) {
+	start := int64(bmp.Header.DataOffset) + int64(bmp.InfoHeader.ImageSize)
+	if bmp.ICCProfile != nil {
+		offset := 14 + int64(binary.LittleEndian.Uint32(bmp.HeaderExtra[extraProfileData:]))
+		start = max(start, offset+int64(len(bmp.ICCProfile)))
+	}
+	end := min(int64(bmp.Header.FileSize), int64(len(b)))
+	if isStampTag(bmp.Header.Reserved) {
+		end -= int64(bmp.Header.Reserved >> 24)
+	}
+
+	for start+commentHeaderSize <= end && bytes.HasPrefix(b[start:], []byte(commentMagic)) {
+		n := int64(binary.LittleEndian.Uint32(b[start+4:]))
+		if n > end-start-commentHeaderSize {
+			break
+		}
+		text := b[start+commentHeaderSize : start+commentHeaderSize+n]
+		bmp.Comments = append(bmp.Comments, string(text))
+		start += commentHeaderSize + n
+	}
+}
+
+// comments returns the comments written into output encoded with opts: those
+// of image followed by the new ones of opts. Only BMP output has comments,
+// and canonical output has none.
+func (opts SaveOptions) comments(image *BMPImage) []string {
+	if opts.Canonical || !isBMP(opts.Format) {
+		return nil
+	}
+	return append(slices.Clip(image.Comments), opts.Comments...)
+}
+
+// WriteComments writes the comments of image to w for the header command,
+// numbered from 1 in the order they were added.
+func WriteComments(w io.Writer, image *BMPImage) error {
+	if len(image.Comments) == 0 {
+		_, err := fmt.Fprintln(w, "Comments: none")
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "Comments:"); err != nil {
+		return err
+	}
+	for i, c := range image.Comments {
+		if _, err := fmt.Fprintf(w, "%d. %s\n", i+1, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
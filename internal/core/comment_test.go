@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkStrict fails unless the BMP file data is one ParseBMP accepts with
+// FileSize matching its length, whose pixels x/image/bmp reads the same, and
+// which passes CheckInvariants.
+func checkStrict(t *testing.T, data []byte) *BMPImage {
+	t.Helper()
+	image, err := ParseBMP(data)
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+	if int(image.Header.FileSize) != len(data) {
+		t.Fatalf("FileSize = %d for a %d-byte file", image.Header.FileSize, len(data))
+	}
+	reference, err := decodeTheirs(data)
+	if err != nil {
+		t.Fatalf("x/image/bmp: %v", err)
+	}
+	for y, row := range image.Rows() {
+		for x, p := range row {
+			if got := opaqueAt(reference, x, y); got != (color.NRGBA{R: p.Red, G: p.Green, B: p.Blue, A: 255}) {
+				t.Fatalf("x/image/bmp reads %v at (%d, %d), ParseBMP %v", got, x, y, p)
+			}
+		}
+	}
+	if err := CheckInvariants(image); err != nil {
+		t.Fatalf("CheckInvariants: %v", err)
+	}
+	return image
+}
+
+func TestCommentsAccumulateAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	image := noiseImage(5, 3, 1)
+	first, second := "cropped per ticket ABC-123", "graded, ünïcode"
+
+	paths := []string{filepath.Join(dir, "first.bmp"), filepath.Join(dir, "second.bmp")}
+	for i, comment := range []string{first, second} {
+		opts, _, err := ParseApplyOptions([]string{"--comment=" + comment})
+		if err != nil {
+			t.Fatalf("ParseApplyOptions: %v", err)
+		}
+		if err := Save(image, paths[i], opts.Save); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if image, err = LoadImage(paths[i]); err != nil {
+			t.Fatalf("LoadImage: %v", err)
+		}
+	}
+
+	if want := []string{first, second}; !slices.Equal(image.Comments, want) {
+		t.Fatalf("Comments = %q, want %q", image.Comments, want)
+	}
+	data, err := os.ReadFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStrict(t, data)
+	if size := EncodedSize(image, SaveOptions{Format: FormatBMP24}); size != int64(len(data)) {
+		t.Errorf("EncodedSize = %d for a %d-byte file", size, len(data))
+	}
+
+	var out bytes.Buffer
+	if err := WriteComments(&out, image); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Comments:\n1. " + first + "\n2. " + second + "\n"; out.String() != want {
+		t.Errorf("WriteComments = %q, want %q", out.String(), want)
+	}
+}
+
+func TestCommentsWithProfileAndStamp(t *testing.T) {
+	profile := []byte("ICC profile data")
+	input, err := ParseBMP(v5File(t, noiseImage(4, 4, 2), profile))
+	if err != nil {
+		t.Fatalf("ParseBMP: %v", err)
+	}
+
+	stamp := &Stamp{Version: StampVersion, Hash: [8]byte{7}}
+	for _, format := range []string{FormatBMP24, FormatBMP32, FormatGray8} {
+		image := input
+		if format == FormatGray8 {
+			image = NewImage(4, 4)
+		}
+		opts := SaveOptions{Format: format, Stamp: stamp, Comments: []string{"a", "bc"}}
+		var buf bytes.Buffer
+		if err := Encode(&buf, image, opts); err != nil {
+			t.Fatalf("%s: Encode: %v", format, err)
+		}
+		if size := EncodedSize(image, opts); size != int64(buf.Len()) {
+			t.Errorf("%s: EncodedSize = %d, wrote %d bytes", format, size, buf.Len())
+		}
+		if format == FormatBMP24 {
+			parsed := checkStrict(t, buf.Bytes())
+			if !bytes.Equal(parsed.ICCProfile, profile) {
+				t.Errorf("ICCProfile = %q, want %q", parsed.ICCProfile, profile)
+			}
+			if !slices.Equal(parsed.Comments, opts.Comments) {
+				t.Errorf("Comments = %q, want %q", parsed.Comments, opts.Comments)
+			}
+		}
+		if got, err := ReadStamp(buf.Bytes()); err != nil || got != *stamp {
+			t.Errorf("%s: ReadStamp = %v, %v", format, got, err)
+		}
+	}
+}
+
+func TestReadCommentsStopsAtForeignData(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, noiseImage(3, 2, 3), SaveOptions{Format: FormatBMP24, Comments: []string{"kept"}}); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name  string
+		extra []byte
+	}{
+		{"other tool", []byte("XXXXsome data")},
+		{"block past the end", append([]byte(commentMagic), 0xff, 0, 0, 0, 'x')},
+		{"short header", []byte("BMC")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(bytes.Clone(valid), tt.extra...)
+			binary.LittleEndian.PutUint32(data[2:], uint32(len(data)))
+			image, err := ParseBMP(data)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			if !slices.Equal(image.Comments, []string{"kept"}) {
+				t.Errorf("Comments = %q, want [kept]", image.Comments)
+			}
+		})
+	}
+}
+
+func TestCommentOptionErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--comment="},
+		{"--comment=" + strings.Repeat("x", MaxCommentSize+1)},
+		{"--comment=\xff"},
+		{"--comment=a", "--format=png"},
+		{"--comment=a", "--canonical"},
+		{"--comment=a", "--tiled"},
+	} {
+		if _, _, err := ParseApplyOptions(args); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("ParseApplyOptions(%.40q): error %v, want ErrInvalidParameter", args, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, noiseImage(2, 2, 1), SaveOptions{Format: FormatPNG, Comments: []string{"a"}}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("PNG output: error %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestCanonicalDropsComments(t *testing.T) {
+	image := noiseImage(3, 3, 4)
+	image.Comments = []string{"note"}
+	var with, without bytes.Buffer
+	if err := Encode(&with, image, SaveOptions{Format: FormatBMP24, Canonical: true}); err != nil {
+		t.Fatal(err)
+	}
+	image.Comments = nil
+	if err := Encode(&without, image, SaveOptions{Format: FormatBMP24, Canonical: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(with.Bytes(), without.Bytes()) {
+		t.Error("the comments of the image change canonical output")
+	}
+}
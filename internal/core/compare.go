@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// MaxReportedDiffs is the number of differing pixels DiffImages records individually.
+const MaxReportedDiffs = 1000
+
+// PixelDiff is a single pixel that differs between two images.
+// X and Y are counted from the visual top-left corner.
+type PixelDiff struct {
+	X, Y int
+	A, B Pixel
+}
+
+// DiffReport describes how two images of the same size differ.
+type DiffReport struct {
+	Width, Height int
+	Tolerance     int         // Largest per-channel difference still considered equal
+	DiffCount     int         // Number of pixels differing by more than Tolerance
+	MaxDelta      int         // Largest per-channel difference found
+	MinX, MinY    int         // Top-left corner of the bounding box of differing pixels
+	MaxX, MaxY    int         // Bottom-right corner of the bounding box, inclusive
+	Diffs         []PixelDiff // The first MaxReportedDiffs differing pixels in row order
+}
+
+// Equal reports whether no pixel differs by more than the tolerance.
+func (r DiffReport) Equal() bool {
+	return r.DiffCount == 0
+}
+
+// DiffImages compares a and b pixel by pixel in visual order. A pixel counts
+// as different when any of its channels differs by more than tolerance.
+// Images of different dimensions can't be compared and return ErrDimensionMismatch.
+func DiffImages(a, b *BMPImage, tolerance int) (DiffReport, error) {
+	aw, ah := int(a.InfoHeader.Width), utils.Abs(int(a.InfoHeader.Height))
+	bw, bh := int(b.InfoHeader.Width), utils.Abs(int(b.InfoHeader.Height))
+	if aw != bw || ah != bh {
+		return DiffReport{}, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, aw, ah, bw, bh)
+	}
+
+	report := DiffReport{Width: aw, Height: ah, Tolerance: tolerance, MinX: aw, MinY: ah, MaxX: -1, MaxY: -1}
+	for y := 0; y < ah; y++ {
+		rowA, rowB := a.Data[y], b.Data[y]
+		for x := 0; x < aw; x++ {
+			delta := maxChannelDelta(rowA[x], rowB[x])
+			report.MaxDelta = max(report.MaxDelta, delta)
+			if delta <= tolerance {
+				continue
+			}
+
+			report.DiffCount++
+			report.MinX, report.MinY = min(report.MinX, x), min(report.MinY, y)
+			report.MaxX, report.MaxY = max(report.MaxX, x), max(report.MaxY, y)
+			if len(report.Diffs) < MaxReportedDiffs {
+				report.Diffs = append(report.Diffs, PixelDiff{X: x, Y: y, A: rowA[x], B: rowB[x]})
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// maxChannelDelta returns the largest absolute difference between the channels of p and q.
+func maxChannelDelta(p, q Pixel) int {
+	return max(
+		utils.Abs(int(p.Blue)-int(q.Blue)),
+		utils.Abs(int(p.Green)-int(q.Green)),
+		utils.Abs(int(p.Red)-int(q.Red)),
+	)
+}
+
+// CompareOptions holds the flags of the compare command.
+type CompareOptions struct {
+	Tolerance int  // Largest per-channel difference still considered equal
+	ShowDiffs int  // Number of differing pixels to list
+	ByRow     bool // Compare the row digests of the files, see RowIndex
+}
+
+// ParseCompareArgs parses the compare command arguments: options followed by two files.
+// Row digests are exact, so --by-row can't be combined with --tolerance or --diffs.
+func ParseCompareArgs(args []string) (CompareOptions, string, string, error) {
+	var opts CompareOptions
+
+	if len(args) < 2 {
+		return opts, "", "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-2] {
+		var err error
+		switch {
+		case strings.HasPrefix(arg, "--tolerance="):
+			opts.Tolerance, err = strconv.Atoi(strings.TrimPrefix(arg, "--tolerance="))
+			if err != nil || opts.Tolerance < 0 || opts.Tolerance > 255 {
+				return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("invalid tolerance option: %s", arg))
+			}
+		case strings.HasPrefix(arg, "--diffs="):
+			opts.ShowDiffs, err = strconv.Atoi(strings.TrimPrefix(arg, "--diffs="))
+			if err != nil || opts.ShowDiffs < 0 || opts.ShowDiffs > MaxReportedDiffs {
+				return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("invalid diffs option: %s (must be 0-%d)", arg, MaxReportedDiffs))
+			}
+		case arg == "--by-row":
+			opts.ByRow = true
+		default:
+			return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	if opts.ByRow && (opts.Tolerance > 0 || opts.ShowDiffs > 0) {
+		return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("--tolerance and --diffs don't apply to --by-row"))
+	}
+	return opts, args[len(args)-2], args[len(args)-1], nil
+}
+
+// PrintDiffReport prints a human-readable summary of the report to w,
+// listing at most showDiffs of the differing pixels.
+func PrintDiffReport(w io.Writer, report DiffReport, showDiffs int) {
+	if report.Equal() {
+		fmt.Fprintf(w, "Images are equal (tolerance %d, max channel difference %d)\n", report.Tolerance, report.MaxDelta)
+		return
+	}
+
+	total := report.Width * report.Height
+	fmt.Fprintf(w, "Images differ: %d of %d pixels (%.4f%%) beyond tolerance %d\n",
+		report.DiffCount, total, float64(report.DiffCount)*100/float64(total), report.Tolerance)
+	fmt.Fprintf(w, "Max channel difference: %d\n", report.MaxDelta)
+	fmt.Fprintf(w, "Bounding box: x=%d y=%d width=%d height=%d\n",
+		report.MinX, report.MinY, report.MaxX-report.MinX+1, report.MaxY-report.MinY+1)
+
+	for _, d := range report.Diffs[:min(showDiffs, len(report.Diffs))] {
+		fmt.Fprintf(w, "(%d,%d): #%02x%02x%02x -> #%02x%02x%02x\n",
+			d.X, d.Y, d.A.Red, d.A.Green, d.A.Blue, d.B.Red, d.B.Green, d.B.Blue)
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestDiffImagesBoundingBox changes one pixel, or a whole row, of images of
+// several sizes and checks the bounding box DiffImages reports, along with
+// the only row the row digests of the two files tell apart.
+func TestDiffImagesBoundingBox(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		x0, x1, y     int // Changed pixels: columns x0 to x1 of row y
+	}{
+		{"1x1", 1, 1, 0, 0, 0},
+		{"pixel", 9, 7, 5, 5, 3},
+		{"corner", 9, 7, 8, 8, 6},
+		{"row", 9, 7, 0, 8, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := noiseImage(tt.width, tt.height, 1)
+			b := a.Clone()
+			for x := tt.x0; x <= tt.x1; x++ {
+				p := b.At(x, tt.y)
+				p.Green ^= 0x80
+				b.Set(x, tt.y, p)
+			}
+
+			report, err := DiffImages(a, b, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := tt.x1 - tt.x0 + 1; report.DiffCount != n || len(report.Diffs) != n || report.MaxDelta != 0x80 {
+				t.Errorf("%d pixels differ, %d listed, by up to %d", report.DiffCount, len(report.Diffs), report.MaxDelta)
+			}
+			if report.MinX != tt.x0 || report.MaxX != tt.x1 || report.MinY != tt.y || report.MaxY != tt.y {
+				t.Errorf("bounding box (%d, %d)-(%d, %d), want (%d, %d)-(%d, %d)",
+					report.MinX, report.MinY, report.MaxX, report.MaxY, tt.x0, tt.y, tt.x1, tt.y)
+			}
+			if d := report.Diffs[0]; d.X != tt.x0 || d.Y != tt.y || d.A != a.At(tt.x0, tt.y) || d.B != b.At(tt.x0, tt.y) {
+				t.Errorf("first difference %+v", d)
+			}
+
+			var out bytes.Buffer
+			PrintDiffReport(&out, report, 0)
+			if want := fmt.Sprintf("Bounding box: x=%d y=%d width=%d height=1\n", tt.x0, tt.y, tt.x1-tt.x0+1); !strings.HasSuffix(out.String(), want) {
+				t.Errorf("printed %q, want it to end with %q", out.String(), want)
+			}
+
+			indexA, err := HashRows(bytes.NewReader(encodeBMP(t, a)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexB, err := HashRows(bytes.NewReader(encodeBMP(t, b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows, err := DiffRows(indexA, indexB); err != nil || !slices.Equal(rows, []int{tt.y}) {
+				t.Errorf("changed rows %v, %v, want [%d]", rows, err, tt.y)
+			}
+
+			// Within the tolerance, nothing differs
+			if report, err := DiffImages(a, b, 0x80); err != nil || !report.Equal() {
+				t.Errorf("with tolerance 128: %d pixels differ, %v", report.DiffCount, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package core
+
+import "fmt"
+
+// BlendMode selects how Composite combines source and destination pixels.
+type BlendMode int
+
+const (
+	// SrcOver draws the source over the destination, weighted by the source alpha.
+	SrcOver BlendMode = iota
+)
+
+// Composite blends src onto dst with its visual top-left corner at (x, y).
+// Both images use straight alpha; a nil Alpha counts as fully opaque. Parts of
+// src that fall outside dst, and empty images, are ignored. A fully opaque source pixel replaces
+// the destination pixel, and a fully transparent one leaves it untouched.
+//
+// All arithmetic is done on integers with round-half-up division by 255, so
+// repeated compositing does not drift darker.
+func Composite(dst, src *BMPImage, x, y int, mode BlendMode) error {
+	if mode != SrcOver {
+		return withKind(ErrUnsupported, fmt.Errorf("unsupported blend mode: %d", mode))
+	}
+
+	srcH, dstH := len(src.Data), len(dst.Data)
+	if srcH == 0 || dstH == 0 {
+		return nil
+	}
+	srcW, dstW := len(src.Data[0]), len(dst.Data[0])
+
+	for sy := max(0, -y); sy < srcH && sy+y < dstH; sy++ {
+		for sx := max(0, -x); sx < srcW && sx+x < dstW; sx++ {
+			sa := byte(255)
+			if src.Alpha != nil {
+				sa = src.Alpha[sy][sx]
+			}
+			da := byte(255)
+			if dst.Alpha != nil {
+				da = dst.Alpha[sy+y][sx+x]
+			}
+
+			p, a := blendSrcOver(src.Data[sy][sx], sa, dst.Data[sy+y][sx+x], da)
+			dst.Data[sy+y][sx+x] = p
+			if dst.Alpha != nil {
+				dst.Alpha[sy+y][sx+x] = a
+			}
+		}
+	}
+
+	return nil
+}
+
+// compositeWide is Composite at 16-bit precision for a widened dst and a
+// src of the same size placed over it: the source pixels are widened and
+// blended into dst.Wide, so the precision of dst is kept. Like the filters at
+// 16-bit precision, it leaves dst.Data to be quantized from Wide on output.
+func compositeWide(dst, src *BMPImage) {
+	for y, row := range src.Rows() {
+		for x, p := range row {
+			sa := byte(255)
+			if src.Alpha != nil {
+				sa = src.Alpha[y][x]
+			}
+			da := byte(255)
+			if dst.Alpha != nil {
+				da = dst.Alpha[y][x]
+			}
+
+			q, a := blendSrcOverWide(WidenPixel(p), sa, dst.Wide[y][x], da)
+			dst.Wide[y][x] = q
+			if dst.Alpha != nil {
+				dst.Alpha[y][x] = a
+			}
+		}
+	}
+}
+
+// blendSrcOver computes the source-over blend of two straight-alpha pixels.
+func blendSrcOver(s Pixel, sa byte, d Pixel, da byte) (Pixel, byte) {
+	switch {
+	case sa == 255:
+		return s, 255
+	case sa == 0:
+		return d, da
+	case da == 255:
+		// Opaque destination: the common case, and exact with a single division.
+		return Pixel{
+			Blue:  mix255(s.Blue, d.Blue, sa),
+			Green: mix255(s.Green, d.Green, sa),
+			Red:   mix255(s.Red, d.Red, sa),
+		}, 255
+	}
+
+	// General case, in units of 255*255: out = sa*255 + da*(255-sa).
+	srcW := int(sa) * 255
+	dstW := int(da) * (255 - int(sa))
+	total := srcW + dstW
+	channel := func(sc, dc byte) byte {
+		return byte(divRound(int(sc)*srcW+int(dc)*dstW, total))
+	}
+
+	return Pixel{
+		Blue:  channel(s.Blue, d.Blue),
+		Green: channel(s.Green, d.Green),
+		Red:   channel(s.Red, d.Red),
+	}, byte(divRound(total, 255))
+}
+
+// blendSrcOverWide is blendSrcOver for 16-bit pixels.
+func blendSrcOverWide(s Pixel16, sa byte, d Pixel16, da byte) (Pixel16, byte) {
+	switch {
+	case sa == 255:
+		return s, 255
+	case sa == 0:
+		return d, da
+	}
+
+	// In units of 255*255, as in blendSrcOver; an opaque destination gives
+	// a total of 255*255 and stays opaque.
+	srcW := int64(sa) * 255
+	dstW := int64(da) * (255 - int64(sa))
+	total := srcW + dstW
+	channel := func(sc, dc uint16) uint16 {
+		return uint16(divRound(int64(sc)*srcW+int64(dc)*dstW, total))
+	}
+
+	return Pixel16{
+		Blue:  channel(s.Blue, d.Blue),
+		Green: channel(s.Green, d.Green),
+		Red:   channel(s.Red, d.Red),
+	}, byte(divRound(total, 255))
+}
+
+// mix255 returns s*a + d*(255-a), divided by 255 and rounded.
+func mix255(s, d, a byte) byte {
+	return byte(divRound(int(s)*int(a)+int(d)*(255-int(a)), 255))
+}
+
+// Premultiply scales every color channel by its pixel's alpha.
+// Images without an alpha channel are left unchanged.
+func Premultiply(image *BMPImage) {
+	if image.Alpha == nil {
+		return
+	}
+	for y := range image.Data {
+		for x := range image.Data[y] {
+			a := int(image.Alpha[y][x])
+			p := &image.Data[y][x]
+			p.Blue = byte(divRound(int(p.Blue)*a, 255))
+			p.Green = byte(divRound(int(p.Green)*a, 255))
+			p.Red = byte(divRound(int(p.Red)*a, 255))
+		}
+	}
+}
+
+// Unpremultiply reverses Premultiply. Fully transparent pixels become black,
+// since their color can't be recovered.
+func Unpremultiply(image *BMPImage) {
+	if image.Alpha == nil {
+		return
+	}
+	unscale := func(c byte, a int) byte {
+		return byte(min(255, divRound(int(c)*255, a)))
+	}
+	for y := range image.Data {
+		for x := range image.Data[y] {
+			a := int(image.Alpha[y][x])
+			p := &image.Data[y][x]
+			if a == 0 {
+				*p = Pixel{}
+				continue
+			}
+			p.Blue = unscale(p.Blue, a)
+			p.Green = unscale(p.Green, a)
+			p.Red = unscale(p.Red, a)
+		}
+	}
+}
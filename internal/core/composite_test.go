@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompositeEmptyImages(t *testing.T) {
+	sizes := [][2]int{{0, 0}, {0, 3}, {3, 0}, {3, 3}}
+	for _, d := range sizes {
+		for _, s := range sizes {
+			t.Run(fmt.Sprintf("%dx%d_onto_%dx%d", s[0], s[1], d[0], d[1]), func(t *testing.T) {
+				dst, src := NewImage(d[0], d[1]), NewImage(s[0], s[1])
+				if err := Composite(dst, src, 0, 0, SrcOver); err != nil {
+					t.Fatalf("Composite: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestCompositeOpaqueSourceReplaces(t *testing.T) {
+	dst, src := NewImage(4, 4), NewImage(2, 2)
+	for _, row := range src.Data {
+		for x := range row {
+			row[x] = Pixel{Red: 255}
+		}
+	}
+	if err := Composite(dst, src, 1, 1, SrcOver); err != nil {
+		t.Fatalf("Composite: %v", err)
+	}
+	for y, row := range dst.Rows() {
+		for x, p := range row {
+			want := Pixel{}
+			if x >= 1 && x < 3 && y >= 1 && y < 3 {
+				want = Pixel{Red: 255}
+			}
+			if p != want {
+				t.Errorf("pixel (%d, %d) = %v, want %v", x, y, p, want)
+			}
+		}
+	}
+}
@@ -2,28 +2,176 @@ package core
 
 import (
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
-
-	"github.com/ab-dauletkhan/bitmap/internal/utils"
 )
 
 // CropInfo holds the parameters needed for cropping an image.
+// Instead of explicit coordinates, the area can be given as a named Region
+// that is only resolved once the image dimensions are known.
 type CropInfo struct {
 	OffsetX int // The x-coordinate of the top-left corner of the crop area.
 	OffsetY int // The y-coordinate of the top-left corner of the crop area.
 	Width   int // The width of the crop area.
 	Height  int // The height of the crop area.
+
+	Region   string  // Named region: top, bottom, left, right or center; empty for explicit coordinates.
+	Fraction float64 // Fraction of the image the named region covers, in (0, 1].
+
+	// Range is "rows" or "cols" if the area was given as a range of rows or
+	// columns across the whole image, which the coordinates above already
+	// describe; it only changes how the crop is described.
+	Range string `json:",omitempty"`
+}
+
+// cropRegions are the named regions accepted by --crop.
+var cropRegions = []string{"top", "bottom", "left", "right", "center"}
+
+// cropRanges are the keywords of the range forms of --crop.
+var cropRanges = []string{"rows", "cols"}
+
+// defaultCropFraction is the fraction of the image a named region covers
+// unless one is given.
+const defaultCropFraction = 0.5
+
+// resolve turns a named region into explicit coordinates for an image of the
+// given dimensions. Sizes are computed as dimension*Fraction, rounded down for
+// top, left and center and rounded up for bottom and right, so that top:f and
+// bottom:1-f (or left:f and right:1-f) always split the image exactly; e.g. on
+// a height of 101, top takes 50 rows and bottom the other 51. The center region
+// is shrunk by Fraction in both dimensions and placed at the middle, with any
+// odd pixel left on the right or bottom side; it keeps at least one pixel in
+// each dimension, so that the center of a single row or column is not empty.
+func (c CropInfo) resolve(width, height int) CropInfo {
+	down := func(dim int) int { return int(math.Floor(snap(float64(dim) * c.Fraction))) }
+	up := func(dim int) int { return int(math.Ceil(snap(float64(dim) * c.Fraction))) }
+
+	switch c.Region {
+	case "top":
+		return CropInfo{Width: width, Height: down(height)}
+	case "bottom":
+		h := up(height)
+		return CropInfo{OffsetY: height - h, Width: width, Height: h}
+	case "left":
+		return CropInfo{Width: down(width), Height: height}
+	case "right":
+		w := up(width)
+		return CropInfo{OffsetX: width - w, Width: w, Height: height}
+	case "center":
+		w, h := max(down(width), 1), max(down(height), 1)
+		return CropInfo{OffsetX: (width - w) / 2, OffsetY: (height - h) / 2, Width: w, Height: h}
+	}
+	return c
+}
+
+// snap rounds v to the nearest integer if it is within floating point noise
+// of it, so that e.g. 100*0.3 is treated as exactly 30 before rounding.
+func snap(v float64) float64 {
+	if r := math.Round(v); math.Abs(v-r) < 1e-9 {
+		return r
+	}
+	return v
+}
+
+// Validate reports whether the crop area fits inside an image of the given dimensions.
+func (c CropInfo) Validate(width, height int) error {
+	if c.Region != "" {
+		if r := c.resolve(width, height); r.Width <= 0 || r.Height <= 0 {
+			return withKind(ErrOutOfBounds, fmt.Errorf("crop region %s:%g is empty", c.Region, c.Fraction))
+		}
+		return nil
+	}
+	// The sizes are compared to the room past the offsets, as adding them could overflow
+	if c.Range == "rows" && c.Height > height-c.OffsetY {
+		return withKind(ErrOutOfBounds, fmt.Errorf("crop rows %d-%d exceed the image height of %d", c.OffsetY, c.OffsetY+c.Height, height))
+	}
+	if c.Range == "cols" && c.Width > width-c.OffsetX {
+		return withKind(ErrOutOfBounds, fmt.Errorf("crop columns %d-%d exceed the image width of %d", c.OffsetX, c.OffsetX+c.Width, width))
+	}
+	if c.OffsetX >= width || c.OffsetY >= height {
+		return withKind(ErrOutOfBounds, fmt.Errorf("offset values exceed image dimensions"))
+	}
+	if c.Width > width-c.OffsetX || c.Height > height-c.OffsetY {
+		return withKind(ErrOutOfBounds, fmt.Errorf("crop area exceeds image boundaries"))
+	}
+	return nil
+}
+
+// Dimensions returns the size of the crop area. A zero Width or Height
+// extends the area to the right or bottom edge of the image.
+func (c CropInfo) Dimensions(width, height int) (int, int) {
+	c = c.resolve(width, height)
+	if c.Width == 0 {
+		c.Width = width - c.OffsetX
+	}
+	if c.Height == 0 {
+		c.Height = height - c.OffsetY
+	}
+	return c.Width, c.Height
+}
+
+// resolved returns the crop area as explicit coordinates, with its size
+// spelled out even where it extends to the edges of the image.
+func (c CropInfo) resolved(width, height int) TransformOptions {
+	r := c.resolve(width, height)
+	r.Width, r.Height = r.Dimensions(width, height)
+	r.Range = ""
+	return r
+}
+
+// MemoryMultiplier is 2 since the cropped rows are copied out of the original.
+func (c CropInfo) MemoryMultiplier() int {
+	return 2
+}
+
+func (c CropInfo) String() string {
+	if c.Region != "" {
+		return fmt.Sprintf("crop %s:%g", c.Region, c.Fraction)
+	}
+	if c.Range == "rows" {
+		return fmt.Sprintf("crop rows:%d-%d", c.OffsetY, c.OffsetY+c.Height)
+	}
+	if c.Range == "cols" {
+		return fmt.Sprintf("crop cols:%d-%d", c.OffsetX, c.OffsetX+c.Width)
+	}
+	if c.Width == 0 && c.Height == 0 {
+		return fmt.Sprintf("crop %d-%d", c.OffsetX, c.OffsetY)
+	}
+	return fmt.Sprintf("crop %d-%d-%d-%d", c.OffsetX, c.OffsetY, c.Width, c.Height)
 }
 
 // parseCropInfo parses the crop string format into CropInfo.
 // The crop string can contain either two values (OffsetX, OffsetY)
-// or four values (OffsetX, OffsetY, Width, Height).
+// or four values (OffsetX, OffsetY, Width, Height), or name a region
+// with an optional fraction, such as "top" or "left:0.33", or give a range
+// of rows or columns across the whole image, such as "rows:100-200". Ranges
+// include their start and exclude their end.
 // It returns a CropInfo struct and an error if parsing fails.
 func parseCropInfo(cropStr string) (CropInfo, error) {
-	info := strings.Split(cropStr, "-")
 	var cropInfo CropInfo
 
+	name, fraction, hasFraction := strings.Cut(cropStr, ":")
+	if slices.Contains(cropRegions, name) {
+		cropInfo.Region = name
+		cropInfo.Fraction = defaultCropFraction
+		if hasFraction {
+			f, err := strconv.ParseFloat(fraction, 64)
+			if err != nil || f <= 0 || f > 1 {
+				return cropInfo, fmt.Errorf("invalid crop fraction: %s (must be in (0, 1])", fraction)
+			}
+			cropInfo.Fraction = f
+		}
+		return cropInfo, nil
+	}
+
+	if slices.Contains(cropRanges, name) && hasFraction {
+		return parseCropRange(name, fraction)
+	}
+
+	info := strings.Split(cropStr, "-")
+
 	if len(info) != 2 && len(info) != 4 {
 		return cropInfo, fmt.Errorf("crop option must have either 2 or 4 values")
 	}
@@ -54,73 +202,74 @@ func parseCropInfo(cropStr string) (CropInfo, error) {
 	return cropInfo, nil
 }
 
-// Crop modifies the BMPImage to only include the specified area defined by CropInfo.
-// It adjusts the image dimensions and discards pixels outside the crop area.
-// The crop area is defined by OffsetX and OffsetY as the top-left corner,
-// with the specified Width and Height. An error is returned if the crop
-// area exceeds the image boundaries or if it results in invalid dimensions.
-func Crop(image *BMPImage, opts CropInfo) error {
-	originalWidth := int(image.InfoHeader.Width)
-	originalHeight := int(image.InfoHeader.Height)
-	isTopDown := originalHeight < 0
-	absHeight := utils.Abs(originalHeight)
-
-	if opts.OffsetX >= originalWidth || opts.OffsetY >= absHeight {
-		return fmt.Errorf("offset values exceed image dimensions")
+// parseCropRange parses the <start>-<end> range of a rows or cols crop into
+// a full-width or full-height crop area.
+func parseCropRange(kind, value string) (CropInfo, error) {
+	from, to, ok := strings.Cut(value, "-")
+	start, err1 := strconv.Atoi(from)
+	end, err2 := strconv.Atoi(to)
+	if !ok || err1 != nil || err2 != nil || start < 0 || end <= start {
+		return CropInfo{}, fmt.Errorf("invalid crop range: %s:%s (must be %s:<start>-<end> with start < end)", kind, value, kind)
 	}
 
-	if opts.Width == 0 {
-		opts.Width = originalWidth - opts.OffsetX
-	}
-	if opts.Height == 0 {
-		opts.Height = absHeight - opts.OffsetY
+	if kind == "rows" {
+		return CropInfo{OffsetY: start, Height: end - start, Range: kind}, nil
 	}
+	return CropInfo{OffsetX: start, Width: end - start, Range: kind}, nil
+}
 
-	if opts.OffsetX+opts.Width > originalWidth || opts.OffsetY+opts.Height > absHeight {
-		return fmt.Errorf("crop area exceeds image boundaries")
+// Crop modifies the BMPImage to only include the specified area defined by CropInfo.
+// It adjusts the image dimensions and discards pixels outside the crop area.
+// The crop area is defined by OffsetX and OffsetY as the top-left corner,
+// with the specified Width and Height. An error of kind ErrOutOfBounds is returned
+// if the crop area exceeds the image boundaries or if it results in invalid dimensions.
+// Cropped is the form that leaves the image as it is.
+func Crop(image *BMPImage, opts CropInfo) error {
+	cropped, err := Cropped(image, opts)
+	if err != nil {
+		return err
 	}
+	*image = *cropped
+	return nil
+}
 
-	croppedData := make([][]Pixel, opts.Height)
-	for i := range croppedData {
-		croppedData[i] = make([]Pixel, opts.Width)
-
-		var srcRow int
-		// Comment for the reviewer, in my MacOS for some reason it is reversed
-		// https://en.wikipedia.org/wiki/BMP_file_format#Pixel_array_(bitmap_data)
-		// when topDown (height is negative) is should start from the top,
-		// however, in my macOS it did complementary, so I changed this to !isTopDown
-		// I might change it on Alem PC's.
-		// glhf
-		if !isTopDown {
-			// For top-down images, map rows starting from the top
-			srcRow = opts.OffsetY + i
-		} else {
-			// For bottom-up images, map rows starting from the bottom
-			srcRow = absHeight - 1 - (opts.OffsetY + i)
+// cropRect returns a copy of the crop area of image, stored in the same row
+// order. The area must have been validated and resolved, with its Width and
+// Height set. The image itself is left untouched.
+func cropRect(image *BMPImage, opts CropInfo) *BMPImage {
+	croppedData := make([][]Pixel, 0, opts.Height)
+	var croppedAlpha [][]byte
+	var croppedWide [][]Pixel16
+	for y, row := range image.Rows() {
+		if y < opts.OffsetY {
+			continue
+		}
+		if y >= opts.OffsetY+opts.Height {
+			break
 		}
 
-		for j := 0; j < opts.Width; j++ {
-			croppedData[i][j] = image.Data[srcRow][opts.OffsetX+j]
+		croppedData = append(croppedData, append([]Pixel(nil), row[opts.OffsetX:opts.OffsetX+opts.Width]...))
+		if image.Alpha != nil {
+			alphaRow := image.Alpha[y]
+			croppedAlpha = append(croppedAlpha, append([]byte(nil), alphaRow[opts.OffsetX:opts.OffsetX+opts.Width]...))
+		}
+		if image.Wide != nil {
+			wideRow := image.Wide[y]
+			croppedWide = append(croppedWide, append([]Pixel16(nil), wideRow[opts.OffsetX:opts.OffsetX+opts.Width]...))
 		}
 	}
 
-	image.Data = croppedData
-
-	bytesPerPixel := int(image.InfoHeader.BitsPerPixel) / 8
-	rowSize := (opts.Width*bytesPerPixel + 3) & ^3
-	imageSize := rowSize * opts.Height
-
-	// Update BMP header file size (headers + pixel data)
-	image.Header.FileSize = uint32(int(image.Header.DataOffset) + imageSize)
-
-	image.InfoHeader.Width = int32(opts.Width)
+	cropped := &BMPImage{Header: image.Header, InfoHeader: image.InfoHeader, Data: croppedData, Alpha: croppedAlpha, Wide: croppedWide, HeaderExtra: image.HeaderExtra, ICCProfile: image.ICCProfile, Comments: image.Comments}
+	cropped.InfoHeader.Width = int32(opts.Width)
 	// Maintain the original orientation (negative height for top-down, positive for bottom-up)
-	if isTopDown {
-		image.InfoHeader.Height = int32(-opts.Height)
+	if image.InfoHeader.Height < 0 {
+		cropped.InfoHeader.Height = int32(-opts.Height)
 	} else {
-		image.InfoHeader.Height = int32(opts.Height)
+		cropped.InfoHeader.Height = int32(opts.Height)
 	}
-	image.InfoHeader.ImageSize = uint32(imageSize)
 
-	return nil
+	// Update the image and file sizes in the headers
+	cropped.updateSizes()
+
+	return cropped
 }
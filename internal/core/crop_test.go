@@ -0,0 +1,126 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCropRanges(t *testing.T) {
+	tests := []struct {
+		value         string
+		width, height int // Size of the result
+		x0, y0        int // Source position of its top-left pixel
+	}{
+		{"rows:10-20", 30, 10, 0, 10},
+		{"rows:0-1", 30, 1, 0, 0},
+		{"rows:0-25", 30, 25, 0, 0},
+		{"rows:24-25", 30, 1, 0, 24},
+		{"cols:5-8", 3, 25, 5, 0},
+		{"cols:29-30", 1, 25, 29, 0},
+		{"cols:0-30", 30, 25, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			opts, err := parseCropInfo(tt.value)
+			if err != nil {
+				t.Fatalf("parseCropInfo: %v", err)
+			}
+			if got := opts.String(); got != "crop "+tt.value {
+				t.Errorf("described as %q", got)
+			}
+
+			source := noiseImage(30, 25, 1)
+			image := source.Clone()
+			if err := Crop(image, opts); err != nil {
+				t.Fatalf("Crop: %v", err)
+			}
+			checkShape(t, image, tt.width, tt.height)
+
+			// The first and last rows kept are the ones the range names
+			src, got := visualRows(source), visualRows(image)
+			for _, y := range []int{0, tt.height - 1} {
+				want := src[tt.y0+y][tt.x0 : tt.x0+tt.width]
+				if !gridsEqual([][]Pixel{got[y]}, [][]Pixel{want}) {
+					t.Errorf("row %d doesn't match row %d of the source", y, tt.y0+y)
+				}
+			}
+		})
+	}
+}
+
+func TestCropRangeErrors(t *testing.T) {
+	for _, value := range []string{"rows:10-10", "rows:20-10", "rows:-1-5", "rows:5", "cols:a-b", "cols:1-2-3"} {
+		t.Run(value, func(t *testing.T) {
+			if _, err := parseCropInfo(value); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+
+	// Ranges past the image are only known to be invalid once its size is
+	for _, value := range []string{"rows:20-26", "rows:25-30", "cols:0-31", "cols:30-31"} {
+		t.Run(value, func(t *testing.T) {
+			opts, err := parseCropInfo(value)
+			if err != nil {
+				t.Fatalf("parseCropInfo: %v", err)
+			}
+			if err := opts.Validate(30, 25); !errors.Is(err, ErrOutOfBounds) {
+				t.Errorf("got error %v, want ErrOutOfBounds", err)
+			}
+		})
+	}
+}
+
+// TestCropNamedRegions checks the regions of an image whose sides are odd,
+// which can't be halved: top, left and center round down and bottom and
+// right round up, so that opposite regions split the image exactly.
+func TestCropNamedRegions(t *testing.T) {
+	const size = 101
+	tests := []struct {
+		value         string
+		width, height int // Size of the result
+		x0, y0        int // Source position of its top-left pixel
+	}{
+		{"top", 101, 50, 0, 0},
+		{"bottom", 101, 51, 0, 50},
+		{"left", 50, 101, 0, 0},
+		{"right", 51, 101, 50, 0},
+		{"center", 50, 50, 25, 25},
+		{"top:0.3", 101, 30, 0, 0},
+		{"bottom:0.7", 101, 71, 0, 30},
+		{"left:0.7", 70, 101, 0, 0},
+		{"right:0.3", 31, 101, 70, 0},
+	}
+
+	source := noiseImage(size, size, 1)
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			opts, err := parseCropInfo(tt.value)
+			if err != nil {
+				t.Fatalf("parseCropInfo: %v", err)
+			}
+			image := source.Clone()
+			if err := Crop(image, opts); err != nil {
+				t.Fatalf("Crop: %v", err)
+			}
+			checkShape(t, image, tt.width, tt.height)
+			for y := range tt.height {
+				for x := range tt.width {
+					if got, want := image.At(x, y), source.At(tt.x0+x, tt.y0+y); got != want {
+						t.Fatalf("pixel (%d, %d) is %v, want %v from (%d, %d) of the source", x, y, got, want, tt.x0+x, tt.y0+y)
+					}
+				}
+			}
+		})
+	}
+}
+
+// visualRows returns the rows of image from the top.
+func visualRows(image *BMPImage) [][]Pixel {
+	var rows [][]Pixel
+	for _, row := range image.Rows() {
+		rows = append(rows, row)
+	}
+	return rows
+}
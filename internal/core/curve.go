@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// curvePoint is a control point of a tone curve: input value X maps to Y.
+type curvePoint struct {
+	X, Y float64
+}
+
+// Curve is a tone curve through a set of control points, interpolated with a
+// monotone cubic (Fritsch-Carlson) spline. Between two points the curve never
+// overshoots them, so a curve through increasing points is itself increasing.
+type Curve struct {
+	points []curvePoint
+	slopes []float64 // tangent at every point
+}
+
+// NewCurve builds a curve through the given (input, output) pairs, which must be
+// sorted by strictly increasing input. Points at 0 and 255 are added as 0/0 and
+// 255/255 when missing, so the curve always covers the whole channel range.
+func NewCurve(xs, ys []byte) (*Curve, error) {
+	if len(xs) != len(ys) {
+		return nil, fmt.Errorf("curve needs as many outputs as inputs")
+	}
+
+	var points []curvePoint
+	if len(xs) == 0 || xs[0] != 0 {
+		points = append(points, curvePoint{0, 0})
+	}
+	for i := range xs {
+		if i > 0 && xs[i] <= xs[i-1] {
+			return nil, fmt.Errorf("curve points must be sorted by increasing input: %d after %d", xs[i], xs[i-1])
+		}
+		points = append(points, curvePoint{float64(xs[i]), float64(ys[i])})
+	}
+	if xs := len(points); points[xs-1].X != 255 {
+		points = append(points, curvePoint{255, 255})
+	}
+
+	n := len(points)
+	deltas := make([]float64, n-1)
+	for i := range deltas {
+		deltas[i] = (points[i+1].Y - points[i].Y) / (points[i+1].X - points[i].X)
+	}
+
+	// Start from the average of the neighboring secant slopes, flattening
+	// the tangent at local extrema, then limit the tangents so that no
+	// segment overshoots (Fritsch-Carlson).
+	slopes := make([]float64, n)
+	slopes[0], slopes[n-1] = deltas[0], deltas[n-2]
+	for i := 1; i < n-1; i++ {
+		if deltas[i-1]*deltas[i] > 0 {
+			slopes[i] = (deltas[i-1] + deltas[i]) / 2
+		}
+	}
+	for i, d := range deltas {
+		if d == 0 {
+			slopes[i], slopes[i+1] = 0, 0
+			continue
+		}
+		a, b := slopes[i]/d, slopes[i+1]/d
+		if s := a*a + b*b; s > 9 {
+			t := 3 / math.Sqrt(s)
+			slopes[i], slopes[i+1] = t*a*d, t*b*d
+		}
+	}
+
+	return &Curve{points: points, slopes: slopes}, nil
+}
+
+// At evaluates the curve at x, in [0, 255]. The result is not rounded.
+func (c *Curve) At(x float64) float64 {
+	i := 0
+	for i < len(c.points)-2 && x > c.points[i+1].X {
+		i++
+	}
+	p0, p1 := c.points[i], c.points[i+1]
+
+	// Cubic Hermite basis on the segment [p0.X, p1.X].
+	h := p1.X - p0.X
+	t := (x - p0.X) / h
+	t2, t3 := t*t, t*t*t
+	return (2*t3-3*t2+1)*p0.Y + (t3-2*t2+t)*h*c.slopes[i] + (-2*t3+3*t2)*p1.Y + (t3-t2)*h*c.slopes[i+1]
+}
+
+// LUT compiles the curve into a lookup table, rounding every output to the
+// nearest channel value.
+func (c *Curve) LUT() [256]byte {
+	var lut [256]byte
+	for v := range lut {
+		lut[v] = unitToByte(c.At(float64(v)) / 255)
+	}
+	return lut
+}
+
+// ApplyCurve maps the selected channel of every pixel through the curve.
+// channel is "red", "green", "blue" or "rgb" for all three.
+// Rows are processed in parallel.
+func ApplyCurve(image *BMPImage, channel string, c *Curve) {
+	lut := c.LUT()
+	ForRange(len(image.Data), 0, func(start, end int) {
+		for _, row := range image.Data[start:end] {
+			for x := range row {
+				p := &row[x]
+				switch channel {
+				case "red":
+					p.Red = lut[p.Red]
+				case "green":
+					p.Green = lut[p.Green]
+				case "blue":
+					p.Blue = lut[p.Blue]
+				default:
+					p.Blue, p.Green, p.Red = lut[p.Blue], lut[p.Green], lut[p.Red]
+				}
+			}
+		}
+	})
+}
+
+// curveChannels are the channels a curve can apply to; rgb is all three.
+var curveChannels = []string{"red", "green", "blue", "rgb"}
+
+// parseCurveArgs parses the parameters of the curve filter: a channel and a
+// comma-separated list of in/out control points, as in curve:rgb:0/0,128/90,255/255.
+func parseCurveArgs(args []string) (string, *Curve, error) {
+	if len(args) != 2 {
+		return "", nil, fmt.Errorf("curve filter requires a channel and points: curve:<channel>:<in>/<out>,...")
+	}
+
+	channel := args[0]
+	if !slices.Contains(curveChannels, channel) {
+		return "", nil, fmt.Errorf("invalid curve channel: %s (must be red, green, blue or rgb)", channel)
+	}
+
+	var xs, ys []byte
+	for _, point := range strings.Split(args[1], ",") {
+		in, out, ok := strings.Cut(point, "/")
+		x, errX := strconv.Atoi(in)
+		y, errY := strconv.Atoi(out)
+		if !ok || errX != nil || errY != nil || x < 0 || x > 255 || y < 0 || y > 255 {
+			return "", nil, fmt.Errorf("invalid curve point: %s (expected <in>/<out> within 0-255)", point)
+		}
+		xs = append(xs, byte(x))
+		ys = append(ys, byte(y))
+	}
+
+	c, err := NewCurve(xs, ys)
+	if err != nil {
+		return "", nil, err
+	}
+	return channel, c, nil
+}
@@ -0,0 +1,54 @@
+package core
+
+import "testing"
+
+// curveFilter parses and runs the curve filter with the given parameters.
+func curveFilter(t *testing.T, image *BMPImage, params string) {
+	t.Helper()
+	opts, err := parseFilterOptions("curve:" + params)
+	if err != nil {
+		t.Fatalf("curve:%s rejected: %v", params, err)
+	}
+	if err := Filter(image, opts); err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+}
+
+func TestCurveIdentity(t *testing.T) {
+	for _, params := range []string{"rgb:0/0,255/255", "rgb:128/128", "green:64/64,192/192", "blue:0/0,1/1,254/254,255/255"} {
+		image := noiseImage(16, 16, 1)
+		want := image.Clone()
+		curveFilter(t, image, params)
+		if x, y, same := firstDifference(image, want); !same {
+			t.Errorf("curve:%s changed pixel (%d, %d) from %v to %v", params, x, y, want.At(x, y), image.At(x, y))
+		}
+	}
+}
+
+func TestCurveMidpoint(t *testing.T) {
+	levels := make([]int, 256)
+	for v := range levels {
+		levels[v] = v
+	}
+	image := grayRow(levels...)
+	curveFilter(t, image, "red:128/200")
+
+	lut := make([]int, 256)
+	for v, p := range image.Data[0] {
+		lut[v] = int(p.Red)
+		if p.Green != byte(v) || p.Blue != byte(v) {
+			t.Fatalf("level %d of the other channels became %v", v, p)
+		}
+	}
+	for v, want := range map[int]int{0: 0, 128: 200, 255: 255} {
+		if lut[v] != want {
+			t.Errorf("%d maps to %d, want %d", v, lut[v], want)
+		}
+	}
+	// The spline through increasing points never goes back down
+	for v := 1; v < 256; v++ {
+		if lut[v] < lut[v-1] {
+			t.Fatalf("%d maps to %d, below %d for %d", v, lut[v], lut[v-1], v-1)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package core
+
+import "slices"
+
+// parallelFilters are the filters that split their work over Workers with
+// ForRange. Every filter listed here must produce the same output whatever
+// the number of workers, which the determinism tests verify. Filters whose
+// result depends on the order pixels are processed in, such as error
+// diffusion dithering, must stay serial: they are left out of this list
+// and must not call ForRange.
+var parallelFilters = []string{
+	"blue", "green", "red", "grayscale", "negative", "pixelate", "blur",
+	"levels", "autocontrast", "gamma", "curve", "kuwahara",
+	"erode", "dilate", "open", "close",
+}
+
+// IsParallel reports whether t runs on more than one goroutine.
+func IsParallel(t Transform) bool {
+	opts, ok := t.Options.(FilterOptions)
+	return ok && t.Type == FilterTransform && slices.Contains(parallelFilters, opts.FilterType)
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// RunDeterminismCheck applies tr to copies of the same random image with
+// Workers set to 1, 4 and GOMAXPROCS, at 8-bit and at 16-bit precision, and
+// fails the test if the results differ in any pixel, alpha or 16-bit value.
+// Transformations that are not parallel (see IsParallel) are skipped.
+// Workers is restored when the test ends.
+func RunDeterminismCheck(t *testing.T, tr Transform) {
+	t.Helper()
+	if !IsParallel(tr) {
+		t.Skipf("%v is serial", tr.Options)
+	}
+
+	saved := Workers
+	t.Cleanup(func() { Workers = saved })
+
+	for _, wide := range []bool{false, true} {
+		image := withAlpha(noiseImage(97, 61, 1))
+		if wide {
+			image.Widen()
+		}
+
+		var want *BMPImage
+		for _, workers := range []int{1, 4, runtime.GOMAXPROCS(0)} {
+			Workers = workers
+			got := image.Clone()
+			if err := ApplyTransformations(got, []Transform{tr}); err != nil {
+				t.Fatalf("%v: %v", tr.Options, err)
+			}
+
+			if want == nil {
+				want = got
+				continue
+			}
+			if !gridsEqual(got.Data, want.Data) || !gridsEqual(got.Alpha, want.Alpha) || !gridsEqual(got.Wide, want.Wide) {
+				t.Errorf("%v (16-bit %t): output with %d workers differs from output with 1 worker", tr.Options, wide, workers)
+			}
+		}
+	}
+}
+
+// determinismFilters are filter values covering every path of the parallel
+// filters, including their channel modes and edge modes.
+var determinismFilters = []string{
+	"blue", "green", "red",
+	"blue:luma", "green:tint", "red:luma",
+	"grayscale", "negative",
+	"pixelate",
+	"blur", "blur:3:clamp", "blur:7:mirror", "blur:50:wrap",
+	"levels:20:200", "autocontrast", "autocontrast:2",
+	"gamma:2.2", "curve:rgb:0/0,128/90,255/255", "curve:red:64/200",
+	"kuwahara:4",
+	"erode:3", "dilate:1", "open:2", "close:40",
+}
+
+func TestParallelFiltersAreDeterministic(t *testing.T) {
+	for _, value := range determinismFilters {
+		t.Run(value, func(t *testing.T) {
+			opts, err := parseFilterOptions(value)
+			if err != nil {
+				t.Fatalf("parseFilterOptions: %v", err)
+			}
+			if opts.FilterType == "pixelate" {
+				opts.PixelateSize = 7
+			}
+			RunDeterminismCheck(t, Transform{Type: FilterTransform, Options: opts})
+		})
+	}
+}
+
+func TestParallelFiltersAreCovered(t *testing.T) {
+	for _, name := range parallelFilters {
+		if !slices.Contains(FilterNames, name) {
+			t.Errorf("parallel filter %s is not a filter", name)
+		}
+		covered := slices.ContainsFunc(determinismFilters, func(value string) bool {
+			opts, err := parseFilterOptions(value)
+			return err == nil && opts.FilterType == name
+		})
+		if !covered {
+			t.Errorf("parallel filter %s has no determinism check", name)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	xbmp "golang.org/x/image/bmp"
+)
+
+// The differential tests check ParseBMP and the BMP encoders against
+// golang.org/x/image/bmp, an independent implementation: files both accept
+// must decode to the same pixels, and every file written must be read back
+// by x/image/bmp as written. The fixtures in testdata/differential are the
+// files the two are known to treat differently or that once revealed a bug;
+// inputs found by fuzzing land in testdata/fuzz and are replayed by go test.
+
+// Outcomes of decoding a fixture with ParseBMP and with x/image/bmp.
+const (
+	bothAgree     = "agree"           // Both decode it to the same pixels
+	onlyOurs      = "only ours"       // ParseBMP decodes it, x/image/bmp refuses it
+	onlyTheirs    = "only theirs"     // x/image/bmp decodes it, ParseBMP refuses it
+	pixelsDiffer  = "pixels differ"   // Both decode it, to different pixels
+	noneDecodesIt = "none decodes it" // Both refuse it
+)
+
+// differentialFixtures lists the files of testdata/differential with the
+// outcome expected of them, and why when they don't agree.
+var differentialFixtures = []struct {
+	name    string
+	outcome string
+	why     string
+}{
+	{"width1.bmp", bothAgree, ""},
+	{"width3.bmp", bothAgree, ""},
+	{"width5.bmp", bothAgree, ""},
+	{"width7-top-down.bmp", bothAgree, ""},
+	{"v4-header.bmp", bothAgree, ""},
+	{"v5-profile.bmp", bothAgree, ""},
+	{"image-size-rounded-up.bmp", bothAgree, ""},
+	{"comments.bmp", bothAgree, ""},
+	{"stamped.bmp", bothAgree, ""},
+	{"image-size-zero.bmp", bothAgree, ""},
+	{"image-size-zero-trailing.bmp", bothAgree, ""},
+	{"file-size-mismatch.bmp", bothAgree, ""},
+	{"gap-before-pixels.bmp", onlyOurs, "x/image/bmp requires the pixels right after the headers"},
+	{"v3-header.bmp", onlyOurs, "x/image/bmp only reads 40, 108 and 124-byte DIB headers"},
+	{"stride-8.bmp", pixelsDiffer, "ParseBMP takes an ImageSize of whole rows of a wider stride as the alignment of the rows, x/image/bmp always reads rows padded to 4 bytes"},
+}
+
+// decodeTheirs decodes data with x/image/bmp.
+func decodeTheirs(data []byte) (image.Image, error) {
+	return xbmp.Decode(bytes.NewReader(data))
+}
+
+// firstDivergence returns the first pixel, in visual order, where got, as
+// decoded by x/image/bmp, differs from want, and whether they match. The
+// alpha channel is compared only if withAlpha is set.
+func firstDivergence(want *BMPImage, got image.Image, withAlpha bool) (string, bool) {
+	width, height := int(want.InfoHeader.Width), len(want.Data)
+	if b := got.Bounds(); b.Dx() != width || b.Dy() != height {
+		return fmt.Sprintf("%dx%d, want %dx%d", b.Dx(), b.Dy(), width, height), false
+	}
+	for y, row := range want.Rows() {
+		for x, p := range row {
+			c := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+			a := byte(255)
+			if withAlpha && want.Alpha != nil {
+				a = want.Alpha[y][x]
+			}
+			if !withAlpha {
+				c.A = 255
+			}
+			if c != (color.NRGBA{R: p.Red, G: p.Green, B: p.Blue, A: a}) {
+				return fmt.Sprintf("(%d, %d) = %v, want %v with alpha %d", x, y, c, p, a), false
+			}
+		}
+	}
+	return "", true
+}
+
+// differentialOutcome returns the outcome of decoding data with both
+// decoders, and the divergence if the pixels differ.
+func differentialOutcome(data []byte) (string, string) {
+	ours, errOurs := ParseBMP(data)
+	theirs, errTheirs := decodeTheirs(data)
+	switch {
+	case errOurs != nil && errTheirs != nil:
+		return noneDecodesIt, ""
+	case errOurs != nil:
+		return onlyTheirs, ""
+	case errTheirs != nil:
+		return onlyOurs, ""
+	}
+	if where, ok := firstDivergence(ours, theirs, false); !ok {
+		return pixelsDiffer, where
+	}
+	return bothAgree, ""
+}
+
+func TestDifferentialFixtures(t *testing.T) {
+	for _, f := range differentialFixtures {
+		t.Run(f.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "differential", f.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outcome, where := differentialOutcome(data); outcome != f.outcome {
+				t.Errorf("%s %s, want %s (%s)", outcome, where, f.outcome, f.why)
+			}
+			// Whatever ParseBMP reads, it writes in a form x/image/bmp reads back
+			if image, err := ParseBMP(data); err == nil {
+				checkTheirsReadsOurs(t, image)
+			}
+		})
+	}
+
+	// Every fixture is listed, with what is expected of it
+	entries, err := os.ReadDir(filepath.Join("testdata", "differential"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !slices.ContainsFunc(differentialFixtures, func(f struct{ name, outcome, why string }) bool { return f.name == e.Name() }) {
+			t.Errorf("testdata/differential/%s has no expected outcome", e.Name())
+		}
+	}
+}
+
+// checkTheirsReadsOurs fails unless the BMP formats image can be written in
+// are read back by x/image/bmp as the pixels written.
+func checkTheirsReadsOurs(t *testing.T, image *BMPImage) {
+	t.Helper()
+	formats := []string{FormatBMP24, FormatBMP32}
+	if isGrayscale(image.narrowed()) {
+		formats = append(formats, FormatGray8)
+	}
+	for _, format := range formats {
+		opts := SaveOptions{Format: format}
+		var buf bytes.Buffer
+		if err := Encode(&buf, image, opts); err != nil {
+			t.Fatalf("%s: Encode: %v", format, err)
+		}
+		theirs, err := decodeTheirs(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: x/image/bmp rejects our output: %v", format, err)
+		}
+		// The pixels as they are written: quantized, and flattened unless alpha is kept
+		want := opts.prepare(image, format == FormatBMP32)
+		if where, ok := firstDivergence(want, theirs, format == FormatBMP32); !ok {
+			t.Fatalf("%s: x/image/bmp reads our output differently: %s", format, where)
+		}
+	}
+}
+
+// FuzzDifferentialDecode feeds arbitrary files to both decoders, which must
+// agree on the pixels of the 24-bit files they both decode. Files of other
+// bit depths, and those whose rows ParseBMP reads with a stride wider than
+// 4-byte alignment, are outside what the two have in common.
+func FuzzDifferentialDecode(f *testing.F) {
+	for _, fixture := range differentialFixtures {
+		if data, err := os.ReadFile(filepath.Join("testdata", "differential", fixture.name)); err == nil {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ours, err := ParseBMP(data)
+		if err != nil || ours.InfoHeader.BitsPerPixel != 24 || pixelStride(ours) != rowStride(int(ours.InfoHeader.Width), 24) {
+			return
+		}
+		theirs, err := decodeTheirs(data)
+		if err != nil {
+			return
+		}
+		if where, ok := firstDivergence(ours, theirs, false); !ok {
+			t.Errorf("the decoders disagree: %s", where)
+		}
+	})
+}
+
+// FuzzDifferentialEncode writes images of fuzzed sizes, row orders, alpha and
+// headers in every BMP format, which x/image/bmp must read back as written.
+func FuzzDifferentialEncode(f *testing.F) {
+	f.Add(uint8(1), uint8(1), int64(1), uint8(0))
+	f.Add(uint8(3), uint8(2), int64(2), uint8(1))
+	f.Add(uint8(5), uint8(7), int64(3), uint8(2|4))
+	f.Add(uint8(7), uint8(3), int64(4), uint8(1|2|8))
+	f.Fuzz(func(t *testing.T, width, height uint8, seed int64, flags uint8) {
+		w, h := int(width%64)+1, int(height%64)+1
+		image := noiseImage(w, h, seed)
+		if flags&1 != 0 {
+			image = topDown(image)
+		}
+		if flags&2 != 0 {
+			image = withAlpha(image)
+		}
+		if flags&4 != 0 {
+			image.Widen()
+		}
+		if flags&8 != 0 {
+			// A V5 header with an embedded profile, as read from a file
+			parsed, err := ParseBMP(v5File(t, image.narrowed(), []byte("profile")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed.Alpha = image.Alpha
+			image = parsed
+		}
+		if flags&16 != 0 {
+			grayscaleImage(image)
+		}
+		checkTheirsReadsOurs(t, image)
+	})
+}
+
+// grayscaleImage makes every pixel of image gray, keeping its green channel.
+func grayscaleImage(image *BMPImage) {
+	image.Narrow()
+	for _, row := range image.Data {
+		for x, p := range row {
+			row[x] = Pixel{Blue: p.Green, Green: p.Green, Red: p.Green}
+		}
+	}
+}
+
+// TestWriteDifferentialFixtures writes the files of testdata/differential.
+// It is kept to document how they were made and to make them again if the
+// encoder changes, when run with BITMAP_WRITE_FIXTURES=1.
+func TestWriteDifferentialFixtures(t *testing.T) {
+	if os.Getenv("BITMAP_WRITE_FIXTURES") == "" {
+		t.Skip("set BITMAP_WRITE_FIXTURES=1 to write testdata/differential")
+	}
+	rng := rand.New(rand.NewSource(1751))
+	noise := func(w, h int) *BMPImage { return noiseImage(w, h, rng.Int63()) }
+	encode := func(image *BMPImage, opts SaveOptions) []byte {
+		var buf bytes.Buffer
+		opts.Format = FormatBMP24
+		if err := Encode(&buf, image, opts); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	setImageSize := func(b []byte, size int) []byte {
+		binary.LittleEndian.PutUint32(b[34:], uint32(size))
+		return b
+	}
+
+	rounded := append(encodeBMP(t, noise(3, 3)), 0, 0)
+	binary.LittleEndian.PutUint32(rounded[2:], uint32(len(rounded)))
+	mismatch := encodeBMP(t, noise(4, 2))
+	binary.LittleEndian.PutUint32(mismatch[2:], uint32(len(mismatch)+100))
+	stride8, err := func() ([]byte, error) {
+		var buf bytes.Buffer
+		err := Encode(&buf, noise(6, 4), SaveOptions{Format: FormatBMP24, Align: 8})
+		return buf.Bytes(), err
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v4 := withDIBHeaderSize(encodeBMP(t, noise(6, 3)), v4HeaderSize, 0)
+	clear(v4[54 : 14+v4HeaderSize])
+
+	files := map[string][]byte{
+		"width1.bmp":                encodeBMP(t, noise(1, 4)),
+		"width3.bmp":                encodeBMP(t, noise(3, 3)),
+		"width5.bmp":                encodeBMP(t, noise(5, 2)),
+		"width7-top-down.bmp":       encodeBMP(t, topDown(noise(7, 3))),
+		"v4-header.bmp":             v4,
+		"v5-profile.bmp":            v5File(t, noise(4, 4), []byte("ICC profile data")),
+		"image-size-rounded-up.bmp": setImageSize(rounded, int(pixelArraySize(3, 3, 24))+2),
+		"comments.bmp":              encode(noise(5, 5), SaveOptions{Comments: []string{"first", "second"}}),
+		"stamped.bmp":               encode(noise(5, 5), SaveOptions{Stamp: &Stamp{Version: StampVersion, Hash: [8]byte{1, 7, 5, 1}}}),
+		"image-size-zero.bmp":       setImageSize(encodeBMP(t, noise(3, 2)), 0),
+		"file-size-mismatch.bmp":    mismatch,
+		"gap-before-pixels.bmp":     withDIBHeaderSize(encodeBMP(t, noise(3, 3)), 40, 8),
+		"v3-header.bmp":             withDIBHeaderSize(encodeBMP(t, noise(3, 3)), 56, 0),
+		"stride-8.bmp":              stride8,
+	}
+	dir := filepath.Join("testdata", "differential")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
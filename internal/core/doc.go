@@ -0,0 +1,13 @@
+// Package core decodes, transforms and encodes the images of the bitmap
+// tool.
+//
+// # Rounding
+//
+// Every filter computes its result at full precision and quantizes it to a
+// channel value once, at the end, by rounding half away from zero and
+// clamping into the range of the channel: clampRound and clampRound16 for
+// values computed in floating point, and divRound for averages of integer
+// sums. The same input thus gives the same output whatever filter or
+// precision it goes through, and no filter biases its results darker by
+// truncating them.
+package core
@@ -0,0 +1,53 @@
+package core
+
+import "github.com/ab-dauletkhan/bitmap/internal/utils"
+
+// SetPixel sets the pixel at (x, y), counted from the visual top-left corner,
+// to color. The pixel is made fully opaque if the image has an alpha channel.
+// Coordinates outside the image are ignored, so shapes can be drawn partly
+// off-canvas.
+func SetPixel(image *BMPImage, x, y int, color Pixel) {
+	if y < 0 || y >= len(image.Data) || x < 0 || x >= len(image.Data[0]) {
+		return
+	}
+
+	image.Data[y][x] = color
+	if image.Alpha != nil {
+		image.Alpha[y][x] = 255
+	}
+	if image.Wide != nil {
+		image.Wide[y][x] = WidenPixel(color)
+	}
+}
+
+// DrawLine draws a 1px line from (x0, y0) to (x1, y1), both ends included,
+// in visual coordinates. It uses Bresenham's algorithm, so every pixel on the
+// line is the one closest to the ideal segment.
+func DrawLine(image *BMPImage, x0, y0, x1, y1 int, color Pixel) {
+	dx := utils.Abs(x1 - x0)
+	dy := -utils.Abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		SetPixel(image, x0, y0, color)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// DryRun validates the pipeline against the dimensions of inFile and prints
+// to w the planned steps with the image size after each one, and the estimated
+// peak memory at the precision of opts. A transformation growing the image
+// past opts.MaxPixels is invalid, as with ApplyTransformationsWith. Only the
+// headers of inFile are read, and nothing is written. A run estimated to exceed opts.MaxMemory fails with
+// ErrMemoryLimit once the plan is printed.
+func DryRun(w io.Writer, transforms []Transform, inFile, outFile string, opts ApplyOptions) error {
+	image, size, format, err := readImageHeader(inFile)
+	if err != nil {
+		return err
+	}
+	if format == InputBMP {
+		if err := validateHeaders(image, int(size)); err != nil {
+			return err
+		}
+	}
+
+	width := int(image.InfoHeader.Width)
+	height := utils.Abs(int(image.InfoHeader.Height))
+	if err := validateTransformations(transforms, width, height, opts.MaxPixels); err != nil {
+		return err
+	}
+
+	memory := EstimateMemory(transforms, width, height, size, PixelBytes(mayHaveAlpha(image, format), opts.Precision))
+	inWidth, inHeight := width, height
+
+	fmt.Fprintf(w, "Input: %s (%dx%d)\n", inFile, width, height)
+	for i, t := range transforms {
+		width, height = t.Options.Dimensions(width, height)
+		fmt.Fprintf(w, "%d. %v -> %dx%d\n", i+1, t.Options, width, height)
+	}
+	save := opts.Save
+	if opts.Stamp {
+		// The size of a stamp doesn't depend on the manifest it is made from
+		save.Stamp = &Stamp{}
+	}
+	save.Format = OutputFormat(outFile, save)
+	fmt.Fprintf(w, "Output: %s (%dx%d, %s)\n", outFile, width, height, save.Format)
+
+	// Only the final dimensions matter for the size of the output.
+	image.InfoHeader.Width = int32(width)
+	image.InfoHeader.Height = int32(height)
+	fmt.Fprintln(w, FormatOutputSize(EncodedSize(image, save)))
+	fmt.Fprintf(w, "Estimated peak memory: %s\n", FormatByteSize(memory))
+
+	if opts.MaxMemory > 0 {
+		return checkMemory(inWidth, inHeight, memory, opts.MaxMemory)
+	}
+	return nil
+}
+
+// FormatOutputSize returns the line reporting an output size computed by
+// EncodedSize, which is not known in advance for compressed formats.
+func FormatOutputSize(size int64) string {
+	if size < 0 {
+		return "Output size: unknown until encoded (compressed format)"
+	}
+	return fmt.Sprintf("Output size: %d bytes", size)
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// DumpOptions holds the flags of the dump command.
+type DumpOptions struct {
+	Row      int  // Visual row to dump, from 0 at the top
+	FirstCol int  // First column to dump
+	LastCol  int  // Last column to dump, inclusive, or -1 for the end of the row
+	RGB      bool // Print the channels in RGB order instead of the stored BGR
+}
+
+// ParseDumpArgs parses the dump command arguments: options and the input file.
+func ParseDumpArgs(args []string) (DumpOptions, string, error) {
+	opts := DumpOptions{Row: -1, LastCol: -1}
+
+	if len(args) < 1 {
+		return opts, "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		switch {
+		case strings.HasPrefix(arg, "--row="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--row="))
+			if err != nil || n < 0 {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid row option: %s", arg))
+			}
+			opts.Row = n
+		case strings.HasPrefix(arg, "--cols="):
+			first, last, ok := strings.Cut(strings.TrimPrefix(arg, "--cols="), "-")
+			var errFirst, errLast error
+			opts.FirstCol, errFirst = strconv.Atoi(first)
+			opts.LastCol, errLast = strconv.Atoi(last)
+			if !ok || errFirst != nil || errLast != nil || opts.FirstCol < 0 || opts.LastCol < opts.FirstCol {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid cols option: %s (expected A-B with A <= B)", arg))
+			}
+		case arg == "--rgb":
+			opts.RGB = true
+		default:
+			return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	if opts.Row < 0 {
+		return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("missing --row option"))
+	}
+
+	return opts, args[len(args)-1], nil
+}
+
+// DumpRow writes the bytes of one row of the BMP file b to w, one pixel per
+// line with its absolute file offset and its channels in hex. The padding at
+// the end of the row is listed after the last column, on its own line. Only
+// the headers are checked, so that files which fail to decode can still be
+// inspected: bytes past the end of the file are shown as --.
+func DumpRow(w io.Writer, b []byte, opts DumpOptions) error {
+	bmp, err := parseHeaders(b)
+	if err != nil {
+		return err
+	}
+	width, height := int(bmp.InfoHeader.Width), utils.Abs(int(bmp.InfoHeader.Height))
+	bpp := int(bmp.InfoHeader.BitsPerPixel)
+	if width <= 0 || height == 0 {
+		return ErrNonPositiveDimensions
+	}
+	if bpp != 24 && bpp != 32 {
+		return withKind(ErrUnsupported, fmt.Errorf("cannot dump %d-bit pixels (only 24 and 32 bits are supported)", bpp))
+	}
+
+	lastCol := opts.LastCol
+	if lastCol < 0 {
+		lastCol = width - 1
+	}
+	if opts.Row >= height {
+		return withKind(ErrOutOfBounds, fmt.Errorf("row %d out of range: the image has %d rows", opts.Row, height))
+	}
+	if lastCol >= width {
+		return withKind(ErrOutOfBounds, fmt.Errorf("columns %d-%d out of range: the image has %d columns", opts.FirstCol, lastCol, width))
+	}
+
+	// Bottom-up images store the last visual row first
+	stored := opts.Row
+	if bmp.InfoHeader.Height > 0 {
+		stored = height - 1 - opts.Row
+	}
+	bytesPerPixel := bpp / 8
+	stride := pixelStride(bmp)
+	start := int(bmp.Header.DataOffset) + stored*stride
+
+	channels := "B  G  R"
+	if opts.RGB {
+		channels = "R  G  B"
+	}
+	if bytesPerPixel == 4 {
+		channels += "  A"
+	}
+
+	fmt.Fprintf(w, "row %d of %d (stored row %d), %d-bit, stride %d bytes (%d padding) at offset 0x%08x\n",
+		opts.Row, height, stored, bpp, stride, stride-width*bytesPerPixel, start)
+	fmt.Fprintf(w, "%-10s  %5s  %s\n", "offset", "x", channels)
+
+	for x := opts.FirstCol; x <= lastCol; x++ {
+		offset := start + x*bytesPerPixel
+		px := make([]string, bytesPerPixel)
+		for i := range px {
+			px[i] = hexByte(b, offset+i)
+		}
+		if opts.RGB {
+			px[0], px[2] = px[2], px[0]
+		}
+		fmt.Fprintf(w, "0x%08x  %5d  %s\n", offset, x, strings.Join(px, " "))
+	}
+
+	// The padding only follows the last column
+	if padding := stride - width*bytesPerPixel; padding > 0 && lastCol == width-1 {
+		offset := start + width*bytesPerPixel
+		pad := make([]string, padding)
+		for i := range pad {
+			pad[i] = hexByte(b, offset+i)
+		}
+		fmt.Fprintf(w, "0x%08x  %5s  %s\n", offset, "pad", strings.Join(pad, " "))
+	}
+	return nil
+}
+
+// hexByte formats b[i] in hex, or -- if it is past the end of b.
+func hexByte(b []byte, i int) string {
+	if i >= len(b) {
+		return "--"
+	}
+	return fmt.Sprintf("%02x", b[i])
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// dumpFixture returns a 3x2 24-bit bottom-up BMP file, whose rows of 9
+// bytes are padded to 12 with the bytes de ad be after the top row.
+func dumpFixture(t *testing.T) []byte {
+	t.Helper()
+	image := NewImage(3, 2)
+	image.Data[0] = []Pixel{{Blue: 1, Green: 2, Red: 3}, {Blue: 4, Green: 5, Red: 6}, {Blue: 7, Green: 8, Red: 9}}
+	image.Data[1] = []Pixel{{Blue: 0xaa, Green: 0xbb, Red: 0xcc}, {}, {Blue: 0xff, Green: 0xff, Red: 0xff}}
+	b := encodeBMP(t, image)
+	copy(b[54+12+9:], []byte{0xde, 0xad, 0xbe})
+	return b
+}
+
+func TestDumpRow(t *testing.T) {
+	tests := []struct {
+		name string
+		opts DumpOptions
+		want string
+	}{
+		{"top row", DumpOptions{Row: 0, LastCol: -1}, "" +
+			"row 0 of 2 (stored row 1), 24-bit, stride 12 bytes (3 padding) at offset 0x00000042\n" +
+			"offset          x  B  G  R\n" +
+			"0x00000042      0  01 02 03\n" +
+			"0x00000045      1  04 05 06\n" +
+			"0x00000048      2  07 08 09\n" +
+			"0x0000004b    pad  de ad be\n"},
+		{"bottom row in RGB", DumpOptions{Row: 1, FirstCol: 0, LastCol: 2, RGB: true}, "" +
+			"row 1 of 2 (stored row 0), 24-bit, stride 12 bytes (3 padding) at offset 0x00000036\n" +
+			"offset          x  R  G  B\n" +
+			"0x00000036      0  cc bb aa\n" +
+			"0x00000039      1  00 00 00\n" +
+			"0x0000003c      2  ff ff ff\n" +
+			"0x0000003f    pad  00 00 00\n"},
+		{"columns without padding", DumpOptions{Row: 0, FirstCol: 1, LastCol: 1}, "" +
+			"row 0 of 2 (stored row 1), 24-bit, stride 12 bytes (3 padding) at offset 0x00000042\n" +
+			"offset          x  B  G  R\n" +
+			"0x00000045      1  04 05 06\n"},
+	}
+	b := dumpFixture(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := DumpRow(&out, b, tt.opts); err != nil {
+				t.Fatalf("DumpRow: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// The bytes of a file cut short show as --
+	var out bytes.Buffer
+	if err := DumpRow(&out, b[:len(b)-2], DumpOptions{Row: 0, FirstCol: 2, LastCol: 2}); err != nil {
+		t.Fatalf("DumpRow of a truncated file: %v", err)
+	}
+	if want := "0x00000048      2  07 08 09\n0x0000004b    pad  de -- --\n"; !bytes.HasSuffix(out.Bytes(), []byte(want)) {
+		t.Errorf("truncated file dumped as\n%s", out.String())
+	}
+}
+
+func TestDumpRowOutOfRange(t *testing.T) {
+	var out bytes.Buffer
+	err := DumpRow(&out, dumpFixture(t), DumpOptions{Row: 2, LastCol: -1})
+	if !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("got error %v, want ErrOutOfBounds", err)
+	}
+	if want := "row 2 out of range: the image has 2 rows"; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %q before failing", out.String())
+	}
+
+	if err := DumpRow(&out, dumpFixture(t), DumpOptions{Row: 0, FirstCol: 1, LastCol: 3}); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("columns past the edge: got error %v, want ErrOutOfBounds", err)
+	}
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// edges are the sides of the image accepted by --chop and --extend.
+var edges = []string{"left", "right", "top", "bottom"}
+
+// ChopOptions stores the edge to delete rows or columns from and how many.
+type ChopOptions struct {
+	Edge  string // left, right, top or bottom
+	Count int
+}
+
+// Validate rejects chops that would leave no rows or columns.
+func (o ChopOptions) Validate(width, height int) error {
+	if size := edgeSize(o.Edge, width, height); o.Count >= size {
+		return withKind(ErrOutOfBounds, fmt.Errorf("cannot chop %d pixels from the %s of an image %d pixels across", o.Count, o.Edge, size))
+	}
+	return nil
+}
+
+func (o ChopOptions) Dimensions(width, height int) (int, int) {
+	return resizeEdge(o.Edge, width, height, -o.Count)
+}
+
+// MemoryMultiplier is 1 since the remaining rows are resliced, not copied.
+func (o ChopOptions) MemoryMultiplier() int { return 1 }
+
+func (o ChopOptions) String() string { return fmt.Sprintf("chop %s:%d", o.Edge, o.Count) }
+
+// ExtendOptions stores the edge to grow the image at and by how many pixels.
+// The only mode is "edge", which repeats the outermost row or column.
+type ExtendOptions struct {
+	Mode  string
+	Edge  string // left, right, top or bottom
+	Count int
+}
+
+// Validate rejects extensions past the largest dimension a BMP header can hold.
+func (o ExtendOptions) Validate(width, height int) error {
+	if size := edgeSize(o.Edge, width, height); o.Count > math.MaxInt32-size {
+		return withKind(ErrOutOfBounds, fmt.Errorf("cannot extend an image %d pixels across by %d pixels", size, o.Count))
+	}
+	return nil
+}
+
+func (o ExtendOptions) Dimensions(width, height int) (int, int) {
+	return resizeEdge(o.Edge, width, height, o.Count)
+}
+
+// MemoryMultiplier is 2 since every row grown at its ends is copied.
+func (o ExtendOptions) MemoryMultiplier() int { return 2 }
+
+func (o ExtendOptions) String() string {
+	return fmt.Sprintf("extend %s:%s:%d", o.Mode, o.Edge, o.Count)
+}
+
+// edgeSize returns the dimension of the image that changes when rows or
+// columns are added to or removed from edge.
+func edgeSize(edge string, width, height int) int {
+	if edge == "left" || edge == "right" {
+		return width
+	}
+	return height
+}
+
+// resizeEdge returns the dimensions of the image after delta columns or rows
+// are added at edge.
+func resizeEdge(edge string, width, height, delta int) (int, int) {
+	if edge == "left" || edge == "right" {
+		return width + delta, height
+	}
+	return width, height + delta
+}
+
+// parseChopOptions parses a chop value of the form <edge>:<N>.
+func parseChopOptions(value string) (ChopOptions, error) {
+	edge, count, err := parseEdgeCount(strings.Split(value, ":"))
+	if err != nil {
+		return ChopOptions{}, fmt.Errorf("invalid chop option: %s: %w", value, err)
+	}
+	return ChopOptions{Edge: edge, Count: count}, nil
+}
+
+// parseExtendOptions parses an extend value of the form <edge>:<N>, like a
+// chop value. The older edge:<edge>:<N>, naming the only mode, is accepted
+// too.
+func parseExtendOptions(value string) (ExtendOptions, error) {
+	edge, count, err := parseEdgeCount(strings.Split(strings.TrimPrefix(value, "edge:"), ":"))
+	if err != nil {
+		return ExtendOptions{}, fmt.Errorf("invalid extend option: %s: %w", value, err)
+	}
+	return ExtendOptions{Mode: "edge", Edge: edge, Count: count}, nil
+}
+
+// parseEdgeCount parses the <edge>:<N> part shared by chop and extend.
+func parseEdgeCount(args []string) (string, int, error) {
+	if len(args) != 2 {
+		return "", 0, fmt.Errorf("expected <edge>:<N>")
+	}
+	if !slices.Contains(edges, args[0]) {
+		return "", 0, fmt.Errorf("edge must be left, right, top or bottom")
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count < 1 {
+		return "", 0, fmt.Errorf("count must be a positive integer")
+	}
+	return args[0], count, nil
+}
+
+// Chop deletes Count rows or columns from the given visual edge of the image.
+// The remaining pixels are left exactly as they are.
+func Chop(image *BMPImage, opts ChopOptions) error {
+	if err := opts.Validate(int(image.InfoHeader.Width), len(image.Data)); err != nil {
+		return err
+	}
+
+	image.Data = chopGrid(image.Data, opts.Edge, opts.Count)
+	if image.Alpha != nil {
+		image.Alpha = chopGrid(image.Alpha, opts.Edge, opts.Count)
+	}
+	if image.Wide != nil {
+		image.Wide = chopGrid(image.Wide, opts.Edge, opts.Count)
+	}
+	resizeHeaders(image)
+	return nil
+}
+
+// Extend grows the image by Count rows or columns at the given visual edge,
+// each an exact copy of the row or column at that edge.
+func Extend(image *BMPImage, opts ExtendOptions) error {
+	if err := opts.Validate(int(image.InfoHeader.Width), len(image.Data)); err != nil {
+		return err
+	}
+
+	image.Data = extendGrid(image.Data, opts.Edge, opts.Count)
+	if image.Alpha != nil {
+		image.Alpha = extendGrid(image.Alpha, opts.Edge, opts.Count)
+	}
+	if image.Wide != nil {
+		image.Wide = extendGrid(image.Wide, opts.Edge, opts.Count)
+	}
+	resizeHeaders(image)
+	return nil
+}
+
+// chopGrid removes n rows or columns from edge of data, where top is the
+// first row.
+func chopGrid[T any](data [][]T, edge string, n int) [][]T {
+	switch edge {
+	case "top":
+		return data[n:]
+	case "bottom":
+		return data[:len(data)-n]
+	}
+	for y, row := range data {
+		if edge == "left" {
+			data[y] = row[n:]
+		} else {
+			data[y] = row[:len(row)-n]
+		}
+	}
+	return data
+}
+
+// extendGrid repeats the row or column at edge of data n more times, where
+// top is the first row.
+func extendGrid[T any](data [][]T, edge string, n int) [][]T {
+	switch edge {
+	case "top", "bottom":
+		src := data[0]
+		if edge == "bottom" {
+			src = data[len(data)-1]
+		}
+		copies := make([][]T, n)
+		for i := range copies {
+			copies[i] = slices.Clone(src)
+		}
+		if edge == "top" {
+			return append(copies, data...)
+		}
+		return append(data, copies...)
+	}
+
+	for y, row := range data {
+		grown := make([]T, 0, len(row)+n)
+		if edge == "left" {
+			for range n {
+				grown = append(grown, row[0])
+			}
+			grown = append(grown, row...)
+		} else {
+			grown = append(grown, row...)
+			for range n {
+				grown = append(grown, row[len(row)-1])
+			}
+		}
+		data[y] = grown
+	}
+	return data
+}
+
+// resizeHeaders updates the dimensions in the headers to those of Data,
+// keeping the orientation, and recomputes the sizes.
+func resizeHeaders(image *BMPImage) {
+	height := len(image.Data)
+	if image.InfoHeader.Height < 0 {
+		height = -height
+	}
+	image.InfoHeader.Width = int32(len(image.Data[0]))
+	image.InfoHeader.Height = int32(height)
+	image.updateSizes()
+}
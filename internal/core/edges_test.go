@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChopExtendPixels(t *testing.T) {
+	const w, h, n = 7, 5, 3
+	for _, edge := range edges {
+		for _, op := range []string{"chop", "extend"} {
+			t.Run(op+" "+edge, func(t *testing.T) {
+				src := withAlpha(noiseImage(w, h, 7))
+				transforms, _, _, err := ParseTransformations([]string{fmt.Sprintf("--%s=%s:%d", op, edge, n), "in.bmp", "out.bmp"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				image := src.Clone()
+				if err := ApplyTransformations(image, transforms); err != nil {
+					t.Fatal(err)
+				}
+
+				// Both shift the source by n from the left and top edges,
+				// the other way for chop; extend then repeats the pixels
+				// at the edges of the source over the new ones.
+				dx, dy := 0, 0
+				switch edge {
+				case "left":
+					dx = n
+				case "top":
+					dy = n
+				}
+				delta := n
+				if op == "chop" {
+					dx, dy, delta = -dx, -dy, -n
+				}
+				wantW, wantH := resizeEdge(edge, w, h, delta)
+				checkShape(t, image, wantW, wantH)
+				for y := range wantH {
+					for x := range wantW {
+						sx, sy := min(max(x-dx, 0), w-1), min(max(y-dy, 0), h-1)
+						if got, want := image.Data[y][x], src.Data[sy][sx]; got != want {
+							t.Fatalf("pixel (%d,%d) is %v, want %v from (%d,%d)", x, y, got, want, sx, sy)
+						}
+						if got, want := image.Alpha[y][x], src.Alpha[sy][sx]; got != want {
+							t.Fatalf("alpha at (%d,%d) is %d, want %d from (%d,%d)", x, y, got, want, sx, sy)
+						}
+					}
+				}
+
+				// The headers follow the new size: the opaque pixels read
+				// back as they are
+				image.Alpha = nil
+				decoded, err := ParseBMP(encodeBMP(t, image))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !gridsEqual(decoded.Data, image.Data) {
+					t.Error("the result changes once encoded and decoded")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"io"
+)
+
+// EncodingCandidate is one of the BMP encodings --format=auto picks from.
+type EncodingCandidate struct {
+	Format   string // FormatBMP24, FormatBMP8 or FormatRLE8
+	Size     int64  // Size of the file Encode writes in the format, in bytes
+	Lossless bool   // Whether the format keeps every pixel as it is
+}
+
+// EncodingAnalysis holds the statistics of the pixels of an image that
+// decide how large each BMP encoding of it is, and the resulting sizes.
+type EncodingAnalysis struct {
+	Colors     int     // Distinct colors
+	UniqueRows int     // Distinct rows, the others repeating one of them
+	AverageRun float64 // Mean length of the runs of equal pixels along a row
+	Candidates []EncodingCandidate
+	Best       string // Format of the smallest lossless candidate
+}
+
+// AnalyzeEncoding returns the statistics of image as Encode writes it with
+// opts, flattened and at 8 bits per channel, and the size of the file each
+// candidate format gives with the rest of opts. The sizes of bmp24 and bmp8
+// only depend on the dimensions, and that of rle8 on the runs of palette
+// indices of every row, which are counted with the same palette and codes
+// the encoder uses. The palettized formats are only lossless for images of
+// at most 256 colors. Best is the smallest lossless format, bmp24 on a tie,
+// then bmp8.
+func AnalyzeEncoding(image *BMPImage, opts SaveOptions) EncodingAnalysis {
+	image = opts.prepare(image, false)
+
+	var a EncodingAnalysis
+	colors := make(map[Pixel]struct{})
+	rows := make(map[string]struct{})
+	var runs, pixels int
+	key := make([]byte, 0, 3*int(image.InfoHeader.Width))
+	for _, row := range image.Data {
+		key = key[:0]
+		for x, p := range row {
+			colors[p] = struct{}{}
+			if x == 0 || p != row[x-1] {
+				runs++
+			}
+			key = append(key, p.Blue, p.Green, p.Red)
+		}
+		rows[string(key)] = struct{}{}
+		pixels += len(row)
+	}
+	a.Colors, a.UniqueRows = len(colors), len(rows)
+	if runs > 0 {
+		a.AverageRun = float64(pixels) / float64(runs)
+	}
+
+	palette := MedianCut(image, 256)
+	rle := rle8Size(image, cachedIndex(func(p Pixel) byte { return nearestColor(palette, p) }))
+	palettized := a.Colors <= 256
+	for _, c := range []EncodingCandidate{
+		{Format: FormatBMP24, Lossless: true},
+		{Format: FormatBMP8, Lossless: palettized},
+		{Format: FormatRLE8, Size: paletteDataOffset + rle + opts.trailersSize(image), Lossless: palettized},
+	} {
+		if c.Size == 0 {
+			o := opts
+			o.Format = c.Format
+			c.Size = EncodedSize(image, o)
+		}
+		a.Candidates = append(a.Candidates, c)
+	}
+
+	best := a.Candidates[0]
+	for _, c := range a.Candidates[1:] {
+		if c.Lossless && c.Size < best.Size {
+			best = c
+		}
+	}
+	a.Best = best.Format
+	return a
+}
+
+// rle8Size returns the size of the pixel array rle8Data gives for image,
+// without holding it in memory.
+func rle8Size(image *BMPImage, index func(Pixel) byte) int64 {
+	var size int64
+	var codes []byte
+	indices := make([]byte, image.InfoHeader.Width)
+	for _, row := range image.Data {
+		for x, p := range row {
+			indices[x] = index(p)
+		}
+		codes = appendRLE8Row(codes[:0], indices)
+		// Every row ends with an end of line or the end of the bitmap
+		size += int64(len(codes)) + 2
+	}
+	return size
+}
+
+// PrintEncodingAnalysis prints the statistics and candidate sizes of a, in
+// the layout of the header command.
+func PrintEncodingAnalysis(w io.Writer, a EncodingAnalysis) error {
+	if _, err := fmt.Fprintf(w, "Encoding Analysis:\n- Colors: %d\n- UniqueRows: %d\n- AverageRun: %.2f pixels\n", a.Colors, a.UniqueRows, a.AverageRun); err != nil {
+		return err
+	}
+	for _, c := range a.Candidates {
+		note := ""
+		if !c.Lossless {
+			note = " (lossy: more than 256 colors)"
+		}
+		if _, err := fmt.Fprintf(w, "- %s: %d bytes%s\n", c.Format, c.Size, note); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "- Best: %s\n", a.Best)
+	return err
+}
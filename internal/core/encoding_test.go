@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// stripes returns an image of horizontal runs of a few colors, the kind of
+// flat artwork RLE8 compresses well.
+func stripes(width, height int) *BMPImage {
+	colors := []Pixel{{Red: 255}, {Green: 200}, {Blue: 90}, {Red: 10, Green: 10, Blue: 10}}
+	image := NewImage(width, height)
+	for y, row := range image.Rows() {
+		for x := range row {
+			row[x] = colors[(x/7+y/3)%len(colors)]
+		}
+	}
+	return image
+}
+
+// decodeRLE8 decodes the pixel array of an RLE8 file b written by
+// encodeRLE8 into palette indices, by visual row.
+func decodeRLE8(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	width := int(binary.LittleEndian.Uint32(b[18:22]))
+	height := int(int32(binary.LittleEndian.Uint32(b[22:26])))
+	if c := binary.LittleEndian.Uint32(b[30:34]); c != biRLE8 || height <= 0 {
+		t.Fatalf("compression %d, height %d", c, height)
+	}
+	offset := binary.LittleEndian.Uint32(b[10:14])
+	data := b[offset : offset+binary.LittleEndian.Uint32(b[34:38])]
+
+	rows := make([][]byte, height)
+	y := height - 1
+	rows[y] = nil
+	for i := 0; ; i += 2 {
+		switch count, value := data[i], data[i+1]; {
+		case count > 0:
+			rows[y] = append(rows[y], bytes.Repeat([]byte{value}, int(count))...)
+		case value == 0:
+			y--
+		case value == 1:
+			if y != 0 || i+2 != len(data) {
+				t.Fatalf("end of bitmap at row %d, byte %d of %d", y, i, len(data))
+			}
+			for y, row := range rows {
+				if len(row) != width {
+					t.Fatalf("row %d has %d pixels, want %d", y, len(row), width)
+				}
+			}
+			return rows
+		case value == 2:
+			t.Fatal("delta escape")
+		default:
+			rows[y] = append(rows[y], data[i+2:i+2+int(value)]...)
+			i += (int(value) + 1) &^ 1
+		}
+	}
+}
+
+func TestAnalyzeEncodingPredictsSizes(t *testing.T) {
+	tests := []struct {
+		name  string
+		image *BMPImage
+		best  string
+	}{
+		{"stripes", stripes(64, 30), FormatRLE8},
+		{"gray noise", grayNoise(33, 17, 1), FormatBMP8},
+		{"color noise", noiseImage(40, 20, 2), FormatBMP24},
+		{"single pixel", stripes(1, 1), FormatBMP24},
+		{"wide runs", stripes(600, 2), FormatRLE8},
+		{"transparent", withAlpha(stripes(20, 9)), FormatBMP24},
+	}
+	for _, tt := range tests {
+		for _, opts := range []SaveOptions{{}, {Comments: []string{"a comment"}}} {
+			t.Run(fmt.Sprintf("%s_%d_comments", tt.name, len(opts.Comments)), func(t *testing.T) {
+				a := AnalyzeEncoding(tt.image, opts)
+				if a.Best != tt.best {
+					t.Errorf("best %s, want %s (%+v)", a.Best, tt.best, a)
+				}
+				for _, c := range a.Candidates {
+					o := opts
+					o.Format = c.Format
+					var buf bytes.Buffer
+					if err := Encode(&buf, tt.image, o); err != nil {
+						t.Fatalf("Encode %s: %v", c.Format, err)
+					}
+					// Within a hundredth, though the sizes are counted exactly
+					if diff := int64(buf.Len()) - c.Size; diff < -c.Size/100 || diff > c.Size/100 {
+						t.Errorf("%s: predicted %d bytes, Encode wrote %d", c.Format, c.Size, buf.Len())
+					}
+				}
+
+				o := opts
+				o.Format = FormatAuto
+				var auto bytes.Buffer
+				if err := Encode(&auto, tt.image, o); err != nil {
+					t.Fatalf("Encode auto: %v", err)
+				}
+				for _, c := range a.Candidates {
+					if c.Format == a.Best && int64(auto.Len()) != c.Size {
+						t.Errorf("auto wrote %d bytes, want the %d of %s", auto.Len(), c.Size, c.Format)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAnalyzeEncodingStatistics(t *testing.T) {
+	image := NewImage(6, 4)
+	for y, row := range image.Rows() {
+		for x := range row {
+			// Rows 0 and 2 repeat, and every row has runs of 3 pixels
+			row[x] = Pixel{Red: byte(x / 3 * 100), Green: byte(y % 2)}
+		}
+	}
+	a := AnalyzeEncoding(image, SaveOptions{})
+	if a.Colors != 4 || a.UniqueRows != 2 || a.AverageRun != 3 {
+		t.Errorf("colors %d, unique rows %d, average run %g; want 4, 2, 3", a.Colors, a.UniqueRows, a.AverageRun)
+	}
+	for _, c := range a.Candidates {
+		if !c.Lossless {
+			t.Errorf("%s is lossy for 4 colors", c.Format)
+		}
+	}
+
+	if a := AnalyzeEncoding(noiseImage(30, 30, 1), SaveOptions{}); a.Candidates[1].Lossless || a.Candidates[2].Lossless || a.Best != FormatBMP24 {
+		t.Errorf("noise: %+v, want lossy palettized formats", a)
+	}
+}
+
+func TestRLE8RoundTrip(t *testing.T) {
+	for _, image := range []*BMPImage{stripes(64, 30), topDown(grayNoise(33, 17, 3)), stripes(600, 2), stripes(1, 1)} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, image, SaveOptions{Format: FormatRLE8}); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if size := binary.LittleEndian.Uint32(b[2:6]); int(size) != len(b) {
+			t.Errorf("FileSize %d, file of %d bytes", size, len(b))
+		}
+
+		palette := b[54:paletteDataOffset]
+		for y, row := range decodeRLE8(t, b) {
+			for x, i := range row {
+				entry := palette[4*int(i):]
+				got := Pixel{Blue: entry[0], Green: entry[1], Red: entry[2]}
+				if want := image.At(x, y); got != want {
+					t.Fatalf("%dx%d: (%d, %d) = %v, want %v", image.InfoHeader.Width, len(image.Data), x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestAppendRLE8Row(t *testing.T) {
+	tests := []struct {
+		row  []byte
+		want []byte
+	}{
+		{[]byte{5, 5, 5, 5}, []byte{4, 5}},
+		{[]byte{1, 2}, []byte{1, 1, 1, 2}},
+		{[]byte{1, 1, 2}, []byte{2, 1, 1, 2}},
+		{[]byte{1, 2, 3}, []byte{1, 1, 1, 2, 1, 3}},
+		{[]byte{1, 2, 3, 4, 5}, []byte{0, 5, 1, 2, 3, 4, 5, 0}},
+		{[]byte{1, 2, 3, 4, 9, 9, 9}, []byte{0, 4, 1, 2, 3, 4, 3, 9}},
+		{bytes.Repeat([]byte{7}, 300), []byte{255, 7, 45, 7}},
+	}
+	for _, tt := range tests {
+		if got := appendRLE8Row(nil, tt.row); !bytes.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.row, got, tt.want)
+		}
+	}
+}
@@ -6,23 +6,121 @@ import (
 	"os"
 )
 
+// Error kinds. The errors returned by the package wrap one of these where it
+// applies, so callers can tell failures apart with errors.Is whatever the
+// message says:
+//   - ErrInvalidParameter: a command line argument or transformation parameter
+//     is malformed or out of its range; returned by the Parse functions
+//   - ErrOutOfBounds: a transformation doesn't fit the image it is applied to,
+//     such as a crop area past the edges; returned by ValidateTransformations,
+//     ApplyTransformations and the transformations themselves
+//   - ErrUnsupported: the input is malformed or not supported, or the requested
+//     output or mode is not supported; returned by ParseBMP, DecodeImage,
+//     LoadImage, ReadRaw and the commands reading images
+//   - ErrIO: reading or writing a file failed; returned by LoadImage, Save,
+//     SaveBMP, WriteFrames, WriteManifest and tee transformations
+//
+// Every sentinel error below is of one of these kinds, e.g. ErrTruncatedData
+// is an ErrUnsupported and ErrDimensionMismatch an ErrOutOfBounds.
+var (
+	ErrInvalidParameter = errors.New("invalid parameter")
+	ErrOutOfBounds      = errors.New("out of bounds")
+	ErrUnsupported      = errors.New("unsupported")
+	ErrIO               = errors.New("I/O error")
+)
+
 var (
 	// Argument-related errors
-	ErrIncorrectArgument = errors.New("incorrect arguments provided; please check your input")
-	ErrMissingFilename   = errors.New("missing BMP filename; please specify a valid file for the header command")
-	ErrUnknownCmd        = errors.New("unknown command")
+	ErrIncorrectArgument = withKind(ErrInvalidParameter, errors.New("incorrect arguments provided; please check your input"))
+	ErrMissingFilename   = withKind(ErrInvalidParameter, errors.New("missing BMP filename; please specify a valid file for the header command"))
+	ErrUnknownCmd        = withKind(ErrInvalidParameter, errors.New("unknown command"))
 
 	// Error variables for various BMP parsing and validation errors.
-	ErrInvalidBMP             = errors.New("invalid BMP file")
-	ErrInvalidFileType        = errors.New("invalid file type, expected 'BM'")
-	ErrCorruptFile            = errors.New("corrupt BMP file")
-	ErrInvalidHeaderSize      = errors.New("invalid header size")
-	ErrNonPositiveDimensions  = errors.New("non-positive image dimensions")
-	ErrUnsupportedFormat      = errors.New("unsupported BMP format")
-	ErrInvalidImageData       = errors.New("invalid image data")
-	ErrUnsupportedCompression = errors.New("unsupported compression method")
+	ErrInvalidBMP             = withKind(ErrUnsupported, errors.New("invalid BMP file"))
+	ErrInvalidFileType        = withKind(ErrUnsupported, errors.New("invalid file type, expected 'BM'"))
+	ErrCorruptFile            = withKind(ErrUnsupported, errors.New("corrupt BMP file"))
+	ErrInvalidHeaderSize      = withKind(ErrUnsupported, errors.New("invalid header size"))
+	ErrNonPositiveDimensions  = withKind(ErrUnsupported, errors.New("non-positive image dimensions"))
+	ErrUnsupportedFormat      = withKind(ErrUnsupported, errors.New("unsupported BMP format"))
+	ErrInvalidImageData       = withKind(ErrUnsupported, errors.New("invalid image data"))
+	ErrUnsupportedCompression = withKind(ErrUnsupported, errors.New("unsupported compression method"))
+	ErrUnrecognizedFormat     = withKind(ErrUnsupported, errors.New("unrecognized image format"))
+	ErrTruncatedData          = withKind(ErrUnsupported, errors.New("pixel data truncated"))
+	ErrNotStamped             = withKind(ErrUnsupported, errors.New("file has no stamp"))
+	ErrInconsistentImage      = withKind(ErrUnsupported, errors.New("image headers don't match its pixels"))
+
+	// Pipeline errors
+	ErrTiledUnsupported = withKind(ErrUnsupported, errors.New("tiled mode supports only a single blur filter with the shrink edge mode"))
+	ErrTiledAlpha       = withKind(ErrUnsupported, errors.New("tiled mode doesn't support images with an alpha channel"))
+	ErrNotGrayscale     = withKind(ErrUnsupported, errors.New("image is not grayscale; apply --filter=grayscale or use --format=bmp8"))
+	ErrMemoryLimit      = withKind(ErrOutOfBounds, errors.New("memory limit exceeded"))
+	ErrTooLarge         = withKind(ErrOutOfBounds, errors.New("image too large"))
+	ErrPixelLimit       = withKind(ErrTooLarge, errors.New("image over the pixel limit"))
+	ErrEmptyImage       = withKind(ErrOutOfBounds, errors.New("transformation left the image without pixels"))
+
+	// Comparison errors
+	ErrDimensionMismatch = withKind(ErrOutOfBounds, errors.New("image dimensions differ"))
 )
 
+// kindError is an error that also matches an error kind with errors.Is,
+// without changing its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// withKind returns err marked as being of the given kind. A nil err stays nil.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// ioError marks err as an ErrIO unless it already has a kind, as do the
+// encoding errors that can come out of the same calls as write failures.
+func ioError(err error) error {
+	for _, kind := range []error{ErrInvalidParameter, ErrOutOfBounds, ErrUnsupported, ErrIO} {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+	return withKind(ErrIO, err)
+}
+
+// TransformError reports the failure of one transformation of a pipeline,
+// either when it is validated or when it runs. It unwraps to the underlying
+// error, so errors.Is still matches its kind.
+type TransformError struct {
+	Index int    // Position of the transformation in the pipeline, counted from 1
+	Name  string // The transformation as its options describe it, e.g. "crop 0-0-10-10"
+	Err   error
+}
+
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("transform %d (%s): %v", e.Index, e.Name, e.Err)
+}
+
+func (e *TransformError) Unwrap() error { return e.Err }
+
+// TruncatedError reports a BMP file whose headers are sound but whose pixel
+// data ends before the last row. It wraps ErrTruncatedData, so errors.Is
+// tells it apart from a corrupt header, and says how many complete rows
+// SalvageBMP can recover.
+type TruncatedError struct {
+	Present int // Complete rows in the file, counted in file order
+	Total   int // Rows the headers declare
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%v: %d of %d rows present", ErrTruncatedData, e.Present, e.Total)
+}
+
+func (e *TruncatedError) Unwrap() error { return ErrTruncatedData }
+
 const (
 	colorRed   = "\033[1;31m"
 	colorReset = "\033[0m"
@@ -39,6 +137,6 @@ func PrintErrorExit(err error) {
 
 func PrintErrorUsageExit(err error, usage string) {
 	PrintError(err)
-	PrintUsage("header")
+	PrintUsage(usage)
 	os.Exit(1)
 }
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSentinelErrorsHaveKinds(t *testing.T) {
+	tests := []struct {
+		err, kind error
+	}{
+		{ErrIncorrectArgument, ErrInvalidParameter},
+		{ErrMissingFilename, ErrInvalidParameter},
+		{ErrUnknownCmd, ErrInvalidParameter},
+		{ErrInvalidBMP, ErrUnsupported},
+		{ErrInvalidFileType, ErrUnsupported},
+		{ErrCorruptFile, ErrUnsupported},
+		{ErrInvalidHeaderSize, ErrUnsupported},
+		{ErrNonPositiveDimensions, ErrUnsupported},
+		{ErrUnsupportedFormat, ErrUnsupported},
+		{ErrInvalidImageData, ErrUnsupported},
+		{ErrUnsupportedCompression, ErrUnsupported},
+		{ErrUnrecognizedFormat, ErrUnsupported},
+		{ErrTruncatedData, ErrUnsupported},
+		{ErrNotStamped, ErrUnsupported},
+		{ErrTiledUnsupported, ErrUnsupported},
+		{ErrTiledAlpha, ErrUnsupported},
+		{ErrNotGrayscale, ErrUnsupported},
+		{ErrMemoryLimit, ErrOutOfBounds},
+		{ErrTooLarge, ErrOutOfBounds},
+		{ErrDimensionMismatch, ErrOutOfBounds},
+	}
+	kinds := []error{ErrInvalidParameter, ErrOutOfBounds, ErrUnsupported, ErrIO}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			for _, kind := range kinds {
+				if got, want := errors.Is(tt.err, kind), kind == tt.kind; got != want {
+					t.Errorf("errors.Is(err, %v) = %v, want %v", kind, got, want)
+				}
+			}
+			// Tagging with ioError keeps the kind the error already has
+			if errors.Is(ioError(tt.err), ErrIO) {
+				t.Error("ioError tagged the error as ErrIO")
+			}
+		})
+	}
+}
+
+func TestErrorPathsHaveKinds(t *testing.T) {
+	bmp := encodeBMP(t, noiseImage(8, 4, 1))
+	missing := filepath.Join(t.TempDir(), "missing.bmp")
+
+	tests := []struct {
+		name     string
+		run      func() error
+		sentinel error // The sentinel the error wraps, if any
+		kind     error
+	}{
+		{"bad magic", func() error {
+			_, err := ParseBMP(append([]byte("XX"), bmp[2:]...))
+			return err
+		}, nil, ErrUnsupported},
+		{"truncated bmp", func() error {
+			_, err := ParseBMP(bmp[:len(bmp)-10])
+			return err
+		}, ErrTruncatedData, ErrUnsupported},
+		{"unrecognized format", func() error {
+			_, err := DecodeImage([]byte("not an image at all"))
+			return err
+		}, ErrUnrecognizedFormat, ErrUnsupported},
+		{"corrupt png", func() error {
+			_, err := DecodeImage([]byte("\x89PNG\r\n\x1a\nbroken"))
+			return err
+		}, nil, ErrUnsupported},
+		{"corrupt ppm", func() error {
+			_, err := DecodeImage([]byte("P6 8 x 255\n"))
+			return err
+		}, ErrCorruptFile, ErrUnsupported},
+		{"missing file", func() error {
+			_, err := LoadImage(missing)
+			return err
+		}, os.ErrNotExist, ErrIO},
+		{"compare mismatch", func() error {
+			_, err := DiffImages(NewImage(4, 4), NewImage(4, 5), 0)
+			return err
+		}, ErrDimensionMismatch, ErrOutOfBounds},
+		{"bad parameter", func() error {
+			_, _, _, err := ParseTransformations([]string{"--filter=gamma:zero", "in.bmp", "out.bmp"})
+			return err
+		}, nil, ErrInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("got error %v, want kind %v", err, tt.kind)
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("got error %v, want it to wrap %v", err, tt.sentinel)
+			}
+		})
+	}
+}
+
+// TestPNGNamedBMP checks that a PNG file named .bmp is decoded by its
+// content where any format is read, and rejected as the PNG it is where
+// only BMP files are.
+func TestPNGNamedBMP(t *testing.T) {
+	src := noiseImage(5, 3, 1)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, toImage(src)); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "photo.bmp")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := LoadImage(path)
+	if err != nil {
+		t.Fatalf("LoadImage: %v", err)
+	}
+	if x, y, same := firstDifference(image, src); !same {
+		t.Errorf("pixel (%d, %d) decodes as %v, was %v", x, y, image.At(x, y), src.At(x, y))
+	}
+
+	_, err = LoadBMP(path)
+	if !errors.Is(err, ErrInvalidFileType) || !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("LoadBMP: got error %v, want ErrInvalidFileType of kind ErrUnsupported", err)
+	}
+	if want := "invalid file type, expected 'BM': it is a png image"; err.Error() != want {
+		t.Errorf("LoadBMP: got error %q, want %q", err, want)
+	}
+}
+
+func TestApplyTransformationsErrorsUnwrap(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		kind error
+	}{
+		{"crop out of bounds", []string{"--mirror=horizontal", "--crop=20-0-4-4"}, ErrOutOfBounds},
+		{"grow past the limit", []string{"--extend=top:1000000000"}, ErrOutOfBounds},
+		{"tee to a missing directory", []string{"--tee=" + filepath.Join(t.TempDir(), "no", "tee.bmp")}, ErrIO},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transforms, _, _, err := ParseTransformations(append(tt.args, "in.bmp", "out.bmp"))
+			if err != nil {
+				t.Fatalf("ParseTransformations: %v", err)
+			}
+			err = ApplyTransformationsWith(context.Background(), noiseImage(8, 4, 1), transforms, Hooks{}, DefaultMaxPixels)
+
+			var te *TransformError
+			if !errors.As(err, &te) {
+				t.Fatalf("got error %v, want a *TransformError", err)
+			}
+			if te.Index != len(tt.args) {
+				t.Errorf("error names transform %d, want %d", te.Index, len(tt.args))
+			}
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("got error %v, want kind %v", err, tt.kind)
+			}
+		})
+	}
+}
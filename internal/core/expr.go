@@ -0,0 +1,374 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExprOptions stores a per-pixel channel expression as given to --expr, such
+// as "r=(r+g)/2; b=255-b", along with the program it compiles to.
+type ExprOptions struct {
+	Source  string
+	program *exprProgram
+}
+
+func (o ExprOptions) Validate(width, height int) error        { return nil }
+func (o ExprOptions) Dimensions(width, height int) (int, int) { return width, height }
+
+// MemoryMultiplier is 1 since every pixel is replaced in place.
+func (o ExprOptions) MemoryMultiplier() int { return 1 }
+
+func (o ExprOptions) String() string { return "expr " + o.Source }
+
+// parseExprOptions compiles an expression program for --expr.
+func parseExprOptions(value string) (ExprOptions, error) {
+	program, err := compileExpr(value)
+	if err != nil {
+		return ExprOptions{}, err
+	}
+	return ExprOptions{Source: value, program: program}, nil
+}
+
+// The variables an expression can read, in the order of exprEnv.
+var exprVars = []string{"r", "g", "b", "x", "y", "w", "h"}
+
+// exprFuncs are the functions an expression can call, with the least and
+// most arguments they take; -1 means any number.
+var exprFuncs = map[string][2]int{
+	"min":   {2, -1},
+	"max":   {2, -1},
+	"clamp": {3, 3},
+}
+
+// exprEnv holds the values of the variables while a pixel is evaluated,
+// indexed as exprVars.
+type exprEnv [7]float64
+
+// exprNode is a node of a compiled expression.
+type exprNode interface {
+	eval(env *exprEnv) float64
+}
+
+type (
+	exprConst  float64
+	exprVar    int
+	exprNeg    struct{ x exprNode }
+	exprBinary struct {
+		op   byte
+		l, r exprNode
+	}
+	exprCall struct {
+		name string
+		args []exprNode
+	}
+)
+
+func (n exprConst) eval(*exprEnv) float64   { return float64(n) }
+func (n exprVar) eval(env *exprEnv) float64 { return env[n] }
+func (n exprNeg) eval(env *exprEnv) float64 { return -n.x.eval(env) }
+func (n exprBinary) eval(env *exprEnv) float64 {
+	l, r := n.l.eval(env), n.r.eval(env)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	}
+	// Dividing by zero gives 0 rather than an infinity that clamps to white
+	if r == 0 {
+		return 0
+	}
+	return l / r
+}
+
+func (n exprCall) eval(env *exprEnv) float64 {
+	v := n.args[0].eval(env)
+	switch n.name {
+	case "min":
+		for _, a := range n.args[1:] {
+			v = min(v, a.eval(env))
+		}
+	case "max":
+		for _, a := range n.args[1:] {
+			v = max(v, a.eval(env))
+		}
+	case "clamp":
+		v = min(max(v, n.args[1].eval(env)), n.args[2].eval(env))
+	}
+	return v
+}
+
+// exprProgram is a compiled expression: the expression of every channel it
+// assigns, indexed by red, green and blue, nil for channels left as they are.
+type exprProgram struct {
+	channels [3]exprNode
+}
+
+// compileExpr parses src, a list of assignments to the r, g and b channels
+// separated by semicolons. Errors give the 1-based position of the offending
+// character in src.
+func compileExpr(src string) (*exprProgram, error) {
+	p := &exprParser{src: src}
+	program := &exprProgram{}
+	assigned := false
+	for {
+		p.skipSpace()
+		if p.pos == len(src) {
+			break
+		}
+		if p.peek() == ';' {
+			p.pos++
+			continue
+		}
+
+		start := p.pos
+		name := p.ident()
+		channel := strings.Index("rgb", name)
+		if len(name) != 1 || channel < 0 {
+			return nil, p.errorAt(start, "expected r, g or b to assign to")
+		}
+		if program.channels[channel] != nil {
+			return nil, p.errorAt(start, name+" is assigned twice")
+		}
+		p.skipSpace()
+		if p.peek() != '=' {
+			return nil, p.errorAt(p.pos, "expected =")
+		}
+		p.pos++
+
+		node, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		program.channels[channel] = node
+		assigned = true
+
+		p.skipSpace()
+		if p.pos < len(src) && p.peek() != ';' {
+			return nil, p.errorAt(p.pos, "expected ; or the end of the expression")
+		}
+	}
+	if !assigned {
+		return nil, fmt.Errorf("invalid expr %q: no channel is assigned", src)
+	}
+	return program, nil
+}
+
+// exprParser is a recursive descent parser over the source of an expression.
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) errorAt(pos int, msg string) error {
+	return fmt.Errorf("invalid expr %q: %s at position %d", p.src, msg, pos+1)
+}
+
+// peek returns the byte at the current position, or 0 at the end.
+func (p *exprParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// ident consumes a run of lowercase letters and returns it.
+func (p *exprParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// expr parses a sum of terms.
+func (p *exprParser) expr() (exprNode, error) {
+	l, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+}
+
+// term parses a product of factors.
+func (p *exprParser) term() (exprNode, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+}
+
+// unary parses a factor with any number of leading minus signs.
+func (p *exprParser) unary() (exprNode, error) {
+	p.skipSpace()
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNeg{x}, nil
+	}
+	return p.primary()
+}
+
+// primary parses a number, a variable, a function call or a parenthesized
+// expression.
+func (p *exprParser) primary() (exprNode, error) {
+	p.skipSpace()
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorAt(p.pos, "expected )")
+		}
+		p.pos++
+		return x, nil
+
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorAt(start, "invalid number "+p.src[start:p.pos])
+		}
+		return exprConst(v), nil
+
+	case c >= 'a' && c <= 'z':
+		name := p.ident()
+		p.skipSpace()
+		if p.peek() == '(' {
+			return p.call(name, start)
+		}
+		for i, v := range exprVars {
+			if v == name {
+				return exprVar(i), nil
+			}
+		}
+		return nil, p.errorAt(start, "unknown variable "+name)
+
+	case c == 0:
+		return nil, p.errorAt(p.pos, "unexpected end of the expression")
+	}
+	return nil, p.errorAt(start, fmt.Sprintf("unexpected %q", p.peek()))
+}
+
+// call parses the arguments of a call to the function name, which starts at
+// start; the current position is at the opening parenthesis.
+func (p *exprParser) call(name string, start int) (exprNode, error) {
+	arity, ok := exprFuncs[name]
+	if !ok {
+		return nil, p.errorAt(start, "unknown function "+name)
+	}
+	p.pos++
+
+	var args []exprNode
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if p.peek() != ')' {
+			return nil, p.errorAt(p.pos, "expected , or )")
+		}
+		p.pos++
+		break
+	}
+
+	if len(args) < arity[0] || arity[1] >= 0 && len(args) > arity[1] {
+		want := fmt.Sprintf("at least %d", arity[0])
+		if arity[0] == arity[1] {
+			want = strconv.Itoa(arity[0])
+		}
+		return nil, p.errorAt(start, fmt.Sprintf("%s takes %s arguments, not %d", name, want, len(args)))
+	}
+	return exprCall{name: name, args: args}, nil
+}
+
+// Expr evaluates the expression of opts at every pixel of the image and
+// stores the results, rounded and clamped into [0, 255], in the channels it
+// assigns. Every expression reads the channels of the pixel as they were
+// before any of them is assigned, along with its column x and row y from the
+// visual top-left corner and the width w and height h of the image.
+// Division by zero gives 0. Widened images are evaluated on the same scale,
+// with fractional channel values, and keep their 16-bit precision. Alpha is
+// left as it is.
+func Expr(image *BMPImage, opts ExprOptions) {
+	program := opts.program
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+
+	ForRange(height, 0, func(start, end int) {
+		env := exprEnv{5: float64(width), 6: float64(height)}
+		for y := start; y < end; y++ {
+			env[4] = float64(y)
+			for x := range width {
+				env[3] = float64(x)
+				if image.Wide != nil {
+					p := &image.Wide[y][x]
+					env[0], env[1], env[2] = float64(p.Red)/257, float64(p.Green)/257, float64(p.Blue)/257
+					for c, dst := range [3]*uint16{&p.Red, &p.Green, &p.Blue} {
+						if n := program.channels[c]; n != nil {
+							*dst = clampRound16(n.eval(&env) * 257)
+						}
+					}
+					continue
+				}
+
+				p := &image.Data[y][x]
+				env[0], env[1], env[2] = float64(p.Red), float64(p.Green), float64(p.Blue)
+				for c, dst := range [3]*byte{&p.Red, &p.Green, &p.Blue} {
+					if n := program.channels[c]; n != nil {
+						*dst = clampRound(n.eval(&env))
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExprPrecedenceAndFunctions(t *testing.T) {
+	in := Pixel{Red: 10, Green: 20, Blue: 30}
+	tests := []struct {
+		src  string
+		want Pixel
+	}{
+		{"r=r+g*2", Pixel{Red: 50, Green: 20, Blue: 30}},
+		{"r=(r+g)*2", Pixel{Red: 60, Green: 20, Blue: 30}},
+		{"r=b-g-r", Pixel{Red: 0, Green: 20, Blue: 30}},
+		{"r=b/g/3*2", Pixel{Red: 1, Green: 20, Blue: 30}}, // ((30/20)/3)*2 = 1
+		{"r=--r + -g*-1", Pixel{Red: 30, Green: 20, Blue: 30}},
+		{"g=min(r, b, 5)+max(1,2); b=clamp(b, 0, 25)", Pixel{Red: 10, Green: 7, Blue: 25}},
+		// Every channel reads the input pixel, whatever was assigned before
+		{"r=g; g=r ; ", Pixel{Red: 20, Green: 10, Blue: 30}},
+		{"b=r/0", Pixel{Red: 10, Green: 20, Blue: 0}},
+		{"r=0.5+1.99", Pixel{Red: 2, Green: 20, Blue: 30}}, // 2.49 rounds down
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			opts, err := parseExprOptions(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			image := NewImage(1, 1)
+			image.Data[0][0] = in
+			Expr(image, opts)
+			if got := image.At(0, 0); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprClamps(t *testing.T) {
+	opts, err := parseExprOptions("r=r*10; g=g-300; b=127.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := NewImage(2, 1)
+	image.Data[0][0] = Pixel{Red: 100, Green: 100}
+	image.Data[0][1] = Pixel{Red: 3, Green: 255}
+	Expr(image, opts)
+	if got, want := image.At(0, 0), (Pixel{Red: 255, Green: 0, Blue: 128}); got != want {
+		t.Errorf("(0, 0) = %v, want %v", got, want)
+	}
+	if got, want := image.At(1, 0), (Pixel{Red: 30, Green: 0, Blue: 128}); got != want {
+		t.Errorf("(1, 0) = %v, want %v", got, want)
+	}
+}
+
+func TestExprVignette(t *testing.T) {
+	// Darken with the distance from the center, normalized to 1 at the corners
+	const d = "(1 - ((x+0.5-w/2)*(x+0.5-w/2) + (y+0.5-h/2)*(y+0.5-h/2)) / (w*w/4 + h*h/4))"
+	opts, err := parseExprOptions("r=r*" + d + "; g=g*" + d + "; b=b*" + d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, wide := range []bool{false, true} {
+		const w, h = 9, 6
+		image := topDown(NewImage(w, h))
+		for _, row := range image.Rows() {
+			for x := range row {
+				row[x] = Pixel{Red: 200, Green: 200, Blue: 200}
+			}
+		}
+		if wide {
+			image.Widen()
+		}
+		Expr(image, opts)
+		image.Narrow()
+
+		for y, row := range image.Rows() {
+			for x, p := range row {
+				dx, dy := float64(x)+0.5-w/2.0, float64(y)+0.5-h/2.0
+				want := clampRound(200 * (1 - (dx*dx+dy*dy)/(w*w/4.0+h*h/4.0)))
+				if p.Red != want || p.Green != want || p.Blue != want {
+					t.Fatalf("wide %t: (%d, %d) = %v, want %d", wide, x, y, p, want)
+				}
+			}
+		}
+		// The center is brighter than the corners, and left/right symmetric
+		if c, k := image.At(w/2, h/2).Red, image.At(0, 0).Red; c <= k || image.At(0, 0) != image.At(w-1, 0) {
+			t.Errorf("wide %t: center %d, corner %d", wide, c, k)
+		}
+	}
+}
+
+func TestExprWideKeepsPrecision(t *testing.T) {
+	opts, err := parseExprOptions("r=r/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := NewImage(1, 1)
+	image.Widen()
+	image.Wide[0][0].Red = 1001
+	Expr(image, opts)
+	if got, want := image.Wide[0][0].Red, uint16(math.Round(1001.0/2)); got != want {
+		t.Errorf("red = %d, want %d", got, want)
+	}
+}
+
+func TestExprRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		src string
+		pos string // Position reported in the error, if any
+	}{
+		{"", ""},
+		{";;", ""},
+		{"r", "position 2"},
+		{"a=1", "position 1"},
+		{"x=1", "position 1"},
+		{"r=", "position 3"},
+		{"r=(g", "position 5"},
+		{"r=g)", "position 4"},
+		{"r=g+*b", "position 5"},
+		{"r=q", "position 3"},
+		{"r=pow(g, 2)", "position 3"},
+		{"r=min(g)", "position 3"},
+		{"r=clamp(g, 1)", "position 3"},
+		{"r=1.2.3", "position 3"},
+		{"r=g b=1", "position 5"},
+		{"r=1; r=2", "position 6"},
+		{"r=g#", "position 4"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseExprOptions(tt.src)
+		if err == nil {
+			t.Errorf("%q accepted", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.pos) {
+			t.Errorf("%q: %v, want %s", tt.src, err, tt.pos)
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package core
 
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
 const (
 	blue = iota
 	green
@@ -10,36 +17,231 @@ const (
 	blur
 )
 
+const (
+	defaultPixelateSize = 50
+	defaultBlurRadius   = 20
+	defaultBlurEdge     = EdgeShrink
+)
+
+// FilterNames lists the filters parseFilterOptions accepts. Every one of
+// them must have a help topic (see MissingHelpTopics).
+var FilterNames = []string{
+	"blue", "green", "red", "grayscale", "negative", "pixelate", "blur",
+	"levels", "autocontrast", "gamma", "curve", "adaptivethreshold", "localcontrast",
+	"kuwahara", "erode", "dilate", "open", "close",
+}
+
+// filterParams describes the parameters of every filter of FilterNames, in
+// the order parseFilterOptions takes them, for bitmap capabilities. Each
+// schema must match what the filter's parser accepts, which is tested.
+var filterParams = map[string][]ParamSchema{
+	"blue":      {channelModeParam},
+	"green":     {channelModeParam},
+	"red":       {channelModeParam},
+	"grayscale": {},
+	"negative":  {},
+	"pixelate":  {},
+	"blur": {
+		{Name: "radius", Type: ParamInt, Min: bound(1), Default: strconv.Itoa(defaultBlurRadius), Optional: true},
+		{Name: "edge", Type: ParamEnum, Values: edgeModeList(), Default: defaultBlurEdge.String(), Optional: true},
+	},
+	"levels": {
+		{Name: "black", Type: ParamInt, Min: bound(0), Max: bound(255)},
+		{Name: "white", Type: ParamInt, Min: bound(1), Max: bound(255), Summary: "must be above black"},
+	},
+	"autocontrast": {
+		{Name: "clip", Type: ParamFloat, Min: bound(0), Max: bound(50), MaxExclusive: true,
+			Default: strconv.FormatFloat(defaultAutoContrastClip, 'g', -1, 64), Optional: true, Summary: "percentage of pixels ignored at each end"},
+	},
+	"gamma": {
+		{Name: "gamma", Type: ParamFloat, Min: bound(0), MinExclusive: true},
+	},
+	"curve": {
+		{Name: "channel", Type: ParamEnum, Values: curveChannels},
+		{Name: "points", Type: ParamPoints, Summary: "comma-separated <in>/<out> pairs within 0-255"},
+	},
+	"adaptivethreshold": {
+		{Name: "window", Type: ParamInt, Min: bound(1)},
+		{Name: "bias", Type: ParamInt, Min: bound(-255), Max: bound(255), Default: strconv.Itoa(defaultThresholdBias), Optional: true},
+	},
+	"localcontrast": {
+		{Name: "radius", Type: ParamInt, Min: bound(1)},
+		{Name: "amount", Type: ParamFloat, Min: bound(0)},
+	},
+	"kuwahara": {{Name: "radius", Type: ParamInt, Min: bound(1)}},
+	"erode":    {morphRadiusParam},
+	"dilate":   {morphRadiusParam},
+	"open":     {morphRadiusParam},
+	"close":    {morphRadiusParam},
+}
+
+var (
+	channelModeParam = ParamSchema{Name: "mode", Type: ParamEnum, Values: channelModes, Optional: true}
+	morphRadiusParam = ParamSchema{Name: "radius", Type: ParamInt, Min: bound(1)}
+)
+
+// opacityParam is the parameter every filter takes last, as opacity=<value>.
+var opacityParam = ParamSchema{Name: "opacity", Type: ParamInt, Min: bound(0), Max: bound(100), Default: "100", Optional: true}
+
+// parseFilterOptions parses a filter value of the form
+// name[:param...][:opacity=N] and checks that the filter exists and its
+// parameters are valid.
+func parseFilterOptions(value string) (FilterOptions, error) {
+	parts := strings.Split(value, ":")
+	opts := FilterOptions{FilterType: parts[0], Args: parts[1:]}
+
+	// Any filter takes an opacity suffix, which is not one of its own parameters
+	if n := len(opts.Args); n > 0 && strings.HasPrefix(opts.Args[n-1], "opacity=") {
+		opacity, err := strconv.Atoi(strings.TrimPrefix(opts.Args[n-1], "opacity="))
+		if err != nil || opacity < 0 || opacity > 100 {
+			return opts, fmt.Errorf("invalid filter opacity: %s (must be between 0 and 100)", opts.Args[n-1])
+		}
+		opts.Args, opts.Opacity = opts.Args[:n-1], &opacity
+	}
+
+	switch opts.FilterType {
+	case "blue", "red", "green":
+		if len(opts.Args) > 1 || len(opts.Args) == 1 && !slices.Contains(channelModes, opts.Args[0]) {
+			return opts, fmt.Errorf("filter %s takes an optional mode: %s[:luma|:tint]", opts.FilterType, opts.FilterType)
+		}
+	case "blur":
+		if _, _, err := opts.blurArgs(); err != nil {
+			return opts, err
+		}
+	case "grayscale", "negative", "pixelate":
+		if len(opts.Args) > 0 {
+			return opts, fmt.Errorf("filter %s takes no parameters", opts.FilterType)
+		}
+	case "levels":
+		if _, _, err := parseLevelsArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "autocontrast":
+		if _, err := parseAutoContrastArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "gamma":
+		if _, err := parseGammaArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "curve":
+		if _, _, err := parseCurveArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "adaptivethreshold":
+		if _, _, err := parseAdaptiveThresholdArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "localcontrast":
+		if _, _, err := parseLocalContrastArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "kuwahara":
+		if _, err := parseKuwaharaArgs(opts.Args); err != nil {
+			return opts, err
+		}
+	case "erode", "dilate", "open", "close":
+		if _, err := parseMorphologyArgs(opts.FilterType, opts.Args); err != nil {
+			return opts, err
+		}
+	default:
+		f, ok := lookupFilter(opts.FilterType)
+		if !ok {
+			return opts, fmt.Errorf("invalid filter option: %s (must be one of %s)", opts.FilterType, strings.Join(filterNames(), ", "))
+		}
+		if _, err := f.parse(opts.FilterType, opts.Args); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
 // Filter applies a specified filter to the given BMPImage.
-// Supported filters: "blue", "green", "red", "grayscale", "negative", "pixelate", and "blur".
-// The "pixelate" filter uses a default block size of 20 pixels.
-// The "blur" filter applies a blur with a default radius of 50 pixels.
-func Filter(image *BMPImage, filter string) {
-	switch filter {
-	case "blue":
-		applyColor(image, blue)
-	case "green":
-		applyColor(image, green)
-	case "red":
-		applyColor(image, red)
+// Supported filters: "blue", "green", "red" (each optionally with a luma or tint mode), "grayscale", "negative", "pixelate", "blur",
+// "levels", "autocontrast", "gamma", "curve", "adaptivethreshold", "localcontrast", "kuwahara", "erode", "dilate", "open" and "close". The parameters in opts must have been
+// validated by parseFilterOptions.
+// The "pixelate" filter uses blocks of PixelateSize pixels, 50 by default.
+// The "blur" filter applies a blur with the radius given in its Args, else BlurRadius, else 20 pixels,
+// and by default the EdgeShrink edge mode.
+// Widened images are filtered at 16-bit precision. A filter with a Region only
+// changes the pixels in it.
+// Filters added with RegisterFilter are run too, and the error their
+// function returns is returned; the built-in filters can't fail.
+func Filter(image *BMPImage, opts FilterOptions) error {
+	if opts.Region != nil {
+		return filterRegion(image, opts)
+	}
+	if image.Wide != nil {
+		return filterWide(image, opts)
+	}
+
+	switch opts.FilterType {
+	case "blue", "green", "red":
+		channel := map[string]int{"blue": blue, "green": green, "red": red}[opts.FilterType]
+		if len(opts.Args) == 0 {
+			applyColor(image, channel)
+		} else {
+			applyChannelMode(image, channel, opts.Args[0])
+		}
 	case "grayscale":
 		applyColor(image, grayscale)
 	case "negative":
 		applyColor(image, negative)
 	case "pixelate":
-		applyPixelate(image, 50)
+		applyPixelate(image, opts.pixelateSize(int(image.InfoHeader.Width), len(image.Data)))
 	case "blur":
-		applyBlur(image, 20)
+		radius, mode, _ := opts.blurArgs()
+		applyBlur(image, radius, mode)
+	case "levels":
+		black, white, _ := parseLevelsArgs(opts.Args)
+		Levels(image, black, white)
+	case "autocontrast":
+		clip, _ := parseAutoContrastArgs(opts.Args)
+		AutoContrast(image, clip)
+	case "gamma":
+		gamma, _ := parseGammaArgs(opts.Args)
+		Gamma(image, gamma)
+	case "curve":
+		channel, c, _ := parseCurveArgs(opts.Args)
+		ApplyCurve(image, channel, c)
+	case "adaptivethreshold":
+		window, bias, _ := parseAdaptiveThresholdArgs(opts.Args)
+		// The image size was checked against the summed-area table limit by Validate,
+		// which is the only error AdaptiveThreshold, LocalContrast and Kuwahara can return.
+		_ = AdaptiveThreshold(image, window, bias)
+	case "localcontrast":
+		radius, amount, _ := parseLocalContrastArgs(opts.Args)
+		_ = LocalContrast(image, radius, amount)
+	case "kuwahara":
+		radius, _ := parseKuwaharaArgs(opts.Args)
+		_ = Kuwahara(image, radius)
+	case "erode", "dilate", "open", "close":
+		radius, _ := parseMorphologyArgs(opts.FilterType, opts.Args)
+		Morphology(image, opts.FilterType, radius)
+	default:
+		if f, ok := lookupFilter(opts.FilterType); ok {
+			params, _ := f.parse(opts.FilterType, opts.Args)
+			return f.fn(image, params)
+		}
 	}
+	return nil
 }
 
 // applyColor applies a color-based filter to the BMPImage data.
 // The color argument determines which channel to keep: blue, green, red, grayscale, or negative.
+// Rows are processed in parallel.
 func applyColor(image *BMPImage, color int) {
-	h := len(image.Data)
+	ForRange(len(image.Data), 0, func(start, end int) {
+		applyColorRows(image, color, start, end)
+	})
+}
+
+// applyColorRows applies the color filter to rows [start, end) of the image data.
+func applyColorRows(image *BMPImage, color, start, end int) {
 	w := len(image.Data[0])
 
-	for y := 0; y < h; y++ {
+	for y := start; y < end; y++ {
 		for x := 0; x < w; x++ {
 			switch color {
 			case blue:
@@ -53,7 +255,7 @@ func applyColor(image *BMPImage, color int) {
 				image.Data[y][x].Green = 0
 			case grayscale:
 				// Convert pixel to grayscale using standard luminance calculation
-				gray := byte(float64(image.Data[y][x].Red)*0.2126 + float64(image.Data[y][x].Green)*0.7152 + float64(image.Data[y][x].Blue)*0.0722)
+				gray := luminance(image.Data[y][x])
 				image.Data[y][x].Blue = gray
 				image.Data[y][x].Green = gray
 				image.Data[y][x].Red = gray
@@ -67,41 +269,141 @@ func applyColor(image *BMPImage, color int) {
 	}
 }
 
+// channelModes are the modes the blue, green and red filters accept.
+var channelModes = []string{"luma", "tint"}
+
+// channelHues are the hues, in degrees, of the pure blue, green and red colors.
+var channelHues = map[int]float64{blue: 240, green: 120, red: 0}
+
+// applyChannelMode isolates a channel without darkening the image the way
+// zeroing the other channels does. With mode "luma" every pixel becomes the
+// gray level of its value in the channel, as if that channel were extracted.
+// With mode "tint" the luminance of every pixel is colorized with the hue of
+// the channel, at full saturation: black and white stay black and white and
+// mid-gray becomes the pure channel color.
+func applyChannelMode(image *BMPImage, color int, mode string) {
+	ForRange(len(image.Data), 0, func(start, end int) {
+		for _, row := range image.Data[start:end] {
+			for x, p := range row {
+				switch mode {
+				case "luma":
+					v := channel(p, color)
+					row[x] = Pixel{Blue: v, Green: v, Red: v}
+				case "tint":
+					row[x] = HSLToRGB(channelHues[color], 1, float64(luminance(p))/255)
+				}
+			}
+		}
+	})
+}
+
+// blurArgs returns the radius and edge mode of a blur filter. A radius given
+// in Args wins over BlurRadius.
+func (o FilterOptions) blurArgs() (int, EdgeMode, error) {
+	radius := defaultBlurRadius
+	if o.BlurRadius > 0 {
+		radius = o.BlurRadius
+	}
+	return parseBlurArgs(o.Args, radius)
+}
+
+// pixelateSize returns the block size of a pixelate filter on a width by
+// height image: the one given with --pixelate-size, or else
+// defaultPixelateSize, clamped to the longer side of the image so that the
+// default works on images of any size.
+func (o FilterOptions) pixelateSize(width, height int) int {
+	if o.PixelateSize > 0 {
+		return o.PixelateSize
+	}
+	return max(1, min(defaultPixelateSize, max(width, height)))
+}
+
+// parseBlurArgs parses the optional radius and edge mode of the blur filter,
+// with radius the radius used if none is given.
+func parseBlurArgs(args []string, radius int) (int, EdgeMode, error) {
+	if len(args) > 2 {
+		return 0, 0, fmt.Errorf("blur filter takes an optional radius and edge mode: blur[:<radius>[:<edge>]]")
+	}
+
+	mode := defaultBlurEdge
+	if len(args) > 0 {
+		r, err := strconv.Atoi(args[0])
+		if err != nil || r < 1 {
+			return 0, 0, fmt.Errorf("invalid blur radius: %s (must be positive)", args[0])
+		}
+		radius = r
+	}
+	if len(args) > 1 {
+		m, err := parseEdgeMode(args[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		mode = m
+	}
+	return radius, mode, nil
+}
+
+// luminance returns the perceived brightness of a pixel using the Rec. 709 coefficients.
+func luminance(p Pixel) byte {
+	return clampRound(luma(p))
+}
+
+// luma is luminance before its quantization, for computations that only
+// use it as an intermediate value.
+func luma(p Pixel) float64 {
+	return float64(p.Red)*0.2126 + float64(p.Green)*0.7152 + float64(p.Blue)*0.0722
+}
+
 // applyPixelate applies a pixelation effect to the BMPImage data.
 // The blocksize argument specifies the size of the pixelation blocks.
+// Bands of blocks are processed in parallel, as no block spans two bands.
 func applyPixelate(image *BMPImage, blocksize int) {
 	h := len(image.Data)
 	w := len(image.Data[0])
+	bands := (h + blocksize - 1) / blocksize
 
-	for y := 0; y < h; y += blocksize {
-		for x := 0; x < w; x += blocksize {
-			colorPixel := avgColorBlock(image, x, y, blocksize)
-			fillBlock(image, x, y, blocksize, colorPixel)
+	ForRange(bands, 0, func(start, end int) {
+		for y := start * blocksize; y < end*blocksize && y < h; y += blocksize {
+			for x := 0; x < w; x += blocksize {
+				colorPixel := avgColorBlock(image, x, y, blocksize)
+				fillBlock(image, x, y, blocksize, colorPixel)
+			}
 		}
-	}
+	})
 }
 
 // avgColorBlock calculates the average color of a block starting at (startX, startY).
 // The blocksize determines the dimensions of the block to average.
 func avgColorBlock(image *BMPImage, startX, startY, blocksize int) Pixel {
-	var rSum, gSum, bSum, cnt uint32
+	return avgColorRect(image, startX, startY, blocksize, blocksize)
+}
+
+// avgColorRect calculates the average color of the width by height rectangle
+// of stored pixels starting at (startX, startY), clipped to the image.
+func avgColorRect(image *BMPImage, startX, startY, width, height int) Pixel {
+	var rSum, gSum, bSum, cnt int
 	h := len(image.Data)
 	w := len(image.Data[0])
 
-	for y := startY; y < startY+blocksize && y < h; y++ {
-		for x := startX; x < startX+blocksize && x < w; x++ {
-			rSum += uint32(image.Data[y][x].Red)
-			gSum += uint32(image.Data[y][x].Green)
-			bSum += uint32(image.Data[y][x].Blue)
+	for y := startY; y < startY+height && y < h; y++ {
+		for x := startX; x < startX+width && x < w; x++ {
+			rSum += int(image.Data[y][x].Red)
+			gSum += int(image.Data[y][x].Green)
+			bSum += int(image.Data[y][x].Blue)
 			cnt++
 		}
 	}
 
+	// A block starting outside the image has no pixels to average
+	if cnt == 0 {
+		return Pixel{}
+	}
+
 	// Return the average color for the block
 	return Pixel{
-		Red:   byte(rSum / cnt),
-		Green: byte(gSum / cnt),
-		Blue:  byte(bSum / cnt),
+		Red:   byte(divRound(rSum, cnt)),
+		Green: byte(divRound(gSum, cnt)),
+		Blue:  byte(divRound(bSum, cnt)),
 	}
 }
 
@@ -121,156 +423,130 @@ func fillBlock(image *BMPImage, startX, startY, blocksize int, colorPixel Pixel)
 // applyBlur applies a basic box blur to the given BMPImage.
 // The blurRadius defines the size of the neighborhood around each pixel used for averaging.
 // A larger blurRadius results in a more pronounced blur effect.
-func applyBlur(image *BMPImage, blurRadius int) {
-	width := int(image.InfoHeader.Width)
-	height := int(image.InfoHeader.Height)
+// The mode selects how neighbors outside the image are read.
+// Every output row only reads the source, so bands of rows are computed in
+// parallel; see blurBandHeight for their size.
+func applyBlur(image *BMPImage, blurRadius int, mode EdgeMode) {
+	height := len(image.Data)
+	width := len(image.Data[0])
 
 	// Create a copy of the original image data to store blurred results.
 	blurredData := make([][]Pixel, height)
-	for i := range blurredData {
-		blurredData[i] = make([]Pixel, width)
-	}
-
-	// Iterate over each pixel in the image.
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// Initialize accumulators for each color channel.
-			var redSum, greenSum, blueSum, count int
-
-			// Iterate over the neighborhood of the current pixel.
-			for ky := -blurRadius; ky <= blurRadius; ky++ {
-				for kx := -blurRadius; kx <= blurRadius; kx++ {
-					// Calculate the neighboring pixel's coordinates.
-					nx := x + kx
-					ny := y + ky
-
-					// Ensure the neighboring pixel is within bounds.
-					if nx >= 0 && nx < width && ny >= 0 && ny < height {
-						// Accumulate the color values.
-						pixel := image.Data[ny][nx]
-						redSum += int(pixel.Red)
-						greenSum += int(pixel.Green)
-						blueSum += int(pixel.Blue)
-						count++
-					}
-				}
-			}
-
-			// Calculate the average color values for the pixel.
-			blurredData[y][x] = Pixel{
-				Red:   byte(redSum / count),
-				Green: byte(greenSum / count),
-				Blue:  byte(blueSum / count),
+	rowAt := func(y int) []Pixel { return image.Data[y] }
+	band := blurBandHeight(blurRadius)
+	ForRange((height+band-1)/band, 0, func(start, end int) {
+		for y := start * band; y < end*band && y < height; y += band {
+			rows := blurredData[y:min(y+band, height)]
+			for i := range rows {
+				rows[i] = make([]Pixel, width)
 			}
+			blurRows(rows, rowAt, y, height, blurRadius, mode)
 		}
-	}
+	})
 
 	// Replace the original image data with the blurred version.
 	image.Data = blurredData
 }
 
-// // applyBlur applies a blur effect to the BMPImage using a blur radius.
-// // The function divides the work between multiple goroutines based on the number of CPU cores available.
-// func applyBlur(image *BMPImage, blurRadius int) {
-// 	startTime := time.Now()
-
-// 	h := len(image.Data)
-// 	w := len(image.Data[0])
-// 	k := 2*blurRadius + 1
-// 	weight := 1.0 / float64(k)
-
-// 	// Determine the number of goroutines to use
-// 	numGoroutines := runtime.NumCPU()
-// 	chunkSize := h / numGoroutines
-// 	if chunkSize < 1 {
-// 		chunkSize = 1
-// 		numGoroutines = h
-// 	}
-
-// 	var wg sync.WaitGroup
-
-// 	// Horizontal pass of the blur
-// 	for i := 0; i < numGoroutines; i++ {
-// 		wg.Add(1)
-// 		go func(startY, endY int) {
-// 			defer wg.Done()
-// 			for y := startY; y < endY; y++ {
-// 				tempRow := make([]float64, w*3)
-// 				for x := 0; x < w; x++ {
-// 					var rSum, gSum, bSum float64
-// 					for i := -blurRadius; i <= blurRadius; i++ {
-// 						ix := x + i
-// 						if ix >= 0 && ix < w {
-// 							rSum += float64(image.Data[y][ix].Red)
-// 							gSum += float64(image.Data[y][ix].Green)
-// 							bSum += float64(image.Data[y][ix].Blue)
-// 						}
-// 					}
-// 					tempRow[x*3] = rSum * weight
-// 					tempRow[x*3+1] = gSum * weight
-// 					tempRow[x*3+2] = bSum * weight
-// 				}
-// 				for x := 0; x < w; x++ {
-// 					image.Data[y][x].Red = byte(clamp(tempRow[x*3]))
-// 					image.Data[y][x].Green = byte(clamp(tempRow[x*3+1]))
-// 					image.Data[y][x].Blue = byte(clamp(tempRow[x*3+2]))
-// 				}
-// 			}
-// 		}(i*chunkSize, min((i+1)*chunkSize, h))
-// 	}
-// 	wg.Wait()
-
-// 	// Vertical pass of the blur
-// 	for i := 0; i < numGoroutines; i++ {
-// 		wg.Add(1)
-// 		go func(startX, endX int) {
-// 			defer wg.Done()
-// 			for x := startX; x < endX; x++ {
-// 				tempCol := make([]float64, h*3)
-// 				for y := 0; y < h; y++ {
-// 					var rSum, gSum, bSum float64
-// 					for i := -blurRadius; i <= blurRadius; i++ {
-// 						iy := y + i
-// 						if iy >= 0 && iy < h {
-// 							rSum += float64(image.Data[iy][x].Red)
-// 							gSum += float64(image.Data[iy][x].Green)
-// 							bSum += float64(image.Data[iy][x].Blue)
-// 						}
-// 					}
-// 					tempCol[y*3] = rSum * weight
-// 					tempCol[y*3+1] = gSum * weight
-// 					tempCol[y*3+2] = bSum * weight
-// 				}
-// 				for y := 0; y < h; y++ {
-// 					image.Data[y][x].Red = byte(clamp(tempCol[y*3]))
-// 					image.Data[y][x].Green = byte(clamp(tempCol[y*3+1]))
-// 					image.Data[y][x].Blue = byte(clamp(tempCol[y*3+2]))
-// 				}
-// 			}
-// 		}(i*chunkSize, min((i+1)*chunkSize, w))
-// 	}
-// 	wg.Wait()
-
-// 	// Output the time taken to apply the blur
-// 	elapsedTime := time.Since(startTime)
-// 	fmt.Printf("Parallel blur operation took %v\n", elapsedTime)
-// }
-
-// // clamp ensures that the value is within the range 0 to 255.
-// func clamp(v float64) float64 {
-// 	if v > 255 {
-// 		return 255
-// 	}
-// 	if v < 0 {
-// 		return 0
-// 	}
-// 	return v
-// }
-
-// // min returns the smaller of two integers.
-// func min(a, b int) int {
-// 	if a < b {
-// 		return a
-// 	}
-// 	return b
-// }
+// blurBandHeight returns the number of rows the blur computes from one set
+// of column sums. Starting a band sums the 2*blurRadius+1 rows around its
+// first row, while every further row only adds the row entering the
+// neighborhood and subtracts the one leaving it, so the bands are made a
+// few times the neighborhood high to keep the start-up cost small.
+func blurBandHeight(blurRadius int) int {
+	return max(64, 4*(2*blurRadius+1))
+}
+
+// blurRows computes rows y, y+1, ... of the box-blurred image into the rows
+// of dst. rowAt returns a source row; with EdgeShrink it is only called for
+// rows within blurRadius of the rows computed, which lets the same kernel
+// run over a whole image or over a band of rows. Neighbors outside the image
+// are read as mode selects: with EdgeShrink they are absent, so the average
+// near the edges is taken over fewer pixels, and with the other modes every
+// average is taken over the full neighborhood.
+//
+// The vertical part of the blur reads whole rows: it keeps the sums of every
+// column over the neighborhood of the current row and slides them down one
+// row at a time. The sums are exact, so the result is the same as summing
+// the neighborhood of every row afresh.
+func blurRows(dst [][]Pixel, rowAt func(int) []Pixel, y, height, blurRadius int, mode EdgeMode) {
+	if len(dst) == 0 {
+		return
+	}
+	sums := newColumnSums(len(dst[0]))
+	slide := func(ny, sign int) {
+		if sy, ok := mode.index(ny, height); ok {
+			sums.add(rowAt(sy), sign)
+		}
+	}
+	for ny := y - blurRadius; ny <= y+blurRadius; ny++ {
+		slide(ny, 1)
+	}
+	for i, row := range dst {
+		if i > 0 {
+			slide(y+i+blurRadius, 1)
+			slide(y+i-blurRadius-1, -1)
+		}
+		sums.blur(blurRadius, mode, func(x, red, green, blue, count int) {
+			row[x] = Pixel{Red: byte(divRound(red, count)), Green: byte(divRound(green, count)), Blue: byte(divRound(blue, count))}
+		})
+	}
+}
+
+// columnSums holds the sums of every channel of every column over a set of
+// rows, the vertical part of a box blur.
+type columnSums struct {
+	red, green, blue []int
+	rows             int
+}
+
+func newColumnSums(width int) *columnSums {
+	return &columnSums{red: make([]int, width), green: make([]int, width), blue: make([]int, width)}
+}
+
+// add adds the row to the sums, or subtracts it if sign is -1.
+func (c *columnSums) add(row []Pixel, sign int) {
+	for x, p := range row {
+		c.red[x] += sign * int(p.Red)
+		c.green[x] += sign * int(p.Green)
+		c.blue[x] += sign * int(p.Blue)
+	}
+	c.rows += sign
+}
+
+// addWide is add for a row of 16-bit pixels.
+func (c *columnSums) addWide(row []Pixel16, sign int) {
+	for x, p := range row {
+		c.red[x] += sign * int(p.Red)
+		c.green[x] += sign * int(p.Green)
+		c.blue[x] += sign * int(p.Blue)
+	}
+	c.rows += sign
+}
+
+// blur slides a horizontal window of 2*blurRadius+1 columns over the sums
+// and calls set with the sums over the window centered on every column and
+// the number of pixels they add up. The columns entering and leaving the
+// window are mapped by mode like the rows.
+func (c *columnSums) blur(blurRadius int, mode EdgeMode, set func(x, red, green, blue, count int)) {
+	width := len(c.red)
+	var redSum, greenSum, blueSum, cols int
+	slide := func(x, sign int) {
+		if sx, ok := mode.index(x, width); ok {
+			redSum += sign * c.red[sx]
+			greenSum += sign * c.green[sx]
+			blueSum += sign * c.blue[sx]
+			cols += sign
+		}
+	}
+	for x := -blurRadius; x < blurRadius; x++ {
+		slide(x, 1)
+	}
+	for x := 0; x < width; x++ {
+		slide(x+blurRadius, 1)
+		if x > 0 {
+			slide(x-blurRadius-1, -1)
+		}
+		set(x, redSum, greenSum, blueSum, c.rows*cols)
+	}
+}
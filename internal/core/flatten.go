@@ -0,0 +1,39 @@
+package core
+
+// checkerSize is the side in pixels of the squares of the checkerboard
+// transparent images are flattened onto with --background=checker.
+const checkerSize = 8
+
+// The light and dark squares of the checkerboard, as image editors show
+// transparency.
+var (
+	checkerLight = Pixel{Blue: 0xff, Green: 0xff, Red: 0xff}
+	checkerDark  = Pixel{Blue: 0xcc, Green: 0xcc, Red: 0xcc}
+)
+
+// Flatten composites the image over an opaque backdrop and drops its alpha
+// channel, for formats that can't store transparency. The backdrop is the
+// solid color background, or with checker set a checkerboard of checkerSize
+// squares starting with a light one at the visual top-left corner. Pixels are
+// blended with blendSrcOver, so half-transparent pixels mix with the backdrop
+// rather than losing their alpha. Opaque images are left unchanged.
+func Flatten(image *BMPImage, background Pixel, checker bool) {
+	if image.Alpha == nil {
+		return
+	}
+
+	for y, row := range image.Rows() {
+		alpha := image.Alpha[y]
+		for x, p := range row {
+			backdrop := background
+			if checker {
+				backdrop = checkerLight
+				if (x/checkerSize+y/checkerSize)%2 == 1 {
+					backdrop = checkerDark
+				}
+			}
+			row[x], _ = blendSrcOver(p, alpha[x], backdrop, 255)
+		}
+	}
+	image.Alpha = nil
+}
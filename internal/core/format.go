@@ -0,0 +1,583 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// Output formats accepted by --format.
+const (
+	FormatBMP24 = "bmp24" // 24-bit true color, the default
+	FormatBMP32 = "bmp32" // 32-bit with an alpha channel, in a V4 header with bit field masks
+	FormatBMP8  = "bmp8"  // 8-bit palettized, quantized with median cut
+	FormatRLE8  = "rle8"  // bmp8 with the rows compressed as runs of palette indices
+	FormatAuto  = "auto"  // whichever of bmp24, bmp8 and rle8 is smallest and lossless, see AnalyzeEncoding
+	FormatGray8 = "gray8" // 8-bit with a gray ramp palette; the image must be grayscale
+	FormatPNG   = "png"
+	FormatJPEG  = "jpeg"
+	FormatPPM   = "ppm" // binary netpbm color, P6
+	FormatPGM   = "pgm" // binary netpbm grayscale, P5; the image must be grayscale
+	FormatRaw   = "raw" // bare pixel bytes without headers, see EncodeRaw
+
+	// FormatNative is the lossless frame for piping images between bitmap
+	// processes, see EncodeNative. It is selected with --pipe-format.
+	FormatNative = "native"
+)
+
+// OutputFormats lists the formats --format accepts.
+var OutputFormats = []string{FormatBMP24, FormatBMP32, FormatBMP8, FormatRLE8, FormatAuto, FormatGray8, FormatPNG, FormatJPEG, FormatPPM, FormatPGM, FormatRaw}
+
+// jpegQuality is the quality JPEG output is encoded with.
+const jpegQuality = 90
+
+// SaveOptions controls how an image is encoded when it is written out.
+type SaveOptions struct {
+	Format     string   // One of the Format constants; empty means taken from the file extension
+	Background Pixel    // Color transparent images are flattened onto for formats without alpha
+	Checker    bool     // Flatten onto a checkerboard instead of Background
+	Align      int      // Row alignment in bytes for bmp24 and raw; 0 means 4 for bmp24 and unpadded for raw
+	Channels   string   // Channel order of raw output, such as rgb, bgr or rgba; empty means rgb
+	PipeFormat string   // Format of images written to standard output when Format is empty; empty means by extension
+	Stamp      *Stamp   // Provenance stamp written into BMP output, if any
+	Comments   []string // Comments added to BMP output after those of the image, see readComments
+
+	ColorProfile string // One of the ColorProfile modes for bmp24 output; empty means ColorProfileKeep
+	Canonical    bool   // Write bmp24 output in the canonical form of Canonicalize
+
+	Hooks Hooks // Receive the progress of the "encode" stage and the format --format=auto picks
+}
+
+// alignFor returns the row alignment opts selects for format.
+func (opts SaveOptions) alignFor(format string) int {
+	switch {
+	case opts.Align > 0:
+		return opts.Align
+	case format == FormatRaw:
+		return 1
+	}
+	return 4
+}
+
+// channels returns the channel order of raw output.
+func (opts SaveOptions) channels() string {
+	if opts.Channels == "" {
+		return defaultRawChannels
+	}
+	return opts.Channels
+}
+
+// colorProfile returns the color profile mode of bmp24 output.
+func (opts SaveOptions) colorProfile() string {
+	if opts.ColorProfile == "" {
+		return ColorProfileKeep
+	}
+	return opts.ColorProfile
+}
+
+// parseFormat validates the value of the --format flag.
+func parseFormat(format string) (string, error) {
+	if slices.Contains(OutputFormats, format) {
+		return format, nil
+	}
+	return "", withKind(ErrInvalidParameter, fmt.Errorf("invalid format option: %s", format))
+}
+
+// OutputFormat returns the format an image saved to path is encoded in:
+// the one given in opts if any, or else the one matching the extension of
+// path. Paths without a known extension, including "-" for standard output,
+// are written as FormatBMP24, unless opts selects a pipe format for
+// standard output.
+func OutputFormat(path string, opts SaveOptions) string {
+	if opts.Format != "" {
+		return opts.Format
+	}
+	if path == "-" && opts.PipeFormat != "" {
+		return opts.PipeFormat
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return FormatPNG
+	case ".jpg", ".jpeg":
+		return FormatJPEG
+	case ".ppm":
+		return FormatPPM
+	case ".pgm":
+		return FormatPGM
+	case ".raw":
+		return FormatRaw
+	}
+	return FormatBMP24
+}
+
+// paletteDataOffset is where the pixels of palettized output start:
+// right after the file header, a 40-byte DIB header and a full 256-entry palette.
+const paletteDataOffset = 14 + 40 + 256*4
+
+// EncodedSize returns the exact size in bytes of the file Encode produces for
+// image with opts, whose Format must be set. Only the headers of image are
+// used, so the size can be known before any pixels are decoded. The encoders
+// derive their header fields from the same computation. The size of
+// compressed formats depends on the pixels, so -1 is returned for them.
+func EncodedSize(image *BMPImage, opts SaveOptions) int64 {
+	width := int(image.InfoHeader.Width)
+	height := utils.Abs(int(image.InfoHeader.Height))
+
+	switch opts.Format {
+	case FormatBMP32:
+		return bmp32DataOffset + pixelArraySize(width, height, 32) + opts.trailersSize(image)
+	case FormatBMP8, FormatGray8:
+		return paletteDataOffset + pixelArraySize(width, height, 8) + opts.trailersSize(image)
+	case FormatPNG, FormatJPEG, FormatRLE8, FormatAuto:
+		return -1
+	case FormatPPM:
+		return int64(len(netpbmHeader("P6", width, height))) + int64(width)*int64(height)*3
+	case FormatPGM:
+		return int64(len(netpbmHeader("P5", width, height))) + int64(width)*int64(height)
+	case FormatRaw:
+		return alignedArraySize(width, height, 8*len(opts.channels()), opts.alignFor(FormatRaw))
+	case FormatNative:
+		return nativeSize(image)
+	}
+	trailers := opts.trailersSize(image)
+	if opts.Canonical {
+		image = Canonicalize(image)
+	}
+	return opts.withColorProfile(image).outputSize(opts.alignFor(FormatBMP24)) + trailers
+}
+
+// isBMP reports whether format is one of the BMP output formats.
+func isBMP(format string) bool {
+	return format == "" || format == FormatBMP24 || format == FormatBMP32 || format == FormatBMP8 || format == FormatRLE8 || format == FormatAuto || format == FormatGray8
+}
+
+// trailersSize returns the number of bytes the comments and the stamp add
+// to the BMP output of image.
+func (opts SaveOptions) trailersSize(image *BMPImage) int64 {
+	size := commentsSize(opts.comments(image))
+	if opts.Stamp != nil {
+		size += stampTrailerSize
+	}
+	return size
+}
+
+// Encode writes image to w in the format selected by opts.
+// A widened image is quantized to 8 bits per channel on the way out, and
+// a transparent one is flattened as opts selects unless the format is PNG,
+// or raw with an alpha channel. The native format keeps both as they are.
+func Encode(w io.Writer, image *BMPImage, opts SaveOptions) error {
+	opts.Hooks.progress("encode", 0, 1)
+	if err := encode(w, image, opts); err != nil {
+		return err
+	}
+	opts.Hooks.progress("encode", 1, 1)
+	return nil
+}
+
+// encode writes image to w for Encode.
+func encode(w io.Writer, image *BMPImage, opts SaveOptions) error {
+	if opts.Align > 0 && opts.Format != "" && opts.Format != FormatBMP24 && opts.Format != FormatRaw {
+		return withKind(ErrInvalidParameter, fmt.Errorf("--align only applies to %s and %s output", FormatBMP24, FormatRaw))
+	}
+	if opts.colorProfile() != ColorProfileKeep && opts.Format != "" && opts.Format != FormatBMP24 {
+		return withKind(ErrInvalidParameter, fmt.Errorf("--color-profile only applies to %s output", FormatBMP24))
+	}
+	if opts.Canonical && (opts.Format != "" && opts.Format != FormatBMP24 || opts.alignFor(FormatBMP24) != 4 || opts.colorProfile() != ColorProfileKeep || opts.Stamp != nil) {
+		return withKind(ErrInvalidParameter, fmt.Errorf("--canonical only applies to plain %s output", FormatBMP24))
+	}
+	if opts.Channels != "" && opts.Format != FormatRaw {
+		return withKind(ErrInvalidParameter, fmt.Errorf("--channels only applies to %s output", FormatRaw))
+	}
+	if opts.Stamp != nil && !isBMP(opts.Format) {
+		return withKind(ErrInvalidParameter, fmt.Errorf("--stamp only applies to BMP output"))
+	}
+	if len(opts.Comments) > 0 && (!isBMP(opts.Format) || opts.Canonical) {
+		return withKind(ErrInvalidParameter, fmt.Errorf("--comment only applies to BMP output that isn't canonical"))
+	}
+	if opts.Format == FormatNative {
+		return EncodeNative(w, image)
+	}
+	if opts.Format == FormatAuto {
+		opts.Format = AnalyzeEncoding(image, opts).Best
+		opts.Hooks.infof("--format=auto picked %s", opts.Format)
+		return encode(w, image, opts)
+	}
+	if isBMP(opts.Format) {
+		if err := checkFileSize(EncodedSize(image, opts)); err != nil {
+			return err
+		}
+	}
+	if opts.Stamp != nil {
+		tw := &trailerWriter{w: w, trailer: opts.Stamp.trailer(), tag: stampTag}
+		opts.Stamp = nil
+		if err := encode(tw, image, opts); err != nil {
+			return err
+		}
+		return tw.close()
+	}
+	// The comments come before the trailer of a stamp, which ends the file
+	if comments := opts.comments(image); len(comments) > 0 {
+		tw := &trailerWriter{w: w, trailer: encodeComments(comments)}
+		c := *image
+		c.Comments, opts.Comments = nil, nil
+		if err := encode(tw, &c, opts); err != nil {
+			return err
+		}
+		return tw.close()
+	}
+
+	keepAlpha := opts.Format == FormatPNG || opts.Format == FormatBMP32 || (opts.Format == FormatRaw && strings.Contains(opts.channels(), "a"))
+	image = opts.prepare(image, keepAlpha)
+
+	switch opts.Format {
+	case "", FormatBMP24:
+		if opts.Canonical {
+			image = Canonicalize(image)
+		}
+		return EncodeBMPAligned(w, opts.withColorProfile(image), opts.alignFor(FormatBMP24))
+	case FormatBMP32:
+		return encodeBMP32(w, image)
+	case FormatBMP8:
+		palette := MedianCut(image, 256)
+		return encodeIndexed(w, image, palette, func(p Pixel) byte { return nearestColor(palette, p) })
+	case FormatRLE8:
+		palette := MedianCut(image, 256)
+		return encodeRLE8(w, image, palette, func(p Pixel) byte { return nearestColor(palette, p) })
+	case FormatGray8:
+		if !isGrayscale(image) {
+			return ErrNotGrayscale
+		}
+		return encodeIndexed(w, image, grayRamp(), func(p Pixel) byte { return p.Red })
+	case FormatPNG:
+		return png.Encode(w, toImage(image))
+	case FormatJPEG:
+		return jpeg.Encode(w, toImage(image), &jpeg.Options{Quality: jpegQuality})
+	case FormatPPM, FormatPGM:
+		if opts.Format == FormatPGM && !isGrayscale(image) {
+			return ErrNotGrayscale
+		}
+		return encodeNetpbm(w, image, opts.Format == FormatPGM)
+	case FormatRaw:
+		return EncodeRaw(w, image, opts.channels(), opts.alignFor(FormatRaw))
+	}
+	return withKind(ErrInvalidParameter, fmt.Errorf("invalid format option: %s", opts.Format))
+}
+
+// prepare returns image as the encoders write it: quantized to 8 bits per
+// channel if it is widened, and flattened as opts selects if it is
+// transparent, unless keepAlpha is set. The image itself is left untouched.
+func (opts SaveOptions) prepare(image *BMPImage, keepAlpha bool) *BMPImage {
+	image = image.narrowed()
+	if image.Alpha != nil && !keepAlpha {
+		image = image.Clone()
+		Flatten(image, opts.Background, opts.Checker)
+	}
+	return image
+}
+
+// Save encodes image into the file filename in the format given by
+// OutputFormat. The file is written atomically: it only appears under its
+// name once it is complete, and is left untouched if encoding fails.
+// A filename of "-" writes to standard output instead. Write failures are of
+// kind ErrIO; images the format can't hold give an error of kind ErrUnsupported.
+func Save(image *BMPImage, filename string, opts SaveOptions) error {
+	opts.Format = OutputFormat(filename, opts)
+	if filename == "-" {
+		return ioError(Encode(os.Stdout, image, opts))
+	}
+
+	f, err := createAtomic(filename)
+	if err != nil {
+		return ioError(err)
+	}
+
+	if err := Encode(f, image, opts); err != nil {
+		f.Abort()
+		return ioError(err)
+	}
+	return ioError(f.Commit())
+}
+
+// isGrayscale reports whether every pixel of the image has equal channels.
+func isGrayscale(image *BMPImage) bool {
+	for _, row := range image.Data {
+		for _, p := range row {
+			if p.Red != p.Green || p.Green != p.Blue {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// grayRamp returns the standard 256-entry palette where index i is gray level i.
+func grayRamp() []Pixel {
+	palette := make([]Pixel, 256)
+	for i := range palette {
+		palette[i] = Pixel{Blue: byte(i), Green: byte(i), Red: byte(i)}
+	}
+	return palette
+}
+
+// encodeIndexed writes image as an 8-bit palettized BMP. The color table
+// follows a plain 40-byte DIB header and always has 256 entries, unused ones
+// being black, so the file size only depends on the dimensions. index maps
+// every pixel to its palette entry; the lookups are cached, since photos
+// repeat colors a lot.
+func encodeIndexed(w io.Writer, image *BMPImage, palette []Pixel, index func(Pixel) byte) error {
+	width := int(image.InfoHeader.Width)
+	stride := rowStride(width, 8)
+
+	header := *image
+	header.InfoHeader.Compression = 0
+	header.InfoHeader.ImageSize = uint32(pixelArraySize(width, utils.Abs(int(image.InfoHeader.Height)), 8))
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(indexedHead(&header, palette)); err != nil {
+		return err
+	}
+
+	index = cachedIndex(index)
+	buf := getRowBuffer(stride)
+	defer putRowBuffer(buf)
+	for n := range image.Data {
+		for x, p := range image.Data[image.fileRow(n)] {
+			buf[x] = index(p)
+		}
+		clear(buf[width:])
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// indexedHead returns the headers and the 256-entry color table of the
+// 8-bit palettized output of header, an image whose Compression and
+// ImageSize are those of the pixel array written after them. The DIB header
+// is a plain 40-byte one, and FileSize is recomputed from ImageSize.
+func indexedHead(header *BMPImage, palette []Pixel) []byte {
+	header.HeaderExtra, header.ICCProfile = nil, nil
+	header.InfoHeader.Size = 40
+	header.InfoHeader.BitsPerPixel = 8
+	header.InfoHeader.ColorsUsed = 256
+	header.InfoHeader.ColorsImportant = 0
+	header.Header.DataOffset = paletteDataOffset
+	header.Header.FileSize = paletteDataOffset + header.InfoHeader.ImageSize
+
+	head := make([]byte, header.Header.DataOffset)
+	putHeaders(head, header)
+	for i, c := range palette {
+		head[54+4*i] = c.Blue
+		head[54+4*i+1] = c.Green
+		head[54+4*i+2] = c.Red
+	}
+	return head
+}
+
+// cachedIndex returns index with its lookups cached, for palettes that are
+// slow to search.
+func cachedIndex(index func(Pixel) byte) func(Pixel) byte {
+	cache := make(map[Pixel]byte)
+	return func(p Pixel) byte {
+		i, ok := cache[p]
+		if !ok {
+			i = index(p)
+			cache[p] = i
+		}
+		return i
+	}
+}
+
+// biRLE8 is the compression method of 8-bit pixel arrays stored as runs of
+// palette indices.
+const biRLE8 = 1
+
+// encodeRLE8 writes image as an 8-bit palettized BMP like encodeIndexed, its
+// rows compressed with appendRLE8Row. Compressed images can't be top-down,
+// so the rows are always written bottom-up. The pixel array is only known
+// once it is compressed, and is held in memory until then.
+func encodeRLE8(w io.Writer, image *BMPImage, palette []Pixel, index func(Pixel) byte) error {
+	data := rle8Data(image, cachedIndex(index))
+	if err := checkFileSize(paletteDataOffset + int64(len(data))); err != nil {
+		return err
+	}
+
+	header := *image
+	header.InfoHeader.Height = int32(len(image.Data))
+	header.InfoHeader.Compression = biRLE8
+	header.InfoHeader.ImageSize = uint32(len(data))
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(indexedHead(&header, palette)); err != nil {
+		return err
+	}
+	if _, err := bw.Write(data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// rle8Data returns the RLE8 pixel array of image, bottom-up, the pixels
+// mapped to palette indices by index. Every row but the last ends with an
+// end of line, and the last with the end of the bitmap.
+func rle8Data(image *BMPImage, index func(Pixel) byte) []byte {
+	var data []byte
+	indices := make([]byte, image.InfoHeader.Width)
+	for y := len(image.Data) - 1; y >= 0; y-- {
+		for x, p := range image.Data[y] {
+			indices[x] = index(p)
+		}
+		data = appendRLE8Row(data, indices)
+		if y > 0 {
+			data = append(data, 0, 0)
+		}
+	}
+	return append(data, 0, 1)
+}
+
+// appendRLE8Row appends the RLE8 codes of one row of palette indices to dst,
+// without the end of line. Runs of 3 or more equal indices are encoded as a
+// count and the index. The stretches between them are copied in absolute
+// mode, padded to an even length, unless encoding their shorter runs as well
+// takes no more bytes, as it always does under the 3 indices absolute mode
+// needs. Either holds at most 255 indices.
+func appendRLE8Row(dst, row []byte) []byte {
+	for x := 0; x < len(row); {
+		if run := rle8Run(row[x:]); run >= 3 {
+			dst = append(dst, byte(run), row[x])
+			x += run
+			continue
+		}
+
+		end, runs := x, 0
+		for end < len(row) && end-x < 255 {
+			run := min(rle8Run(row[end:]), 255-(end-x))
+			if run >= 3 {
+				break
+			}
+			end += run
+			runs++
+		}
+		if n := end - x; n < 3 || 2*runs <= 2+n+n%2 {
+			for x < end {
+				run := min(rle8Run(row[x:]), end-x)
+				dst = append(dst, byte(run), row[x])
+				x += run
+			}
+			continue
+		}
+		dst = append(dst, 0, byte(end-x))
+		dst = append(dst, row[x:end]...)
+		if (end-x)%2 == 1 {
+			dst = append(dst, 0)
+		}
+		x = end
+	}
+	return dst
+}
+
+// rle8Run returns the number of indices at the start of row equal to the
+// first one, at most 255, the longest run RLE8 encodes.
+func rle8Run(row []byte) int {
+	n := 1
+	for n < len(row) && n < 255 && row[n] == row[0] {
+		n++
+	}
+	return n
+}
+
+// bmp32DataOffset is where the pixels of 32-bit output start: right after
+// the file header and a V4 DIB header, which holds the masks.
+const bmp32DataOffset = 14 + v4HeaderSize
+
+// encodeBMP32 writes image as a 32-bit BMP whose V4 header gives the masks
+// of the blue, green, red and alpha bytes of every pixel, in that order, and
+// tags the colors as sRGB. Opaque images get an alpha of 255 throughout. The
+// rows are written in the order of the sign of the height and need no
+// padding.
+func encodeBMP32(w io.Writer, image *BMPImage) error {
+	header := *image
+	header.HeaderExtra = make([]byte, v4HeaderSize-40)
+	for i, mask := range []uint32{0x00ff0000, 0x0000ff00, 0x000000ff, 0xff000000} {
+		binary.LittleEndian.PutUint32(header.HeaderExtra[4*i:], mask)
+	}
+	binary.LittleEndian.PutUint32(header.HeaderExtra[extraCSType:], lcsSRGB)
+	header.ICCProfile = nil
+	header.InfoHeader.Size = v4HeaderSize
+	header.InfoHeader.BitsPerPixel = 32
+	header.InfoHeader.Compression = biBitfields
+	header.InfoHeader.ColorsUsed = 0
+	header.InfoHeader.ColorsImportant = 0
+	header.Header.DataOffset = bmp32DataOffset
+	header.updateSizes()
+
+	bw := bufio.NewWriter(w)
+	head := make([]byte, header.Header.DataOffset)
+	putHeaders(head, &header)
+	if _, err := bw.Write(head); err != nil {
+		return err
+	}
+
+	buf := getRowBuffer(4 * int(image.InfoHeader.Width))
+	defer putRowBuffer(buf)
+	for i := range image.Data {
+		y := image.fileRow(i)
+		for x, p := range image.Data[y] {
+			a := byte(255)
+			if image.Alpha != nil {
+				a = image.Alpha[y][x]
+			}
+			buf[4*x], buf[4*x+1], buf[4*x+2], buf[4*x+3] = p.Blue, p.Green, p.Red, a
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// netpbmHeader returns the header of a binary netpbm file with 8-bit samples.
+func netpbmHeader(magic string, width, height int) string {
+	return fmt.Sprintf("%s\n%d %d\n255\n", magic, width, height)
+}
+
+// encodeNetpbm writes image as a binary PPM, or as a PGM if gray is set,
+// in which case the image must be grayscale.
+func encodeNetpbm(w io.Writer, image *BMPImage, gray bool) error {
+	width := int(image.InfoHeader.Width)
+	magic, channels := "P6", 3
+	if gray {
+		magic, channels = "P5", 1
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(netpbmHeader(magic, width, len(image.Data))); err != nil {
+		return err
+	}
+
+	buf := make([]byte, width*channels)
+	for _, row := range image.Rows() {
+		for x, p := range row {
+			if gray {
+				buf[x] = p.Red
+			} else {
+				buf[3*x], buf[3*x+1], buf[3*x+2] = p.Red, p.Green, p.Blue
+			}
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
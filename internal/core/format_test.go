@@ -0,0 +1,305 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// grayNoise returns noiseImage with every pixel turned gray, as the
+// grayscale formats require.
+func grayNoise(width, height int, seed int64) *BMPImage {
+	image := noiseImage(width, height, seed)
+	for _, row := range image.Data {
+		for x, p := range row {
+			row[x] = Pixel{Blue: p.Red, Green: p.Red, Red: p.Red}
+		}
+	}
+	return image
+}
+
+// withAlpha gives image an alpha plane with every level from 0 to 255.
+func withAlpha(image *BMPImage) *BMPImage {
+	image.Alpha = make([][]byte, len(image.Data))
+	for y, row := range image.Data {
+		image.Alpha[y] = make([]byte, len(row))
+		for x := range row {
+			image.Alpha[y][x] = byte(x*37 + y*11)
+		}
+	}
+	return image
+}
+
+func TestEncodedSizeMatchesEncode(t *testing.T) {
+	formats := []SaveOptions{
+		{Format: FormatBMP24},
+		{Format: FormatBMP24, Align: 8},
+		{Format: FormatBMP24, Align: 16},
+		{Format: FormatBMP32},
+		{Format: FormatBMP8},
+		{Format: FormatGray8},
+		{Format: FormatPPM},
+		{Format: FormatPGM},
+		{Format: FormatRaw},
+		{Format: FormatRaw, Channels: "argb", Align: 4},
+		{Format: FormatRaw, Channels: "bgr", Align: 16},
+		{Format: FormatNative},
+		{Format: FormatBMP24, Stamp: &Stamp{}},
+		{Format: FormatBMP8, Stamp: &Stamp{}},
+		{Format: FormatBMP32, Stamp: &Stamp{}},
+	}
+	variants := []struct {
+		name string
+		make func(width, height int) *BMPImage
+	}{
+		{"plain", func(w, h int) *BMPImage { return grayNoise(w, h, 1) }},
+		{"alpha", func(w, h int) *BMPImage { return withAlpha(grayNoise(w, h, 2)) }},
+		{"wide", func(w, h int) *BMPImage { b := grayNoise(w, h, 3); b.Widen(); return b }},
+		{"32-bit headers", func(w, h int) *BMPImage {
+			b := withAlpha(grayNoise(w, h, 4))
+			b.Header.DataOffset, b.InfoHeader.Size, b.InfoHeader.BitsPerPixel = 138, 124, 32
+			b.updateSizes()
+			return b
+		}},
+	}
+
+	for _, opts := range formats {
+		for _, v := range variants {
+			for _, width := range []int{1, 2, 3, 4, 5, 7, 13} {
+				for _, height := range []int{1, 2, 9} {
+					name := fmt.Sprintf("%s_align%d_%s_%s_%dx%d", opts.Format, opts.Align, opts.Channels, v.name, width, height)
+					t.Run(name, func(t *testing.T) {
+						image := v.make(width, height)
+						var buf bytes.Buffer
+						if err := Encode(&buf, image, opts); err != nil {
+							t.Fatalf("Encode: %v", err)
+						}
+						if want := EncodedSize(image, opts); int64(buf.Len()) != want {
+							t.Errorf("Encode wrote %d bytes, EncodedSize predicted %d", buf.Len(), want)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestSerializeBMPMatchesEncode(t *testing.T) {
+	for _, width := range []int{1, 2, 3, 4, 5, 7, 13} {
+		for _, height := range []int{1, 2, 9} {
+			t.Run(fmt.Sprintf("%dx%d", width, height), func(t *testing.T) {
+				image := withAlpha(noiseImage(width, height, 1))
+				image.Widen()
+
+				out, err := SerializeBMP(image)
+				if err != nil {
+					t.Fatalf("SerializeBMP: %v", err)
+				}
+				if want := EncodedSize(image, SaveOptions{Format: FormatBMP24}); int64(len(out)) != want {
+					t.Errorf("SerializeBMP wrote %d bytes, EncodedSize predicted %d", len(out), want)
+				}
+
+				var encoded bytes.Buffer
+				if err := Encode(&encoded, image, SaveOptions{Format: FormatBMP24}); err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+				if !bytes.Equal(out, encoded.Bytes()) {
+					t.Error("SerializeBMP and Encode disagree")
+				}
+				if !bytes.Equal(out, encodeBMP(t, image)) {
+					t.Error("SerializeBMP and EncodeBMP disagree")
+				}
+			})
+		}
+	}
+}
+
+// TestGray8Output writes known colors turned gray by the grayscale filter
+// as gray8, and checks the layout of the file and the levels it holds.
+func TestGray8Output(t *testing.T) {
+	colors := []struct {
+		p    Pixel
+		want byte // 0.2126 red + 0.7152 green + 0.0722 blue, rounded
+	}{
+		{Pixel{Red: 255}, 54},
+		{Pixel{Green: 255}, 182},
+		{Pixel{Blue: 255}, 18},
+		{Pixel{Red: 200, Green: 100, Blue: 50}, 118},
+		{Pixel{Red: 255, Green: 255, Blue: 255}, 255},
+	}
+	const height = 3
+	image := NewImage(len(colors), height)
+	for _, row := range image.Data {
+		for x, c := range colors {
+			row[x] = c.p
+		}
+	}
+	opts, err := parseFilterOptions("grayscale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Filter(image, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, image, SaveOptions{Format: FormatGray8}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	b := buf.Bytes()
+
+	// 5 pixels of 1 byte are padded to a stride of 8, after 256 colors of 4 bytes
+	const stride = 8
+	if want := 14 + 40 + 256*4 + stride*height; len(b) != want {
+		t.Fatalf("wrote %d bytes, want %d", len(b), want)
+	}
+	header, err := parseHeaders(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := header.InfoHeader; h.BitsPerPixel != 8 || h.ColorsUsed != 256 || h.ImageSize != stride*height ||
+		header.Header.DataOffset != 1078 || int(header.Header.FileSize) != len(b) {
+		t.Errorf("headers %+v %+v", header.Header, h)
+	}
+	for i := range 256 {
+		if entry := b[54+4*i : 54+4*i+4]; entry[0] != byte(i) || entry[1] != byte(i) || entry[2] != byte(i) {
+			t.Fatalf("palette entry %d is % x", i, entry)
+		}
+	}
+	for y := range height {
+		row := b[1078+y*stride : 1078+(y+1)*stride]
+		for x, c := range colors {
+			if row[x] != c.want {
+				t.Errorf("stored row %d: %v is at level %d, want %d", y, c.p, row[x], c.want)
+			}
+		}
+		if pad := row[len(colors):]; !bytes.Equal(pad, make([]byte, len(pad))) {
+			t.Errorf("stored row %d is padded with % x", y, pad)
+		}
+	}
+
+	decoded, err := DecodeImage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, same := firstDifference(decoded, image); !same {
+		t.Errorf("pixel (%d, %d) decodes as %v, was %v", x, y, decoded.At(x, y), image.At(x, y))
+	}
+
+	// Colors are refused rather than silently turned gray
+	if err := Encode(&buf, grayRow(1, 2, 3), SaveOptions{Format: FormatGray8}); err != nil {
+		t.Fatalf("a gray image: %v", err)
+	}
+	image.Data[0][0].Blue++
+	if err := Encode(&buf, image, SaveOptions{Format: FormatGray8}); !errors.Is(err, ErrNotGrayscale) {
+		t.Errorf("a color image: got %v, want ErrNotGrayscale", err)
+	}
+}
+
+func TestBackgroundComposite(t *testing.T) {
+	src := Pixel{Red: 200, Green: 100}
+	alphas := []byte{255, 0, 128, 64, 255, 255, 255, 255, 0, 128}
+	image := NewImage(len(alphas), 1)
+	image.Alpha = [][]byte{alphas}
+	for x := range image.Data[0] {
+		image.Data[0][x] = src
+	}
+
+	// Every channel is s*a + d*(255-a) over 255, rounded
+	tests := []struct {
+		background string
+		want       map[int]Pixel
+	}{
+		{"blue", map[int]Pixel{
+			0: src,
+			1: {Blue: 255},
+			2: {Red: 100, Green: 50, Blue: 127},
+			3: {Red: 50, Green: 25, Blue: 191},
+			8: {Blue: 255},
+			9: {Red: 100, Green: 50, Blue: 127},
+		}},
+		// The squares are 8 pixels wide, light then dark
+		{"checker", map[int]Pixel{
+			0: src,
+			1: checkerLight,
+			2: {Red: 227, Green: 177, Blue: 127},
+			3: {Red: 241, Green: 216, Blue: 191},
+			8: checkerDark,
+			9: {Red: 202, Green: 152, Blue: 102},
+		}},
+	}
+	for _, tt := range tests {
+		opts, _, err := ParseApplyOptions([]string{"--background=" + tt.background, "in.bmp", "out.ppm"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.Save.Format = FormatPPM
+		var buf bytes.Buffer
+		if err := Encode(&buf, image, opts.Save); err != nil {
+			t.Fatal(err)
+		}
+		out, err := DecodeImage(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x, want := range tt.want {
+			if got := out.Data[0][x]; got != want {
+				t.Errorf("--background=%s: alpha %d gives %v, want %v", tt.background, alphas[x], got, want)
+			}
+		}
+	}
+	if image.Alpha == nil || image.Data[0][1] != src {
+		t.Error("encoding flattened the image itself")
+	}
+}
+
+func TestAlignedLayout(t *testing.T) {
+	for _, align := range []int{4, 8, 16} {
+		for width := 1; width <= 6; width++ {
+			const height = 3
+			image := noiseImage(width, height, int64(width))
+			var buf bytes.Buffer
+			if err := Encode(&buf, image, SaveOptions{Format: FormatBMP24, Align: align}); err != nil {
+				t.Fatalf("align %d, width %d: %v", align, width, err)
+			}
+			b := buf.Bytes()
+
+			// 3 bytes a pixel, rounded up to a multiple of align
+			stride := (3*width + align - 1) / align * align
+			if want := 54 + stride*height; len(b) != want {
+				t.Fatalf("align %d, width %d: wrote %d bytes, want %d", align, width, len(b), want)
+			}
+			header, err := parseHeaders(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := header.InfoHeader; int(h.ImageSize) != stride*height || int(header.Header.FileSize) != len(b) || header.Header.DataOffset != 54 {
+				t.Errorf("align %d, width %d: headers %+v %+v", align, width, header.Header, h)
+			}
+
+			// Rows are stored bottom-up, each followed by zeroed padding
+			for y := range height {
+				row := b[54+y*stride : 54+(y+1)*stride]
+				for x, p := range image.Data[height-1-y] {
+					if got := row[3*x : 3*x+3]; got[0] != p.Blue || got[1] != p.Green || got[2] != p.Red {
+						t.Fatalf("align %d, width %d: stored row %d has % x at %d, want %v", align, width, y, got, x, p)
+					}
+				}
+				for i, v := range row[3*width:] {
+					if v != 0 {
+						t.Fatalf("align %d, width %d: padding byte %d of stored row %d is %#x", align, width, i, y, v)
+					}
+				}
+			}
+
+			decoded, err := ParseBMP(b)
+			if err != nil {
+				t.Fatalf("align %d, width %d: %v", align, width, err)
+			}
+			if !gridsEqual(decoded.Data, image.Data) {
+				t.Errorf("align %d, width %d: decodes to other pixels", align, width)
+			}
+		}
+	}
+}
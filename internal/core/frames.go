@@ -0,0 +1,107 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// FramesOptions holds the flags of the frames command.
+type FramesOptions struct {
+	Cols, Rows int // Grid size of the sprite sheet
+	Frame      int // Index of the only frame to extract, or -1 for all of them
+}
+
+// ParseFramesArgs parses the frames command arguments: options, the input file and the output directory.
+func ParseFramesArgs(args []string) (FramesOptions, string, string, error) {
+	opts := FramesOptions{Frame: -1}
+
+	if len(args) < 2 {
+		return opts, "", "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-2] {
+		switch {
+		case strings.HasPrefix(arg, "--grid="):
+			cols, rows, ok := strings.Cut(strings.TrimPrefix(arg, "--grid="), "x")
+			var errCols, errRows error
+			opts.Cols, errCols = strconv.Atoi(cols)
+			opts.Rows, errRows = strconv.Atoi(rows)
+			if !ok || errCols != nil || errRows != nil || opts.Cols <= 0 || opts.Rows <= 0 {
+				return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("invalid grid option: %s (expected COLSxROWS)", arg))
+			}
+		case strings.HasPrefix(arg, "--frame="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--frame="))
+			if err != nil || n < 0 {
+				return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("invalid frame option: %s", arg))
+			}
+			opts.Frame = n
+		default:
+			return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	if opts.Cols == 0 {
+		return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("missing --grid option"))
+	}
+	if opts.Frame >= opts.Cols*opts.Rows {
+		return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("frame %d out of range: the grid has %d frames", opts.Frame, opts.Cols*opts.Rows))
+	}
+
+	return opts, args[len(args)-2], args[len(args)-1], nil
+}
+
+// FrameRect returns the crop area of frame n in a cols x rows grid laid over
+// an image of the given dimensions. Frames are numbered from 0 in row-major
+// order starting at the visual top-left. The grid must divide the image evenly,
+// or else an error of kind ErrOutOfBounds is returned.
+func FrameRect(width, height, cols, rows, n int) (CropInfo, error) {
+	if width%cols != 0 || height%rows != 0 {
+		return CropInfo{}, withKind(ErrOutOfBounds, fmt.Errorf("%dx%d grid does not divide %dx%d image evenly (remainder %d columns, %d rows)",
+			cols, rows, width, height, width%cols, height%rows))
+	}
+
+	frameW, frameH := width/cols, height/rows
+	return CropInfo{
+		OffsetX: (n % cols) * frameW,
+		OffsetY: (n / cols) * frameH,
+		Width:   frameW,
+		Height:  frameH,
+	}, nil
+}
+
+// WriteFrames crops the frames selected by opts out of image and saves each
+// one as frame_N.bmp in outDir, creating the directory if needed. Only the
+// pixels of each frame are copied, and nothing is created if the grid doesn't
+// fit the image. Failing to write a frame is an error of kind ErrIO.
+func WriteFrames(image *BMPImage, opts FramesOptions, outDir string) error {
+	width := int(image.InfoHeader.Width)
+	height := utils.Abs(int(image.InfoHeader.Height))
+
+	first, last := 0, opts.Cols*opts.Rows-1
+	if opts.Frame >= 0 {
+		first, last = opts.Frame, opts.Frame
+	}
+
+	// Every frame has the same size, so checking one checks the whole grid
+	if _, err := FrameRect(width, height, opts.Cols, opts.Rows, first); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return ioError(err)
+	}
+
+	for n := first; n <= last; n++ {
+		rect, _ := FrameRect(width, height, opts.Cols, opts.Rows, n)
+		frame := cropRect(image, rect)
+		if err := SaveBMP(frame, filepath.Join(outDir, fmt.Sprintf("frame_%d.bmp", n))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// spriteSheet returns a cols x rows grid of frameW x frameH frames, where
+// every pixel of frame n is Pixel{Red: n, Green: x, Blue: y} for its
+// position (x, y) inside the frame.
+func spriteSheet(cols, rows, frameW, frameH int) *BMPImage {
+	sheet := NewImage(cols*frameW, rows*frameH)
+	for y, row := range sheet.Rows() {
+		for x := range row {
+			n := y/frameH*cols + x/frameW
+			row[x] = Pixel{Red: byte(n), Green: byte(x % frameW), Blue: byte(y % frameH)}
+		}
+	}
+	return sheet
+}
+
+func TestWriteFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame int
+		want  []int
+	}{
+		{"all frames", -1, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"one frame", 5, []int{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "out")
+			sheet := spriteSheet(4, 2, 3, 5)
+			if err := WriteFrames(sheet, FramesOptions{Cols: 4, Rows: 2, Frame: tt.frame}, dir); err != nil {
+				t.Fatalf("WriteFrames: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("wrote %d files, want %d", len(entries), len(tt.want))
+			}
+
+			for _, n := range tt.want {
+				frame, err := LoadBMP(filepath.Join(dir, fmt.Sprintf("frame_%d.bmp", n)))
+				if err != nil {
+					t.Fatalf("frame %d: %v", n, err)
+				}
+				if w, h := int(frame.InfoHeader.Width), len(frame.Data); w != 3 || h != 5 {
+					t.Fatalf("frame %d is %dx%d, want 3x5", n, w, h)
+				}
+				for y, row := range frame.Rows() {
+					for x, p := range row {
+						if want := (Pixel{Red: byte(n), Green: byte(x), Blue: byte(y)}); p != want {
+							t.Fatalf("frame %d: pixel (%d, %d) = %v, want %v", n, x, y, p, want)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFramesUnevenGrid(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	err := WriteFrames(spriteSheet(4, 2, 3, 5), FramesOptions{Cols: 5, Rows: 2, Frame: -1}, dir)
+	if !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("got error %v, want kind ErrOutOfBounds", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("output directory was created for an invalid grid")
+	}
+}
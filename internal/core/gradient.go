@@ -0,0 +1,200 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GradientOptions describes a generated gradient and how it is applied.
+type GradientOptions struct {
+	Kind       string  // "linear" or "radial"
+	Angle      float64 // Direction of a linear gradient in degrees: 0 runs left to right, 90 top to bottom
+	From, To   Pixel   // Colors at the start and the end of the gradient
+	Opacity    float64 // Opacity of the gradient over the image, in [0, 1]
+	Normalized bool    // Lay the gradient out on a unit square stretched over the image
+	Replace    bool    // Replace the image with the gradient instead of compositing over it
+}
+
+func (o GradientOptions) Validate(width, height int) error        { return nil }
+func (o GradientOptions) Dimensions(width, height int) (int, int) { return width, height }
+
+// MemoryMultiplier is 2 since the gradient is rendered into an image of its own.
+func (o GradientOptions) MemoryMultiplier() int { return 2 }
+
+func (o GradientOptions) String() string {
+	name := "gradient"
+	if o.Replace {
+		name = "gradient-only"
+	}
+	if o.Kind == "linear" {
+		return fmt.Sprintf("%s linear %g°", name, o.Angle)
+	}
+	return name + " radial"
+}
+
+// gradientKinds are the kinds of gradients accepted by --gradient.
+var gradientKinds = []string{"linear", "radial"}
+
+// defaultGradientOpacity is the opacity of a gradient unless one is given.
+const defaultGradientOpacity = 1.0
+
+// parseGradientOptions parses a gradient value of the form
+// linear:<angle>:<from>:<to>[:<opacity>][:normalized] or
+// radial:<from>:<to>[:<opacity>][:normalized], with colors as accepted by ParseColor.
+func parseGradientOptions(value string, replace bool) (GradientOptions, error) {
+	parts := strings.Split(value, ":")
+	opts := GradientOptions{Kind: parts[0], Opacity: defaultGradientOpacity, Replace: replace}
+	args := parts[1:]
+
+	if !slices.Contains(gradientKinds, opts.Kind) {
+		return opts, fmt.Errorf("invalid gradient option: %s (must be %s)", opts.Kind, strings.Join(gradientKinds, " or "))
+	}
+	if opts.Kind == "linear" {
+		if len(args) == 0 {
+			return opts, fmt.Errorf("linear gradient requires an angle: linear:<angle>:<from>:<to>")
+		}
+		angle, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || math.IsInf(angle, 0) || math.IsNaN(angle) {
+			return opts, fmt.Errorf("invalid gradient angle: %s", args[0])
+		}
+		opts.Angle = angle
+		args = args[1:]
+	}
+
+	if n := len(args); n > 0 && args[n-1] == "normalized" {
+		opts.Normalized = true
+		args = args[:n-1]
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return opts, fmt.Errorf("gradient requires two colors and an optional opacity: %s", value)
+	}
+
+	var err error
+	if opts.From, err = ParseColor(args[0]); err != nil {
+		return opts, err
+	}
+	if opts.To, err = ParseColor(args[1]); err != nil {
+		return opts, err
+	}
+	if len(args) == 3 {
+		opts.Opacity, err = strconv.ParseFloat(args[2], 64)
+		if err != nil || opts.Opacity < 0 || opts.Opacity > 1 {
+			return opts, fmt.Errorf("invalid gradient opacity: %s (must be in [0, 1])", args[2])
+		}
+	}
+
+	return opts, nil
+}
+
+// RenderGradient returns an opaque image of the given size filled with the gradient.
+//
+// Positions are measured between pixel centers, so the first and last pixels
+// along the gradient get exactly the From and To colors. A linear gradient
+// projects every pixel on its axis: by default the axis is taken in pixel
+// space, so 45° runs along true diagonal lines whatever the aspect ratio, and
+// with Normalized it is taken on the unit square stretched over the image, so
+// 45° runs from the top-left to the bottom-right corner with lines parallel to
+// the other diagonal. A radial gradient goes from the center to the farthest
+// corner, on a circle, or on an ellipse of the image's proportions if Normalized.
+func RenderGradient(width, height int, opts GradientOptions) *BMPImage {
+	g := NewImage(width, height)
+
+	// Coordinates of pixel (x, y) on the gradient plane.
+	sx, sy := 1.0, 1.0
+	if opts.Normalized {
+		sx, sy = 1/float64(max(width-1, 1)), 1/float64(max(height-1, 1))
+	}
+	lastX, lastY := float64(width-1)*sx, float64(height-1)*sy
+
+	var at func(px, py float64) float64
+	switch opts.Kind {
+	case "linear":
+		rad := opts.Angle * math.Pi / 180
+		dx, dy := math.Cos(rad), math.Sin(rad)
+		// The projections of the corners bound the projection of every pixel.
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, c := range [][2]float64{{0, 0}, {lastX, 0}, {0, lastY}, {lastX, lastY}} {
+			p := c[0]*dx + c[1]*dy
+			lo, hi = min(lo, p), max(hi, p)
+		}
+		at = func(px, py float64) float64 {
+			if hi-lo < 1e-9 {
+				return 0
+			}
+			return (px*dx + py*dy - lo) / (hi - lo)
+		}
+	default:
+		cx, cy := lastX/2, lastY/2
+		far := math.Hypot(cx, cy)
+		at = func(px, py float64) float64 {
+			if far == 0 {
+				return 0
+			}
+			return math.Hypot(px-cx, py-cy) / far
+		}
+	}
+
+	lerp := func(a, b byte, t float64) byte {
+		return clampRound(float64(a) + (float64(b)-float64(a))*t)
+	}
+	for y, row := range g.Rows() {
+		for x := range row {
+			t := min(max(at(float64(x)*sx, float64(y)*sy), 0), 1)
+			row[x] = Pixel{
+				Blue:  lerp(opts.From.Blue, opts.To.Blue, t),
+				Green: lerp(opts.From.Green, opts.To.Green, t),
+				Red:   lerp(opts.From.Red, opts.To.Red, t),
+			}
+		}
+	}
+	return g
+}
+
+// Gradient renders the gradient over the whole image and composites it on
+// top with its opacity, or with Replace makes the image the gradient itself,
+// keeping the opacity in the alpha channel if it is below 1. Widened images
+// are blended at 16-bit precision.
+func Gradient(image *BMPImage, opts GradientOptions) error {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	g := RenderGradient(width, height, opts)
+
+	alpha := clampRound(opts.Opacity * 255)
+	if opts.Replace {
+		for y, row := range g.Rows() {
+			copy(image.Data[y], row)
+		}
+		image.Alpha = nil
+		if alpha < 255 {
+			image.Alpha = constantAlpha(width, height, alpha)
+		}
+		if image.Wide != nil {
+			image.Widen()
+		}
+		return nil
+	}
+
+	if alpha < 255 {
+		g.Alpha = constantAlpha(width, height, alpha)
+	}
+	// A widened image is blended at 16 bits, keeping its precision
+	if image.Wide != nil {
+		compositeWide(image, g)
+		return nil
+	}
+	return Composite(image, g, 0, 0, SrcOver)
+}
+
+// constantAlpha returns an alpha channel of the given size with every pixel set to a.
+func constantAlpha(width, height int, a byte) [][]byte {
+	alpha := make([][]byte, height)
+	for y := range alpha {
+		alpha[y] = make([]byte, width)
+		for x := range alpha[y] {
+			alpha[y][x] = a
+		}
+	}
+	return alpha
+}
@@ -0,0 +1,43 @@
+package core
+
+import "testing"
+
+func TestGradientKeepsWidePrecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		opacity float64
+		level   uint16
+		want    uint16
+	}{
+		// A black gradient at alpha 128 keeps 127/255 of the image
+		{"half opacity", 0.5, 1000, uint16((1000*127*255 + 65025/2) / 65025)},
+		{"transparent", 0, 1000, 1000},
+		{"opaque", 1, 1000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := NewImage(5, 3)
+			image.Widen()
+			for _, row := range image.Wide {
+				for x := range row {
+					row[x] = Pixel16{Blue: tt.level, Green: tt.level, Red: tt.level}
+				}
+			}
+
+			if err := Gradient(image, GradientOptions{Kind: "linear", Opacity: tt.opacity}); err != nil {
+				t.Fatalf("Gradient: %v", err)
+			}
+			if image.Wide == nil {
+				t.Fatal("the image is no longer widened")
+			}
+			for y, row := range image.Wide {
+				for x, p := range row {
+					if want := (Pixel16{Blue: tt.want, Green: tt.want, Red: tt.want}); p != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, p, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultGuideColorName is the color of the guides unless one is given:
+// magenta, which rarely blends into a photo.
+const defaultGuideColorName = "fuchsia"
+
+var defaultGuideColor = colorNames[defaultGuideColorName]
+
+// guideKinds are the kinds of guides accepted by --guides.
+var guideKinds = []string{"thirds", "golden", "grid"}
+
+// GuidesOptions stores the kind of guide overlay to draw and its color.
+type GuidesOptions struct {
+	Kind  string // "thirds", "golden" or "grid"
+	Cells int    // Number of cells per side for the grid
+	Color Pixel
+}
+
+func (o GuidesOptions) Validate(width, height int) error        { return nil }
+func (o GuidesOptions) Dimensions(width, height int) (int, int) { return width, height }
+func (o GuidesOptions) MemoryMultiplier() int                   { return 1 }
+
+func (o GuidesOptions) String() string {
+	if o.Kind == "grid" {
+		return fmt.Sprintf("guides grid:%d", o.Cells)
+	}
+	return "guides " + o.Kind
+}
+
+// parseGuidesOptions parses a guides value of the form thirds, golden or
+// grid:<N>, optionally followed by a color as accepted by ParseColor.
+func parseGuidesOptions(value string) (GuidesOptions, error) {
+	parts := strings.Split(value, ":")
+	opts := GuidesOptions{Kind: parts[0], Color: defaultGuideColor}
+	args := parts[1:]
+
+	if !slices.Contains(guideKinds, opts.Kind) {
+		return opts, fmt.Errorf("invalid guides option: %s", opts.Kind)
+	}
+	if opts.Kind == "grid" {
+		if len(args) == 0 {
+			return opts, fmt.Errorf("grid guides require a cell count: grid:<N>")
+		}
+		cells, err := strconv.Atoi(args[0])
+		if err != nil || cells < 2 {
+			return opts, fmt.Errorf("invalid guides grid value: %s (must be at least 2)", args[0])
+		}
+		opts.Cells = cells
+		args = args[1:]
+	}
+
+	switch len(args) {
+	case 0:
+	case 1:
+		color, err := ParseColor(args[0])
+		if err != nil {
+			return opts, err
+		}
+		opts.Color = color
+	default:
+		return opts, fmt.Errorf("too many guides parameters: %s", value)
+	}
+
+	return opts, nil
+}
+
+// guidePositions returns the columns (or rows) at which the guides of the
+// given kind are drawn along a side of length size. Every position is the
+// exact division point size*fraction rounded to the nearest pixel, with
+// halves rounded up, and then clamped into the image; e.g. thirds of 90 land
+// on 30 and 60, and thirds of 100 on 33 and 67.
+func guidePositions(opts GuidesOptions, size int) []int {
+	var fractions []float64
+	switch opts.Kind {
+	case "thirds":
+		fractions = []float64{1.0 / 3, 2.0 / 3}
+	case "golden":
+		phi := (1 + math.Sqrt(5)) / 2
+		fractions = []float64{1 - 1/phi, 1 / phi}
+	case "grid":
+		for i := 1; i < opts.Cells; i++ {
+			fractions = append(fractions, float64(i)/float64(opts.Cells))
+		}
+	}
+
+	positions := make([]int, len(fractions))
+	for i, f := range fractions {
+		positions[i] = min(int(math.Floor(snap(float64(size)*f)+0.5)), size-1)
+	}
+	return positions
+}
+
+// Guides draws 1px composition guides over the image: vertical lines at
+// the guide columns and horizontal lines at the guide rows.
+func Guides(image *BMPImage, opts GuidesOptions) {
+	height := len(image.Data)
+	width := len(image.Data[0])
+
+	for _, x := range guidePositions(opts, width) {
+		DrawLine(image, x, 0, x, height-1, opts.Color)
+	}
+	for _, y := range guidePositions(opts, height) {
+		DrawLine(image, 0, y, width-1, y, opts.Color)
+	}
+}
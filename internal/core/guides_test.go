@@ -0,0 +1,38 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGuidesThirds(t *testing.T) {
+	opts, err := parseGuidesOptions("thirds:red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := NewImage(90, 90)
+	Guides(image, opts)
+
+	// Exactly the pixels of the rows and columns 30 and 60 are drawn
+	lines := []int{30, 60}
+	for y, row := range image.Rows() {
+		for x, p := range row {
+			want := Pixel{}
+			if slices.Contains(lines, x) || slices.Contains(lines, y) {
+				want = Pixel{Red: 255}
+			}
+			if p != want {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, p, want)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		size int
+		want []int
+	}{{90, []int{30, 60}}, {100, []int{33, 67}}, {3, []int{1, 2}}, {1, []int{0, 0}}} {
+		if got := guidePositions(opts, tt.size); !slices.Equal(got, tt.want) {
+			t.Errorf("thirds of %d at %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
@@ -2,20 +2,45 @@ package core
 
 import "fmt"
 
-func PrintUsage(opts ...string) {
-	if len(opts) < 1 {
-		fmt.Print(MainHelp)
-		return
-	}
+// commandHelp maps the commands to their usage, as printed by
+// bitmap <command> --help and bitmap help <command>.
+var commandHelp = map[string]string{
+	"header":          HeaderHelp,
+	"histogram":       HistogramHelp,
+	"apply":           ApplyHelp,
+	"compare":         CompareHelp,
+	"rowhash":         RowHashHelp,
+	"motion":          MotionHelp,
+	"frames":          FramesHelp,
+	"pyramid":         PyramidHelp,
+	"merge-exposures": MergeHelp,
+	"align-channels":  AlignChannelsHelp,
+	"dump":            DumpHelp,
+	"orient":          OrientHelp,
+	"blobs":           BlobsHelp,
+	"suggest-crop":    SuggestCropHelp,
+	"stereo":          StereoHelp,
+	"mosaic":          MosaicHelp,
+	"stamp":           StampHelp,
+	"generate":        GenerateHelp,
+	"verify-pattern":  VerifyPatternHelp,
+	"export-raw":      ExportRawHelp,
+	"import-raw":      ImportRawHelp,
+	"alpha":           AlphaHelp,
+	"canonicalize":    CanonicalizeHelp,
+	"clipboard":       ClipboardHelp,
+	"interactive":     InteractiveHelp,
+	"capabilities":    CapabilitiesHelp,
+}
 
-	switch opts[0] {
-	case "header":
-		fmt.Print(HeaderHelp)
-	case "apply":
-		fmt.Print(ApplyHelp)
-	default:
-		fmt.Print(MainHelp)
+func PrintUsage(opts ...string) {
+	if len(opts) > 0 {
+		if help, ok := commandHelp[opts[0]]; ok {
+			fmt.Print(help)
+			return
+		}
 	}
+	fmt.Print(MainHelp)
 }
 
 const (
@@ -23,19 +48,91 @@ const (
   bitmap <command> [arguments]
 
 The commands are:
-  header    prints bitmap file header information
-  apply     applies processing to the image and saves it to the file
+  header           prints bitmap file header information
+  histogram        prints the luminance histogram of an image as a bar chart
+  apply            applies processing to the image and saves it to the file
+  compare          reports the pixels that differ between two images
+  rowhash          writes the CRC-32 of every row of a bitmap, for compare --by-row
+  motion           writes a mask of the pixels that changed between two frames
+  frames           splits a sprite sheet laid out in a grid into separate frames
+  pyramid          writes an image and successively halved versions of it for previews
+  merge-exposures  fuses bracketed shots of a scene into one image
+  align-channels   lines up and merges the red, green and blue plates of a color separation
+  dump             prints the bytes of a bitmap row with their file offsets
+  orient           flips an image to match the orientation of a reference image
+  blobs            counts and measures the connected regions of a thresholded image
+  suggest-crop     finds the crop of a given aspect ratio that keeps the most detail
+  stereo           splits, joins or makes an anaglyph of side-by-side stereo images
+  mosaic           rebuilds an image out of the tiles of a library of images
+  stamp            prints the provenance stamp of a BMP file written by apply --stamp
+  generate         writes a test pattern that encodes the coordinates of every pixel
+  verify-pattern   checks a captured test pattern and diagnoses how it was damaged
+  export-raw       writes the pixels of an image as a raw dump with a JSON descriptor
+  import-raw       reads a raw dump back into an image given its descriptor
+  alpha            writes the alpha channel of an image as a mask, or sets it from one
+  canonicalize     rewrites an image as a BMP whose bytes only depend on its pixels
+  clipboard        saves the image on the Windows clipboard to a file, or copies one to it
+  interactive      loads an image once and applies transformations typed one at a time
+  capabilities     lists the formats, filters, transformations and limits supported
+  help             explains a command, or a flag or filter of apply, e.g. bitmap help crop
 
 Use "bitmap <command> --help" for more information about a command.
 `
 	HeaderHelp = `Usage:
-  bitmap header <source_file>
+  bitmap header [--thumbnail[=<mode>]] [--width=<n>] [--comments] [--encoding-analysis]
+                [--verbose] <source_file>
 
 Description:
-  Prints bitmap file header information
+  Prints bitmap file header information, and with --verbose warnings about the oddities
+  of the file that were worked around, such as an uncommon DIB header whose extra fields
+  were skipped
 
 Arguments:
   <source_file>    Path to the source bitmap (.bmp) file
+
+Options:
+  --thumbnail[=<mode>]  Also show a preview of the image, scaled down to fit 128 pixels, or
+                        64 characters in ASCII. Modes: sixel, iterm (the inline images of
+                        iTerm2 and WezTerm) or ascii. Without a mode, it is chosen from the
+                        TERM_PROGRAM and TERM environment variables, falling back to ascii
+  --width=<n>           Width of ASCII previews in characters, at least 20. Defaults to 64, or
+                        the width of the terminal if narrower
+  --comments            Also print the comments added by bitmap apply --comment, in order
+  --encoding-analysis   Also print the distinct colors and rows, the average run of equal pixels
+                        along a row, and the size of the file bmp24, bmp8 and rle8 output gives,
+                        with the smallest lossless one, which apply --format=auto picks
+  --verbose             Also print, to standard error, the warnings of the decoder about the file
+
+Examples:
+  bitmap header photo.bmp
+  bitmap header --verbose photo.bmp
+  bitmap header --comments photo.bmp
+  bitmap header --encoding-analysis logo.bmp
+  bitmap header --thumbnail photo.bmp
+  bitmap header --thumbnail=ascii photo.bmp
+  bitmap header --thumbnail=ascii --width=120 photo.bmp
+`
+	HistogramHelp = `Usage:
+  bitmap histogram [--width=<n>] <source_file>
+
+Description:
+  Prints how many pixels of an image fall in each of 16 ranges of luminance, as a bar
+  chart as wide as the terminal. The width is asked of the terminal, or else read from
+  the COLUMNS environment variable, or else taken as 80. On narrow terminals the ranges
+  are shortened to their first value, then the counts are left out, to keep room for
+  the bars.
+
+Arguments:
+  <source_file>    Path to the source image: BMP, PNG, JPEG, PPM or PGM, recognized by its
+                   content, or - for standard input
+
+Options:
+  --width=<n>      Width of the chart in characters, at least 20, instead of that of the
+                   terminal
+
+Examples:
+  bitmap histogram photo.bmp
+  bitmap histogram --width=40 photo.bmp
 `
 	ApplyHelp = `Usage:
   bitmap apply [options] <source_file> <output_file>
@@ -44,18 +141,615 @@ Description:
   Applies processing to the image and saves it to the file
 
 Arguments:
-  <source_file>    Path to the source bitmap file
-  <output_file>    Path to save the processed bitmap file
+  <source_file>    Path to the source image: BMP, PNG, JPEG, PPM, PGM or a native frame, recognized by
+                   its content, or - for standard input
+  <output_file>    Path to save the processed image, or - for standard output
 
 Options:
   --mirror=<value>        Mirror the image. Values: horizontal, h, horizontally, hor, vertical, v, vertically, ver
-  --filter=<value>        Apply a filter. Can be used multiple times. Values: blue, red, green, grayscale, negative, pixelate, blur
-                          Default values: pixelate = 20px, blur = 20px
+  --filter=<value>        Apply a filter. Can be used multiple times. Values: blue, red, green, grayscale, negative, pixelate, blur,
+                          levels:<black>:<white>, autocontrast[:<clip%>], gamma:<value>,
+                          curve:<red|green|blue|rgb>:<in>/<out>,... (monotone cubic, 0/0 and 255/255 implied),
+                          adaptivethreshold:<window>[:<bias>] (black and white against the local mean),
+                          localcontrast:<radius>:<amount> (clarity; changes capped at 32 levels to avoid halos),
+                          kuwahara:<radius> (edge-preserving smoothing, painterly at large radii),
+                          erode:<radius>, dilate:<radius>, open:<radius>, close:<radius> (per-channel
+                          minimum or maximum over the square around each pixel, and their compositions),
+                          blur:<radius>[:<edge>] with edge shrink (default, averages fewer pixels at the
+                          edges), clamp (repeat the edge pixel), mirror (reflect) or wrap (tile)
+                          blue, red and green take an optional mode: :luma shows the channel as gray,
+                          :tint colorizes the luminance with the channel's hue
+                          Default values: pixelate = 50px, blur = 20px, autocontrast clip = 0%
+                          Any filter takes a last :opacity=<0-100> to blend the result over the original,
+                          e.g. grayscale:opacity=50 for half the effect; 0 skips the filter
+  --blur-radius=<n>       Radius of every blur filter that doesn't give its own (default 20)
+  --pixelate-size=<n>     Block size of every pixelate filter (default 50, or the image size if smaller)
+  --region=<value>        Limit the next --filter to a region: rect:<x>:<y>:<w>:<h> or ellipse:<cx>:<cy>:<rx>:<ry>
+  --feather=<n>           After --region, blend the filter in over a band of n pixels across the region boundary
   --rotate=<value>        Rotate the image. Can be used multiple times. Values: right, 90, 180, 270, left, -90, -180, -270
   --crop=<value>          Crop the image. Format: OffsetX-OffsetY-Width-Height. Width and Height are optional
+                          Or a named region with an optional fraction (default 0.5): top, bottom, left, right, center,
+                          e.g. top:0.33. Top and left round down, bottom and right round up
+                          Or rows:<start>-<end> or cols:<start>-<end> for full-width rows or full-height
+                          columns from start up to but not including end, e.g. rows:100-200
+  --tee=<path>            Save the image as it is at this point of the pipeline. Can be used multiple times
+  --guides=<value>        Draw 1px guide lines. Values: thirds, golden, grid:<N>, optionally followed by
+                          :<color> (default fuchsia). Lines go on the nearest pixel, halves round up
+  --gradient=<value>      Composite a gradient over the image. Values: linear:<angle>:<from>:<to>[:<opacity>],
+                          radial:<from>:<to>[:<opacity>], angle 0 = left to right,
+                          90 = top to bottom. The axis is in pixel space; append :normalized to stretch
+                          a unit square over the image instead
+  --gradient-only=<value> Like --gradient, but replace the image with the gradient
+  --chop=<edge>:<n>       Delete n columns or rows from an edge: left, right, top or bottom, e.g. right:1
+  --pixelate-mask=<value> Pixelate only where a mask image of the same size is brighter than mid-gray.
+                          Format: <mask>:<blocksize>. Blocks partly under the mask are pixelated whole
+  --extend=<edge>:<n>     Grow the image by n columns or rows at an edge by repeating the outermost ones,
+                          e.g. bottom:2. The form edge:<edge>:<n> is accepted too
+  --affine=<matrix>       Map every point (x, y) through the affine matrix a,b,c,d,e,f to
+                          (a*x + b*y + c, d*x + e*y + f), from the top-left with y down, sampling bilinearly.
+                          Append :<color> for the uncovered pixels (default black), e.g. 1,0.3,0,0,1,0:white
+  --affine-fit=<matrix>   Like --affine, but size the output to the bounding box of the transformed image
+  --kaleidoscope=<n>      Mirror a wedge of the image around its center into n segments, n even: 2 mirrors the
+                          left half, 4 the top-left quadrant, and higher counts wedges sampled bilinearly
+  --scroll=<axis>:<n>     Move the content n pixels right (x) or down (y) with wrap-around, e.g. x:-10.
+                          n is taken modulo the width or height
+  --expr=<program>        Compute channels per pixel, e.g. "r=(r+g)/2; b=255-b". Reads r, g, b, x, y, w, h;
+                          supports + - * /, min, max, clamp(v, lo, hi). Results are clamped to 0-255
+  --tiled[=<rows>]        Stream the image in bands of rows (default 64) instead of decoding it whole.
+                          Only a single --filter=blur with the shrink edge mode is supported in this mode
+  --format=<value>        Output format. Values: bmp24, bmp32 (with the alpha of transparent input),
+                          bmp8 (256-color palette, median cut), rle8 (bmp8 with run-length encoded rows,
+                          which this tool doesn't read back yet), auto (the smallest of bmp24, bmp8 and
+                          rle8 that keeps every pixel, see bitmap header --encoding-analysis),
+                          gray8 (8-bit grayscale, the image must already be gray), png, jpeg, ppm, pgm (gray),
+                          raw (pixel bytes only, rows from the top, no headers).
+                          Defaults to the output extension (.png, .jpg, .jpeg, .ppm, .pgm, .raw), else bmp24.
+                          Use it when writing to - (standard output) or to a path without an extension
+  --pipe-format=<value>   Format written to - (standard output) when --format isn't given: bmp (default) or
+                          native, a lossless frame that keeps the alpha plane and 16-bit precision and that
+                          the next bitmap reading - decodes without parsing BMP headers
+  --align=<n>             Pad bmp24 and raw rows to a multiple of n bytes: 4, 8 or 16. Defaults to 4 for
+                          bmp24, as the format requires, and to no padding for raw. Viewers only read 4
+  --color-profile=<mode>  Color space information of bmp24 output: keep (default) passes the V4/V5 header
+                          fields and ICC profile of the input through, strip writes a plain 40-byte header
+                          and srgb a V5 header tagged sRGB without an embedded profile
+  --canonical             Write bmp24 output in canonical form, so that images with the same pixels and
+                          resolution give the same bytes (see bitmap canonicalize --help)
+  --channels=<order>      Channel order of raw output, e.g. rgb (default), bgr, rgba or argb.
+                          The a channel is the alpha of transparent input, else 255
+  --background=<value>    What transparent input (PNG, 32-bit BMP) is flattened onto for formats without
+                          alpha: a color (default black), or checker for a white and gray checkerboard
+  --precision=<bits>      Bits per channel the filters work at: 8 (default) or 16. With 16, values are
+                          only rounded to 8 bits when saving, so chained filters don't band
+  --jobs=<n>              Number of goroutines the filters run on (default: one per CPU)
+  --max-memory=<size>     Refuse to run if the estimated peak memory exceeds size (e.g. 512MB, 2GB),
+                          counting the alpha plane and the 16-bit copy of --precision=16. Checked by
+                          --dry-run too, but not applied in tiled mode, which only holds a band of rows
+  --salvage[=<color>]     Decode a BMP with truncated pixel data, filling the missing rows with color
+                          (default fuchsia) instead of failing
+  --write-manifest        Also write <output_file>.json recording the input path and SHA-256, the transforms
+                          with their parameters, the tool version and the time
+  --stamp                 Mark BMP output with the first 8 bytes of the SHA-256 of that manifest, whether or
+                          not it is written, in the Reserved header field and a 16-byte trailer after the
+                          pixels that viewers ignore. Read it back with bitmap stamp read
+  --comment=<text>        Add a note to BMP output in a block after the pixels that viewers ignore. The
+                          comments of the input are kept, and repeated flags add several in order. Read
+                          them back with bitmap header --comments
+  --allow-huge            Allow images over 100 megapixels, which are refused by default when read
+                          or produced by a transformation in case of a typo in a size
+  --mmap                  Memory-map the input file instead of reading it, which is otherwise only done for
+                          files of 256 MiB and more, so that the file isn't held in memory next to the image
+  --check-invariants      Before processing, check that the input survives a BMP round trip unchanged and
+                          that a pixel set at the top-left corner is read back there, also by an
+                          independent decoder, golang.org/x/image/bmp. Fails if the BMP codec gets the row
+                          order wrong
+  --timeout=<duration>    Give up once the run has taken duration, e.g. 30s or 2m: stop whatever is running,
+                          even halfway through a filter, remove the partial output and exit with status 124
+  --verbose               Print the oddities of a BMP input that were worked around, such as an uncommon
+                          DIB header whose extra fields were skipped, and how long each transformation took
+  --progress              Draw the progress of decoding, transforming and encoding on standard error
+  --print-size            Print the exact size of the output file before writing it
+  --dry-run               Validate the transformations against the input size and print the plan,
+                          memory estimate and output size without writing
+
+Colors can be given as #RGB, #RRGGBB, RRGGBB, rgb(r,g,b) or one of the 16 basic CSS names
+(black, silver, gray, white, maroon, red, purple, fuchsia, green, lime, olive, yellow, navy, blue, teal, aqua).
 
 Examples:
   bitmap apply --mirror=horizontal --filter=grayscale input.bmp output.bmp
   bitmap apply --rotate=right --rotate=right --crop=20-20-100-100 input.bmp output.bmp
+  bitmap apply --filter=grayscale --tee=gray.bmp --filter=blur input.bmp output.bmp
+  bitmap apply --crop=left:0.66 --guides=thirds:00ff00 input.bmp output.bmp
+  bitmap apply --gradient=linear:90:#808080:#000000:0.6 input.bmp output.bmp
+  bitmap apply --chop=right:1 --extend=bottom:2 input.bmp output.bmp
+  bitmap apply --precision=16 --filter=gamma:2.2 --filter=gamma:0.4545 input.bmp output.bmp
+  bitmap apply --format=raw --channels=bgra --align=8 input.bmp framebuffer.raw
+  bitmap apply --precision=16 --filter=gamma:2.2 --pipe-format=native input.bmp - | bitmap apply --filter=blur - output.bmp
+`
+	CompareHelp = `Usage:
+  bitmap compare [options] <first_file> <second_file>
+
+Description:
+  Compares two images of the same size pixel by pixel and reports how many pixels
+  differ, by how much, and the bounding box of the differing region.
+  Exits with status 1 if the images differ, including in size, and with status 2
+  if they can't be compared (unreadable or unsupported file, invalid options).
+
+  With --by-row, or given two row index files written by bitmap rowhash, it compares
+  the CRC-32 of every row instead and lists the rows that differ. Neither image is
+  loaded whole: the rows of BMP files are streamed through the decoder one at a time,
+  which finds the few changed rows of huge scans quickly.
+
+Arguments:
+  <first_file>     Path to the first bitmap file, or row index file
+  <second_file>    Path to the second bitmap file, or row index file
+
+Options:
+  --tolerance=<n>  Largest per-channel difference still considered equal (default 0)
+  --diffs=<n>      List the first n differing pixels with their colors (default 0, max 1000)
+  --by-row         Compare row digests, listing the differing rows as ranges. Digests are
+                   exact, so this can't be combined with --tolerance or --diffs
+
+Examples:
+  bitmap compare expected.bmp actual.bmp
+  bitmap compare --tolerance=2 --diffs=10 expected.bmp actual.bmp
+  bitmap compare --by-row scan-a.bmp scan-b.bmp
+  bitmap compare scan-a.rows scan-b.rows
+`
+	RowHashHelp = `Usage:
+  bitmap rowhash <source_file> [<index_file>]
+
+Description:
+  Computes the CRC-32 of the pixels of every row of a BMP file, streaming the rows so
+  the image is never held whole, and writes them to a compact row index file, 4 bytes
+  a row, or prints them one per line with the row number if no index file is given.
+  bitmap compare lists the rows that differ between two index files, so a huge file
+  indexed once can be checked against others without being read again. Rows hash the
+  same whatever the bit depth and row order of their file.
+
+Arguments:
+  <source_file>    Path to the source bitmap (.bmp) file
+  <index_file>     Path to save the row index to
+
+Examples:
+  bitmap rowhash scan.bmp
+  bitmap rowhash scan.bmp scan.rows
+  bitmap compare scan.rows copy.rows
+`
+	MotionHelp = `Usage:
+  bitmap motion [options] <previous_file> <current_file> <mask_file>
+
+Description:
+  Detects motion between two frames of the same size: a pixel has changed if its
+  luminance differs by at least the threshold. Writes a mask, white where the frames
+  changed and black elsewhere, and prints the percentage of changed pixels. The mask
+  can be cleaned of speckle with the morphology filters before the pixels are counted.
+
+  Exits with status 1 if more than the minimum change is found, 0 if not, and 2 if
+  the frames can't be compared, including when their sizes differ.
+
+Options:
+  --threshold=<n>       Smallest luminance difference that counts as a change, 1-255 (default 25)
+  --morph=<op>:<r>      Apply erode, dilate, open or close with radius r to the mask. Can be
+                        used multiple times, in order; open:1 removes isolated changed pixels
+  --min-change=<p>%     Percentage of changed pixels above which the frames count as moving
+                        (default 1%)
+
+Examples:
+  bitmap motion prev.bmp curr.bmp mask.bmp
+  bitmap motion --threshold=40 --morph=open:1 --min-change=0.5% prev.bmp curr.bmp mask.bmp
+`
+	FramesHelp = `Usage:
+  bitmap frames --grid=<cols>x<rows> [--frame=<n>] <source_file> <output_dir>
+
+Description:
+  Splits a sprite sheet whose frames are laid out in a grid into separate files
+  named frame_<n>.bmp. Frames are numbered from 0 in row-major order starting
+  at the top-left. The grid must divide the image dimensions evenly.
+
+Arguments:
+  <source_file>    Path to the source bitmap file
+  <output_dir>     Directory to write the frames to; created if missing
+
+Options:
+  --grid=<c>x<r>   Number of columns and rows of frames in the sheet
+  --frame=<n>      Extract only frame n
+
+Examples:
+  bitmap frames --grid=4x2 sheet.bmp frames/
+  bitmap frames --grid=4x2 --frame=5 sheet.bmp frames/
+`
+	PyramidHelp = `Usage:
+  bitmap pyramid [--levels=<n>] <source_file> <output_dir>
+
+Description:
+  Writes a pyramid of previews of the image to the output directory: level_0.bmp is
+  the image itself and every next level is half the size of the one before, rounded
+  down, each pixel the average of the pixels it covers. Fewer levels are written if
+  one would be less than a pixel wide or tall. index.json lists the file, width and
+  height of every level. The directory is created if needed.
+
+Options:
+  --levels=<n>    Number of levels, including the image itself (default 4)
+
+Examples:
+  bitmap pyramid photo.bmp previews/
+  bitmap pyramid --levels=6 photo.bmp previews/
+`
+	MergeHelp = `Usage:
+  bitmap merge-exposures <source_file> <source_file>... <output_file>
+
+Description:
+  Fuses two or more shots of the same scene taken at different exposures into one
+  image. Every pixel is a weighted average of the shots, favoring those where it
+  is close to mid-gray and saturated, so shadows come from the brighter shots and
+  highlights from the darker ones. The shots must have the same dimensions.
+
+Arguments:
+  <source_file>    Path to a source image; at least two are needed
+  <output_file>    Path to save the fused image; the format follows the extension
+
+Examples:
+  bitmap merge-exposures under.bmp normal.bmp over.bmp out.bmp
+`
+	AlignChannelsHelp = `Usage:
+  bitmap align-channels [options] <red_file> <green_file> <blue_file> <output_file>
+
+Description:
+  Merges three grayscale plates of a color separation, such as scans of old
+  color-separated negatives, into one color image, lining them up first. The green
+  plate is the reference: the red and blue ones are moved by the whole number of
+  pixels at which they correlate best with it (normalized cross-correlation over the
+  area where they overlap), and the offsets found are printed. The channels are taken
+  from the luminance of each plate, which must all have the same size.
+
+Options:
+  --search=<n>          Largest offset tried along each axis, in pixels (default 16).
+                        Offsets are also limited to half the width and height of the plates
+  --background=<color>  Color whose channels fill the edges a moved plate uncovers
+                        (default black)
+
+Examples:
+  bitmap align-channels red.bmp green.bmp blue.bmp color.bmp
+  bitmap align-channels --search=40 --background=white r.bmp g.bmp b.bmp color.bmp
+`
+	DumpHelp = `Usage:
+  bitmap dump --row=<n> [options] <source_file>
+
+Description:
+  Prints the bytes of one row of a bitmap as they are stored in the file, one
+  pixel per line with its absolute file offset, followed by the padding bytes
+  that end the row. Only the headers are checked, so broken files can be
+  inspected too; bytes past the end of the file are shown as --.
+
+Arguments:
+  <source_file>    Path to the source bitmap (.bmp) file, 24 or 32 bits per pixel
+
+Options:
+  --row=<n>        Row to print, counted from 0 at the visual top
+  --cols=<a>-<b>   Print only columns a to b, inclusive; the padding is printed
+                   only if b is the last column
+  --rgb            Print the channels in RGB order instead of the stored BGR
+
+Examples:
+  bitmap dump --row=0 sample.bmp
+  bitmap dump --row=10 --cols=0-3 --rgb sample.bmp
+`
+	OrientHelp = `Usage:
+  bitmap orient --reference=<file> [options] <source_file> <output_file>
+
+Description:
+  Tries the four flips of the image (none, horizontal, vertical, both) against a
+  reference image in the expected orientation, keeps the one that matches best and
+  saves it. Both images are downscaled before comparing, so the reference may be
+  a smaller copy. The chosen flip and the mean difference of every candidate are
+  printed; a warning is printed if two candidates tie or if even the best one
+  differs by more than the threshold.
+
+Arguments:
+  <source_file>    Path to the source image
+  <output_file>    Path to save the oriented image; the format follows the extension
+
+Options:
+  --reference=<file>  Image in the expected orientation
+  --threshold=<n>     Mean channel difference (0-255) above which the best match is
+                      reported as doubtful (default 20)
+
+Examples:
+  bitmap orient --reference=ref.bmp in.bmp out.bmp
+`
+	BlobsHelp = `Usage:
+  bitmap blobs [options] <source_file>
+
+Description:
+  Thresholds the image by luminance and labels its connected regions of foreground
+  pixels (blobs), then prints the area, bounding box (inclusive) and centroid of
+  every blob, numbered in the order they first appear from the top-left.
+
+Arguments:
+  <source_file>    Path to the source image
+
+Options:
+  --threshold=<n>        Pixels with a luminance of at least n are foreground (default 128)
+  --invert               Count the pixels below the threshold instead, e.g. ink on paper
+  --min-area=<n>         Leave out blobs of fewer than n pixels (default 1)
+  --connectivity=<n>     4 to join only pixels sharing an edge, 8 to join diagonal
+                         neighbors too (default 8)
+  --json                 Print the blobs as a JSON array
+  --label-output=<file>  Also save an image of the blobs, each in its own color
+
+Examples:
+  bitmap blobs --threshold=100 --min-area=20 scan.bmp
+  bitmap blobs --invert --connectivity=4 --json --label-output=labels.bmp scan.bmp
+`
+	SuggestCropHelp = `Usage:
+  bitmap suggest-crop [options] <source_file>
+
+Description:
+  Finds the crop of the given aspect ratio that keeps the most detail of the image,
+  for automatic crops such as square avatars, and prints it as the --crop option of
+  bitmap apply. The crop is the largest window of that ratio that fits in the image,
+  placed where it contains the most edge energy: the gradient magnitude of the
+  luminance, from the Sobel kernels. Placements with the same energy are broken
+  toward the center of the image.
+
+Arguments:
+  <source_file>    Path to the source image
+
+Options:
+  --aspect=<w>:<h>    Aspect ratio of the crop (default 1:1)
+  --blur=<radius>     Smooth the energy map with a box blur of the radius first, so that
+                      the crop favors areas of detail over isolated edges (default 0)
+  --apply=<file>      Save the cropped image to the file instead of printing the crop
+
+Examples:
+  bitmap suggest-crop in.bmp
+  bitmap suggest-crop --aspect=16:9 --blur=4 --apply=banner.bmp in.bmp
+`
+	StereoHelp = `Usage:
+  bitmap stereo split [--layout=<layout>] <stereo_file> <left_file> <right_file>
+  bitmap stereo join [--layout=<layout>] <left_file> <right_file> <stereo_file>
+  bitmap stereo anaglyph [--layout=<layout>] <stereo_file> <output_file>
+  bitmap stereo anaglyph <left_file> <right_file> <output_file>
+
+Description:
+  Works with stereo pairs stored as one image holding both views. split cuts the
+  image at its midpoint into the left and right views, join puts two views of the
+  same size back together, and anaglyph makes a red/cyan composite taking red from
+  the left view and green and blue from the right one, from a stereo image or a pair.
+  The dimension the image is split along must be even, since a middle column or row
+  belongs to neither eye; split and anaglyph fail on odd ones.
+
+Options:
+  --layout=<layout>   How the views are arranged: sbs (default), left then right side
+                      by side, or tb, left on top of right
+
+Examples:
+  bitmap stereo split capture.bmp left.bmp right.bmp
+  bitmap stereo join --layout=tb left.bmp right.bmp over-under.bmp
+  bitmap stereo anaglyph capture.bmp anaglyph.bmp
+`
+	MosaicHelp = `Usage:
+  bitmap mosaic --tiles=<dir> [--cell=<n>] <target_file> <output_file>
+
+Description:
+  Divides the target image into square cells and replaces each one with the tile
+  whose average color is nearest to that of the cell. Every image in the tile
+  directory is a tile, resized to the cell size; hidden files and subdirectories are
+  skipped, and a file that isn't a readable image is an error. Of equally near
+  tiles, the first by file name is used, so the same library gives the same mosaic.
+
+Options:
+  --tiles=<dir>   Directory of the tile images
+  --cell=<n>      Side of the cells in pixels (default 16)
+
+Examples:
+  bitmap mosaic --tiles=photos/ portrait.bmp mosaic.bmp
+  bitmap mosaic --tiles=photos/ --cell=8 portrait.bmp fine-mosaic.bmp
+`
+	StampHelp = `Usage:
+  bitmap stamp read <file>
+
+Description:
+  Prints the provenance stamp of a BMP file written by bitmap apply --stamp: the
+  stamp version and the first 8 bytes of the SHA-256 of the manifest of the run that
+  made the file, in hexadecimal. With --write-manifest, they are those of the SHA-256
+  of <output_file>.json. Fails if the file has no stamp.
+
+  The stamp is kept in the file itself: the Reserved field of the file header holds
+  "bs", the version and the trailer size, and a 16-byte trailer after the pixel data,
+  counted in the file size, holds "BMST", the version and the hash. Viewers find the
+  pixels through the headers and ignore both.
+
+Examples:
+  bitmap apply --stamp --write-manifest --filter=grayscale in.bmp out.bmp
+  bitmap stamp read out.bmp
+`
+	GenerateHelp = `Usage:
+  bitmap generate --size=<width>x<height> [--pattern=ramp-id] <output_file>
+
+Description:
+  Writes a test pattern for checking display and file pipelines end to end. The
+  ramp-id pattern encodes the coordinates of every pixel in its color: red holds the
+  low 8 bits of x, green the low 8 bits of y, and blue the high 4 bits of x and of y.
+  Flash or pass the image through the pipeline, capture the result and check it
+  with bitmap verify-pattern.
+
+Arguments:
+  <output_file>    Path to save the pattern; the format follows the extension
+
+Options:
+  --size=<w>x<h>      Size of the pattern, at most 4096x4096
+  --pattern=<name>    Pattern to write: ramp-id (default)
+
+Examples:
+  bitmap generate --size=320x240 pattern.bmp
+`
+	VerifyPatternHelp = `Usage:
+  bitmap verify-pattern <captured_file>
+
+Description:
+  Checks that every pixel of a captured ramp-id pattern, as written by bitmap
+  generate, encodes its own coordinates, and otherwise reports the first pixel that
+  doesn't and guesses the damage: truncation, mirroring, rotation by 180 degrees,
+  exchanged channels (e.g. BGR/RGB) or a row stride error.
+  Exits with status 1 if the pattern is damaged and with status 2 if the file
+  can't be read.
+
+Arguments:
+  <captured_file>  Path to the captured pattern
+
+Examples:
+  bitmap verify-pattern captured.bmp
+`
+	ExportRawHelp = `Usage:
+  bitmap export-raw [--channels=<order>] <source_file> <output_file>
+
+Description:
+  Writes the pixels of the image to the output file with no header, one byte per
+  channel, rows from the top and no padding, and a JSON descriptor of that layout
+  to <output_file>.json: width, height, channels, stride (bytes per row) and origin.
+
+Arguments:
+  <source_file>    Path to the source image
+  <output_file>    Path to write the raw pixels to
+
+Options:
+  --channels=<order>  Channel order, e.g. rgb (default), bgr, rgba or bgra. Only
+                      orders with a keep the transparency of the image
+
+Examples:
+  bitmap export-raw in.bmp out.raw
+  bitmap export-raw --channels=bgr in.bmp out.raw
+`
+	ImportRawHelp = `Usage:
+  bitmap import-raw --desc=<descriptor> <source_file> <output_file>
+
+Description:
+  Reads raw pixels laid out as the JSON descriptor says, as written by export-raw,
+  and saves them as an image. The origin may be top-left or bottom-left, and the
+  stride may include padding. The file must hold exactly stride x height bytes.
+
+Arguments:
+  <source_file>    Path to the raw pixels
+  <output_file>    Path to save the image; the format follows the extension
+
+Options:
+  --desc=<file>    Path to the JSON descriptor
+
+Examples:
+  bitmap import-raw --desc=out.raw.json out.raw back.bmp
+`
+	AlphaHelp = `Usage:
+  bitmap alpha extract <source_file> <mask_file>
+  bitmap alpha apply <base_file> <mask_file> <output_file>
+
+Description:
+  Moves the alpha channel of an image in and out of a separate mask file. extract
+  writes the alpha as a grayscale image, black where the image is transparent and
+  white where it is opaque, white throughout if it has no alpha. apply sets the alpha
+  of the base image to the luminance of the mask, which must have the same size,
+  replacing any it had. Extracting a mask and applying it restores the alpha exactly.
+
+  Masks are written in the format of their extension; BMP masks are 24-bit, and
+  8-bit grayscale masks from other tools are read as well. BMP output of apply is
+  32-bit with an alpha channel, whatever the depth of the base. Other formats
+  follow the extension: PNG keeps the alpha, the others flatten it.
+
+Arguments:
+  <source_file>    Path to the image to extract the alpha of
+  <base_file>      Path to the image to set the alpha of, 24 or 32-bit
+  <mask_file>      Path to the mask
+  <output_file>    Path to save the image with its new alpha
+
+Examples:
+  bitmap alpha extract logo.bmp logo-mask.bmp
+  bitmap alpha apply photo.bmp logo-mask.bmp photo-masked.bmp
+`
+	CanonicalizeHelp = `Usage:
+  bitmap canonicalize <source_file> <output_file>
+
+Description:
+  Rewrites the image as a 24-bit BMP in canonical form, so that images with the
+  same pixels and resolution give byte-identical files whatever the encoder that
+  wrote them: rows bottom-up, a 40-byte DIB header with the pixels at offset 54,
+  ImageSize and FileSize computed, Reserved zeroed, and no gap before the pixels,
+  color space information or trailer after them. Transparent images are flattened
+  onto black. bitmap apply --canonical saves its output in the same form.
+
+Arguments:
+  <source_file>    Path to the source image
+  <output_file>    Path to save the canonical BMP to
+
+Examples:
+  bitmap canonicalize in.bmp out.bmp
+  bitmap apply --canonical --filter=grayscale in.bmp out.bmp
+`
+	ClipboardHelp = `Usage:
+  bitmap clipboard paste <output_file>
+  bitmap clipboard copy <source_file>
+
+Description:
+  Exchanges images with the clipboard, where Windows keeps them, screenshots included,
+  as a BMP without its 14-byte file header (CF_DIB). paste saves the image on the
+  clipboard as a BMP file, putting the file header back in front of it and keeping
+  every other byte. copy puts an image file of any supported format on the clipboard
+  as a 24-bit bitmap; transparency is dropped. Only available on Windows; elsewhere
+  both fail with an error saying the clipboard is unsupported on this OS.
+
+Arguments:
+  <output_file>    Path to save the pasted BMP to
+  <source_file>    Path to the image to copy
+
+Examples:
+  bitmap clipboard paste screenshot.bmp
+  bitmap clipboard copy out.bmp
+`
+	InteractiveHelp = `Usage:
+  bitmap interactive <source_file>
+
+Description:
+  Loads the image once, then reads commands from standard input, one per line, and
+  applies each transformation to a working copy, printing its new dimensions. Tuning
+  parameters this way avoids decoding a large file again for every attempt. A command
+  that fails prints its error and leaves the image as it was.
+
+Commands:
+  <transformation> [<value>...]  An apply flag without its dashes, and its value after a
+                                 space: filter grayscale, rotate right, mirror horizontal.
+                                 The values of crop and the parameters of filters may be
+                                 separated by spaces: crop 10 10 100 100, filter blur 5.
+                                 Apply flags such as --filter=blur:5 are accepted too
+  undo                           Go back to the image before the last transformation,
+                                 up to 16 times
+  save <file>                    Save the image, in the format of the extension
+  stats                          Print channel, luminance and entropy statistics
+  help                           List the commands
+  quit                           Leave, as does the end of the input
+
+Arguments:
+  <source_file>    Path to the source image
+
+Examples:
+  bitmap interactive photo.bmp
+  printf 'filter grayscale\ncrop 0 0 100 100\nsave out.bmp\n' | bitmap interactive photo.bmp
+`
+	CapabilitiesHelp = `Usage:
+  bitmap capabilities [--json]
+
+Description:
+  Lists what this build supports: the input and output formats, the BMP bit depths,
+  the transformations, the filters with their parameters, and the limits on image
+  size and memory. The list is taken from the tables the option parsers use, so it
+  always matches what apply accepts.
+
+Options:
+  --json    Print the list as JSON. Each filter parameter has a name, a type (int,
+            float, enum or points), its range or values, its default and whether
+            it can be left out. Bounds are inclusive unless marked exclusive
+
+Examples:
+  bitmap capabilities
+  bitmap capabilities --json
 `
 )
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// noiseImage returns a bottom-up image of the given size filled with random
+// pixels from seed.
+func noiseImage(width, height int, seed int64) *BMPImage {
+	rng := rand.New(rand.NewSource(seed))
+	b := NewImage(width, height)
+	for _, row := range b.Data {
+		for x := range row {
+			row[x] = Pixel{Blue: byte(rng.Intn(256)), Green: byte(rng.Intn(256)), Red: byte(rng.Intn(256))}
+		}
+	}
+	return b
+}
+
+// encodeBMP returns image encoded as a 24-bit BMP file.
+func encodeBMP(t *testing.T, image *BMPImage) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeBMP(&buf, image); err != nil {
+		t.Fatalf("EncodeBMP: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// gridsEqual reports whether two grids of pixel values are identical.
+func gridsEqual[T comparable](a, b [][]T) bool {
+	return slices.EqualFunc(a, b, func(x, y []T) bool { return slices.Equal(x, y) })
+}
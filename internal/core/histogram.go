@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// histogramBins is the number of bars of the histogram chart, each counting
+// 256/histogramBins luminance values.
+const histogramBins = 16
+
+// minHistogramBar is the narrowest the bars of the histogram chart are let
+// get before the labels are shortened, then the counts dropped, to widen them.
+const minHistogramBar = 8
+
+// HistogramOptions stores the flags of the histogram command.
+type HistogramOptions struct {
+	Width int // Width of the chart in characters, 0 for that of the terminal
+}
+
+// ParseHistogramArgs parses the histogram command arguments: the optional
+// --width flag, then the file.
+func ParseHistogramArgs(args []string) (HistogramOptions, string, error) {
+	var opts HistogramOptions
+	if len(args) < 1 {
+		return opts, "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		switch {
+		case strings.HasPrefix(arg, "--width="):
+			n, err := parseWidth(arg)
+			if err != nil {
+				return opts, "", err
+			}
+			opts.Width = n
+		default:
+			return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+	return opts, args[len(args)-1], nil
+}
+
+// WriteHistogram writes the luminance histogram of image to w as a bar chart
+// of histogramBins lines, each the luminance range it counts, a bar as long
+// as the count relative to the largest one, and the count. No line is wider
+// than width, or the terminal if it is 0: when the bars would get narrower
+// than minHistogramBar, the ranges are shortened to their first value, then
+// the counts are left out, so the bars always start in the same column.
+func WriteHistogram(w io.Writer, image *BMPImage, width int) error {
+	width = textWidth(width)
+
+	hist := Histogram(image)
+	var bins [histogramBins]int
+	for v, n := range hist {
+		bins[v*histogramBins/256] += n
+	}
+	largest := 1
+	for _, n := range bins {
+		largest = max(largest, n)
+	}
+
+	// The bar fills whatever the label, the "|" before it and the count leave
+	countWidth := len(strconv.Itoa(largest))
+	labelWidth, showCount := 7, true
+	bar := width - labelWidth - 2 - 1 - countWidth
+	if bar < minHistogramBar {
+		labelWidth = 3
+		bar = width - labelWidth - 2 - 1 - countWidth
+	}
+	if bar < minHistogramBar {
+		showCount = false
+		bar = width - labelWidth - 2
+	}
+
+	bw := bufio.NewWriter(w)
+	title := fmt.Sprintf("Luminance histogram of %dx%d pixels", image.InfoHeader.Width, len(image.Data))
+	fmt.Fprintln(bw, strings.TrimRight(truncateLabel(title, width), " "))
+	span := 256 / histogramBins
+	for i, n := range bins {
+		label := fmt.Sprintf("%3d-%3d", i*span, (i+1)*span-1)
+		// Any pixel at all shows as at least one mark
+		marks := strings.Repeat("#", (n*bar+largest-1)/largest)
+		if showCount {
+			fmt.Fprintf(bw, "%s |%-*s %*d\n", truncateLabel(label, labelWidth), bar, marks, countWidth, n)
+		} else {
+			fmt.Fprintf(bw, "%s |%s\n", truncateLabel(label, labelWidth), marks)
+		}
+	}
+	return bw.Flush()
+}
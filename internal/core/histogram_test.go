@@ -0,0 +1,62 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteHistogramWidths(t *testing.T) {
+	image := grayNoise(300, 200, 1)
+	for _, width := range []int{5, 20, 34, 80, 200} {
+		var buf bytes.Buffer
+		if err := WriteHistogram(&buf, image, width); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 1+histogramBins {
+			t.Fatalf("width %d: %d lines, want %d", width, len(lines), 1+histogramBins)
+		}
+
+		// Narrower widths are laid out as the narrowest supported
+		limit := max(width, minTextWidth)
+		bar := strings.IndexByte(lines[1], '|')
+		total, counted := 0, true
+		for _, line := range lines {
+			if len(line) > limit {
+				t.Errorf("width %d: line %q is %d characters", width, line, len(line))
+			}
+		}
+		for _, line := range lines[1:] {
+			if i := strings.IndexByte(line, '|'); i != bar {
+				t.Errorf("width %d: bar of %q starts at %d, want %d", width, line, i, bar)
+			}
+			fields := strings.Fields(line[bar+1:])
+			if n, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+				total += n
+			} else {
+				counted = false
+			}
+		}
+		if counted && total != 300*200 {
+			t.Errorf("width %d: counts add up to %d, want %d", width, total, 300*200)
+		}
+		if width >= 80 && (!counted || !strings.HasPrefix(lines[1], "  0- 15 |")) {
+			t.Errorf("width %d: labels or counts left out:\n%s", width, buf.String())
+		}
+	}
+}
+
+func TestParseHistogramArgs(t *testing.T) {
+	opts, file, err := ParseHistogramArgs([]string{"--width=40", "a.bmp"})
+	if err != nil || opts.Width != 40 || file != "a.bmp" {
+		t.Errorf("got %+v, %q, %v", opts, file, err)
+	}
+	for _, arg := range []string{"--width=10", "--width=wide", "--bins=4"} {
+		if _, _, err := ParseHistogramArgs([]string{arg, "a.bmp"}); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("%s: error %v, want ErrInvalidParameter", arg, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package core
+
+// ProgressSink receives the progress of an operation: done of the total
+// units of work of its current stage, such as "apply" counting the
+// transformations of a pipeline. Every stage reports 0 of total before it
+// starts and total of total once it is over.
+type ProgressSink interface {
+	OnProgress(stage string, done, total int)
+}
+
+// Logger receives the messages of an operation: Infof what it did, and
+// Warnf the oddities it worked around, such as those of a decoded file.
+type Logger interface {
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+}
+
+// Hooks holds the callbacks operations report to, so that programs embedding
+// the package get their progress and messages as calls rather than output.
+// Either may be nil to discard what it would receive.
+type Hooks struct {
+	Progress ProgressSink
+	Logger   Logger
+}
+
+func (h Hooks) progress(stage string, done, total int) {
+	if h.Progress != nil {
+		h.Progress.OnProgress(stage, done, total)
+	}
+}
+
+func (h Hooks) infof(format string, args ...any) {
+	if h.Logger != nil {
+		h.Logger.Infof(format, args...)
+	}
+}
+
+func (h Hooks) warnf(format string, args ...any) {
+	if h.Logger != nil {
+		h.Logger.Warnf(format, args...)
+	}
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recorder is a ProgressSink and Logger that records what it receives.
+type recorder struct {
+	events []string
+	infos  []string
+	warns  []string
+}
+
+func (r *recorder) OnProgress(stage string, done, total int) {
+	r.events = append(r.events, fmt.Sprintf("%s %d/%d", stage, done, total))
+}
+
+func (r *recorder) Infof(format string, args ...any) {
+	r.infos = append(r.infos, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Warnf(format string, args ...any) {
+	r.warns = append(r.warns, fmt.Sprintf(format, args...))
+}
+
+func TestHooksReportPipeline(t *testing.T) {
+	transforms, _, _, err := ParseTransformations([]string{"--mirror=horizontal", "--rotate=90", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	hooks := Hooks{Progress: rec, Logger: rec}
+
+	// Palette index 3 is past the two colors of the palette
+	b := palettedBMP(5, 4, 8, []Pixel{{Red: 255}, {Blue: 255}}, 2, func(x, y int) byte { return byte(x % 4) })
+	image, err := DecodeImageWith(b, ParseOptions{Hooks: hooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyTransformationsWith(context.Background(), image, transforms, hooks, 0); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, image, SaveOptions{Format: FormatAuto, Hooks: hooks}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"decode 0/1", "decode 1/1", "apply 0/2", "apply 1/2", "apply 2/2", "encode 0/1", "encode 1/1"}
+	if !slices.Equal(rec.events, want) {
+		t.Errorf("progress events %q, want %q", rec.events, want)
+	}
+	if len(rec.warns) != 1 || !strings.Contains(rec.warns[0], "palette") {
+		t.Errorf("warnings %q, want the one about the palette", rec.warns)
+	}
+	if len(rec.infos) != 3 || !strings.HasPrefix(rec.infos[0], "1. mirror") || !strings.HasPrefix(rec.infos[1], "2. rotate") || !strings.HasPrefix(rec.infos[2], "--format=auto picked") {
+		t.Errorf("messages %q, want one per transformation and the format picked", rec.infos)
+	}
+}
+
+func TestHooksInvalidPipeline(t *testing.T) {
+	transforms, _, _, err := ParseTransformations([]string{"--mirror=horizontal", "--crop=0-0-2-2", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The crop doesn't fit, so the pipeline fails validation before any step
+	rec := &recorder{}
+	if err := ApplyTransformationsWith(context.Background(), noiseImage(1, 1, 1), transforms, Hooks{Progress: rec, Logger: rec}, 0); err == nil {
+		t.Fatal("cropped 2x2 out of a 1x1 image")
+	}
+	if len(rec.events) > 0 || len(rec.infos) > 0 {
+		t.Errorf("invalid pipeline reported progress %q and messages %q", rec.events, rec.infos)
+	}
+
+	// Empty hooks discard everything
+	if err := ApplyTransformationsWith(context.Background(), noiseImage(3, 3, 1), transforms[:1], Hooks{}, 0); err != nil {
+		t.Error(err)
+	}
+}
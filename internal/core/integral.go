@@ -0,0 +1,150 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ChannelSums holds one sum per color channel.
+type ChannelSums struct {
+	Blue, Green, Red uint64
+}
+
+func (s ChannelSums) add(o ChannelSums) ChannelSums {
+	return ChannelSums{s.Blue + o.Blue, s.Green + o.Green, s.Red + o.Red}
+}
+
+func (s ChannelSums) sub(o ChannelSums) ChannelSums {
+	return ChannelSums{s.Blue - o.Blue, s.Green - o.Green, s.Red - o.Red}
+}
+
+// maxIntegralPixels is the largest image an IntegralImage accepts: the sum of
+// the squares of 255 over that many pixels still fits in a uint64.
+const maxIntegralPixels = math.MaxUint64 / (255 * 255)
+
+// IntegralImage is a summed-area table of an image: it answers the sum of
+// the channel values over any rectangle in constant time. Entry (x, y) of the
+// table holds the sum over all pixels above and to the left of pixel (x, y),
+// so the table is one entry wider and taller than the image, with a zero
+// first row and column. Coordinates are visual, from the top-left corner.
+type IntegralImage struct {
+	Width, Height int
+
+	sums    []ChannelSums
+	squares []ChannelSums // nil unless requested
+}
+
+// NewIntegralImage builds the summed-area table of image. If squares is set,
+// a second table of squared channel values is built too, for SumSquaresRect.
+func NewIntegralImage(image *BMPImage, squares bool) (*IntegralImage, error) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	if uint64(width)*uint64(height) > maxIntegralPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large for a summed-area table", width, height)
+	}
+
+	ii := &IntegralImage{Width: width, Height: height}
+	stride := width + 1
+	ii.sums = make([]ChannelSums, stride*(height+1))
+	if squares {
+		ii.squares = make([]ChannelSums, stride*(height+1))
+	}
+
+	for y, row := range image.Rows() {
+		// Running sums of the current row, added to the entries above.
+		var rowSum, rowSquares ChannelSums
+		for x, p := range row {
+			b, g, r := uint64(p.Blue), uint64(p.Green), uint64(p.Red)
+			rowSum = rowSum.add(ChannelSums{b, g, r})
+			i := (y+1)*stride + x + 1
+			ii.sums[i] = ii.sums[i-stride].add(rowSum)
+			if squares {
+				rowSquares = rowSquares.add(ChannelSums{b * b, g * g, r * r})
+				ii.squares[i] = ii.squares[i-stride].add(rowSquares)
+			}
+		}
+	}
+	return ii, nil
+}
+
+// SumRect returns the channel sums over the pixels with x0 <= x < x1 and
+// y0 <= y < y1. The rectangle is clipped to the image, so windows may
+// extend past the edges; an empty rectangle sums to zero.
+func (ii *IntegralImage) SumRect(x0, y0, x1, y1 int) ChannelSums {
+	return ii.rect(ii.sums, x0, y0, x1, y1)
+}
+
+// SumSquaresRect is SumRect over the squared channel values. It panics if
+// the table was built without squares.
+func (ii *IntegralImage) SumSquaresRect(x0, y0, x1, y1 int) ChannelSums {
+	if ii.squares == nil {
+		panic("core: IntegralImage built without squares")
+	}
+	return ii.rect(ii.squares, x0, y0, x1, y1)
+}
+
+// rect evaluates a rectangle sum on table, clipping it to the image.
+func (ii *IntegralImage) rect(table []ChannelSums, x0, y0, x1, y1 int) ChannelSums {
+	x0, y0 = max(x0, 0), max(y0, 0)
+	x1, y1 = min(x1, ii.Width), min(y1, ii.Height)
+	if x0 >= x1 || y0 >= y1 {
+		return ChannelSums{}
+	}
+
+	stride := ii.Width + 1
+	return table[y1*stride+x1].sub(table[y0*stride+x1]).sub(table[y1*stride+x0]).add(table[y0*stride+x0])
+}
+
+// AdaptiveThreshold binarizes the image by comparing the luminance of every
+// pixel to the mean luminance of the window x window square around it,
+// clipped to the image: pixels brighter than the mean minus bias become
+// white, the others black. Unlike a single global threshold, this follows
+// uneven lighting, as on photographed documents.
+func AdaptiveThreshold(image *BMPImage, window, bias int) error {
+	ii, err := NewIntegralImage(image, false)
+	if err != nil {
+		return err
+	}
+
+	before, after := window/2, window-window/2
+	for y, row := range image.Rows() {
+		for x, p := range row {
+			x0, y0 := max(x-before, 0), max(y-before, 0)
+			x1, y1 := min(x+after, ii.Width), min(y+after, ii.Height)
+			s := ii.SumRect(x0, y0, x1, y1)
+			n := float64((x1 - x0) * (y1 - y0))
+			mean := (float64(s.Red)*0.2126 + float64(s.Green)*0.7152 + float64(s.Blue)*0.0722) / n
+
+			if float64(luminance(p)) > mean-float64(bias) {
+				row[x] = Pixel{Blue: 255, Green: 255, Red: 255}
+			} else {
+				row[x] = Pixel{}
+			}
+		}
+	}
+	return nil
+}
+
+// defaultThresholdBias is the bias of adaptivethreshold unless one is given.
+const defaultThresholdBias = 0
+
+// parseAdaptiveThresholdArgs parses the window size and the optional bias of
+// the adaptivethreshold filter.
+func parseAdaptiveThresholdArgs(args []string) (int, int, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return 0, 0, fmt.Errorf("adaptivethreshold filter requires a window size: adaptivethreshold:<window>[:<bias>]")
+	}
+
+	window, err := strconv.Atoi(args[0])
+	if err != nil || window < 1 {
+		return 0, 0, fmt.Errorf("invalid adaptivethreshold window: %s (must be positive)", args[0])
+	}
+	bias := defaultThresholdBias
+	if len(args) == 2 {
+		bias, err = strconv.Atoi(args[1])
+		if err != nil || bias < -255 || bias > 255 {
+			return 0, 0, fmt.Errorf("invalid adaptivethreshold bias: %s (must be in [-255, 255])", args[1])
+		}
+	}
+	return window, bias, nil
+}
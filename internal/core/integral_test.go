@@ -0,0 +1,67 @@
+package core
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// bruteSums sums the channels, or their squares, of the pixels of image with
+// x0 <= x < x1 and y0 <= y < y1 that lie inside it.
+func bruteSums(image *BMPImage, x0, y0, x1, y1 int, squares bool) ChannelSums {
+	var s ChannelSums
+	for y, row := range image.Rows() {
+		for x, p := range row {
+			if x < x0 || x >= x1 || y < y0 || y >= y1 {
+				continue
+			}
+			b, g, r := uint64(p.Blue), uint64(p.Green), uint64(p.Red)
+			if squares {
+				b, g, r = b*b, g*g, r*r
+			}
+			s = s.add(ChannelSums{b, g, r})
+		}
+	}
+	return s
+}
+
+func TestSumRectMatchesBruteForce(t *testing.T) {
+	const width, height = 23, 17
+	image := noiseImage(width, height, 1)
+	ii, err := NewIntegralImage(image, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rects := [][4]int{
+		// The whole image, its corners, a full row and a full column
+		{0, 0, width, height},
+		{0, 0, 1, 1},
+		{width - 1, 0, width, 1},
+		{0, height - 1, 1, height},
+		{width - 1, height - 1, width, height},
+		{0, 5, width, 6},
+		{7, 0, 8, height},
+		// Past the edges, and entirely outside
+		{-5, -5, width + 5, height + 5},
+		{width - 3, height - 3, width + 9, height + 9},
+		{width, 0, width + 4, height},
+		{-4, -4, 0, 0},
+		// Empty
+		{3, 3, 3, 10},
+		{5, 5, 2, 2},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for range 500 {
+		x0, y0 := rng.Intn(width+4)-2, rng.Intn(height+4)-2
+		rects = append(rects, [4]int{x0, y0, x0 + rng.Intn(width/2+2), y0 + rng.Intn(height/2+2)})
+	}
+
+	for _, r := range rects {
+		if got, want := ii.SumRect(r[0], r[1], r[2], r[3]), bruteSums(image, r[0], r[1], r[2], r[3], false); got != want {
+			t.Errorf("SumRect%v = %+v, want %+v", r, got, want)
+		}
+		if got, want := ii.SumSquaresRect(r[0], r[1], r[2], r[3]), bruteSums(image, r[0], r[1], r[2], r[3], true); got != want {
+			t.Errorf("SumSquaresRect%v = %+v, want %+v", r, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// MaxUndo is the number of commands an interactive session can undo. Every
+// one holds a copy of the image, so the oldest are forgotten past it.
+const MaxUndo = 16
+
+// Session is an interactive session exploring transformations on an image,
+// as run by the interactive command: the working copy and the copies it was
+// cloned from before the last commands that changed it.
+type Session struct {
+	Image   *BMPImage
+	history []*BMPImage
+}
+
+// NewSession returns a session working on image.
+func NewSession(image *BMPImage) *Session {
+	return &Session{Image: image}
+}
+
+// Run reads commands from r, one per line, and runs them until quit or the
+// end of r, writing the outcome of every command to w. A command that fails
+// writes its error and leaves the image as it was, so the session goes on;
+// only reading r or writing w can make Run fail. The commands are:
+//
+//   - a transformation: an apply flag with its leading dashes dropped and its
+//     value after a space, such as "filter grayscale" or "rotate right".
+//     The values of crop are separated by spaces, "crop 10 10 100 100", and
+//     the parameters of the others by spaces or colons, "filter blur 5".
+//     Lines of apply flags, such as "--region=... --filter=...", are taken
+//     as they are. The new dimensions are written;
+//   - undo, to go back to the image before the last transformation;
+//   - save <file>, to save the image as apply would;
+//   - stats, to write the statistics of the image, see Stats;
+//   - help, to list the commands, and quit.
+//
+// Blank lines and lines starting with # are skipped.
+func (s *Session) Run(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+		if words[0] == "quit" || words[0] == "exit" {
+			return nil
+		}
+
+		out, err := s.command(words)
+		if err != nil {
+			out = "error: " + err.Error()
+		}
+		if _, err := fmt.Fprintln(w, out); err != nil {
+			return ioError(err)
+		}
+	}
+	return ioError(scanner.Err())
+}
+
+// command runs the command of the given words and returns what to write.
+func (s *Session) command(words []string) (string, error) {
+	switch words[0] {
+	case "undo":
+		if len(words) != 1 {
+			return "", withKind(ErrInvalidParameter, fmt.Errorf("undo takes no arguments"))
+		}
+		if len(s.history) == 0 {
+			return "", withKind(ErrInvalidParameter, fmt.Errorf("nothing to undo"))
+		}
+		s.Image = s.history[len(s.history)-1]
+		s.history = s.history[:len(s.history)-1]
+		return s.dimensions(), nil
+	case "save":
+		if len(words) != 2 {
+			return "", withKind(ErrInvalidParameter, fmt.Errorf("save takes a file"))
+		}
+		if err := Save(s.Image, words[1], SaveOptions{}); err != nil {
+			return "", err
+		}
+		return "saved " + words[1], nil
+	case "stats":
+		if len(words) != 1 {
+			return "", withKind(ErrInvalidParameter, fmt.Errorf("stats takes no arguments"))
+		}
+		return formatStats(Stats(s.Image)), nil
+	case "help":
+		return sessionHelp, nil
+	}
+
+	transforms, err := parseTransformArgs(sessionFlags(words))
+	if err != nil {
+		return "", err
+	}
+	if len(transforms) == 0 {
+		return "", withKind(ErrInvalidParameter, fmt.Errorf("%s is not a transformation", words[0]))
+	}
+	image := s.Image.Clone()
+	if err := ApplyTransformations(image, transforms); err != nil {
+		return "", err
+	}
+	s.history = append(s.history, s.Image)
+	if len(s.history) > MaxUndo {
+		s.history = s.history[1:]
+	}
+	s.Image = image
+	return s.dimensions(), nil
+}
+
+// sessionFlags returns the apply flags of a transformation command: the
+// words themselves if they are flags already, else the flag named by the
+// first with the others as its value.
+func sessionFlags(words []string) []string {
+	if strings.HasPrefix(words[0], "--") {
+		return words
+	}
+	sep := ":"
+	if words[0] == "crop" {
+		sep = "-"
+	}
+	return []string{"--" + words[0] + "=" + strings.Join(words[1:], sep)}
+}
+
+// dimensions returns the dimensions of the working image.
+func (s *Session) dimensions() string {
+	return fmt.Sprintf("%dx%d", s.Image.InfoHeader.Width, utils.Abs(int(s.Image.InfoHeader.Height)))
+}
+
+// formatStats returns st as the stats command writes it.
+func formatStats(st ImageStats) string {
+	var b strings.Builder
+	for _, c := range []struct {
+		name string
+		ChannelStats
+	}{{"red", st.Red}, {"green", st.Green}, {"blue", st.Blue}} {
+		fmt.Fprintf(&b, "%-6s min %3d  max %3d  mean %6.2f  stddev %6.2f  clipped %5.2f%%\n", c.name, c.Min, c.Max, c.Mean, c.StdDev, 100*c.Clipped)
+	}
+	fmt.Fprintf(&b, "luma   mean %6.2f  stddev %6.2f  entropy %.3f bits", st.LumaMean, st.LumaStdDev, st.Entropy)
+	return b.String()
+}
+
+// sessionHelp is what the help command of a session writes.
+const sessionHelp = `Commands:
+  <transformation> [<value>...]  Apply a transformation, e.g. filter grayscale, crop 10 10 100 100,
+                                 rotate right or --filter=blur:5, and print the new dimensions
+  undo                           Go back to the image before the last transformation
+  save <file>                    Save the image, in the format of the extension
+  stats                          Print channel, luminance and entropy statistics
+  help                           Print this list
+  quit                           Leave the session`
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runSession runs script in a session on image and returns its output.
+func runSession(t *testing.T, image *BMPImage, script string) (*Session, string) {
+	t.Helper()
+	s := NewSession(image)
+	var out bytes.Buffer
+	if err := s.Run(strings.NewReader(script), &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return s, out.String()
+}
+
+func TestSessionMatchesPipeline(t *testing.T) {
+	dir := t.TempDir()
+	input := noiseImage(12, 9, 1)
+	got, want := filepath.Join(dir, "session.bmp"), filepath.Join(dir, "pipeline.bmp")
+
+	script := strings.Join([]string{
+		"filter grayscale",
+		"crop 1 2 8 6",
+		"mirror horizontal",
+		"undo",
+		"# blur rather than mirror",
+		"",
+		"filter blur 1",
+		"--rotate=right",
+		"save " + got,
+		"quit",
+		"filter negative",
+	}, "\n")
+	_, out := runSession(t, input.Clone(), script)
+	if wantOut := "12x9\n8x6\n8x6\n8x6\n8x6\n6x8\nsaved " + got + "\n"; out != wantOut {
+		t.Errorf("output = %q, want %q", out, wantOut)
+	}
+
+	transforms, _, _, err := ParseTransformations([]string{"--filter=grayscale", "--crop=1-2-8-6", "--filter=blur:1", "--rotate=right", "in.bmp", want})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyTransformations(input, transforms); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(input, want, SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("the session saved a different file than the pipeline")
+	}
+}
+
+func TestSessionErrorsKeepImage(t *testing.T) {
+	image := noiseImage(4, 4, 2)
+	s, out := runSession(t, image.Clone(), "undo\ncrop 2 2 9 9\nfilter sepia-ish\nresize 2\nsave\nstats extra\n--blur-radius=2\n")
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("output = %q, want 7 lines", out)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "error: ") {
+			t.Errorf("%q is not an error", line)
+		}
+	}
+	if x, y, ok := firstDifference(s.Image, image); !ok {
+		t.Errorf("pixel (%d, %d) changed", x, y)
+	}
+}
+
+func TestSessionUndoLimit(t *testing.T) {
+	image := noiseImage(3, 3, 3)
+	script := strings.Repeat("filter negative\n", MaxUndo+2) + strings.Repeat("undo\n", MaxUndo+1)
+	s, out := runSession(t, image.Clone(), script)
+	if !strings.HasSuffix(out, "error: nothing to undo\n") {
+		t.Errorf("output ends with %q, want nothing to undo", out[max(len(out)-40, 0):])
+	}
+	// Two negatives were forgotten, which cancel out
+	if x, y, ok := firstDifference(s.Image, image); !ok {
+		t.Errorf("pixel (%d, %d) differs after undoing all that can be", x, y)
+	}
+}
+
+func TestSessionStats(t *testing.T) {
+	_, out := runSession(t, NewImage(2, 2), "stats")
+	if !strings.Contains(out, "red    min   0  max   0") || !strings.Contains(out, "entropy 0.000 bits") {
+		t.Errorf("stats = %q", out)
+	}
+}
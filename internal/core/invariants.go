@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+
+	xbmp "golang.org/x/image/bmp"
+)
+
+// CheckInvariants verifies the assumptions the BMP codec makes about row
+// order, for --check-invariants. It checks that:
+//
+//   - serializing the image and parsing the result gives back the same
+//     pixels, as the image is saved (quantized and flattened);
+//   - a marker written at the visual top-left corner with Set is read back at
+//     (0, 0) by ParseBMP as well as by golang.org/x/image/bmp, an independent
+//     decoder that shares no code with ParseBMP, and that both decoders agree
+//     on every other pixel.
+//
+// The image itself is left untouched.
+func CheckInvariants(bmp *BMPImage) error {
+	expected := SaveOptions{}.prepare(bmp, false)
+	if len(expected.Data) == 0 || len(expected.Data[0]) == 0 {
+		return nil
+	}
+
+	data, err := SerializeBMP(expected)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseBMP(data)
+	if err != nil {
+		return fmt.Errorf("invariant violated: the serialized image does not parse: %w", err)
+	}
+	if x, y, ok := firstDifference(expected, parsed); !ok {
+		return fmt.Errorf("invariant violated: pixel (%d, %d) changed in a serialize and parse round trip", x, y)
+	}
+
+	// The marker is the complement of the corner pixel, so it differs from it in every channel
+	probe := expected.Clone()
+	corner := probe.At(0, 0)
+	marker := Pixel{Blue: ^corner.Blue, Green: ^corner.Green, Red: ^corner.Red}
+	probe.Set(0, 0, marker)
+	if data, err = SerializeBMP(probe); err != nil {
+		return err
+	}
+
+	parsed, err = ParseBMP(data)
+	if err != nil {
+		return fmt.Errorf("invariant violated: the orientation probe does not parse: %w", err)
+	}
+	if got := parsed.At(0, 0); got != marker {
+		return fmt.Errorf("invariant violated: ParseBMP reads %v at the top-left corner, want the marker %v", got, marker)
+	}
+
+	reference, err := xbmp.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invariant violated: x/image/bmp rejects the orientation probe: %w", err)
+	}
+	if got := opaqueAt(reference, 0, 0); got != (color.NRGBA{R: marker.Red, G: marker.Green, B: marker.Blue, A: 255}) {
+		return fmt.Errorf("invariant violated: x/image/bmp reads %v at the top-left corner, want the marker %v", got, marker)
+	}
+	for y, row := range parsed.Rows() {
+		for x, p := range row {
+			if c := opaqueAt(reference, x, y); c.R != p.Red || c.G != p.Green || c.B != p.Blue {
+				return fmt.Errorf("invariant violated: ParseBMP and x/image/bmp disagree at (%d, %d)", x, y)
+			}
+		}
+	}
+	return nil
+}
+
+// firstDifference compares the pixels of a and b in visual order and returns
+// the first position where they differ, or ok if they are identical. Images
+// of different sizes differ at (0, 0).
+func firstDifference(a, b *BMPImage) (x, y int, ok bool) {
+	if a.InfoHeader.Width != b.InfoHeader.Width || len(a.Data) != len(b.Data) {
+		return 0, 0, false
+	}
+	for y, row := range a.Rows() {
+		for x, p := range row {
+			if b.At(x, y) != p {
+				return x, y, false
+			}
+		}
+	}
+	return 0, 0, true
+}
+
+// opaqueAt returns the color of img at (x, y) as an opaque color.NRGBA, for
+// comparing the pixels read by another decoder with ours.
+func opaqueAt(img image.Image, x, y int) color.NRGBA {
+	c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	c.A = 255
+	return c
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"testing"
+)
+
+// topDown returns image with its rows stored from the visual top down. The
+// picture stays the same; only the order it is written in changes.
+func topDown(image *BMPImage) *BMPImage {
+	image.InfoHeader.Height = -image.InfoHeader.Height
+	return image
+}
+
+// twoByTwoBMP returns a 24-bit 2x2 BMP file holding the given rows in file
+// order, with the height sign selecting bottom-up (positive) or top-down
+// (negative) storage.
+func twoByTwoBMP(height int32, rows [2][2]Pixel) []byte {
+	const stride = 8 // 2 pixels of 3 bytes, padded to 4
+	b := make([]byte, 54+2*stride)
+	copy(b, "BM")
+	binary.LittleEndian.PutUint32(b[2:6], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[10:14], 54)
+	binary.LittleEndian.PutUint32(b[14:18], 40)
+	binary.LittleEndian.PutUint32(b[18:22], 2)
+	binary.LittleEndian.PutUint32(b[22:26], uint32(height))
+	binary.LittleEndian.PutUint16(b[26:28], 1)
+	binary.LittleEndian.PutUint16(b[28:30], 24)
+	binary.LittleEndian.PutUint32(b[34:38], 2*stride)
+	for r, row := range rows {
+		for x, p := range row {
+			copy(b[54+r*stride+3*x:], []byte{p.Blue, p.Green, p.Red})
+		}
+	}
+	return b
+}
+
+func TestBMPRowOrder(t *testing.T) {
+	first := [2]Pixel{{Red: 255}, {Green: 255}}
+	second := [2]Pixel{{Blue: 255}, {Red: 255, Green: 255, Blue: 255}}
+
+	tests := []struct {
+		name   string
+		height int32
+		top    [2]Pixel // The row that shows at the visual top
+	}{
+		// The first row in a bottom-up file is the bottom of the picture
+		{"bottom-up", 2, second},
+		{"top-down", -2, first},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := twoByTwoBMP(tt.height, [2][2]Pixel{first, second})
+
+			image, err := ParseBMP(data)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			reference, err := decodeTheirs(data)
+			if err != nil {
+				t.Fatalf("x/image/bmp: %v", err)
+			}
+
+			for x, want := range tt.top {
+				if got := image.At(x, 0); got != want {
+					t.Errorf("ParseBMP: At(%d, 0) = %v, want %v", x, got, want)
+				}
+				if got, want := opaqueAt(reference, x, 0), (color.NRGBA{R: want.Red, G: want.Green, B: want.Blue, A: 255}); got != want {
+					t.Errorf("x/image/bmp: (%d, 0) = %v, want %v", x, got, want)
+				}
+			}
+			if err := CheckInvariants(image); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestBMPRowOrderRoundTrip(t *testing.T) {
+	first := [2]Pixel{{Red: 255}, {Green: 255}}
+	second := [2]Pixel{{Blue: 255}, {Red: 10, Green: 20, Blue: 30}}
+
+	for _, height := range []int32{2, -2} {
+		t.Run(fmt.Sprintf("height_%d", height), func(t *testing.T) {
+			data := twoByTwoBMP(height, [2][2]Pixel{first, second})
+			image, err := ParseBMP(data)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			// Data holds the visual top row first whatever the file order
+			top := first
+			if height > 0 {
+				top = second
+			}
+			if got := [2]Pixel(image.Data[0]); got != top {
+				t.Errorf("Data[0] = %v, want the top row %v", got, top)
+			}
+
+			out, err := SerializeBMP(image)
+			if err != nil {
+				t.Fatalf("SerializeBMP: %v", err)
+			}
+			if !bytes.Equal(out[54:], data[54:]) {
+				t.Errorf("pixel array = %v, want %v", out[54:], data[54:])
+			}
+			if got := int32(binary.LittleEndian.Uint32(out[22:26])); got != height {
+				t.Errorf("height = %d, want %d", got, height)
+			}
+		})
+	}
+}
+
+func TestAtAndSetFollowRows(t *testing.T) {
+	for _, image := range []*BMPImage{noiseImage(5, 3, 1), topDown(noiseImage(5, 3, 1))} {
+		for y, row := range image.Rows() {
+			for x, p := range row {
+				if got := image.At(x, y); got != p {
+					t.Fatalf("At(%d, %d) = %v, want %v", x, y, got, p)
+				}
+			}
+		}
+
+		marker := Pixel{Red: 1, Green: 2, Blue: 3}
+		image.Set(4, 0, marker)
+		for y, row := range image.Rows() {
+			if y == 0 && row[4] != marker {
+				t.Errorf("Set(4, 0) did not change the top-right pixel (height %d)", image.InfoHeader.Height)
+			}
+		}
+	}
+}
+
+func TestCheckInvariants(t *testing.T) {
+	tests := []struct {
+		name  string
+		image *BMPImage
+	}{
+		{"bottom-up", noiseImage(7, 5, 1)},
+		{"top-down", topDown(noiseImage(7, 5, 2))},
+		{"1x1", noiseImage(1, 1, 3)},
+		{"single row", topDown(noiseImage(9, 1, 4))},
+		{"single column", noiseImage(1, 9, 5)},
+		{"transparent", withAlpha(noiseImage(6, 4, 6))},
+		{"wide", func() *BMPImage { image := noiseImage(6, 4, 7); image.Widen(); return image }()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.image.Clone()
+			if err := CheckInvariants(tt.image); err != nil {
+				t.Fatal(err)
+			}
+			if !gridsEqual(tt.image.Data, before.Data) {
+				t.Error("CheckInvariants changed the image")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// KaleidoscopeOptions stores the number of mirrored segments of a
+// kaleidoscope, an even number of at least 2.
+type KaleidoscopeOptions struct {
+	Segments int
+}
+
+func (o KaleidoscopeOptions) Validate(width, height int) error        { return nil }
+func (o KaleidoscopeOptions) Dimensions(width, height int) (int, int) { return width, height }
+
+// MemoryMultiplier is 2 since the output is written into new rows.
+func (o KaleidoscopeOptions) MemoryMultiplier() int { return 2 }
+
+func (o KaleidoscopeOptions) String() string {
+	return "kaleidoscope " + strconv.Itoa(o.Segments)
+}
+
+// parseKaleidoscopeOptions parses the number of segments of a kaleidoscope.
+// Odd counts are rejected: a wedge can only be mirrored all the way around
+// the center back onto itself in an even number of reflections.
+func parseKaleidoscopeOptions(value string) (KaleidoscopeOptions, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 2 || n%2 != 0 {
+		return KaleidoscopeOptions{}, fmt.Errorf("invalid kaleidoscope option: %s (must be an even number of segments, at least 2)", value)
+	}
+	return KaleidoscopeOptions{Segments: n}, nil
+}
+
+// Kaleidoscope makes the image symmetric around its center by mirroring a
+// wedge of it, of 360/Segments degrees, into every other segment: the
+// source wedge lies just left of the line from the center straight up, and
+// each segment is the reflection of its neighbor. With 2 segments the left
+// half is mirrored onto the right one, and with 4 the top-left quadrant onto
+// the other three; both copy pixels exactly. Higher counts sample the wedge
+// bilinearly, and the parts of segments whose reflection falls outside the
+// image repeat its nearest edge pixels. The size of the image is kept.
+func Kaleidoscope(image *BMPImage, opts KaleidoscopeOptions) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+
+	data := makeGrid[Pixel](width, height)
+	var alpha [][]byte
+	if image.Alpha != nil {
+		alpha = makeGrid[byte](width, height)
+	}
+	var wide [][]Pixel16
+	if image.Wide != nil {
+		wide = makeGrid[Pixel16](width, height)
+	}
+
+	ForRange(height, 0, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range width {
+				if opts.Segments <= 4 {
+					sx, sy := min(x, width-1-x), y
+					if opts.Segments == 4 {
+						sy = min(y, height-1-y)
+					}
+					data[y][x] = image.Data[sy][sx]
+					if alpha != nil {
+						alpha[y][x] = image.Alpha[sy][sx]
+					}
+					if wide != nil {
+						wide[y][x] = image.Wide[sy][sx]
+					}
+					continue
+				}
+
+				s := kaleidoscopeSample(float64(x)+0.5, float64(y)+0.5, width, height, opts.Segments)
+				data[y][x] = s.pixel(image)
+				if alpha != nil {
+					alpha[y][x] = s.alpha(image)
+				}
+				if wide != nil {
+					wide[y][x] = s.wide(image)
+				}
+			}
+		}
+	})
+
+	image.Data, image.Alpha, image.Wide = data, alpha, wide
+}
+
+// kaleidoscopeSample returns the bilinear sample of the source wedge that
+// the point (x, y) of a width x height image reflects, folding its angle
+// around the center into the wedge at the same distance.
+func kaleidoscopeSample(x, y float64, width, height, segments int) bilinearSample {
+	cx, cy := float64(width)/2, float64(height)/2
+	dx, dy := x-cx, y-cy
+	r := math.Hypot(dx, dy)
+
+	// With y pointing down, the wedge ends at 3π/2, straight up
+	wedge := 2 * math.Pi / float64(segments)
+	start := 3*math.Pi/2 - wedge
+	theta := math.Mod(math.Atan2(dy, dx)-start+4*math.Pi, 2*math.Pi)
+	k := math.Floor(theta / wedge)
+	local := theta - k*wedge
+	if int(k)%2 == 1 {
+		local = wedge - local
+	}
+
+	sx := min(max(cx+r*math.Cos(start+local), 0.5), float64(width)-0.5)
+	sy := min(max(cy+r*math.Sin(start+local), 0.5), float64(height)-0.5)
+	s, _ := bilinearAt(sx, sy, width, height)
+	return s
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestKaleidoscopeQuadrantSymmetry(t *testing.T) {
+	for _, size := range [][2]int{{12, 8}, {13, 7}, {1, 5}} {
+		for _, orientation := range []string{"bottom-up", "top-down"} {
+			t.Run(fmt.Sprintf("%dx%d_%s", size[0], size[1], orientation), func(t *testing.T) {
+				image := withAlpha(noiseImage(size[0], size[1], 1))
+				if orientation == "top-down" {
+					image = topDown(image)
+				}
+				src := image.Clone()
+				Kaleidoscope(image, KaleidoscopeOptions{Segments: 4})
+				checkShape(t, image, size[0], size[1])
+
+				w, h := size[0], size[1]
+				alphaAt := func(image *BMPImage, x, y int) byte { return image.Alpha[y][x] }
+				for y := range h {
+					for x := range w {
+						p := image.At(x, y)
+						for _, r := range [][2]int{{w - 1 - x, y}, {x, h - 1 - y}, {w - 1 - x, h - 1 - y}} {
+							if q := image.At(r[0], r[1]); q != p || alphaAt(image, r[0], r[1]) != alphaAt(image, x, y) {
+								t.Fatalf("(%d, %d) = %v but its reflection (%d, %d) = %v", x, y, p, r[0], r[1], q)
+							}
+						}
+						// The top-left quadrant is the source, kept as it was
+						if x < (w+1)/2 && y < (h+1)/2 && p != src.At(x, y) {
+							t.Fatalf("(%d, %d) of the top-left quadrant changed", x, y)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestKaleidoscopeHalves(t *testing.T) {
+	image := noiseImage(9, 4, 2)
+	src := image.Clone()
+	Kaleidoscope(image, KaleidoscopeOptions{Segments: 2})
+	for y := range 4 {
+		for x := range 9 {
+			if want := src.At(min(x, 8-x), y); image.At(x, y) != want {
+				t.Fatalf("(%d, %d) = %v, want %v", x, y, image.At(x, y), want)
+			}
+		}
+	}
+}
+
+func TestKaleidoscopeWedges(t *testing.T) {
+	const size = 41
+	image := noiseImage(size, size, 3)
+	image.Widen()
+	src := image.Clone()
+	Kaleidoscope(image, KaleidoscopeOptions{Segments: 8})
+	checkShape(t, image, size, size)
+	image.Narrow()
+	src.Narrow()
+
+	near := func(p, q Pixel) bool {
+		d := func(a, b byte) bool { return a-b <= 1 || b-a <= 1 }
+		return d(p.Blue, q.Blue) && d(p.Green, q.Green) && d(p.Red, q.Red)
+	}
+	for y := range size {
+		for x := range size {
+			// Straight up from the center is a mirror line
+			if p, q := image.At(x, y), image.At(size-1-x, y); !near(p, q) {
+				t.Fatalf("(%d, %d) = %v but its mirror image = %v", x, y, p, q)
+			}
+		}
+	}
+	// The middle of the source wedge, 22.5 degrees left of straight up, is kept
+	angle := 3*math.Pi/2 - math.Pi/8
+	for _, r := range []float64{4, 10, 16} {
+		x := int(size/2.0 + r*math.Cos(angle))
+		y := int(size/2.0 + r*math.Sin(angle))
+		if p, want := image.At(x, y), src.At(x, y); !near(p, want) {
+			t.Errorf("(%d, %d) of the source wedge = %v, want %v", x, y, p, want)
+		}
+	}
+}
+
+func TestKaleidoscopeRejectsSegments(t *testing.T) {
+	for _, value := range []string{"0", "1", "3", "7", "-4", "x", ""} {
+		if _, err := parseKaleidoscopeOptions(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
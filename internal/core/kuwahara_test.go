@@ -0,0 +1,107 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// noisyStep returns a gray image that is dark left of column edge and light
+// from it on, with uniform noise of up to amount levels added to every pixel.
+func noisyStep(width, height, edge, amount int, seed int64) *BMPImage {
+	rng := rand.New(rand.NewSource(seed))
+	image := NewImage(width, height)
+	for _, row := range image.Rows() {
+		for x := range row {
+			v := 60
+			if x >= edge {
+				v = 190
+			}
+			v += rng.Intn(2*amount+1) - amount
+			row[x] = Pixel{Blue: byte(v), Green: byte(v), Red: byte(v)}
+		}
+	}
+	return image
+}
+
+// deviation returns the standard deviation of the green values of the image.
+func deviation(image *BMPImage) float64 {
+	var sum, squares, n float64
+	for _, row := range image.Rows() {
+		for _, p := range row {
+			v := float64(p.Green)
+			sum, squares, n = sum+v, squares+v*v, n+1
+		}
+	}
+	mean := sum / n
+	return math.Sqrt(squares/n - mean*mean)
+}
+
+func TestKuwaharaSmoothsFlatRegions(t *testing.T) {
+	image := noisyStep(40, 30, 40, 20, 1)
+	before := deviation(image)
+	if err := Kuwahara(image, 4); err != nil {
+		t.Fatal(err)
+	}
+	if after := deviation(image); after > before/4 {
+		t.Errorf("noise deviation went from %.2f to %.2f, want at most %.2f", before, after, before/4)
+	}
+}
+
+func TestKuwaharaPreservesEdges(t *testing.T) {
+	for _, radius := range []int{1, 3, 6} {
+		image := noisyStep(40, 20, 17, 8, int64(radius))
+		if err := Kuwahara(image, radius); err != nil {
+			t.Fatal(err)
+		}
+
+		// The step stays between columns 16 and 17, from one side's level to the other's
+		for y, row := range image.Rows() {
+			for x, p := range row {
+				dark := x < 17
+				if dark && p.Green > 60+8 || !dark && p.Green < 190-8 {
+					t.Fatalf("radius %d: pixel (%d, %d) = %d is on the wrong side of the edge", radius, x, y, p.Green)
+				}
+			}
+		}
+	}
+}
+
+func TestKuwaharaKeepsUniformImages(t *testing.T) {
+	image := NewImage(9, 5)
+	for _, row := range image.Rows() {
+		for x := range row {
+			row[x] = Pixel{Blue: 10, Green: 20, Red: 30}
+		}
+	}
+	want := image.Clone()
+	if err := Kuwahara(image, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !gridsEqual(image.Data, want.Data) {
+		t.Error("Kuwahara changed a uniform image")
+	}
+}
+
+func TestParseKuwaharaArgs(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"kuwahara:1", true},
+		{"kuwahara:15", true},
+		{"kuwahara", false},
+		{"kuwahara:0", false},
+		{"kuwahara:-2", false},
+		{"kuwahara:2.5", false},
+		{"kuwahara:2:3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, err := parseFilterOptions(tt.value); (err == nil) != tt.ok {
+				t.Errorf("parseFilterOptions(%q) error = %v, want ok %v", tt.value, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Histogram counts how many pixels of the image have each luminance value.
+func Histogram(image *BMPImage) [256]int {
+	var hist [256]int
+	for _, row := range image.Data {
+		for _, pixel := range row {
+			hist[luminance(pixel)]++
+		}
+	}
+	return hist
+}
+
+// Levels linearly remaps every channel so that black becomes 0 and white
+// becomes 255. Values outside [black, white] are clipped. Levels(image, 0, 255)
+// leaves the image unchanged, as does any call with black >= white.
+func Levels(image *BMPImage, black, white byte) {
+	if black >= white {
+		return
+	}
+
+	// Build a lookup table once instead of remapping every channel value.
+	var lut [256]byte
+	span := int(white) - int(black)
+	for v := range lut {
+		switch {
+		case v <= int(black):
+			lut[v] = 0
+		case v >= int(white):
+			lut[v] = 255
+		default:
+			lut[v] = byte(divRound((v-int(black))*255, span))
+		}
+	}
+
+	mapPixels(image, &lut)
+}
+
+// Gamma applies gamma correction to every channel: values are mapped through
+// v^(1/gamma) on the 0-1 scale and rounded to the nearest integer, so a gamma
+// above 1 brightens the midtones and a gamma below 1 darkens them.
+func Gamma(image *BMPImage, gamma float64) {
+	var lut [256]byte
+	for v := range lut {
+		lut[v] = unitToByte(math.Pow(float64(v)/255, 1/gamma))
+	}
+
+	mapPixels(image, &lut)
+}
+
+// mapPixels replaces every channel value v of the image with lut[v]. Rows
+// are processed in parallel.
+func mapPixels(image *BMPImage, lut *[256]byte) {
+	ForRange(len(image.Data), 0, func(start, end int) {
+		for _, row := range image.Data[start:end] {
+			for x := range row {
+				p := &row[x]
+				p.Blue, p.Green, p.Red = lut[p.Blue], lut[p.Green], lut[p.Red]
+			}
+		}
+	})
+}
+
+// AutoContrast stretches the luminance range of the image to the full 0-255
+// range. The darkest and brightest clip percent of pixels are ignored when
+// looking for the range, so a few outliers can't defeat the stretch.
+func AutoContrast(image *BMPImage, clip float64) {
+	black, white := histogramBounds(Histogram(image), clip)
+	Levels(image, black, white)
+}
+
+// histogramBounds returns the lowest and highest values of hist after
+// discarding clip percent of the total count from each end.
+func histogramBounds(hist [256]int, clip float64) (byte, byte) {
+	total := 0
+	for _, n := range hist {
+		total += n
+	}
+	skip := int(float64(total) * clip / 100)
+
+	low, count := 0, 0
+	for ; low < 255; low++ {
+		count += hist[low]
+		if count > skip {
+			break
+		}
+	}
+
+	high := 255
+	count = 0
+	for ; high > 0; high-- {
+		count += hist[high]
+		if count > skip {
+			break
+		}
+	}
+
+	return byte(low), byte(high)
+}
+
+// parseLevelsArgs parses the parameters of the levels filter: <black>:<white>.
+func parseLevelsArgs(args []string) (byte, byte, error) {
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("levels filter requires two values: levels:<black>:<white>")
+	}
+
+	black, err := strconv.Atoi(args[0])
+	if err != nil || black < 0 || black > 255 {
+		return 0, 0, fmt.Errorf("invalid levels black value: %s", args[0])
+	}
+	white, err := strconv.Atoi(args[1])
+	if err != nil || white < 0 || white > 255 || white <= black {
+		return 0, 0, fmt.Errorf("invalid levels white value: %s", args[1])
+	}
+
+	return byte(black), byte(white), nil
+}
+
+// defaultAutoContrastClip is the percentage of pixels autocontrast ignores at
+// each end unless one is given.
+const defaultAutoContrastClip = 0.0
+
+// parseAutoContrastArgs parses the optional clip percentage of the autocontrast filter.
+func parseAutoContrastArgs(args []string) (float64, error) {
+	if len(args) == 0 {
+		return defaultAutoContrastClip, nil
+	}
+	if len(args) > 1 {
+		return 0, fmt.Errorf("autocontrast filter takes at most one value: autocontrast[:<clip%%>]")
+	}
+
+	clip, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || clip < 0 || clip >= 50 {
+		return 0, fmt.Errorf("invalid autocontrast clip value: %s (must be in [0, 50))", args[0])
+	}
+	return clip, nil
+}
+
+// parseGammaArgs parses the exponent of the gamma filter.
+func parseGammaArgs(args []string) (float64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("gamma filter requires one value: gamma:<value>")
+	}
+
+	gamma, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || gamma <= 0 || math.IsInf(gamma, 0) {
+		return 0, fmt.Errorf("invalid gamma value: %s (must be positive)", args[0])
+	}
+	return gamma, nil
+}
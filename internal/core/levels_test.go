@@ -0,0 +1,75 @@
+package core
+
+import "testing"
+
+// grayRow returns a one-row image with a gray pixel of each given value.
+func grayRow(values ...int) *BMPImage {
+	image := NewImage(len(values), 1)
+	for x, v := range values {
+		image.Data[0][x] = Pixel{Blue: byte(v), Green: byte(v), Red: byte(v)}
+	}
+	return image
+}
+
+// grayValues returns the values of the pixels of a row made by grayRow.
+func grayValues(image *BMPImage) []int {
+	values := make([]int, len(image.Data[0]))
+	for x, p := range image.Data[0] {
+		values[x] = int(p.Red)
+	}
+	return values
+}
+
+func TestAutoContrastStretches(t *testing.T) {
+	var ramp []int
+	for v := 60; v <= 180; v++ {
+		ramp = append(ramp, v)
+	}
+	image := grayRow(ramp...)
+	AutoContrast(image, 0)
+
+	got := grayValues(image)
+	if got[0] != 0 || got[len(got)-1] != 255 {
+		t.Errorf("60-180 stretched to %d-%d, want 0-255", got[0], got[len(got)-1])
+	}
+	for x := 1; x < len(got); x++ {
+		if got[x] <= got[x-1] {
+			t.Fatalf("%d and %d became %d and %d, which isn't increasing", ramp[x-1], ramp[x], got[x-1], got[x])
+		}
+	}
+	// The middle of the range lands in the middle, rounded up
+	if mid := got[60]; mid != 128 {
+		t.Errorf("120 stretched to %d, want 128", mid)
+	}
+
+	// An image spanning the whole range is left as it is
+	full := grayRow(0, 17, 128, 200, 255)
+	AutoContrast(full, 0)
+	if got := grayValues(full); got[1] != 17 || got[2] != 128 || got[3] != 200 {
+		t.Errorf("0-255 changed into %v", got)
+	}
+}
+
+func TestAutoContrastClipsHotPixel(t *testing.T) {
+	// 99 pixels in 60-180, and a single hot one at 255
+	values := []int{255}
+	for i := range 99 {
+		values = append(values, 60+i*120/98)
+	}
+
+	pinned := grayRow(values...)
+	AutoContrast(pinned, 0)
+	if got := grayValues(pinned); got[len(got)-1] == 255 {
+		t.Fatalf("without clipping, the hot pixel doesn't pin the range: 180 became %d", got[len(got)-1])
+	}
+
+	clipped := grayRow(values...)
+	AutoContrast(clipped, 1)
+	got := grayValues(clipped)
+	if got[1] != 0 || got[len(got)-1] != 255 {
+		t.Errorf("with 1%% clipped, 60-180 stretched to %d-%d, want 0-255", got[1], got[len(got)-1])
+	}
+	if got[0] != 255 {
+		t.Errorf("the hot pixel became %d, want 255", got[0])
+	}
+}
@@ -0,0 +1,59 @@
+package core
+
+import "testing"
+
+func TestLocalContrastFlat(t *testing.T) {
+	for _, color := range []Pixel{{}, {Blue: 100, Green: 100, Red: 100}, {Blue: 90, Green: 50, Red: 200}, {Blue: 255, Green: 255, Red: 255}} {
+		for _, radius := range []int{1, 4, 40} {
+			image := NewImage(13, 9)
+			for _, row := range image.Data {
+				for x := range row {
+					row[x] = color
+				}
+			}
+			if err := LocalContrast(image, radius, 2); err != nil {
+				t.Fatal(err)
+			}
+			for y, row := range image.Rows() {
+				for x, p := range row {
+					if p != color {
+						t.Fatalf("radius %d: pixel (%d, %d) of a flat %v image became %v", radius, x, y, color, p)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLocalContrastEdge(t *testing.T) {
+	// A vertical edge between levels 80 and 160 at x = 10
+	image := NewImage(20, 5)
+	for _, row := range image.Data {
+		for x := range row {
+			v := byte(80)
+			if x >= 10 {
+				v = 160
+			}
+			row[x] = Pixel{Blue: v, Green: v, Red: v}
+		}
+	}
+	if err := LocalContrast(image, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The windows of radius 3 around x = 7 to 12 straddle the edge: the
+	// pixels next to it are pushed apart by the cap of 32 levels, and those
+	// further away by their difference to the mean of their window, which
+	// is 6*80+160 over 7 at x = 7. Beyond, nothing changes.
+	want := map[int]byte{0: 80, 6: 80, 7: 69, 9: 48, 10: 192, 12: 171, 13: 160, 19: 160}
+	for y, row := range image.Rows() {
+		for x, v := range want {
+			if p := row[x]; p != (Pixel{Blue: v, Green: v, Red: v}) {
+				t.Errorf("pixel (%d, %d) is %v, want level %d", x, y, p, v)
+			}
+		}
+	}
+	if got := int(image.Data[0][10].Red) - int(image.Data[0][9].Red); got <= 80 {
+		t.Errorf("the edge is %d levels high, no more than the 80 it was", got)
+	}
+}
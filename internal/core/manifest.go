@@ -0,0 +1,80 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+	"github.com/ab-dauletkhan/bitmap/manifest"
+)
+
+// Version identifies the build of the tool in manifests. It is meant to be
+// set at build time with -ldflags "-X github.com/ab-dauletkhan/bitmap/internal/core.Version=...".
+var Version = "dev"
+
+// NewManifest describes the run of transforms over inFile into outFile,
+// encoded in the given format. The input file, or standard input for "-",
+// is read to compute its hash, and its headers give the dimensions the parameters of the transformations
+// are resolved against (see ResolveTransformations).
+func NewManifest(inFile, outFile, format string, transforms []Transform) (*manifest.Manifest, error) {
+	header, _, _, err := readImageHeader(inFile)
+	if err != nil {
+		return nil, err
+	}
+	transforms = ResolveTransformations(transforms, int(header.InfoHeader.Width), utils.Abs(int(header.InfoHeader.Height)))
+
+	f, _, err := openInput(inFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	m := &manifest.Manifest{
+		Input:       inFile,
+		InputSHA256: hex.EncodeToString(h.Sum(nil)),
+		Output:      outFile,
+		Format:      format,
+		Transforms:  make([]manifest.Transform, len(transforms)),
+		Version:     Version,
+		Created:     time.Now().UTC(),
+	}
+	for i, t := range transforms {
+		options, err := json.Marshal(t.Options)
+		if err != nil {
+			return nil, err
+		}
+		m.Transforms[i] = manifest.Transform{
+			Type:        t.Type.String(),
+			Description: fmt.Sprint(t.Options),
+			Options:     options,
+		}
+	}
+	return m, nil
+}
+
+// WriteManifest writes m as indented JSON to path, atomically like Save.
+func WriteManifest(m *manifest.Manifest, path string) error {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomic(path)
+	if err != nil {
+		return ioError(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return ioError(err)
+	}
+	return ioError(f.Commit())
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/manifest"
+)
+
+func TestManifestRecordsResolvedParameters(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.bmp")
+	if err := os.WriteFile(in, encodeBMP(t, noiseImage(100, 50, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	transforms, _, _, err := ParseTransformations([]string{
+		"--filter=blur", "--crop=center:0.5", "--crop=right", "--filter=pixelate", "--filter=autocontrast", "--mirror=horizontal",
+		in, "out.bmp",
+	})
+	if err != nil {
+		t.Fatalf("ParseTransformations: %v", err)
+	}
+
+	m, err := NewManifest(in, "out.bmp", FormatBMP24, transforms)
+	if err != nil {
+		t.Fatalf("NewManifest: %v", err)
+	}
+	path := manifest.Path(filepath.Join(dir, "out.bmp"))
+	if err := WriteManifest(m, path); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+
+	// The file must decode into the public schema with nothing left over
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got manifest.Manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("decoding the manifest: %v", err)
+	}
+
+	want := []struct {
+		typ, description string
+		options          TransformOptions
+	}{
+		{"filter", "filter blur:20:shrink", FilterOptions{FilterType: "blur", Args: []string{"20", "shrink"}}},
+		{"crop", "crop 25-12-50-25", CropInfo{OffsetX: 25, OffsetY: 12, Width: 50, Height: 25}},
+		{"crop", "crop 25-0-25-25", CropInfo{OffsetX: 25, Width: 25, Height: 25}},
+		// The default block of 50 pixels is clamped to the 25x25 crop
+		{"filter", "filter pixelate size 25", FilterOptions{FilterType: "pixelate", Args: []string{}, PixelateSize: 25}},
+		{"filter", "filter autocontrast:0", FilterOptions{FilterType: "autocontrast", Args: []string{"0"}}},
+		{"mirror", "mirror horizontal", MirrorOptions{Direction: "horizontal"}},
+	}
+	if len(got.Transforms) != len(want) {
+		t.Fatalf("got %d transforms, want %d", len(got.Transforms), len(want))
+	}
+	for i, w := range want {
+		tr := got.Transforms[i]
+		if tr.Type != w.typ || tr.Description != w.description {
+			t.Errorf("transform %d: got %s %q, want %s %q", i+1, tr.Type, tr.Description, w.typ, w.description)
+		}
+		options, err := json.Marshal(w.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, tr.Options); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(compact.Bytes(), options) {
+			t.Errorf("transform %d: options %s, want %s", i+1, compact.Bytes(), options)
+		}
+	}
+}
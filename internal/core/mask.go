@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// maskThreshold is the luminance above which a mask pixel selects the pixel
+// under it.
+const maskThreshold = 127
+
+// PixelateMaskOptions stores the mask image that selects the pixelated
+// regions and the size of the pixelation blocks.
+type PixelateMaskOptions struct {
+	Path      string
+	BlockSize int
+}
+
+// Validate checks that the mask has the size of the image it is applied to.
+// Only the header of the mask is read.
+func (o PixelateMaskOptions) Validate(width, height int) error {
+	mask, err := ReadImageHeader(o.Path)
+	if err != nil {
+		return fmt.Errorf("reading mask %s: %w", o.Path, err)
+	}
+	if mw, mh := int(mask.InfoHeader.Width), utils.Abs(int(mask.InfoHeader.Height)); mw != width || mh != height {
+		return withKind(ErrOutOfBounds, fmt.Errorf("mask %s is %dx%d but the image is %dx%d", o.Path, mw, mh, width, height))
+	}
+	return nil
+}
+
+func (o PixelateMaskOptions) Dimensions(width, height int) (int, int) { return width, height }
+
+// MemoryMultiplier is 2 since the mask is decoded alongside the image.
+func (o PixelateMaskOptions) MemoryMultiplier() int { return 2 }
+
+func (o PixelateMaskOptions) String() string {
+	return fmt.Sprintf("pixelate-mask %s:%d", o.Path, o.BlockSize)
+}
+
+// parsePixelateMaskOptions parses a value of the form <mask>:<blocksize>.
+// The block size follows the last colon, so the path may contain colons.
+func parsePixelateMaskOptions(value string) (PixelateMaskOptions, error) {
+	i := strings.LastIndex(value, ":")
+	if i <= 0 {
+		return PixelateMaskOptions{}, fmt.Errorf("pixelate-mask requires a mask and a block size: <mask.bmp>:<blocksize>")
+	}
+	size, err := strconv.Atoi(value[i+1:])
+	if err != nil || size < 1 {
+		return PixelateMaskOptions{}, fmt.Errorf("invalid pixelate-mask block size: %s (must be positive)", value[i+1:])
+	}
+	return PixelateMaskOptions{Path: value[:i], BlockSize: size}, nil
+}
+
+// PixelateMask pixelates the blocks of the image that the mask selects: a
+// block is pixelated if the luminance of the mask exceeds maskThreshold
+// under any of its pixels, so blocks partly covered by the mask are
+// pixelated whole. Blocks are laid out as by the pixelate filter, and the
+// mask must have the size of the image; it is matched pixel for pixel from
+// the visual top-left corner. Widened images are pixelated at 16-bit
+// precision, leaving the pixels outside the selected blocks untouched.
+func PixelateMask(image, mask *BMPImage, blocksize int) error {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	if mw, mh := int(mask.InfoHeader.Width), len(mask.Data); mw != width || mh != height {
+		return withKind(ErrOutOfBounds, fmt.Errorf("mask is %dx%d but the image is %dx%d", mw, mh, width, height))
+	}
+	selected := make([][]bool, height)
+	for y, row := range mask.Rows() {
+		selected[y] = make([]bool, width)
+		for x, p := range row {
+			selected[y][x] = luminance(p) > maskThreshold
+		}
+	}
+
+	for startY := 0; startY < height; startY += blocksize {
+		for startX := 0; startX < width; startX += blocksize {
+			switch {
+			case !blockSelected(selected, startX, startY, blocksize):
+			case image.Wide != nil:
+				pixelateBlockWide(image, startX, startY, blocksize)
+			default:
+				fillBlock(image, startX, startY, blocksize, avgColorBlock(image, startX, startY, blocksize))
+			}
+		}
+	}
+	return nil
+}
+
+// blockSelected reports whether any pixel of the block starting at
+// (startX, startY) is selected.
+func blockSelected(selected [][]bool, startX, startY, blocksize int) bool {
+	for y := startY; y < startY+blocksize && y < len(selected); y++ {
+		for x := startX; x < startX+blocksize && x < len(selected[y]); x++ {
+			if selected[y][x] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package core
+
+import "testing"
+
+func TestPixelateMask(t *testing.T) {
+	tests := []struct {
+		name string
+		wide bool
+	}{
+		{"8-bit", false},
+		{"16-bit", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := noiseImage(8, 4, 1)
+			if tt.wide {
+				image.Widen()
+				// Levels between the 8-bit ones, which narrowing would lose
+				for _, row := range image.Wide {
+					for x := range row {
+						row[x].Red += 100
+					}
+				}
+			}
+			original := image.Clone()
+
+			// The mask selects a single pixel of the top-left 4x4 block
+			mask := NewImage(8, 4)
+			mask.Data[1][2] = Pixel{Blue: 255, Green: 255, Red: 255}
+
+			if err := PixelateMask(image, mask, 4); err != nil {
+				t.Fatalf("PixelateMask: %v", err)
+			}
+			if tt.wide && image.Wide == nil {
+				t.Fatal("the image is no longer widened")
+			}
+
+			for y := range 4 {
+				for x := range 8 {
+					inBlock := x < 4
+					if tt.wide {
+						got, was, first := image.Wide[y][x], original.Wide[y][x], image.Wide[0][0]
+						if !inBlock && got != was || inBlock && got != first {
+							t.Errorf("pixel (%d, %d) = %v, was %v", x, y, got, was)
+						}
+						continue
+					}
+					got, was, first := image.Data[y][x], original.Data[y][x], image.Data[0][0]
+					if !inBlock && got != was || inBlock && got != first {
+						t.Errorf("pixel (%d, %d) = %v, was %v", x, y, got, was)
+					}
+				}
+			}
+		})
+	}
+}
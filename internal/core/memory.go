@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// In-memory sizes in bytes of a Pixel, of an alpha value and of a Pixel16.
+const (
+	pixelSize     = 3
+	alphaSize     = 1
+	widePixelSize = 6
+)
+
+// DefaultMaxPixels is the largest number of pixels of an image the command
+// line reads or produces by default, 100 megapixels, so that a typo in a size
+// or a forged header can't exhaust the memory of the machine. The package
+// itself has no limit unless one is given, as ParseOptions.MaxPixels or to
+// ApplyTransformationsWith.
+const DefaultMaxPixels = 100_000_000
+
+// checkPixels returns an error wrapping ErrPixelLimit, and so ErrTooLarge, if
+// an image of the given dimensions exceeds limit pixels. A limit of 0 means no limit. It is checked
+// wherever pixels are allocated for a new size: before decoding an image and
+// before a transformation grows one.
+func checkPixels(width, height int, limit int64) error {
+	if pixels := int64(width) * int64(height); limit > 0 && pixels > limit {
+		return fmt.Errorf("%w: %dx%d is %d pixels, more than %d",
+			ErrPixelLimit, width, height, pixels, limit)
+	}
+	return nil
+}
+
+// PixelBytes returns the memory an image holds per pixel: 3 bytes of Data,
+// 1 more if it has an Alpha plane, and 6 more for the Wide copy of its pixels
+// when it is filtered at a precision of 16 bits.
+func PixelBytes(alpha bool, precision int) int64 {
+	n := int64(pixelSize)
+	if alpha {
+		n += alphaSize
+	}
+	if precision == 16 {
+		n += widePixelSize
+	}
+	return n
+}
+
+// EstimateMemory returns the peak number of bytes a pipeline is expected to
+// need for an image of the given dimensions read from a file of fileSize bytes,
+// holding pixelBytes bytes per pixel (see PixelBytes). Decoding holds the file
+// contents and the decoded pixels at once; after that, every transformation
+// holds as many copies of the pixels as its MemoryMultiplier, sized for the
+// larger of its input and output.
+func EstimateMemory(transforms []Transform, width, height int, fileSize, pixelBytes int64) int64 {
+	peak := fileSize + int64(width)*int64(height)*pixelBytes
+
+	for _, t := range transforms {
+		w, h := t.Options.Dimensions(width, height)
+		pixels := max(int64(width)*int64(height), int64(w)*int64(h))
+		peak = max(peak, int64(t.Options.MemoryMultiplier())*pixels*pixelBytes)
+		width, height = w, h
+	}
+
+	return peak
+}
+
+// mayHaveAlpha reports whether an image with the given headers, decoded from
+// format, may get an Alpha plane. Only the pixels tell whether it does, so
+// 32-bit BMP files and PNG files are assumed to.
+func mayHaveAlpha(image *BMPImage, format string) bool {
+	return format == InputPNG || format == InputBMP && image.InfoHeader.BitsPerPixel == 32
+}
+
+// CheckMemory estimates the memory the pipeline needs for inFile at the given
+// precision from its headers alone and returns ErrMemoryLimit if it exceeds
+// limit bytes. The check runs before the file is validated, so even a bare
+// header claiming huge dimensions is rejected for its size rather than its
+// missing data.
+func CheckMemory(transforms []Transform, inFile string, limit int64, precision int) error {
+	image, size, format, err := readImageHeader(inFile)
+	if err != nil {
+		return err
+	}
+
+	width := int(image.InfoHeader.Width)
+	height := utils.Abs(int(image.InfoHeader.Height))
+	need := EstimateMemory(transforms, width, height, size, PixelBytes(mayHaveAlpha(image, format), precision))
+	return checkMemory(width, height, need, limit)
+}
+
+// checkMemory returns ErrMemoryLimit if need exceeds limit bytes for a
+// width x height image.
+func checkMemory(width, height int, need, limit int64) error {
+	if need > limit {
+		return fmt.Errorf("%w: %dx%d image needs an estimated %s but the limit is %s",
+			ErrMemoryLimit, width, height, FormatByteSize(need), FormatByteSize(limit))
+	}
+	return nil
+}
+
+// byteUnits are the suffixes accepted by ParseByteSize, largest first.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "512MB", "2GB" or "1024".
+// Units are binary (1KB = 1024 bytes) and case-insensitive.
+func ParseByteSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper = strings.TrimSuffix(upper, u.suffix)
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n <= 0 || n > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * unit, nil
+}
+
+// FormatByteSize formats n bytes using the largest unit that keeps the value at least 1.
+func FormatByteSize(n int64) string {
+	for _, u := range byteUnits[:len(byteUnits)-1] {
+		if n >= u.size {
+			return fmt.Sprintf("%.1f%s", float64(n)/float64(u.size), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	blur := Transform{Type: FilterTransform, Options: FilterOptions{FilterType: "blur"}}
+	negative := Transform{Type: FilterTransform, Options: FilterOptions{FilterType: "negative"}}
+
+	tests := []struct {
+		name       string
+		transforms []Transform
+		alpha      bool
+		precision  int
+		want       int64
+	}{
+		{"decode only", nil, false, 8, 1000 + 100*50*3},
+		{"in place filter", []Transform{negative}, false, 8, 1000 + 100*50*3},
+		{"blur", []Transform{blur}, false, 8, 2 * 100 * 50 * 3},
+		{"blur with alpha", []Transform{blur}, true, 8, 2 * 100 * 50 * 4},
+		{"blur at 16 bits", []Transform{blur}, false, 16, 2 * 100 * 50 * 9},
+		{"blur at 16 bits with alpha", []Transform{blur}, true, 16, 2 * 100 * 50 * 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateMemory(tt.transforms, 100, 50, 1000, PixelBytes(tt.alpha, tt.precision))
+			if got != tt.want {
+				t.Errorf("EstimateMemory = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxPixelsLimitsGrowth(t *testing.T) {
+	extend := func(count int) Transform {
+		return Transform{Type: ExtendTransform, Options: ExtendOptions{Mode: "edge", Edge: "right", Count: count}}
+	}
+	mirror := Transform{Type: MirrorTransform, Options: MirrorOptions{Direction: "horizontal"}}
+	negative := Transform{Type: FilterTransform, Options: FilterOptions{FilterType: "negative"}}
+
+	tests := []struct {
+		name          string
+		limit         int64
+		width, height int
+		transforms    []Transform
+		tooLarge      bool
+	}{
+		{"extend to the limit", 100, 10, 5, []Transform{extend(10)}, false},
+		{"extend past the limit", 100, 10, 5, []Transform{extend(11)}, true},
+		{"extend past the limit later", 100, 10, 5, []Transform{mirror, extend(5), negative, extend(6)}, true},
+		{"no limit", 0, 10, 5, []Transform{extend(1000)}, false},
+		// Transformations that don't grow the image allocate nothing new
+		{"mirror over the limit", 100, 20, 10, []Transform{mirror, negative}, false},
+		{"extend over the limit", 100, 20, 10, []Transform{extend(1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTransformations(tt.transforms, tt.width, tt.height, tt.limit)
+			if got := errors.Is(err, ErrPixelLimit); got != tt.tooLarge {
+				t.Fatalf("got error %v, want ErrPixelLimit: %v", err, tt.tooLarge)
+			}
+			if tt.tooLarge && !errors.Is(err, ErrOutOfBounds) {
+				t.Errorf("error %v is not of kind ErrOutOfBounds", err)
+			}
+		})
+	}
+}
+
+func TestMaxPixelsLimitsDecoding(t *testing.T) {
+	image := noiseImage(20, 10, 1)
+	encode := func(opts SaveOptions) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, image, opts); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		return buf.Bytes()
+	}
+	bmp := encode(SaveOptions{Format: FormatBMP24})
+
+	tests := []struct {
+		name   string
+		decode func(ParseOptions) (*BMPImage, error)
+	}{
+		{"bmp", func(opts ParseOptions) (*BMPImage, error) { return DecodeImageWith(bmp, opts) }},
+		{"salvaged bmp", func(opts ParseOptions) (*BMPImage, error) {
+			b, _, err := SalvageBMP(bmp, Pixel{}, opts)
+			return b, err
+		}},
+		{"salvaged truncated bmp", func(opts ParseOptions) (*BMPImage, error) {
+			b, _, err := SalvageBMP(bmp[:len(bmp)-100], Pixel{}, opts)
+			return b, err
+		}},
+		{"ppm", func(opts ParseOptions) (*BMPImage, error) {
+			return DecodeImageWith(encode(SaveOptions{Format: FormatPPM}), opts)
+		}},
+		{"png", func(opts ParseOptions) (*BMPImage, error) {
+			return DecodeImageWith(encode(SaveOptions{Format: FormatPNG}), opts)
+		}},
+		{"native", func(opts ParseOptions) (*BMPImage, error) {
+			return DecodeImageWith(encode(SaveOptions{Format: FormatNative}), opts)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.decode(ParseOptions{MaxPixels: 199}); !errors.Is(err, ErrPixelLimit) || !errors.Is(err, ErrOutOfBounds) {
+				t.Fatalf("got error %v, want ErrPixelLimit of kind ErrOutOfBounds", err)
+			}
+
+			// At the limit, or without one as by default, the image decodes
+			for _, limit := range []int64{200, 0} {
+				if _, err := tt.decode(ParseOptions{MaxPixels: limit}); err != nil {
+					t.Errorf("limit %d: %v", limit, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// exposureSigma is the spread of the well-exposedness weight around mid-gray,
+// on a 0-1 luminance scale, as in Mertens et al.'s exposure fusion.
+const exposureSigma = 0.2
+
+// ParseMergeArgs parses the merge-exposures arguments: two or more input
+// files followed by the output file.
+func ParseMergeArgs(args []string) ([]string, string, error) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			return nil, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+	if len(args) < 3 {
+		return nil, "", withKind(ErrInvalidParameter, fmt.Errorf("merge-exposures needs at least two inputs and an output"))
+	}
+	return args[:len(args)-1], args[len(args)-1], nil
+}
+
+// MergeExposures fuses differently exposed shots of the same scene into a
+// single image. Every output pixel is the average of the input pixels at the
+// same position, weighted by how well exposed and how saturated each of them
+// is: the well-exposedness is a Gaussian of the distance of the luminance from
+// mid-gray, and the saturation the standard deviation of the channels, which
+// raises the weight by up to a half. Clipped shadows and highlights therefore
+// give way to the shots that hold detail there. The weights are never zero,
+// and are normalized per pixel.
+//
+// All images must have the same dimensions; they are matched from their
+// visual top-left corners. The result is a new 24-bit bottom-up image.
+func MergeExposures(images []*BMPImage) (*BMPImage, error) {
+	if len(images) == 0 {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("no images to merge"))
+	}
+	width, height := int(images[0].InfoHeader.Width), len(images[0].Data)
+	for _, image := range images[1:] {
+		if w, h := int(image.InfoHeader.Width), len(image.Data); w != width || h != height {
+			return nil, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, width, height, w, h)
+		}
+	}
+
+	out := NewImage(width, height)
+	weights := make([]float64, len(images))
+	for y, row := range out.Rows() {
+		for x := range row {
+			var total float64
+			for i, image := range images {
+				weights[i] = exposureWeight(image.Data[y][x])
+				total += weights[i]
+			}
+
+			var b, g, r float64
+			for i, image := range images {
+				w := weights[i] / total
+				p := image.Data[y][x]
+				b += w * float64(p.Blue)
+				g += w * float64(p.Green)
+				r += w * float64(p.Red)
+			}
+			row[x] = Pixel{Blue: unitToByte(b / 255), Green: unitToByte(g / 255), Red: unitToByte(r / 255)}
+		}
+	}
+	return out, nil
+}
+
+// exposureWeight returns the fusion weight of a pixel, from its
+// well-exposedness and its saturation.
+func exposureWeight(p Pixel) float64 {
+	l := luma(p)/255 - 0.5
+	exposedness := math.Exp(-l * l / (2 * exposureSigma * exposureSigma))
+
+	b, g, r := float64(p.Blue)/255, float64(p.Green)/255, float64(p.Red)/255
+	mean := (b + g + r) / 3
+	saturation := math.Sqrt(((b-mean)*(b-mean) + (g-mean)*(g-mean) + (r-mean)*(r-mean)) / 3)
+
+	return exposedness * (1 + saturation)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// exposureScene returns a gray scene whose left half is a textured shadow
+// patch and right half a textured highlight patch, each with 8 levels.
+func exposureScene() *BMPImage {
+	scene := NewImage(32, 16)
+	for y, row := range scene.Rows() {
+		for x := range row {
+			v := 8 + (x+y)%8*3
+			if x >= 16 {
+				v += 217
+			}
+			row[x] = Pixel{Blue: byte(v), Green: byte(v), Red: byte(v)}
+		}
+	}
+	return scene
+}
+
+// exposed returns a copy of the scene with every level multiplied by gain,
+// rounded and clipped, as a shot with a different exposure.
+func exposed(scene *BMPImage, gain float64) *BMPImage {
+	shot := scene.Clone()
+	for _, row := range shot.Data {
+		for x, p := range row {
+			v := clampRound(float64(p.Red) * gain)
+			row[x] = Pixel{Blue: v, Green: v, Red: v}
+		}
+	}
+	return shot
+}
+
+// patchStats returns the lowest and highest level of the columns [x0, x1)
+// of the image and the number of distinct levels among them.
+func patchStats(image *BMPImage, x0, x1 int) (lo, hi byte, levels int) {
+	seen := map[byte]bool{}
+	lo = 255
+	for _, row := range image.Data {
+		for _, p := range row[x0:x1] {
+			lo, hi = min(lo, p.Red), max(hi, p.Red)
+			seen[p.Red] = true
+		}
+	}
+	return lo, hi, len(seen)
+}
+
+func TestMergeExposuresRecoversShadowsAndHighlights(t *testing.T) {
+	scene := exposureScene()
+	under, normal, over := exposed(scene, 0.5), scene, exposed(scene, 4)
+
+	// The bracket clips each patch in one shot: the highlights of over
+	// and, nearly, the shadows of under
+	if _, _, levels := patchStats(over, 16, 32); levels != 1 {
+		t.Fatalf("over exposed highlights have %d levels, want them clipped to 1", levels)
+	}
+
+	merged, err := MergeExposures([]*BMPImage{under, normal, over})
+	if err != nil {
+		t.Fatalf("MergeExposures: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		x0, x1 int
+	}{
+		{"shadows", 0, 16},
+		{"highlights", 16, 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo, hi, levels := patchStats(merged, tt.x0, tt.x1)
+			if lo == 0 || hi == 255 {
+				t.Errorf("patch is clipped: levels from %d to %d", lo, hi)
+			}
+			if levels < 2 {
+				t.Errorf("patch is flat at level %d: its detail is lost", lo)
+			}
+
+			// Detail is kept in order: a brighter scene pixel is never darker in the result
+			for y := range scene.Data {
+				for x := tt.x0; x+1 < tt.x1; x++ {
+					a, b := scene.Data[y][x].Red, scene.Data[y][x+1].Red
+					ma, mb := merged.Data[y][x].Red, merged.Data[y][x+1].Red
+					if a < b && ma > mb || a > b && ma < mb {
+						t.Fatalf("row %d: levels %d and %d of the scene become %d and %d", y, a, b, ma, mb)
+					}
+				}
+			}
+		})
+	}
+
+	// The shadows are lifted out of the dark and the highlights brought down
+	if lo, _, _ := patchStats(merged, 0, 16); lo <= 8 {
+		t.Errorf("shadows start at %d, no brighter than the normal shot", lo)
+	}
+	if _, hi, _ := patchStats(merged, 16, 32); hi >= 246 {
+		t.Errorf("highlights reach %d, no darker than the normal shot", hi)
+	}
+}
+
+func TestMergeExposuresRejectsMismatchedSizes(t *testing.T) {
+	_, err := MergeExposures([]*BMPImage{NewImage(4, 4), NewImage(4, 5)})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("got error %v, want ErrDimensionMismatch", err)
+	}
+}
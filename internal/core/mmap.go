@@ -0,0 +1,96 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultMmapThreshold is the default of MmapThreshold: 256 MiB.
+const DefaultMmapThreshold = 256 << 20
+
+// MmapThreshold is the size in bytes from which LoadImage memory-maps a file
+// read-only instead of reading it into memory, so that a huge input isn't
+// held twice, as file contents and as decoded pixels, while it is decoded.
+// The OS pages the file in as the decoder touches it. 0 maps every non-empty
+// file, as set by the --mmap flag of apply.
+var MmapThreshold int64 = DefaultMmapThreshold
+
+// readFile returns the contents of the file at path, memory-mapped if it is
+// at least MmapThreshold bytes long and mapping is supported, along with a
+// function releasing them. The contents must not be used after release is
+// called. The decoders copy every pixel into the image they return, so the
+// image never aliases the mapping and can outlive it. A path of "-" reads
+// standard input to its end, once: later reads of "-" get the same contents.
+func readFile(path string) (data []byte, release func() error, err error) {
+	if path == "-" {
+		data, err = readStdin()
+		if err != nil {
+			return nil, nil, err
+		}
+		return data, func() error { return nil }, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if size := info.Size(); size > 0 && size >= MmapThreshold && info.Mode().IsRegular() {
+		if data, release, err := mapFile(f, size); err == nil {
+			return data, release, nil
+		}
+	}
+
+	// Small files, and files that can't be mapped, are read whole
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
+
+// stdin holds standard input once read. It can only be read once, while a
+// run may need its input several times: for the headers of a dry run or a
+// memory check, for the pixels and for the hash of a manifest.
+var stdin struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// readStdin returns the whole of standard input, reading it on the first
+// call only.
+func readStdin() ([]byte, error) {
+	stdin.once.Do(func() { stdin.data, stdin.err = io.ReadAll(os.Stdin) })
+	return stdin.data, stdin.err
+}
+
+// openInput opens the file at path for reading and returns it with its
+// size. A path of "-" gives the contents of standard input, as readFile.
+func openInput(path string) (io.ReadCloser, int64, error) {
+	if path == "-" {
+		data, err := readStdin()
+		if err != nil {
+			return nil, 0, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
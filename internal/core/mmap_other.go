@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile reports that memory mapping isn't supported, so that readFile reads
+// the file instead.
+func mapFile(f *os.File, size int64) (data []byte, release func() error, err error) {
+	return nil, nil, errors.New("memory mapping is not supported on this platform")
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmapFrom lowers MmapThreshold for the test so that small files are mapped.
+func mmapFrom(t *testing.T, threshold int64) {
+	saved := MmapThreshold
+	MmapThreshold = threshold
+	t.Cleanup(func() { MmapThreshold = saved })
+}
+
+func TestLoadImageMapsLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	want := noiseImage(33, 17, 1)
+	bmp := encodeBMP(t, want)
+
+	tests := []struct {
+		name      string
+		threshold int64
+	}{
+		{"below the threshold", int64(len(bmp)) + 1},
+		{"at the threshold", int64(len(bmp))},
+		{"every file", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mmapFrom(t, tt.threshold)
+			path := filepath.Join(dir, "in.bmp")
+			if err := os.WriteFile(path, bmp, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, load := range map[string]func(string) (*BMPImage, error){"LoadImage": LoadImage, "LoadBMP": LoadBMP} {
+				image, err := load(path)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				// The file is unmapped by now; the image must not depend on it
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+				if !gridsEqual(image.Data, want.Data) {
+					t.Errorf("%s decoded different pixels", name)
+				}
+				if err := os.WriteFile(path, bmp, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("mapped or read, the content is the same")
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		threshold int64
+		want      string
+	}{
+		{"read", path, DefaultMmapThreshold, string(content)},
+		{"mapped", path, 1, string(content)},
+		{"empty file is never mapped", empty, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mmapFrom(t, tt.threshold)
+			data, release, err := readFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %q, want %q", data, tt.want)
+			}
+			if err := release(); err != nil {
+				t.Errorf("release: %v", err)
+			}
+		})
+	}
+
+	if _, _, err := readFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("got error %v for a missing file, want a not-exist error", err)
+	}
+}
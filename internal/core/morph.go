@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// morphologyFilters are the filters built on Erode and Dilate.
+var morphologyFilters = []string{"erode", "dilate", "open", "close"}
+
+// Morphology applies one of morphologyFilters with the given radius. Every
+// channel of every pixel is replaced by its minimum (erode) or maximum
+// (dilate) over the (2*radius+1)-pixel square around it. Open is an erode
+// followed by a dilate, which removes bright specks smaller than the square
+// but keeps larger bright shapes as they are; close is a dilate followed by
+// an erode, which fills dark specks and gaps the same way.
+func Morphology(image *BMPImage, name string, radius int) {
+	switch name {
+	case "erode":
+		morph(image, radius, minPixel)
+	case "dilate":
+		morph(image, radius, maxPixel)
+	case "open":
+		morph(image, radius, minPixel)
+		morph(image, radius, maxPixel)
+	case "close":
+		morph(image, radius, maxPixel)
+		morph(image, radius, minPixel)
+	}
+}
+
+func minPixel(a, b Pixel) Pixel {
+	return Pixel{Blue: min(a.Blue, b.Blue), Green: min(a.Green, b.Green), Red: min(a.Red, b.Red)}
+}
+
+func maxPixel(a, b Pixel) Pixel {
+	return Pixel{Blue: max(a.Blue, b.Blue), Green: max(a.Green, b.Green), Red: max(a.Red, b.Red)}
+}
+
+// morph replaces every pixel by op over the square of the given radius
+// around it, as a pass over the rows followed by a pass over the columns,
+// since the minimum and maximum over a square are separable. The square is
+// clipped to the image, which gives the same result as repeating the edge
+// pixels. Rows, then bands of columns, are processed in parallel.
+//
+// Reading a column touches one pixel of every row, and so a cache line per
+// pixel. The column pass instead transposes a band of morphTile columns,
+// reading the rows a run of pixels at a time, into a scratch buffer where
+// every column is contiguous, runs the row kernel over it and transposes it
+// back.
+func morph(image *BMPImage, radius int, op func(a, b Pixel) Pixel) {
+	morphRows(image, radius, op)
+	morphColumns(image, radius, op)
+}
+
+// morphRows is the pass of morph over the rows.
+func morphRows(image *BMPImage, radius int, op func(a, b Pixel) Pixel) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	ForRange(height, 0, func(start, end int) {
+		w := newWindowOp(width, radius, op)
+		for y := start; y < end; y++ {
+			w.apply(image.Data[y])
+		}
+	})
+}
+
+// morphColumns is the pass of morph over the columns.
+func morphColumns(image *BMPImage, radius int, op func(a, b Pixel) Pixel) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	bands := (width + morphTile - 1) / morphTile
+	ForRange(bands, 0, func(start, end int) {
+		w := newWindowOp(height, radius, op)
+		scratch := getPixelBuffer(morphTile * height)
+		defer putPixelBuffer(scratch)
+		for x0 := start * morphTile; x0 < end*morphTile && x0 < width; x0 += morphTile {
+			x1 := min(x0+morphTile, width)
+			for y, row := range image.Data {
+				for i, p := range row[x0:x1] {
+					scratch[i*height+y] = p
+				}
+			}
+			for i := range x1 - x0 {
+				w.apply(scratch[i*height : (i+1)*height])
+			}
+			for y, row := range image.Data {
+				for i := range row[x0:x1] {
+					row[x0+i] = scratch[i*height+y]
+				}
+			}
+		}
+	})
+}
+
+// morphTile is the number of columns the column pass of morph transposes at
+// once: 16 pixels of 3 bytes span less than a cache line of every row, and
+// keep the 16 columns being written to few enough for the cache too.
+const morphTile = 16
+
+// pixelPool recycles the scratch buffers of the column passes. Buffers are
+// returned to the pool as they are, so their contents are arbitrary when
+// handed out again.
+var pixelPool sync.Pool
+
+// getPixelBuffer returns a buffer of n pixels, reusing one from pixelPool if possible.
+func getPixelBuffer(n int) []Pixel {
+	if b, ok := pixelPool.Get().(*[]Pixel); ok && cap(*b) >= n {
+		return (*b)[:n]
+	}
+	return make([]Pixel, n)
+}
+
+// putPixelBuffer returns a buffer obtained from getPixelBuffer to pixelPool.
+func putPixelBuffer(b []Pixel) {
+	pixelPool.Put(&b)
+}
+
+// windowOp computes op over a sliding window of 2*radius+1 elements with the
+// van Herk/Gil-Werman algorithm, which takes three applications of op per
+// element whatever the radius. The line is padded with radius copies of its
+// end elements on both sides and cut into blocks of the window size; every
+// window then spans the end of one block and the start of the next, so its
+// result combines a suffix of the one with a prefix of the other.
+type windowOp struct {
+	radius         int
+	op             func(a, b Pixel) Pixel
+	padded         []Pixel
+	prefix, suffix []Pixel
+}
+
+// newWindowOp returns a windowOp for lines of n elements.
+func newWindowOp(n, radius int, op func(a, b Pixel) Pixel) *windowOp {
+	size := n + 2*radius
+	return &windowOp{
+		radius: radius,
+		op:     op,
+		padded: make([]Pixel, size),
+		prefix: make([]Pixel, size),
+		suffix: make([]Pixel, size),
+	}
+}
+
+// apply replaces every element of line, which must have the length the
+// windowOp was made for, by op over the window centered on it.
+func (w *windowOp) apply(line []Pixel) {
+	k := 2*w.radius + 1
+	p := w.padded
+	for i := range w.radius {
+		p[i], p[len(p)-1-i] = line[0], line[len(line)-1]
+	}
+	copy(p[w.radius:], line)
+
+	for i := range p {
+		if i%k == 0 {
+			w.prefix[i] = p[i]
+		} else {
+			w.prefix[i] = w.op(w.prefix[i-1], p[i])
+		}
+	}
+	for i := len(p) - 1; i >= 0; i-- {
+		if i%k == k-1 || i == len(p)-1 {
+			w.suffix[i] = p[i]
+		} else {
+			w.suffix[i] = w.op(w.suffix[i+1], p[i])
+		}
+	}
+
+	// The window of line[i] is p[i:i+k]
+	for i := range line {
+		line[i] = w.op(w.suffix[i], w.prefix[i+k-1])
+	}
+}
+
+// parseMorphologyArgs parses the radius of the erode, dilate, open and close
+// filters.
+func parseMorphologyArgs(name string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s filter requires a radius: %s:<radius>", name, name)
+	}
+	radius, err := strconv.Atoi(args[0])
+	if err != nil || radius < 1 {
+		return 0, fmt.Errorf("invalid %s radius: %s (must be positive)", name, args[0])
+	}
+	return radius, nil
+}
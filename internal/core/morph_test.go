@@ -0,0 +1,186 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+var white = Pixel{Blue: 255, Green: 255, Red: 255}
+
+// whiteArea returns the number of white pixels and their inclusive bounding
+// box in visual coordinates.
+func whiteArea(image *BMPImage) (count, minX, minY, maxX, maxY int) {
+	minX, minY, maxX, maxY = math.MaxInt, math.MaxInt, -1, -1
+	for y, row := range image.Rows() {
+		for x, p := range row {
+			if p == white {
+				count++
+				minX, minY, maxX, maxY = min(minX, x), min(minY, y), max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	return count, minX, minY, maxX, maxY
+}
+
+func TestDilateSinglePixel(t *testing.T) {
+	image := NewImage(9, 7)
+	image.Set(4, 3, white)
+	Morphology(image, "dilate", 1)
+
+	count, minX, minY, maxX, maxY := whiteArea(image)
+	if count != 9 || minX != 3 || minY != 2 || maxX != 5 || maxY != 4 {
+		t.Errorf("dilated pixel covers %d pixels in (%d,%d)-(%d,%d), want the 3x3 square (3,2)-(5,4)", count, minX, minY, maxX, maxY)
+	}
+}
+
+func TestOpenRemovesSpeckles(t *testing.T) {
+	image := NewImage(40, 30)
+	image.Set(3, 3, white)
+	image.Set(35, 27, white)
+	for y := 10; y < 22; y++ {
+		for x := 12; x < 30; x++ {
+			image.Set(x, y, white)
+		}
+	}
+
+	for _, radius := range []int{1, 2, 5} {
+		opened := image.Clone()
+		Morphology(opened, "open", radius)
+		count, minX, minY, maxX, maxY := whiteArea(opened)
+		if count != 18*12 || minX != 12 || minY != 10 || maxX != 29 || maxY != 21 {
+			t.Errorf("radius %d: %d white pixels in (%d,%d)-(%d,%d), want the 18x12 block at (12,10) alone", radius, count, minX, minY, maxX, maxY)
+		}
+	}
+}
+
+func TestCloseFillsGaps(t *testing.T) {
+	image := NewImage(20, 20)
+	for _, row := range image.Rows() {
+		for x := range row {
+			row[x] = white
+		}
+	}
+	image.Set(10, 10, Pixel{})
+	Morphology(image, "close", 1)
+	if count, _, _, _, _ := whiteArea(image); count != 400 {
+		t.Errorf("close left %d white pixels, want all 400", count)
+	}
+}
+
+// naiveMorph is the reference for morph: op over the clipped square.
+func naiveMorph(image *BMPImage, radius int, op func(a, b Pixel) Pixel) *BMPImage {
+	out := image.Clone()
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	for y := range height {
+		for x := range width {
+			acc := image.At(x, y)
+			for dy := max(y-radius, 0); dy <= min(y+radius, height-1); dy++ {
+				for dx := max(x-radius, 0); dx <= min(x+radius, width-1); dx++ {
+					acc = op(acc, image.At(dx, dy))
+				}
+			}
+			out.Set(x, y, acc)
+		}
+	}
+	return out
+}
+
+func TestMorphMatchesNaive(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {1, 9}, {9, 1}, {13, 7}, {32, 20}, {35, 18}, {17, 40}}
+	for _, size := range sizes {
+		for _, radius := range []int{1, 2, 4, 25} {
+			for name, op := range map[string]func(a, b Pixel) Pixel{"erode": minPixel, "dilate": maxPixel} {
+				t.Run(fmt.Sprintf("%s_%dx%d_r%d", name, size[0], size[1], radius), func(t *testing.T) {
+					image := noiseImage(size[0], size[1], int64(radius))
+					want := naiveMorph(image, radius, op)
+					Morphology(image, name, radius)
+					if !gridsEqual(image.Data, want.Data) {
+						t.Error("differs from the naive minimum and maximum")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestParseMorphologyArgs(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"erode:1", true},
+		{"dilate:10", true},
+		{"open:3", true},
+		{"close:2", true},
+		{"erode", false},
+		{"dilate:0", false},
+		{"open:x", false},
+		{"close:1:2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, err := parseFilterOptions(tt.value); (err == nil) != tt.ok {
+				t.Errorf("parseFilterOptions(%q) error = %v, want ok %v", tt.value, err, tt.ok)
+			}
+		})
+	}
+}
+
+// naiveMorphColumns is morphColumns reading and writing one column at a time.
+func naiveMorphColumns(image *BMPImage, radius int, op func(a, b Pixel) Pixel) {
+	height := len(image.Data)
+	ForRange(int(image.InfoHeader.Width), 0, func(start, end int) {
+		w := newWindowOp(height, radius, op)
+		column := make([]Pixel, height)
+		for x := start; x < end; x++ {
+			for y, row := range image.Data {
+				column[y] = row[x]
+			}
+			w.apply(column)
+			for y, row := range image.Data {
+				row[x] = column[y]
+			}
+		}
+	})
+}
+
+func TestMorphColumnsMatchesNaive(t *testing.T) {
+	for _, size := range [][2]int{{1, 5}, {15, 3}, {16, 8}, {17, 8}, {50, 33}} {
+		for _, radius := range []int{1, 3, 40} {
+			image := noiseImage(size[0], size[1], int64(radius))
+			want := image.Clone()
+			naiveMorphColumns(want, radius, maxPixel)
+			morphColumns(image, radius, maxPixel)
+			if !gridsEqual(image.Data, want.Data) {
+				t.Errorf("%dx%d radius %d: differs from the column by column pass", size[0], size[1], radius)
+			}
+		}
+	}
+}
+
+// largeImage is the 6000x6000 image the filter pass benchmarks run on.
+var largeImage = sync.OnceValue(func() *BMPImage { return noiseImage(6000, 6000, 1) })
+
+// benchmarkPass measures pass on a copy of largeImage.
+func benchmarkPass(b *testing.B, pass func(image *BMPImage)) {
+	image := largeImage().Clone()
+	b.ResetTimer()
+	for range b.N {
+		pass(image)
+	}
+}
+
+func BenchmarkMorphRows(b *testing.B) {
+	benchmarkPass(b, func(image *BMPImage) { morphRows(image, 5, maxPixel) })
+}
+
+func BenchmarkMorphColumns(b *testing.B) {
+	benchmarkPass(b, func(image *BMPImage) { morphColumns(image, 5, maxPixel) })
+}
+
+func BenchmarkMorphColumnsNaive(b *testing.B) {
+	benchmarkPass(b, func(image *BMPImage) { naiveMorphColumns(image, 5, maxPixel) })
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultMosaicCell is the cell size of the mosaic command without --cell.
+const defaultMosaicCell = 16
+
+// MosaicOptions holds the flags of the mosaic command.
+type MosaicOptions struct {
+	Tiles string // Directory of the tile library
+	Cell  int    // Side of the square cells, in pixels
+}
+
+// ParseMosaicArgs parses the mosaic command arguments: the options, then the
+// target image and the output.
+func ParseMosaicArgs(args []string) (MosaicOptions, []string, error) {
+	opts := MosaicOptions{Cell: defaultMosaicCell}
+
+	var files []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--tiles="):
+			opts.Tiles = strings.TrimPrefix(arg, "--tiles=")
+		case strings.HasPrefix(arg, "--cell="):
+			cell, err := strconv.Atoi(strings.TrimPrefix(arg, "--cell="))
+			if err != nil || cell <= 0 {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid cell option: %s", arg))
+			}
+			opts.Cell = cell
+		case strings.HasPrefix(arg, "--"):
+			return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		default:
+			files = append(files, arg)
+		}
+	}
+
+	if opts.Tiles == "" {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("mosaic needs a tile library, given with --tiles"))
+	}
+	if len(files) != 2 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("mosaic needs a target image and an output"))
+	}
+	return opts, files, nil
+}
+
+// mosaicTile is a tile of a TileLibrary, resized to the cell size.
+type mosaicTile struct {
+	name  string
+	image *BMPImage
+	avg   Pixel
+}
+
+// TileLibrary holds the tiles a mosaic is made of, resized to the cell size
+// and with their average colors computed once for all the cells.
+type TileLibrary struct {
+	cell  int
+	tiles []mosaicTile // Sorted by file name, which breaks ties between equally near tiles
+}
+
+// LoadTileLibrary loads every image in dir as a tile of cell by cell pixels.
+// Hidden files and subdirectories are skipped. A directory without tiles is
+// an error of kind ErrInvalidParameter, and a file that can't be read as an
+// image fails the whole library with an error naming it, rather than leaving
+// the mosaic short of a tile without notice.
+func LoadTileLibrary(dir string, cell int) (*TileLibrary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, ioError(err)
+	}
+
+	lib := &TileLibrary{cell: cell}
+	for _, entry := range entries { // os.ReadDir sorts them by name
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		image, err := LoadImage(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("tile %s: %w", entry.Name(), err)
+		}
+		lib.add(entry.Name(), image)
+	}
+
+	if len(lib.tiles) == 0 {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("no tiles in %s", dir))
+	}
+	return lib, nil
+}
+
+// add resizes image to the cell size and adds it to the library under name.
+// Tiles must be added in name order.
+func (lib *TileLibrary) add(name string, image *BMPImage) {
+	tile := resizeBox(image, lib.cell, lib.cell)
+	lib.tiles = append(lib.tiles, mosaicTile{name: name, image: tile, avg: avgColorBlock(tile, 0, 0, lib.cell)})
+}
+
+// nearest returns the tile whose average color is nearest to c, by squared
+// distance in RGB, the first by name on a tie.
+func (lib *TileLibrary) nearest(c Pixel) *mosaicTile {
+	best, bestDist := 0, -1
+	for i, tile := range lib.tiles {
+		dr := int(tile.avg.Red) - int(c.Red)
+		dg := int(tile.avg.Green) - int(c.Green)
+		db := int(tile.avg.Blue) - int(c.Blue)
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return &lib.tiles[best]
+}
+
+// Mosaic replaces every cell of image by the tile of lib whose average color
+// is nearest to that of the cell. Cells are squares of the library's cell
+// size laid out from the top left corner; those cut by the right and bottom
+// edges get the top left part of their tile. The image is left opaque and at
+// 8 bits per channel.
+func Mosaic(image *BMPImage, lib *TileLibrary) {
+	h, w, cell := len(image.Data), int(image.InfoHeader.Width), lib.cell
+	image.Alpha, image.Wide = nil, nil
+
+	bands := (h + cell - 1) / cell
+	ForRange(bands, 0, func(start, end int) {
+		// Neighbouring cells often share their average color
+		chosen := make(map[Pixel]*mosaicTile)
+		for top := start * cell; top < end*cell && top < h; top += cell {
+			rows := min(cell, h-top)
+			for x0 := 0; x0 < w; x0 += cell {
+				avg := avgColorRect(image, x0, top, cell, rows)
+				tile, ok := chosen[avg]
+				if !ok {
+					tile = lib.nearest(avg)
+					chosen[avg] = tile
+				}
+				for y := range rows {
+					src := tile.image.Data[y]
+					copy(image.Data[top+y][x0:min(x0+cell, w)], src)
+				}
+			}
+		}
+	})
+}
+
+// resizeBox returns image resized to width by height pixels with a box
+// filter: every output pixel is the average of the source pixels its area
+// covers, or the one source pixel it falls in when enlarging. The result is a
+// new 24-bit bottom-up image.
+func resizeBox(image *BMPImage, width, height int) *BMPImage {
+	sw, sh := int(image.InfoHeader.Width), len(image.Data)
+	out := NewImage(width, height)
+	for y, row := range out.Rows() {
+		y0 := y * sh / height
+		y1 := max((y+1)*sh/height, y0+1)
+		for x := range row {
+			x0 := x * sw / width
+			x1 := max((x+1)*sw/width, x0+1)
+
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				src := image.Data[sy]
+				for _, p := range src[x0:x1] {
+					r, g, b, n = r+int(p.Red), g+int(p.Green), b+int(p.Blue), n+1
+				}
+			}
+			row[x] = Pixel{Red: byte(divRound(r, n)), Green: byte(divRound(g, n)), Blue: byte(divRound(b, n))}
+		}
+	}
+	return out
+}
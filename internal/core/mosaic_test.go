@@ -0,0 +1,198 @@
+package core
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// solidImage returns a width by height image filled with c.
+func solidImage(width, height int, c Pixel) *BMPImage {
+	image := NewImage(width, height)
+	for _, row := range image.Data {
+		for x := range row {
+			row[x] = c
+		}
+	}
+	return image
+}
+
+// tileDir writes the given tiles to a new directory, in the reverse order of
+// their names so that nothing depends on the order files were created in.
+func tileDir(t *testing.T, tiles map[string]*BMPImage) string {
+	t.Helper()
+	dir := t.TempDir()
+	names := slices.Sorted(maps.Keys(tiles))
+	slices.Reverse(names)
+	for _, name := range names {
+		if err := Save(tiles[name], filepath.Join(dir, name), SaveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMosaicPicksNearestTile(t *testing.T) {
+	var (
+		black = Pixel{}
+		white = Pixel{Red: 255, Green: 255, Blue: 255}
+		red   = Pixel{Red: 255}
+		blue  = Pixel{Blue: 255}
+	)
+	dir := tileDir(t, map[string]*BMPImage{
+		"black.bmp": solidImage(3, 3, black),
+		"white.bmp": solidImage(7, 5, white),
+		"red.bmp":   solidImage(4, 4, red),
+		"blue.bmp":  solidImage(1, 1, blue),
+		"a.bmp":     solidImage(2, 2, Pixel{Red: 100}),
+		"b.bmp":     solidImage(2, 2, Pixel{Green: 100}),
+	})
+	lib, err := LoadTileLibrary(dir, 4)
+	if err != nil {
+		t.Fatalf("LoadTileLibrary: %v", err)
+	}
+
+	// Visual cells of the target, 4x4 pixels, the last column cut to 2 pixels
+	cells := [][]struct{ in, want Pixel }{
+		{{Pixel{Red: 10, Green: 10, Blue: 10}, black}, {Pixel{Red: 240, Green: 250, Blue: 230}, white}, {Pixel{Red: 200, Green: 30, Blue: 20}, red}},
+		{{Pixel{Red: 20, Green: 10, Blue: 210}, blue}, {Pixel{Red: 50, Green: 50}, Pixel{Red: 100}}, {Pixel{Red: 230, Green: 240, Blue: 255}, white}},
+	}
+	target := func(height int) *BMPImage {
+		image := NewImage(10, 8)
+		image.InfoHeader.Height = int32(height)
+		for y := range 8 {
+			for x := range 10 {
+				image.Set(x, y, cells[y/4][x/4].in)
+			}
+		}
+		return image
+	}
+
+	for _, tt := range []struct {
+		name  string
+		image *BMPImage
+	}{
+		{"bottom-up", target(8)},
+		{"top-down", target(-8)},
+		{"transparent", withAlpha(target(8))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			Mosaic(tt.image, lib)
+			if tt.image.Alpha != nil {
+				t.Error("the mosaic kept the alpha plane")
+			}
+			for y := range 8 {
+				for x := range 10 {
+					if got, want := tt.image.At(x, y), cells[y/4][x/4].want; got != want {
+						t.Fatalf("(%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMosaicKeepsTileOrientation(t *testing.T) {
+	// A tile red on top and blue at the bottom
+	tile := topDown(NewImage(2, 2))
+	tile.Set(0, 0, Pixel{Red: 255})
+	tile.Set(1, 0, Pixel{Red: 255})
+	tile.Set(0, 1, Pixel{Blue: 255})
+	tile.Set(1, 1, Pixel{Blue: 255})
+	lib, err := LoadTileLibrary(tileDir(t, map[string]*BMPImage{"split.bmp": tile}), 2)
+	if err != nil {
+		t.Fatalf("LoadTileLibrary: %v", err)
+	}
+
+	// 3 rows: a full cell, then one cut to its top row
+	for _, image := range []*BMPImage{noiseImage(2, 3, 1), topDown(noiseImage(2, 3, 2))} {
+		Mosaic(image, lib)
+		for y, want := range []Pixel{{Red: 255}, {Blue: 255}, {Red: 255}} {
+			if got := image.At(0, y); got != want {
+				t.Errorf("height %d: row %d = %v, want %v", image.InfoHeader.Height, y, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadTileLibraryErrors(t *testing.T) {
+	empty := t.TempDir()
+	if err := os.Mkdir(filepath.Join(empty, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(empty, ".hidden"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := tileDir(t, map[string]*BMPImage{"good.bmp": solidImage(2, 2, Pixel{})})
+	if err := os.WriteFile(filepath.Join(broken, "notes.txt"), []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		kind    error
+		message string
+	}{
+		{"missing directory", filepath.Join(empty, "missing"), ErrIO, "missing"},
+		{"no tiles", empty, ErrInvalidParameter, "no tiles"},
+		{"unreadable tile", broken, ErrUnsupported, "tile notes.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTileLibrary(tt.dir, 4)
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("error = %v, want kind %v", err, tt.kind)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("error %q doesn't mention %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestResizeBox(t *testing.T) {
+	image := NewImage(4, 2)
+	flipped := topDown(NewImage(4, 2))
+	for x, v := range []byte{0, 100, 200, 255} {
+		image.Set(x, 0, Pixel{Red: v})
+		image.Set(x, 1, Pixel{Red: v, Blue: 100})
+		flipped.Set(x, 0, Pixel{Red: v})
+		flipped.Set(x, 1, Pixel{Red: v, Blue: 100})
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+		want          [][]Pixel
+	}{
+		{"shrink", 2, 1, [][]Pixel{{{Red: 50, Blue: 50}, {Red: 228, Blue: 50}}}},
+		{"same size", 4, 2, [][]Pixel{
+			{{Red: 0}, {Red: 100}, {Red: 200}, {Red: 255}},
+			{{Red: 0, Blue: 100}, {Red: 100, Blue: 100}, {Red: 200, Blue: 100}, {Red: 255, Blue: 100}},
+		}},
+		{"enlarge", 8, 1, [][]Pixel{{
+			{Red: 0, Blue: 50}, {Red: 0, Blue: 50}, {Red: 100, Blue: 50}, {Red: 100, Blue: 50},
+			{Red: 200, Blue: 50}, {Red: 200, Blue: 50}, {Red: 255, Blue: 50}, {Red: 255, Blue: 50},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, src := range []*BMPImage{image, flipped} {
+				got := resizeBox(src, tt.width, tt.height)
+				for y, row := range tt.want {
+					for x, want := range row {
+						if p := got.At(x, y); p != want {
+							t.Fatalf("(%d, %d) = %v, want %v", x, y, p, want)
+						}
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// MorphStep is one of morphologyFilters with its radius.
+type MorphStep struct {
+	Name   string
+	Radius int
+}
+
+// MotionOptions holds the flags of the motion command.
+type MotionOptions struct {
+	Threshold int         // Pixels whose luminance changed by at least Threshold are motion
+	Morph     []MorphStep // Morphology applied to the mask in order, to remove speckle
+	MinChange float64     // Percentage of changed pixels from which the frames count as moving
+}
+
+// ParseMotionArgs parses the motion command arguments: the options, then the
+// previous frame, the current frame and the output mask.
+func ParseMotionArgs(args []string) (MotionOptions, []string, error) {
+	opts := MotionOptions{Threshold: 25, MinChange: 1}
+
+	var files []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--threshold="):
+			t, err := strconv.Atoi(strings.TrimPrefix(arg, "--threshold="))
+			if err != nil || t < 1 || t > 255 {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid threshold option: %s (must be between 1 and 255)", arg))
+			}
+			opts.Threshold = t
+		case strings.HasPrefix(arg, "--morph="):
+			name, radius, _ := strings.Cut(strings.TrimPrefix(arg, "--morph="), ":")
+			if !slices.Contains(morphologyFilters, name) {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid morph option: %s (must be one of %s)", arg, strings.Join(morphologyFilters, ", ")))
+			}
+			r, err := parseMorphologyArgs(name, []string{radius})
+			if err != nil {
+				return opts, nil, withKind(ErrInvalidParameter, err)
+			}
+			opts.Morph = append(opts.Morph, MorphStep{Name: name, Radius: r})
+		case strings.HasPrefix(arg, "--min-change="):
+			value := strings.TrimSuffix(strings.TrimPrefix(arg, "--min-change="), "%")
+			change, err := strconv.ParseFloat(value, 64)
+			if err != nil || change < 0 || change > 100 {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid min-change option: %s (must be a percentage between 0 and 100)", arg))
+			}
+			opts.MinChange = change
+		case strings.HasPrefix(arg, "--"):
+			return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		default:
+			files = append(files, arg)
+		}
+	}
+
+	if len(files) != 3 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("motion needs the previous frame, the current frame and an output"))
+	}
+	return opts, files, nil
+}
+
+// MotionMask compares the luminance of two frames and returns a mask that is
+// white where it changed by at least opts.Threshold and black elsewhere,
+// after the morphology of opts.Morph, along with the percentage of white
+// pixels in it. Frames of different dimensions return ErrDimensionMismatch.
+func MotionMask(prev, curr *BMPImage, opts MotionOptions) (*BMPImage, float64, error) {
+	pw, ph := int(prev.InfoHeader.Width), utils.Abs(int(prev.InfoHeader.Height))
+	cw, ch := int(curr.InfoHeader.Width), utils.Abs(int(curr.InfoHeader.Height))
+	if pw != cw || ph != ch {
+		return nil, 0, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, pw, ph, cw, ch)
+	}
+
+	white := Pixel{Blue: 255, Green: 255, Red: 255}
+	mask := NewImage(pw, ph)
+	for y, row := range mask.Rows() {
+		a, b := prev.Data[y], curr.Data[y]
+		for x := range row {
+			if utils.Abs(int(luminance(a[x]))-int(luminance(b[x]))) >= opts.Threshold {
+				row[x] = white
+			}
+		}
+	}
+	for _, step := range opts.Morph {
+		Morphology(mask, step.Name, step.Radius)
+	}
+
+	changed := 0
+	for _, row := range mask.Data {
+		for _, p := range row {
+			if p == white {
+				changed++
+			}
+		}
+	}
+	return mask, float64(changed) * 100 / float64(pw*ph), nil
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMotionMaskFindsChangedRectangle(t *testing.T) {
+	// The current frame is brighter in a 6x4 rectangle at (5, 3), with two
+	// specks of changed pixels elsewhere
+	prev := solidImage(20, 12, Pixel{Red: 50, Green: 50, Blue: 50})
+	curr := prev.Clone()
+	for y := 3; y < 7; y++ {
+		for x := 5; x < 11; x++ {
+			curr.Data[y][x] = Pixel{Red: 200, Green: 200, Blue: 200}
+		}
+	}
+	curr.Data[0][0] = Pixel{Red: 200, Green: 200, Blue: 200}
+	curr.Data[10][17] = Pixel{Red: 200, Green: 200, Blue: 200}
+
+	opts := MotionOptions{Threshold: 25, Morph: []MorphStep{{Name: "open", Radius: 1}}}
+	mask, changed, err := MotionMask(prev, curr, opts)
+	if err != nil {
+		t.Fatalf("MotionMask: %v", err)
+	}
+	for y := range 12 {
+		for x := range 20 {
+			inside := x >= 5 && x < 11 && y >= 3 && y < 7
+			if white := mask.At(x, y) == (Pixel{Red: 255, Green: 255, Blue: 255}); white != inside {
+				t.Errorf("mask at (%d,%d) white = %v, want %v", x, y, white, inside)
+			}
+		}
+	}
+	if want := 24.0 * 100 / 240; math.Abs(changed-want) > 1e-9 {
+		t.Errorf("changed %.4f%%, want %.4f%%", changed, want)
+	}
+
+	// Without the morphology the specks count too
+	_, changed, _ = MotionMask(prev, curr, MotionOptions{Threshold: 25})
+	if want := 26.0 * 100 / 240; math.Abs(changed-want) > 1e-9 {
+		t.Errorf("changed without morphology %.4f%%, want %.4f%%", changed, want)
+	}
+
+	// Changes under the threshold are not motion
+	_, changed, _ = MotionMask(prev, curr, MotionOptions{Threshold: 151})
+	if changed != 0 {
+		t.Errorf("changed %.4f%% with a threshold above the difference, want 0", changed)
+	}
+}
+
+func TestMotionMaskDimensionMismatch(t *testing.T) {
+	_, _, err := MotionMask(NewImage(4, 4), NewImage(4, 5), MotionOptions{Threshold: 25})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("error %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestParseMotionArgs(t *testing.T) {
+	opts, files, err := ParseMotionArgs([]string{"--threshold=40", "--morph=open:1", "--morph=dilate:2", "--min-change=0.5%", "a.bmp", "b.bmp", "m.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Threshold != 40 || opts.MinChange != 0.5 || len(opts.Morph) != 2 || opts.Morph[1] != (MorphStep{"dilate", 2}) || len(files) != 3 {
+		t.Errorf("parsed %+v %v", opts, files)
+	}
+
+	for _, args := range [][]string{
+		{"--threshold=0", "a", "b", "c"},
+		{"--morph=blur:2", "a", "b", "c"},
+		{"--morph=open", "a", "b", "c"},
+		{"--min-change=101%", "a", "b", "c"},
+		{"a", "b"},
+	} {
+		if _, _, err := ParseMotionArgs(args); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("ParseMotionArgs(%q) error %v, want ErrInvalidParameter", args, err)
+		}
+	}
+}
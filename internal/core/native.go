@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// nativeMagic starts every native frame. Like the PNG signature, its first
+// byte is not ASCII and it holds a line ending and an EOF character, so a
+// frame mangled by a text-mode transfer is recognized as such.
+const nativeMagic = "\x89BMN\r\n\x1a\n"
+
+// Flags of a native frame.
+const (
+	nativeTopDown = 1 << iota // Rows are stored from the visual top down
+	nativeAlpha               // An alpha plane follows the pixel rows
+	nativeWide                // A plane of 16-bit pixels follows
+)
+
+// nativeHeaderSize is the size of the magic, the width and height as 32-bit
+// little endian integers and the flags byte.
+const nativeHeaderSize = len(nativeMagic) + 4 + 4 + 1
+
+// nativeSize returns the size of the native frame of image. Only the planes
+// image has count, so a header-only image is sized as opaque and 8-bit.
+func nativeSize(image *BMPImage) int64 {
+	pixels := int64(image.InfoHeader.Width) * int64(utils.Abs(int(image.InfoHeader.Height)))
+	size := int64(nativeHeaderSize) + pixels*3
+	if image.Alpha != nil {
+		size += pixels
+	}
+	if image.Wide != nil {
+		size += pixels * widePixelSize
+	}
+	return size
+}
+
+// EncodeNative writes image to w as a native frame, the format for piping
+// an image from one bitmap process to the next: a short header with the
+// dimensions and flags, then the rows in the order of the file, 3 bytes
+// per pixel in BGR order with no padding, then the rows of Alpha and of Wide
+// if the image has them, the latter as 16-bit little endian BGR. Unlike BMP,
+// it keeps the alpha plane and the 16-bit precision of a widened image, so
+// passing an image through a pipe loses nothing, and reading it back needs
+// no header reconstruction or validation beyond the sizes.
+func EncodeNative(w io.Writer, image *BMPImage) error {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, nativeHeaderSize)
+	copy(header, nativeMagic)
+	binary.LittleEndian.PutUint32(header[len(nativeMagic):], uint32(image.InfoHeader.Width))
+	binary.LittleEndian.PutUint32(header[len(nativeMagic)+4:], uint32(len(image.Data)))
+	var flags byte
+	if image.InfoHeader.Height < 0 {
+		flags |= nativeTopDown
+	}
+	if image.Alpha != nil {
+		flags |= nativeAlpha
+	}
+	if image.Wide != nil {
+		flags |= nativeWide
+	}
+	header[nativeHeaderSize-1] = flags
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	width := int(image.InfoHeader.Width)
+	buf := make([]byte, width*widePixelSize)
+	for i := range image.Data {
+		for x, p := range image.Data[image.fileRow(i)] {
+			buf[3*x], buf[3*x+1], buf[3*x+2] = p.Blue, p.Green, p.Red
+		}
+		if _, err := bw.Write(buf[:3*width]); err != nil {
+			return err
+		}
+	}
+	for i := range image.Alpha {
+		if _, err := bw.Write(image.Alpha[image.fileRow(i)]); err != nil {
+			return err
+		}
+	}
+	for i := range image.Wide {
+		for x, p := range image.Wide[image.fileRow(i)] {
+			binary.LittleEndian.PutUint16(buf[6*x:], p.Blue)
+			binary.LittleEndian.PutUint16(buf[6*x+2:], p.Green)
+			binary.LittleEndian.PutUint16(buf[6*x+4:], p.Red)
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readNativeHeader reads the header of a native frame and returns the
+// dimensions and flags it holds.
+func readNativeHeader(r io.Reader) (width, height int, flags byte, err error) {
+	header := make([]byte, nativeHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: native frame header: %v", ErrTruncatedData, err)
+	}
+	if !bytes.HasPrefix(header, []byte(nativeMagic)) {
+		return 0, 0, 0, ErrInvalidFileType
+	}
+	w := binary.LittleEndian.Uint32(header[len(nativeMagic):])
+	h := binary.LittleEndian.Uint32(header[len(nativeMagic)+4:])
+	flags = header[nativeHeaderSize-1]
+	if w == 0 || h == 0 || w > 1<<31-1 || h > 1<<31-1 {
+		return 0, 0, 0, ErrNonPositiveDimensions
+	}
+	if flags&^(nativeTopDown|nativeAlpha|nativeWide) != 0 {
+		return 0, 0, 0, withKind(ErrUnsupported, fmt.Errorf("native frame has unknown flags 0x%02x", flags))
+	}
+	return int(w), int(h), flags, nil
+}
+
+// decodeNative decodes a native frame as written by EncodeNative. The frame
+// must be exactly as long as its header says; one that ends early is an
+// error wrapping ErrTruncatedData, and one over maxPixels, unless it is 0,
+// an error wrapping ErrPixelLimit.
+func decodeNative(data []byte, maxPixels int64) (*BMPImage, error) {
+	width, height, flags, err := readNativeHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPixels(width, height, maxPixels); err != nil {
+		return nil, err
+	}
+
+	image := NewImage(width, height)
+	if flags&nativeTopDown != 0 {
+		image.InfoHeader.Height = -image.InfoHeader.Height
+	}
+	if flags&nativeAlpha != 0 {
+		image.Alpha = make([][]byte, 0)
+	}
+	if flags&nativeWide != 0 {
+		image.Wide = make([][]Pixel16, 0)
+	}
+	if want := nativeSize(image); int64(len(data)) != want {
+		if int64(len(data)) < want {
+			return nil, fmt.Errorf("%w: native frame of %d bytes, want %d", ErrTruncatedData, len(data), want)
+		}
+		return nil, withKind(ErrUnsupported, fmt.Errorf("native frame of %d bytes, want %d", len(data), want))
+	}
+
+	pixels := data[nativeHeaderSize:]
+	for i := range image.Data {
+		row := image.Data[image.fileRow(i)]
+		for x := range row {
+			row[x] = Pixel{Blue: pixels[3*x], Green: pixels[3*x+1], Red: pixels[3*x+2]}
+		}
+		pixels = pixels[3*width:]
+	}
+	if image.Alpha != nil {
+		image.Alpha = make([][]byte, height)
+		for i := range image.Alpha {
+			image.Alpha[image.fileRow(i)] = append([]byte(nil), pixels[:width]...)
+			pixels = pixels[width:]
+		}
+	}
+	if image.Wide != nil {
+		image.Wide = make([][]Pixel16, height)
+		for i := range image.Wide {
+			row := make([]Pixel16, width)
+			for x := range row {
+				row[x] = Pixel16{
+					Blue:  binary.LittleEndian.Uint16(pixels[6*x:]),
+					Green: binary.LittleEndian.Uint16(pixels[6*x+2:]),
+					Red:   binary.LittleEndian.Uint16(pixels[6*x+4:]),
+				}
+			}
+			image.Wide[image.fileRow(i)] = row
+			pixels = pixels[widePixelSize*width:]
+		}
+	}
+	return image, nil
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNativeRoundTrip(t *testing.T) {
+	wide := func(image *BMPImage) *BMPImage {
+		image.Widen()
+		// Values an 8-bit round trip would lose
+		for _, row := range image.Wide {
+			for x := range row {
+				row[x].Red |= 0x0101
+				row[x].Blue ^= 0x00ff
+			}
+		}
+		return image
+	}
+
+	tests := []struct {
+		name  string
+		image *BMPImage
+	}{
+		{"bottom-up", noiseImage(7, 5, 1)},
+		{"top-down", topDown(noiseImage(7, 5, 2))},
+		{"1x1", noiseImage(1, 1, 3)},
+		{"transparent", withAlpha(noiseImage(6, 4, 4))},
+		{"wide", wide(noiseImage(6, 4, 5))},
+		{"wide transparent top-down", topDown(wide(withAlpha(noiseImage(3, 8, 6))))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.image, SaveOptions{Format: FormatNative}); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if format, err := DetectFormat(buf.Bytes()); err != nil || format != InputNative {
+				t.Fatalf("DetectFormat = %q, %v, want %q", format, err, InputNative)
+			}
+			got, err := DecodeImage(buf.Bytes())
+			if err != nil {
+				t.Fatalf("DecodeImage: %v", err)
+			}
+
+			if got.InfoHeader.Width != tt.image.InfoHeader.Width || got.InfoHeader.Height != tt.image.InfoHeader.Height {
+				t.Errorf("size %dx%d, want %dx%d", got.InfoHeader.Width, got.InfoHeader.Height, tt.image.InfoHeader.Width, tt.image.InfoHeader.Height)
+			}
+			if !gridsEqual(got.Data, tt.image.Data) {
+				t.Error("pixels differ")
+			}
+			if (got.Alpha == nil) != (tt.image.Alpha == nil) || !gridsEqual(got.Alpha, tt.image.Alpha) {
+				t.Error("alpha differs")
+			}
+			if (got.Wide == nil) != (tt.image.Wide == nil) || !gridsEqual(got.Wide, tt.image.Wide) {
+				t.Error("16-bit pixels differ")
+			}
+		})
+	}
+}
+
+func TestDecodeNativeRejectsBadFrames(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeNative(&buf, withAlpha(noiseImage(4, 3, 1))); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	withFlags := func(flags byte) []byte {
+		b := bytes.Clone(frame)
+		b[nativeHeaderSize-1] = flags
+		return b
+	}
+	zeroWidth := bytes.Clone(frame)
+	copy(zeroWidth[len(nativeMagic):], []byte{0, 0, 0, 0})
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"header only", frame[:nativeHeaderSize-3], ErrTruncatedData},
+		{"pixels cut short", frame[:len(frame)-1], ErrTruncatedData},
+		{"alpha flag without alpha", withFlags(nativeAlpha | nativeWide), ErrTruncatedData},
+		{"trailing bytes", append(bytes.Clone(frame), 0), ErrUnsupported},
+		{"alpha missing from flags", withFlags(0), ErrUnsupported},
+		{"unknown flag", withFlags(0x80), ErrUnsupported},
+		{"zero width", zeroWidth, ErrNonPositiveDimensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeImage(tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("DecodeImage error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFormatPipeFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		opts SaveOptions
+		want string
+	}{
+		{"-", SaveOptions{}, FormatBMP24},
+		{"-", SaveOptions{PipeFormat: FormatNative}, FormatNative},
+		{"-", SaveOptions{Format: FormatPNG, PipeFormat: FormatNative}, FormatPNG},
+		{"out.bmp", SaveOptions{PipeFormat: FormatNative}, FormatBMP24},
+	}
+
+	for _, tt := range tests {
+		if got := OutputFormat(tt.path, tt.opts); got != tt.want {
+			t.Errorf("OutputFormat(%q, %+v) = %q, want %q", tt.path, tt.opts, got, tt.want)
+		}
+	}
+}
+
+// benchmarkDecode measures decoding a 2048x2048 image saved with opts.
+func benchmarkDecode(b *testing.B, opts SaveOptions) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, noiseImage(2048, 2048, 1), opts); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for range b.N {
+		if _, err := DecodeImage(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeNative(b *testing.B) { benchmarkDecode(b, SaveOptions{Format: FormatNative}) }
+
+func BenchmarkDecodeBMP(b *testing.B) { benchmarkDecode(b, SaveOptions{Format: FormatBMP24}) }
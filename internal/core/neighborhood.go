@@ -0,0 +1,70 @@
+package core
+
+import "fmt"
+
+// EdgeMode selects what neighborhood filters read for neighbors that fall
+// outside the image.
+type EdgeMode int
+
+const (
+	// EdgeShrink treats neighbors outside the image as absent, so the
+	// neighborhood near the edges is smaller.
+	EdgeShrink EdgeMode = iota
+	// EdgeClamp repeats the pixel at the edge.
+	EdgeClamp
+	// EdgeMirror reflects the image at the edge, repeating the edge pixel:
+	// the neighbor one past the edge is the edge pixel itself.
+	EdgeMirror
+	// EdgeWrap tiles the image, so neighbors past one edge come from the other.
+	EdgeWrap
+)
+
+var edgeModeNames = map[string]EdgeMode{
+	"shrink": EdgeShrink,
+	"clamp":  EdgeClamp,
+	"mirror": EdgeMirror,
+	"wrap":   EdgeWrap,
+}
+
+func (m EdgeMode) String() string {
+	for name, mode := range edgeModeNames {
+		if mode == m {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// parseEdgeMode parses the name of an edge mode.
+func parseEdgeMode(name string) (EdgeMode, error) {
+	mode, ok := edgeModeNames[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid edge mode: %s (must be shrink, clamp, mirror or wrap)", name)
+	}
+	return mode, nil
+}
+
+// index maps the coordinate i of a neighbor along a dimension of size n to
+// the coordinate of the pixel read for it. Coordinates inside [0, n) map to
+// themselves. For EdgeShrink the neighbor is absent outside the image and ok
+// is false. Neighborhoods may be larger than the image, so mirror and wrap
+// repeat for as long as needed.
+func (m EdgeMode) index(i, n int) (j int, ok bool) {
+	if i >= 0 && i < n {
+		return i, true
+	}
+
+	switch m {
+	case EdgeClamp:
+		return min(max(i, 0), n-1), true
+	case EdgeMirror:
+		i = ((i % (2 * n)) + 2*n) % (2 * n)
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+		return i, true
+	case EdgeWrap:
+		return ((i % n) + n) % n, true
+	}
+	return 0, false
+}
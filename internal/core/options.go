@@ -0,0 +1,201 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSalvageFill is the color --salvage fills missing rows with: magenta,
+// so the missing region stands out.
+var defaultSalvageFill = Pixel{Red: 255, Blue: 255}
+
+// ApplyOptions holds the apply flags that control how the pipeline is run,
+// as opposed to the transformations that make up the pipeline itself.
+type ApplyOptions struct {
+	TileRows    int   // Band height for the streaming blur; 0 disables tiled mode
+	DryRun      bool  // Validate and print the pipeline without writing any output
+	MaxMemory   int64 // Refuse to run pipelines estimated to need more bytes; 0 means no limit
+	PrintSize   bool  // Print the exact output file size before writing it
+	Precision   int   // Bits per channel the filters work at: 8, or 16 to quantize only when saving
+	Jobs        int   // Number of goroutines parallel filters use; 0 keeps the default of one per CPU
+	Manifest    bool  // Write a JSON manifest of the run next to the output
+	Stamp       bool  // Stamp BMP output with the hash of the manifest of the run
+	AllowHuge   bool  // Lift the limit of DefaultMaxPixels on the input and output dimensions
+	MaxPixels   int64 // Refuse images over this many pixels, read or produced; 0 means no limit
+	Salvage     bool  // Decode truncated BMP input, filling the missing rows with SalvageFill
+	SalvageFill Pixel
+	Mmap        bool          // Memory-map the input whatever its size, instead of only above MmapThreshold
+	Invariants  bool          // Check the row order of the BMP codec on the input before processing it
+	Timeout     time.Duration // Abort the run once it has taken this long; 0 means no limit
+	Verbose     bool          // Print the warnings of the input decoder and how long each transformation took
+	Progress    bool          // Draw the progress of the run on standard error
+	Save        SaveOptions
+}
+
+// ParseApplyOptions extracts the pipeline flags from the apply arguments.
+// It returns the parsed options and the remaining arguments, which are left
+// in order for ParseTransformations.
+func ParseApplyOptions(args []string) (ApplyOptions, []string, error) {
+	opts := ApplyOptions{Precision: 8}
+	var rest []string
+
+	for _, arg := range args {
+		switch {
+		// Handle tiled mode, optionally with an explicit band height.
+		case arg == "--tiled":
+			opts.TileRows = DefaultTileRows
+		case strings.HasPrefix(arg, "--tiled="):
+			rows, err := strconv.Atoi(strings.TrimPrefix(arg, "--tiled="))
+			if err != nil || rows <= 0 {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid tiled option: %s", arg))
+			}
+			opts.TileRows = rows
+		case arg == "--dry-run":
+			opts.DryRun = true
+		case arg == "--salvage":
+			opts.Salvage, opts.SalvageFill = true, defaultSalvageFill
+		case strings.HasPrefix(arg, "--salvage="):
+			fill, err := ParseColor(strings.TrimPrefix(arg, "--salvage="))
+			if err != nil {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid salvage option: %w", err))
+			}
+			opts.Salvage, opts.SalvageFill = true, fill
+		case arg == "--write-manifest":
+			opts.Manifest = true
+		case arg == "--stamp":
+			opts.Stamp = true
+		case strings.HasPrefix(arg, "--comment="):
+			text := strings.TrimPrefix(arg, "--comment=")
+			if err := checkComment(text); err != nil {
+				return opts, nil, err
+			}
+			opts.Save.Comments = append(opts.Save.Comments, text)
+		case arg == "--print-size":
+			opts.PrintSize = true
+		case arg == "--allow-huge":
+			opts.AllowHuge = true
+		case arg == "--mmap":
+			opts.Mmap = true
+		case arg == "--check-invariants":
+			opts.Invariants = true
+		case arg == "--verbose":
+			opts.Verbose = true
+		case arg == "--progress":
+			opts.Progress = true
+		case strings.HasPrefix(arg, "--timeout="):
+			timeout, err := time.ParseDuration(strings.TrimPrefix(arg, "--timeout="))
+			if err != nil || timeout <= 0 {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid timeout option: %s (must be a positive duration such as 30s)", arg))
+			}
+			opts.Timeout = timeout
+		case strings.HasPrefix(arg, "--max-memory="):
+			limit, err := ParseByteSize(strings.TrimPrefix(arg, "--max-memory="))
+			if err != nil {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid max-memory option: %w", err))
+			}
+			opts.MaxMemory = limit
+		case strings.HasPrefix(arg, "--precision="):
+			switch value := strings.TrimPrefix(arg, "--precision="); value {
+			case "8":
+				opts.Precision = 8
+			case "16":
+				opts.Precision = 16
+			default:
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid precision option: %s (must be 8 or 16)", value))
+			}
+		case strings.HasPrefix(arg, "--jobs="):
+			jobs, err := strconv.Atoi(strings.TrimPrefix(arg, "--jobs="))
+			if err != nil || jobs <= 0 {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid jobs option: %s", arg))
+			}
+			opts.Jobs = jobs
+		case arg == "--background=checker":
+			opts.Save.Background, opts.Save.Checker = Pixel{}, true
+		case strings.HasPrefix(arg, "--background="):
+			color, err := ParseColor(strings.TrimPrefix(arg, "--background="))
+			if err != nil {
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid background option: %w", err))
+			}
+			opts.Save.Background, opts.Save.Checker = color, false
+		case strings.HasPrefix(arg, "--format="):
+			format, err := parseFormat(strings.TrimPrefix(arg, "--format="))
+			if err != nil {
+				return opts, nil, withKind(ErrInvalidParameter, err)
+			}
+			opts.Save.Format = format
+		case strings.HasPrefix(arg, "--pipe-format="):
+			switch value := strings.TrimPrefix(arg, "--pipe-format="); value {
+			case FormatNative:
+				opts.Save.PipeFormat = value
+			case "bmp":
+				opts.Save.PipeFormat = ""
+			default:
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid pipe-format option: %s (must be native or bmp)", value))
+			}
+		case strings.HasPrefix(arg, "--align="):
+			switch value := strings.TrimPrefix(arg, "--align="); value {
+			case "4", "8", "16":
+				opts.Save.Align, _ = strconv.Atoi(value)
+			default:
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid align option: %s (must be 4, 8 or 16)", value))
+			}
+		case strings.HasPrefix(arg, "--color-profile="):
+			profile, err := parseColorProfile(strings.TrimPrefix(arg, "--color-profile="))
+			if err != nil {
+				return opts, nil, err
+			}
+			opts.Save.ColorProfile = profile
+		case arg == "--canonical":
+			opts.Save.Canonical = true
+		case strings.HasPrefix(arg, "--channels="):
+			channels, err := parseChannels(strings.TrimPrefix(arg, "--channels="))
+			if err != nil {
+				return opts, nil, withKind(ErrInvalidParameter, err)
+			}
+			opts.Save.Channels = channels
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	if opts.TileRows > 0 && opts.Save.Format != "" && opts.Save.Format != FormatBMP24 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode only writes %s output", FormatBMP24))
+	}
+	if opts.Stamp && opts.Save.Format != "" && !isBMP(opts.Save.Format) {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("--stamp only applies to BMP output"))
+	}
+	if opts.TileRows > 0 && opts.Stamp {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode doesn't support --stamp"))
+	}
+	if len(opts.Save.Comments) > 0 && (opts.Save.Format != "" && !isBMP(opts.Save.Format) || opts.Save.PipeFormat != "") {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("--comment only applies to BMP output"))
+	}
+	if opts.TileRows > 0 && len(opts.Save.Comments) > 0 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode doesn't support --comment"))
+	}
+	if opts.TileRows > 0 && opts.Save.PipeFormat != "" {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode only writes %s output", FormatBMP24))
+	}
+	if opts.TileRows > 0 && opts.Save.Align > 4 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode only writes rows aligned to 4 bytes"))
+	}
+	if opts.Save.colorProfile() != ColorProfileKeep && opts.Save.Format != "" && opts.Save.Format != FormatBMP24 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("--color-profile only applies to %s output", FormatBMP24))
+	}
+	if opts.TileRows > 0 && opts.Save.colorProfile() != ColorProfileKeep {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode only keeps the color profile of the input"))
+	}
+	if opts.Save.Canonical && (opts.Save.Format != "" && opts.Save.Format != FormatBMP24 || opts.Save.PipeFormat != "" || opts.Save.Align > 4 || opts.Save.colorProfile() != ColorProfileKeep || opts.Stamp || len(opts.Save.Comments) > 0) {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("--canonical only applies to plain %s output", FormatBMP24))
+	}
+	if opts.TileRows > 0 && opts.Save.Canonical {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode doesn't support --canonical"))
+	}
+	if opts.TileRows > 0 && opts.Precision != 8 {
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("tiled mode only works at 8-bit precision"))
+	}
+
+	return opts, rest, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseApplyOptionsTimeout(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"--timeout=30s", 30 * time.Second, false},
+		{"--timeout=1m30s", 90 * time.Second, false},
+		{"--timeout=50ms", 50 * time.Millisecond, false},
+		{"--timeout=0", 0, true},
+		{"--timeout=0s", 0, true},
+		{"--timeout=-5s", 0, true},
+		{"--timeout=30", 0, true},
+		{"--timeout=", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			opts, _, err := ParseApplyOptions([]string{tt.arg, "in.bmp", "out.bmp"})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidParameter) {
+					t.Fatalf("error = %v, want an ErrInvalidParameter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Timeout != tt.want {
+				t.Errorf("Timeout = %v, want %v", opts.Timeout, tt.want)
+			}
+		})
+	}
+}
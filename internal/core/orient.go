@@ -0,0 +1,167 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// orientGrid is the size of the grid images are downscaled to before their
+// orientations are compared.
+const orientGrid = 64
+
+// orientTieMargin is how close, in mean channel levels, the two best
+// orientations must be for the choice to be reported as a tie.
+const orientTieMargin = 1.0
+
+// Orientations tried by FindOrientation, in the order ties are resolved.
+var Orientations = []string{"none", "horizontal", "vertical", "both"}
+
+// OrientOptions holds the flags of the orient command.
+type OrientOptions struct {
+	Reference string  // Path of the image in the expected orientation
+	Threshold float64 // Mean difference above which the best match is reported as doubtful
+}
+
+// OrientResult is the outcome of FindOrientation.
+type OrientResult struct {
+	Orientation string             // The best matching entry of Orientations
+	Differences map[string]float64 // Mean absolute channel difference from the reference per orientation
+	Tie         bool               // Another orientation is within orientTieMargin of the best one
+}
+
+// ParseOrientArgs parses the orient command arguments: options, the input
+// file and the output file.
+func ParseOrientArgs(args []string) (OrientOptions, string, string, error) {
+	opts := OrientOptions{Threshold: 20}
+
+	if len(args) < 2 {
+		return opts, "", "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-2] {
+		switch {
+		case strings.HasPrefix(arg, "--reference="):
+			opts.Reference = strings.TrimPrefix(arg, "--reference=")
+		case strings.HasPrefix(arg, "--threshold="):
+			t, err := strconv.ParseFloat(strings.TrimPrefix(arg, "--threshold="), 64)
+			if err != nil || t < 0 || t > 255 {
+				return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("invalid threshold option: %s (must be between 0 and 255)", arg))
+			}
+			opts.Threshold = t
+		default:
+			return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	if opts.Reference == "" {
+		return opts, "", "", withKind(ErrInvalidParameter, fmt.Errorf("missing --reference option"))
+	}
+
+	return opts, args[len(args)-2], args[len(args)-1], nil
+}
+
+// FindOrientation returns which flip of image best matches reference: none,
+// horizontal, vertical or both. Every flip and the reference are downscaled
+// to a small grid by averaging, so the images need not have the same size,
+// and every flip is scored by its mean absolute channel difference from the
+// reference.
+func FindOrientation(image, reference *BMPImage) OrientResult {
+	b := downscaleGrid(reference, false, false)
+
+	result := OrientResult{Differences: make(map[string]float64, len(Orientations))}
+	for _, o := range Orientations {
+		a := downscaleGrid(image, o == "horizontal" || o == "both", o == "vertical" || o == "both")
+		var sum float64
+		for y := range orientGrid {
+			for x := range orientGrid {
+				for c := range 3 {
+					d := a[y][x][c] - b[y][x][c]
+					if d < 0 {
+						d = -d
+					}
+					sum += d
+				}
+			}
+		}
+		result.Differences[o] = sum / (orientGrid * orientGrid * 3)
+	}
+
+	best := Orientations[0]
+	for _, o := range Orientations[1:] {
+		if result.Differences[o] < result.Differences[best] {
+			best = o
+		}
+	}
+	result.Orientation = best
+	for _, o := range Orientations {
+		if o != best && result.Differences[o]-result.Differences[best] < orientTieMargin {
+			result.Tie = true
+		}
+	}
+	return result
+}
+
+// Orient flips image as given by one of Orientations.
+func Orient(image *BMPImage, orientation string) {
+	if orientation == "horizontal" || orientation == "both" {
+		MirrorImage(image, "horizontal")
+	}
+	if orientation == "vertical" || orientation == "both" {
+		MirrorImage(image, "vertical")
+	}
+}
+
+// PrintOrientReport prints to w the chosen orientation and the difference of
+// every candidate, and warns through log if the choice is a tie or if even
+// the best match differs by more than threshold.
+func PrintOrientReport(w io.Writer, log Logger, result OrientResult, threshold float64) {
+	fmt.Fprintf(w, "Orientation: %s\n", result.Orientation)
+	for _, o := range Orientations {
+		fmt.Fprintf(w, "  %-10s  mean difference %.2f\n", o, result.Differences[o])
+	}
+
+	if result.Tie {
+		log.Warnf("the best orientations are within %.1f of each other; the choice may be wrong", orientTieMargin)
+	}
+	if d := result.Differences[result.Orientation]; d > threshold {
+		log.Warnf("the best orientation still differs by %.2f on average (threshold %.2f); the reference may not show the same scene", d, threshold)
+	}
+}
+
+// downscaleGrid averages the image, flipped as given, into an orientGrid x
+// orientGrid grid of cells in visual order, each holding its mean blue, green
+// and red levels. Cells span whole pixels; images smaller than the grid
+// repeat pixels.
+func downscaleGrid(image *BMPImage, flipX, flipY bool) [][][3]float64 {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	grid := make([][][3]float64, orientGrid)
+	for gy := range grid {
+		grid[gy] = make([][3]float64, orientGrid)
+		y0, y1 := gy*height/orientGrid, max((gy+1)*height/orientGrid, gy*height/orientGrid+1)
+		for gx := range grid[gy] {
+			x0, x1 := gx*width/orientGrid, max((gx+1)*width/orientGrid, gx*width/orientGrid+1)
+			var cell [3]float64
+			for y := y0; y < y1; y++ {
+				sy := y
+				if flipY {
+					sy = height - 1 - y
+				}
+				row := image.Data[sy]
+				for x := x0; x < x1; x++ {
+					sx := x
+					if flipX {
+						sx = width - 1 - x
+					}
+					cell[0] += float64(row[sx].Blue)
+					cell[1] += float64(row[sx].Green)
+					cell[2] += float64(row[sx].Red)
+				}
+			}
+			n := float64((y1 - y0) * (x1 - x0))
+			grid[gy][gx] = [3]float64{cell[0] / n, cell[1] / n, cell[2] / n}
+		}
+	}
+	return grid
+}
@@ -0,0 +1,79 @@
+package core
+
+import "testing"
+
+// orientFixture returns an image with no mirror symmetry: red grows to the
+// right, green downwards and blue towards the bottom-right corner.
+func orientFixture(width, height int) *BMPImage {
+	image := NewImage(width, height)
+	for y, row := range image.Rows() {
+		for x := range row {
+			row[x] = Pixel{
+				Blue:  byte((x + y) * 255 / (width + height)),
+				Green: byte(y * 255 / height),
+				Red:   byte(x * 255 / width),
+			}
+		}
+	}
+	return image
+}
+
+func TestFindOrientationRecoversFlip(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		flip          string
+	}{
+		{"none", 120, 80, "none"},
+		{"horizontal", 120, 80, "horizontal"},
+		{"vertical", 120, 80, "vertical"},
+		{"both", 120, 80, "both"},
+		{"smaller than the grid", 20, 10, "vertical"},
+		{"odd size", 97, 61, "both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reference := orientFixture(tt.width, tt.height)
+			image := reference.Clone()
+			Orient(image, tt.flip)
+
+			// Flips are their own inverse, so undoing one means applying it again
+			result := FindOrientation(image, reference)
+			if result.Orientation != tt.flip {
+				t.Fatalf("found %s, want %s (differences %v)", result.Orientation, tt.flip, result.Differences)
+			}
+			if result.Tie {
+				t.Errorf("reported a tie: %v", result.Differences)
+			}
+			if d := result.Differences[tt.flip]; d != 0 {
+				t.Errorf("the recovered orientation differs by %.2f, want 0", d)
+			}
+
+			Orient(image, result.Orientation)
+			if !gridsEqual(image.Data, reference.Data) {
+				t.Error("the oriented image does not match the reference")
+			}
+		})
+	}
+}
+
+func TestFindOrientationAcrossSizes(t *testing.T) {
+	// A reference of another size still shows the same scene
+	reference := orientFixture(300, 200)
+	image := orientFixture(150, 100)
+	Orient(image, "horizontal")
+
+	if result := FindOrientation(image, reference); result.Orientation != "horizontal" {
+		t.Errorf("found %s, want horizontal (differences %v)", result.Orientation, result.Differences)
+	}
+}
+
+func TestFindOrientationReportsTie(t *testing.T) {
+	// A uniform image looks the same under every flip
+	image := NewImage(16, 16)
+	result := FindOrientation(image, image.Clone())
+	if !result.Tie {
+		t.Errorf("no tie reported for a uniform image: %v", result.Differences)
+	}
+}
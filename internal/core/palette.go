@@ -0,0 +1,89 @@
+package core
+
+import (
+	"slices"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// pointwiseFilters are the filters whose output pixel only depends on the
+// input pixel at the same position. Applied to the colors of a palette, they
+// give the same image as applied to every pixel indexed by it.
+var pointwiseFilters = []string{"blue", "green", "red", "grayscale", "negative", "levels", "gamma", "curve"}
+
+// IsPointwise reports whether the filter of opts maps every pixel on its own,
+// regardless of its position and of the other pixels. Filters limited to a
+// region depend on the position, so they never are.
+func IsPointwise(opts FilterOptions) bool {
+	return opts.Region == nil && slices.Contains(pointwiseFilters, opts.FilterType)
+}
+
+// FilterPalette applies a pointwise filter to the colors of a palette in
+// place, in a time that doesn't depend on the size of the image the palette
+// belongs to; the indices of the image are left as they are. The colors are
+// run through Filter itself and blended at opts.Opacity like the pixels of a
+// pipeline, so the result is identical to filtering the expanded image. It
+// returns false, leaving the palette untouched, if the filter is not
+// pointwise: the image must then be expanded to true color and filtered as a
+// whole.
+func FilterPalette(palette []Pixel, opts FilterOptions) bool {
+	if !IsPointwise(opts) {
+		return false
+	}
+	if len(palette) == 0 {
+		return true
+	}
+
+	colors := NewImage(len(palette), 1)
+	copy(colors.Data[0], palette)
+	// Pointwise filters are built in, which can't fail
+	_ = filterWithOpacity(colors, opts)
+	copy(palette, colors.Data[0])
+	return true
+}
+
+// indexedPixels is the palette representation of a palettized image, kept
+// along with its pixels when ParseOptions.KeepPalette is set: its color table
+// and the index of every pixel in it, rows in the order of Data.
+type indexedPixels struct {
+	palette []Pixel
+	indices [][]byte
+}
+
+// readIndices returns the palette representation of the palettized image
+// bmp decoded from the file b, or nil for other images. Images with indices
+// past the end of their palette have none, since those pixels are black
+// whatever the palette becomes.
+func readIndices(bmp *BMPImage, b []byte) *indexedPixels {
+	palette := readPalette(bmp, b)
+	if palette == nil {
+		return nil
+	}
+	h := utils.Abs(int(bmp.InfoHeader.Height))
+	w := int(bmp.InfoHeader.Width)
+	bpp := int(bmp.InfoHeader.BitsPerPixel)
+	stride := pixelStride(bmp)
+	dataOffset := int(bmp.Header.DataOffset)
+
+	indices := make([][]byte, h)
+	for i := range h {
+		row := make([]byte, w)
+		for x := range row {
+			row[x] = paletteIndex(b[dataOffset+i*stride:], x, bpp)
+			if int(row[x]) >= len(palette) {
+				return nil
+			}
+		}
+		indices[bmp.fileRow(i)] = row
+	}
+	return &indexedPixels{palette: palette, indices: indices}
+}
+
+// expand sets the pixels of image to the colors of the palette they index.
+func (p *indexedPixels) expand(image *BMPImage) {
+	for y, row := range p.indices {
+		for x, i := range row {
+			image.Data[y][x] = p.palette[i]
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// palettizedFixture returns an 8-bit palettized BMP file of the given size
+// whose 256 colors are spread over the pixels.
+func palettizedFixture(width, height int) []byte {
+	palette := make([]Pixel, 256)
+	for i := range palette {
+		palette[i] = Pixel{Blue: byte(i), Green: byte(i * 7), Red: byte(255 - i*3)}
+	}
+	return palettedBMP(width, height, 8, palette, 0, func(x, y int) byte { return byte(x*13 + y*29) })
+}
+
+func TestFilterPaletteMatchesPixels(t *testing.T) {
+	data := palettizedFixture(23, 17)
+	pipelines := []string{
+		"--filter=negative",
+		"--filter=gamma:2.2",
+		"--filter=levels:40:200 --filter=red",
+		"--filter=curve:rgb:0/0,128/200,255/255 --filter=blue:tint",
+		"--filter=grayscale:opacity=40",
+		"--filter=negative --filter=blur:2 --filter=gamma:0.5",
+		"--filter=green --mirror=horizontal --filter=negative",
+		"--filter=negative:opacity=0 --filter=gamma:3:opacity=70",
+	}
+	for _, pipeline := range pipelines {
+		t.Run(pipeline, func(t *testing.T) {
+			transforms, _, _, err := ParseTransformations(append(strings.Fields(pipeline), "in.bmp", "out.bmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := DecodeImage(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ApplyTransformations(want, transforms); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := DecodeImageWith(data, ParseOptions{KeepPalette: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.indexed == nil {
+				t.Fatal("the palette of the image wasn't kept")
+			}
+			if err := ApplyTransformations(got, transforms); err != nil {
+				t.Fatal(err)
+			}
+			if got.indexed != nil {
+				t.Error("the palette is still kept after the pipeline")
+			}
+			if x, y, same := firstDifference(got, want); !same {
+				t.Errorf("pixel (%d, %d) is %v on the palette, %v on the pixels", x, y, got.Data[y][x], want.Data[y][x])
+			}
+		})
+	}
+}
+
+func TestKeepPaletteOnlyPalettized(t *testing.T) {
+	image, err := DecodeImageWith(encodeBMP(t, noiseImage(4, 4, 1)), ParseOptions{KeepPalette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.indexed != nil {
+		t.Error("a 24-bit image has a palette")
+	}
+
+	// A pixel past the end of the palette is black whatever the palette becomes
+	palette := []Pixel{{Red: 10}, {Green: 20}}
+	data := palettedBMP(3, 2, 8, palette, 2, func(x, y int) byte { return byte(x + y) })
+	if image, err = DecodeImageWith(data, ParseOptions{KeepPalette: true}); err != nil {
+		t.Fatal(err)
+	}
+	if image.indexed != nil {
+		t.Error("an image indexing past its palette has one")
+	}
+}
+
+// BenchmarkFilterPalettized compares pipelines of pointwise filters run on
+// the pixels of a palettized image and on its palette, whose colors still
+// have to be expanded to every pixel once.
+func BenchmarkFilterPalettized(b *testing.B) {
+	data := palettizedFixture(1024, 1024)
+	pipelines := []struct{ name, args string }{
+		{"negative", "--filter=negative"},
+		{"gamma", "--filter=gamma:2.2"},
+		{"chain", "--filter=negative --filter=gamma:2.2 --filter=levels:40:200 --filter=grayscale"},
+	}
+	for _, pipeline := range pipelines {
+		transforms, _, _, err := ParseTransformations(append(strings.Fields(pipeline.args), "in.bmp", "out.bmp"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, keep := range []bool{false, true} {
+			path := "pixels"
+			if keep {
+				path = "palette"
+			}
+			b.Run(fmt.Sprintf("%s/%s", pipeline.name, path), func(b *testing.B) {
+				for range b.N {
+					b.StopTimer()
+					image, err := DecodeImageWith(data, ParseOptions{KeepPalette: keep})
+					if err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+					if err := ApplyTransformations(image, transforms); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Workers is the number of goroutines the filters split their work over
+// when they run in parallel. It defaults to the number of CPUs and is set
+// by the --jobs flag of apply.
+var Workers = runtime.NumCPU()
+
+// ForRange calls fn on consecutive chunks [start, end) that together cover
+// [0, n), running the chunks on up to workers goroutines and returning once
+// all of them are done. A workers value below 1 means Workers. The chunks
+// differ in size by at most one, and with a single worker fn runs once on
+// the whole range in the calling goroutine.
+//
+// fn must only write to state owned by its own chunk for the result to be
+// independent of the number of workers. Filters that call ForRange are
+// listed in parallelFilters so that the determinism tests cover them.
+func ForRange(n, workers int, fn func(start, end int)) {
+	if workers < 1 {
+		workers = Workers
+	}
+	workers = min(workers, n)
+	if workers <= 1 {
+		if n > 0 {
+			fn(0, n)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	size, extra := n/workers, n%workers
+	start := 0
+	for i := 0; i < workers; i++ {
+		end := start + size
+		if i < extra {
+			end++
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
+		start = end
+	}
+	wg.Wait()
+}
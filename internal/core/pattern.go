@@ -0,0 +1,296 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PatternRampID is the test pattern that encodes the coordinates of every
+// pixel in its color: the low 8 bits of x in red, the low 8 bits of y in
+// green, and the high 4 bits of both in blue, x above y. It covers images up
+// to maxPatternSize in both dimensions.
+const PatternRampID = "ramp-id"
+
+// maxPatternSize is the largest width and height of a ramp-id pattern, the
+// largest coordinate the 12 bits per axis can hold plus one.
+const maxPatternSize = 1 << 12
+
+// patternMostly is the fraction of the pixels undoing a damage must make
+// verify for diagnosePattern to report that the pattern mostly looks damaged
+// that way.
+const patternMostly = 0.9
+
+// GenerateOptions holds the flags of the generate command.
+type GenerateOptions struct {
+	Pattern       string
+	Width, Height int
+}
+
+// ParseGenerateArgs parses the generate command arguments: options and the
+// output file.
+func ParseGenerateArgs(args []string) (GenerateOptions, string, error) {
+	opts := GenerateOptions{Pattern: PatternRampID}
+
+	if len(args) < 1 {
+		return opts, "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		switch {
+		case strings.HasPrefix(arg, "--pattern="):
+			opts.Pattern = strings.TrimPrefix(arg, "--pattern=")
+			if opts.Pattern != PatternRampID {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid pattern option: %s (must be %s)", arg, PatternRampID))
+			}
+		case strings.HasPrefix(arg, "--size="):
+			w, h, ok := strings.Cut(strings.TrimPrefix(arg, "--size="), "x")
+			var errW, errH error
+			opts.Width, errW = strconv.Atoi(w)
+			opts.Height, errH = strconv.Atoi(h)
+			if !ok || errW != nil || errH != nil || opts.Width <= 0 || opts.Height <= 0 {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid size option: %s (expected WIDTHxHEIGHT)", arg))
+			}
+			if opts.Width > maxPatternSize || opts.Height > maxPatternSize {
+				return opts, "", withKind(ErrOutOfBounds, fmt.Errorf("invalid size option: %s (the %s pattern is at most %dx%d)", arg, PatternRampID, maxPatternSize, maxPatternSize))
+			}
+		default:
+			return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	if opts.Width == 0 {
+		return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("missing --size option"))
+	}
+
+	return opts, args[len(args)-1], nil
+}
+
+// GeneratePattern returns a new bottom-up image holding the pattern of opts.
+func GeneratePattern(opts GenerateOptions) *BMPImage {
+	image := NewImage(opts.Width, opts.Height)
+	for y, row := range image.Rows() {
+		for x := range row {
+			row[x] = patternPixel(x, y)
+		}
+	}
+	return image
+}
+
+// patternPixel returns the ramp-id color of the pixel at (x, y).
+func patternPixel(x, y int) Pixel {
+	return Pixel{
+		Red:   byte(x),
+		Green: byte(y),
+		Blue:  byte(x>>8&0xf)<<4 | byte(y>>8&0xf),
+	}
+}
+
+// patternCoordinates returns the coordinates a ramp-id color encodes.
+func patternCoordinates(p Pixel) (x, y int) {
+	return int(p.Blue>>4)<<8 | int(p.Red), int(p.Blue&0xf)<<8 | int(p.Green)
+}
+
+// PatternReport is the outcome of VerifyPattern.
+type PatternReport struct {
+	Width, Height  int
+	Mismatches     int   // Number of pixels that don't encode their own coordinates
+	FirstX, FirstY int   // The first of them in raster order from the visual top-left
+	Expected, Got  Pixel // The color expected there and the one found
+	Diagnosis      string
+}
+
+// OK reports whether every pixel encodes its own coordinates.
+func (r PatternReport) OK() bool {
+	return r.Mismatches == 0
+}
+
+// VerifyPattern checks that every pixel of a captured ramp-id pattern
+// encodes its own coordinates. If not, it reports the first pixel that
+// doesn't and guesses how the pattern was damaged; see diagnosePattern.
+func VerifyPattern(image *BMPImage) PatternReport {
+	report := PatternReport{Width: int(image.InfoHeader.Width), Height: len(image.Data)}
+	for y, row := range image.Rows() {
+		for x, p := range row {
+			if px, py := patternCoordinates(p); px == x && py == y {
+				continue
+			}
+			if report.Mismatches == 0 {
+				report.FirstX, report.FirstY = x, y
+				report.Expected, report.Got = patternPixel(x, y), p
+			}
+			report.Mismatches++
+		}
+	}
+	if !report.OK() {
+		report.Diagnosis = diagnosePattern(image)
+	}
+	return report
+}
+
+// patternCorrection is a way a pattern may be damaged: it reports whether
+// the color p found at (x, y) of a width x height capture is the one the
+// damage would put there.
+type patternCorrection struct {
+	name    string
+	matches func(x, y, width, height int, p Pixel) bool
+}
+
+// patternCorrections are the damages diagnosePattern recognizes by undoing
+// them, in the order ties are resolved.
+var patternCorrections = []patternCorrection{
+	{"horizontally mirrored", func(x, y, w, h int, p Pixel) bool {
+		return atCoordinates(p, w-1-x, y)
+	}},
+	{"vertically mirrored (rows in the wrong order, e.g. a bottom-up/top-down mix-up)", func(x, y, w, h int, p Pixel) bool {
+		return atCoordinates(p, x, h-1-y)
+	}},
+	{"rotated by 180 degrees", func(x, y, w, h int, p Pixel) bool {
+		return atCoordinates(p, w-1-x, h-1-y)
+	}},
+	{"like a BGR/RGB swap (red and blue exchanged)", func(x, y, w, h int, p Pixel) bool {
+		return atCoordinates(Pixel{Blue: p.Red, Green: p.Green, Red: p.Blue}, x, y)
+	}},
+	{"like red and green exchanged", func(x, y, w, h int, p Pixel) bool {
+		return atCoordinates(Pixel{Blue: p.Blue, Green: p.Red, Red: p.Green}, x, y)
+	}},
+	{"like green and blue exchanged", func(x, y, w, h int, p Pixel) bool {
+		return atCoordinates(Pixel{Blue: p.Green, Green: p.Blue, Red: p.Red}, x, y)
+	}},
+}
+
+// atCoordinates reports whether p is the ramp-id color of (x, y).
+func atCoordinates(p Pixel, x, y int) bool {
+	px, py := patternCoordinates(p)
+	return px == x && py == y
+}
+
+// diagnosePattern guesses how a ramp-id pattern that doesn't verify was
+// damaged. It recognizes, in this order:
+//   - truncation: the rows up to some row of the file are intact and the
+//     rest are a single fill color, as left by a salvaged or zero-filled read;
+//   - mirroring, rotation by 180 degrees and exchanged channels: undoing
+//     the damage makes every pixel, or most of them, verify;
+//   - a stride error: every row starts a constant number of pixels further
+//     into the pattern than the one before, as when rows are read with the
+//     wrong length.
+func diagnosePattern(image *BMPImage) string {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+
+	if rows, ok := truncatedPattern(image); ok {
+		return fmt.Sprintf("looks truncated: only the first %d of %d rows of the file are intact, the rest are a single fill color", rows, height)
+	}
+
+	best, bestCount := -1, 0
+	for i, c := range patternCorrections {
+		count := 0
+		for y, row := range image.Rows() {
+			for x, p := range row {
+				if c.matches(x, y, width, height, p) {
+					count++
+				}
+			}
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	total := width * height
+	if best >= 0 && bestCount == total {
+		return "looks " + patternCorrections[best].name
+	}
+	if best >= 0 && float64(bestCount) >= patternMostly*float64(total) {
+		return fmt.Sprintf("mostly looks %s (%d of %d pixels)", patternCorrections[best].name, bestCount, total)
+	}
+
+	if shift, ok := patternStride(image); ok {
+		return fmt.Sprintf("looks like a stride error: every row starts %d pixels (%d bytes) further into the pattern than it should, relative to the row above",
+			shift, 3*shift)
+	}
+	return "no known damage matches"
+}
+
+// truncatedPattern reports whether the rows of the pattern are intact up to
+// some row of the file and every pixel of the rows after it has the same
+// color, and returns the number of intact rows. Rows are taken in file order,
+// so for a bottom-up image the missing rows are at the visual top.
+func truncatedPattern(image *BMPImage) (int, bool) {
+	var fill Pixel
+	intact := -1
+	for i := range image.Data {
+		y := image.fileRow(i)
+		for x, p := range image.Data[y] {
+			if intact < 0 {
+				if atCoordinates(p, x, y) {
+					continue
+				}
+				if x != 0 {
+					return 0, false
+				}
+				intact, fill = i, p
+			}
+			if p != fill {
+				return 0, false
+			}
+		}
+	}
+	return intact, intact > 0
+}
+
+// patternStride reports whether the rows of the pattern are shifted by a
+// constant number of pixels more than the row above, as happens when the rows
+// of a capture are read with the wrong stride, and returns that shift. The
+// first two rows, and most of the others, must hold consecutive pixels of the
+// pattern at the shifted position; the last rows may run past the end of the
+// data.
+func patternStride(image *BMPImage) (int, bool) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	if height < 2 {
+		return 0, false
+	}
+
+	// The position of a pixel in the pattern when read row by row
+	offset := func(y int) (int, bool) {
+		row := image.Data[y]
+		x0, y0 := patternCoordinates(row[0])
+		start := y0*width + x0
+		for x, p := range row {
+			px, py := patternCoordinates(p)
+			if px >= width || py*width+px != start+x {
+				return 0, false
+			}
+		}
+		return start - y*width, true
+	}
+
+	first, ok := offset(0)
+	if !ok {
+		return 0, false
+	}
+	second, ok := offset(1)
+	if !ok || second == first {
+		return 0, false
+	}
+	shift := second - first
+	matching := 2
+	for y := 2; y < height; y++ {
+		if o, ok := offset(y); ok && o == first+y*shift {
+			matching++
+		}
+	}
+	return shift, float64(matching) >= patternMostly*float64(height)
+}
+
+// PrintPatternReport writes whether the pattern verified to w, or else the
+// first pixel that doesn't, the number of such pixels and the diagnosis.
+func PrintPatternReport(w io.Writer, r PatternReport) {
+	if r.OK() {
+		fmt.Fprintf(w, "Pattern OK: all %d pixels of the %dx%d image encode their coordinates\n", r.Width*r.Height, r.Width, r.Height)
+		return
+	}
+	fmt.Fprintf(w, "Pattern mismatch: %d of %d pixels don't encode their coordinates\n", r.Mismatches, r.Width*r.Height)
+	fmt.Fprintf(w, "First at (%d,%d): expected #%02x%02x%02x, got #%02x%02x%02x\n",
+		r.FirstX, r.FirstY, r.Expected.Red, r.Expected.Green, r.Expected.Blue, r.Got.Red, r.Got.Green, r.Got.Blue)
+	fmt.Fprintf(w, "Diagnosis: %s\n", r.Diagnosis)
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestPatternEncodesCoordinates(t *testing.T) {
+	for _, c := range [][2]int{{0, 0}, {1, 2}, {255, 256}, {256, 255}, {4095, 4095}, {1234, 3210}} {
+		if x, y := patternCoordinates(patternPixel(c[0], c[1])); x != c[0] || y != c[1] {
+			t.Errorf("(%d, %d) decodes as (%d, %d)", c[0], c[1], x, y)
+		}
+	}
+}
+
+// strided returns the pattern as read back with rows shift pixels longer
+// than they are: every row starts shift pixels further into the data.
+func strided(pattern *BMPImage, shift int) *BMPImage {
+	width, height := int(pattern.InfoHeader.Width), len(pattern.Data)
+	var linear []Pixel
+	for _, row := range pattern.Rows() {
+		linear = append(linear, row...)
+	}
+	image := NewImage(width, height)
+	for y, row := range image.Rows() {
+		for x := range row {
+			if i := y*(width+shift) + x; i < len(linear) {
+				row[x] = linear[i]
+			}
+		}
+	}
+	return image
+}
+
+func TestVerifyPatternDiagnoses(t *testing.T) {
+	swap := func(f func(p Pixel) Pixel) func(*BMPImage) *BMPImage {
+		return func(image *BMPImage) *BMPImage {
+			for _, row := range image.Data {
+				for x, p := range row {
+					row[x] = f(p)
+				}
+			}
+			return image
+		}
+	}
+
+	tests := []struct {
+		name      string
+		damage    func(*BMPImage) *BMPImage
+		diagnosis string // Expected prefix of the diagnosis; empty for an intact pattern
+	}{
+		{"intact", func(image *BMPImage) *BMPImage { return image }, ""},
+		{"bmp round trip", func(image *BMPImage) *BMPImage {
+			parsed, err := ParseBMP(encodeBMP(t, image))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return parsed
+		}, ""},
+		{"horizontal mirror", func(image *BMPImage) *BMPImage { MirrorImage(image, "horizontal"); return image }, "looks horizontally mirrored"},
+		{"vertical mirror", func(image *BMPImage) *BMPImage { MirrorImage(image, "vertical"); return image }, "looks vertically mirrored"},
+		{"top-down mix-up", func(image *BMPImage) *BMPImage {
+			// The rows of a bottom-up file read as if they were top-down
+			b := encodeBMP(t, image)
+			binary.LittleEndian.PutUint32(b[22:], uint32(-image.InfoHeader.Height))
+			parsed, err := ParseBMP(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return parsed
+		}, "looks vertically mirrored"},
+		{"rotation", func(image *BMPImage) *BMPImage { Orient(image, "both"); return image }, "looks rotated by 180 degrees"},
+		{"bgr", swap(func(p Pixel) Pixel { return Pixel{Blue: p.Red, Green: p.Green, Red: p.Blue} }), "looks like a BGR/RGB swap"},
+		{"red and green", swap(func(p Pixel) Pixel { return Pixel{Blue: p.Blue, Green: p.Red, Red: p.Green} }), "looks like red and green"},
+		{"green and blue", swap(func(p Pixel) Pixel { return Pixel{Blue: p.Green, Green: p.Blue, Red: p.Red} }), "looks like green and blue"},
+		{"mirror with a bad pixel", func(image *BMPImage) *BMPImage {
+			MirrorImage(image, "horizontal")
+			image.Set(10, 10, Pixel{Red: 1})
+			return image
+		}, "mostly looks horizontally mirrored"},
+		{"truncated", func(image *BMPImage) *BMPImage {
+			parsed, _, err := SalvageBMP(encodeBMP(t, image)[:54+100*300*3+10], defaultSalvageFill, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return parsed
+		}, "looks truncated: only the first 100 of 260 rows"},
+		{"stride", func(image *BMPImage) *BMPImage { return strided(image, 2) }, "looks like a stride error: every row starts 2 pixels (6 bytes)"},
+		{"noise", func(image *BMPImage) *BMPImage { return noiseImage(300, 260, 1) }, "no known damage matches"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Larger than 256 both ways, so the high bits in blue are used
+			image := tt.damage(GeneratePattern(GenerateOptions{Pattern: PatternRampID, Width: 300, Height: 260}))
+			report := VerifyPattern(image)
+
+			if tt.diagnosis == "" {
+				if !report.OK() {
+					t.Fatalf("pattern reported damaged: %+v", report)
+				}
+				return
+			}
+			if report.OK() {
+				t.Fatal("damaged pattern verified")
+			}
+			if !strings.HasPrefix(report.Diagnosis, tt.diagnosis) {
+				t.Errorf("diagnosis %q, want it to start with %q", report.Diagnosis, tt.diagnosis)
+			}
+		})
+	}
+}
+
+func TestVerifyPatternReportsFirstMismatch(t *testing.T) {
+	image := GeneratePattern(GenerateOptions{Pattern: PatternRampID, Width: 20, Height: 10})
+	image.Set(7, 3, Pixel{Red: 9})
+	image.Set(2, 8, Pixel{})
+
+	report := VerifyPattern(image)
+	if report.Mismatches != 2 || report.FirstX != 7 || report.FirstY != 3 {
+		t.Errorf("got %d mismatches, first at (%d, %d), want 2 at (7, 3)", report.Mismatches, report.FirstX, report.FirstY)
+	}
+	if report.Expected != patternPixel(7, 3) || report.Got != (Pixel{Red: 9}) {
+		t.Errorf("expected %v and got %v at the first mismatch", report.Expected, report.Got)
+	}
+}
+
+func TestParseGenerateArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"--size=320x240", "out.bmp"}, true},
+		{[]string{"--pattern=ramp-id", "--size=4096x1", "out.bmp"}, true},
+		{[]string{"out.bmp"}, false},
+		{[]string{"--size=4097x1", "out.bmp"}, false},
+		{[]string{"--size=0x5", "out.bmp"}, false},
+		{[]string{"--size=5", "out.bmp"}, false},
+		{[]string{"--pattern=bars", "--size=5x5", "out.bmp"}, false},
+		{[]string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if _, _, err := ParseGenerateArgs(tt.args); (err == nil) != tt.ok {
+				t.Errorf("ParseGenerateArgs(%v) error = %v, want ok %v", tt.args, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package core
+
+import "context"
+
+// ParsedPipeline is a pipeline of transformations parsed once and applied to
+// any number of images, such as every file of a batch, without parsing the
+// flags again. Applying it only reads the transformations, so one pipeline
+// may be applied to several images concurrently.
+type ParsedPipeline struct {
+	Transforms []Transform
+}
+
+// ParsePipeline parses the transformation flags of apply, without the input
+// and output files ParseTransformations expects after them. Its errors are
+// of kind ErrInvalidParameter.
+func ParsePipeline(args []string) (*ParsedPipeline, error) {
+	transforms, err := parseTransformArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return &ParsedPipeline{Transforms: transforms}, nil
+}
+
+// Apply applies the pipeline to image, as ApplyTransformations does.
+func (p *ParsedPipeline) Apply(image *BMPImage) error {
+	return ApplyTransformations(image, p.Transforms)
+}
+
+// ApplyContext applies the pipeline to image, stopping once ctx is done, as
+// ApplyTransformationsContext does.
+func (p *ParsedPipeline) ApplyContext(ctx context.Context, image *BMPImage) error {
+	return ApplyTransformationsContext(ctx, image, p.Transforms)
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// batchArgs are the flags of a typical batch run.
+var batchArgs = []string{"--mirror=horizontal", "--filter=levels:10:240", "--filter=blur:2:clamp", "--rotate=right", "--crop=1-1-6-6", "--filter=grayscale:opacity=50"}
+
+func TestParsedPipelineMatchesParseTransformations(t *testing.T) {
+	pipeline, err := ParsePipeline(batchArgs)
+	if err != nil {
+		t.Fatalf("ParsePipeline: %v", err)
+	}
+	transforms, _, _, err := ParseTransformations(append(batchArgs[:len(batchArgs):len(batchArgs)], "in.bmp", "out.bmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same pipeline applied to several images gives what parsing the
+	// flags for each of them gives
+	for seed := range int64(3) {
+		want := noiseImage(9, 8, seed)
+		if err := ApplyTransformations(want, transforms); err != nil {
+			t.Fatal(err)
+		}
+		got := noiseImage(9, 8, seed)
+		if err := pipeline.Apply(got); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		if !gridsEqual(got.Data, want.Data) {
+			t.Errorf("image %d differs from the one of ParseTransformations", seed)
+		}
+	}
+
+	if _, err := ParsePipeline([]string{"--filter=sepia"}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("unknown filter: error %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestApplyTransformMismatchedOptions(t *testing.T) {
+	// The options tell the transformation, so a Type that doesn't match them
+	// can't make it panic
+	transforms := []Transform{{Type: CropTransform, Options: MirrorOptions{Direction: "horizontal"}}}
+	if err := ApplyTransformations(noiseImage(4, 4, 1), transforms); err != nil {
+		t.Errorf("mirror options with a crop type: %v", err)
+	}
+}
+
+// BenchmarkBatchParsePerFile simulates a batch of 1000 small files whose
+// flags are parsed again for every file.
+func BenchmarkBatchParsePerFile(b *testing.B) {
+	args := append(batchArgs[:len(batchArgs):len(batchArgs)], "in.bmp", "out.bmp")
+	src := noiseImage(8, 8, 1)
+	for range b.N {
+		for range 1000 {
+			transforms, _, _, err := ParseTransformations(args)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := ApplyTransformations(src.Clone(), transforms); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkBatchParsedPipeline is BenchmarkBatchParsePerFile with the flags
+// parsed once for the whole batch.
+func BenchmarkBatchParsedPipeline(b *testing.B) {
+	pipeline, err := ParsePipeline(batchArgs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	src := noiseImage(8, 8, 1)
+	for range b.N {
+		for range 1000 {
+			if err := pipeline.Apply(src.Clone()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+// checkBlocks checks that every pixel of image is the rounded average of
+// the size by size block of src it lies in, clipped to the image.
+func checkBlocks(t *testing.T, image, src *BMPImage, size int) {
+	t.Helper()
+	for y, row := range image.Data {
+		for x, p := range row {
+			bx, by := x/size*size, y/size*size
+			var red, green, blue, count int
+			for sy := by; sy < min(by+size, len(src.Data)); sy++ {
+				for sx := bx; sx < min(bx+size, len(row)); sx++ {
+					q := src.Data[sy][sx]
+					red, green, blue, count = red+int(q.Red), green+int(q.Green), blue+int(q.Blue), count+1
+				}
+			}
+			want := Pixel{Red: byte(divRound(red, count)), Green: byte(divRound(green, count)), Blue: byte(divRound(blue, count))}
+			if p != want {
+				t.Fatalf("blocks of %d: pixel (%d, %d) is %v, want %v", size, x, y, p, want)
+			}
+		}
+	}
+}
+
+func TestPixelateSize(t *testing.T) {
+	pixelate := func(src *BMPImage, args ...string) *BMPImage {
+		t.Helper()
+		transforms, _, _, err := ParseTransformations(append(args, "in.bmp", "out.bmp"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		image := src.Clone()
+		if err := ApplyTransformations(image, transforms); err != nil {
+			t.Fatal(err)
+		}
+		return image
+	}
+
+	src := noiseImage(100, 60, 3)
+	byDefault := pixelate(src, "--filter=pixelate")
+	checkBlocks(t, byDefault, src, defaultPixelateSize)
+
+	// The size applies wherever it is given, and wins over the default
+	for _, args := range [][]string{
+		{"--pixelate-size=2", "--filter=pixelate"},
+		{"--filter=pixelate", "--pixelate-size=2"},
+	} {
+		sized := pixelate(src, args...)
+		checkBlocks(t, sized, src, 2)
+		if gridsEqual(sized.Data, byDefault.Data) {
+			t.Errorf("%v gives the same pixels as the default", args)
+		}
+	}
+
+	// On an image smaller than the default block, the default is the whole
+	// image, while a size given is kept
+	small := noiseImage(10, 6, 4)
+	checkBlocks(t, pixelate(small, "--filter=pixelate"), small, 10)
+	for _, size := range []int{2, 3} {
+		checkBlocks(t, pixelate(small, fmt.Sprintf("--pixelate-size=%d", size), "--filter=pixelate"), small, size)
+	}
+}
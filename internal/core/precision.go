@@ -0,0 +1,294 @@
+package core
+
+import "math"
+
+// Pixel16 is a pixel with 16 bits per channel, used by the high precision
+// mode so that chained filters don't round their results to 8 bits after
+// every step.
+type Pixel16 struct {
+	Blue  uint16
+	Green uint16
+	Red   uint16
+}
+
+// WidenPixel converts p to 16 bits per channel. Every 8-bit value v becomes
+// v*257, so 0 and 255 map to the ends of the 16-bit range.
+func WidenPixel(p Pixel) Pixel16 {
+	return Pixel16{Blue: uint16(p.Blue) * 257, Green: uint16(p.Green) * 257, Red: uint16(p.Red) * 257}
+}
+
+// NarrowPixel converts p back to 8 bits per channel, rounding every channel
+// to the nearest 8-bit value. NarrowPixel(WidenPixel(p)) == p for any p.
+func NarrowPixel(p Pixel16) Pixel {
+	return Pixel{Blue: narrow(p.Blue), Green: narrow(p.Green), Red: narrow(p.Red)}
+}
+
+// narrow rounds a 16-bit channel value to the nearest 8-bit one.
+func narrow(v uint16) byte {
+	return byte((uint32(v)*255 + 32767) / 65535)
+}
+
+// Widen switches the image to 16-bit precision by filling Wide from Data.
+// From then on filters only update Wide, and Data merely keeps the shape of
+// the image until Narrow is called. Geometric transformations keep both in step.
+func (b *BMPImage) Widen() {
+	b.Wide = make([][]Pixel16, len(b.Data))
+	for y, row := range b.Data {
+		b.Wide[y] = make([]Pixel16, len(row))
+		for x, p := range row {
+			b.Wide[y][x] = WidenPixel(p)
+		}
+	}
+}
+
+// Narrow quantizes Wide back into Data and leaves 16-bit precision.
+// It does nothing if the image is not widened.
+func (b *BMPImage) Narrow() {
+	if b.Wide == nil {
+		return
+	}
+	for y, row := range b.Wide {
+		for x, p := range row {
+			b.Data[y][x] = NarrowPixel(p)
+		}
+	}
+	b.Wide = nil
+}
+
+// narrowed returns the image with 8-bit pixel data quantized from Wide,
+// without modifying b. Images that are not widened are returned as they are.
+func (b *BMPImage) narrowed() *BMPImage {
+	if b.Wide == nil {
+		return b
+	}
+	n := *b
+	n.Data = make([][]Pixel, len(b.Wide))
+	for y, row := range b.Wide {
+		n.Data[y] = make([]Pixel, len(row))
+		for x, p := range row {
+			n.Data[y][x] = NarrowPixel(p)
+		}
+	}
+	n.Wide = nil
+	return &n
+}
+
+// filterWide is Filter for widened images. Every filter computes its result
+// from the 16-bit values directly, or through a 65536-entry lookup table.
+// Filters with no 16-bit implementation, whose output doesn't gain from the
+// extra precision, run on the image narrowed to 8 bits and widened again.
+func filterWide(image *BMPImage, opts FilterOptions) error {
+	switch opts.FilterType {
+	case "blue", "green", "red", "grayscale", "negative":
+		if len(opts.Args) > 0 {
+			return filterNarrowed(image, opts)
+		}
+		applyColorWide(image, opts.FilterType)
+	case "pixelate":
+		applyPixelateWide(image, opts.pixelateSize(int(image.InfoHeader.Width), len(image.Data)))
+	case "blur":
+		radius, mode, _ := opts.blurArgs()
+		applyBlurWide(image, radius, mode)
+	case "levels":
+		black, white, _ := parseLevelsArgs(opts.Args)
+		levelsWide(image, uint16(black)*257, uint16(white)*257)
+	case "autocontrast":
+		clip, _ := parseAutoContrastArgs(opts.Args)
+		var hist [256]int
+		for _, row := range image.Wide {
+			for _, p := range row {
+				hist[narrow(luminanceWide(p))]++
+			}
+		}
+		black, white := histogramBounds(hist, clip)
+		levelsWide(image, uint16(black)*257, uint16(white)*257)
+	case "gamma":
+		gamma, _ := parseGammaArgs(opts.Args)
+		lut := make([]uint16, 65536)
+		for v := range lut {
+			lut[v] = clampRound16(math.Pow(float64(v)/65535, 1/gamma) * 65535)
+		}
+		mapWide(image, lut)
+	case "curve":
+		channel, c, _ := parseCurveArgs(opts.Args)
+		lut := make([]uint16, 65536)
+		for v := range lut {
+			lut[v] = clampRound16(c.At(float64(v)/257) / 255 * 65535)
+		}
+		curveWide(image, channel, lut)
+	default:
+		return filterNarrowed(image, opts)
+	}
+	return nil
+}
+
+// filterNarrowed runs a filter on the widened image at 8-bit precision.
+func filterNarrowed(image *BMPImage, opts FilterOptions) error {
+	image.Narrow()
+	err := Filter(image, opts)
+	image.Widen()
+	return err
+}
+
+// curveWide is ApplyCurve at 16-bit precision, with the curve compiled into lut.
+func curveWide(image *BMPImage, channel string, lut []uint16) {
+	if channel == "rgb" {
+		mapWide(image, lut)
+		return
+	}
+	ForRange(len(image.Wide), 0, func(start, end int) {
+		for _, row := range image.Wide[start:end] {
+			for x := range row {
+				p := &row[x]
+				switch channel {
+				case "red":
+					p.Red = lut[p.Red]
+				case "green":
+					p.Green = lut[p.Green]
+				case "blue":
+					p.Blue = lut[p.Blue]
+				}
+			}
+		}
+	})
+}
+
+// applyColorWide is applyColor at 16-bit precision.
+func applyColorWide(image *BMPImage, filter string) {
+	ForRange(len(image.Wide), 0, func(start, end int) {
+		for _, row := range image.Wide[start:end] {
+			for x := range row {
+				p := &row[x]
+				switch filter {
+				case "blue":
+					p.Green, p.Red = 0, 0
+				case "green":
+					p.Blue, p.Red = 0, 0
+				case "red":
+					p.Blue, p.Green = 0, 0
+				case "grayscale":
+					gray := luminanceWide(*p)
+					p.Blue, p.Green, p.Red = gray, gray, gray
+				case "negative":
+					p.Blue, p.Green, p.Red = 65535-p.Blue, 65535-p.Green, 65535-p.Red
+				}
+			}
+		}
+	})
+}
+
+// luminanceWide is luminance at 16-bit precision.
+func luminanceWide(p Pixel16) uint16 {
+	return clampRound16(float64(p.Red)*0.2126 + float64(p.Green)*0.7152 + float64(p.Blue)*0.0722)
+}
+
+// levelsWide is Levels at 16-bit precision, with black and white on the 16-bit scale.
+func levelsWide(image *BMPImage, black, white uint16) {
+	if black >= white {
+		return
+	}
+
+	lut := make([]uint16, 65536)
+	span := int(white) - int(black)
+	for v := range lut {
+		switch {
+		case v <= int(black):
+			lut[v] = 0
+		case v >= int(white):
+			lut[v] = 65535
+		default:
+			lut[v] = uint16(divRound((v-int(black))*65535, span))
+		}
+	}
+	mapWide(image, lut)
+}
+
+// mapWide replaces every channel value v of the widened image with lut[v].
+// Rows are processed in parallel.
+func mapWide(image *BMPImage, lut []uint16) {
+	ForRange(len(image.Wide), 0, func(start, end int) {
+		for _, row := range image.Wide[start:end] {
+			for x := range row {
+				p := &row[x]
+				p.Blue, p.Green, p.Red = lut[p.Blue], lut[p.Green], lut[p.Red]
+			}
+		}
+	})
+}
+
+// applyPixelateWide is applyPixelate at 16-bit precision.
+func applyPixelateWide(image *BMPImage, blocksize int) {
+	h := len(image.Wide)
+	w := len(image.Wide[0])
+
+	for startY := 0; startY < h; startY += blocksize {
+		for startX := 0; startX < w; startX += blocksize {
+			pixelateBlockWide(image, startX, startY, blocksize)
+		}
+	}
+}
+
+// pixelateBlockWide fills the block of the widened image starting at
+// (startX, startY) with its average color. The block must start inside
+// the image.
+func pixelateBlockWide(image *BMPImage, startX, startY, blocksize int) {
+	endY, endX := min(startY+blocksize, len(image.Wide)), min(startX+blocksize, len(image.Wide[0]))
+
+	var rSum, gSum, bSum, cnt uint64
+	for y := startY; y < endY; y++ {
+		for _, p := range image.Wide[y][startX:endX] {
+			rSum += uint64(p.Red)
+			gSum += uint64(p.Green)
+			bSum += uint64(p.Blue)
+			cnt++
+		}
+	}
+
+	avg := Pixel16{Red: uint16(divRound(rSum, cnt)), Green: uint16(divRound(gSum, cnt)), Blue: uint16(divRound(bSum, cnt))}
+	for y := startY; y < endY; y++ {
+		for x := startX; x < endX; x++ {
+			image.Wide[y][x] = avg
+		}
+	}
+}
+
+// applyBlurWide is applyBlur at 16-bit precision.
+func applyBlurWide(image *BMPImage, blurRadius int, mode EdgeMode) {
+	height := len(image.Wide)
+	width := len(image.Wide[0])
+
+	blurred := make([][]Pixel16, height)
+	band := blurBandHeight(blurRadius)
+	ForRange((height+band-1)/band, 0, func(start, end int) {
+		for y := start * band; y < end*band && y < height; y += band {
+			rows := blurred[y:min(y+band, height)]
+			for i := range rows {
+				rows[i] = make([]Pixel16, width)
+			}
+			blurRowsWide(rows, image.Wide, y, blurRadius, mode)
+		}
+	})
+	image.Wide = blurred
+}
+
+// blurRowsWide is blurRows at 16-bit precision, reading its rows from src.
+func blurRowsWide(dst [][]Pixel16, src [][]Pixel16, y, blurRadius int, mode EdgeMode) {
+	sums := newColumnSums(len(dst[0]))
+	slide := func(ny, sign int) {
+		if sy, ok := mode.index(ny, len(src)); ok {
+			sums.addWide(src[sy], sign)
+		}
+	}
+	for ny := y - blurRadius; ny <= y+blurRadius; ny++ {
+		slide(ny, 1)
+	}
+	for i, row := range dst {
+		if i > 0 {
+			slide(y+i+blurRadius, 1)
+			slide(y+i-blurRadius-1, -1)
+		}
+		sums.blur(blurRadius, mode, func(x, red, green, blue, count int) {
+			row[x] = Pixel16{Red: uint16(divRound(red, count)), Green: uint16(divRound(green, count)), Blue: uint16(divRound(blue, count))}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultPyramidLevels is the number of levels of the pyramid command
+// without --levels.
+const defaultPyramidLevels = 4
+
+// pyramidIndexName is the name of the index the pyramid command writes next
+// to the levels.
+const pyramidIndexName = "index.json"
+
+// ParsePyramidArgs parses the pyramid command arguments: the options, the
+// input file and the output directory. It returns the number of levels.
+func ParsePyramidArgs(args []string) (int, string, string, error) {
+	levels := defaultPyramidLevels
+
+	if len(args) < 2 {
+		return levels, "", "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-2] {
+		switch {
+		case strings.HasPrefix(arg, "--levels="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--levels="))
+			if err != nil || n <= 0 {
+				return levels, "", "", withKind(ErrInvalidParameter, fmt.Errorf("invalid levels option: %s", arg))
+			}
+			levels = n
+		default:
+			return levels, "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	return levels, args[len(args)-2], args[len(args)-1], nil
+}
+
+// Pyramid returns up to levels versions of image, the first being image
+// itself and each next one half the size of the one before, rounded down,
+// resized from it with the box filter so that the whole pyramid costs about
+// as much as one pass over image. It stops early at the level that would
+// be less than a pixel wide or tall.
+func Pyramid(image *BMPImage, levels int) []*BMPImage {
+	pyramid := []*BMPImage{image}
+	for len(pyramid) < levels {
+		prev := pyramid[len(pyramid)-1]
+		width, height := int(prev.InfoHeader.Width)/2, len(prev.Data)/2
+		if width < 1 || height < 1 {
+			break
+		}
+		pyramid = append(pyramid, resizeBox(prev, width, height))
+	}
+	return pyramid
+}
+
+// PyramidLevel describes a level of a pyramid in its index.
+type PyramidLevel struct {
+	File   string `json:"file"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// WritePyramid saves the levels of pyramid as level_N.bmp in outDir,
+// creating the directory if needed, and describes them in index.json there,
+// written atomically like Save once every level is. Failing to write a level
+// or the index is an error of kind ErrIO.
+func WritePyramid(pyramid []*BMPImage, outDir string) error {
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return ioError(err)
+	}
+
+	index := struct {
+		Levels []PyramidLevel `json:"levels"`
+	}{}
+	for n, level := range pyramid {
+		name := fmt.Sprintf("level_%d.bmp", n)
+		if err := SaveBMP(level, filepath.Join(outDir, name)); err != nil {
+			return err
+		}
+		index.Levels = append(index.Levels, PyramidLevel{File: name, Width: int(level.InfoHeader.Width), Height: len(level.Data)})
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomic(filepath.Join(outDir, pyramidIndexName))
+	if err != nil {
+		return ioError(err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Abort()
+		return ioError(err)
+	}
+	return ioError(f.Commit())
+}
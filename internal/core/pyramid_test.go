@@ -0,0 +1,98 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPyramidDimensions(t *testing.T) {
+	tests := []struct {
+		width, height, levels int
+		want                  [][2]int
+	}{
+		{64, 32, 4, [][2]int{{64, 32}, {32, 16}, {16, 8}, {8, 4}}},
+		{13, 7, 4, [][2]int{{13, 7}, {6, 3}, {3, 1}}},
+		{5, 9, 10, [][2]int{{5, 9}, {2, 4}, {1, 2}}},
+		{1, 1, 3, [][2]int{{1, 1}}},
+		{8, 8, 1, [][2]int{{8, 8}}},
+	}
+
+	for _, tt := range tests {
+		pyramid := Pyramid(noiseImage(tt.width, tt.height, 1), tt.levels)
+		var got [][2]int
+		for _, level := range pyramid {
+			got = append(got, [2]int{int(level.InfoHeader.Width), len(level.Data)})
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Pyramid of %dx%d with %d levels: sizes %v, want %v", tt.width, tt.height, tt.levels, got, tt.want)
+		}
+	}
+}
+
+func TestPyramidLevelsAverageThePreviousLevel(t *testing.T) {
+	pyramid := Pyramid(noiseImage(23, 18, 2), 4)
+	for n, level := range pyramid[1:] {
+		prev := pyramid[n]
+		pw, ph := int(prev.InfoHeader.Width), len(prev.Data)
+		w, h := int(level.InfoHeader.Width), len(level.Data)
+
+		// Every pixel is the rounded average of the pixels of the previous
+		// level it covers; on odd sizes the last one also takes the odd
+		// column or row
+		for y := range h {
+			for x := range w {
+				y1, x1 := 2*y+2, 2*x+2
+				if y == h-1 {
+					y1 = ph
+				}
+				if x == w-1 {
+					x1 = pw
+				}
+				var r, g, b, count int
+				for sy := 2 * y; sy < y1; sy++ {
+					for sx := 2 * x; sx < x1; sx++ {
+						p := prev.At(sx, sy)
+						r, g, b, count = r+int(p.Red), g+int(p.Green), b+int(p.Blue), count+1
+					}
+				}
+				want := Pixel{Red: byte((r + count/2) / count), Green: byte((g + count/2) / count), Blue: byte((b + count/2) / count)}
+				if got := level.At(x, y); got != want {
+					t.Fatalf("level %d pixel (%d,%d) = %v, want %v", n+1, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWritePyramid(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	pyramid := Pyramid(noiseImage(10, 6, 3), 4)
+	if err := WritePyramid(pyramid, dir); err != nil {
+		t.Fatalf("WritePyramid: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct{ Levels []PyramidLevel }
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("index isn't valid JSON: %v", err)
+	}
+	want := []PyramidLevel{{"level_0.bmp", 10, 6}, {"level_1.bmp", 5, 3}, {"level_2.bmp", 2, 1}}
+	if !slices.Equal(index.Levels, want) {
+		t.Fatalf("index %v, want %v", index.Levels, want)
+	}
+	for n, level := range index.Levels {
+		image, err := LoadImage(filepath.Join(dir, level.File))
+		if err != nil {
+			t.Fatalf("level %d: %v", n, err)
+		}
+		if !gridsEqual(image.Data, pyramid[n].Data) {
+			t.Errorf("%s doesn't hold level %d", level.File, n)
+		}
+	}
+}
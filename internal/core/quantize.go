@@ -0,0 +1,154 @@
+package core
+
+import "slices"
+
+// colorCount is a distinct color of an image together with how often it occurs.
+type colorCount struct {
+	color Pixel
+	count int
+}
+
+// colorBox is a set of colors that will be represented by a single palette entry.
+type colorBox struct {
+	colors []colorCount
+	total  int // sum of the counts of colors
+}
+
+// channel returns the value of channel c (0 blue, 1 green, 2 red) of p.
+func channel(p Pixel, c int) byte {
+	switch c {
+	case 0:
+		return p.Blue
+	case 1:
+		return p.Green
+	}
+	return p.Red
+}
+
+// widestChannel returns the channel with the largest value range in the box and that range.
+func (b *colorBox) widestChannel() (int, int) {
+	best, bestRange := 0, -1
+	for c := 0; c < 3; c++ {
+		lo, hi := byte(255), byte(0)
+		for _, cc := range b.colors {
+			v := channel(cc.color, c)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if r := int(hi) - int(lo); r > bestRange {
+			best, bestRange = c, r
+		}
+	}
+	return best, bestRange
+}
+
+// average returns the count-weighted mean color of the box, rounded.
+func (b *colorBox) average() Pixel {
+	var blueSum, greenSum, redSum int
+	for _, cc := range b.colors {
+		blueSum += int(cc.color.Blue) * cc.count
+		greenSum += int(cc.color.Green) * cc.count
+		redSum += int(cc.color.Red) * cc.count
+	}
+	return Pixel{
+		Blue:  byte(divRound(blueSum, b.total)),
+		Green: byte(divRound(greenSum, b.total)),
+		Red:   byte(divRound(redSum, b.total)),
+	}
+}
+
+// MedianCut computes a palette of at most maxColors colors for the image.
+// If the image has no more distinct colors than that, the palette holds
+// exactly those colors, so quantizing to it is lossless. Otherwise the color
+// space is split recursively at the pixel-weighted median of the widest
+// channel of the box with the largest range, and every box contributes its
+// weighted mean color.
+func MedianCut(image *BMPImage, maxColors int) []Pixel {
+	counts := make(map[Pixel]int)
+	for _, row := range image.Data {
+		for _, p := range row {
+			counts[p]++
+		}
+	}
+
+	colors := make([]colorCount, 0, len(counts))
+	total := 0
+	for p, n := range counts {
+		colors = append(colors, colorCount{color: p, count: n})
+		total += n
+	}
+	// Map iteration order is random; sort so the palette is deterministic.
+	slices.SortFunc(colors, func(a, b colorCount) int {
+		return int(packPixel(a.color)) - int(packPixel(b.color))
+	})
+
+	if len(colors) <= maxColors {
+		palette := make([]Pixel, len(colors))
+		for i, cc := range colors {
+			palette[i] = cc.color
+		}
+		return palette
+	}
+
+	boxes := []colorBox{{colors: colors, total: total}}
+	for len(boxes) < maxColors {
+		// Pick the box whose widest channel spans the largest range.
+		pick, pickChannel, pickRange := -1, 0, 0
+		for i := range boxes {
+			if len(boxes[i].colors) < 2 {
+				continue
+			}
+			if c, r := boxes[i].widestChannel(); r > pickRange {
+				pick, pickChannel, pickRange = i, c, r
+			}
+		}
+		if pick < 0 {
+			break
+		}
+
+		box := boxes[pick]
+		slices.SortStableFunc(box.colors, func(a, b colorCount) int {
+			return int(channel(a.color, pickChannel)) - int(channel(b.color, pickChannel))
+		})
+
+		// Split at the weighted median, keeping at least one color on each side.
+		split, seen := 1, box.colors[0].count
+		for split < len(box.colors)-1 && seen+box.colors[split].count <= box.total/2 {
+			seen += box.colors[split].count
+			split++
+		}
+
+		lower := colorBox{colors: box.colors[:split], total: seen}
+		upper := colorBox{colors: box.colors[split:], total: box.total - seen}
+		boxes[pick] = lower
+		boxes = append(boxes, upper)
+	}
+
+	palette := make([]Pixel, len(boxes))
+	for i := range boxes {
+		palette[i] = boxes[i].average()
+	}
+	return palette
+}
+
+// nearestColor returns the index of the palette entry closest to p
+// by squared Euclidean distance.
+func nearestColor(palette []Pixel, p Pixel) byte {
+	best, bestDist := 0, 1<<30
+	for i, c := range palette {
+		db := int(c.Blue) - int(p.Blue)
+		dg := int(c.Green) - int(p.Green)
+		dr := int(c.Red) - int(p.Red)
+		if d := db*db + dg*dg + dr*dr; d < bestDist {
+			best, bestDist = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return byte(best)
+}
+
+// packPixel packs the channels of p into a single integer.
+func packPixel(p Pixel) uint32 {
+	return uint32(p.Red)<<16 | uint32(p.Green)<<8 | uint32(p.Blue)
+}
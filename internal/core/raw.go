@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// defaultRawChannels is the channel order of raw output when none is given.
+const defaultRawChannels = "rgb"
+
+// parseChannels validates a raw channel order: the letters r, g and b once
+// each, in any order, and optionally a for alpha, such as rgb, bgr or argb.
+func parseChannels(order string) (string, error) {
+	order = strings.ToLower(order)
+	if len(order) != 3 && len(order) != 4 {
+		return "", fmt.Errorf("invalid channel order: %s (must be 3 or 4 of r, g, b and a)", order)
+	}
+	for _, c := range "rgb" {
+		if strings.Count(order, string(c)) != 1 {
+			return "", fmt.Errorf("invalid channel order: %s (must contain r, g and b once each)", order)
+		}
+	}
+	if len(order) == 4 && strings.Count(order, "a") != 1 {
+		return "", fmt.Errorf("invalid channel order: %s (the fourth channel must be a)", order)
+	}
+	return order, nil
+}
+
+// PixelOrders lists the channel orders of ToBytes and FromBytes.
+var PixelOrders = []string{"rgb", "bgr", "rgba", "bgra"}
+
+// ToBytes returns the pixels of b tightly packed in a new buffer, one byte
+// per channel in the given order, one of PixelOrders, along with the stride
+// of its rows. Rows go from the visual top down if topDown is set, and from
+// the bottom up as in a BMP file otherwise. The a channel is the alpha of the
+// image, or 255 for opaque images. ToBytes panics on any other order.
+func (b *BMPImage) ToBytes(order string, topDown bool) ([]byte, int) {
+	if !slices.Contains(PixelOrders, order) {
+		panic(fmt.Sprintf("core: ToBytes with pixel order %q", order))
+	}
+
+	height := len(b.Data)
+	stride := int(b.InfoHeader.Width) * len(order)
+	buf := make([]byte, stride*height)
+	for y, row := range b.Rows() {
+		n := y
+		if !topDown {
+			n = height - 1 - y
+		}
+		dst := buf[n*stride : (n+1)*stride]
+		i := 0
+		for x, p := range row {
+			for _, c := range order {
+				dst[i] = rawChannel(b, p, y, x, c)
+				i++
+			}
+		}
+	}
+	return buf, stride
+}
+
+// FromBytes is the reverse of ToBytes: it reads a w by h image tightly packed
+// in buf in the given order, rows from the top down if topDown is set, into a
+// new bottom-up image. The alpha channel, if any, is kept in Alpha unless
+// every pixel is opaque. An unknown order, or a buffer that isn't exactly
+// the size of the image, is an error of kind ErrInvalidParameter.
+func FromBytes(buf []byte, w, h int, order string, topDown bool) (*BMPImage, error) {
+	if !slices.Contains(PixelOrders, order) {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid pixel order: %s (must be one of %s)", order, strings.Join(PixelOrders, ", ")))
+	}
+	if w <= 0 || h <= 0 {
+		return nil, ErrNonPositiveDimensions
+	}
+	if want := w * h * len(order); len(buf) != want {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("buffer of %d bytes for a %dx%d %s image, want %d bytes", len(buf), w, h, order, want))
+	}
+	return readRaw(bytes.NewReader(buf), w, h, order, w*len(order), !topDown)
+}
+
+// EncodeRaw writes the pixels of image to w with no header, as a framebuffer
+// holds them: rows from the visual top, one byte per channel in the given
+// order, and every row padded with zeros to a multiple of align bytes. An
+// align of 1 means no padding. The a channel is the alpha of the image, or
+// 255 for opaque images. ReadRaw reads the data back given the same layout.
+func EncodeRaw(w io.Writer, image *BMPImage, channels string, align int) error {
+	width := int(image.InfoHeader.Width)
+	bw := bufio.NewWriter(w)
+
+	buf := getRowBuffer(alignedStride(width, 8*len(channels), align))
+	defer putRowBuffer(buf)
+	for y, row := range image.Rows() {
+		i := 0
+		for x, p := range row {
+			for _, c := range channels {
+				buf[i] = rawChannel(image, p, y, x, c)
+				i++
+			}
+		}
+		clear(buf[i:])
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// rawChannel returns channel c of pixel p at visual position (x, y).
+func rawChannel(image *BMPImage, p Pixel, y, x int, c rune) byte {
+	switch c {
+	case 'r':
+		return p.Red
+	case 'g':
+		return p.Green
+	case 'b':
+		return p.Blue
+	}
+	if image.Alpha == nil {
+		return 255
+	}
+	return image.Alpha[y][x]
+}
+
+// ReadRaw reads raw pixel data of the given dimensions, channel order and row
+// alignment, as written by EncodeRaw, into a new bottom-up image. The alpha
+// channel, if any, is kept in Alpha unless every pixel is opaque. Data that
+// ends early is an error wrapping ErrTruncatedData.
+func ReadRaw(r io.Reader, width, height int, channels string, align int) (*BMPImage, error) {
+	channels, err := parseChannels(channels)
+	if err != nil {
+		return nil, withKind(ErrInvalidParameter, err)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, ErrNonPositiveDimensions
+	}
+	if align < 1 {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid row alignment: %d", align))
+	}
+	return readRaw(r, width, height, channels, alignedStride(width, 8*len(channels), align), false)
+}
+
+// readRaw is ReadRaw for a validated layout with rows of stride bytes, which
+// go from the visual bottom up if bottomUp is set.
+func readRaw(r io.Reader, width, height int, channels string, stride int, bottomUp bool) (*BMPImage, error) {
+	image := NewImage(width, height)
+	alpha := make([][]byte, height)
+	opaque := true
+
+	buf := make([]byte, stride)
+	br := bufio.NewReader(r)
+	for n := range height {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("%w: row %d of %d: %v", ErrTruncatedData, n, height, err)
+		}
+		y := n
+		if bottomUp {
+			y = height - 1 - n
+		}
+		row := image.Data[y]
+		a := make([]byte, width)
+		i := 0
+		for x := range row {
+			a[x] = 255
+			for _, c := range channels {
+				switch c {
+				case 'r':
+					row[x].Red = buf[i]
+				case 'g':
+					row[x].Green = buf[i]
+				case 'b':
+					row[x].Blue = buf[i]
+				case 'a':
+					a[x] = buf[i]
+					opaque = opaque && buf[i] == 255
+				}
+				i++
+			}
+		}
+		alpha[y] = a
+	}
+
+	if !opaque {
+		image.Alpha = alpha
+	}
+	return image, nil
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestToBytesFromBytesRoundTrip(t *testing.T) {
+	for _, order := range PixelOrders {
+		for _, topDown := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/topdown=%v", order, topDown), func(t *testing.T) {
+				image := noiseImage(7, 4, 1)
+				if len(order) == 4 {
+					withAlpha(image)
+				}
+				buf, stride := image.ToBytes(order, topDown)
+				if stride != 7*len(order) || len(buf) != 4*stride {
+					t.Fatalf("%d bytes with stride %d, want stride %d", len(buf), stride, 7*len(order))
+				}
+
+				// The first bytes are the first pixel of the first row in
+				// the given order
+				y := 0
+				if !topDown {
+					y = 3
+				}
+				p := image.At(0, y)
+				for i, c := range order[:3] {
+					if want := map[rune]byte{'r': p.Red, 'g': p.Green, 'b': p.Blue}[c]; buf[i] != want {
+						t.Errorf("channel %c of the first pixel = %d, want %d", c, buf[i], want)
+					}
+				}
+
+				back, err := FromBytes(buf, 7, 4, order, topDown)
+				if err != nil {
+					t.Fatalf("FromBytes: %v", err)
+				}
+				if !gridsEqual(back.Data, image.Data) {
+					t.Error("the pixels changed")
+				}
+				if !gridsEqual(back.Alpha, image.Alpha) {
+					t.Error("the alpha changed")
+				}
+			})
+		}
+	}
+}
+
+func TestToBytesAlpha(t *testing.T) {
+	// Opaque images expand with 255, and narrowing drops the alpha
+	opaque := noiseImage(3, 2, 2)
+	buf, _ := opaque.ToBytes("bgra", true)
+	for i := 3; i < len(buf); i += 4 {
+		if buf[i] != 255 {
+			t.Fatalf("alpha of an opaque image = %d, want 255", buf[i])
+		}
+	}
+
+	image := withAlpha(noiseImage(3, 2, 2))
+	buf, _ = image.ToBytes("rgb", false)
+	back, err := FromBytes(buf, 3, 2, "rgb", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Alpha != nil || !gridsEqual(back.Data, image.Data) {
+		t.Error("narrowing to rgb didn't keep the pixels without the alpha")
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	buf := make([]byte, 6*5*3)
+	if _, err := FromBytes(buf, 6, 5, "argb", true); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("order argb: error %v, want ErrInvalidParameter", err)
+	}
+	if _, err := FromBytes(buf, 6, 5, "rgba", true); !errors.Is(err, ErrInvalidParameter) || !strings.Contains(err.Error(), "want 120 bytes") {
+		t.Errorf("short buffer: error %v, want ErrInvalidParameter naming 120 bytes", err)
+	}
+	if _, err := FromBytes(append(buf, 0), 6, 5, "rgb", true); err == nil {
+		t.Error("a buffer with a byte too many was accepted")
+	}
+	if _, err := FromBytes(nil, 0, 5, "rgb", true); err == nil {
+		t.Error("a zero width was accepted")
+	}
+}
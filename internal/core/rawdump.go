@@ -0,0 +1,141 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+	"github.com/ab-dauletkhan/bitmap/rawdesc"
+)
+
+// ParseExportRawArgs parses the export-raw command arguments: options, the
+// input file and the output file. It returns the channel order of the dump.
+func ParseExportRawArgs(args []string) (string, string, string, error) {
+	channels := defaultRawChannels
+
+	if len(args) < 2 {
+		return "", "", "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-2] {
+		switch {
+		case strings.HasPrefix(arg, "--channels="):
+			c, err := parseChannels(strings.TrimPrefix(arg, "--channels="))
+			if err != nil {
+				return "", "", "", withKind(ErrInvalidParameter, err)
+			}
+			channels = c
+		default:
+			return "", "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	return channels, args[len(args)-2], args[len(args)-1], nil
+}
+
+// ParseImportRawArgs parses the import-raw command arguments: options, the
+// raw input file and the output file. It returns the path of the descriptor.
+func ParseImportRawArgs(args []string) (string, string, string, error) {
+	var desc string
+
+	if len(args) < 2 {
+		return "", "", "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-2] {
+		switch {
+		case strings.HasPrefix(arg, "--desc="):
+			desc = strings.TrimPrefix(arg, "--desc=")
+		default:
+			return "", "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	if desc == "" {
+		return "", "", "", withKind(ErrInvalidParameter, fmt.Errorf("missing --desc option"))
+	}
+	return desc, args[len(args)-2], args[len(args)-1], nil
+}
+
+// ExportRaw writes the pixels of image to rawFile with EncodeRaw, rows from
+// the top with no padding, and their descriptor to rawdesc.Path(rawFile).
+// Both files are written atomically like Save.
+func ExportRaw(image *BMPImage, rawFile, channels string) error {
+	width := int(image.InfoHeader.Width)
+	desc := rawdesc.Descriptor{
+		Width:    width,
+		Height:   utils.Abs(int(image.InfoHeader.Height)),
+		Channels: channels,
+		Stride:   alignedStride(width, 8*len(channels), 1),
+		Origin:   rawdesc.OriginTopLeft,
+	}
+	data, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomic(rawFile)
+	if err != nil {
+		return ioError(err)
+	}
+	if err := EncodeRaw(f, image, channels, 1); err != nil {
+		f.Abort()
+		return ioError(err)
+	}
+	if err := f.Commit(); err != nil {
+		return ioError(err)
+	}
+
+	d, err := createAtomic(rawdesc.Path(rawFile))
+	if err != nil {
+		return ioError(err)
+	}
+	if _, err := d.Write(append(data, '\n')); err != nil {
+		d.Abort()
+		return ioError(err)
+	}
+	return ioError(d.Commit())
+}
+
+// ImportRaw reads the raw pixel dump in rawFile laid out as desc says. The
+// descriptor must be consistent, with a stride that holds a row of pixels,
+// and agree with the size of the file: Stride*Height bytes exactly. A
+// descriptor that doesn't is an error of kind ErrInvalidParameter.
+func ImportRaw(desc *rawdesc.Descriptor, rawFile string) (*BMPImage, error) {
+	channels, err := parseChannels(desc.Channels)
+	if err != nil {
+		return nil, withKind(ErrInvalidParameter, err)
+	}
+	if desc.Width <= 0 || desc.Height <= 0 {
+		return nil, ErrNonPositiveDimensions
+	}
+	if row := desc.Width * len(channels); desc.Stride < row {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("descriptor stride %d is shorter than a row of %d pixels of %d bytes", desc.Stride, desc.Width, len(channels)))
+	}
+	if desc.Origin != rawdesc.OriginTopLeft && desc.Origin != rawdesc.OriginBottomLeft {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid descriptor origin: %q (must be %s or %s)", desc.Origin, rawdesc.OriginTopLeft, rawdesc.OriginBottomLeft))
+	}
+
+	f, err := os.Open(rawFile)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, ioError(err)
+	}
+	if want := int64(desc.Stride) * int64(desc.Height); info.Size() != want {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("descriptor says %d rows of %d bytes, %d bytes in all, but %s has %d",
+			desc.Height, desc.Stride, want, rawFile, info.Size()))
+	}
+
+	image, err := readRaw(f, desc.Width, desc.Height, channels, desc.Stride, desc.Origin == rawdesc.OriginBottomLeft)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	return image, nil
+}
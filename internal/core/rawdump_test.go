@@ -0,0 +1,136 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/rawdesc"
+)
+
+func TestExportImportRawRoundTrip(t *testing.T) {
+	tests := []struct {
+		channels string
+		alpha    bool
+	}{
+		{"bgr", false},
+		{"rgb", false},
+		{"rgba", true},
+		{"abgr", true},
+	}
+
+	for _, tt := range tests {
+		for _, size := range [][2]int{{1, 1}, {5, 3}, {33, 17}} {
+			t.Run(fmt.Sprintf("%s/%dx%d", tt.channels, size[0], size[1]), func(t *testing.T) {
+				image := noiseImage(size[0], size[1], 1)
+				if tt.alpha {
+					withAlpha(image)
+				}
+				path := filepath.Join(t.TempDir(), "out.raw")
+				if err := ExportRaw(image, path, tt.channels); err != nil {
+					t.Fatalf("ExportRaw: %v", err)
+				}
+
+				desc, err := rawdesc.Read(rawdesc.Path(path))
+				if err != nil {
+					t.Fatalf("reading the descriptor: %v", err)
+				}
+				want := rawdesc.Descriptor{Width: size[0], Height: size[1], Channels: tt.channels, Stride: size[0] * len(tt.channels), Origin: rawdesc.OriginTopLeft}
+				if *desc != want {
+					t.Errorf("descriptor %+v, want %+v", *desc, want)
+				}
+
+				back, err := ImportRaw(desc, path)
+				if err != nil {
+					t.Fatalf("ImportRaw: %v", err)
+				}
+				if !gridsEqual(back.Data, image.Data) {
+					t.Error("the pixels changed")
+				}
+				if tt.alpha && !gridsEqual(back.Alpha, image.Alpha) {
+					t.Error("the alpha changed")
+				}
+			})
+		}
+	}
+}
+
+func TestImportRawLayouts(t *testing.T) {
+	image := noiseImage(5, 3, 2)
+	var rows [][]Pixel
+	for _, row := range image.Rows() {
+		rows = append(rows, row)
+	}
+
+	tests := []struct {
+		name   string
+		stride int
+		origin string
+	}{
+		{"padded rows", 16, rawdesc.OriginTopLeft},
+		{"bottom up", 15, rawdesc.OriginBottomLeft},
+		{"padded bottom up", 20, rawdesc.OriginBottomLeft},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Lay the rows out by hand, padding them with a marker byte
+			var data []byte
+			for i := range rows {
+				row := rows[i]
+				if tt.origin == rawdesc.OriginBottomLeft {
+					row = rows[len(rows)-1-i]
+				}
+				start := len(data)
+				for _, p := range row {
+					data = append(data, p.Blue, p.Green, p.Red)
+				}
+				for len(data)-start < tt.stride {
+					data = append(data, 0xee)
+				}
+			}
+			path := filepath.Join(t.TempDir(), "in.raw")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			back, err := ImportRaw(&rawdesc.Descriptor{Width: 5, Height: 3, Channels: "bgr", Stride: tt.stride, Origin: tt.origin}, path)
+			if err != nil {
+				t.Fatalf("ImportRaw: %v", err)
+			}
+			if !gridsEqual(back.Data, image.Data) {
+				t.Error("the pixels don't match")
+			}
+		})
+	}
+}
+
+func TestImportRawRejectsBadDescriptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.raw")
+	if err := os.WriteFile(path, make([]byte, 5*3*3), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		desc rawdesc.Descriptor
+		kind error
+	}{
+		{"stride longer than the blob allows", rawdesc.Descriptor{Width: 5, Height: 3, Channels: "bgr", Stride: 16, Origin: rawdesc.OriginTopLeft}, ErrInvalidParameter},
+		{"stride shorter than the blob", rawdesc.Descriptor{Width: 4, Height: 3, Channels: "bgr", Stride: 12, Origin: rawdesc.OriginTopLeft}, ErrInvalidParameter},
+		{"stride shorter than a row", rawdesc.Descriptor{Width: 5, Height: 3, Channels: "bgr", Stride: 14, Origin: rawdesc.OriginTopLeft}, ErrInvalidParameter},
+		{"bad channels", rawdesc.Descriptor{Width: 5, Height: 3, Channels: "bgx", Stride: 15, Origin: rawdesc.OriginTopLeft}, ErrInvalidParameter},
+		{"bad origin", rawdesc.Descriptor{Width: 5, Height: 3, Channels: "bgr", Stride: 15, Origin: "middle"}, ErrInvalidParameter},
+		{"no pixels", rawdesc.Descriptor{Width: 0, Height: 3, Channels: "bgr", Stride: 15, Origin: rawdesc.OriginTopLeft}, ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportRaw(&tt.desc, path); !errors.Is(err, tt.kind) {
+				t.Errorf("got error %v, want kind %v", err, tt.kind)
+			}
+		})
+	}
+}
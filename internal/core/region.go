@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Region limits a filter to part of the image. The filter runs on the whole
+// image, and the result is then blended with the original pixels by the
+// weight of every pixel in the region: 1 inside, 0 outside, and a linear ramp
+// across a band of Feather pixels centered on the boundary. Coordinates are
+// visual, from the top-left corner, and may extend past the image.
+type Region struct {
+	Shape string // "rect" or "ellipse"
+
+	X, Y, Width, Height int // Rectangle, with (X, Y) its top-left corner
+	CX, CY, RX, RY      int // Ellipse, centered on pixel (CX, CY) with radii RX and RY
+
+	Feather int // Width in pixels of the transition band; 0 for a hard edge
+}
+
+func (r *Region) String() string {
+	s := fmt.Sprintf("rect:%d:%d:%d:%d", r.X, r.Y, r.Width, r.Height)
+	if r.Shape == "ellipse" {
+		s = fmt.Sprintf("ellipse:%d:%d:%d:%d", r.CX, r.CY, r.RX, r.RY)
+	}
+	if r.Feather > 0 {
+		s += fmt.Sprintf(" feather %d", r.Feather)
+	}
+	return s
+}
+
+// regionShapes are the shapes accepted by --region.
+var regionShapes = []string{"rect", "ellipse"}
+
+// defaultFeather is the feathering of a region unless --feather is given: a
+// hard edge.
+const defaultFeather = 0
+
+// parseRegion parses a region value of the form rect:<x>:<y>:<w>:<h> or
+// ellipse:<cx>:<cy>:<rx>:<ry>.
+func parseRegion(value string) (*Region, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 5 || !slices.Contains(regionShapes, parts[0]) {
+		return nil, fmt.Errorf("invalid region option: %s (must be rect:<x>:<y>:<w>:<h> or ellipse:<cx>:<cy>:<rx>:<ry>)", value)
+	}
+
+	var v [4]int
+	for i, s := range parts[1:] {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid region value: %s", s)
+		}
+		v[i] = n
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return nil, fmt.Errorf("invalid region option: %s (sizes must be positive)", value)
+	}
+
+	if parts[0] == "rect" {
+		return &Region{Shape: "rect", X: v[0], Y: v[1], Width: v[2], Height: v[3]}, nil
+	}
+	return &Region{Shape: "ellipse", CX: v[0], CY: v[1], RX: v[2], RY: v[3]}, nil
+}
+
+// distance returns the signed distance in pixels from the center of pixel
+// (x, y) to the boundary of the region, negative inside. For ellipses it is
+// approximated to first order from the implicit equation, which is exact on
+// circles and accurate near the boundary, where the feathering needs it.
+func (r *Region) distance(x, y int) float64 {
+	if r.Shape == "rect" {
+		px, py := float64(x)+0.5, float64(y)+0.5
+		return max(float64(r.X)-px, px-float64(r.X+r.Width), float64(r.Y)-py, py-float64(r.Y+r.Height))
+	}
+
+	dx, dy := float64(x-r.CX), float64(y-r.CY)
+	rx, ry := float64(r.RX), float64(r.RY)
+	d := math.Sqrt(dx*dx/(rx*rx) + dy*dy/(ry*ry))
+	if d == 0 {
+		return -min(rx, ry)
+	}
+	gradient := math.Hypot(dx/(rx*rx), dy/(ry*ry)) / d
+	return (d - 1) / gradient
+}
+
+// weight returns how much of the filtered pixel (x, y) is kept, in [0, 1].
+func (r *Region) weight(x, y int) float64 {
+	sd := r.distance(x, y)
+	if r.Feather == 0 {
+		if sd <= 0 {
+			return 1
+		}
+		return 0
+	}
+	return clamp01(0.5 - sd/float64(r.Feather))
+}
+
+// blend mixes the filtered image with before, its pixels prior to
+// filtering, by the weight of every pixel in the region.
+func (r *Region) blend(image, before *BMPImage) {
+	blendWeighted(image, before, r.weight)
+}
+
+// blendWeighted mixes the filtered image with before, its pixels prior to
+// filtering, keeping the fraction weight(x, y) of the filtered pixel at
+// (x, y) of the visual image. Widened images are mixed at 16 bits.
+func blendWeighted(image, before *BMPImage, weight func(x, y int) float64) {
+	for y := range image.Data {
+		for x := range image.Data[y] {
+			w := weight(x, y)
+			if w == 1 {
+				continue
+			}
+			if image.Wide != nil {
+				f, o := &image.Wide[y][x], before.Wide[y][x]
+				mix := func(f, o uint16) uint16 { return clampRound16(float64(o) + (float64(f)-float64(o))*w) }
+				f.Blue, f.Green, f.Red = mix(f.Blue, o.Blue), mix(f.Green, o.Green), mix(f.Red, o.Red)
+			} else {
+				f, o := &image.Data[y][x], before.Data[y][x]
+				mix := func(f, o byte) byte { return clampRound(float64(o) + (float64(f)-float64(o))*w) }
+				f.Blue, f.Green, f.Red = mix(f.Blue, o.Blue), mix(f.Green, o.Green), mix(f.Red, o.Red)
+			}
+		}
+	}
+}
+
+// filterRegion runs a filter limited to opts.Region.
+func filterRegion(image *BMPImage, opts FilterOptions) error {
+	before := image.Clone()
+	region := opts.Region
+	opts.Region = nil
+	if err := Filter(image, opts); err != nil {
+		return err
+	}
+	region.blend(image, before)
+	return nil
+}
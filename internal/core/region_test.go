@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// featheredRow returns the values of a black row of width pixels after
+// negative runs limited to its first edge pixels, feathered by feather. The
+// region reaches far past the other sides of the row, so that only its
+// right side is feathered.
+func featheredRow(t *testing.T, width, edge, feather int) []int {
+	t.Helper()
+	args := []string{fmt.Sprintf("--region=rect:-50:-50:%d:101", edge+50), fmt.Sprintf("--feather=%d", feather), "--filter=negative", "in.bmp", "out.bmp"}
+	transforms, _, _, err := ParseTransformations(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := NewImage(width, 1)
+	if err := ApplyTransformations(image, transforms); err != nil {
+		t.Fatal(err)
+	}
+	return grayValues(image)
+}
+
+func TestFeatherBand(t *testing.T) {
+	for _, feather := range []int{2, 4, 10} {
+		values := featheredRow(t, 40, 20, feather)
+
+		// Every pixel center within feather/2 of the boundary is blended,
+		// and the weight falls steadily from inside to outside
+		band := 0
+		for x, v := range values {
+			if v != 0 && v != 255 {
+				band++
+			}
+			if x > 0 && v > values[x-1] {
+				t.Errorf("feather %d: %d at x=%d rises from %d", feather, v, x, values[x-1])
+			}
+		}
+		if band != feather {
+			t.Errorf("feather %d blends %d pixels: %v", feather, band, values)
+		}
+		if values[20-feather/2-1] != 255 || values[20+feather/2] != 0 {
+			t.Errorf("feather %d: the band is not centered on the boundary: %v", feather, values)
+		}
+	}
+
+	// A linear ramp, 255 times 0.5 - (x+0.5-20)/10
+	want := []int{242, 217, 191, 166, 140, 115, 89, 64, 38, 13}
+	if got := featheredRow(t, 40, 20, 10)[15:25]; !slices.Equal(got, want) {
+		t.Errorf("feather 10 gives %v across the band, want %v", got, want)
+	}
+
+	// Without feathering the edge is hard
+	values := featheredRow(t, 40, 20, 0)
+	if values[19] != 255 || values[20] != 0 {
+		t.Errorf("feather 0 gives %v", values)
+	}
+}
+
+func TestFeatherEllipseFalloff(t *testing.T) {
+	transforms, _, _, err := ParseTransformations([]string{"--region=ellipse:20:20:10:10", "--feather=6", "--filter=negative", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := NewImage(41, 41)
+	if err := ApplyTransformations(image, transforms); err != nil {
+		t.Fatal(err)
+	}
+
+	// Along every direction out of the center, the weight never rises and
+	// reaches 0 past the band
+	for _, dir := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {-1, 1}} {
+		prev := 256
+		for i := 0; ; i++ {
+			x, y := 20+i*dir[0], 20+i*dir[1]
+			if x < 0 || x > 40 || y < 0 || y > 40 {
+				break
+			}
+			v := int(image.Data[y][x].Red)
+			if v > prev {
+				t.Fatalf("direction %v: %d at (%d, %d) rises from %d", dir, v, x, y, prev)
+			}
+			prev = v
+		}
+		if prev != 0 {
+			t.Errorf("direction %v ends at %d past the band", dir, prev)
+		}
+	}
+	if image.Data[20][20].Red != 255 || image.Data[20][27].Red != 255 || image.Data[20][33].Red != 0 {
+		t.Errorf("the band doesn't span radii 7 to 13: %v", image.Data[20][26:34])
+	}
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FilterFunc implements a filter added with RegisterFilter. It modifies the
+// 8-bit pixels of image in place, and gets the parameters of the filter by
+// name, with the defaults of the ones not given filled in. Optional
+// parameters without a default are missing from params when not given.
+type FilterFunc func(image *BMPImage, params map[string]string) error
+
+// registeredFilter is a filter added with RegisterFilter.
+type registeredFilter struct {
+	params []ParamSchema
+	fn     FilterFunc
+}
+
+var (
+	registryMu        sync.RWMutex
+	registeredFilters = map[string]registeredFilter{}
+)
+
+// RegisterFilter adds a filter that --filter=name[:param...] runs with fn,
+// whose parameters, in order, are described by params. The arguments are
+// checked against params like those of the built-in filters, and the
+// filter is listed by bitmap capabilities and bitmap help along with them.
+// It takes the opacity suffix and --region too. Widened images are narrowed
+// to 8 bits for it.
+//
+// Names must not contain ':', '=' or ',', nor be those of built-in or
+// already registered filters. It is meant to be called from an init
+// function, before any pipeline is parsed. Programs embedding bitmap call
+// it through package bmp.
+func RegisterFilter(name string, params []ParamSchema, fn FilterFunc) error {
+	switch {
+	case name == "" || strings.ContainsAny(name, ":=,"):
+		return withKind(ErrInvalidParameter, fmt.Errorf("invalid filter name: %q", name))
+	case slices.Contains(FilterNames, name):
+		return withKind(ErrInvalidParameter, fmt.Errorf("filter %s is built in", name))
+	case fn == nil:
+		return withKind(ErrInvalidParameter, fmt.Errorf("filter %s has no function", name))
+	}
+	for _, p := range params {
+		if !slices.Contains([]string{ParamInt, ParamFloat, ParamEnum, ParamPoints}, p.Type) {
+			return withKind(ErrInvalidParameter, fmt.Errorf("parameter %s of filter %s has unknown type %q", p.Name, name, p.Type))
+		}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registeredFilters[name]; ok {
+		return withKind(ErrInvalidParameter, fmt.Errorf("filter %s is already registered", name))
+	}
+	registeredFilters[name] = registeredFilter{params: slices.Clone(params), fn: fn}
+	return nil
+}
+
+// lookupFilter returns the registered filter of the given name.
+func lookupFilter(name string) (registeredFilter, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	f, ok := registeredFilters[name]
+	return f, ok
+}
+
+// registeredFilterNames returns the names of the registered filters, sorted.
+func registeredFilterNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Sorted(maps.Keys(registeredFilters))
+}
+
+// filterNames returns the names of the built-in filters followed by those
+// of the registered ones.
+func filterNames() []string {
+	return append(slices.Clone(FilterNames), registeredFilterNames()...)
+}
+
+// parse checks args against the parameters of the filter and returns them
+// by name, filling in the defaults of those not given.
+func (f registeredFilter) parse(name string, args []string) (map[string]string, error) {
+	if len(args) > len(f.params) {
+		return nil, fmt.Errorf("filter %s takes at most %d parameters", name, len(f.params))
+	}
+	values := make(map[string]string)
+	for i, p := range f.params {
+		if i >= len(args) {
+			if !p.Optional {
+				return nil, fmt.Errorf("filter %s is missing its %s parameter", name, p.Name)
+			}
+			if p.Default != "" {
+				values[p.Name] = p.Default
+			}
+			continue
+		}
+		if err := p.check(args[i]); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", name, p.Name, err)
+		}
+		values[p.Name] = args[i]
+	}
+	return values, nil
+}
+
+// check returns an error if value is not within the schema.
+func (p ParamSchema) check(value string) error {
+	var v float64
+	switch p.Type {
+	case ParamEnum:
+		if !slices.Contains(p.Values, value) {
+			return fmt.Errorf("%s (must be one of %s)", value, strings.Join(p.Values, ", "))
+		}
+		return nil
+	case ParamPoints:
+		_, _, err := parseCurveArgs([]string{"rgb", value})
+		return err
+	case ParamInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s (must be an integer)", value)
+		}
+		v = float64(n)
+	case ParamFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s (must be a number)", value)
+		}
+		v = f
+	}
+	if p.Min != nil && (v < *p.Min || p.MinExclusive && v == *p.Min) || p.Max != nil && (v > *p.Max || p.MaxExclusive && v == *p.Max) {
+		return fmt.Errorf("%s (out of range)", value)
+	}
+	return nil
+}
+
+// exampleArg returns a value within the schema of p, for examples.
+func exampleArg(p ParamSchema) string {
+	switch {
+	case p.Default != "":
+		return p.Default
+	case p.Type == ParamEnum:
+		return p.Values[0]
+	case p.Type == ParamPoints:
+		return "0/0,128/100,255/255"
+	}
+	v := 1.0
+	if p.Min != nil {
+		v = *p.Min
+		if p.MinExclusive {
+			v += 0.5
+		}
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// registeredHelpTopic returns the help topic of a registered filter, made
+// from the schema of its parameters.
+func registeredHelpTopic(name string) (HelpTopic, bool) {
+	f, ok := lookupFilter(name)
+	if !ok {
+		return HelpTopic{}, false
+	}
+
+	syntax, example := "--filter="+name, "--filter="+name
+	var defaults []string
+	for _, p := range f.params {
+		if p.Optional {
+			syntax += "[:<" + p.Name + ">]"
+		} else {
+			syntax += ":<" + p.Name + ">"
+		}
+		example += ":" + exampleArg(p)
+		if p.Default != "" {
+			defaults = append(defaults, p.Name+" = "+p.Default)
+		}
+	}
+	return HelpTopic{
+		Name:    name,
+		Syntax:  syntax,
+		Summary: "A filter registered by the program embedding this tool.",
+		Default: strings.Join(defaults, ", "),
+		Examples: [2]string{
+			"bitmap apply " + example + " in.bmp out.bmp",
+			"bitmap apply " + example + ":opacity=50 in.bmp out.bmp",
+		},
+	}, true
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// errTestFilter is returned by the test filter when asked to fail.
+var errTestFilter = errors.New("test filter failed")
+
+// registerTestFilter registers "test-fill", which fills the image with the
+// gray level given as its first parameter, or fails if its mode is "fail".
+var registerTestFilter = sync.OnceValue(func() error {
+	params := []ParamSchema{
+		{Name: "level", Type: ParamInt, Min: bound(0), Max: bound(255)},
+		{Name: "mode", Type: ParamEnum, Values: []string{"ok", "fail"}, Default: "ok", Optional: true},
+	}
+	return RegisterFilter("test-fill", params, func(image *BMPImage, params map[string]string) error {
+		if params["mode"] == "fail" {
+			return errTestFilter
+		}
+		level, _ := strconv.Atoi(params["level"])
+		for _, row := range image.Data {
+			for x := range row {
+				row[x] = Pixel{Blue: byte(level), Green: byte(level), Red: byte(level)}
+			}
+		}
+		return nil
+	})
+})
+
+func TestRegisterFilterRuns(t *testing.T) {
+	if err := registerTestFilter(); err != nil {
+		t.Fatalf("RegisterFilter: %v", err)
+	}
+
+	transforms, _, _, err := ParseTransformations([]string{"--filter=test-fill:200", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatalf("ParseTransformations: %v", err)
+	}
+	image := noiseImage(4, 3, 1)
+	if err := ApplyTransformations(image, transforms); err != nil {
+		t.Fatalf("ApplyTransformations: %v", err)
+	}
+	if p := image.At(2, 1); p != (Pixel{200, 200, 200}) {
+		t.Errorf("pixel = %v, want gray 200", p)
+	}
+
+	// Widened images are narrowed for it, and its errors stop the pipeline
+	image.Widen()
+	if err := Filter(image, FilterOptions{FilterType: "test-fill", Args: []string{"10"}}); err != nil || image.Wide[0][0] != WidenPixel(Pixel{10, 10, 10}) {
+		t.Errorf("widened: %v, pixel %v", err, image.Wide[0][0])
+	}
+	transforms, _, _, _ = ParseTransformations([]string{"--filter=test-fill:1:fail", "in.bmp", "out.bmp"})
+	if err := ApplyTransformations(image, transforms); !errors.Is(err, errTestFilter) {
+		t.Errorf("failing filter: %v, want its error", err)
+	}
+}
+
+func TestRegisterFilterChecksArguments(t *testing.T) {
+	if err := registerTestFilter(); err != nil {
+		t.Fatalf("RegisterFilter: %v", err)
+	}
+
+	for _, value := range []string{"test-fill", "test-fill:256", "test-fill:x", "test-fill:1:maybe", "test-fill:1:ok:3"} {
+		if _, err := parseFilterOptions(value); err == nil {
+			t.Errorf("%s accepted", value)
+		}
+	}
+	if _, err := parseFilterOptions("test-fill:1:ok:opacity=50"); err != nil {
+		t.Errorf("opacity suffix rejected: %v", err)
+	}
+}
+
+func TestRegisterFilterRejectsCollisions(t *testing.T) {
+	if err := registerTestFilter(); err != nil {
+		t.Fatalf("RegisterFilter: %v", err)
+	}
+
+	noop := func(*BMPImage, map[string]string) error { return nil }
+	for _, name := range []string{"blur", "test-fill", "", "a:b"} {
+		if err := RegisterFilter(name, nil, noop); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("RegisterFilter(%q): %v, want an ErrInvalidParameter", name, err)
+		}
+	}
+	if err := RegisterFilter("bad-param", []ParamSchema{{Name: "x", Type: "color"}}, noop); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("unknown parameter type: %v, want an ErrInvalidParameter", err)
+	}
+}
+
+func TestRegisteredFilterListed(t *testing.T) {
+	if err := registerTestFilter(); err != nil {
+		t.Fatalf("RegisterFilter: %v", err)
+	}
+
+	filters := GetCapabilities().Filters
+	i := slices.IndexFunc(filters, func(f FilterCapability) bool { return f.Name == "test-fill" })
+	if i < 0 || len(filters[i].Params) != 2 {
+		t.Fatalf("capabilities list %v", filters)
+	}
+	topic, ok := FindHelpTopic("test-fill")
+	if !ok || topic.Syntax != "--filter=test-fill:<level>[:<mode>]" || topic.Default != "mode = ok" {
+		t.Errorf("help topic %+v", topic)
+	}
+	if !slices.Contains(helpTopicNames(), "test-fill") {
+		t.Error("missing from the help topics")
+	}
+}
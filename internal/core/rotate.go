@@ -5,27 +5,46 @@ package core
 // - A value of -1 rotates the image 90 degrees to the left (counterclockwise).
 // - Any other value rotates the image 90 degrees to the right (clockwise).
 // The function updates the image's width and height in the DIB header after rotation.
+// Rotated is the form that leaves the image as it is.
 func Rotate(image *BMPImage, direction int) {
-	h := len(image.Data)
-	w := len(image.Data[0])
+	*image = *rotated(image, direction)
+}
 
-	// Create a new 2D slice for the rotated image data with swapped width and height
-	rotatedData := make([][]Pixel, w)
+// rotated returns a copy of image rotated 90 degrees in the given direction.
+// rotateGrid builds new grids, so the source is left untouched.
+func rotated(image *BMPImage, direction int) *BMPImage {
+	r := &BMPImage{Header: image.Header, InfoHeader: image.InfoHeader, HeaderExtra: image.HeaderExtra, ICCProfile: image.ICCProfile, Comments: image.Comments}
+	r.InfoHeader.Width, r.InfoHeader.Height = int32(len(image.Data)), int32(len(image.Data[0]))
+	// The row order of the file is kept
+	if image.InfoHeader.Height < 0 {
+		r.InfoHeader.Height = -r.InfoHeader.Height
+	}
+	r.Data = rotateGrid(image.Data, direction)
+	if image.Alpha != nil {
+		r.Alpha = rotateGrid(image.Alpha, direction)
+	}
+	if image.Wide != nil {
+		r.Wide = rotateGrid(image.Wide, direction)
+	}
+	return r
+}
+
+// rotateGrid returns a copy of data rotated 90 degrees in the given direction.
+func rotateGrid[T any](data [][]T, direction int) [][]T {
+	h := len(data)
+	w := len(data[0])
+
+	// Create a new 2D slice for the rotated data with swapped width and height
+	rotated := make([][]T, w)
 	for i := 0; i < w; i++ {
-		rotatedData[i] = make([]Pixel, h)
+		rotated[i] = make([]T, h)
 		for j := 0; j < h; j++ {
 			if direction == -1 { // to the left (counterclockwise)
-				rotatedData[i][j] = image.Data[h-1-j][i]
+				rotated[i][j] = data[j][w-1-i]
 			} else { // to the right (clockwise)
-				rotatedData[i][j] = image.Data[j][w-1-i]
+				rotated[i][j] = data[h-1-j][i]
 			}
 		}
 	}
-
-	// Update the BMP image headers to reflect the new dimensions after rotation
-	image.InfoHeader.Height = int32(w)
-	image.InfoHeader.Width = int32(h)
-
-	// Replace the original pixel data with the rotated data
-	image.Data = rotatedData
+	return rotated
 }
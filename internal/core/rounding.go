@@ -0,0 +1,21 @@
+package core
+
+import "math"
+
+// clampRound rounds v half away from zero to the nearest byte, clamping it
+// into [0, 255]. It is the final quantization of every filter computing in
+// floating point; see the package documentation.
+func clampRound(v float64) byte {
+	return byte(min(max(math.Round(v), 0), 255))
+}
+
+// clampRound16 is clampRound for 16-bit channels, clamping into [0, 65535].
+func clampRound16(v float64) uint16 {
+	return uint16(min(max(math.Round(v), 0), 65535))
+}
+
+// divRound returns sum/n rounded half away from zero, for averages of
+// channel values, whose sum is never negative.
+func divRound[T int | int64 | uint64](sum, n T) T {
+	return (sum + n/2) / n
+}
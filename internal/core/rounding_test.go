@@ -0,0 +1,166 @@
+package core
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClampRound(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want byte
+	}{
+		{-3, 0},
+		{-0.5, 0},
+		{0.49, 0},
+		{0.5, 1},
+		{127.5, 128},
+		{254.5, 255},
+		{300, 255},
+	}
+	for _, tt := range tests {
+		if got := clampRound(tt.v); got != tt.want {
+			t.Errorf("clampRound(%v) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+	if got := clampRound16(65534.5); got != 65535 {
+		t.Errorf("clampRound16(65534.5) = %d, want 65535", got)
+	}
+	if got := clampRound16(70000); got != 65535 {
+		t.Errorf("clampRound16(70000) = %d, want 65535", got)
+	}
+
+	for _, tt := range []struct{ sum, n, want int }{{5, 2, 3}, {7, 3, 2}, {8, 3, 3}, {0, 4, 0}} {
+		if got := divRound(tt.sum, tt.n); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tt.sum, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLuminanceKeepsGrays(t *testing.T) {
+	// The Rec. 709 weights add up to 1 in theory only: truncating made
+	// some grays a level darker
+	for v := range 256 {
+		if got := luminance(Pixel{Blue: byte(v), Green: byte(v), Red: byte(v)}); got != byte(v) {
+			t.Errorf("luminance of gray %d = %d", v, got)
+		}
+	}
+}
+
+// TestFiltersRoundHalfWay checks the filters that average or rescale
+// channel values on inputs whose exact result lies half-way between two
+// levels, where rounding gives the level above and truncating the one below.
+// The gray rows are given as 8-bit values, or as 16-bit values with wide.
+func TestFiltersRoundHalfWay(t *testing.T) {
+	tests := []struct {
+		filter   string
+		size     int // --pixelate-size
+		wide     bool
+		in, want []uint16
+	}{
+		{"pixelate", 2, false, []uint16{0, 1}, []uint16{1, 1}},
+		{"pixelate", 2, true, []uint16{0, 1}, []uint16{1, 1}},
+		{"blur:1:shrink", 0, false, []uint16{0, 1}, []uint16{1, 1}},
+		{"blur:1:shrink", 0, true, []uint16{0, 1}, []uint16{1, 1}},
+		{"levels:0:2", 0, false, []uint16{0, 1, 2}, []uint16{0, 128, 255}},
+		{"levels:0:2", 0, true, []uint16{0, 257, 514}, []uint16{0, 32768, 65535}},
+		{"autocontrast:0", 0, false, []uint16{0, 1, 2}, []uint16{0, 128, 255}},
+		{"autocontrast:0", 0, true, []uint16{0, 257, 514}, []uint16{0, 32768, 65535}},
+		{"kuwahara:1", 0, false, []uint16{0, 1}, []uint16{1, 1}},
+	}
+
+	for _, tt := range tests {
+		name := strings.ReplaceAll(tt.filter, ":", "_")
+		if tt.wide {
+			name += "_16bit"
+		}
+		t.Run(name, func(t *testing.T) {
+			opts, err := parseFilterOptions(tt.filter)
+			if err != nil {
+				t.Fatalf("%s rejected: %v", tt.filter, err)
+			}
+			opts.PixelateSize = tt.size
+
+			image := NewImage(len(tt.in), 1)
+			if tt.wide {
+				image.Widen()
+			}
+			for x, v := range tt.in {
+				if tt.wide {
+					image.Wide[0][x] = Pixel16{Blue: v, Green: v, Red: v}
+				} else {
+					image.Data[0][x] = Pixel{Blue: byte(v), Green: byte(v), Red: byte(v)}
+				}
+			}
+			if err := Filter(image, opts); err != nil {
+				t.Fatalf("Filter: %v", err)
+			}
+
+			got := make([]uint16, len(tt.in))
+			for x := range got {
+				if tt.wide {
+					got[x] = image.Wide[0][x].Red
+				} else {
+					got[x] = uint16(image.Data[0][x].Red)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%v gives %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNegativeInvolution checks that negative is its own inverse on every
+// pixel, at both precisions: it is exact, so nothing may be lost to rounding.
+func TestNegativeInvolution(t *testing.T) {
+	opts, err := parseFilterOptions("negative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	negate := func(t *testing.T, image *BMPImage) {
+		t.Helper()
+		if err := Filter(image, opts); err != nil {
+			t.Fatalf("Filter: %v", err)
+		}
+	}
+
+	t.Run("8bit", func(t *testing.T) {
+		image := noiseImage(16, 16, 1)
+		image.Data[0][0] = Pixel{}
+		image.Data[0][1] = Pixel{Blue: 255, Green: 255, Red: 255}
+		want := image.Clone()
+		negate(t, image)
+		if got := image.Data[0][0]; got != (Pixel{Blue: 255, Green: 255, Red: 255}) {
+			t.Fatalf("negative of black is %v", got)
+		}
+		negate(t, image)
+		if x, y, same := firstDifference(image, want); !same {
+			t.Errorf("pixel (%d, %d) is %v, was %v", x, y, image.At(x, y), want.At(x, y))
+		}
+	})
+
+	t.Run("16bit", func(t *testing.T) {
+		image := NewImage(16, 16)
+		image.Widen()
+		for y, row := range image.Wide {
+			for x := range row {
+				v := uint16((y*16 + x) * 257)
+				row[x] = Pixel16{Blue: v, Green: v + 1, Red: 65535 - v}
+			}
+		}
+		want := slices.Clone(image.Wide)
+		for y := range want {
+			want[y] = slices.Clone(want[y])
+		}
+		negate(t, image)
+		if got := image.Wide[0][0]; got != (Pixel16{Blue: 65535, Green: 65534, Red: 0}) {
+			t.Fatalf("negative of %v is %v", want[0][0], got)
+		}
+		negate(t, image)
+		if !gridsEqual(image.Wide, want) {
+			t.Error("negative applied twice changed 16-bit pixels")
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// rowIndexMagic starts a row index file. It is followed by the width and
+// height of the image and the CRC-32 of each of its rows, from the visual top
+// down, all as little-endian uint32s.
+const rowIndexMagic = "BMRI"
+
+// RowIndex holds the CRC-32 of every row of an image, which tells two images
+// apart row by row without holding either of them in memory.
+type RowIndex struct {
+	Width, Height int
+	Rows          []uint32 // CRC-32 of each row, from the visual top down
+}
+
+// ParseRowHashArgs parses the rowhash command arguments: the BMP file to
+// index and, optionally, the index file to write.
+func ParseRowHashArgs(args []string) (string, string, error) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			return "", "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+	switch len(args) {
+	case 1:
+		return args[0], "", nil
+	case 2:
+		return args[0], args[1], nil
+	}
+	return "", "", ErrIncorrectArgument
+}
+
+// HashRow returns the CRC-32 (IEEE) of the blue, green and red channels of
+// the pixels of row, in that order and without padding, so that rows of the
+// same pixels hash the same whatever the bit depth and stride of their file.
+func HashRow(row []Pixel) uint32 {
+	return crc32.ChecksumIEEE(appendRowBytes(nil, row))
+}
+
+// appendRowBytes appends the channels HashRow hashes to dst.
+func appendRowBytes(dst []byte, row []Pixel) []byte {
+	for _, p := range row {
+		dst = append(dst, p.Blue, p.Green, p.Red)
+	}
+	return dst
+}
+
+// HashRows returns the row index of the BMP file read from r. The rows are
+// streamed through a BMPReader, so only one of them is held at a time.
+func HashRows(r io.Reader) (*RowIndex, error) {
+	br, err := NewBMPReader(r)
+	if err != nil {
+		return nil, err
+	}
+	width, height := int(br.Image.InfoHeader.Width), utils.Abs(int(br.Image.InfoHeader.Height))
+	index := &RowIndex{Width: width, Height: height, Rows: make([]uint32, height)}
+
+	row := make([]Pixel, width)
+	var buf []byte
+	for n := range height {
+		if err := br.ReadRow(row); err != nil {
+			return nil, err
+		}
+		// Rows come in file order, bottom-up for a positive height
+		y := n
+		if br.Image.InfoHeader.Height > 0 {
+			y = height - 1 - n
+		}
+		buf = appendRowBytes(buf[:0], row)
+		index.Rows[y] = crc32.ChecksumIEEE(buf)
+	}
+	return index, nil
+}
+
+// WriteRowIndex writes index to w in the row index file format.
+func WriteRowIndex(w io.Writer, index *RowIndex) error {
+	b := make([]byte, 12+4*len(index.Rows))
+	copy(b, rowIndexMagic)
+	binary.LittleEndian.PutUint32(b[4:], uint32(index.Width))
+	binary.LittleEndian.PutUint32(b[8:], uint32(index.Height))
+	for i, crc := range index.Rows {
+		binary.LittleEndian.PutUint32(b[12+4*i:], crc)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadRowIndex reads a row index file written by WriteRowIndex from r. The
+// rows are read one at a time, so a file claiming more than it holds is
+// rejected with ErrCorruptFile before they are all allocated.
+func ReadRowIndex(r io.Reader) (*RowIndex, error) {
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:4]) != rowIndexMagic {
+		return nil, withKind(ErrCorruptFile, errors.New("not a row index file"))
+	}
+	index := &RowIndex{Width: int(binary.LittleEndian.Uint32(head[4:])), Height: int(binary.LittleEndian.Uint32(head[8:]))}
+
+	br := bufio.NewReader(r)
+	crc := make([]byte, 4)
+	for range index.Height {
+		if _, err := io.ReadFull(br, crc); err != nil {
+			return nil, withKind(ErrCorruptFile, fmt.Errorf("row index file cut short after %d of %d rows", len(index.Rows), index.Height))
+		}
+		index.Rows = append(index.Rows, binary.LittleEndian.Uint32(crc))
+	}
+	return index, nil
+}
+
+// IsRowIndexFile reports whether the file at path is a row index file. Files
+// that can't be read aren't.
+func IsRowIndexFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(rowIndexMagic))
+	_, err = io.ReadFull(f, magic)
+	return err == nil && string(magic) == rowIndexMagic
+}
+
+// LoadRowIndex returns the row index of the file at path: the one it holds if
+// it is a row index file, or else the one HashRows computes from the BMP
+// file, streaming its rows.
+func LoadRowIndex(path string) (*RowIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if magic, _ := r.Peek(len(rowIndexMagic)); string(magic) == rowIndexMagic {
+		return ReadRowIndex(r)
+	}
+	return HashRows(r)
+}
+
+// SaveRowIndex atomically writes index to the file at path.
+func SaveRowIndex(index *RowIndex, path string) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return ioError(err)
+	}
+	if err := WriteRowIndex(f, index); err != nil {
+		f.Abort()
+		return ioError(err)
+	}
+	return ioError(f.Commit())
+}
+
+// PrintRowIndex prints the dimensions of index and the CRC-32 of each row,
+// one per line after its number.
+func PrintRowIndex(w io.Writer, index *RowIndex) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%dx%d\n", index.Width, index.Height)
+	for y, crc := range index.Rows {
+		fmt.Fprintf(bw, "%d %08x\n", y, crc)
+	}
+	return bw.Flush()
+}
+
+// DiffRows returns the numbers of the rows whose CRC-32 differs between a and
+// b, in increasing order. Indexes of images of different dimensions return
+// ErrDimensionMismatch.
+func DiffRows(a, b *RowIndex) ([]int, error) {
+	if a.Width != b.Width || a.Height != b.Height {
+		return nil, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, a.Width, a.Height, b.Width, b.Height)
+	}
+	var rows []int
+	for y := range a.Rows {
+		if a.Rows[y] != b.Rows[y] {
+			rows = append(rows, y)
+		}
+	}
+	return rows, nil
+}
+
+// PrintRowDiff prints the rows DiffRows found to differ out of height, runs
+// of consecutive rows as ranges.
+func PrintRowDiff(w io.Writer, rows []int, height int) {
+	if len(rows) == 0 {
+		fmt.Fprintf(w, "Images are equal (all %d rows match)\n", height)
+		return
+	}
+
+	var ranges []string
+	for i := 0; i < len(rows); {
+		j := i
+		for j+1 < len(rows) && rows[j+1] == rows[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(rows[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", rows[i], rows[j]))
+		}
+		i = j + 1
+	}
+	fmt.Fprintf(w, "Images differ: %d of %d rows\n", len(rows), height)
+	fmt.Fprintf(w, "Rows: %s\n", strings.Join(ranges, ", "))
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCompareByRowNamesChangedRow(t *testing.T) {
+	dir := t.TempDir()
+	original := noiseImage(40, 30, 1)
+	path := filepath.Join(dir, "original.bmp")
+	if err := SaveBMP(original, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The copy is a top-down 32-bit file, which only its pixels are compared by
+	changed := topDown(original.Clone())
+	changed.Data[17][23].Green ^= 1
+	copyPath := filepath.Join(dir, "copy.bmp")
+	if err := Save(changed, copyPath, SaveOptions{Format: FormatBMP32}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := LoadRowIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadRowIndex(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y, row := range original.Rows() {
+		if a.Rows[y] != HashRow(row) {
+			t.Fatalf("row %d: streamed digest %08x, HashRow %08x", y, a.Rows[y], HashRow(row))
+		}
+	}
+	rows, err := DiffRows(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rows, []int{17}) {
+		t.Errorf("differing rows %v, want [17]", rows)
+	}
+
+	// The same through index files, and with one of them against a BMP file
+	indexPath := filepath.Join(dir, "copy.rows")
+	if err := SaveRowIndex(b, indexPath); err != nil {
+		t.Fatal(err)
+	}
+	if !IsRowIndexFile(indexPath) || IsRowIndexFile(path) {
+		t.Error("IsRowIndexFile doesn't tell the index from the BMP file")
+	}
+	if info, err := os.Stat(indexPath); err != nil || info.Size() != 12+4*30 {
+		t.Errorf("index file: %v, %v", info, err)
+	}
+	fromFile, err := LoadRowIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := DiffRows(a, fromFile); err != nil || !slices.Equal(rows, []int{17}) {
+		t.Errorf("against the index file: rows %v, %v", rows, err)
+	}
+
+	var out bytes.Buffer
+	PrintRowDiff(&out, rows, a.Height)
+	if want := "Images differ: 1 of 30 rows\nRows: 17\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestDiffRowsMismatch(t *testing.T) {
+	a := &RowIndex{Width: 4, Height: 2, Rows: []uint32{1, 2}}
+	b := &RowIndex{Width: 5, Height: 2, Rows: []uint32{1, 2}}
+	if _, err := DiffRows(a, b); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("got %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestPrintRowDiffRanges(t *testing.T) {
+	var out bytes.Buffer
+	PrintRowDiff(&out, []int{0, 1, 2, 5, 7, 8}, 10)
+	if want := "Images differ: 6 of 10 rows\nRows: 0-2, 5, 7-8\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	PrintRowDiff(&out, nil, 10)
+	if want := "Images are equal (all 10 rows match)\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestReadRowIndexRejectsMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteRowIndex(&buf, &RowIndex{Width: 3, Height: 4, Rows: []uint32{1, 2, 3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	index, err := ReadRowIndex(bytes.NewReader(b))
+	if err != nil || index.Width != 3 || !slices.Equal(index.Rows, []uint32{1, 2, 3, 4}) {
+		t.Fatalf("read back %+v, %v", index, err)
+	}
+
+	for name, data := range map[string][]byte{"cut short": b[:len(b)-1], "bad magic": append([]byte("XXXX"), b[4:]...), "empty": nil} {
+		if _, err := ReadRowIndex(bytes.NewReader(data)); !errors.Is(err, ErrCorruptFile) {
+			t.Errorf("%s: %v, want ErrCorruptFile", name, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ScrollOptions stores the axis to scroll the image along and by how many
+// pixels: positive values move the content right (x) or down (y).
+type ScrollOptions struct {
+	Axis   string // x or y
+	Pixels int
+}
+
+func (o ScrollOptions) Validate(width, height int) error        { return nil }
+func (o ScrollOptions) Dimensions(width, height int) (int, int) { return width, height }
+
+// MemoryMultiplier is 1 since the rows are rotated in place.
+func (o ScrollOptions) MemoryMultiplier() int { return 1 }
+
+func (o ScrollOptions) String() string { return fmt.Sprintf("scroll %s:%d", o.Axis, o.Pixels) }
+
+// parseScrollOptions parses a scroll value of the form x:<N> or y:<N>.
+func parseScrollOptions(value string) (ScrollOptions, error) {
+	axis, pixels, ok := strings.Cut(value, ":")
+	if !ok || axis != "x" && axis != "y" {
+		return ScrollOptions{}, fmt.Errorf("invalid scroll option: %s (must be x:<N> or y:<N>)", value)
+	}
+	n, err := strconv.Atoi(pixels)
+	if err != nil {
+		return ScrollOptions{}, fmt.Errorf("invalid scroll option: %s (pixels must be an integer)", value)
+	}
+	return ScrollOptions{Axis: axis, Pixels: n}, nil
+}
+
+// Scroll moves the content of the image along an axis with wrap-around:
+// the pixels pushed off one edge reappear at the opposite one. The count is
+// taken modulo the width or height, so scrolling by a multiple of it leaves
+// the image as it is. Columns are scrolled by rotating every row in place,
+// and rows by rotating the rows themselves; no pixel is computed.
+func Scroll(image *BMPImage, opts ScrollOptions) {
+	if opts.Axis == "y" {
+		rotateRight(image.Data, opts.Pixels)
+		if image.Alpha != nil {
+			rotateRight(image.Alpha, opts.Pixels)
+		}
+		if image.Wide != nil {
+			rotateRight(image.Wide, opts.Pixels)
+		}
+		return
+	}
+
+	ForRange(len(image.Data), 0, func(start, end int) {
+		for y := start; y < end; y++ {
+			rotateRight(image.Data[y], opts.Pixels)
+			if image.Alpha != nil {
+				rotateRight(image.Alpha[y], opts.Pixels)
+			}
+			if image.Wide != nil {
+				rotateRight(image.Wide[y], opts.Pixels)
+			}
+		}
+	})
+}
+
+// rotateRight moves every element of s k places towards its end, those
+// past it wrapping around to the start, with three reversals.
+func rotateRight[T any](s []T, k int) {
+	if len(s) == 0 {
+		return
+	}
+	k = (k%len(s) + len(s)) % len(s)
+	if k == 0 {
+		return
+	}
+	slices.Reverse(s)
+	slices.Reverse(s[:k])
+	slices.Reverse(s[k:])
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestScrollMovesContent(t *testing.T) {
+	const w, h = 7, 5
+	for _, orientation := range []string{"bottom-up", "top-down"} {
+		for _, opts := range []ScrollOptions{{"x", 3}, {"x", -2}, {"x", 15}, {"y", 1}, {"y", -4}, {"y", 12}} {
+			t.Run(fmt.Sprintf("%s_%s", orientation, opts), func(t *testing.T) {
+				image := withAlpha(noiseImage(w, h, 1))
+				if orientation == "top-down" {
+					image = topDown(image)
+				}
+				src := image.Clone()
+				Scroll(image, opts)
+
+				for y := range h {
+					for x := range w {
+						sx, sy := x, y
+						if opts.Axis == "x" {
+							sx = ((x-opts.Pixels)%w + w) % w
+						} else {
+							sy = ((y-opts.Pixels)%h + h) % h
+						}
+						if image.At(x, y) != src.At(sx, sy) || image.Alpha[y][x] != src.Alpha[sy][sx] {
+							t.Fatalf("(%d, %d) = %v, want %v from (%d, %d)", x, y, image.At(x, y), src.At(sx, sy), sx, sy)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestScrollNoOpsAndInverse(t *testing.T) {
+	image := withAlpha(noiseImage(9, 6, 2))
+	image.Widen()
+	want := encodeBMP(t, image)
+
+	for _, opts := range []ScrollOptions{{"x", 0}, {"x", 9}, {"x", -18}, {"y", 0}, {"y", 6}, {"y", -6}} {
+		Scroll(image, opts)
+		if !bytes.Equal(encodeBMP(t, image), want) {
+			t.Errorf("%s changed the image", opts)
+		}
+	}
+	for _, opts := range []ScrollOptions{{"x", 4}, {"x", -13}, {"y", 2}, {"y", 17}} {
+		original := image.Clone()
+		Scroll(image, opts)
+		Scroll(image, ScrollOptions{opts.Axis, -opts.Pixels})
+		if !gridsEqual(image.Data, original.Data) || !gridsEqual(image.Alpha, original.Alpha) || !gridsEqual(image.Wide, original.Wide) {
+			t.Errorf("%s and back didn't restore the image", opts)
+		}
+	}
+}
+
+func TestParseScrollOptions(t *testing.T) {
+	if opts, err := parseScrollOptions("y:-12"); err != nil || opts != (ScrollOptions{"y", -12}) {
+		t.Errorf("y:-12 parsed as %+v, %v", opts, err)
+	}
+	for _, value := range []string{"", "x", "z:3", "x:", "x:1.5", "x:3:4"} {
+		if _, err := parseScrollOptions(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ab-dauletkhan/bitmap/manifest"
+)
+
+// A stamp is a provenance marker carried by the BMP file itself: the 4-byte
+// Reserved field of the file header holds stampTag, and the file ends with a
+// trailer of stampTrailerSize bytes after the pixel data, counted in
+// FileSize:
+//
+//	offset 0  "BMST"  magic
+//	offset 4  1 byte  version, StampVersion
+//	offset 5  3 bytes zero
+//	offset 8  8 bytes the first 8 bytes of the SHA-256 of the manifest
+//
+// Readers locate pixels through DataOffset and ImageSize and ignore the
+// Reserved field, so a stamped file shows the same in any viewer.
+const (
+	stampMagic       = "BMST"
+	stampTrailerSize = 16
+
+	// StampVersion is the version of the stamp layout written by --stamp.
+	StampVersion = 1
+)
+
+// stampTag is the value of the Reserved field of a stamped file: "bs", the
+// stamp version and the size of the trailer, as bytes in file order.
+var stampTag = binary.LittleEndian.Uint32([]byte{'b', 's', StampVersion, stampTrailerSize})
+
+// isStampTag reports whether reserved, the Reserved field of a BMP file
+// header, marks a stamp of any version.
+func isStampTag(reserved uint32) bool {
+	return reserved&0xffff == stampTag&0xffff
+}
+
+// Stamp is the provenance marker of a stamped file.
+type Stamp struct {
+	Version byte
+	Hash    [8]byte // The first 8 bytes of the SHA-256 of the manifest, as written by WriteManifest
+}
+
+// String returns the hash of the stamp in hexadecimal.
+func (s Stamp) String() string {
+	return hex.EncodeToString(s.Hash[:])
+}
+
+// NewStamp returns the stamp of the run described by m. Its hash is that of
+// the manifest file WriteManifest writes for m, so a stamped image can be
+// matched with its manifest by hashing the file.
+func NewStamp(m *manifest.Manifest) (*Stamp, error) {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	s := &Stamp{Version: StampVersion}
+	copy(s.Hash[:], sum[:])
+	return s, nil
+}
+
+// trailer returns the trailer of the stamp.
+func (s Stamp) trailer() []byte {
+	t := make([]byte, stampTrailerSize)
+	copy(t, stampMagic)
+	t[4] = s.Version
+	copy(t[8:], s.Hash[:])
+	return t
+}
+
+// trailerWriter writes a BMP file as encoded without trailer, followed by
+// trailer, growing FileSize by its size on the way. A nonzero tag replaces
+// the Reserved field. The trailer itself is written by close.
+type trailerWriter struct {
+	w       io.Writer
+	trailer []byte
+	tag     uint32
+	head    [10]byte // The file header up to the Reserved field, held until complete
+	off     int
+}
+
+func (tw *trailerWriter) Write(p []byte) (int, error) {
+	n := 0
+	for tw.off < len(tw.head) && len(p) > 0 {
+		tw.head[tw.off] = p[0]
+		p, tw.off, n = p[1:], tw.off+1, n+1
+		if tw.off == len(tw.head) {
+			size := binary.LittleEndian.Uint32(tw.head[2:6])
+			binary.LittleEndian.PutUint32(tw.head[2:6], size+uint32(len(tw.trailer)))
+			if tw.tag != 0 {
+				binary.LittleEndian.PutUint32(tw.head[6:10], tw.tag)
+			}
+			if _, err := tw.w.Write(tw.head[:]); err != nil {
+				return n, err
+			}
+		}
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+	m, err := tw.w.Write(p)
+	return n + m, err
+}
+
+// close writes the trailer after the rest of the file.
+func (tw *trailerWriter) close() error {
+	_, err := tw.w.Write(tw.trailer)
+	return err
+}
+
+// ReadStamp returns the stamp of the BMP file data. A file that isn't
+// stamped gives ErrNotStamped, and one whose Reserved field announces a
+// stamp that isn't there an error of kind ErrInvalidParameter.
+func ReadStamp(data []byte) (Stamp, error) {
+	if len(data) < 14 || !bytes.HasPrefix(data, []byte("BM")) {
+		return Stamp{}, ErrInvalidFileType
+	}
+	reserved := binary.LittleEndian.Uint32(data[6:10])
+	if !isStampTag(reserved) {
+		return Stamp{}, ErrNotStamped
+	}
+
+	size := int(reserved >> 24)
+	fileSize := int(binary.LittleEndian.Uint32(data[2:6]))
+	if size < stampTrailerSize || fileSize > len(data) || fileSize < 54+size {
+		return Stamp{}, withKind(ErrInvalidParameter, fmt.Errorf("damaged stamp: no %d-byte trailer at the end of the %d-byte file", size, fileSize))
+	}
+	trailer := data[fileSize-size : fileSize]
+	if !bytes.HasPrefix(trailer, []byte(stampMagic)) || trailer[4] != byte(reserved>>16) {
+		return Stamp{}, withKind(ErrInvalidParameter, fmt.Errorf("damaged stamp: the trailer doesn't match the file header"))
+	}
+
+	s := Stamp{Version: trailer[4]}
+	copy(s.Hash[:], trailer[8:16])
+	return s, nil
+}
+
+// ReadStampFile reads the stamp of the BMP file at path; see ReadStamp.
+func ReadStampFile(path string) (Stamp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Stamp{}, ioError(err)
+	}
+	return ReadStamp(data)
+}
+
+// encodeManifest returns the contents of the manifest file of m.
+func encodeManifest(m *manifest.Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
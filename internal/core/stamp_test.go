@@ -0,0 +1,143 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/bitmap/manifest"
+)
+
+// stamped returns image encoded as BMP with a stamp of the given hash.
+func stamped(t *testing.T, image *BMPImage, hash [8]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, image, SaveOptions{Format: FormatBMP24, Stamp: &Stamp{Version: StampVersion, Hash: hash}}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStampRoundTrip(t *testing.T) {
+	hash := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, image := range []*BMPImage{noiseImage(5, 3, 1), topDown(noiseImage(8, 2, 2))} {
+		data := stamped(t, image, hash)
+
+		stamp, err := ReadStamp(data)
+		if err != nil {
+			t.Fatalf("ReadStamp: %v", err)
+		}
+		if stamp.Version != StampVersion || stamp.Hash != hash {
+			t.Errorf("ReadStamp = %+v, want version %d and hash %x", stamp, StampVersion, hash)
+		}
+		if got := stamp.String(); got != "0102030405060708" {
+			t.Errorf("String = %q", got)
+		}
+
+		// The file is still a valid BMP holding the same pixels
+		parsed, err := ParseBMP(data)
+		if err != nil {
+			t.Fatalf("ParseBMP of a stamped file: %v", err)
+		}
+		if !gridsEqual(parsed.Data, image.Data) {
+			t.Error("the pixels of the stamped file differ")
+		}
+		if _, err := decodeTheirs(data); err != nil {
+			t.Errorf("x/image/bmp: %v", err)
+		}
+		if err := CheckInvariants(parsed); err != nil {
+			t.Error(err)
+		}
+
+		// Saving the decoded image again doesn't keep a stamp without its trailer
+		var buf bytes.Buffer
+		if err := Encode(&buf, parsed, SaveOptions{Format: FormatBMP24}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadStamp(buf.Bytes()); !errors.Is(err, ErrNotStamped) {
+			t.Errorf("ReadStamp of the saved copy: error = %v, want %v", err, ErrNotStamped)
+		}
+	}
+}
+
+func TestStampWriterPatchesSplitHeader(t *testing.T) {
+	image := noiseImage(4, 4, 1)
+	want := stamped(t, image, [8]byte{9})
+
+	var plain, got bytes.Buffer
+	if err := Encode(&plain, image, SaveOptions{Format: FormatBMP24}); err != nil {
+		t.Fatal(err)
+	}
+	sw := &trailerWriter{w: &got, trailer: Stamp{Version: StampVersion, Hash: [8]byte{9}}.trailer(), tag: stampTag}
+	for _, b := range plain.Bytes() {
+		if n, err := sw.Write([]byte{b}); n != 1 || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if err := sw.close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Error("writing a byte at a time gives a different file")
+	}
+}
+
+func TestReadStampErrors(t *testing.T) {
+	data := stamped(t, noiseImage(4, 4, 1), [8]byte{1})
+	var plain bytes.Buffer
+	if err := Encode(&plain, noiseImage(4, 4, 1), SaveOptions{Format: FormatBMP24}); err != nil {
+		t.Fatal(err)
+	}
+	badTrailer := bytes.Clone(data)
+	copy(badTrailer[len(badTrailer)-stampTrailerSize:], "XXXX")
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"unstamped", plain.Bytes(), ErrNotStamped},
+		{"not a BMP", []byte("\x89PNG\r\n\x1a\n0000000000"), ErrInvalidFileType},
+		{"cut short", data[:len(data)-4], ErrInvalidParameter},
+		{"trailer overwritten", badTrailer, ErrInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadStamp(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("ReadStamp error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStampOnlyForBMP(t *testing.T) {
+	err := Encode(&bytes.Buffer{}, noiseImage(2, 2, 1), SaveOptions{Format: FormatPNG, Stamp: &Stamp{}})
+	if !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("Encode of a stamped PNG: error = %v, want %v", err, ErrInvalidParameter)
+	}
+}
+
+func TestNewStampHashesTheManifestFile(t *testing.T) {
+	m := &manifest.Manifest{Input: "in.bmp", Output: "out.bmp", Format: FormatBMP24, Version: "test", Created: time.Unix(0, 0).UTC()}
+	path := filepath.Join(t.TempDir(), "out.bmp.json")
+	if err := WriteManifest(m, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamp, err := NewStamp(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(stamp.Hash[:], sum[:8]) {
+		t.Errorf("stamp hash %x, want the start of the manifest file's %x", stamp.Hash, sum)
+	}
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"math"
+	"sync"
+)
+
+// ChannelStats describes the values of one color channel of an image.
+type ChannelStats struct {
+	Min, Max byte
+	Mean     float64
+	StdDev   float64 // Population standard deviation
+	Clipped  float64 // Fraction of the pixels at 0 or 255
+}
+
+// ImageStats describes the pixels of an image, as returned by Stats.
+type ImageStats struct {
+	Blue, Green, Red ChannelStats
+	LumaMean         float64 // Mean Rec. 709 luminance, on the 0-255 scale
+	LumaStdDev       float64
+	Entropy          float64 // Shannon entropy of the rounded luminance, in bits per pixel: 0 to 8
+}
+
+// statsSums accumulates the pixels of part of an image. The sums are exact
+// integers, so that merging the parts in any order gives the same result.
+type statsSums struct {
+	n        uint64
+	sum      [3]uint64 // Blue, green, red
+	sumSq    [3]uint64
+	cross    [3]uint64 // Blue*green, blue*red, green*red
+	min, max [3]byte
+	clipped  [3]uint64
+	hist     [256]uint64 // Of the rounded luminance
+}
+
+// add accumulates a row of pixels.
+func (s *statsSums) add(row []Pixel) {
+	for _, p := range row {
+		c := [3]uint64{uint64(p.Blue), uint64(p.Green), uint64(p.Red)}
+		for k, v := range c {
+			s.sum[k] += v
+			s.sumSq[k] += v * v
+			if v == 0 || v == 255 {
+				s.clipped[k]++
+			}
+		}
+		s.cross[0] += c[0] * c[1]
+		s.cross[1] += c[0] * c[2]
+		s.cross[2] += c[1] * c[2]
+		for k, v := range [3]byte{p.Blue, p.Green, p.Red} {
+			if s.n == 0 || v < s.min[k] {
+				s.min[k] = v
+			}
+			if s.n == 0 || v > s.max[k] {
+				s.max[k] = v
+			}
+		}
+		s.hist[luminance(p)]++
+		s.n++
+	}
+}
+
+// merge adds the sums of o to s.
+func (s *statsSums) merge(o *statsSums) {
+	if o.n == 0 {
+		return
+	}
+	for k := range 3 {
+		if s.n == 0 || o.min[k] < s.min[k] {
+			s.min[k] = o.min[k]
+		}
+		if s.n == 0 || o.max[k] > s.max[k] {
+			s.max[k] = o.max[k]
+		}
+		s.sum[k] += o.sum[k]
+		s.sumSq[k] += o.sumSq[k]
+		s.cross[k] += o.cross[k]
+		s.clipped[k] += o.clipped[k]
+	}
+	for v, count := range o.hist {
+		s.hist[v] += count
+	}
+	s.n += o.n
+}
+
+// Stats computes the statistics of the 8-bit pixels of image, a widened
+// image being rounded to 8 bits first, in one pass over its rows run in
+// parallel. The alpha channel is ignored. The luminance is that of the
+// grayscale filter: its mean and standard deviation are computed before
+// rounding, and its entropy after. An image without pixels has zero
+// statistics.
+func Stats(image *BMPImage) ImageStats {
+	image = image.narrowed()
+
+	var (
+		mu    sync.Mutex
+		total statsSums
+	)
+	ForRange(len(image.Data), 0, func(start, end int) {
+		var part statsSums
+		for _, row := range image.Data[start:end] {
+			part.add(row)
+		}
+		mu.Lock()
+		total.merge(&part)
+		mu.Unlock()
+	})
+	return total.stats()
+}
+
+// stats derives the statistics from the sums.
+func (s *statsSums) stats() ImageStats {
+	var st ImageStats
+	if s.n == 0 {
+		return st
+	}
+	n := float64(s.n)
+
+	channels := [3]*ChannelStats{&st.Blue, &st.Green, &st.Red}
+	var mean [3]float64
+	for k, c := range channels {
+		mean[k] = float64(s.sum[k]) / n
+		c.Min, c.Max = s.min[k], s.max[k]
+		c.Mean = mean[k]
+		c.StdDev = math.Sqrt(max(float64(s.sumSq[k])/n-mean[k]*mean[k], 0))
+		c.Clipped = float64(s.clipped[k]) / n
+	}
+
+	// The luminance is a weighted sum of the channels, so its moments follow
+	// from theirs: E[L^2] needs the products of every pair of channels
+	w := [3]float64{0.0722, 0.7152, 0.2126} // Those of luma, blue first
+	st.LumaMean = w[0]*mean[0] + w[1]*mean[1] + w[2]*mean[2]
+	sq := 0.0
+	for k := range 3 {
+		sq += w[k] * w[k] * float64(s.sumSq[k])
+	}
+	sq += 2 * (w[0]*w[1]*float64(s.cross[0]) + w[0]*w[2]*float64(s.cross[1]) + w[1]*w[2]*float64(s.cross[2]))
+	st.LumaStdDev = math.Sqrt(max(sq/n-st.LumaMean*st.LumaMean, 0))
+
+	for _, count := range s.hist {
+		if count > 0 {
+			p := float64(count) / n
+			st.Entropy -= p * math.Log2(p)
+		}
+	}
+	return st
+}
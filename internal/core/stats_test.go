@@ -0,0 +1,97 @@
+package core
+
+import (
+	"math"
+	"testing"
+)
+
+// approx reports whether a and b are equal up to rounding errors.
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestStatsSolidColor(t *testing.T) {
+	image := NewImage(7, 5)
+	p := Pixel{Blue: 10, Green: 200, Red: 255}
+	for _, row := range image.Data {
+		for x := range row {
+			row[x] = p
+		}
+	}
+
+	st := Stats(image)
+	for _, c := range []struct {
+		name    string
+		stats   ChannelStats
+		v       byte
+		clipped float64
+	}{{"blue", st.Blue, 10, 0}, {"green", st.Green, 200, 0}, {"red", st.Red, 255, 1}} {
+		if c.stats.Min != c.v || c.stats.Max != c.v || !approx(c.stats.Mean, float64(c.v)) || c.stats.StdDev != 0 || c.stats.Clipped != c.clipped {
+			t.Errorf("%s: %+v, want a constant %d", c.name, c.stats, c.v)
+		}
+	}
+	if !approx(st.LumaMean, luma(p)) || !approx(st.LumaStdDev, 0) || st.Entropy != 0 {
+		t.Errorf("luminance mean %v, stddev %v, entropy %v, want %v, 0, 0", st.LumaMean, st.LumaStdDev, st.Entropy, luma(p))
+	}
+}
+
+func TestStatsCheckerboard(t *testing.T) {
+	image := NewImage(8, 6)
+	for y, row := range image.Data {
+		for x := range row {
+			if (x+y)%2 == 1 {
+				row[x] = Pixel{Blue: 255, Green: 255, Red: 255}
+			}
+		}
+	}
+
+	// Half the pixels are 0 and half 255: a mean of 127.5 and a standard
+	// deviation of 127.5, all clipped, and one bit of entropy
+	st := Stats(image)
+	for _, c := range []ChannelStats{st.Blue, st.Green, st.Red} {
+		if c.Min != 0 || c.Max != 255 || !approx(c.Mean, 127.5) || !approx(c.StdDev, 127.5) || c.Clipped != 1 {
+			t.Errorf("channel %+v", c)
+		}
+	}
+	if !approx(st.LumaMean, 127.5) || !approx(st.LumaStdDev, 127.5) || !approx(st.Entropy, 1) {
+		t.Errorf("luminance mean %v, stddev %v, entropy %v, want 127.5, 127.5, 1", st.LumaMean, st.LumaStdDev, st.Entropy)
+	}
+}
+
+func TestStatsRamp(t *testing.T) {
+	// Every gray level once per row: a uniform distribution over 0-255
+	image := NewImage(256, 3)
+	for _, row := range image.Data {
+		for x := range row {
+			row[x] = Pixel{Blue: byte(x), Green: byte(x), Red: byte(x)}
+		}
+	}
+	image.Widen()
+
+	st := Stats(image)
+	stddev := math.Sqrt((256*256 - 1) / 12.0)
+	for _, c := range []ChannelStats{st.Blue, st.Green, st.Red} {
+		if c.Min != 0 || c.Max != 255 || !approx(c.Mean, 127.5) || !approx(c.StdDev, stddev) || !approx(c.Clipped, 2.0/256) {
+			t.Errorf("channel %+v, want a mean of 127.5 and a standard deviation of %v", c, stddev)
+		}
+	}
+	if !approx(st.LumaMean, 127.5) || math.Abs(st.LumaStdDev-stddev) > 1e-6 || !approx(st.Entropy, 8) {
+		t.Errorf("luminance mean %v, stddev %v, entropy %v, want 127.5, %v, 8", st.LumaMean, st.LumaStdDev, st.Entropy, stddev)
+	}
+}
+
+func TestStatsIndependentOfWorkers(t *testing.T) {
+	image := noiseImage(31, 47, 1)
+	defer func(n int) { Workers = n }(Workers)
+	Workers = 1
+	want := Stats(image)
+	for _, n := range []int{2, 3, 8} {
+		Workers = n
+		if got := Stats(image); got != want {
+			t.Errorf("%d workers: %+v, want %+v", n, got, want)
+		}
+	}
+	if st := Stats(NewImage(0, 0)); st != (ImageStats{}) {
+		t.Errorf("empty image: %+v", st)
+	}
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stereo layouts accepted by --layout.
+const (
+	StereoSideBySide = "sbs" // Left eye in the left half, right eye in the right half
+	StereoTopBottom  = "tb"  // Left eye in the top half, right eye in the bottom half
+)
+
+// Actions of the stereo command.
+const (
+	StereoSplit    = "split"
+	StereoJoin     = "join"
+	StereoAnaglyph = "anaglyph"
+)
+
+// StereoOptions holds the action and flags of the stereo command.
+type StereoOptions struct {
+	Action string // One of StereoSplit, StereoJoin and StereoAnaglyph
+	Layout string // StereoSideBySide or StereoTopBottom
+}
+
+// ParseStereoArgs parses the stereo command arguments: the action, options
+// and the files, which are
+//   - split: the stereo image, then the left and right outputs;
+//   - join: the left and right images, then the stereo output;
+//   - anaglyph: either the left and right images or a single stereo image
+//     in the layout given, then the output.
+func ParseStereoArgs(args []string) (StereoOptions, []string, error) {
+	opts := StereoOptions{Layout: StereoSideBySide}
+
+	if len(args) < 1 {
+		return opts, nil, ErrIncorrectArgument
+	}
+	opts.Action = args[0]
+
+	var files []string
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "--layout="):
+			switch value := strings.TrimPrefix(arg, "--layout="); value {
+			case StereoSideBySide, StereoTopBottom:
+				opts.Layout = value
+			default:
+				return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid layout option: %s (must be sbs or tb)", value))
+			}
+		case strings.HasPrefix(arg, "--"):
+			return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		default:
+			files = append(files, arg)
+		}
+	}
+
+	switch opts.Action {
+	case StereoSplit:
+		if len(files) != 3 {
+			return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("stereo split needs an input and two outputs"))
+		}
+	case StereoJoin:
+		if len(files) != 3 {
+			return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("stereo join needs two inputs and an output"))
+		}
+	case StereoAnaglyph:
+		if len(files) != 2 && len(files) != 3 {
+			return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("stereo anaglyph needs one or two inputs and an output"))
+		}
+	default:
+		return opts, nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid stereo action: %s (must be split, join or anaglyph)", opts.Action))
+	}
+
+	return opts, files, nil
+}
+
+// SplitStereo returns the left and right views of a stereo image stored in
+// layout. The image is split at its midpoint, so the dimension it is split
+// along must be even: there is no way to tell which eye a middle column or
+// row belongs to, and guessing would make the views differ in size. An odd
+// one is an error of kind ErrOutOfBounds. The image is left untouched.
+func SplitStereo(image *BMPImage, layout string) (left, right *BMPImage, err error) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+
+	first, second := CropInfo{Width: width / 2, Height: height}, CropInfo{OffsetX: width / 2, Width: width / 2, Height: height}
+	size, dimension := width, "width"
+	if layout == StereoTopBottom {
+		first, second = CropInfo{Width: width, Height: height / 2}, CropInfo{OffsetY: height / 2, Width: width, Height: height / 2}
+		size, dimension = height, "height"
+	}
+	if size%2 != 0 {
+		return nil, nil, withKind(ErrOutOfBounds, fmt.Errorf("can't split a %dx%d image into two %s views: the %s must be even", width, height, layout, dimension))
+	}
+
+	if left, err = Cropped(image, first); err != nil {
+		return nil, nil, err
+	}
+	if right, err = Cropped(image, second); err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+// JoinStereo returns the stereo image holding left and right in layout, the
+// inverse of SplitStereo. The views must have the same dimensions, else the
+// error wraps ErrDimensionMismatch. The result is a new 24-bit bottom-up
+// image, with an alpha plane if either view has one.
+func JoinStereo(left, right *BMPImage, layout string) (*BMPImage, error) {
+	width, height := int(left.InfoHeader.Width), len(left.Data)
+	if w, h := int(right.InfoHeader.Width), len(right.Data); w != width || h != height {
+		return nil, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, width, height, w, h)
+	}
+
+	// The offset of the right view
+	dx, dy := width, 0
+	joined := NewImage(2*width, height)
+	if layout == StereoTopBottom {
+		dx, dy = 0, height
+		joined = NewImage(width, 2*height)
+	}
+	if left.Alpha != nil || right.Alpha != nil {
+		joined.Alpha = constantAlpha(int(joined.InfoHeader.Width), len(joined.Data), 255)
+	}
+
+	for i, view := range []*BMPImage{left, right} {
+		for y, row := range view.Rows() {
+			dst := y + i*dy
+			copy(joined.Data[dst][i*dx:], row)
+			if view.Alpha != nil {
+				copy(joined.Alpha[dst][i*dx:], view.Alpha[y])
+			}
+		}
+	}
+	return joined, nil
+}
+
+// Anaglyph returns the red/cyan anaglyph of a stereo pair: the red channel
+// of every pixel comes from left and the green and blue channels from right,
+// so that red/cyan glasses show each eye its own view. The views must have
+// the same dimensions, else the error wraps ErrDimensionMismatch. The result
+// is a new 24-bit bottom-up image.
+func Anaglyph(left, right *BMPImage) (*BMPImage, error) {
+	width, height := int(left.InfoHeader.Width), len(left.Data)
+	if w, h := int(right.InfoHeader.Width), len(right.Data); w != width || h != height {
+		return nil, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch, width, height, w, h)
+	}
+
+	out := NewImage(width, height)
+	for y, row := range out.Rows() {
+		l, r := left.Data[y], right.Data[y]
+		for x := range row {
+			row[x] = Pixel{Red: l[x].Red, Green: r[x].Green, Blue: r[x].Blue}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplitAndJoinStereo(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		image  *BMPImage
+	}{
+		{"side by side", StereoSideBySide, noiseImage(8, 5, 1)},
+		{"side by side top-down", StereoSideBySide, topDown(noiseImage(6, 3, 2))},
+		{"top-bottom", StereoTopBottom, noiseImage(5, 8, 3)},
+		{"top-bottom top-down", StereoTopBottom, topDown(noiseImage(3, 6, 4))},
+		{"transparent", StereoSideBySide, withAlpha(noiseImage(4, 4, 5))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.image.Clone()
+			left, right, err := SplitStereo(tt.image, tt.layout)
+			if err != nil {
+				t.Fatalf("SplitStereo: %v", err)
+			}
+			if !sameImage(tt.image, before) {
+				t.Error("SplitStereo changed the image")
+			}
+
+			// Every pixel of a view comes from its half of the image
+			width, height := int(left.InfoHeader.Width), len(left.Data)
+			dx, dy := width, 0
+			if tt.layout == StereoTopBottom {
+				dx, dy = 0, height
+			}
+			for y := range height {
+				for x := range width {
+					if got, want := left.At(x, y), tt.image.At(x, y); got != want {
+						t.Fatalf("left (%d, %d) = %v, want %v", x, y, got, want)
+					}
+					if got, want := right.At(x, y), tt.image.At(x+dx, y+dy); got != want {
+						t.Fatalf("right (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+
+			joined, err := JoinStereo(left, right, tt.layout)
+			if err != nil {
+				t.Fatalf("JoinStereo: %v", err)
+			}
+			if joined.InfoHeader.Width != tt.image.InfoHeader.Width || len(joined.Data) != len(tt.image.Data) {
+				t.Fatalf("joined is %dx%d, want %dx%d", joined.InfoHeader.Width, len(joined.Data), tt.image.InfoHeader.Width, len(tt.image.Data))
+			}
+			for y := range len(joined.Data) {
+				for x := range int(joined.InfoHeader.Width) {
+					if got, want := joined.At(x, y), tt.image.At(x, y); got != want {
+						t.Fatalf("joined (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+			if tt.image.Alpha != nil {
+				for y := range len(joined.Data) {
+					if got, want := joined.Alpha[y], tt.image.Alpha[y]; string(got) != string(want) {
+						t.Fatalf("joined alpha row %d = %v, want %v", y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStereoErrors(t *testing.T) {
+	if _, _, err := SplitStereo(noiseImage(7, 4, 1), StereoSideBySide); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("SplitStereo of an odd width: error = %v, want %v", err, ErrOutOfBounds)
+	}
+	if _, _, err := SplitStereo(noiseImage(4, 7, 1), StereoTopBottom); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("SplitStereo of an odd height: error = %v, want %v", err, ErrOutOfBounds)
+	}
+	if _, _, err := SplitStereo(noiseImage(4, 7, 1), StereoSideBySide); err != nil {
+		t.Errorf("SplitStereo of an odd height side by side: %v", err)
+	}
+	if _, err := JoinStereo(noiseImage(4, 4, 1), noiseImage(4, 5, 2), StereoSideBySide); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("JoinStereo of different sizes: error = %v, want %v", err, ErrDimensionMismatch)
+	}
+	if _, err := Anaglyph(noiseImage(4, 4, 1), noiseImage(5, 4, 2)); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Anaglyph of different sizes: error = %v, want %v", err, ErrDimensionMismatch)
+	}
+}
+
+func TestAnaglyph(t *testing.T) {
+	left, right := noiseImage(5, 4, 1), topDown(noiseImage(5, 4, 2))
+	anaglyph, err := Anaglyph(left, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := range 4 {
+		for x := range 5 {
+			got, l, r := anaglyph.At(x, y), left.At(x, y), right.At(x, y)
+			if got.Red != l.Red {
+				t.Fatalf("(%d, %d): red %d, want %d from the left view", x, y, got.Red, l.Red)
+			}
+			if got.Green != r.Green || got.Blue != r.Blue {
+				t.Fatalf("(%d, %d): green and blue %d, %d, want %d, %d from the right view", x, y, got.Green, got.Blue, r.Green, r.Blue)
+			}
+		}
+	}
+}
+
+func TestParseStereoArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		layout  string
+		files   int
+		wantErr bool
+	}{
+		{[]string{"split", "in.bmp", "l.bmp", "r.bmp"}, StereoSideBySide, 3, false},
+		{[]string{"join", "--layout=tb", "l.bmp", "r.bmp", "out.bmp"}, StereoTopBottom, 3, false},
+		{[]string{"anaglyph", "in.bmp", "out.bmp"}, StereoSideBySide, 2, false},
+		{[]string{"anaglyph", "l.bmp", "r.bmp", "out.bmp"}, StereoSideBySide, 3, false},
+		{[]string{"split", "in.bmp", "l.bmp"}, "", 0, true},
+		{[]string{"join", "l.bmp", "out.bmp"}, "", 0, true},
+		{[]string{"anaglyph", "out.bmp"}, "", 0, true},
+		{[]string{"split", "--layout=lr", "in.bmp", "l.bmp", "r.bmp"}, "", 0, true},
+		{[]string{"split", "--scale=2", "in.bmp", "l.bmp", "r.bmp"}, "", 0, true},
+		{[]string{"merge", "l.bmp", "r.bmp", "out.bmp"}, "", 0, true},
+		{nil, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		opts, files, err := ParseStereoArgs(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStereoArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (opts.Layout != tt.layout || len(files) != tt.files) {
+			t.Errorf("ParseStereoArgs(%q) = layout %q, %d files, want %q, %d", tt.args, opts.Layout, len(files), tt.layout, tt.files)
+		}
+	}
+}
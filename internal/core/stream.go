@@ -0,0 +1,201 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// BMPReader decodes a BMP file row by row, so the pixel array never has to be
+// held in memory at once. Rows are returned in storage order, i.e. bottom-up
+// for images with a positive height.
+type BMPReader struct {
+	Image *BMPImage // Parsed headers; Data is left empty
+	Alpha bool      // Whether the pixels have an alpha channel, which ReadRow drops
+
+	r       *bufio.Reader
+	buf     []byte  // raw bytes of one padded row
+	palette []Pixel // color table of palettized images, nil for others
+	next    int     // index of the next row to be read
+}
+
+// NewBMPReader reads and validates the headers from r and skips to the start
+// of the pixel data. Since the total length of a stream is unknown, the
+// FileSize field is trusted instead of being compared to the actual size.
+func NewBMPReader(r io.Reader) (*BMPReader, error) {
+	br := &BMPReader{r: bufio.NewReader(r)}
+
+	image, alpha, palette, err := readStreamHeaders(br.r)
+	if err != nil {
+		return nil, err
+	}
+
+	br.Image, br.Alpha, br.palette = image, alpha, palette
+	br.buf = make([]byte, pixelStride(image))
+	return br, nil
+}
+
+// readStreamHeaders reads and validates the headers from r, leaving it at
+// the start of the pixel data, and reports whether the pixels have an alpha
+// channel. It also returns the color table of palettized images, nil for others.
+// The FileSize field is trusted, as the size of r is unknown.
+func readStreamHeaders(r io.Reader) (*BMPImage, bool, []Pixel, error) {
+	head := make([]byte, 54)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, false, nil, ErrInvalidBMP
+	}
+
+	image, err := parseHeaders(head)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if err := validateHeaders(image, int(image.Header.FileSize)); err != nil {
+		return nil, false, nil, err
+	}
+	if image.Header.DataOffset < 54 {
+		return nil, false, nil, ErrCorruptFile
+	}
+
+	// Read whatever lies between the headers and the pixel array, which
+	// includes the color masks of 32-bit images and the palette of palettized ones
+	head = append(head, make([]byte, int(image.Header.DataOffset)-54)...)
+	if _, err := io.ReadFull(r, head[54:]); err != nil {
+		return nil, false, nil, ErrCorruptFile
+	}
+	alpha, err := hasAlpha(image, head)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	readHeaderExtra(image, head)
+	return image, alpha, readPalette(image, head), nil
+}
+
+// ReadRow decodes the next row into dst, which must hold Width pixels.
+// It returns io.EOF once every row has been read.
+func (br *BMPReader) ReadRow(dst []Pixel) error {
+	if br.next >= utils.Abs(int(br.Image.InfoHeader.Height)) {
+		return io.EOF
+	}
+	if _, err := io.ReadFull(br.r, br.buf); err != nil {
+		return ErrInvalidImageData
+	}
+	br.next++
+
+	if br.palette != nil {
+		bpp := int(br.Image.InfoHeader.BitsPerPixel)
+		for x := range dst {
+			dst[x] = paletteEntry(br.palette, paletteIndex(br.buf, x, bpp))
+		}
+		return nil
+	}
+	bytesPerPixel := int(br.Image.InfoHeader.BitsPerPixel) / 8
+	for x := range dst {
+		dst[x] = Pixel{
+			Blue:  br.buf[x*bytesPerPixel],
+			Green: br.buf[x*bytesPerPixel+1],
+			Red:   br.buf[x*bytesPerPixel+2],
+		}
+	}
+	return nil
+}
+
+// BMPWriter encodes a BMP file row by row. Rows must be written in storage
+// order, and exactly as many rows as the header declares. Close must be
+// called once all rows are written.
+type BMPWriter struct {
+	w       *bufio.Writer
+	buf     []byte // raw bytes of one padded row
+	profile []byte // ICC profile written after the rows
+}
+
+// NewBMPWriter writes the headers of image to w. The pixel data of image is
+// ignored; rows are supplied afterwards with WriteRow. The ImageSize and
+// FileSize fields are recomputed rather than trusted, so they always match
+// what is written, and the headers of 32-bit images are turned into those of
+// the 24-bit image written (see outputHeaders).
+func NewBMPWriter(w io.Writer, image *BMPImage) (*BMPWriter, error) {
+	return NewBMPWriterAligned(w, image, 4)
+}
+
+// NewBMPWriterAligned is like NewBMPWriter, but pads rows to a multiple of
+// align bytes instead of 4. The header sizes account for the wider rows, but
+// readers that assume 4-byte alignment won't display the file correctly, so
+// this is only meant for loaders that require it.
+func NewBMPWriterAligned(w io.Writer, image *BMPImage, align int) (*BMPWriter, error) {
+	if err := image.checkHeaders(); err != nil {
+		return nil, err
+	}
+	if err := checkFileSize(image.outputSize(align)); err != nil {
+		return nil, err
+	}
+	bw := &BMPWriter{w: bufio.NewWriter(w)}
+
+	header := image.outputHeaders(align)
+	head := make([]byte, header.Header.DataOffset)
+	putHeaders(head, &header)
+	if _, err := bw.w.Write(head); err != nil {
+		return nil, err
+	}
+
+	bw.buf = getRowBuffer(alignedStride(int(image.InfoHeader.Width), 24, align))
+	bw.profile = header.ICCProfile
+	return bw, nil
+}
+
+// WriteRow encodes a single row of pixels followed by its padding bytes.
+func (bw *BMPWriter) WriteRow(row []Pixel) error {
+	for x, pixel := range row {
+		bw.buf[x*3] = pixel.Blue
+		bw.buf[x*3+1] = pixel.Green
+		bw.buf[x*3+2] = pixel.Red
+	}
+	// The buffer may come dirty from the pool, so the padding is
+	// zeroed on every row rather than relying on a fresh allocation.
+	clear(bw.buf[len(row)*3:])
+
+	_, err := bw.w.Write(bw.buf)
+	return err
+}
+
+// Close writes the ICC profile of the image, if any, and any buffered data
+// to the underlying writer and releases the row buffer. The underlying
+// writer itself is not closed.
+func (bw *BMPWriter) Close() error {
+	putRowBuffer(bw.buf)
+	bw.buf = nil
+	if _, err := bw.w.Write(bw.profile); err != nil {
+		return err
+	}
+	return bw.w.Flush()
+}
+
+// rowPool recycles row buffers between writers. Buffers are returned to the
+// pool as they are, so their contents are arbitrary when handed out again.
+var rowPool sync.Pool
+
+// getRowBuffer returns a buffer of n bytes, reusing one from rowPool if possible.
+func getRowBuffer(n int) []byte {
+	if b, ok := rowPool.Get().(*[]byte); ok && cap(*b) >= n {
+		return (*b)[:n]
+	}
+	return make([]byte, n)
+}
+
+// putRowBuffer returns a buffer obtained from getRowBuffer to rowPool.
+func putRowBuffer(b []byte) {
+	rowPool.Put(&b)
+}
+
+// rowStride returns the number of bytes a row occupies in the file,
+// including the padding up to the next 4-byte boundary.
+func rowStride(width, bitsPerPixel int) int {
+	return alignedStride(width, bitsPerPixel, 4)
+}
+
+// alignedStride returns the number of bytes a row occupies when rows are
+// padded to a multiple of align bytes. An align of 1 means no padding.
+func alignedStride(width, bitsPerPixel, align int) int {
+	return int(stride64(width, bitsPerPixel, align))
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// DecodeSubsampled decodes the BMP read from r keeping only every factor-th
+// row, and every factor-th pixel of those rows, counted from the visual
+// top-left corner. The result is the ceil(w/factor)×ceil(h/factor) image a
+// nearest neighbor downscale of the whole one gives, built without decoding
+// anything else: the rows in between are sought over if r is an io.Seeker
+// that can seek, and read and discarded otherwise. It keeps the row order of
+// the file and the alpha channel of 32-bit images that have one. As for
+// NewBMPReader, the FileSize field is trusted. A factor of 1 decodes the
+// whole image.
+func DecodeSubsampled(r io.Reader, factor int) (*BMPImage, error) {
+	if factor < 1 {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid subsampling factor: %d", factor))
+	}
+	src, alpha, palette, err := readStreamHeaders(r)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := int(src.InfoHeader.Width), utils.Abs(int(src.InfoHeader.Height))
+	outWidth, outHeight := (width+factor-1)/factor, (height+factor-1)/factor
+	out := NewImage(outWidth, outHeight)
+	if src.InfoHeader.Height < 0 {
+		out.InfoHeader.Height = -out.InfoHeader.Height
+	}
+	if alpha {
+		out.Alpha = make([][]byte, outHeight)
+		for y := range out.Alpha {
+			out.Alpha[y] = make([]byte, outWidth)
+		}
+	}
+
+	// Only the bytes of a row up to its last kept pixel are read
+	bpp := int(src.InfoHeader.BitsPerPixel)
+	bytesPerPixel := bpp / 8
+	stride := pixelStride(src)
+	buf := make([]byte, (((outWidth-1)*factor+1)*bpp+7)/8)
+	skip := newSkipper(r)
+	opaque := true
+	for s := range height {
+		y := s
+		if src.InfoHeader.Height > 0 {
+			y = height - 1 - s
+		}
+		if y%factor != 0 {
+			skip.pending += int64(stride)
+			continue
+		}
+		if err := skip.flush(); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, ErrInvalidImageData
+		}
+		skip.pending += int64(stride - len(buf))
+
+		i := y / factor
+		for x := range out.Data[i] {
+			if palette != nil {
+				out.Data[i][x] = paletteEntry(palette, paletteIndex(buf, x*factor, bpp))
+				continue
+			}
+			p := buf[x*factor*bytesPerPixel:]
+			out.Data[i][x] = Pixel{Blue: p[0], Green: p[1], Red: p[2]}
+			if alpha {
+				out.Alpha[i][x] = p[3]
+				opaque = opaque && p[3] == 255
+			}
+		}
+	}
+	if opaque {
+		out.Alpha = nil
+	}
+	return out, nil
+}
+
+// skipper skips the bytes of a reader that aren't needed, seeking over them
+// if it can and reading them otherwise. Consecutive skips are merged into
+// pending, which flush skips before the next read.
+type skipper struct {
+	r       io.Reader
+	seeker  io.Seeker // nil if r can't seek, such as a pipe behind an *os.File
+	pending int64
+}
+
+// newSkipper returns a skipper for r.
+func newSkipper(r io.Reader) *skipper {
+	s := &skipper{r: r}
+	if seeker, ok := r.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			s.seeker = seeker
+		}
+	}
+	return s
+}
+
+// flush skips the pending bytes.
+func (s *skipper) flush() error {
+	n := s.pending
+	if n == 0 {
+		return nil
+	}
+	s.pending = 0
+	if s.seeker != nil {
+		if _, err := s.seeker.Seek(n, io.SeekCurrent); err != nil {
+			return ioError(err)
+		}
+		return nil
+	}
+	if _, err := io.CopyN(io.Discard, s.r, n); err != nil {
+		return ErrInvalidImageData
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// plainReader hides the io.Seeker of the reader it wraps.
+type plainReader struct{ io.Reader }
+
+// nearestDownscale is the reference for DecodeSubsampled: the pixels of
+// image at every factor-th row and column from the visual top-left corner.
+func nearestDownscale(image *BMPImage, factor int) *BMPImage {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	out := NewImage((width+factor-1)/factor, (height+factor-1)/factor)
+	for y, row := range out.Rows() {
+		for x := range row {
+			row[x] = image.At(x*factor, y*factor)
+		}
+	}
+	return out
+}
+
+// bgra32File returns image encoded as a 32-bit BMP with a V4 header whose
+// masks give its alpha channel.
+func bgra32File(image *BMPImage) []byte {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	const offset = 14 + v4HeaderSize
+	b := make([]byte, offset+width*height*4)
+	header := *image
+	header.InfoHeader.Size = v4HeaderSize
+	header.InfoHeader.BitsPerPixel = 32
+	header.InfoHeader.Compression = biBitfields
+	header.InfoHeader.ImageSize = uint32(width * height * 4)
+	header.Header.DataOffset = offset
+	header.Header.FileSize = uint32(len(b))
+	header.HeaderExtra = nil
+	putHeaders(b, &header)
+	for i, mask := range []uint32{0x00ff0000, 0x0000ff00, 0x000000ff, 0xff000000} {
+		binary.LittleEndian.PutUint32(b[54+4*i:], mask)
+	}
+	for i := range image.Data {
+		y := image.fileRow(i)
+		for x, p := range image.Data[y] {
+			copy(b[offset+(i*width+x)*4:], []byte{p.Blue, p.Green, p.Red, image.Alpha[y][x]})
+		}
+	}
+	return b
+}
+
+func TestDecodeSubsampledMatchesNearestDownscale(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {7, 5}, {13, 70}, {64, 33}}
+	for _, size := range sizes {
+		for _, factor := range []int{1, 2, 3, 8, 100} {
+			for _, orientation := range []string{"bottom-up", "top-down"} {
+				image := noiseImage(size[0], size[1], int64(factor))
+				if orientation == "top-down" {
+					image = topDown(image)
+				}
+				file := encodeBMP(t, image)
+				want := nearestDownscale(image, factor)
+
+				for _, seek := range []bool{true, false} {
+					t.Run(fmt.Sprintf("%dx%d_f%d_%s_seek=%t", size[0], size[1], factor, orientation, seek), func(t *testing.T) {
+						var r io.Reader = bytes.NewReader(file)
+						if !seek {
+							r = plainReader{r}
+						}
+						got, err := DecodeSubsampled(r, factor)
+						if err != nil {
+							t.Fatalf("DecodeSubsampled: %v", err)
+						}
+						if w, h := got.InfoHeader.Width, len(got.Data); int(w) != (size[0]+factor-1)/factor || h != (size[1]+factor-1)/factor {
+							t.Fatalf("size %dx%d", w, h)
+						}
+						if (got.InfoHeader.Height < 0) != (orientation == "top-down") {
+							t.Errorf("height %d doesn't keep the row order", got.InfoHeader.Height)
+						}
+						for y := range len(want.Data) {
+							for x := range int(want.InfoHeader.Width) {
+								if got.At(x, y) != want.At(x, y) {
+									t.Fatalf("(%d, %d) = %v, want %v", x, y, got.At(x, y), want.At(x, y))
+								}
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeSubsampledAlpha(t *testing.T) {
+	image := withAlpha(noiseImage(9, 7, 1))
+	got, err := DecodeSubsampled(bytes.NewReader(bgra32File(image)), 2)
+	if err != nil {
+		t.Fatalf("DecodeSubsampled: %v", err)
+	}
+	if got.Alpha == nil {
+		t.Fatal("alpha channel dropped")
+	}
+	for y := range 4 {
+		for x := range 5 {
+			if a, want := got.Alpha[y][x], image.Alpha[2*y][2*x]; a != want {
+				t.Fatalf("alpha at (%d, %d) = %d, want %d", x, y, a, want)
+			}
+		}
+	}
+}
+
+func TestDecodeSubsampledErrors(t *testing.T) {
+	file := encodeBMP(t, noiseImage(10, 10, 1))
+	if _, err := DecodeSubsampled(bytes.NewReader(file), 0); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("factor 0: %v, want an ErrInvalidParameter", err)
+	}
+	for _, seek := range []bool{true, false} {
+		var r io.Reader = bytes.NewReader(file[:len(file)-40])
+		if !seek {
+			r = plainReader{r}
+		}
+		if _, err := DecodeSubsampled(r, 3); !errors.Is(err, ErrInvalidImageData) {
+			t.Errorf("truncated file, seek=%t: %v, want ErrInvalidImageData", seek, err)
+		}
+	}
+}
+
+// largeFile is largeImage encoded as a BMP file.
+var largeFile = sync.OnceValue(func() []byte {
+	var buf bytes.Buffer
+	if err := EncodeBMP(&buf, largeImage()); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+})
+
+func BenchmarkDecodeThenDownscale(b *testing.B) {
+	file := largeFile()
+	b.ResetTimer()
+	for range b.N {
+		image, err := ParseBMP(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		nearestDownscale(image, 8)
+	}
+}
+
+func BenchmarkDecodeSubsampled(b *testing.B) {
+	file := largeFile()
+	for _, seek := range []bool{true, false} {
+		b.Run(fmt.Sprintf("seek=%t", seek), func(b *testing.B) {
+			for range b.N {
+				var r io.Reader = bytes.NewReader(file)
+				if !seek {
+					r = plainReader{r}
+				}
+				if _, err := DecodeSubsampled(r, 8); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
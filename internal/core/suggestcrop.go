@@ -0,0 +1,153 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SuggestCropOptions stores the settings of the suggest-crop command.
+type SuggestCropOptions struct {
+	Aspect [2]int // Width and height of the aspect ratio of the crop, e.g. 1:1
+	Blur   int    // Radius of the box blur smoothing the energy map; 0 leaves it sharp
+	Apply  string // Path to save the cropped image to, if any, instead of printing the crop
+}
+
+// ParseSuggestCropArgs parses the suggest-crop command arguments: options
+// followed by the input file.
+func ParseSuggestCropArgs(args []string) (SuggestCropOptions, string, error) {
+	opts := SuggestCropOptions{Aspect: [2]int{1, 1}}
+
+	if len(args) < 1 {
+		return opts, "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		switch {
+		case strings.HasPrefix(arg, "--aspect="):
+			w, h, ok := strings.Cut(strings.TrimPrefix(arg, "--aspect="), ":")
+			aw, errW := strconv.Atoi(w)
+			ah, errH := strconv.Atoi(h)
+			if !ok || errW != nil || errH != nil || aw < 1 || ah < 1 {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid aspect option: %s (must be <width>:<height>, e.g. 1:1)", arg))
+			}
+			opts.Aspect = [2]int{aw, ah}
+		case strings.HasPrefix(arg, "--blur="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--blur="))
+			if err != nil || n < 0 {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid blur option: %s (must be a radius of at least 0)", arg))
+			}
+			opts.Blur = n
+		case strings.HasPrefix(arg, "--apply="):
+			opts.Apply = strings.TrimPrefix(arg, "--apply=")
+			if opts.Apply == "" {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("apply option requires a file path"))
+			}
+		default:
+			return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+
+	return opts, args[len(args)-1], nil
+}
+
+// SuggestCrop returns the crop of the aspect ratio of opts that keeps the
+// most detail of the image: the largest window of that ratio that fits,
+// placed where the gradient magnitude it contains, as measured by the Sobel
+// kernels on the luminance, is highest. Among placements with the same
+// energy the one closest to the center of the image wins, and the topmost,
+// then leftmost, of those.
+func SuggestCrop(image *BMPImage, opts SuggestCropOptions) CropInfo {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	w, h := width, width*opts.Aspect[1]/opts.Aspect[0]
+	if h > height {
+		w, h = height*opts.Aspect[0]/opts.Aspect[1], height
+	}
+	w, h = max(w, 1), max(h, 1)
+
+	sums := prefixSums(boxBlur(sobelEnergy(image), opts.Blur))
+	sum := func(x0, y0, x1, y1 int) int64 {
+		stride := width + 1
+		return sums[y1*stride+x1] - sums[y0*stride+x1] - sums[y1*stride+x0] + sums[y0*stride+x0]
+	}
+
+	best := CropInfo{Width: w, Height: h}
+	bestEnergy, bestDistance := int64(-1), 0
+	for y := 0; y+h <= height; y++ {
+		for x := 0; x+w <= width; x++ {
+			energy := sum(x, y, x+w, y+h)
+			// Twice the offset of the center of the window from that of the image
+			dx, dy := 2*x+w-width, 2*y+h-height
+			distance := dx*dx + dy*dy
+			if energy > bestEnergy || energy == bestEnergy && distance < bestDistance {
+				best.OffsetX, best.OffsetY = x, y
+				bestEnergy, bestDistance = energy, distance
+			}
+		}
+	}
+	return best
+}
+
+// sobelEnergy returns the gradient magnitude of the luminance of image at
+// every pixel, rounded, in visual rows. The Sobel kernels see the edge
+// pixels repeated past the edges.
+func sobelEnergy(image *BMPImage) [][]int64 {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	lum := makeGrid[int64](width, height)
+	for y, row := range image.narrowed().Rows() {
+		for x, p := range row {
+			lum[y][x] = int64(luminance(p))
+		}
+	}
+	at := func(x, y int) int64 {
+		return lum[min(max(y, 0), height-1)][min(max(x, 0), width-1)]
+	}
+
+	energy := makeGrid[int64](width, height)
+	for y := range height {
+		for x := range width {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			energy[y][x] = int64(math.Round(math.Hypot(float64(gx), float64(gy))))
+		}
+	}
+	return energy
+}
+
+// boxBlur returns the mean of every (2*radius+1)-wide square of grid around
+// each value, clipped to the grid and rounded. A radius of 0 returns grid.
+func boxBlur(grid [][]int64, radius int) [][]int64 {
+	if radius == 0 {
+		return grid
+	}
+	height, width := len(grid), len(grid[0])
+	sums := prefixSums(grid)
+	stride := width + 1
+	out := makeGrid[int64](width, height)
+	for y := range height {
+		for x := range width {
+			x0, y0 := max(x-radius, 0), max(y-radius, 0)
+			x1, y1 := min(x+radius+1, width), min(y+radius+1, height)
+			s := sums[y1*stride+x1] - sums[y0*stride+x1] - sums[y1*stride+x0] + sums[y0*stride+x0]
+			out[y][x] = int64(divRound(int(s), (x1-x0)*(y1-y0)))
+		}
+	}
+	return out
+}
+
+// prefixSums returns the summed-area table of grid, one entry wider and
+// taller than it with a zero first row and column, in rows of width+1.
+func prefixSums(grid [][]int64) []int64 {
+	height, width := len(grid), len(grid[0])
+	stride := width + 1
+	sums := make([]int64, stride*(height+1))
+	for y, row := range grid {
+		var rowSum int64
+		for x, v := range row {
+			rowSum += v
+			sums[(y+1)*stride+x+1] = sums[y*stride+x+1] + rowSum
+		}
+	}
+	return sums
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+// detailImage returns a plain gray width x height image with a square of
+// noise of the given size at (x, y).
+func detailImage(width, height, x, y, size int) *BMPImage {
+	image := NewImage(width, height)
+	for _, row := range image.Data {
+		for i := range row {
+			row[i] = Pixel{Blue: 128, Green: 128, Red: 128}
+		}
+	}
+	noise := noiseImage(size, size, 7)
+	for j := range size {
+		for i := range size {
+			image.Set(x+i, y+j, noise.At(i, j))
+		}
+	}
+	return image
+}
+
+func TestSuggestCropContainsDetail(t *testing.T) {
+	tests := []struct {
+		width, height, x, y, size int
+		aspect                    [2]int
+	}{
+		{120, 60, 90, 20, 15, [2]int{1, 1}},
+		{120, 60, 5, 30, 12, [2]int{1, 1}},
+		{60, 120, 10, 95, 20, [2]int{1, 1}},
+		{200, 100, 150, 10, 20, [2]int{4, 3}},
+		{100, 100, 70, 80, 10, [2]int{2, 1}},
+	}
+	for _, tt := range tests {
+		for _, blur := range []int{0, 3} {
+			t.Run(fmt.Sprintf("%dx%d_at_%d,%d_aspect%d:%d_blur%d", tt.width, tt.height, tt.x, tt.y, tt.aspect[0], tt.aspect[1], blur), func(t *testing.T) {
+				image := detailImage(tt.width, tt.height, tt.x, tt.y, tt.size)
+				c := SuggestCrop(image, SuggestCropOptions{Aspect: tt.aspect, Blur: blur})
+
+				if c.Width*tt.aspect[1] > c.Height*tt.aspect[0]+tt.aspect[1] || c.Height*tt.aspect[0] > c.Width*tt.aspect[1]+tt.aspect[0] {
+					t.Errorf("crop %dx%d doesn't have the aspect ratio %d:%d", c.Width, c.Height, tt.aspect[0], tt.aspect[1])
+				}
+				if c.Width != tt.width && c.Height != tt.height {
+					t.Errorf("crop %dx%d isn't the largest that fits", c.Width, c.Height)
+				}
+				if err := c.Validate(tt.width, tt.height); err != nil {
+					t.Fatalf("crop %+v doesn't fit: %v", c, err)
+				}
+				if c.OffsetX > tt.x || c.OffsetY > tt.y || c.OffsetX+c.Width < tt.x+tt.size || c.OffsetY+c.Height < tt.y+tt.size {
+					t.Errorf("crop %d-%d-%d-%d misses the detail at %d-%d-%d-%d", c.OffsetX, c.OffsetY, c.Width, c.Height, tt.x, tt.y, tt.size, tt.size)
+				}
+			})
+		}
+	}
+}
+
+func TestSuggestCropBreaksTiesTowardCenter(t *testing.T) {
+	for _, size := range [][2]int{{100, 40}, {101, 40}, {40, 99}} {
+		image := detailImage(size[0], size[1], 0, 0, 0)
+		c := SuggestCrop(topDown(image), SuggestCropOptions{Aspect: [2]int{1, 1}})
+		if x, y := (size[0]-c.Width)/2, (size[1]-c.Height)/2; c.OffsetX != x || c.OffsetY != y {
+			t.Errorf("%dx%d: plain image cropped at %d-%d, want the center %d-%d", size[0], size[1], c.OffsetX, c.OffsetY, x, y)
+		}
+	}
+}
+
+func TestParseSuggestCropArgs(t *testing.T) {
+	opts, in, err := ParseSuggestCropArgs([]string{"--aspect=16:9", "--blur=2", "--apply=out.bmp", "in.bmp"})
+	if err != nil || in != "in.bmp" || opts != (SuggestCropOptions{Aspect: [2]int{16, 9}, Blur: 2, Apply: "out.bmp"}) {
+		t.Errorf("parsed %+v, %q, %v", opts, in, err)
+	}
+	for _, arg := range []string{"--aspect=1", "--aspect=0:1", "--aspect=a:b", "--blur=-1", "--apply=", "--size=3"} {
+		if _, _, err := ParseSuggestCropArgs([]string{arg, "in.bmp"}); err == nil {
+			t.Errorf("%s accepted", arg)
+		}
+	}
+}
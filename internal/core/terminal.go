@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Widths of text output, in characters: the one assumed when the terminal
+// can't be asked and COLUMNS isn't set, and the narrowest the text renderers
+// lay out, narrower widths being raised to it.
+const (
+	defaultTerminalWidth = 80
+	minTextWidth         = 20
+)
+
+// terminalWidth returns the width of the terminal on standard output: the
+// one the terminal reports, or else the COLUMNS environment variable, or else
+// defaultTerminalWidth.
+func terminalWidth() int {
+	return detectTerminalWidth(stdoutWidth, os.Getenv)
+}
+
+// detectTerminalWidth returns the width query reports, falling back to the
+// COLUMNS variable read with getenv and then to defaultTerminalWidth when
+// either fails or gives no positive width.
+func detectTerminalWidth(query func() (int, error), getenv func(string) string) int {
+	if w, err := query(); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(strings.TrimSpace(getenv("COLUMNS"))); err == nil && w > 0 {
+		return w
+	}
+	return defaultTerminalWidth
+}
+
+// textWidth returns the width text output is laid out for: width if it was
+// given with --width, or else the width of the terminal, in either case at
+// least minTextWidth.
+func textWidth(width int) int {
+	if width <= 0 {
+		width = terminalWidth()
+	}
+	return max(width, minTextWidth)
+}
+
+// parseWidth parses the value of a --width=<n> flag, which must be at least
+// minTextWidth.
+func parseWidth(arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "--width="))
+	if err != nil || n < minTextWidth {
+		return 0, withKind(ErrInvalidParameter, fmt.Errorf("invalid width option: %s (must be at least %d)", arg, minTextWidth))
+	}
+	return n, nil
+}
+
+// truncateLabel returns s cut to at most n bytes, the labels of text output
+// being ASCII.
+func truncateLabel(s string, n int) string {
+	if len(s) > n {
+		return s[:max(n, 0)]
+	}
+	return s
+}
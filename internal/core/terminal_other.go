@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package core
+
+import "errors"
+
+// stdoutWidth reports that the terminal can't be asked for its width on
+// this OS, leaving it to COLUMNS.
+func stdoutWidth() (int, error) {
+	return 0, errors.New("the terminal width can't be queried on this OS")
+}
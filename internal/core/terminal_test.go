@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectTerminalWidth(t *testing.T) {
+	failing := func() (int, error) { return 0, errors.New("not a terminal") }
+	tests := []struct {
+		name    string
+		query   func() (int, error)
+		columns string
+		want    int
+	}{
+		{"terminal", func() (int, error) { return 132, nil }, "100", 132},
+		{"terminal of no columns", func() (int, error) { return 0, nil }, "100", 100},
+		{"COLUMNS", failing, "100", 100},
+		{"COLUMNS with spaces", failing, " 42\n", 42},
+		{"malformed COLUMNS", failing, "wide", defaultTerminalWidth},
+		{"negative COLUMNS", failing, "-5", defaultTerminalWidth},
+		{"nothing", failing, "", defaultTerminalWidth},
+	}
+	for _, tt := range tests {
+		getenv := func(k string) string {
+			if k == "COLUMNS" {
+				return tt.columns
+			}
+			return ""
+		}
+		if got := detectTerminalWidth(tt.query, getenv); got != tt.want {
+			t.Errorf("%s: width %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateLabel(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"  0- 15", 7, "  0- 15"},
+		{"  0- 15", 3, "  0"},
+		{"abc", 0, ""},
+		{"abc", -1, ""},
+	} {
+		if got := truncateLabel(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateLabel(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin
+
+package core
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// winsize is the struct the TIOCGWINSZ ioctl fills in.
+type winsize struct {
+	Rows, Cols, XPixel, YPixel uint16
+}
+
+// stdoutWidth asks the terminal on standard output for its number of
+// columns, which fails when standard output isn't a terminal.
+func stdoutWidth() (int, error) {
+	var ws winsize
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws))); errno != 0 {
+		return 0, errno
+	}
+	return int(ws.Cols), nil
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Modes of the header --thumbnail flag.
+const (
+	ThumbnailAuto  = "auto" // Pick one of the others from the environment, see DetectThumbnailMode
+	ThumbnailSixel = "sixel"
+	ThumbnailITerm = "iterm"
+	ThumbnailASCII = "ascii"
+)
+
+// thumbnailModes lists the values of --thumbnail.
+var thumbnailModes = []string{ThumbnailAuto, ThumbnailSixel, ThumbnailITerm, ThumbnailASCII}
+
+// Largest sides of thumbnails: in pixels for terminals that show images, and
+// in characters for ASCII previews.
+const (
+	thumbnailPixels = 128
+	thumbnailChars  = 64
+)
+
+// asciiRamp are the characters of ASCII previews, from dark to bright.
+const asciiRamp = " .:-=+*#%@"
+
+// HeaderOptions stores the flags of the header command.
+type HeaderOptions struct {
+	Thumbnail        string // Thumbnail mode, "" for no thumbnail
+	Comments         bool   // Also print the comments of the file
+	EncodingAnalysis bool   // Also print which BMP encoding stores the image in the fewest bytes
+	Width            int    // Width of ASCII previews in characters, 0 for the default
+	Verbose          bool   // Also print the warnings of the decoder about the file
+}
+
+// ParseHeaderArgs parses the header command arguments: the optional
+// --thumbnail, --width, --comments, --encoding-analysis and --verbose flags,
+// then the file.
+func ParseHeaderArgs(args []string) (HeaderOptions, string, error) {
+	var opts HeaderOptions
+	if len(args) < 1 {
+		return opts, "", ErrIncorrectArgument
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		switch {
+		case arg == "--thumbnail":
+			opts.Thumbnail = ThumbnailAuto
+		case strings.HasPrefix(arg, "--thumbnail="):
+			opts.Thumbnail = strings.TrimPrefix(arg, "--thumbnail=")
+			if !slices.Contains(thumbnailModes, opts.Thumbnail) {
+				return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("invalid thumbnail option: %s (must be one of %s)", arg, strings.Join(thumbnailModes, ", ")))
+			}
+		case strings.HasPrefix(arg, "--width="):
+			n, err := parseWidth(arg)
+			if err != nil {
+				return opts, "", err
+			}
+			opts.Width = n
+		case arg == "--comments":
+			opts.Comments = true
+		case arg == "--encoding-analysis":
+			opts.EncodingAnalysis = true
+		case arg == "--verbose":
+			opts.Verbose = true
+		default:
+			return opts, "", withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
+		}
+	}
+	return opts, args[len(args)-1], nil
+}
+
+// DetectThumbnailMode picks the thumbnail mode for the terminal the
+// environment, read with getenv, describes: iTerm2 and WezTerm show inline
+// images, a TERM naming sixel or a terminal known to support it shows sixel
+// graphics, and any other gets an ASCII preview.
+func DetectThumbnailMode(getenv func(string) string) string {
+	switch program := getenv("TERM_PROGRAM"); program {
+	case "iTerm.app", "WezTerm":
+		return ThumbnailITerm
+	}
+	switch term := getenv("TERM"); {
+	case strings.Contains(term, "sixel"), term == "mlterm", strings.HasPrefix(term, "yaft"), strings.HasPrefix(term, "foot"):
+		return ThumbnailSixel
+	}
+	return ThumbnailASCII
+}
+
+// WriteThumbnail writes a preview of image to w in the given mode, which
+// must not be ThumbnailAuto. ASCII previews are width characters wide at
+// most, or if width is 0 thumbnailChars or the width of the terminal,
+// whichever is narrower.
+func WriteThumbnail(w io.Writer, image *BMPImage, mode string, width int) error {
+	switch mode {
+	case ThumbnailSixel:
+		return EncodeSixel(w, fitThumbnail(image, thumbnailPixels, thumbnailPixels))
+	case ThumbnailITerm:
+		return EncodeITerm(w, fitThumbnail(image, thumbnailPixels, thumbnailPixels))
+	}
+	if width <= 0 {
+		width = min(thumbnailChars, textWidth(0))
+	}
+	width = max(width, minTextWidth)
+	// Characters are about twice as tall as they are wide
+	return EncodeASCII(w, fitThumbnail(image, width, width/2))
+}
+
+// fitThumbnail returns image scaled down with the box filter to fit in
+// width by height, keeping its aspect ratio, or image itself if it fits.
+func fitThumbnail(image *BMPImage, width, height int) *BMPImage {
+	w, h := int(image.InfoHeader.Width), len(image.Data)
+	if w <= width && h <= height {
+		return image
+	}
+	scale := min(float64(width)/float64(w), float64(height)/float64(h))
+	return resizeBox(image, max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale)))
+}
+
+// EncodeITerm writes image to w as an iTerm2 inline image: the OSC 1337
+// File escape sequence carrying the image as a base64 PNG.
+func EncodeITerm(w io.Writer, image *BMPImage) error {
+	var png bytes.Buffer
+	if err := Encode(&png, image, SaveOptions{Format: FormatPNG}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;width=%dpx;height=%dpx;preserveAspectRatio=1:%s\a\n",
+		png.Len(), image.InfoHeader.Width, len(image.Data), base64.StdEncoding.EncodeToString(png.Bytes()))
+	return err
+}
+
+// sixelColor returns the index of p in the 6x6x6 color cube sixel images are
+// drawn with, and the levels of its red, green and blue, from 0 to 5.
+func sixelColor(p Pixel) (int, [3]int) {
+	level := func(c byte) int { return divRound(int(c)*5, 255) }
+	r, g, b := level(p.Red), level(p.Green), level(p.Blue)
+	return r*36 + g*6 + b, [3]int{r, g, b}
+}
+
+// EncodeSixel writes image to w as a sixel graphic, its colors rounded to
+// the 216 of a 6x6x6 cube, of which only those used are defined. Every band
+// of six rows is drawn one color at a time, runs of four or more identical
+// sixels compressed.
+func EncodeSixel(w io.Writer, image *BMPImage) error {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	bw := bufio.NewWriter(w)
+
+	indices := make([][]int, height)
+	used := map[int][3]int{}
+	for y, row := range image.Rows() {
+		indices[y] = make([]int, width)
+		for x, p := range row {
+			i, levels := sixelColor(p)
+			indices[y][x], used[i] = i, levels
+		}
+	}
+	colors := make([]int, 0, len(used))
+	for i := range used {
+		colors = append(colors, i)
+	}
+	slices.Sort(colors)
+
+	fmt.Fprintf(bw, "\x1bPq\"1;1;%d;%d", width, height)
+	for _, i := range colors {
+		l := used[i]
+		fmt.Fprintf(bw, "#%d;2;%d;%d;%d", i, l[0]*20, l[1]*20, l[2]*20)
+	}
+
+	sixels := make([]byte, width)
+	for top := 0; top < height; top += 6 {
+		for _, i := range colors {
+			found := false
+			for x := range sixels {
+				var bits byte
+				for dy := range min(6, height-top) {
+					if indices[top+dy][x] == i {
+						bits |= 1 << dy
+					}
+				}
+				sixels[x] = '?' + bits
+				found = found || bits != 0
+			}
+			if !found {
+				continue
+			}
+			fmt.Fprintf(bw, "#%d", i)
+			writeSixelRuns(bw, sixels)
+			bw.WriteByte('$')
+		}
+		bw.WriteByte('-')
+	}
+	bw.WriteString("\x1b\\")
+	return bw.Flush()
+}
+
+// writeSixelRuns writes sixels to w, runs of four or more of the same one
+// as a repeat introducer.
+func writeSixelRuns(w *bufio.Writer, sixels []byte) {
+	for x := 0; x < len(sixels); {
+		n := 1
+		for x+n < len(sixels) && sixels[x+n] == sixels[x] {
+			n++
+		}
+		if n >= 4 {
+			fmt.Fprintf(w, "!%d%c", n, sixels[x])
+		} else {
+			w.Write(sixels[x : x+n])
+		}
+		x += n
+	}
+}
+
+// EncodeASCII writes image to w as text, a character of asciiRamp per pixel
+// by its luminance and a line per row.
+func EncodeASCII(w io.Writer, image *BMPImage) error {
+	bw := bufio.NewWriter(w)
+	for _, row := range image.Rows() {
+		for _, p := range row {
+			bw.WriteByte(asciiRamp[int(luminance(p))*len(asciiRamp)/256])
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
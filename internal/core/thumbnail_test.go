@@ -0,0 +1,154 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// thumbnailFixture returns a 2x2 image: red and black on top, white and red
+// below.
+func thumbnailFixture() *BMPImage {
+	var (
+		red   = Pixel{Red: 255}
+		white = Pixel{Red: 255, Green: 255, Blue: 255}
+	)
+	image := NewImage(2, 2)
+	image.Set(0, 0, red)
+	image.Set(0, 1, white)
+	image.Set(1, 1, red)
+	return image
+}
+
+func TestEncodeSixel(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeSixel(&buf, thumbnailFixture()); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1bPq\"1;1;2;2#0;2;0;0;0#180;2;100;0;0#215;2;100;100;100#0?@$#180@A$#215A?$-\x1b\\"
+	if got := buf.String(); got != want {
+		t.Errorf("sixel\n%q, want\n%q", got, want)
+	}
+
+	// Runs of a sixel are compressed, and bands are six rows
+	buf.Reset()
+	if err := EncodeSixel(&buf, solidImage(9, 7, Pixel{Blue: 255})); err != nil {
+		t.Fatal(err)
+	}
+	want = "\x1bPq\"1;1;9;7#5;2;0;0;100#5!9~$-#5!9@$-\x1b\\"
+	if got := buf.String(); got != want {
+		t.Errorf("sixel\n%q, want\n%q", got, want)
+	}
+}
+
+func TestEncodeITerm(t *testing.T) {
+	image := thumbnailFixture()
+	var buf bytes.Buffer
+	if err := EncodeITerm(&buf, image); err != nil {
+		t.Fatal(err)
+	}
+	var png bytes.Buffer
+	if err := Encode(&png, image, SaveOptions{Format: FormatPNG}); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1b]1337;File=inline=1;size=" + strconv.Itoa(png.Len()) + ";width=2px;height=2px;preserveAspectRatio=1:" +
+		base64.StdEncoding.EncodeToString(png.Bytes()) + "\a\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("iTerm sequence\n%q, want\n%q", got, want)
+	}
+
+	// The payload is the image itself
+	payload := strings.TrimSuffix(want[strings.IndexByte(want, ':')+1:], "\a\n")
+	data, _ := base64.StdEncoding.DecodeString(payload)
+	decoded, err := DecodeImage(data)
+	if err != nil {
+		t.Fatalf("decoding the payload: %v", err)
+	}
+	if !gridsEqual(decoded.Data, image.Data) {
+		t.Error("the payload doesn't hold the image")
+	}
+}
+
+func TestEncodeASCII(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeASCII(&buf, thumbnailFixture()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), ": \n@:\n"; got != want {
+		t.Errorf("ASCII preview %q, want %q", got, want)
+	}
+}
+
+func TestWriteThumbnailFits(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteThumbnail(&buf, noiseImage(300, 90, 1), ThumbnailASCII, thumbnailChars); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 19 || len(lines[0]) != 64 {
+		t.Errorf("ASCII preview of a 300x90 image is %dx%d, want 64x19", len(lines[0]), len(lines))
+	}
+
+	for _, width := range []int{20, 80, 200} {
+		buf.Reset()
+		if err := WriteThumbnail(&buf, noiseImage(300, 90, 1), ThumbnailASCII, width); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		for _, line := range lines {
+			if len(line) != len(lines[0]) || len(line) > width {
+				t.Fatalf("width %d: line of %d characters, the first of %d", width, len(line), len(lines[0]))
+			}
+		}
+		if want := min(width, 300); len(lines[0]) != want {
+			t.Errorf("width %d: preview %d wide, want %d", width, len(lines[0]), want)
+		}
+	}
+}
+
+func TestDetectThumbnailMode(t *testing.T) {
+	tests := []struct {
+		program, term, want string
+	}{
+		{"iTerm.app", "xterm-256color", ThumbnailITerm},
+		{"WezTerm", "xterm-256color", ThumbnailITerm},
+		{"", "xterm-sixel", ThumbnailSixel},
+		{"", "mlterm", ThumbnailSixel},
+		{"Apple_Terminal", "xterm-256color", ThumbnailASCII},
+		{"", "", ThumbnailASCII},
+	}
+	for _, tt := range tests {
+		env := map[string]string{"TERM_PROGRAM": tt.program, "TERM": tt.term}
+		if got := DetectThumbnailMode(func(k string) string { return env[k] }); got != tt.want {
+			t.Errorf("TERM_PROGRAM=%q TERM=%q: mode %s, want %s", tt.program, tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeaderArgs(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want HeaderOptions
+	}{
+		{[]string{"a.bmp"}, HeaderOptions{}},
+		{[]string{"--thumbnail", "a.bmp"}, HeaderOptions{Thumbnail: ThumbnailAuto}},
+		{[]string{"--thumbnail=sixel", "a.bmp"}, HeaderOptions{Thumbnail: ThumbnailSixel}},
+		{[]string{"--comments", "--thumbnail=ascii", "a.bmp"}, HeaderOptions{Thumbnail: ThumbnailASCII, Comments: true}},
+		{[]string{"--thumbnail=ascii", "--width=20", "a.bmp"}, HeaderOptions{Thumbnail: ThumbnailASCII, Width: 20}},
+		{[]string{"--verbose", "a.bmp"}, HeaderOptions{Verbose: true}},
+	} {
+		opts, file, err := ParseHeaderArgs(tt.args)
+		if err != nil || opts != tt.want || file != "a.bmp" {
+			t.Errorf("ParseHeaderArgs(%q) = %+v, %q, %v; want %+v, a.bmp", tt.args, opts, file, err, tt.want)
+		}
+	}
+	if _, _, err := ParseHeaderArgs([]string{"--thumbnail=kitty", "a.bmp"}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("unknown mode: error %v, want ErrInvalidParameter", err)
+	}
+	if _, _, err := ParseHeaderArgs([]string{"--width=19", "a.bmp"}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("width under 20: error %v, want ErrInvalidParameter", err)
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// DefaultTileRows is the band height used by tiled mode when none is given.
+const DefaultTileRows = 64
+
+// BlurTiled box-blurs the BMP read from r and writes the result to w without
+// decoding the whole image. The image is processed in horizontal bands of
+// bandHeight rows; each band is read together with blurRadius rows of context
+// above and below it, so memory is proportional to bandHeight+2*blurRadius
+// rows rather than to the image height.
+//
+// Every output row is computed by the same kernel as the in-memory blur from
+// exactly the same source rows, so the result is byte-identical to applying
+// the blur filter to the fully decoded image.
+func BlurTiled(r io.Reader, w io.Writer, blurRadius, bandHeight int) error {
+	if bandHeight < 1 {
+		return ErrIncorrectArgument
+	}
+
+	br, err := NewBMPReader(r)
+	if err != nil {
+		return err
+	}
+	if br.Alpha {
+		return ErrTiledAlpha
+	}
+	bw, err := NewBMPWriter(w, br.Image)
+	if err != nil {
+		return err
+	}
+
+	width := int(br.Image.InfoHeader.Width)
+	height := utils.Abs(int(br.Image.InfoHeader.Height))
+
+	// window holds the source rows [first, first+len(window)).
+	var window [][]Pixel
+	first := 0
+	rowAt := func(y int) []Pixel { return window[y-first] }
+	out := make([][]Pixel, bandHeight)
+	for i := range out {
+		out[i] = make([]Pixel, width)
+	}
+
+	for start := 0; start < height; start += bandHeight {
+		end := min(start+bandHeight, height)
+		lo := max(0, start-blurRadius)
+		hi := min(height, end+blurRadius)
+
+		// Drop the rows no longer needed by this band and read the new ones.
+		if drop := min(lo-first, len(window)); drop > 0 {
+			window = window[drop:]
+			first += drop
+		}
+		for first+len(window) < hi {
+			row := make([]Pixel, width)
+			if err := br.ReadRow(row); err != nil {
+				bw.Close()
+				return err
+			}
+			window = append(window, row)
+		}
+
+		blurRows(out[:end-start], rowAt, start, height, blurRadius, EdgeShrink)
+		for _, row := range out[:end-start] {
+			if err := bw.WriteRow(row); err != nil {
+				bw.Close()
+				return err
+			}
+		}
+	}
+
+	return bw.Close()
+}
+
+// ApplyTiled runs a pipeline in tiled mode, streaming inFile to outFile in
+// bands of bandHeight rows. Only a pipeline made of a single blur filter with
+// the shrink edge mode can be streamed, since the other modes may read rows
+// far from the band; anything else returns ErrTiledUnsupported. The output is
+// always a 24-bit BMP, written to standard output if outFile is "-".
+func ApplyTiled(transforms []Transform, inFile, outFile string, bandHeight int) error {
+	if len(transforms) != 1 || transforms[0].Type != FilterTransform ||
+		transforms[0].Options.(FilterOptions).FilterType != "blur" || transforms[0].Options.(FilterOptions).Region != nil ||
+		transforms[0].Options.(FilterOptions).Opacity != nil {
+		return ErrTiledUnsupported
+	}
+	radius, mode, err := transforms[0].Options.(FilterOptions).blurArgs()
+	if err != nil {
+		return withKind(ErrInvalidParameter, err)
+	}
+	if mode != EdgeShrink {
+		return ErrTiledUnsupported
+	}
+	if format := OutputFormat(outFile, SaveOptions{}); format != FormatBMP24 {
+		return withKind(ErrUnsupported, fmt.Errorf("tiled mode only writes %s output, not %s", FormatBMP24, format))
+	}
+
+	in, _, err := openInput(inFile)
+	if err != nil {
+		return ioError(err)
+	}
+	defer in.Close()
+
+	if outFile == "-" {
+		return ioError(BlurTiled(in, os.Stdout, radius, bandHeight))
+	}
+
+	out, err := createAtomic(outFile)
+	if err != nil {
+		return ioError(err)
+	}
+
+	if err := BlurTiled(in, out, radius, bandHeight); err != nil {
+		out.Abort()
+		return err
+	}
+	return ioError(out.Commit())
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestBlurTiledMatchesFullBlur(t *testing.T) {
+	tests := []struct {
+		width, height int
+		radius, band  int
+	}{
+		{1, 1, 1, 1},
+		{3, 7, 1, 2},
+		{5, 40, 3, 4},
+		{17, 33, 5, 1},
+		{31, 64, 10, 16},
+		{64, 100, 20, 7},
+		{101, 90, 4, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dx%d_r%d_b%d", tt.width, tt.height, tt.radius, tt.band), func(t *testing.T) {
+			src := encodeBMP(t, noiseImage(tt.width, tt.height, 1))
+
+			full, err := ParseBMP(src)
+			if err != nil {
+				t.Fatalf("ParseBMP: %v", err)
+			}
+			Filter(full, FilterOptions{FilterType: "blur", BlurRadius: tt.radius})
+			want := encodeBMP(t, full)
+
+			var got bytes.Buffer
+			if err := BlurTiled(bytes.NewReader(src), &got, tt.radius, tt.band); err != nil {
+				t.Fatalf("BlurTiled: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("tiled output differs from the full blur (%d vs %d bytes)", got.Len(), len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
+)
+
+// tinyTransforms covers every filter, with its edge modes and channel modes,
+// both mirrors, both rotations and trivial crops. Arguments that go together
+// are separated by spaces.
+var tinyTransforms = []string{
+	"--filter=blue", "--filter=green:luma", "--filter=red:tint", "--filter=grayscale", "--filter=negative",
+	"--pixelate-size=1 --filter=pixelate", "--filter=blur", "--filter=blur:1:clamp", "--filter=blur:3:mirror", "--filter=blur:2:wrap",
+	"--filter=levels:16:235", "--filter=autocontrast:5", "--filter=gamma:2.2", "--filter=curve:rgb:64/48,192/208",
+	"--filter=adaptivethreshold:3:5", "--filter=localcontrast:2:0.5",
+	"--filter=kuwahara:2",
+	"--filter=erode:1", "--filter=dilate:3", "--filter=open:2", "--filter=close:1",
+	"--mirror=horizontal", "--mirror=vertical", "--rotate=right", "--rotate=left", "--rotate=180",
+	"--crop=0-0", "--crop=center", "--crop=bottom:0.1", "--crop=right:0.1",
+	"--affine=1,0.5,0,0,1,0", "--affine-fit=0.8,-0.6,0,0.6,0.8,0:white",
+	"--kaleidoscope=2", "--kaleidoscope=4", "--kaleidoscope=6",
+	"--scroll=x:3", "--scroll=y:-5",
+	"--expr=r=(r+g)/2;b=255-b+x*y/w/h",
+}
+
+func TestTransformsOnTinyImages(t *testing.T) {
+	if missing := len(FilterNames) - countFilters(tinyTransforms); missing != 0 {
+		t.Fatalf("%d filters are missing from tinyTransforms", missing)
+	}
+
+	for _, size := range [][2]int{{1, 1}, {1, 7}, {7, 1}, {2, 2}} {
+		for _, wide := range []bool{false, true} {
+			for _, arg := range tinyTransforms {
+				name := fmt.Sprintf("%dx%d/wide=%v/%s", size[0], size[1], wide, arg)
+				t.Run(name, func(t *testing.T) {
+					transforms, _, _, err := ParseTransformations(append(strings.Fields(arg), "in.bmp", "out.bmp"))
+					if err != nil {
+						t.Fatalf("ParseTransformations: %v", err)
+					}
+					image := withAlpha(noiseImage(size[0], size[1], 1))
+					if wide {
+						image.Widen()
+					}
+
+					width, height := size[0], size[1]
+					for _, tr := range transforms {
+						width, height = tr.Options.Dimensions(width, height)
+					}
+					if err := ApplyTransformations(image, transforms); err != nil {
+						t.Fatalf("ApplyTransformations: %v", err)
+					}
+					checkShape(t, image, width, height)
+				})
+			}
+		}
+	}
+}
+
+func TestTinyImagesRoundTrip(t *testing.T) {
+	pairs := [][2]string{
+		{"--mirror=horizontal", "--mirror=horizontal"},
+		{"--mirror=vertical", "--mirror=vertical"},
+		{"--rotate=right", "--rotate=left"},
+		{"--rotate=180", "--rotate=180"},
+		{"--filter=negative", "--filter=negative"},
+		{"--crop=0-0", "--crop=center:1"},
+		{"--pixelate-size=1", "--filter=pixelate"},
+		{"--filter=levels:0:255", "--filter=gamma:1"},
+	}
+
+	for _, size := range [][2]int{{1, 1}, {1, 7}, {7, 1}, {2, 2}} {
+		for _, pair := range pairs {
+			t.Run(fmt.Sprintf("%dx%d/%s", size[0], size[1], pair[0]), func(t *testing.T) {
+				transforms, _, _, err := ParseTransformations([]string{pair[0], pair[1], "in.bmp", "out.bmp"})
+				if err != nil {
+					t.Fatalf("ParseTransformations: %v", err)
+				}
+				image := noiseImage(size[0], size[1], 2)
+				original := image.Clone()
+				if err := ApplyTransformations(image, transforms); err != nil {
+					t.Fatalf("ApplyTransformations: %v", err)
+				}
+				if !gridsEqual(image.Data, original.Data) {
+					t.Error("the image changed")
+				}
+			})
+		}
+	}
+}
+
+// countFilters returns how many distinct filters args apply.
+func countFilters(args []string) int {
+	seen := map[string]bool{}
+	for _, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			if value, ok := strings.CutPrefix(field, "--filter="); ok {
+				seen[strings.Split(value, ":")[0]] = true
+			}
+		}
+	}
+	return len(seen)
+}
+
+// checkShape checks that the headers and every plane of image agree on the
+// given dimensions.
+func checkShape(t *testing.T, image *BMPImage, width, height int) {
+	t.Helper()
+	if w, h := int(image.InfoHeader.Width), utils.Abs(int(image.InfoHeader.Height)); w != width || h != height {
+		t.Fatalf("headers say %dx%d, want %dx%d", w, h, width, height)
+	}
+	if len(image.Data) != height {
+		t.Fatalf("%d rows, want %d", len(image.Data), height)
+	}
+	for y, row := range image.Data {
+		if len(row) != width {
+			t.Fatalf("row %d has %d pixels, want %d", y, len(row), width)
+		}
+	}
+	if image.Alpha != nil && (len(image.Alpha) != height || len(image.Alpha[0]) != width) {
+		t.Fatalf("alpha is %dx%d, want %dx%d", len(image.Alpha[0]), len(image.Alpha), width, height)
+	}
+	if image.Wide != nil && (len(image.Wide) != height || len(image.Wide[0]) != width) {
+		t.Fatalf("wide pixels are %dx%d, want %dx%d", len(image.Wide[0]), len(image.Wide), width, height)
+	}
+}
@@ -0,0 +1,459 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// HelpTopic documents a flag or a filter of apply for bitmap help.
+type HelpTopic struct {
+	Name     string   // Flag name without the dashes, or filter name
+	Aliases  []string // Other names the topic is found under
+	Syntax   string
+	Summary  string
+	Default  string // Default values, if any
+	Examples [2]string
+}
+
+// HelpTopics lists a topic for every transformation flag of apply and every
+// filter, followed by some of the other flags of apply, in the order they
+// are listed by bitmap help. The accepted values and the defaults are taken
+// from the tables and constants the parsers use, so they can't go stale. MissingHelpTopics reports the transformations and
+// filters that have no topic.
+var HelpTopics = []HelpTopic{
+	{
+		Name:   "mirror",
+		Syntax: "--mirror=" + choice(names(mirrorDirections, false)...),
+		Summary: "Flips the image left to right (" + strings.Join(names(mirrorDirections[:1], true), ", ") +
+			") or top to bottom (" + strings.Join(names(mirrorDirections[1:], true), ", ") + ").",
+		Examples: [2]string{
+			"bitmap apply --mirror=horizontal in.bmp out.bmp",
+			"bitmap apply --mirror=v --mirror=h in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "filter",
+		Aliases: []string{"filters"},
+		Syntax:  "--filter=<name>[:<param>...]",
+		Summary: "Applies a filter; can be given several times. The filters are " + strings.Join(FilterNames, ", ") +
+			`. Use "bitmap help <filter>" for the parameters of each. Any filter takes a last :opacity=<0-100> ` +
+			`that blends the result over the original, 100 being the full effect and 0 none.`,
+		Examples: [2]string{
+			"bitmap apply --filter=grayscale:opacity=50 in.bmp out.bmp",
+			"bitmap apply --filter=blur:5:mirror --filter=negative in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "rotate",
+		Syntax:  "--rotate=" + choice(names(rotateAngles, true)...),
+		Summary: "Rotates the image clockwise by the angle; right is 90 and left is -90. Can be given several times.",
+		Examples: [2]string{
+			"bitmap apply --rotate=right in.bmp out.bmp",
+			"bitmap apply --rotate=180 in.bmp out.bmp",
+		},
+	},
+	{
+		Name: "crop",
+		Syntax: "--crop=<x>-<y>[-<width>-<height>] or --crop=" + choice(cropRegions...) + "[:<fraction>]" +
+			" or --crop=" + choice(cropRanges...) + ":<start>-<end>",
+		Summary: "Keeps the area with its top-left corner at (x, y), to the right and bottom edges if no size is given, " +
+			"the named part of the image, or a range of rows or columns across the whole image, from start up to but not including end. " +
+			"Top and left round down, bottom and right round up.",
+		Default: fmt.Sprintf("fraction %g", defaultCropFraction),
+		Examples: [2]string{
+			"bitmap apply --crop=20-20-100-100 in.bmp out.bmp",
+			"bitmap apply --crop=top:0.33 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "tee",
+		Syntax:  "--tee=<path>",
+		Summary: "Saves the image as it is at this point of the pipeline, in the format of the path extension.",
+		Examples: [2]string{
+			"bitmap apply --filter=grayscale --tee=gray.bmp --filter=blur in.bmp out.bmp",
+			"bitmap apply --crop=center --tee=crop.png --rotate=right in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "guides",
+		Syntax:  "--guides=" + choice(guidesSyntax()...) + "[:<color>]",
+		Summary: "Draws 1px guide lines over the image to judge a crop. Lines go on the nearest pixel, halves round up.",
+		Default: "color " + defaultGuideColorName,
+		Examples: [2]string{
+			"bitmap apply --guides=thirds in.bmp out.bmp",
+			"bitmap apply --guides=grid:4:00ff00 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "gradient",
+		Aliases: []string{"gradient-only"},
+		Syntax:  gradientSyntax(),
+		Summary: "Composites a gradient over the image; --gradient-only replaces the image with it. " +
+			"Angle 0 runs left to right and 90 top to bottom.",
+		Default: fmt.Sprintf("opacity %g", defaultGradientOpacity),
+		Examples: [2]string{
+			"bitmap apply --gradient=linear:90:#808080:#000000:0.6 in.bmp out.bmp",
+			"bitmap apply --gradient-only=radial:white:black in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "chop",
+		Syntax:  "--chop=" + choice(edges...) + ":<n>",
+		Summary: "Deletes n columns or rows at an edge of the image.",
+		Examples: [2]string{
+			"bitmap apply --chop=right:1 in.bmp out.bmp",
+			"bitmap apply --chop=top:10 --chop=bottom:10 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "extend",
+		Syntax:  "--extend=" + choice(edges...) + ":<n>",
+		Summary: "Grows the image by n columns or rows at an edge by repeating the outermost one.",
+		Examples: [2]string{
+			"bitmap apply --extend=bottom:2 in.bmp out.bmp",
+			"bitmap apply --chop=right:1 --extend=left:1 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "pixelate-mask",
+		Syntax:  "--pixelate-mask=<mask>:<blocksize>",
+		Summary: "Pixelates the blocks where a mask image of the same size is brighter than mid-gray. Blocks partly under the mask are pixelated whole.",
+		Examples: [2]string{
+			"bitmap apply --pixelate-mask=faces.bmp:16 in.bmp out.bmp",
+			"bitmap apply --pixelate-mask=plate.png:8 in.bmp out.png",
+		},
+	},
+	{
+		Name:    "region",
+		Aliases: []string{"feather"},
+		Syntax:  "--region=rect:<x>:<y>:<w>:<h> or --region=ellipse:<cx>:<cy>:<rx>:<ry>, optionally followed by --feather=<n>",
+		Summary: "Limits the next --filter to a region, blended in over a band of n pixels across its boundary with --feather.",
+		Default: fmt.Sprintf("feather %d (hard edge)", defaultFeather),
+		Examples: [2]string{
+			"bitmap apply --region=rect:0:0:100:50 --filter=blur in.bmp out.bmp",
+			"bitmap apply --region=ellipse:200:150:80:60 --feather=10 --filter=grayscale in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "affine",
+		Aliases: []string{"affine-fit"},
+		Syntax:  "--affine=<a>,<b>,<c>,<d>,<e>,<f>[:<color>] or --affine-fit=<a>,<b>,<c>,<d>,<e>,<f>[:<color>]",
+		Summary: "Maps every point (x, y) of the image to (a*x + b*y + c, d*x + e*y + f), measured from the top-left corner " +
+			"with y pointing down, sampling bilinearly. The matrix must be invertible. The output keeps the size of the image; " +
+			"--affine-fit sizes it to the bounding box of the transformed image instead. Uncovered pixels get the color.",
+		Default: "color black",
+		Examples: [2]string{
+			"bitmap apply --affine=1,0,10,0,1,-5 in.bmp out.bmp",
+			"bitmap apply --affine-fit=0.866,-0.5,0,0.5,0.866,0:white in.bmp out.bmp",
+		},
+	},
+	{
+		Name:   "kaleidoscope",
+		Syntax: "--kaleidoscope=<segments>",
+		Summary: "Makes the image symmetric around its center by mirroring a wedge of it into an even number of segments. " +
+			"2 mirrors the left half onto the right and 4 the top-left quadrant onto the others, pixel for pixel; higher counts " +
+			"reflect the wedge just left of straight up, sampled bilinearly. The image keeps its size.",
+		Examples: [2]string{
+			"bitmap apply --kaleidoscope=4 in.bmp out.bmp",
+			"bitmap apply --crop=center --kaleidoscope=8 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:   "scroll",
+		Syntax: "--scroll=x:<n> or --scroll=y:<n>",
+		Summary: "Moves the content of the image n pixels right (x) or down (y), negative values the other way; " +
+			"the pixels pushed off one edge reappear at the opposite one. n is taken modulo the width or height.",
+		Examples: [2]string{
+			"bitmap apply --scroll=x:64 in.bmp out.bmp",
+			"bitmap apply --scroll=x:-32 --scroll=y:32 texture.bmp preview.bmp",
+		},
+	},
+	{
+		Name:   "expr",
+		Syntax: "--expr=<channel>=<expression>[;<channel>=<expression>...]",
+		Summary: "Computes the r, g and b channels of every pixel from an expression over the input channels r, g and b, " +
+			"the position x and y from the top-left and the size w and h, with + - * /, parentheses, numbers and the functions " +
+			"min, max and clamp(v, lo, hi). Every expression reads the input pixel; results are rounded and clamped to 0-255, " +
+			"channels not assigned are kept, and division by zero gives 0. Slower than the built-in filters.",
+		Examples: [2]string{
+			"bitmap apply '--expr=r=(r+g)/2; b=255-b' in.bmp out.bmp",
+			"bitmap apply '--expr=r=r*(1-y/h); g=g*(1-y/h); b=b*(1-y/h)' in.bmp faded.bmp",
+		},
+	},
+	{
+		Name:    "blue",
+		Aliases: []string{"green", "red"},
+		Syntax:  "--filter=" + choice(FilterNames[blue], FilterNames[green], FilterNames[red]) + "[:" + strings.Join(channelModes, "|:") + "]",
+		Summary: "Keeps a single channel. With luma the channel is shown as gray, with tint the luminance is colored with the hue of the channel.",
+		Examples: [2]string{
+			"bitmap apply --filter=red in.bmp out.bmp",
+			"bitmap apply --filter=green:luma in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "grayscale",
+		Syntax:  "--filter=grayscale",
+		Summary: "Converts the image to shades of gray by its luminance.",
+		Examples: [2]string{
+			"bitmap apply --filter=grayscale in.bmp out.bmp",
+			"bitmap apply --filter=grayscale --format=gray8 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "negative",
+		Syntax:  "--filter=negative",
+		Summary: "Inverts every channel.",
+		Examples: [2]string{
+			"bitmap apply --filter=negative in.bmp out.bmp",
+			"bitmap apply --region=rect:0:0:50:50 --filter=negative in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "pixelate",
+		Syntax:  "--filter=pixelate",
+		Summary: "Replaces blocks of pixels with their average color.",
+		Default: fmt.Sprintf("block size %d, clamped to the image, or as set by --pixelate-size=<n>", defaultPixelateSize),
+		Examples: [2]string{
+			"bitmap apply --filter=pixelate in.bmp out.bmp",
+			"bitmap apply --region=ellipse:100:100:40:40 --filter=pixelate in.bmp out.bmp",
+		},
+	},
+	{
+		Name:   "blur",
+		Syntax: "--filter=blur[:<radius>[:" + choice(edgeModeList()...) + "]]",
+		Summary: "Box-blurs the image. The edge mode sets what is read past the edges: shrink averages fewer pixels, " +
+			"clamp repeats the edge pixel, mirror reflects the image and wrap tiles it.",
+		Default: fmt.Sprintf("radius %d, or as set by --blur-radius=<n>, edge %s", defaultBlurRadius, defaultBlurEdge),
+		Examples: [2]string{
+			"bitmap apply --filter=blur in.bmp out.bmp",
+			"bitmap apply --filter=blur:3:clamp in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "levels",
+		Syntax:  "--filter=levels:<black>:<white>",
+		Summary: "Stretches the levels from black to white over the full range; values outside it clip.",
+		Examples: [2]string{
+			"bitmap apply --filter=levels:16:235 in.bmp out.bmp",
+			"bitmap apply --precision=16 --filter=levels:30:200 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "autocontrast",
+		Syntax:  "--filter=autocontrast[:<clip%>]",
+		Summary: "Stretches the levels of the image over the full range, ignoring clip percent of the darkest and brightest pixels.",
+		Default: fmt.Sprintf("clip %g%%", defaultAutoContrastClip),
+		Examples: [2]string{
+			"bitmap apply --filter=autocontrast in.bmp out.bmp",
+			"bitmap apply --filter=autocontrast:0.5 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "gamma",
+		Syntax:  "--filter=gamma:<value>",
+		Summary: "Applies a gamma curve; values above 1 brighten the midtones, values below 1 darken them.",
+		Examples: [2]string{
+			"bitmap apply --filter=gamma:2.2 in.bmp out.bmp",
+			"bitmap apply --precision=16 --filter=gamma:2.2 --filter=gamma:0.4545 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "curve",
+		Syntax:  "--filter=curve:" + choice(curveChannels...) + ":<in>/<out>,...",
+		Summary: "Maps the levels of a channel through a monotone cubic curve through the points; 0/0 and 255/255 are implied.",
+		Examples: [2]string{
+			"bitmap apply --filter=curve:rgb:64/48,192/208 in.bmp out.bmp",
+			"bitmap apply --filter=curve:blue:128/100 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "adaptivethreshold",
+		Syntax:  "--filter=adaptivethreshold:<window>[:<bias>]",
+		Summary: "Turns the pixels brighter than the mean of the window around them, minus bias, white and the others black.",
+		Default: fmt.Sprintf("bias %d", defaultThresholdBias),
+		Examples: [2]string{
+			"bitmap apply --filter=adaptivethreshold:15 in.bmp out.bmp",
+			"bitmap apply --filter=adaptivethreshold:31:-10 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "localcontrast",
+		Syntax:  "--filter=localcontrast:<radius>:<amount>",
+		Summary: "Boosts detail against the local mean within radius (clarity). Changes are capped at 32 levels to avoid halos.",
+		Examples: [2]string{
+			"bitmap apply --filter=localcontrast:20:0.5 in.bmp out.bmp",
+			"bitmap apply --filter=localcontrast:50:1 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "kuwahara",
+		Syntax:  "--filter=kuwahara:<radius>",
+		Summary: "Sets every pixel to the mean of the least varied of the four squares of side radius+1 cornered on it, smoothing noise but not edges; painterly at large radii.",
+		Examples: [2]string{
+			"bitmap apply --filter=kuwahara:3 in.bmp out.bmp",
+			"bitmap apply --filter=kuwahara:8 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "erode",
+		Aliases: morphologyFilters[1:],
+		Syntax:  "--filter=" + choice(morphologyFilters...) + ":<radius>",
+		Summary: "Sets every channel to its minimum (erode) or maximum (dilate) over the square of the radius around the pixel. Open erodes then dilates, removing bright specks; close dilates then erodes, filling dark ones.",
+		Examples: [2]string{
+			"bitmap apply --filter=dilate:2 in.bmp out.bmp",
+			"bitmap apply --filter=adaptivethreshold:31 --filter=open:1 scan.bmp clean.bmp",
+		},
+	},
+	{
+		Name:    "format",
+		Syntax:  "--format=" + choice(OutputFormats...),
+		Summary: "Sets the format the output is encoded in. Needed when writing to - (standard output) or to a path without a known extension.",
+		Default: "the format of the output extension (.png, .jpg, .jpeg, .ppm, .pgm, .raw), else " + FormatBMP24,
+		Examples: [2]string{
+			"bitmap apply --format=png --filter=negative in.bmp out",
+			"bitmap apply --format=auto --filter=grayscale in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "jobs",
+		Syntax:  "--jobs=<n>",
+		Summary: "Runs the filters on n goroutines; 1 runs them sequentially. The output doesn't depend on n.",
+		Default: "one per CPU",
+		Examples: [2]string{
+			"bitmap apply --jobs=1 --filter=blur in.bmp out.bmp",
+			"bitmap apply --jobs=4 --filter=kuwahara:3 in.bmp out.bmp",
+		},
+	},
+	{
+		Name:    "tiled",
+		Syntax:  "--tiled[=<rows>]",
+		Summary: "Streams the image in bands of rows instead of decoding it whole. Only a single --filter=blur with the shrink edge mode is supported.",
+		Default: fmt.Sprintf("bands of %d rows", DefaultTileRows),
+		Examples: [2]string{
+			"bitmap apply --tiled --filter=blur:3 huge.bmp out.bmp",
+			"bitmap apply --tiled=256 --filter=blur huge.bmp out.bmp",
+		},
+	},
+}
+
+// FindHelpTopic returns the topic with the given name or alias. Leading
+// dashes are ignored, so a flag can be looked up as written.
+func FindHelpTopic(name string) (HelpTopic, bool) {
+	name = strings.TrimLeft(name, "-")
+	for _, t := range HelpTopics {
+		if t.Name == name || slices.Contains(t.Aliases, name) {
+			return t, true
+		}
+	}
+	return registeredHelpTopic(name)
+}
+
+// PrintHelpTopic prints the topic with the given name to w, or the usage of
+// the command with that name, or returns an error listing the available
+// topics if there is neither.
+func PrintHelpTopic(w io.Writer, name string) error {
+	if help, ok := commandHelp[name]; ok {
+		fmt.Fprint(w, help)
+		return nil
+	}
+	t, ok := FindHelpTopic(name)
+	if !ok {
+		return withKind(ErrInvalidParameter, fmt.Errorf("no help topic or command %s; the topics are: %s", name, strings.Join(helpTopicNames(), ", ")))
+	}
+
+	fmt.Fprintf(w, "Usage:\n  %s\n\nDescription:\n  %s\n", t.Syntax, t.Summary)
+	if t.Default != "" {
+		fmt.Fprintf(w, "\nDefaults:\n  %s\n", t.Default)
+	}
+	fmt.Fprintf(w, "\nExamples:\n  %s\n  %s\n", t.Examples[0], t.Examples[1])
+	return nil
+}
+
+// PrintHelpTopics prints the names of the help topics, with their aliases,
+// and of the commands to w.
+func PrintHelpTopics(w io.Writer) {
+	fmt.Fprintf(w, "Usage:\n  bitmap help <topic>\n  bitmap help <command>\n\nThe topics are:\n  %s\n", strings.Join(helpTopicNames(), "\n  "))
+	fmt.Fprintf(w, "\nThe commands are:\n  %s\n", strings.Join(slices.Sorted(maps.Keys(commandHelp)), "\n  "))
+}
+
+// helpTopicNames returns the names of the help topics, each followed by its
+// aliases in parentheses, and then those of the registered filters.
+func helpTopicNames() []string {
+	names := make([]string, len(HelpTopics))
+	for i, t := range HelpTopics {
+		names[i] = t.Name
+		if len(t.Aliases) > 0 {
+			names[i] += " (" + strings.Join(t.Aliases, ", ") + ")"
+		}
+	}
+	return append(names, registeredFilterNames()...)
+}
+
+// MissingHelpTopics returns the transformations and filters that have no
+// help topic.
+func MissingHelpTopics() []string {
+	var missing []string
+	for t := TransformationType(0); t.String() != "unknown"; t++ {
+		if _, ok := FindHelpTopic(t.String()); !ok {
+			missing = append(missing, t.String())
+		}
+	}
+	for _, f := range FilterNames {
+		if _, ok := FindHelpTopic(f); !ok {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// choice formats values as alternatives in a syntax line, as in <a|b|c>.
+func choice(values ...string) string {
+	return "<" + strings.Join(values, "|") + ">"
+}
+
+// names returns the names in list, followed by their aliases if aliases is set.
+func names(list []optionName, aliases bool) []string {
+	var out []string
+	for _, n := range list {
+		out = append(out, n.Name)
+		if aliases {
+			out = append(out, n.Aliases...)
+		}
+	}
+	return out
+}
+
+// guidesSyntax returns the guide kinds with the cell count grid takes.
+func guidesSyntax() []string {
+	kinds := slices.Clone(guideKinds)
+	for i, k := range kinds {
+		if k == "grid" {
+			kinds[i] = "grid:<n>"
+		}
+	}
+	return kinds
+}
+
+// gradientSyntax returns the forms of --gradient, one per kind of gradient.
+func gradientSyntax() string {
+	forms := make([]string, len(gradientKinds))
+	for i, k := range gradientKinds {
+		if k == "linear" {
+			k += ":<angle>"
+		}
+		forms[i] = "--gradient=" + k + ":<from>:<to>[:<opacity>][:normalized]"
+	}
+	return strings.Join(forms, " or ")
+}
+
+// edgeModeList returns the names of the edge modes in their order.
+func edgeModeList() []string {
+	var list []string
+	for m := EdgeMode(0); m.String() != "unknown"; m++ {
+		list = append(list, m.String())
+	}
+	return list
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEveryTransformAndFilterHasHelpTopic(t *testing.T) {
+	if missing := MissingHelpTopics(); len(missing) != 0 {
+		t.Errorf("no help topic for %s", strings.Join(missing, ", "))
+	}
+}
+
+func TestHelpTopicsListParserValues(t *testing.T) {
+	tests := []struct {
+		topic  string
+		values []string
+	}{
+		{"mirror", names(mirrorDirections, false)},
+		{"rotate", names(rotateAngles, true)},
+		{"crop", cropRegions},
+		{"crop", cropRanges},
+		{"guides", guideKinds},
+		{"gradient", gradientKinds},
+		{"chop", edges},
+		{"extend", edges},
+		{"region", regionShapes},
+		{"red", channelModes},
+		{"blur", edgeModeList()},
+		{"curve", curveChannels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			topic, ok := FindHelpTopic(tt.topic)
+			if !ok {
+				t.Fatalf("no help topic %s", tt.topic)
+			}
+			for _, v := range tt.values {
+				if !strings.Contains(topic.Syntax, v) {
+					t.Errorf("syntax %q doesn't list %s", topic.Syntax, v)
+				}
+			}
+		})
+	}
+}
+
+func TestHelpTopicsHaveExamples(t *testing.T) {
+	for _, topic := range HelpTopics {
+		for _, example := range topic.Examples {
+			if !strings.HasPrefix(example, "bitmap ") {
+				t.Errorf("topic %s: example %q is not a bitmap command", topic.Name, example)
+			}
+		}
+	}
+}
+
+func TestHelpTopicsOfCommands(t *testing.T) {
+	for _, name := range []string{"apply", "header"} {
+		var buf bytes.Buffer
+		if err := PrintHelpTopic(&buf, name); err != nil {
+			t.Fatalf("help %s: %v", name, err)
+		}
+		if got := buf.String(); got != commandHelp[name] || !strings.HasPrefix(got, "Usage:\n  bitmap "+name) {
+			t.Errorf("help %s prints %q, not the usage of the command", name, got)
+		}
+	}
+
+	// A command would hide the topic of the same name
+	for name := range commandHelp {
+		if _, ok := FindHelpTopic(name); ok {
+			t.Errorf("%s is both a command and a help topic", name)
+		}
+	}
+}
+
+func TestHelpTopicsOfFlags(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  []string // In the syntax or the defaults
+	}{
+		{"--format", append([]string{"--format="}, OutputFormats...)},
+		{"--jobs", []string{"--jobs=<n>", "one per CPU"}},
+		{"--tiled", []string{"--tiled[=<rows>]", fmt.Sprint(DefaultTileRows)}},
+		{"tiled", []string{"--tiled"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := PrintHelpTopic(&buf, tt.topic); err != nil {
+			t.Fatalf("help %s: %v", tt.topic, err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(buf.String(), s) {
+				t.Errorf("help %s doesn't mention %s:\n%s", tt.topic, s, buf.String())
+			}
+		}
+	}
+}
+
+func TestHelpTopicsList(t *testing.T) {
+	var buf bytes.Buffer
+	PrintHelpTopics(&buf)
+	for _, line := range []string{"filter (filters)", "format", "jobs", "tiled", "apply", "header"} {
+		if !strings.Contains(buf.String(), "\n  "+line+"\n") {
+			t.Errorf("the topic list doesn't have %q:\n%s", line, buf.String())
+		}
+	}
+
+	// The alias finds the topic it is listed with
+	var filter, filters bytes.Buffer
+	if err := PrintHelpTopic(&filter, "filter"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrintHelpTopic(&filters, "filters"); err != nil || filters.String() != filter.String() {
+		t.Errorf("help filters: %v, or not the filter topic", err)
+	}
+
+	err := PrintHelpTopic(&buf, "nope")
+	if !errors.Is(err, ErrInvalidParameter) || !strings.Contains(err.Error(), "filter (filters)") {
+		t.Errorf("unknown topic: %v, want ErrInvalidParameter listing the topics", err)
+	}
+}
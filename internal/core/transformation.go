@@ -1,8 +1,15 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/bitmap/internal/utils"
 )
 
 // TransformationType defines various types of transformations that can be applied to an image.
@@ -17,12 +24,102 @@ const (
 	RotateTransform
 	// CropTransform crops the image to a specified region.
 	CropTransform
+	// TeeTransform saves a snapshot of the image at its point in the pipeline.
+	TeeTransform
+	// GuidesTransform draws composition guides over the image for debugging crops.
+	GuidesTransform
+	// GradientTransform composites a generated gradient over the image, or replaces it.
+	GradientTransform
+	// ChopTransform deletes rows or columns from an edge of the image.
+	ChopTransform
+	// ExtendTransform duplicates the row or column at an edge of the image.
+	ExtendTransform
+	// PixelateMaskTransform pixelates the regions of the image selected by a mask image.
+	PixelateMaskTransform
+	// AffineTransform maps the image through an arbitrary 2x3 affine matrix.
+	AffineTransform
+	// KaleidoscopeTransform mirrors a wedge of the image around its center.
+	KaleidoscopeTransform
+	// ScrollTransform moves the image content along an axis with wrap-around.
+	ScrollTransform
+	// ExprTransform computes the channels of every pixel with an expression.
+	ExprTransform
+
+	// numTransformTypes is the number of transformation types, not one itself.
+	numTransformTypes
 )
 
+// TransformNames returns the flag names of every transformation type, in
+// the order of the types.
+func TransformNames() []string {
+	names := make([]string, numTransformTypes)
+	for t := range numTransformTypes {
+		names[t] = t.String()
+	}
+	return names
+}
+
+// String returns the flag name of the transformation type.
+func (t TransformationType) String() string {
+	switch t {
+	case MirrorTransform:
+		return "mirror"
+	case FilterTransform:
+		return "filter"
+	case RotateTransform:
+		return "rotate"
+	case CropTransform:
+		return "crop"
+	case TeeTransform:
+		return "tee"
+	case GuidesTransform:
+		return "guides"
+	case GradientTransform:
+		return "gradient"
+	case ChopTransform:
+		return "chop"
+	case ExtendTransform:
+		return "extend"
+	case PixelateMaskTransform:
+		return "pixelate-mask"
+	case AffineTransform:
+		return "affine"
+	case KaleidoscopeTransform:
+		return "kaleidoscope"
+	case ScrollTransform:
+		return "scroll"
+	case ExprTransform:
+		return "expr"
+	}
+	return "unknown"
+}
+
 // Transform represents a single transformation operation, storing its type and any options.
 type Transform struct {
 	Type    TransformationType
-	Options interface{} // Options vary depending on the transformation type
+	Options TransformOptions // Options vary depending on the transformation type
+}
+
+// TransformOptions is implemented by the options of every transformation type.
+// It lets a whole pipeline be checked against the image dimensions before
+// any of it is executed.
+type TransformOptions interface {
+	// Validate reports whether the transformation can be applied
+	// to an image of the given dimensions.
+	Validate(width, height int) error
+	// Dimensions returns the size of the image after the transformation.
+	Dimensions(width, height int) (int, int)
+	// MemoryMultiplier returns how many full copies of the pixel data are
+	// alive at once while the transformation runs.
+	MemoryMultiplier() int
+}
+
+// resolver is implemented by the options of the transformations whose
+// parameters have defaults or depend on the size of the image. resolved
+// returns the options with every parameter spelled out as the
+// transformation runs it on an image of the given dimensions.
+type resolver interface {
+	resolved(width, height int) TransformOptions
 }
 
 // MirrorOptions stores the direction for mirror transformations (e.g., "horizontal" or "vertical").
@@ -30,9 +127,96 @@ type MirrorOptions struct {
 	Direction string
 }
 
-// FilterOptions stores the type of filter to be applied (e.g., "grayscale", "negative").
+func (o MirrorOptions) Validate(width, height int) error        { return nil }
+func (o MirrorOptions) Dimensions(width, height int) (int, int) { return width, height }
+func (o MirrorOptions) MemoryMultiplier() int                   { return 1 }
+func (o MirrorOptions) String() string                          { return "mirror " + o.Direction }
+
+// FilterOptions stores the type of filter to be applied (e.g., "grayscale", "negative")
+// and its parameters, given after the name as in "autocontrast:0.5".
+// Region, if set by a preceding --region, limits the filter to part of the image.
+// Opacity, if set by an opacity=N suffix, blends the filtered image over the
+// original at N percent.
 type FilterOptions struct {
-	FilterType string
+	FilterType   string
+	Args         []string
+	Region       *Region
+	Opacity      *int // Percent of the filtered image kept, from 0 to 100; nil means 100
+	BlurRadius   int  // Blur radius when Args give none, from --blur-radius; 0 means defaultBlurRadius
+	PixelateSize int  // Pixelate block size, from --pixelate-size; 0 means defaultPixelateSize
+}
+
+func (o FilterOptions) Dimensions(width, height int) (int, int) { return width, height }
+
+// Validate rejects pixelate blocks given with --pixelate-size larger than
+// the whole image, which would flatten it to a single color, and images too
+// large for the summed-area table of the filters built on it. The default
+// block size is clamped to the image instead, see pixelateSize.
+func (o FilterOptions) Validate(width, height int) error {
+	if size := o.PixelateSize; o.FilterType == "pixelate" && size > width && size > height {
+		return withKind(ErrOutOfBounds, fmt.Errorf("pixelate block size %d is larger than the image", size))
+	}
+	if (o.FilterType == "adaptivethreshold" || o.FilterType == "localcontrast" || o.FilterType == "kuwahara") && uint64(width)*uint64(height) > maxIntegralPixels {
+		return withKind(ErrUnsupported, fmt.Errorf("image too large for the %s filter", o.FilterType))
+	}
+	return nil
+}
+
+// MemoryMultiplier is 2 for the blur, which writes into a new buffer,
+// and 1 for the filters that work in place, plus 1 for a copy of the
+// original pixels when the filter is limited to a region and 1 when it is
+// blended over them at a partial opacity.
+func (o FilterOptions) MemoryMultiplier() int {
+	n := 1
+	if o.FilterType == "blur" {
+		n = 2
+	}
+	if o.Region != nil {
+		n++
+	}
+	if o.Opacity != nil && *o.Opacity > 0 && *o.Opacity < 100 {
+		n++
+	}
+	return n
+}
+
+// resolved spells out the parameters the filter runs with in Args: the
+// radius and edge mode of a blur, the clip of autocontrast and the bias of
+// adaptivethreshold. The block size of pixelate, which takes no Args, is set
+// in PixelateSize.
+func (o FilterOptions) resolved(width, height int) TransformOptions {
+	switch o.FilterType {
+	case "blur":
+		radius, mode, _ := o.blurArgs()
+		o.Args = []string{strconv.Itoa(radius), mode.String()}
+		o.BlurRadius = 0
+	case "pixelate":
+		o.PixelateSize = o.pixelateSize(width, height)
+	case "autocontrast":
+		clip, _ := parseAutoContrastArgs(o.Args)
+		o.Args = []string{strconv.FormatFloat(clip, 'g', -1, 64)}
+	case "adaptivethreshold":
+		window, bias, _ := parseAdaptiveThresholdArgs(o.Args)
+		o.Args = []string{strconv.Itoa(window), strconv.Itoa(bias)}
+	}
+	return o
+}
+
+func (o FilterOptions) String() string {
+	s := "filter " + strings.Join(append([]string{o.FilterType}, o.Args...), ":")
+	if o.FilterType == "blur" && len(o.Args) == 0 && o.BlurRadius > 0 {
+		s += fmt.Sprintf(" radius %d", o.BlurRadius)
+	}
+	if o.FilterType == "pixelate" && o.PixelateSize > 0 {
+		s += fmt.Sprintf(" size %d", o.PixelateSize)
+	}
+	if o.Opacity != nil {
+		s += fmt.Sprintf(":opacity=%d", *o.Opacity)
+	}
+	if o.Region != nil {
+		s += " in " + o.Region.String()
+	}
+	return s
 }
 
 // RotateOptions stores the rotation angle (90 degrees left or right).
@@ -40,33 +224,98 @@ type RotateOptions struct {
 	Angle int
 }
 
+func (o RotateOptions) Validate(width, height int) error        { return nil }
+func (o RotateOptions) Dimensions(width, height int) (int, int) { return height, width }
+func (o RotateOptions) MemoryMultiplier() int                   { return 2 }
+
+func (o RotateOptions) String() string {
+	if o.Angle == -1 {
+		return "rotate left"
+	}
+	return "rotate right"
+}
+
+// TeeOptions stores the path the intermediate image is written to.
+type TeeOptions struct {
+	Path string
+}
+
+func (o TeeOptions) Validate(width, height int) error        { return nil }
+func (o TeeOptions) Dimensions(width, height int) (int, int) { return width, height }
+func (o TeeOptions) MemoryMultiplier() int                   { return 1 }
+func (o TeeOptions) String() string                          { return "tee " + o.Path }
+
+// optionName is a value of a command line option together with the other
+// spellings it is accepted under.
+type optionName struct {
+	Name    string
+	Aliases []string
+}
+
+// mirrorDirections are the values of --mirror.
+var mirrorDirections = []optionName{
+	{"horizontal", []string{"h", "horizontally", "hor"}},
+	{"vertical", []string{"v", "vertically", "ver"}},
+}
+
+// rotateAngles are the values of --rotate, clockwise: a quarter turn either
+// way or a half turn.
+var rotateAngles = []optionName{
+	{"right", []string{"90", "-270"}},
+	{"left", []string{"-90", "270"}},
+	{"180", []string{"-180"}},
+}
+
+// lookupName returns the name in names that s is, or is an alias of.
+func lookupName(names []optionName, s string) (string, bool) {
+	for _, n := range names {
+		if n.Name == s || slices.Contains(n.Aliases, s) {
+			return n.Name, true
+		}
+	}
+	return "", false
+}
+
 // ParseTransformations parses command-line arguments to extract a list of image transformations,
 // along with input and output file names. It handles multiple transformation flags, ensuring
-// the transformations are applied in the specified order.
+// the transformations are applied in the specified order. Its errors are of kind ErrInvalidParameter.
 func ParseTransformations(args []string) ([]Transform, string, string, error) {
-	var transforms []Transform
-
 	if len(args) < 2 {
 		return nil, "", "", ErrIncorrectArgument // Require at least input and output files.
 	}
 
-	inFile := args[len(args)-2]
-	outFile := args[len(args)-1]
+	transforms, err := parseTransformArgs(args[:len(args)-2])
+	if err != nil {
+		return nil, "", "", err
+	}
+	return transforms, args[len(args)-2], args[len(args)-1], nil
+}
+
+// parseTransformArgs is ParseTransformations for the transformation flags
+// alone.
+func parseTransformArgs(args []string) ([]Transform, error) {
+	var transforms []Transform
+
+	// A region, and its feathering, apply to the next filter only
+	var region *Region
+	feather := defaultFeather
+
+	// The default filter parameters apply to every filter, wherever given
+	blurRadius, pixelateSize := 0, 0
+
+	for _, arg := range args {
+		if region != nil && !strings.HasPrefix(arg, "--filter=") && !strings.HasPrefix(arg, "--feather=") {
+			return nil, withKind(ErrInvalidParameter, fmt.Errorf("--region must be followed by a --filter, not %s", arg))
+		}
 
-	for _, arg := range args[:len(args)-2] {
 		switch {
 		// Handle mirror transformations with various directional options.
 		case strings.HasPrefix(arg, "--mirror="):
 			opts := strings.Split(strings.TrimPrefix(arg, "--mirror="), ",")
 			for _, opt := range opts {
-				var direction string
-				switch opt {
-				case "horizontal", "h", "horizontally", "hor":
-					direction = "horizontal"
-				case "vertical", "v", "vertically", "ver":
-					direction = "vertical"
-				default:
-					return nil, "", "", fmt.Errorf("invalid mirror option: %s", opt)
+				direction, ok := lookupName(mirrorDirections, opt)
+				if !ok {
+					return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid mirror option: %s", opt))
 				}
 				transforms = append(transforms, Transform{
 					Type:    MirrorTransform,
@@ -76,40 +325,43 @@ func ParseTransformations(args []string) ([]Transform, string, string, error) {
 
 		// Handle filter transformations for different color effects.
 		case strings.HasPrefix(arg, "--filter="):
-			filterType := strings.TrimPrefix(arg, "--filter=")
-			switch filterType {
-			case "blue", "red", "green", "grayscale", "negative", "pixelate", "blur":
-				transforms = append(transforms, Transform{
-					Type:    FilterTransform,
-					Options: FilterOptions{FilterType: filterType},
-				})
-			default:
-				return nil, "", "", fmt.Errorf("invalid filter option: %s", filterType)
+			filterOpts, err := parseFilterOptions(strings.TrimPrefix(arg, "--filter="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			if region != nil {
+				region.Feather = feather
+				filterOpts.Region = region
+				region, feather = nil, defaultFeather
 			}
+			transforms = append(transforms, Transform{
+				Type:    FilterTransform,
+				Options: filterOpts,
+			})
 
 		// Handle rotate transformations with multiple angles (left, right, 180 degrees).
 		case strings.HasPrefix(arg, "--rotate="):
 			opts := strings.Split(strings.TrimPrefix(arg, "--rotate="), ",")
 			for _, opt := range opts {
-				var angle int
-				switch opt {
-				case "right", "90", "-270":
-					angle = 1
-				case "left", "-90", "270":
-					angle = -1
-				case "-180", "180":
+				angle, ok := lookupName(rotateAngles, opt)
+				if !ok {
+					return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid rotate option: %s", opt))
+				}
+				if angle == "180" {
 					// 180-degree rotation is handled by applying two mirror operations.
 					transforms = append(transforms,
 						Transform{Type: MirrorTransform, Options: MirrorOptions{Direction: "horizontal"}},
 						Transform{Type: MirrorTransform, Options: MirrorOptions{Direction: "vertical"}},
 					)
 					continue
-				default:
-					return nil, "", "", fmt.Errorf("invalid rotate option: %s", opt)
+				}
+				quarters := 1
+				if angle == "left" {
+					quarters = -1
 				}
 				transforms = append(transforms, Transform{
 					Type:    RotateTransform,
-					Options: RotateOptions{Angle: angle},
+					Options: RotateOptions{Angle: quarters},
 				})
 			}
 
@@ -117,40 +369,390 @@ func ParseTransformations(args []string) ([]Transform, string, string, error) {
 		case strings.HasPrefix(arg, "--crop="):
 			cropInfo, err := parseCropInfo(strings.TrimPrefix(arg, "--crop="))
 			if err != nil {
-				return nil, "", "", err
+				return nil, withKind(ErrInvalidParameter, err)
 			}
 			transforms = append(transforms, Transform{
 				Type:    CropTransform,
 				Options: cropInfo,
 			})
+
+		// Handle tee snapshots of the intermediate image.
+		case strings.HasPrefix(arg, "--tee="):
+			path := strings.TrimPrefix(arg, "--tee=")
+			if path == "" {
+				return nil, withKind(ErrInvalidParameter, fmt.Errorf("tee option requires a file path"))
+			}
+			transforms = append(transforms, Transform{
+				Type:    TeeTransform,
+				Options: TeeOptions{Path: path},
+			})
+
+		// Handle guide overlays drawn at composition divisions.
+		case strings.HasPrefix(arg, "--guides="):
+			guidesOpts, err := parseGuidesOptions(strings.TrimPrefix(arg, "--guides="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    GuidesTransform,
+				Options: guidesOpts,
+			})
+
+		// Handle generated gradients, composited over the image or replacing it.
+		case strings.HasPrefix(arg, "--gradient="), strings.HasPrefix(arg, "--gradient-only="):
+			name, value, _ := strings.Cut(arg, "=")
+			gradientOpts, err := parseGradientOptions(value, name == "--gradient-only")
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    GradientTransform,
+				Options: gradientOpts,
+			})
+
+		// Handle exact-size adjustments at the edges of the image.
+		case strings.HasPrefix(arg, "--chop="):
+			chopOpts, err := parseChopOptions(strings.TrimPrefix(arg, "--chop="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    ChopTransform,
+				Options: chopOpts,
+			})
+		case strings.HasPrefix(arg, "--extend="):
+			extendOpts, err := parseExtendOptions(strings.TrimPrefix(arg, "--extend="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    ExtendTransform,
+				Options: extendOpts,
+			})
+
+		// Handle the region the next filter is limited to, with its feathering.
+		case strings.HasPrefix(arg, "--region="):
+			r, err := parseRegion(strings.TrimPrefix(arg, "--region="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			region = r
+		case strings.HasPrefix(arg, "--feather="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--feather="))
+			if err != nil || n < 0 {
+				return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid feather option: %s", arg))
+			}
+			if region == nil {
+				return nil, withKind(ErrInvalidParameter, fmt.Errorf("--feather must follow a --region"))
+			}
+			feather = n
+
+		// Handle the defaults of the filter parameters.
+		case strings.HasPrefix(arg, "--blur-radius="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--blur-radius="))
+			if err != nil || n < 1 {
+				return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid blur-radius option: %s (must be positive)", arg))
+			}
+			blurRadius = n
+		case strings.HasPrefix(arg, "--pixelate-size="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--pixelate-size="))
+			if err != nil || n < 1 {
+				return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid pixelate-size option: %s (must be positive)", arg))
+			}
+			pixelateSize = n
+
+		// Handle pixelation of the regions selected by a mask image.
+		case strings.HasPrefix(arg, "--pixelate-mask="):
+			maskOpts, err := parsePixelateMaskOptions(strings.TrimPrefix(arg, "--pixelate-mask="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    PixelateMaskTransform,
+				Options: maskOpts,
+			})
+
+		// Handle general affine transformations.
+		case strings.HasPrefix(arg, "--affine="), strings.HasPrefix(arg, "--affine-fit="):
+			name, value, _ := strings.Cut(arg, "=")
+			affineOpts, err := parseAffineOptions(value, name == "--affine-fit")
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    AffineTransform,
+				Options: affineOpts,
+			})
+
+		// Handle kaleidoscopes mirroring a wedge around the center.
+		case strings.HasPrefix(arg, "--kaleidoscope="):
+			kaleidoscopeOpts, err := parseKaleidoscopeOptions(strings.TrimPrefix(arg, "--kaleidoscope="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    KaleidoscopeTransform,
+				Options: kaleidoscopeOpts,
+			})
+
+		// Handle scrolling with wrap-around.
+		case strings.HasPrefix(arg, "--scroll="):
+			scrollOpts, err := parseScrollOptions(strings.TrimPrefix(arg, "--scroll="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    ScrollTransform,
+				Options: scrollOpts,
+			})
+
+		// Handle per-pixel channel expressions.
+		case strings.HasPrefix(arg, "--expr="):
+			exprOpts, err := parseExprOptions(strings.TrimPrefix(arg, "--expr="))
+			if err != nil {
+				return nil, withKind(ErrInvalidParameter, err)
+			}
+			transforms = append(transforms, Transform{
+				Type:    ExprTransform,
+				Options: exprOpts,
+			})
 		default:
-			return nil, "", "", fmt.Errorf("incorrect argument: %s", arg)
+			return nil, withKind(ErrInvalidParameter, fmt.Errorf("incorrect argument: %s", arg))
 		}
 	}
 
-	return transforms, inFile, outFile, nil
+	if region != nil {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("--region must be followed by a --filter"))
+	}
+
+	for i, t := range transforms {
+		if opts, ok := t.Options.(FilterOptions); ok {
+			opts.BlurRadius, opts.PixelateSize = blurRadius, pixelateSize
+			transforms[i].Options = opts
+		}
+	}
+
+	return transforms, nil
+}
+
+// ValidateTransformations checks the whole pipeline against an image of the given
+// dimensions without touching any pixels. The dimensions are propagated through
+// the chain, so each transformation is validated against the size the image will
+// have by the time it runs (e.g. a crop after a rotate sees the swapped size).
+// The first invalid transformation is reported as a *TransformError, wrapping
+// an error of kind ErrOutOfBounds or ErrUnsupported.
+func ValidateTransformations(transforms []Transform, width, height int) error {
+	return validateTransformations(transforms, width, height, 0)
+}
+
+// validateTransformations is ValidateTransformations, where a transformation
+// growing the image past maxPixels, unless it is 0, is invalid too. One that
+// doesn't grow it allocates no more than the input already holds, so it is
+// let through even on an image over the limit.
+func validateTransformations(transforms []Transform, width, height int, maxPixels int64) error {
+	for i, t := range transforms {
+		err := t.Options.Validate(width, height)
+		if w, h := t.Options.Dimensions(width, height); err == nil && w*h > width*height {
+			err = checkPixels(w, h, maxPixels)
+		}
+		if err != nil {
+			return &TransformError{Index: i + 1, Name: fmt.Sprint(t.Options), Err: fmt.Errorf("%w (on a %dx%d image)", err, width, height)}
+		}
+		width, height = t.Options.Dimensions(width, height)
+	}
+	return nil
+}
+
+// ResolveTransformations returns a copy of the pipeline with the parameters
+// every transformation runs with on an image of the given dimensions:
+// defaults are filled in and named crop regions are turned into coordinates.
+// The dimensions are propagated through the chain as in ValidateTransformations,
+// which the pipeline must pass.
+func ResolveTransformations(transforms []Transform, width, height int) []Transform {
+	resolved := make([]Transform, len(transforms))
+	for i, t := range transforms {
+		resolved[i] = t
+		if r, ok := t.Options.(resolver); ok {
+			resolved[i].Options = r.resolved(width, height)
+		}
+		width, height = t.Options.Dimensions(width, height)
+	}
+	return resolved
 }
 
 // ApplyTransformations applies the parsed transformations sequentially to the BMP image.
 // Each transformation modifies the image based on the options provided.
+// The whole pipeline is validated up front, so an invalid step fails before
+// any of the earlier steps have run.
 func ApplyTransformations(image *BMPImage, transforms []Transform) error {
-	for _, t := range transforms {
-		switch t.Type {
-		case MirrorTransform:
-			opts := t.Options.(MirrorOptions)
-			MirrorImage(image, opts.Direction)
-		case FilterTransform:
-			opts := t.Options.(FilterOptions)
-			Filter(image, opts.FilterType)
-		case RotateTransform:
-			opts := t.Options.(RotateOptions)
-			Rotate(image, opts.Angle)
-		case CropTransform:
-			opts := t.Options.(CropInfo)
-			if err := Crop(image, opts); err != nil {
-				return err
+	return ApplyTransformationsContext(context.Background(), image, transforms)
+}
+
+// ApplyTransformationsContext is like ApplyTransformations but stops once ctx
+// is done. Between transformations it returns the context's error and leaves
+// the image in the state produced by the last completed transformation. A
+// transformation still running when ctx is done is abandoned rather than
+// waited for, so that a deadline stops even a long blur promptly: the error
+// is then a *TransformError naming it and wrapping the context's error, and
+// the image, which the abandoned transformation may still be modifying, must
+// be discarded. The validation, which reads the headers of mask files, is
+// abandoned the same way.
+//
+// A transformation that fails is reported as a *TransformError, whose kind is
+// that of the validation error (see ValidateTransformations), or ErrIO if
+// a tee snapshot could not be written.
+func ApplyTransformationsContext(ctx context.Context, image *BMPImage, transforms []Transform) error {
+	return ApplyTransformationsWith(ctx, image, transforms, Hooks{}, 0)
+}
+
+// ApplyTransformationsWith is like ApplyTransformationsContext, reporting
+// the progress of the pipeline to hooks as the "apply" stage, counting the
+// transformations completed, and logging each one with how long it took.
+// Unless maxPixels is 0, a transformation growing the image past maxPixels
+// fails validation with an error wrapping ErrPixelLimit.
+func ApplyTransformationsWith(ctx context.Context, image *BMPImage, transforms []Transform, hooks Hooks, maxPixels int64) error {
+	err := runContext(ctx, func() error {
+		return validateTransformations(transforms, int(image.InfoHeader.Width), utils.Abs(int(image.InfoHeader.Height)), maxPixels)
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); errors.Is(err, ctxErr) {
+			return fmt.Errorf("validating the pipeline: %w", ctxErr)
+		}
+		return err
+	}
+
+	// The pointwise filters leading the pipeline run on the palette kept by
+	// ParseOptions.KeepPalette, whose colors replace the pixels before any
+	// other step. Pixels of 16 bits don't come from the palette.
+	indexed := image.indexed
+	image.indexed = nil
+	if image.Wide != nil {
+		indexed = nil
+	}
+	defer func() {
+		if indexed != nil {
+			indexed.expand(image)
+		}
+	}()
+
+	tees := 0
+	hooks.progress("apply", 0, len(transforms))
+	for i, t := range transforms {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		var err error
+		if opts, ok := t.Options.(FilterOptions); !ok || indexed == nil || !FilterPalette(indexed.palette, opts) {
+			if indexed != nil {
+				indexed.expand(image)
+				indexed = nil
 			}
+			err = runContext(ctx, func() error { return applyTransform(image, t, &tees) })
+			if err == nil {
+				err = checkOutput(image)
+			}
+		}
+		if err != nil {
+			return &TransformError{Index: i + 1, Name: fmt.Sprint(t.Options), Err: err}
 		}
+		hooks.infof("%d. %v took %v", i+1, t.Options, time.Since(start).Round(time.Millisecond))
+		hooks.progress("apply", i+1, len(transforms))
+	}
+	return nil
+}
+
+// checkOutput enforces what every transformation must leave behind, so
+// that a degenerate result fails at the step that produced it rather than
+// later on: at least one row of at least one pixel, with Data, and Alpha and
+// Wide if set, holding as many rows of as many pixels as the headers declare.
+func checkOutput(image *BMPImage) error {
+	width, height := int(image.InfoHeader.Width), utils.Abs(int(image.InfoHeader.Height))
+	if width < 1 || height < 1 || len(image.Data) == 0 || len(image.Data[0]) == 0 {
+		return fmt.Errorf("%w: it is %dx%d", ErrEmptyImage, width, height)
+	}
+	return image.checkPlanes()
+}
+
+// runContext runs fn, returning the context's error as soon as ctx is done
+// even if fn hasn't returned. A context that can't be done runs fn in place.
+func runContext(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// applyTransform runs a single validated transformation on image, counting
+// tee snapshots in tees. The transformation is told by the type of its
+// options, so options that don't match its Type can't be misread.
+func applyTransform(image *BMPImage, t Transform, tees *int) error {
+	switch opts := t.Options.(type) {
+	case MirrorOptions:
+		MirrorImage(image, opts.Direction)
+	case FilterOptions:
+		return filterWithOpacity(image, opts)
+	case RotateOptions:
+		Rotate(image, opts.Angle)
+	case CropInfo:
+		return Crop(image, opts)
+	case TeeOptions:
+		*tees++
+		if err := SaveBMP(image, opts.Path); err != nil {
+			return fmt.Errorf("tee #%d: %w", *tees, err)
+		}
+	case GuidesOptions:
+		Guides(image, opts)
+	case GradientOptions:
+		return Gradient(image, opts)
+	case ChopOptions:
+		return Chop(image, opts)
+	case ExtendOptions:
+		return Extend(image, opts)
+	case PixelateMaskOptions:
+		mask, err := LoadImage(opts.Path)
+		if err != nil {
+			return fmt.Errorf("reading mask %s: %w", opts.Path, err)
+		}
+		return PixelateMask(image, mask, opts.BlockSize)
+	case AffineOptions:
+		Affine(image, opts)
+	case KaleidoscopeOptions:
+		Kaleidoscope(image, opts)
+	case ScrollOptions:
+		Scroll(image, opts)
+	case ExprOptions:
+		Expr(image, opts)
+	default:
+		return withKind(ErrUnsupported, fmt.Errorf("unknown transformation options %T", t.Options))
+	}
+	return nil
+}
+
+// filterWithOpacity runs a filter and blends the result over the original
+// pixels at opts.Opacity, which works the same for every filter. Opacity 100
+// runs the filter alone, and opacity 0 skips it.
+func filterWithOpacity(image *BMPImage, opts FilterOptions) error {
+	if opts.Opacity == nil || *opts.Opacity == 100 {
+		return Filter(image, opts)
+	}
+	if *opts.Opacity == 0 {
+		return nil
+	}
+
+	before := image.Clone()
+	if err := Filter(image, opts); err != nil {
+		return err
 	}
+	w := float64(*opts.Opacity) / 100
+	blendWeighted(image, before, func(x, y int) float64 { return w })
 	return nil
 }
@@ -0,0 +1,318 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplyTransformationsValidatesUpFront(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		width     int
+		height    int
+		wantIndex int
+	}{
+		{"crop after rotate", []string{"--rotate=right", "--crop=0-0-80-10"}, 100, 50, 2},
+		{"crop after crop", []string{"--crop=10-10-20-20", "--crop=15-0-10-10"}, 100, 50, 2},
+		{"crop after blur", []string{"--filter=blur", "--crop=0-60-10-10"}, 100, 50, 2},
+		{"pixelate larger than the image", []string{"--filter=negative", "--filter=pixelate", "--pixelate-size=200"}, 100, 50, 2},
+		{"pixelate after crop", []string{"--crop=0-0-10-10", "--filter=pixelate", "--pixelate-size=50"}, 100, 50, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transforms, _, _, err := ParseTransformations(append(tt.args, "in.bmp", "out.bmp"))
+			if err != nil {
+				t.Fatalf("ParseTransformations: %v", err)
+			}
+
+			image := noiseImage(tt.width, tt.height, 1)
+			original := image.Clone()
+			err = ApplyTransformations(image, transforms)
+
+			var te *TransformError
+			if !errors.As(err, &te) {
+				t.Fatalf("got error %v, want a *TransformError", err)
+			}
+			if te.Index != tt.wantIndex {
+				t.Errorf("failing transform %d, want %d", te.Index, tt.wantIndex)
+			}
+			if !errors.Is(err, ErrOutOfBounds) {
+				t.Errorf("error %v is not of kind ErrOutOfBounds", err)
+			}
+			if !gridsEqual(image.Data, original.Data) || image.InfoHeader != original.InfoHeader {
+				t.Error("the image was changed before the invalid transform was rejected")
+			}
+		})
+	}
+}
+
+func TestApplyTransformationsAcceptsValidChain(t *testing.T) {
+	transforms, _, _, err := ParseTransformations([]string{"--rotate=right", "--crop=0-0-50-100", "--filter=pixelate", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatalf("ParseTransformations: %v", err)
+	}
+	image := noiseImage(100, 50, 1)
+	if err := ApplyTransformations(image, transforms); err != nil {
+		t.Fatalf("ApplyTransformations: %v", err)
+	}
+	if w, h := int(image.InfoHeader.Width), len(image.Data); w != 50 || h != 100 {
+		t.Errorf("result is %dx%d, want 50x100", w, h)
+	}
+}
+
+// TestTeeSnapshots checks that every tee snapshot holds, byte for byte, the
+// image as the steps before it leave it, including when the palette of a
+// palettized input was filtered in place of its pixels.
+func TestTeeSnapshots(t *testing.T) {
+	palettized, err := DecodeImageWith(palettizedFixture(13, 9), ParseOptions{KeepPalette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := map[string]*BMPImage{"24-bit": noiseImage(13, 9, 1), "palettized": palettized}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			first, second := filepath.Join(dir, "first.bmp"), filepath.Join(dir, "second.bmp")
+			steps := [][]string{{"--filter=gamma:2.2"}, {"--rotate=right", "--filter=negative"}, {"--filter=blur:2"}}
+			args := slices.Concat(steps[0], []string{"--tee=" + first}, steps[1], []string{"--tee=" + second}, steps[2])
+			transforms, _, _, err := ParseTransformations(append(args, "in.bmp", "out.bmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The clone has no palette, so the steps run on its pixels
+			image := input.Clone()
+			if err := ApplyTransformations(input, transforms); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, path := range []string{first, second} {
+				part, _, _, err := ParseTransformations(append(slices.Clone(steps[i]), "in.bmp", "out.bmp"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ApplyTransformations(image, part); err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := encodeBMP(t, image); !bytes.Equal(got, want) {
+					t.Errorf("tee #%d after %s differs from the image at that point", i+1, strings.Join(steps[i], " "))
+				}
+			}
+		})
+	}
+}
+
+func TestFilterOpacity(t *testing.T) {
+	// A saturated fixture: pure red, green and blue stripes
+	saturated := func() *BMPImage {
+		image := NewImage(6, 4)
+		for _, row := range image.Rows() {
+			for x := range row {
+				row[x] = []Pixel{{Red: 255}, {Green: 255}, {Blue: 255}}[x%3]
+			}
+		}
+		return image
+	}
+	gray := saturated()
+	Filter(gray, FilterOptions{FilterType: "grayscale"})
+
+	apply := func(t *testing.T, filter string, image *BMPImage) {
+		t.Helper()
+		transforms, _, _, err := ParseTransformations([]string{"--filter=" + filter, "in.bmp", "out.bmp"})
+		if err != nil {
+			t.Fatalf("ParseTransformations: %v", err)
+		}
+		if err := ApplyTransformations(image, transforms); err != nil {
+			t.Fatalf("ApplyTransformations: %v", err)
+		}
+	}
+
+	t.Run("50 lands halfway", func(t *testing.T) {
+		image := saturated()
+		apply(t, "grayscale:opacity=50", image)
+		original := saturated()
+		for y := range 4 {
+			for x := range 6 {
+				o, g, got := original.At(x, y), gray.At(x, y), image.At(x, y)
+				half := func(a, b byte) byte { return byte(math.Round((float64(a) + float64(b)) / 2)) }
+				if want := (Pixel{Blue: half(o.Blue, g.Blue), Green: half(o.Green, g.Green), Red: half(o.Red, g.Red)}); got != want {
+					t.Fatalf("(%d, %d) = %v, want %v halfway between %v and %v", x, y, got, want, o, g)
+				}
+			}
+		}
+	})
+
+	for _, filter := range []string{"grayscale", "blur:2:mirror", "levels:20:200", "negative"} {
+		t.Run(filter+" at 100 is the filter alone", func(t *testing.T) {
+			plain, opaque := noiseImage(9, 7, 1), noiseImage(9, 7, 1)
+			apply(t, filter, plain)
+			apply(t, filter+":opacity=100", opaque)
+			if !sameImage(plain, opaque) {
+				t.Error("opacity=100 differs from no opacity")
+			}
+		})
+		t.Run(filter+" at 0 is a no-op", func(t *testing.T) {
+			image := noiseImage(9, 7, 1)
+			apply(t, filter+":opacity=0", image)
+			if !sameImage(image, noiseImage(9, 7, 1)) {
+				t.Error("opacity=0 changed the image")
+			}
+		})
+	}
+
+	t.Run("wide", func(t *testing.T) {
+		image := saturated()
+		image.Widen()
+		apply(t, "grayscale:opacity=25", image)
+		o, g, got := saturated().At(0, 0), gray.At(0, 0), image.narrowed().At(0, 0)
+		if want := 0.75*float64(o.Red) + 0.25*float64(g.Red); math.Abs(float64(got.Red)-want) > 1 {
+			t.Errorf("red %d, want about %.1f", got.Red, want)
+		}
+	})
+
+	for _, value := range []string{"grayscale:opacity=101", "grayscale:opacity=-1", "grayscale:opacity=half", "blur:opacity=50:3"} {
+		if _, err := parseFilterOptions(value); err == nil {
+			t.Errorf("parseFilterOptions(%q) accepted an invalid opacity", value)
+		}
+	}
+}
+
+func TestApplyTransformationsContextDeadline(t *testing.T) {
+	transforms, _, _, err := ParseTransformations([]string{"--filter=blur:40", "--filter=grayscale", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The blur takes far longer than the deadline, so it is abandoned
+	image := noiseImage(4000, 4000, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = ApplyTransformationsContext(ctx, image, transforms)
+
+	var te *TransformError
+	if !errors.As(err, &te) || te.Index != 1 || te.Name != "filter blur:40" {
+		t.Fatalf("error = %v, want a TransformError for transform 1 (filter blur:40)", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v doesn't wrap context.DeadlineExceeded", err)
+	}
+
+	// A context already done stops the pipeline before anything runs
+	image = noiseImage(4, 4, 2)
+	before := image.Clone()
+	if err := ApplyTransformationsContext(ctx, image, transforms); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if !sameImage(image, before) {
+		t.Error("the image changed although the context was done")
+	}
+}
+
+// registerDegenerateFilter registers "test-degenerate", which breaks the
+// shape of the image as its parameter says: "rows" drops every row,
+// "columns" every column and "ragged" the last pixel of the first row.
+var registerDegenerateFilter = sync.OnceValue(func() error {
+	params := []ParamSchema{{Name: "mode", Type: ParamEnum, Values: []string{"rows", "columns", "ragged"}}}
+	return RegisterFilter("test-degenerate", params, func(image *BMPImage, params map[string]string) error {
+		switch params["mode"] {
+		case "rows":
+			image.Data = image.Data[:0]
+		case "columns":
+			for y, row := range image.Data {
+				image.Data[y] = row[:0]
+			}
+		case "ragged":
+			image.Data[0] = image.Data[0][:len(image.Data[0])-1]
+		}
+		return nil
+	})
+})
+
+func TestApplyTransformationsRejectsDegenerateOutput(t *testing.T) {
+	if err := registerDegenerateFilter(); err != nil {
+		t.Fatalf("RegisterFilter: %v", err)
+	}
+
+	tests := []struct {
+		mode string
+		want error
+	}{
+		{"rows", ErrEmptyImage},
+		{"columns", ErrEmptyImage},
+		{"ragged", ErrInconsistentImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			args := []string{"--mirror=horizontal", "--filter=test-degenerate:" + tt.mode, "--rotate=right", "in.bmp", "out.bmp"}
+			transforms, _, _, err := ParseTransformations(args)
+			if err != nil {
+				t.Fatalf("ParseTransformations: %v", err)
+			}
+			err = ApplyTransformations(noiseImage(5, 4, 1), transforms)
+
+			var te *TransformError
+			if !errors.As(err, &te) || te.Index != 2 || te.Name != "filter test-degenerate:"+tt.mode {
+				t.Fatalf("error = %v, want a TransformError for transform 2 (filter test-degenerate:%s)", err, tt.mode)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExtendSharesChopSyntax(t *testing.T) {
+	want := ExtendOptions{Mode: "edge", Edge: "bottom", Count: 2}
+	for _, value := range []string{"bottom:2", "edge:bottom:2"} {
+		transforms, _, _, err := ParseTransformations([]string{"--extend=" + value, "in.bmp", "out.bmp"})
+		if err != nil {
+			t.Fatalf("--extend=%s: %v", value, err)
+		}
+		if got := transforms[0].Options; got != want {
+			t.Errorf("--extend=%s parsed as %+v, want %+v", value, got, want)
+		}
+	}
+	for _, value := range []string{"edge:bottom", "middle:2", "bottom:0", "edge:edge:bottom:2"} {
+		if _, _, _, err := ParseTransformations([]string{"--extend=" + value, "in.bmp", "out.bmp"}); err == nil {
+			t.Errorf("--extend=%s accepted", value)
+		}
+	}
+}
+
+func TestDefaultPixelateOnSmallImage(t *testing.T) {
+	// The default block of 50 pixels is clamped to a 13x7 image
+	transforms, _, _, err := ParseTransformations([]string{"--filter=pixelate", "in.bmp", "out.bmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := noiseImage(13, 7, 1)
+	if err := ApplyTransformations(image, transforms); err != nil {
+		t.Fatalf("ApplyTransformations: %v", err)
+	}
+	for _, row := range image.Rows() {
+		for _, p := range row {
+			if p != image.At(0, 0) {
+				t.Fatalf("pixel %v, want the whole image one block of %v", p, image.At(0, 0))
+			}
+		}
+	}
+	if got := fmt.Sprint(ResolveTransformations(transforms, 13, 7)[0].Options); got != "filter pixelate size 13" {
+		t.Errorf("resolved to %q, want filter pixelate size 13", got)
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import "fmt"
+
+// Mirrored, Rotated and Cropped are the non-mutating forms of MirrorImage,
+// Rotate and Crop, for callers that keep a decoded image, such as a server
+// caching an original, and derive several variants from it. They never
+// modify the source image, and the image they return shares no memory with
+// it: editing either one leaves the other as it was. Since the source is only
+// read, any number of variants may be made from it concurrently, as long as
+// nothing mutates it meanwhile. Package bmp exports them to programs
+// embedding bitmap.
+
+// Mirrored returns a copy of image mirrored in the given direction, which is
+// one of the values of --mirror such as "horizontal", "v" or "vertically".
+// An unknown direction is an error of kind ErrInvalidParameter.
+func Mirrored(image *BMPImage, direction string) (*BMPImage, error) {
+	name, ok := lookupName(mirrorDirections, direction)
+	if !ok {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid mirror direction: %s", direction))
+	}
+	mirrored := image.Clone()
+	MirrorImage(mirrored, name)
+	return mirrored, nil
+}
+
+// Rotated returns a copy of image rotated clockwise by angle degrees, which
+// must be a multiple of 90; negative angles turn counterclockwise. Any other
+// angle is an error of kind ErrInvalidParameter.
+func Rotated(image *BMPImage, angle int) (*BMPImage, error) {
+	if angle%90 != 0 {
+		return nil, withKind(ErrInvalidParameter, fmt.Errorf("invalid rotation angle: %d (must be a multiple of 90)", angle))
+	}
+
+	switch (angle/90%4 + 4) % 4 {
+	case 1:
+		return rotated(image, 1), nil
+	case 2:
+		return rotated(rotated(image, 1), 1), nil
+	case 3:
+		return rotated(image, -1), nil
+	}
+	return image.Clone(), nil
+}
+
+// Cropped returns a copy of the area of image given by rect, which is
+// validated and resolved as by Crop. An area outside the image is an error
+// of kind ErrOutOfBounds.
+func Cropped(image *BMPImage, rect CropInfo) (*BMPImage, error) {
+	width, height := int(image.InfoHeader.Width), len(image.Data)
+	if err := rect.Validate(width, height); err != nil {
+		return nil, err
+	}
+	rect = rect.resolve(width, height)
+	rect.Width, rect.Height = rect.Dimensions(width, height)
+	return cropRect(image, rect), nil
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// variantCases produce a variant from a source image along with the
+// mutating operations that give the same result.
+var variantCases = []struct {
+	name    string
+	variant func(*BMPImage) (*BMPImage, error)
+	mutate  func(*BMPImage) error
+}{
+	{"mirror horizontal", func(b *BMPImage) (*BMPImage, error) { return Mirrored(b, "horizontal") },
+		func(b *BMPImage) error { MirrorImage(b, "horizontal"); return nil }},
+	{"mirror v", func(b *BMPImage) (*BMPImage, error) { return Mirrored(b, "v") },
+		func(b *BMPImage) error { MirrorImage(b, "vertical"); return nil }},
+	{"rotate 90", func(b *BMPImage) (*BMPImage, error) { return Rotated(b, 90) },
+		func(b *BMPImage) error { Rotate(b, 1); return nil }},
+	{"rotate -90", func(b *BMPImage) (*BMPImage, error) { return Rotated(b, -90) },
+		func(b *BMPImage) error { Rotate(b, -1); return nil }},
+	{"rotate 270", func(b *BMPImage) (*BMPImage, error) { return Rotated(b, 270) },
+		func(b *BMPImage) error { Rotate(b, -1); return nil }},
+	{"rotate 180", func(b *BMPImage) (*BMPImage, error) { return Rotated(b, 180) },
+		func(b *BMPImage) error { Rotate(b, 1); Rotate(b, 1); return nil }},
+	{"rotate 360", func(b *BMPImage) (*BMPImage, error) { return Rotated(b, 360) },
+		func(b *BMPImage) error { return nil }},
+	{"crop", func(b *BMPImage) (*BMPImage, error) {
+		return Cropped(b, CropInfo{OffsetX: 2, OffsetY: 1, Width: 5, Height: 3})
+	},
+		func(b *BMPImage) error { return Crop(b, CropInfo{OffsetX: 2, OffsetY: 1, Width: 5, Height: 3}) }},
+	{"crop region", func(b *BMPImage) (*BMPImage, error) { return Cropped(b, CropInfo{Region: "right", Fraction: 0.5}) },
+		func(b *BMPImage) error { return Crop(b, CropInfo{Region: "right", Fraction: 0.5}) }},
+}
+
+// variantSource returns a transparent, widened image so that every plane
+// of the image is exercised.
+func variantSource() *BMPImage {
+	image := withAlpha(noiseImage(9, 6, 1))
+	image.Widen()
+	return image
+}
+
+// sameImage reports whether a and b have identical headers and planes.
+func sameImage(a, b *BMPImage) bool {
+	return a.Header == b.Header && a.InfoHeader == b.InfoHeader &&
+		gridsEqual(a.Data, b.Data) && gridsEqual(a.Alpha, b.Alpha) && gridsEqual(a.Wide, b.Wide)
+}
+
+func TestVariantsLeaveTheSourceAlone(t *testing.T) {
+	for _, tt := range variantCases {
+		t.Run(tt.name, func(t *testing.T) {
+			source := variantSource()
+			before := source.Clone()
+
+			variant, err := tt.variant(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameImage(source, before) {
+				t.Fatal("making the variant changed the source")
+			}
+
+			// The variant shares no memory with the source
+			for _, row := range variant.Data {
+				for x := range row {
+					row[x] = Pixel{Red: 1}
+				}
+			}
+			for _, row := range variant.Alpha {
+				clear(row)
+			}
+			for _, row := range variant.Wide {
+				clear(row)
+			}
+			if !sameImage(source, before) {
+				t.Error("editing the variant changed the source")
+			}
+		})
+	}
+}
+
+func TestVariantsMatchMutatingForms(t *testing.T) {
+	for _, tt := range variantCases {
+		t.Run(tt.name, func(t *testing.T) {
+			want := variantSource()
+			if err := tt.mutate(want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.variant(variantSource())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameImage(got, want) {
+				t.Error("the variant differs from the result of the mutating form")
+			}
+		})
+	}
+}
+
+func TestVariantsFromCachedDecode(t *testing.T) {
+	file := encodeBMP(t, noiseImage(11, 7, 2))
+	cached, err := ParseBMP(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make every variant twice from the one decode, as a server would
+	for round := range 2 {
+		for _, tt := range variantCases {
+			t.Run(fmt.Sprintf("%s round %d", tt.name, round), func(t *testing.T) {
+				fresh, err := ParseBMP(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := tt.mutate(fresh); err != nil {
+					t.Fatal(err)
+				}
+				variant, err := tt.variant(cached)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(encodeBMP(t, variant), encodeBMP(t, fresh)) {
+					t.Error("the variant of the cached decode differs from a decode per request")
+				}
+			})
+		}
+	}
+}
+
+func TestVariantErrors(t *testing.T) {
+	source := noiseImage(4, 4, 1)
+	tests := []struct {
+		name string
+		run  func() (*BMPImage, error)
+		kind error
+	}{
+		{"mirror direction", func() (*BMPImage, error) { return Mirrored(source, "diagonal") }, ErrInvalidParameter},
+		{"rotation angle", func() (*BMPImage, error) { return Rotated(source, 45) }, ErrInvalidParameter},
+		{"crop outside", func() (*BMPImage, error) { return Cropped(source, CropInfo{OffsetX: 3, Width: 2, Height: 1}) }, ErrOutOfBounds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := tt.run()
+			if image != nil || !errors.Is(err, tt.kind) {
+				t.Errorf("got %v, %v, want an error of kind %v", image, err, tt.kind)
+			}
+		})
+	}
+}
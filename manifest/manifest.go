@@ -0,0 +1,47 @@
+// Package manifest defines the JSON sidecar written next to an output by
+// bitmap apply --write-manifest, for tools that audit how images were made.
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Manifest records how an output image was produced.
+type Manifest struct {
+	Input       string      `json:"input"`
+	InputSHA256 string      `json:"input_sha256"`
+	Output      string      `json:"output"`
+	Format      string      `json:"format"`
+	Transforms  []Transform `json:"transforms"`
+	Version     string      `json:"version"`
+	Created     time.Time   `json:"created"`
+}
+
+// Transform is one step of the pipeline in a Manifest, with the parameters
+// it ran with: defaults are filled in and size-dependent parameters, such as
+// named crop regions, are resolved against the image it was applied to.
+type Transform struct {
+	Type        string          `json:"type"`        // Flag name of the transformation, e.g. "filter" or "crop"
+	Description string          `json:"description"` // Human readable summary, as printed by --dry-run
+	Options     json.RawMessage `json:"options"`     // Parameters of the step, the JSON form of its options type
+}
+
+// Path returns the path of the manifest written for outFile.
+func Path(outFile string) string {
+	return outFile + ".json"
+}
+
+// Read reads the manifest at path.
+func Read(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,44 @@
+// Package rawdesc defines the JSON descriptor written next to a raw pixel
+// dump by bitmap export-raw and read back by bitmap import-raw, so that other
+// tools can find the layout of the pixels without parsing any image format.
+package rawdesc
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Corners the first row of a dump can start at.
+const (
+	OriginTopLeft    = "top-left"    // Rows go from the visual top down
+	OriginBottomLeft = "bottom-left" // Rows go from the visual bottom up, as stored in a BMP
+)
+
+// Descriptor describes the layout of a raw pixel dump: Height rows of Stride
+// bytes each, holding Width pixels of one byte per channel followed by zero
+// padding up to Stride.
+type Descriptor struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Channels string `json:"channels"` // Order of the channel bytes of a pixel, e.g. "bgr", "rgb" or "rgba"
+	Stride   int    `json:"stride"`   // Bytes per row, padding included
+	Origin   string `json:"origin"`   // OriginTopLeft or OriginBottomLeft
+}
+
+// Path returns the path of the descriptor written for rawFile.
+func Path(rawFile string) string {
+	return rawFile + ".json"
+}
+
+// Read reads the descriptor at path.
+func Read(path string) (*Descriptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d Descriptor
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}